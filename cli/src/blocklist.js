@@ -0,0 +1,112 @@
+"use strict";
+
+const url = require("url");
+
+// Hosts serving ads (matched including their subdomains)
+const adHosts = [
+    "doubleclick.net",
+    "googlesyndication.com",
+    "googleadservices.com",
+    "adservice.google.com",
+    "amazon-adsystem.com",
+    "adnxs.com",
+    "advertising.com",
+    "adform.net",
+    "criteo.com",
+    "criteo.net",
+    "outbrain.com",
+    "taboola.com",
+    "pubmatic.com",
+    "rubiconproject.com",
+    "openx.net",
+    "casalemedia.com",
+    "moatads.com",
+    "media.net",
+    "serving-sys.com",
+    "smartadserver.com",
+];
+
+// Hosts serving trackers, and analytics
+const trackerHosts = [
+    "google-analytics.com",
+    "googletagmanager.com",
+    "googletagservices.com",
+    "connect.facebook.net",
+    "facebook.com/tr",
+    "hotjar.com",
+    "mixpanel.com",
+    "segment.com",
+    "segment.io",
+    "scorecardresearch.com",
+    "quantserve.com",
+    "chartbeat.com",
+    "newrelic.com",
+    "nr-data.net",
+    "optimizely.com",
+    "fullstory.com",
+    "clarity.ms",
+    "bat.bing.com",
+    "krxd.net",
+    "bluekai.com",
+];
+
+const extensions = {
+    "fonts": /\.(woff2?|ttf|otf|eot)$/i,
+    "images": /\.(png|jpe?g|gif|webp|svg|ico|bmp)$/i,
+    "media": /\.(mp4|webm|ogg|ogv|mp3|wav|m4a|mov)$/i,
+    "scripts": /\.js$/i,
+};
+
+const resourceTypes = {
+    "images": ["image"],
+    "media": ["media"],
+    "scripts": ["script"],
+};
+
+const Types = ["ads", "trackers", "fonts", "images", "media", "scripts"];
+
+const _escape = (s) => s.replace(/[.+?^${}()|[\]\\]/g, "\\$&");
+
+// Converts hosts (optionally followed by a path) to RegExps, matching their
+// subdomains too
+const _hostRegExps = (hosts) => {
+    return hosts.map((h) => new RegExp("(^|\\.)" + _escape(h) + "(/|$)", "i"));
+};
+
+const hostRegExps = {
+    "ads": _hostRegExps(adHosts),
+    "trackers": _hostRegExps(trackerHosts),
+};
+
+// Converts a URL pattern, where '*' matches any characters, to a RegExp
+const _patternRegExp = (pattern) => {
+    return new RegExp("^" + pattern.split("*").map(_escape).join(".*") + "$", "i");
+};
+
+// Returns a function testing if a request should be blocked, given the
+// blocked resource types, and URL patterns
+const matcher = (types, patterns) => {
+    const regExps = patterns.map(_patternRegExp);
+    return (details) => {
+        if (details.resourceType === "mainFrame") {
+            return false;
+        }
+        if (regExps.some((r) => r.test(details.url))) {
+            return true;
+        }
+        const u = url.parse(details.url);
+        const hostPath = u.hostname + u.pathname;
+        return types.some((t) => {
+            if (hostRegExps[t]) {
+                return hostRegExps[t].some((r) => r.test(hostPath));
+            }
+            return (resourceTypes[t] || []).indexOf(details.resourceType) !== -1 ||
+                extensions[t].test(u.pathname || "");
+        });
+    };
+};
+
+module.exports = {
+    Types: Types,
+    matcher: matcher,
+};
@@ -0,0 +1,34 @@
+// Makes the links of the page print as working link annotations: links to
+// fragments of the page are relative, so that they go to their target in the
+// output (even if the page has a base URL), and links to local files (e.g.
+// relative links of uploaded documents), and scripts are removed, as they
+// cannot be followed from the output. It is called with a base URL relative
+// links are resolved against instead of the page (or null), and whether
+// links leaving the page are removed.
+(function(base, stripExternal) {
+    var page = location.href.split("#")[0];
+    var links = document.querySelectorAll("a[href], area[href]");
+    for (var i = 0, l = links.length; i < l; i++) {
+        var link = links[i];
+        var href = link.getAttribute("href").trim();
+        if (href.charAt(0) === "#") {
+            continue;
+        }
+        if (link.href.split("#")[0] === page && link.hash) {
+            link.setAttribute("href", link.hash);
+            continue;
+        }
+        if (base && !/^[a-z][a-z0-9+.-]*:/i.test(href)) {
+            try {
+                link.setAttribute("href", new URL(href, base).href);
+            } catch (e) {
+                // Links that are not URLs are removed below
+            }
+        }
+        var url = link.href;
+        var internal = url.split("#")[0] === page;
+        if (/^(file|javascript|blob):/i.test(url) && !internal || stripExternal && !internal) {
+            link.removeAttribute("href");
+        }
+    }
+})
@@ -0,0 +1,10 @@
+var sheets = document.querySelectorAll("link[rel='stylesheet'][media], style[media]");
+
+for (var i = 0, l = sheets.length; i < l; i++) {
+    var media = sheets[i].getAttribute("media");
+    if (/screen/i.test(media)) {
+        sheets[i].removeAttribute("media");
+    } else if (/print/i.test(media)) {
+        sheets[i].setAttribute("media", "not all");
+    }
+}
@@ -0,0 +1,86 @@
+// Masks personal data in the page before it is saved: every match of the
+// patterns in its text (including form values, and the title), and in the
+// attributes shown, or followed from the output (e.g. 'alt', or 'mailto:'
+// links) is replaced with a block of the same length. It is called with the
+// patterns ([source, flags, luhn] arrays, where matches of patterns with luhn
+// set are only masked if they pass the Luhn check, e.g. card numbers), and
+// returns the number of masked matches.
+(function(patterns) {
+    var MASK = "█";
+    var count = 0;
+
+    var luhn = function(s) {
+        var digits = s.replace(/\D/g, "");
+        var sum = 0;
+        for (var i = 0; i < digits.length; i++) {
+            var d = +digits.charAt(digits.length - 1 - i);
+            if (i % 2 === 1) {
+                d = d * 2 > 9 ? d * 2 - 9 : d * 2;
+            }
+            sum += d;
+        }
+        return sum % 10 === 0;
+    };
+
+    var regexps = patterns.map(function(p) {
+        var flags = p[1].indexOf("g") === -1 ? p[1] + "g" : p[1];
+        return {re: new RegExp(p[0], flags), luhn: p[2]};
+    });
+
+    var redact = function(s) {
+        if (!s) {
+            return s;
+        }
+        regexps.forEach(function(r) {
+            s = s.replace(r.re, function(m) {
+                if (m.length === 0 || r.luhn && !luhn(m)) {
+                    return m;
+                }
+                count++;
+                return new Array(m.length + 1).join(MASK);
+            });
+        });
+        return s;
+    };
+
+    // Text, and comments, including the content of scripts (which have
+    // already run), as they are saved with the DOM. Styles are kept, so that
+    // the page still renders the same.
+    var walker = document.createTreeWalker(document.documentElement, NodeFilter.SHOW_TEXT | NodeFilter.SHOW_COMMENT, null, false);
+    for (var node = walker.nextNode(); node; node = walker.nextNode()) {
+        if (node.parentNode && node.parentNode.nodeName === "STYLE") {
+            continue;
+        }
+        var text = redact(node.nodeValue);
+        if (text !== node.nodeValue) {
+            node.nodeValue = text;
+        }
+    }
+
+    var attributes = ["alt", "title", "placeholder", "value", "aria-label", "content", "href", "src"];
+    var elements = document.querySelectorAll("*");
+    for (var i = 0, l = elements.length; i < l; i++) {
+        var el = elements[i];
+        attributes.forEach(function(name) {
+            var value = el.getAttribute(name);
+            if (value === null) {
+                return;
+            }
+            var redacted = redact(value);
+            if (redacted === value) {
+                return;
+            }
+            // Redacted URLs cannot be followed
+            if (name === "href" || name === "src") {
+                el.removeAttribute(name);
+            } else {
+                el.setAttribute(name, redacted);
+            }
+        });
+        if ((el.nodeName === "INPUT" || el.nodeName === "TEXTAREA") && el.value) {
+            el.value = redact(el.value);
+        }
+    }
+    document.title = redact(document.title);
+    return count;
+})
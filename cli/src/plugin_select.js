@@ -0,0 +1,28 @@
+// Hides everything but the elements matching a selector (and their
+// content), so that only they are printed. Their ancestors are kept, so that
+// the styles of the page still apply to them. It is called with the selector,
+// and returns the number of matching elements.
+(function(selector) {
+    var selected = document.querySelectorAll(selector);
+    var keep = [];
+    for (var i = 0, l = selected.length; i < l; i++) {
+        for (var el = selected[i]; el && keep.indexOf(el) === -1; el = el.parentElement) {
+            keep.push(el);
+        }
+    }
+
+    var hide = function(parent) {
+        for (var child = parent.firstElementChild; child; child = child.nextElementSibling) {
+            if (keep.indexOf(child) === -1) {
+                child.style.setProperty("display", "none", "important");
+            } else if (!child.matches(selector)) {
+                hide(child);
+            }
+        }
+    };
+
+    if (selected.length > 0) {
+        hide(document.documentElement);
+    }
+    return selected.length;
+})
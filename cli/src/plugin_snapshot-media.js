@@ -0,0 +1,58 @@
+// Replaces canvases with images of their content, and videos with their
+// poster (or their current frame), as they may be printed blank. It runs when
+// the page is saved, so that deferred drawing (e.g. animated charts) is kept.
+(function() {
+    var images = [];
+
+    var replace = function(el, src) {
+        var img = document.createElement("img");
+        var rect = el.getBoundingClientRect();
+        img.className = el.className;
+        img.style.cssText = el.style.cssText;
+        img.style.width = rect.width + "px";
+        img.style.height = rect.height + "px";
+        img.style.objectFit = "contain";
+        img.src = src;
+        el.parentNode.replaceChild(img, el);
+        images.push(img);
+    };
+
+    var canvases = document.querySelectorAll("canvas");
+    for (var i = 0, l = canvases.length; i < l; i++) {
+        try {
+            replace(canvases[i], canvases[i].toDataURL("image/png"));
+        } catch (e) {
+            // Canvases with cross-origin content cannot be read
+        }
+    }
+
+    var videos = document.querySelectorAll("video");
+    for (var i = 0, l = videos.length; i < l; i++) {
+        var video = videos[i];
+        if (video.poster) {
+            replace(video, video.poster);
+        } else if (video.readyState >= 2) {
+            var frame = document.createElement("canvas");
+            frame.width = video.videoWidth;
+            frame.height = video.videoHeight;
+            try {
+                frame.getContext("2d").drawImage(video, 0, 0);
+                replace(video, frame.toDataURL("image/png"));
+            } catch (e) {
+                // Videos with cross-origin content cannot be read
+            }
+        }
+    }
+
+    // Posters are loaded before the page is saved (for up to 5 seconds)
+    return Promise.race([
+        Promise.all(images.map(function(img) {
+            return img.complete ? null : new Promise(function(resolve) {
+                img.onload = img.onerror = resolve;
+            });
+        })),
+        new Promise(function(resolve) {
+            setTimeout(resolve, 5000);
+        })
+    ]);
+})();
@@ -0,0 +1,219 @@
+"use strict";
+
+const crypto = require("crypto");
+const fs = require("fs");
+const url = require("url");
+
+// Records the network requests, and responses of a page (using the DevTools
+// protocol), and writes them to a WARC 1.1 file: a 'warcinfo' record, and a
+// 'request', and 'response' record for every exchange, with the digests of
+// their content, so that the archive can be verified.
+
+// Schemes of the requests that are not made over the network
+const localSchemes = ["data:", "blob:", "about:", "chrome:", "chrome-extension:", "devtools:", "file:"];
+
+// Response headers that do not describe the recorded body, which is decoded,
+// and complete. They are kept with an 'X-Archive-Orig-' prefix.
+const rewrittenHeaders = ["content-encoding", "content-length", "transfer-encoding"];
+
+const BASE32 = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567";
+
+const base32 = (buf) => {
+    let out = "";
+    let bits = 0;
+    let value = 0;
+    for (let i = 0; i < buf.length; i++) {
+        value = (value << 8) | buf[i];
+        bits += 8;
+        while (bits >= 5) {
+            out += BASE32[(value >>> (bits - 5)) & 31];
+            bits -= 5;
+        }
+    }
+    if (bits > 0) {
+        out += BASE32[(value << (5 - bits)) & 31];
+    }
+    while (out.length % 8 !== 0) {
+        out += "=";
+    }
+    return out;
+};
+
+// The SHA-1 digest of a record block, or payload (as in WARC-Block-Digest)
+const digest = (buf) => {
+    return "sha1:" + base32(crypto.createHash("sha1").update(buf).digest());
+};
+
+const uuid = () => {
+    const b = crypto.randomBytes(16);
+    b[6] = (b[6] & 0x0f) | 0x40;
+    b[8] = (b[8] & 0x3f) | 0x80;
+    const h = b.toString("hex");
+    return `<urn:uuid:${h.slice(0, 8)}-${h.slice(8, 12)}-${h.slice(12, 16)}-${h.slice(16, 20)}-${h.slice(20)}>`;
+};
+
+// Header lines of DevTools headers (multiple values are separated by new
+// lines)
+const headerLines = (headers, rewrite) => {
+    let lines = "";
+    Object.keys(headers || {}).forEach((name) => {
+        const key = rewrite && rewrittenHeaders.indexOf(name.toLowerCase()) !== -1 ? `X-Archive-Orig-${name}` : name;
+        String(headers[name]).split("\n").forEach((value) => {
+            lines += `${key}: ${value}\r\n`;
+        });
+    });
+    return lines;
+};
+
+const hasHeader = (headers, name) => {
+    return Object.keys(headers || {}).some((key) => key.toLowerCase() === name);
+};
+
+const record = (type, date, fields, block) => {
+    let head = `WARC/1.1\r\nWARC-Type: ${type}\r\nWARC-Record-ID: ${fields.id || uuid()}\r\nWARC-Date: ${date}\r\n`;
+    Object.keys(fields).forEach((name) => {
+        if (name !== "id" && fields[name] !== undefined && fields[name] !== "") {
+            head += `${name}: ${fields[name]}\r\n`;
+        }
+    });
+    head += `WARC-Block-Digest: ${digest(block)}\r\nContent-Length: ${block.length}\r\n\r\n`;
+    return Buffer.concat([Buffer.from(head, "utf8"), block, Buffer.from("\r\n\r\n", "utf8")]);
+};
+
+// The request, and response records of an exchange
+const exchangeRecords = (ex) => {
+    const date = new Date((ex.wallTime || Date.now() / 1000) * 1000).toISOString().replace(/\.\d+Z$/, "Z");
+    const u = url.parse(ex.url);
+
+    const requestHeaders = ex.response.requestHeaders || ex.request.headers;
+    let requestHead = `${ex.request.method} ${u.path || "/"} HTTP/1.1\r\n`;
+    if (!hasHeader(requestHeaders, "host")) {
+        requestHead += `Host: ${u.host}\r\n`;
+    }
+    requestHead += headerLines(requestHeaders, false) + "\r\n";
+    const requestBlock = Buffer.concat([Buffer.from(requestHead, "utf8"), Buffer.from(ex.request.postData || "", "utf8")]);
+
+    const res = ex.response;
+    let responseHead = `HTTP/1.1 ${res.status} ${res.statusText || ""}\r\n`;
+    responseHead += headerLines(res.headers, true);
+    responseHead += `Content-Length: ${ex.body.length}\r\n\r\n`;
+    const responseBlock = Buffer.concat([Buffer.from(responseHead, "utf8"), ex.body]);
+
+    const responseID = uuid();
+    return [
+        record("response", date, {
+            id: responseID,
+            "WARC-Target-URI": ex.url,
+            "WARC-IP-Address": res.remoteIPAddress,
+            "WARC-Payload-Digest": digest(ex.body),
+            "WARC-Truncated": ex.truncated ? "unspecified" : undefined,
+            "Content-Type": "application/http; msgtype=response"
+        }, responseBlock),
+        record("request", date, {
+            "WARC-Target-URI": ex.url,
+            "WARC-Concurrent-To": responseID,
+            "Content-Type": "application/http; msgtype=request"
+        }, requestBlock)
+    ];
+};
+
+const sendCommand = (dbg, method, params) => {
+    return new Promise((resolve, reject) => {
+        dbg.sendCommand(method, params || {}, (err, result) => {
+            if (err && err.message) {
+                reject(new Error(err.message));
+                return;
+            }
+            resolve(result);
+        });
+    });
+};
+
+// recorder starts recording the exchanges of a page. It must be called before
+// the page starts loading. The returned recorder's save(path) writes the
+// exchanges that have finished to a WARC file, and returns a promise.
+const recorder = (webContents, software) => {
+    const dbg = webContents.debugger;
+    dbg.attach("1.1");
+    // Bodies are kept until they are read, so that they are not evicted
+    const enabled = sendCommand(dbg, "Network.enable", {
+        maxTotalBufferSize: 256 * 1024 * 1024,
+        maxResourceBufferSize: 64 * 1024 * 1024
+    });
+
+    const exchanges = [];
+    const pending = {};
+
+    const finish = (ex, body) => {
+        ex.done = body.then((b) => {
+            ex.body = b;
+        }, () => {
+            ex.body = Buffer.alloc(0);
+            ex.truncated = true;
+        });
+    };
+
+    dbg.on("message", (e, method, params) => {
+        if (method === "Network.requestWillBeSent") {
+            const previous = pending[params.requestId];
+            // A redirect finishes the previous request of the chain
+            if (previous && params.redirectResponse) {
+                previous.response = params.redirectResponse;
+                finish(previous, Promise.resolve(Buffer.alloc(0)));
+            }
+            delete pending[params.requestId];
+            if (localSchemes.indexOf(url.parse(params.request.url).protocol) !== -1) {
+                return;
+            }
+            const ex = {
+                url: params.request.url,
+                request: params.request,
+                wallTime: params.wallTime
+            };
+            exchanges.push(ex);
+            pending[params.requestId] = ex;
+        } else if (method === "Network.responseReceived") {
+            const ex = pending[params.requestId];
+            if (ex) {
+                ex.response = params.response;
+            }
+        } else if (method === "Network.loadingFinished") {
+            const ex = pending[params.requestId];
+            if (ex && ex.response) {
+                finish(ex, sendCommand(dbg, "Network.getResponseBody", {requestId: params.requestId}).then((r) => {
+                    return Buffer.from(r.body, r.base64Encoded ? "base64" : "utf8");
+                }));
+            } else if (ex) {
+                exchanges.splice(exchanges.indexOf(ex), 1);
+            }
+            delete pending[params.requestId];
+        } else if (method === "Network.loadingFailed") {
+            const ex = pending[params.requestId];
+            if (ex) {
+                exchanges.splice(exchanges.indexOf(ex), 1);
+            }
+            delete pending[params.requestId];
+        }
+    });
+
+    const save = (path) => {
+        return enabled.then(() => {
+            const finished = exchanges.filter((ex) => ex.done);
+            return Promise.all(finished.map((ex) => ex.done)).then(() => finished);
+        }).then((finished) => {
+            const info = `software: ${software}\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n`;
+            const date = new Date().toISOString().replace(/\.\d+Z$/, "Z");
+            let records = [record("warcinfo", date, {"Content-Type": "application/warc-fields"}, Buffer.from(info, "utf8"))];
+            finished.forEach((ex) => {
+                records = records.concat(exchangeRecords(ex));
+            });
+            fs.writeFileSync(path, Buffer.concat(records));
+        });
+    };
+
+    return {save: save};
+};
+
+module.exports = {
+    recorder: recorder
+};
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+var (
+	// ErrAttachmentsFormat should be returned when attachments are requested
+	// for an output format other than PDF.
+	ErrAttachmentsFormat = errors.New("attachments are only supported by the PDF format")
+	// ErrAttachmentsInvalid should be returned when the attachments of a
+	// request cannot be read.
+	ErrAttachmentsInvalid = errors.New("invalid attachments provided (expected files, or contents in plain text, or base64)")
+)
+
+// AttachmentOptions is a file embedded in the output PDF of a v2 conversion
+// request.
+type AttachmentOptions struct {
+	Name string `json:"name"`
+	// The file itself.
+	Content string `json:"content"`
+	// The encoding of the content: empty (plain), or 'base64'.
+	Encoding string `json:"encoding,omitempty"`
+	// The type of the file, e.g. 'text/xml'.
+	MimeType    string `json:"mime_type,omitempty"`
+	Description string `json:"description,omitempty"`
+	// The relationship of the file to the document, e.g. 'Data' (see
+	// pdf.Attachment).
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// attachSource returns true if the rendered source (DOM) of a conversion
+// should be embedded in its output ('attachSource').
+func attachSource(c *gin.Context) bool {
+	return queryFlag(c, "attachSource")
+}
+
+// requestAttachments returns the files embedded in the output of a
+// conversion: the attachments of a v2 request, and the files uploaded as
+// 'attachment' (with the relationship in 'attachment_relationship'). Together
+// they must fit in the spool quota. They are read once per request.
+func requestAttachments(c *gin.Context) ([]pdf.Attachment, error) {
+	if files, ok := c.Get("attachments"); ok {
+		return files.([]pdf.Attachment), nil
+	}
+	conf := c.MustGet("config").(Config)
+	used := 0
+
+	var files []pdf.Attachment
+	if req, ok := c.Get("conversion_request"); ok {
+		for _, a := range req.(ConversionRequest).Output.Attachments {
+			data := []byte(a.Content)
+			switch a.Encoding {
+			case "":
+			case "base64":
+				var err error
+				if data, err = base64.StdEncoding.DecodeString(a.Content); err != nil {
+					return nil, ErrAttachmentsInvalid
+				}
+			default:
+				return nil, ErrAttachmentsInvalid
+			}
+			if used += len(data); conf.Spool.MaxBytes > 0 && used > conf.Spool.MaxBytes {
+				return nil, ErrSourceTooLarge
+			}
+			files = append(files, pdf.Attachment{
+				Name:         a.Name,
+				MimeType:     a.MimeType,
+				Description:  a.Description,
+				Relationship: a.Relationship,
+				Data:         data,
+			})
+		}
+	}
+	if form := c.Request.MultipartForm; form != nil {
+		for _, header := range form.File["attachment"] {
+			f, err := header.Open()
+			if err != nil {
+				return nil, ErrAttachmentsInvalid
+			}
+			b, err := readLimited(f, conf.Spool.MaxBytes, &used)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, pdf.Attachment{
+				Name:         path.Base(header.Filename),
+				MimeType:     header.Header.Get("Content-Type"),
+				Relationship: c.Query("attachment_relationship"),
+				Data:         b,
+			})
+		}
+	}
+	c.Set("attachments", files)
+	return files, nil
+}
+
+// checkAttachments checks that the attachments of a conversion can be
+// embedded in its output.
+func checkAttachments(c *gin.Context) error {
+	files, err := requestAttachments(c)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && !attachSource(c) {
+		return nil
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+		return ErrAttachmentsFormat
+	}
+	if attachSource(c) {
+		files = append(files[:len(files):len(files)], pdf.Attachment{Name: athenapdf.SourceAttachment})
+	}
+	return pdf.CheckAttachments(files)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+func TestRequestAttachments(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	f, _ := w.CreateFormFile("attachment", "factur-x.xml")
+	f.Write([]byte("<rsm:CrossIndustryInvoice/>"))
+	w.Close()
+
+	tests := []struct {
+		query       string
+		attachments []AttachmentOptions
+		names       []string
+		err         error
+	}{
+		{"?attachment_relationship=Alternative", nil, []string{"factur-x.xml"}, nil},
+		{"", []AttachmentOptions{{Name: "data.json", Content: "e30=", Encoding: "base64"}}, []string{"data.json", "factur-x.xml"}, nil},
+		{"", []AttachmentOptions{{Name: "data.json", Content: "{}", Encoding: "gzip"}}, nil, ErrAttachmentsInvalid},
+		{"", []AttachmentOptions{{Name: "factur-x.xml", Content: "<invoice/>"}}, nil, pdf.ErrAttachmentName},
+		{"?attachSource", []AttachmentOptions{{Name: "source.html", Content: "<html></html>"}}, nil, pdf.ErrAttachmentName},
+		{"?attachment_relationship=Invoice", nil, nil, pdf.ErrRelationshipInvalid},
+		{"?format=markdown", nil, nil, ErrAttachmentsFormat},
+	}
+	for _, tt := range tests {
+		var files []pdf.Attachment
+		var err error
+		r := gin.New()
+		r.Use(ConfigMiddleware(Config{}))
+		r.POST("/", func(c *gin.Context) {
+			c.Request.ParseMultipartForm(maxDocumentMemory)
+			c.Set("conversion_request", ConversionRequest{Output: OutputOptions{Attachments: tt.attachments}})
+			if err = checkAttachments(c); err == nil {
+				files, _ = requestAttachments(c)
+			}
+		})
+		req, _ := http.NewRequest("POST", "/"+tt.query, bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if err != tt.err {
+			t.Errorf("expected attachments of %q to return %v, got %v", tt.query, tt.err, err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("expected attachments of %q to be %v, got %v", tt.query, tt.names, names)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package audit records a structured trail of every conversion request.
+package audit
+
+import (
+	"log"
+	"time"
+)
+
+// Record is a single audited conversion request.
+type Record struct {
+	Time time.Time `json:"time"`
+	// JobID is the ID of the conversion (see events.Event).
+	JobID string `json:"job_id,omitempty"`
+	// Tenant is the ID of the requesting tenant (empty for the admin key or
+	// if multi-tenancy is disabled).
+	Tenant     string `json:"tenant,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	// Source is the requested URL or the name of the uploaded file.
+	Source string `json:"source,omitempty"`
+	// SourceHash is the SHA-256 hash (hex) of an uploaded file.
+	SourceHash string `json:"source_hash,omitempty"`
+	// Options contains the request options, without secrets.
+	Options     map[string]string `json:"options,omitempty"`
+	Status      int               `json:"status"`
+	Outcome     string            `json:"outcome"`
+	Error       string            `json:"error,omitempty"`
+	OutputBytes int               `json:"output_bytes"`
+	DurationMS  int64             `json:"duration_ms"`
+}
+
+// Outcomes of an audited request.
+const (
+	OutcomeSuccess = "success"
+	OutcomeQueued  = "queued"
+	OutcomeFailed  = "failed"
+)
+
+// Sink stores audit records.
+type Sink interface {
+	Write(Record) error
+}
+
+// Pruner may be implemented by sinks that can enforce a retention period.
+type Pruner interface {
+	// Prune deletes all records older than the given time.
+	Prune(before time.Time) error
+}
+
+// StartRetention prunes records older than the retention period from the
+// sink once an hour until the done channel is closed. It does nothing if
+// the sink does not support pruning or the retention period is zero.
+func StartRetention(s Sink, retention time.Duration, done <-chan struct{}) {
+	p, ok := s.(Pruner)
+	if !ok || retention <= 0 {
+		return
+	}
+	prune := func() {
+		if err := p.Prune(time.Now().Add(-retention)); err != nil {
+			log.Printf("[Audit] unable to prune records: %+v\n", err)
+		}
+	}
+	go func() {
+		prune()
+		t := time.NewTicker(time.Hour)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				prune()
+			}
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileDateLayout = "2006-01-02"
+
+// FileSink writes audit records as JSON lines to daily files
+// (audit-YYYY-MM-DD.log, UTC) in a directory.
+type FileSink struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileSink creates a file sink in the given directory. The directory is
+// created if it does not exist.
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+func (s *FileSink) path(t time.Time) string {
+	return filepath.Join(s.dir, "audit-"+t.UTC().Format(fileDateLayout)+".log")
+}
+
+// Write appends a record to the file of the record's day.
+func (s *FileSink) Write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(r.Time), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Prune deletes the files of all days before the given time.
+func (s *FileSink) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	cutoff := before.UTC().Format(fileDateLayout)
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, "audit-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		day := strings.TrimSuffix(strings.TrimPrefix(name, "audit-"), ".log")
+		if day < cutoff {
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
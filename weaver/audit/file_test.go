@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSink_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := NewFileSink(dir)
+	now := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	s.Write(Record{Time: now, Source: "http://example.com", Outcome: OutcomeSuccess})
+	s.Write(Record{Time: now, Source: "http://example.org", Outcome: OutcomeFailed})
+
+	f, err := os.Open(filepath.Join(dir, "audit-2018-06-01.log"))
+	if err != nil {
+		t.Fatalf("unable to open audit file: %+v", err)
+	}
+	defer f.Close()
+	var records []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("unable to decode audit record: %+v", err)
+		}
+		records = append(records, r)
+	}
+	if got, want := len(records), 2; got != want {
+		t.Fatalf("expected %d audit records, got %d", want, got)
+	}
+	if got, want := records[1].Source, "http://example.org"; got != want {
+		t.Errorf("expected audit record source to be %s, got %s", want, got)
+	}
+}
+
+func TestFileSink_Prune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := NewFileSink(dir)
+	now := time.Date(2018, 6, 10, 10, 0, 0, 0, time.UTC)
+	s.Write(Record{Time: now.AddDate(0, 0, -10)})
+	s.Write(Record{Time: now})
+
+	if err := s.Prune(now.AddDate(0, 0, -7)); err != nil {
+		t.Fatalf("prune returned an unexpected error: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit-2018-05-31.log")); !os.IsNotExist(err) {
+		t.Errorf("expected expired audit file to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit-2018-06-10.log")); err != nil {
+		t.Errorf("expected current audit file to be kept: %+v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Sink buffers audit records, and uploads them as JSON lines objects
+// (<prefix>YYYY/MM/DD/<time>.log, UTC) to an S3 bucket.
+type S3Sink struct {
+	mu     sync.Mutex
+	svc    *s3.S3
+	bucket string
+	prefix string
+	buf    bytes.Buffer
+}
+
+// NewS3Sink creates an S3 sink, and flushes its buffer at the given
+// interval until the done channel is closed.
+// Credentials are resolved using the default AWS credential chain.
+func NewS3Sink(region, bucket, prefix string, interval time.Duration, done <-chan struct{}) *S3Sink {
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	s := &S3Sink{svc: s3.New(sess), bucket: bucket, prefix: prefix}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				if err := s.Flush(); err != nil {
+					log.Printf("[Audit] unable to flush records to S3: %+v\n", err)
+				}
+				return
+			case <-t.C:
+				if err := s.Flush(); err != nil {
+					log.Printf("[Audit] unable to flush records to S3: %+v\n", err)
+				}
+			}
+		}
+	}()
+	return s
+}
+
+// Write adds a record to the buffer.
+func (s *S3Sink) Write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(append(b, '\n'))
+	return nil
+}
+
+// Flush uploads all buffered records as a single object.
+func (s *S3Sink) Flush() error {
+	s.mu.Lock()
+	if s.buf.Len() == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	body := make([]byte, s.buf.Len())
+	copy(body, s.buf.Bytes())
+	s.buf.Reset()
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%s.log", s.prefix, now.Format("2006/01/02"), now.Format("150405.000000000"))
+	_, err := s.svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/x-ndjson"),
+		Body:        bytes.NewReader(body),
+	})
+	return err
+}
+
+// Prune deletes all objects (under the prefix) last modified before the
+// given time.
+func (s *S3Sink) Prune(before time.Time) error {
+	var keys []*s3.ObjectIdentifier
+	err := s.svc.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *s3.ListObjectsOutput, last bool) bool {
+		for _, o := range page.Contents {
+			if o.LastModified != nil && o.LastModified.Before(before) {
+				keys = append(keys, &s3.ObjectIdentifier{Key: o.Key})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// DeleteObjects accepts up to 1000 keys per request
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 1000 {
+			n = 1000
+		}
+		_, err := s.svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &s3.Delete{Objects: keys[:n], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/breaker"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// hostBreaker returns the circuit breakers of source hosts from the context,
+// or nil if they are disabled.
+func hostBreaker(c *gin.Context) *breaker.Breaker {
+	if b, ok := c.Get("breaker"); ok {
+		return b.(*breaker.Breaker)
+	}
+	return nil
+}
+
+// allowSource returns breaker.ErrOpen (and sets a Retry-After header) if
+// conversions of the host of a source URL fail fast. Otherwise, the host is
+// set in the context, so that the outcome of the conversion is recorded (see
+// recordSource).
+func allowSource(c *gin.Context, uri string) error {
+	b := hostBreaker(c)
+	host := sourceDomain(uri)
+	if b == nil || host == "" {
+		return nil
+	}
+	if err := b.Allow(host); err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(b.RetryAfter(host).Seconds()))))
+		return err
+	}
+	c.Set("source_host", host)
+	return nil
+}
+
+// recordSource records the outcome of a conversion of the source host of a
+// request (see allowSource).
+func recordSource(c *gin.Context, failed bool) {
+	host := c.GetString("source_host")
+	if host == "" {
+		return
+	}
+	s := c.MustGet("statsd").(*statsd.Client)
+	recordHost(hostBreaker(c), s, host, failed)
+}
+
+// recordHost records the outcome of a conversion of a host to the breaker.
+// It does nothing if the breaker is nil.
+func recordHost(b *breaker.Breaker, s *statsd.Client, host string, failed bool) {
+	if b == nil || host == "" {
+		return
+	}
+	if b.Record(host, failed) {
+		log.Printf("[Breaker] conversions of %s fail fast until it recovers\n", host)
+		s.Increment("circuit_opened")
+	}
+}
+
+// sourceFailed returns true if an error fetching a source counts as a
+// failure of its host, i.e. the host could not be reached.
+func sourceFailed(err error) bool {
+	_, ok := err.(*url.Error)
+	return ok
+}
@@ -0,0 +1,138 @@
+// Package breaker provides circuit breakers for the hosts of conversion
+// sources, so that conversions of a host that keeps failing (e.g. timing out)
+// fail fast instead of tying up workers.
+package breaker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOpen should be returned when conversions of a host fail fast, because
+// its circuit is open.
+var ErrOpen = errors.New("the source host is failing, try again later")
+
+// state is the circuit of a host. It is closed while opened is zero.
+type state struct {
+	failures int
+	last     time.Time
+	opened   time.Time
+	// probing is the start of the conversion probing the host (while the
+	// circuit is half-open).
+	probing time.Time
+}
+
+// Breaker tracks the consecutive failures of hosts. After a number of
+// consecutive failures (the threshold), the circuit of a host opens, and its
+// conversions fail fast for a cooldown. Then, a single conversion is let
+// through to probe the host (half-open): if it succeeds, the circuit closes,
+// otherwise, it opens again.
+type Breaker struct {
+	mu        sync.Mutex
+	hosts     map[string]*state
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+// New creates a breaker.
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		hosts:     make(map[string]*state),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow returns ErrOpen if conversions of a host should fail fast. If the
+// cooldown has passed, the conversion is allowed to probe the host (another
+// probe is allowed if it has not finished within the cooldown).
+func (b *Breaker) Allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.hosts[host]
+	if !ok || s.opened.IsZero() {
+		return nil
+	}
+	now := b.now()
+	if now.Sub(s.opened) < b.cooldown {
+		return ErrOpen
+	}
+	if !s.probing.IsZero() && now.Sub(s.probing) < b.cooldown {
+		return ErrOpen
+	}
+	s.probing = now
+	return nil
+}
+
+// Record records the outcome of an allowed conversion of a host. It returns
+// true if a failure opened the circuit of the host.
+func (b *Breaker) Record(host string, failed bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		delete(b.hosts, host)
+		return false
+	}
+
+	now := b.now()
+	b.expire(now)
+	s, ok := b.hosts[host]
+	if !ok {
+		s = new(state)
+		b.hosts[host] = s
+	}
+	s.failures++
+	s.last = now
+	if !s.probing.IsZero() || (s.opened.IsZero() && s.failures >= b.threshold) {
+		s.opened, s.probing = now, time.Time{}
+		return true
+	}
+	return false
+}
+
+// RetryAfter returns the time until a conversion of a host is allowed to
+// probe it, or zero if its circuit is not open.
+func (b *Breaker) RetryAfter(host string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.hosts[host]
+	if !ok || s.opened.IsZero() {
+		return 0
+	}
+	at := s.opened.Add(b.cooldown)
+	if !s.probing.IsZero() {
+		at = s.probing.Add(b.cooldown)
+	}
+	if d := at.Sub(b.now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Open returns the hosts whose circuits are open (sorted).
+func (b *Breaker) Open() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var hosts []string
+	for host, s := range b.hosts {
+		if !s.opened.IsZero() {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// expire forgets the failures of closed circuits that are older than the
+// cooldown, so that only consecutive failures within the cooldown count.
+func (b *Breaker) expire(now time.Time) {
+	for host, s := range b.hosts {
+		if s.opened.IsZero() && now.Sub(s.last) > b.cooldown {
+			delete(b.hosts, host)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package breaker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mockBreaker returns a breaker with a clock that is advanced manually.
+func mockBreaker(threshold int, cooldown time.Duration) (*Breaker, *time.Time) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := New(threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker(t *testing.T) {
+	b, now := mockBreaker(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if b.Record("example.com", true) {
+			t.Fatalf("expected circuit not to open before the threshold")
+		}
+	}
+	if err := b.Allow("example.com"); err != nil {
+		t.Fatalf("expected conversion to be allowed, got %v", err)
+	}
+	if !b.Record("example.com", true) {
+		t.Fatalf("expected circuit to open at the threshold")
+	}
+	if err := b.Allow("example.com"); err != ErrOpen {
+		t.Errorf("expected error to be %v, got %v", ErrOpen, err)
+	}
+	if err := b.Allow("other.example.com"); err != nil {
+		t.Errorf("expected conversion of another host to be allowed, got %v", err)
+	}
+	if got, want := b.RetryAfter("example.com"), time.Minute; got != want {
+		t.Errorf("expected retry after %s, got %s", want, got)
+	}
+	if got, want := b.Open(), []string{"example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected open circuits to be %v, got %v", want, got)
+	}
+
+	// Half-open: a single probe is allowed
+	*now = now.Add(time.Minute)
+	if err := b.Allow("example.com"); err != nil {
+		t.Fatalf("expected probe to be allowed after the cooldown, got %v", err)
+	}
+	if err := b.Allow("example.com"); err != ErrOpen {
+		t.Errorf("expected a second probe not to be allowed, got %v", err)
+	}
+	b.Record("example.com", false)
+	if err := b.Allow("example.com"); err != nil {
+		t.Errorf("expected circuit to close after a successful probe, got %v", err)
+	}
+}
+
+func TestBreaker_failedProbe(t *testing.T) {
+	b, now := mockBreaker(1, time.Minute)
+	b.Record("example.com", true)
+	*now = now.Add(time.Minute)
+	b.Allow("example.com")
+	if !b.Record("example.com", true) {
+		t.Errorf("expected a failed probe to open the circuit again")
+	}
+	if err := b.Allow("example.com"); err != ErrOpen {
+		t.Errorf("expected error to be %v, got %v", ErrOpen, err)
+	}
+}
+
+func TestBreaker_expiredProbe(t *testing.T) {
+	b, now := mockBreaker(1, time.Minute)
+	b.Record("example.com", true)
+	*now = now.Add(time.Minute)
+	b.Allow("example.com")
+	*now = now.Add(time.Minute)
+	if err := b.Allow("example.com"); err != nil {
+		t.Errorf("expected another probe once the first did not finish within the cooldown, got %v", err)
+	}
+}
+
+func TestBreaker_consecutive(t *testing.T) {
+	b, now := mockBreaker(2, time.Minute)
+	b.Record("example.com", true)
+	b.Record("example.com", false)
+	if b.Record("example.com", true) {
+		t.Errorf("expected a success to reset the failures")
+	}
+	*now = now.Add(2 * time.Minute)
+	if b.Record("example.com", true) {
+		t.Errorf("expected failures older than the cooldown to be forgotten")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/breaker"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestConvertByURLHandler_circuitOpen(t *testing.T) {
+	b := breaker.New(1, time.Minute)
+	b.Record("example.com", true)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	svc := Services{Queue: converter.InitWorkers(1, 1, 10), Breaker: b}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/convert?auth=123456&url=https://example.com/page", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+	if got, want := res.Header().Get("Retry-After"), "60"; got != want {
+		t.Errorf("expected Retry-After header to be %s, got %s", want, got)
+	}
+	if got, want := errorCode(breaker.ErrOpen, res.Code), CodeSourceUnavailable; got != want {
+		t.Errorf("expected error code to be %s, got %s", want, got)
+	}
+}
+
+func TestSourceFailed(t *testing.T) {
+	if !sourceFailed(&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("timeout")}) {
+		t.Errorf("expected a fetch error to count as a failure of the host")
+	}
+	if sourceFailed(errors.New("test error")) {
+		t.Errorf("expected other errors not to count as a failure of the host")
+	}
+}
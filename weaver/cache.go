@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// uncachedParams are the query parameters that do not affect the output of
+// a conversion, so they are not part of its cache key.
+var uncachedParams = []string{
+	"auth", "aws_id", "aws_secret", "aws_region",
+	"s3_bucket", "s3_key", "s3_acl", "s3_dedupe", "no_cache",
+}
+
+// outputCache returns the conversion output cache (if it is enabled).
+func outputCache(c *gin.Context) *outputcache.Store {
+	if s, ok := c.Get("output_cache"); ok {
+		return s.(*outputcache.Store)
+	}
+	return nil
+}
+
+// conversionCacheKey returns the cache key of the output of a request, i.e.
+// its tenant, and the options that affect the output.
+func conversionCacheKey(c *gin.Context) string {
+	q := c.Request.URL.Query()
+	for _, k := range uncachedParams {
+		q.Del(k)
+	}
+	// The attachments of v2 requests are not query parameters (they are
+	// read when the options are checked, see checkAttachments)
+	if files, ok := c.Get("attachments"); ok && len(files.([]pdf.Attachment)) > 0 {
+		b, _ := json.Marshal(files)
+		sum := sha256.Sum256(b)
+		q.Set("attachments", hex.EncodeToString(sum[:]))
+	}
+	// The default redactions (see Config.Redaction) may change
+	if names, _ := redaction(c); len(names) > 0 {
+		q.Set("redact", strings.Join(names, ","))
+	}
+	sum := sha256.Sum256([]byte(q.Encode()))
+	return tenantID(c) + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// jobCacheKey returns the cache key of the output of an asynchronous job,
+// i.e. the job without its IDs, and destination.
+func jobCacheKey(j queue.Job) string {
+	j.ID, j.RequestID, j.AWSS3 = "", "", converter.AWSS3{}
+	b, _ := json.Marshal(j)
+	sum := sha256.Sum256(b)
+	return "job\x00" + hex.EncodeToString(sum[:])
+}
+
+// validators returns the validators of the source of a cached output.
+func validators(e outputcache.Entry) converter.Validators {
+	return converter.Validators{ETag: e.ETag, LastModified: e.LastModified}
+}
+
+// cacheOutput caches the output of a conversion of a source by its key,
+// with the tenant, and data subject of the conversion. It does nothing if the
+// store is nil, or the key is empty.
+func cacheOutput(s *outputcache.Store, key, tenant, subject string, source converter.ConversionSource, out []byte, pages int) {
+	if s == nil || key == "" || len(out) == 0 {
+		return
+	}
+	s.Put(key, outputcache.Entry{
+		ETag:         source.Validators.ETag,
+		LastModified: source.Validators.LastModified,
+		Output:       out,
+		Pages:        pages,
+		Tenant:       tenant,
+		Subject:      subject,
+	})
+}
+
+// newCachedURLSource creates a conversion source for a URL. If the output of
+// the request is cached, the URL is fetched with a conditional request, and
+// the cached output is returned instead if the URL has not been modified.
+// Requests with 'no_cache' are converted again (refreshing the cache).
+func newCachedURLSource(c *gin.Context, uri string) (*converter.ConversionSource, *outputcache.Entry, error) {
+	s := outputCache(c)
+	if s == nil {
+		source, err := newURLSource(c, uri)
+		return source, nil, err
+	}
+
+	key := conversionCacheKey(c)
+	c.Set("output_cache_key", key)
+	e, ok := s.Get(key)
+	if _, noCache := c.GetQuery("no_cache"); !ok || noCache {
+		source, err := newURLSource(c, uri)
+		return source, nil, err
+	}
+	source, err := newConditionalURLSource(c, uri, validators(e))
+	if err == converter.ErrNotModified {
+		return nil, &e, nil
+	}
+	return source, nil, err
+}
+
+// cachedConversionHandler returns (or uploads) the cached output of a
+// request whose source has not been modified. It is accounted for as a
+// conversion without CPU time.
+func cachedConversionHandler(c *gin.Context, e outputcache.Entry) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	format, _ := outputFormat(c)
+	id := c.GetString("job")
+
+	report := &converter.Report{Pages: e.Pages, Bytes: len(e.Output), SHA256: converter.Digest(e.Output)}
+	c.Set("report", report)
+	c.Set("engine", "cache")
+	awsConf := requestAWSS3(c, format)
+	uploaded, err := converter.UploadConversion{AWSS3: awsConf}.Upload(e.Output)
+	if err != nil {
+		s.Increment("s3_upload_error")
+		events.Emit(publisher(c), events.Failed, id, c.Query("url"), err)
+		c.Error(err)
+		return
+	}
+
+	s.Increment("output_cache_hit")
+	events.EmitOutput(publisher(c), events.Completed, id, c.Query("url"), report.Pages, report.Bytes)
+	recordUsage(c, report)
+	setReportHeaders(c, report)
+	c.Header("X-Cache", "HIT")
+	if uploaded {
+		events.EmitOutput(publisher(c), events.Uploaded, id, c.Query("url"), report.Pages, report.Bytes)
+		c.JSON(200, uploadedResponse(c, awsConf.Object))
+		return
+	}
+	sendOutput(c, athenapdf.ContentTypes[format], e.Output, report.SHA256)
+}
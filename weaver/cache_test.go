@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/queue"
+)
+
+func TestConversionCacheKey(t *testing.T) {
+	conf := Config{}
+	key := func(url string) string {
+		req, _ := http.NewRequest("GET", url, nil)
+		c := &gin.Context{Request: req}
+		c.Set("config", conf)
+		return conversionCacheKey(c)
+	}
+	if key("/convert?url=a&auth=1&s3_bucket=b") != key("/convert?url=a&auth=2") {
+		t.Errorf("expected credentials, and destination not to affect the cache key")
+	}
+	if key("/convert?url=a") == key("/convert?url=a&format=text") {
+		t.Errorf("expected options to affect the cache key")
+	}
+	before := key("/convert?url=a")
+	conf.Redaction.Default = []string{"email"}
+	if key("/convert?url=a") == before || key("/convert?url=a") != key("/convert?url=a&redact=email") {
+		t.Errorf("expected the default redactions to affect the cache key")
+	}
+}
+
+func TestJobCacheKey(t *testing.T) {
+	a := queue.Job{ID: "a", URL: "https://example.com"}
+	a.AWSS3.S3Key = "a.pdf"
+	b := queue.Job{ID: "b", URL: "https://example.com"}
+	b.AWSS3.S3Key = "b.pdf"
+	if jobCacheKey(a) != jobCacheKey(b) {
+		t.Errorf("expected IDs, and destination not to affect the cache key")
+	}
+	b.Tenant = "acme"
+	if jobCacheKey(a) == jobCacheKey(b) {
+		t.Errorf("expected tenant to affect the cache key")
+	}
+}
+
+func TestConvertByURLHandler_cached(t *testing.T) {
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "echo"
+	wq := converter.InitWorkers(1, 1, 10)
+	svc := Services{Queue: wq, OutputCache: outputcache.NewStore(time.Hour, 1<<20)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	tests := []struct {
+		query string
+		cache string
+	}{
+		{"", ""},
+		{"", "HIT"},
+		{"&no_cache", ""},
+	}
+	var body string
+	for i, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		req, _ := http.NewRequest("GET", "/convert?auth=123456&url="+ts.URL+tt.query, nil)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, http.StatusOK; got != want {
+			t.Fatalf("expected response code of request %d to be %d, got %d", i, want, got)
+		}
+		if got := res.Header().Get("X-Cache"); got != tt.cache {
+			t.Errorf("expected cache header of request %d to be %q, got %q", i, tt.cache, got)
+		}
+		if i == 0 {
+			body = res.Body.String()
+		} else if got := res.Body.String(); got != body {
+			t.Errorf("expected output of request %d to be %q, got %q", i, body, got)
+		}
+	}
+	if got, want := fetches, 3; got != want {
+		t.Errorf("expected source to be fetched %d times, got %d", want, got)
+	}
+}
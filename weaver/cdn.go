@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+// cdnVersionLength is the length of the version tokens of CDN URLs (a prefix
+// of the SHA-256 digest of the object).
+const cdnVersionLength = 16
+
+// cdnURL returns the stable URL of an uploaded object under the base URL of
+// the CDN, and its version token. It returns false if the object is not
+// fronted by the CDN.
+func cdnURL(conf Config, o *converter.S3Object) (string, string, bool) {
+	if conf.CDN.BaseURL == "" || (conf.CDN.Bucket != "" && o.Bucket != conf.CDN.Bucket) {
+		return "", "", false
+	}
+	segments := strings.Split(o.Key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	stable := strings.TrimSuffix(conf.CDN.BaseURL, "/") + "/" + strings.Join(segments, "/")
+	version := o.SHA256
+	if len(version) > cdnVersionLength {
+		version = version[:cdnVersionLength]
+	}
+	return stable, version, true
+}
+
+// objectURLs sets the URLs of an uploaded object in a response: its CDN
+// URL with its version token ('url'), its stable CDN URL ('stable_url'), and
+// the token ('version'), or its S3 URL ('url').
+func objectURLs(conf Config, res map[string]interface{}, o *converter.S3Object) {
+	stable, version, ok := cdnURL(conf, o)
+	if !ok {
+		res["url"] = o.URL
+		return
+	}
+	res["url"] = stable + "?v=" + version
+	res["stable_url"] = stable
+	res["version"] = version
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestCDNURL(t *testing.T) {
+	o := &converter.S3Object{
+		Bucket: "reports",
+		Key:    "2018/a report.pdf",
+		URL:    "https://reports.s3.amazonaws.com/2018/a%20report.pdf",
+		SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	tests := []struct {
+		cdn     CDN
+		url     string
+		stable  string
+		version string
+	}{
+		{CDN{}, o.URL, "", ""},
+		{CDN{BaseURL: "https://cdn.example.com/docs/"}, "https://cdn.example.com/docs/2018/a%20report.pdf?v=9f86d081884c7d65", "https://cdn.example.com/docs/2018/a%20report.pdf", "9f86d081884c7d65"},
+		{CDN{BaseURL: "https://cdn.example.com", Bucket: "reports"}, "https://cdn.example.com/2018/a%20report.pdf?v=9f86d081884c7d65", "https://cdn.example.com/2018/a%20report.pdf", "9f86d081884c7d65"},
+		{CDN{BaseURL: "https://cdn.example.com", Bucket: "other"}, o.URL, "", ""},
+	}
+	for _, tt := range tests {
+		res := map[string]interface{}{}
+		objectURLs(Config{CDN: tt.cdn}, res, o)
+		if got, want := res["url"], tt.url; got != want {
+			t.Errorf("expected url %q with %+v, got %q", want, tt.cdn, got)
+		}
+		if tt.stable == "" {
+			if _, ok := res["stable_url"]; ok {
+				t.Errorf("expected no stable_url with %+v, got %q", tt.cdn, res["stable_url"])
+			}
+			continue
+		}
+		if got, want := res["stable_url"], tt.stable; got != want {
+			t.Errorf("expected stable_url %q with %+v, got %q", want, tt.cdn, got)
+		}
+		if got, want := res["version"], tt.version; got != want {
+			t.Errorf("expected version %q with %+v, got %q", want, tt.cdn, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/chart"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// readChart returns the chart of a request (a JSON body, see chart.Chart) as
+// a HTML document, with the charting library of its type (see Charts)
+// inlined. The body must fit in the spool quota.
+func readChart(c *gin.Context) ([]byte, error) {
+	conf := c.MustGet("config").(Config)
+	if !strings.HasPrefix(c.ContentType(), "application/json") {
+		return nil, ErrRequestInvalid
+	}
+	used := 0
+	b, err := readLimited(c.Request.Body, conf.Spool.MaxBytes, &used)
+	if err != nil {
+		return nil, err
+	}
+	var ch chart.Chart
+	if err := json.Unmarshal(b, &ch); err != nil {
+		return nil, ErrRequestInvalid
+	}
+	if err := ch.Validate(); err != nil {
+		return nil, err
+	}
+	libraries, err := chart.Load(conf.Charts.Dir, ch.Type)
+	if err != nil {
+		return nil, err
+	}
+	return ch.HTML(libraries)
+}
+
+// chartHandler renders a chart spec (a Chart.js configuration, or a Vega-Lite
+// spec) into a page, with its charting library (read from the charts
+// directory, see Charts) inlined, and converts it like an uploaded HTML
+// document, so that charts can be converted to PDF, or
+// images without hosting a page. The page is converted offline, once the
+// chart is rendered. Every conversion option applies.
+func chartHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	doc, err := readChart(c)
+	if err != nil {
+		s.Increment("chart_error")
+		switch err {
+		case ErrSourceTooLarge:
+			c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+		case ErrRequestInvalid, chart.ErrTypeInvalid, chart.ErrSpecInvalid, chart.ErrSizeInvalid, chart.ErrBackgroundInvalid, chart.ErrUnavailable:
+			c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	s.Increment("chart")
+
+	// The page only runs its inlined scripts, and signals when the chart
+	// is rendered
+	q := c.Request.URL.Query()
+	q.Set("ext", "html")
+	q.Set("offline", "true")
+	q.Set("waitForStatus", "true")
+	c.Request.URL.RawQuery = q.Encode()
+	convertUpload(c, "chart.html", bytes.NewReader(doc))
+}
@@ -0,0 +1,197 @@
+// Package chart renders chart specs (Chart.js configurations, or Vega-Lite
+// specs) as standalone HTML documents, with their charting library inlined,
+// so that charts can be converted without hosting a page.
+package chart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	// ErrTypeInvalid is returned when the type of a chart is unknown.
+	ErrTypeInvalid = errors.New("invalid chart type provided (use chartjs, or vega-lite)")
+	// ErrSpecInvalid is returned when the spec of a chart is not a JSON
+	// object.
+	ErrSpecInvalid = errors.New("invalid chart spec provided (expected a JSON object)")
+	// ErrSizeInvalid is returned when the size of a chart is out of range.
+	ErrSizeInvalid = errors.New("invalid chart size provided (width, and height must be between 1, and 10000 pixels)")
+	// ErrBackgroundInvalid is returned when the background of a chart is not
+	// a CSS color.
+	ErrBackgroundInvalid = errors.New("invalid chart background provided (expected a CSS color, e.g. '#fff', or 'transparent')")
+	// ErrUnavailable is returned when the charting library of a chart is not
+	// installed.
+	ErrUnavailable = errors.New("the charting library of the chart type is not installed")
+)
+
+// Types of charts.
+const (
+	TypeChartJS   = "chartjs"
+	TypeVegaLite  = "vega-lite"
+	defaultWidth  = 800
+	defaultHeight = 500
+	maxSize       = 10000
+)
+
+// Libraries are the files of the charting libraries of the types of charts,
+// in the order they are loaded.
+var Libraries = map[string][]string{
+	TypeChartJS:  {"chart.umd.js"},
+	TypeVegaLite: {"vega.min.js", "vega-lite.min.js", "vega-embed.min.js"},
+}
+
+// Chart is a chart to render.
+type Chart struct {
+	// Type is the type of the chart: 'chartjs', or 'vega-lite'.
+	Type string `json:"type"`
+	// Spec is the Chart.js configuration ({type, data, options}), or the
+	// Vega-Lite spec of the chart.
+	Spec json.RawMessage `json:"spec"`
+	// Width, and Height are the size of the chart in CSS pixels.
+	// Defaults to 800x500.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Background is the CSS color behind the chart.
+	// Defaults to white.
+	Background string `json:"background,omitempty"`
+}
+
+// background matches the CSS colors allowed as backgrounds: hex colors,
+// functional notations, and keywords.
+var background = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|(rgb|rgba|hsl|hsla)\([0-9., %]+\)|[a-zA-Z]+)$`)
+
+// Validate returns an error if the chart is invalid, and sets its defaults.
+func (c *Chart) Validate() error {
+	if _, ok := Libraries[c.Type]; !ok {
+		return ErrTypeInvalid
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(c.Spec), []byte("{")) || !json.Valid(c.Spec) {
+		return ErrSpecInvalid
+	}
+	if c.Width == 0 {
+		c.Width = defaultWidth
+	}
+	if c.Height == 0 {
+		c.Height = defaultHeight
+	}
+	if c.Width < 1 || c.Width > maxSize || c.Height < 1 || c.Height > maxSize {
+		return ErrSizeInvalid
+	}
+	if c.Background == "" {
+		c.Background = "white"
+	}
+	if !background.MatchString(c.Background) {
+		return ErrBackgroundInvalid
+	}
+	return nil
+}
+
+// Load returns the scripts of the charting library of a type of chart, from
+// the directory of the libraries.
+func Load(dir, typ string) ([][]byte, error) {
+	files, ok := Libraries[typ]
+	if !ok {
+		return nil, ErrTypeInvalid
+	}
+	scripts := make([][]byte, 0, len(files))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f))
+		if os.IsNotExist(err) {
+			return nil, ErrUnavailable
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read charting library %s: %v", f, err)
+		}
+		scripts = append(scripts, b)
+	}
+	return scripts, nil
+}
+
+// renderers are the scripts rendering the spec (spec) of the types of charts
+// into #chart. They set window.status to 'ready' once the chart is rendered,
+// or failed to render.
+var renderers = map[string]template.JS{
+	TypeChartJS: `try {
+  spec.options = spec.options || {};
+  spec.options.animation = false;
+  spec.options.responsive = true;
+  spec.options.maintainAspectRatio = false;
+  if (spec.options.devicePixelRatio === undefined) {
+    spec.options.devicePixelRatio = 3;
+  }
+  var canvas = document.createElement("canvas");
+  document.getElementById("chart").appendChild(canvas);
+  new Chart(canvas, spec);
+} catch (e) {
+  fail(e);
+}
+window.status = "ready";`,
+	TypeVegaLite: `vegaEmbed("#chart", spec, {actions: false, renderer: "svg"})
+  .catch(fail)
+  .then(function() { window.status = "ready"; });`,
+}
+
+var tmpl = template.Must(template.New("chart").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+html, body { margin: 0; background: {{.Background}}; }
+#chart { position: relative; width: {{.Width}}px; height: {{.Height}}px; overflow: hidden; }
+.error { font: 10pt sans-serif; color: #b00020; }
+</style>
+{{range .Libraries}}<script>{{.}}</script>
+{{end}}</head>
+<body>
+<div id="chart"></div>
+<script>
+(function() {
+  var spec = {{.Spec}};
+  function fail(e) {
+    var p = document.createElement("p");
+    p.className = "error";
+    p.textContent = "Unable to render the chart: " + e;
+    document.body.appendChild(p);
+  }
+  {{.Render}}
+})();
+</script>
+</body>
+</html>
+`))
+
+// HTML returns the chart as a HTML document, with the scripts of its
+// charting library (see Load) inlined. The document sets window.status to
+// 'ready' once the chart is rendered.
+func (c *Chart) HTML(libraries [][]byte) ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	// The spec is escaped so that it cannot close the script
+	var spec bytes.Buffer
+	json.HTMLEscape(&spec, c.Spec)
+	scripts := make([]template.JS, len(libraries))
+	for i, l := range libraries {
+		scripts[i] = template.JS(bytes.Replace(l, []byte("</script"), []byte(`<\/script`), -1))
+	}
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, map[string]interface{}{
+		"Background": template.CSS(c.Background),
+		"Width":      c.Width,
+		"Height":     c.Height,
+		"Libraries":  scripts,
+		"Spec":       template.JS(spec.String()),
+		"Render":     renderers[c.Type],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
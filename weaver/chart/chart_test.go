@@ -0,0 +1,76 @@
+package chart
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChart_Validate(t *testing.T) {
+	tests := []struct {
+		chart Chart
+		want  error
+	}{
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`{"type": "bar"}`)}, nil},
+		{Chart{Type: TypeVegaLite, Spec: json.RawMessage(`{"mark": "bar"}`), Width: 10000, Background: "rgba(0, 0, 0, 0.5)"}, nil},
+		{Chart{Type: "d3", Spec: json.RawMessage(`{}`)}, ErrTypeInvalid},
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`[]`)}, ErrSpecInvalid},
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`{"type"`)}, ErrSpecInvalid},
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`{}`), Height: -1}, ErrSizeInvalid},
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`{}`), Width: 10001}, ErrSizeInvalid},
+		{Chart{Type: TypeChartJS, Spec: json.RawMessage(`{}`), Background: "red; } body { display: none"}, ErrBackgroundInvalid},
+	}
+	for _, tt := range tests {
+		if got := tt.chart.Validate(); got != tt.want {
+			t.Errorf("expected %+v to return %v, got %v", tt.chart, tt.want, got)
+		}
+	}
+}
+
+func TestChart_HTML(t *testing.T) {
+	c := Chart{Type: TypeChartJS, Spec: json.RawMessage(`{"type": "bar", "data": {"labels": ["</script><script>alert(1)</script>"]}}`)}
+	b, err := c.HTML([][]byte{[]byte(`var Chart = function() {}; "</script>";`)})
+	if err != nil {
+		t.Fatalf("unable to render chart: %+v", err)
+	}
+	doc := string(b)
+	for _, s := range []string{
+		`<script>var Chart = function() {}; "<\/script>";</script>`,
+		`var spec = {"type": "bar", "data": {"labels": ["\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"]}};`,
+		`width: 800px; height: 500px;`,
+		`background: white;`,
+		`new Chart(canvas, spec);`,
+		`window.status = "ready";`,
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("expected the document to contain %q, got %s", s, doc)
+		}
+	}
+	if got, want := strings.Count(doc, "<script>"), 2; got != want {
+		t.Errorf("expected the document to have %d scripts, got %d", want, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "chart.umd.js"), []byte("var Chart;"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "vega.min.js"), []byte("var vega;"), 0644)
+
+	scripts, err := Load(dir, TypeChartJS)
+	if err != nil || len(scripts) != 1 || string(scripts[0]) != "var Chart;" {
+		t.Errorf("expected Chart.js to be loaded, got %q (%v)", scripts, err)
+	}
+	if _, err := Load(dir, TypeVegaLite); err != ErrUnavailable {
+		t.Errorf("expected Vega-Lite without vega-lite.min.js to return %v, got %v", ErrUnavailable, err)
+	}
+	if _, err := Load(dir, "d3"); err != ErrTypeInvalid {
+		t.Errorf("expected an unknown type to return %v, got %v", ErrTypeInvalid, err)
+	}
+}
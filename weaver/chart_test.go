@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestChartHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The mock converter keeps the document it converts, and its arguments
+	script := filepath.Join(dir, "converter.sh")
+	ioutil.WriteFile(script, []byte("echo \"$@\" > "+dir+"/args\n"+
+		"for a; do case \"$a\" in *.html) cp \"$a\" "+dir+"/source.html;; esac; done\n"+
+		"cat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+	// Only Chart.js is installed
+	ioutil.WriteFile(filepath.Join(dir, "chart.umd.js"), []byte("var Chart = function() {};"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	conf.Charts.Dir = dir
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	tests := []struct {
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{"application/json", `{"type": "chartjs", "spec": {"type": "bar", "data": {"labels": ["Q1"]}}, "width": 600}`, http.StatusOK, `width: 600px; height: 500px;`},
+		{"application/json", `{"type": "vega-lite", "spec": {"mark": "bar"}}`, http.StatusBadRequest, ""},
+		{"application/json", `{"type": "chartjs", "spec": "bar"}`, http.StatusBadRequest, ""},
+		{"application/json", `{"type": "highcharts", "spec": {}}`, http.StatusBadRequest, ""},
+		{"text/plain", `{"type": "chartjs", "spec": {}}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/chart?auth=123456", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d: %s", tt.body, want, got, res.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		source, _ := ioutil.ReadFile(filepath.Join(dir, "source.html"))
+		for _, s := range []string{tt.want, "var Chart = function() {};"} {
+			if !strings.Contains(string(source), s) {
+				t.Errorf("expected the chart of %s to contain %q, got %s", tt.body, s, source)
+			}
+		}
+		args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+		for _, flag := range []string{"--wait-for-status", "--offline"} {
+			if !strings.Contains(string(args), flag) {
+				t.Errorf("expected the chart of %s to be converted with %s, got %s", tt.body, flag, args)
+			}
+		}
+	}
+}
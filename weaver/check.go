@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+// check is a startup self-check. It returns the problems it found, each
+// with an actionable message.
+type check struct {
+	name string
+	run  func(conf Config) []error
+}
+
+// checks contains the self-checks run by 'weaver check'.
+var checks = []check{
+	{"configuration", Config.Validate},
+	{"converter", checkConverter},
+	{"display", checkDisplay},
+	{"storage", checkStorage},
+}
+
+// runChecks runs all self-checks, and reports their outcome to w. It returns
+// false if any check failed.
+func runChecks(conf Config, checks []check, w io.Writer) bool {
+	ok := true
+	for _, c := range checks {
+		errs := c.run(conf)
+		if len(errs) == 0 {
+			fmt.Fprintf(w, "ok    %s\n", c.name)
+			continue
+		}
+		ok = false
+		for _, err := range errs {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", c.name, err)
+		}
+	}
+	return ok
+}
+
+// checkConverter verifies that the converter (see AthenaCMD) is installed,
+// and executable.
+func checkConverter(conf Config) []error {
+	cmd := strings.Fields(conf.AthenaCMD)
+	if len(cmd) == 0 {
+		return []error{fmt.Errorf("WEAVER_ATHENA_CMD must be set")}
+	}
+	path, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return []error{fmt.Errorf("%s was not found in PATH, install it, or fix WEAVER_ATHENA_CMD (%v)", cmd[0], err)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput(); err != nil {
+		return []error{fmt.Errorf("%s is not executable: %v %s", path, err, strings.TrimSpace(string(out)))}
+	}
+	return nil
+}
+
+// checkDisplay verifies that Xvfb is installed, or a display is running.
+func checkDisplay(conf Config) []error {
+	if _, err := exec.LookPath("Xvfb"); err == nil {
+		return nil
+	}
+	display := os.Getenv("DISPLAY")
+	if strings.HasPrefix(display, ":") {
+		if _, err := os.Stat("/tmp/.X11-unix/X" + strings.SplitN(display[1:], ".", 2)[0]); err == nil {
+			return nil
+		}
+	}
+	return []error{fmt.Errorf("Xvfb was not found in PATH, and no display is running (DISPLAY=%q), install Xvfb (e.g. 'apt-get install xvfb')", display)}
+}
+
+// checkStorage verifies that the configured directories are writable, the
+// tenants file is valid, and the S3 buckets are accessible with the
+// configured credentials.
+func checkStorage(conf Config) []error {
+	var errs []error
+	if conf.Audit.Sink == "file" {
+		if err := writableDir(conf.Audit.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("the audit directory (WEAVER_AUDIT_DIR) is not writable: %v", err))
+		}
+	}
+	if conf.FontsDir != "" {
+		if err := writableDir(conf.FontsDir); err != nil {
+			errs = append(errs, fmt.Errorf("the fonts directory (WEAVER_FONTS_DIR) is not writable: %v", err))
+		}
+	}
+	for env, path := range map[string]string{
+		"WEAVER_SCHEDULES_FILE": conf.SchedulesFile,
+		"WEAVER_USAGE_FILE":     conf.UsageFile,
+		"WEAVER_SQLITE_PATH":    conf.SQLitePath,
+	} {
+		if path == "" {
+			continue
+		}
+		if err := writableDir(filepath.Dir(path)); err != nil {
+			errs = append(errs, fmt.Errorf("the directory of %s is not writable: %v", env, err))
+		}
+	}
+	if conf.TenantsFile != "" {
+		if _, err := tenant.LoadRegistry(conf.TenantsFile); err != nil {
+			errs = append(errs, fmt.Errorf("the tenants file (WEAVER_TENANTS_FILE) is invalid: %v", err))
+		}
+	}
+	if conf.Queue.S3Bucket != "" {
+		if err := checkBucket(conf.Queue.Region, conf.Queue.S3Bucket, conf.S3); err != nil {
+			errs = append(errs, fmt.Errorf("the S3 bucket %q (WEAVER_QUEUE_S3_BUCKET) is not accessible, check WEAVER_S3_ACCESS_KEY, or the AWS credentials: %v", conf.Queue.S3Bucket, err))
+		}
+	}
+	if conf.Audit.Sink == "s3" && conf.Audit.S3Bucket != "" {
+		if err := checkBucket(conf.Audit.Region, conf.Audit.S3Bucket, S3{}); err != nil {
+			errs = append(errs, fmt.Errorf("the S3 bucket %q (WEAVER_AUDIT_S3_BUCKET) is not accessible, check the AWS credentials: %v", conf.Audit.S3Bucket, err))
+		}
+	}
+	return errs
+}
+
+// writableDir creates a directory (if needed), and verifies that files can
+// be written to it.
+func writableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".weaver-check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkBucket verifies that an S3 bucket exists, and is accessible with the
+// given credentials (or the default AWS credential chain).
+func checkBucket(region, bucket string, creds S3) error {
+	if region == "" {
+		region = "us-east-1"
+	}
+	conf := aws.NewConfig().WithRegion(region).WithMaxRetries(3)
+	if creds.AccessKey != "" && creds.AccessSecret != "" {
+		conf = conf.WithCredentials(credentials.NewStaticCredentials(creds.AccessKey, creds.AccessSecret, ""))
+	}
+	svc := s3.New(session.New(conf))
+	_, err := svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	return err
+}
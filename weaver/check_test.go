@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunChecks(t *testing.T) {
+	w := new(bytes.Buffer)
+	ok := runChecks(Config{}, []check{
+		{"passing", func(Config) []error { return nil }},
+		{"failing", func(Config) []error { return []error{errors.New("set WEAVER_FOO")} }},
+	}, w)
+	if ok {
+		t.Errorf("expected checks to fail")
+	}
+	if got, want := w.String(), "ok    passing\nFAIL  failing: set WEAVER_FOO\n"; got != want {
+		t.Errorf("expected check report to be %q, got %q", want, got)
+	}
+}
+
+func TestCheckConverter(t *testing.T) {
+	if errs := checkConverter(Config{AthenaCMD: "echo -S"}); len(errs) > 0 {
+		t.Errorf("expected converter check to pass, got %v", errs)
+	}
+	if errs := checkConverter(Config{AthenaCMD: "athenapdf-nonexistent -S"}); len(errs) != 1 {
+		t.Errorf("expected converter check to fail, got %v", errs)
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := Config{
+		Audit:         Audit{Sink: "file", Dir: filepath.Join(dir, "audit")},
+		SchedulesFile: filepath.Join(dir, "schedules.json"),
+	}
+	if errs := checkStorage(conf); len(errs) > 0 {
+		t.Errorf("expected storage check to pass, got %v", errs)
+	}
+
+	tenants := filepath.Join(dir, "tenants.json")
+	ioutil.WriteFile(tenants, []byte(`[{"id": "acme"}]`), 0644)
+	conf.TenantsFile = tenants
+	if errs := checkStorage(conf); len(errs) != 1 {
+		t.Errorf("expected storage check to fail, got %v", errs)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/lachee/athenapdf/weaver/breaker"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/postgres"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrJobNotUploaded should be returned when an asynchronous job finished
+	// without uploading its output.
+	ErrJobNotUploaded = errors.New("asynchronous conversion was not uploaded")
+)
+
+const (
+	// minRetryDelay is the delay before a job is redelivered after its first
+	// failed attempt.
+	minRetryDelay = 10 * time.Second
+	// maxRetryDelay is the maximum delay before a failed job is redelivered.
+	maxRetryDelay = 15 * time.Minute
+)
+
+// NewBroker creates a broker for the clustered mode using the queue
+// configuration. It returns a nil broker if the clustered mode is disabled.
+func NewBroker(conf Config) (queue.Broker, error) {
+	visibility := time.Second * time.Duration(conf.Queue.VisibilityTimeout)
+	switch conf.Queue.Driver {
+	case "":
+		return nil, nil
+	case "memory":
+		return queue.NewMemoryBroker(conf.MaxConversionQueue, visibility), nil
+	case "sqs":
+		return queue.NewSQSBroker(conf.Queue.Region, conf.Queue.URL, int64(conf.Queue.VisibilityTimeout)), nil
+	case "postgres":
+		db, err := postgres.Open(conf.Queue.URL)
+		if err != nil {
+			return nil, err
+		}
+		b := queue.NewPostgresBroker(db, visibility)
+		b.MaxAttempts = conf.Queue.MaxAttempts
+		return b, nil
+	}
+	return nil, queue.ErrUnknownDriver
+}
+
+// NewNotifier creates a notifier for job completion events using the queue
+// configuration. It returns a nil notifier if no SNS topic is configured.
+func NewNotifier(conf Config) queue.Notifier {
+	if conf.Queue.SNSTopic == "" {
+		return nil
+	}
+	return queue.NewSNSNotifier(conf.Queue.Region, conf.Queue.SNSTopic)
+}
+
+// Consumer receives jobs from a broker, and runs them through the local work
+// queue.
+type Consumer struct {
+	Conf   Config
+	Broker queue.Broker
+	// Notifier is optional. If it is set, an event is published after every
+	// attempt.
+	Notifier queue.Notifier
+	// Events is optional. If it is set, lifecycle events are published for
+	// every job.
+	Events events.Publisher
+	// Usage is optional. If it is set, the usage of jobs with a tenant is
+	// accounted for.
+	Usage *tenant.Accountant
+	// Tenants is optional. If it is set (with Usage), jobs of tenants over
+	// their quota fail, as requests do (see QuotaMiddleware), since jobs
+	// published by schedules skip the middleware.
+	Tenants *tenant.Registry
+	// History is optional. If it is set, every attempt is recorded to it.
+	History history.Store
+	// Registry is optional. If it is set, the outputs of completed jobs are
+	// recorded to it.
+	Registry registry.Store
+	// Retention is optional. If it is set, the deletion of the outputs of
+	// completed jobs is scheduled to it.
+	Retention retention.Store
+	// Throughput is optional. If it is set, every conversion is counted.
+	Throughput *Throughput
+	// Progress is optional. If it is set, the stages of every job are
+	// tracked.
+	Progress *progress.Tracker
+	// OutputCache is optional. If it is set, jobs of unchanged URLs upload
+	// their cached output instead of converting again.
+	OutputCache *outputcache.Store
+	// Breaker is optional. If it is set, jobs of failing source hosts fail
+	// fast.
+	Breaker *breaker.Breaker
+	// Politeness is optional. If it is set, jobs wait until the conversions
+	// of their source host are within its limit (see Config.Politeness).
+	Politeness *politeness.Limiter
+	// Notifiers is optional. If it is set, the outputs of completed jobs are
+	// announced to their targets.
+	Notifiers *notify.Registry
+	Queue     chan<- converter.Work
+	Statsd    *statsd.Client
+}
+
+// Start starts the configured number of consumers.
+// Jobs are only acknowledged once they have been uploaded, so jobs from an
+// instance that fails (or is shut down) will be picked up by another.
+func (c Consumer) Start(done <-chan struct{}) {
+	for i := 0; i < c.Conf.Queue.Consumers; i++ {
+		go c.consume(i, done)
+	}
+}
+
+func (c Consumer) consume(id int, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		d, err := c.Broker.Receive(done)
+		if err != nil {
+			log.Printf("[Consumer #%d] unable to receive job: %+v\n", id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+
+		j := jobDestination(c.Conf, d.Job())
+		log.Printf("[Consumer #%d] processing job %s (attempt %d)\n", id, j.ID, d.Attempts())
+		report, err := c.process(j)
+		if c.Notifier != nil {
+			if nerr := c.Notifier.Notify(queue.NewEvent(j, d.Attempts(), report, err)); nerr != nil {
+				log.Printf("[Consumer #%d] unable to publish event for job %s: %+v\n", id, j.ID, nerr)
+			}
+		}
+		if err == breaker.ErrOpen {
+			// The job is redelivered once its visibility timeout expires,
+			// instead of immediately
+			log.Printf("[Consumer #%d] job %s postponed: %+v\n", id, j.ID, err)
+			c.Statsd.Increment("job_postponed")
+			continue
+		}
+		if err != nil {
+			log.Printf("[Consumer #%d] job %s failed: %+v\n", id, j.ID, err)
+			c.Statsd.Increment("job_failed")
+			if n := c.Conf.Queue.MaxAttempts; n > 0 && d.Attempts() >= n {
+				// The job is given up on, instead of being redelivered
+				// forever
+				log.Printf("[Consumer #%d] job %s dropped after %d attempts\n", id, j.ID, d.Attempts())
+				c.Statsd.Increment("job_dropped")
+				if err := d.Ack(); err != nil {
+					log.Printf("[Consumer #%d] unable to drop job %s: %+v\n", id, j.ID, err)
+				}
+				continue
+			}
+			if err := d.Nack(retryDelay(d.Attempts())); err != nil {
+				log.Printf("[Consumer #%d] unable to release job %s: %+v\n", id, j.ID, err)
+			}
+			continue
+		}
+		c.Statsd.Increment("job_success")
+		if err := d.Ack(); err != nil {
+			log.Printf("[Consumer #%d] unable to acknowledge job %s: %+v\n", id, j.ID, err)
+		}
+	}
+}
+
+// retryDelay returns the delay before a job that failed its nth attempt is
+// redelivered, which doubles with every attempt, so that a failing job does
+// not keep the consumers busy.
+func retryDelay(n int) time.Duration {
+	d := minRetryDelay
+	for i := 1; i < n && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// jobEvents returns the lifecycle event publisher of a job, which accounts
+// its events to the tenant of the job.
+func (c Consumer) jobEvents(j queue.Job) events.Publisher {
+	return events.WithTenant(c.Events, j.Tenant)
+}
+
+// emitStarted publishes a started event once a worker has picked up the
+// work.
+func emitStarted(p events.Publisher, w converter.Work, jobID, source string) {
+	if p == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-w.Started():
+			events.Emit(p, events.Started, jobID, source, nil)
+		case <-w.Cancelled():
+		}
+	}()
+}
+
+// Run runs a job outside of the request cycle. The job is published to the
+// broker in clustered mode, so that it can be consumed by any instance.
+// Otherwise, it is processed locally in the background.
+func (c Consumer) Run(j queue.Job) {
+	j = jobDestination(c.Conf, j)
+	events.Emit(c.jobEvents(j), events.Queued, j.ID, j.URL, nil)
+	progress.Set(c.Progress, j.ID, j.Tenant, progress.Queued, nil)
+	if c.Broker != nil {
+		if err := c.Broker.Publish(j); err != nil {
+			log.Printf("[Consumer] unable to publish job %s: %+v\n", j.ID, err)
+			c.Statsd.Increment("job_publish_error")
+			events.Emit(c.jobEvents(j), events.Failed, j.ID, j.URL, err)
+			progress.Set(c.Progress, j.ID, j.Tenant, progress.Failed, err)
+		}
+		return
+	}
+	go func() {
+		if _, err := c.process(j); err != nil {
+			log.Printf("[Consumer] job %s failed: %+v\n", j.ID, err)
+			c.Statsd.Increment("job_failed")
+			return
+		}
+		c.Statsd.Increment("job_success")
+	}()
+}
+
+// jobDestination sets the default S3 destination (see Queue.S3Bucket),
+// credentials (see S3), and retention period (see Retention) for a job
+// without them.
+func jobDestination(conf Config, j queue.Job) queue.Job {
+	if j.AWSS3.S3Bucket == "" && conf.Queue.S3Bucket != "" {
+		j.AWSS3.S3Bucket = conf.Queue.S3Bucket
+		if j.AWSS3.Region == "" {
+			j.AWSS3.Region = conf.Queue.Region
+		}
+	}
+	if j.AWSS3.S3Key == "" && j.AWSS3.S3Bucket != "" && !j.AWSS3.ContentAddressed {
+		j.AWSS3.S3Key = j.ID + ".pdf"
+	}
+	if j.AWSS3.AccessKey == "" && j.AWSS3.AccessSecret == "" {
+		j.AWSS3.AccessKey = conf.S3.AccessKey
+		j.AWSS3.AccessSecret = conf.S3.AccessSecret
+	}
+	if j.AWSS3.RetentionDays == 0 {
+		j.AWSS3.RetentionDays = conf.Retention.Days
+	}
+	return j
+}
+
+// process runs an asynchronous conversion job using athenapdf CLI, and
+// uploads its output to S3. It returns the report of the conversion (with
+// only its diagnostics if the conversion failed).
+func (c Consumer) process(j queue.Job) (report *converter.Report, err error) {
+	defer func() {
+		if err != nil {
+			events.Emit(c.jobEvents(j), events.Failed, j.ID, j.URL, err)
+			progress.Set(c.Progress, j.ID, j.Tenant, progress.Failed, err)
+		}
+		if c.History != nil {
+			if herr := c.History.Add(asyncJob(j, report, err)); herr != nil {
+				log.Printf("[History] unable to record job %s: %+v\n", j.ID, herr)
+			}
+		}
+		if c.Registry != nil && err == nil && report != nil && report.SHA256 != "" {
+			r := documentRecord(j.ID, j.Tenant, j.Format, report)
+			if rerr := c.Registry.Add(r); rerr != nil {
+				log.Printf("[Registry] unable to record the output of job %s: %+v\n", j.ID, rerr)
+			}
+		}
+		if c.Retention != nil && err == nil {
+			scheduleDeletions(c.Retention, j.AWSS3.Object, j.ID, j.Tenant)
+		}
+	}()
+
+	if c.Tenants != nil && c.Usage != nil && j.Tenant != "" {
+		if t, ok := c.Tenants.Get(j.Tenant); ok && c.Usage.Usage(t.ID, tenant.Month(time.Now())).Exceeds(t.Quota) {
+			c.Statsd.Increment("job_quota_exceeded")
+			return nil, tenant.ErrQuotaExceeded
+		}
+	}
+
+	host := sourceDomain(j.URL)
+	if c.Breaker != nil && host != "" {
+		if err := c.Breaker.Allow(host); err != nil {
+			c.Statsd.Increment("circuit_open")
+			return nil, err
+		}
+	}
+
+	release, err := acquireJob(c.Politeness, c.Conf, j, host)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	progress.Set(c.Progress, j.ID, j.Tenant, progress.Fetching, nil)
+	e, err := jobEgress(c.Conf, j)
+	if err != nil {
+		return nil, err
+	}
+	j.AWSS3.Metadata = s3Metadata(j.RequestID)
+	j.AWSS3.Object = new(converter.S3Object)
+
+	key := jobCacheKey(j)
+	var cached outputcache.Entry
+	if c.OutputCache != nil {
+		cached, _ = c.OutputCache.Get(key)
+	}
+	source, err := fetchSource(c.Conf, c.Statsd, e, j.URL, j.Ext, validators(cached), nil)
+	if err == converter.ErrNotModified {
+		recordHost(c.Breaker, c.Statsd, host, false)
+		return c.uploadCached(j, cached)
+	}
+	if err != nil {
+		recordHost(c.Breaker, c.Statsd, host, sourceFailed(err))
+		return nil, err
+	}
+	defer source.Remove()
+
+	redactions, err := redactionNames(c.Conf, j.Redact)
+	if err != nil {
+		return nil, err
+	}
+	redact, redactPatterns := redactOptions(c.Conf, redactions)
+
+	t := c.Statsd.NewTiming()
+	report = new(converter.Report)
+	block, blockURLs := c.Conf.Blocking.With(j.Block, j.BlockURLs)
+	uploadConversion := converter.UploadConversion{AWSS3: j.AWSS3}
+	conversion := athenapdf.AthenaPDF{
+		UploadConversion: uploadConversion,
+		CMD:              c.Conf.AthenaCMD,
+		Aggressive:       j.Aggressive,
+		WaitForStatus:    j.WaitForStatus,
+		NoPortrait:       j.NoPortrait,
+		PageSize:         j.PageSize,
+		SinglePage:       j.SinglePage,
+		Select:           j.Select,
+		LinkBase:         j.LinkBase,
+		StripLinks:       j.StripLinks,
+		Redact:           redact,
+		RedactPatterns:   redactPatterns,
+		RepeatHeaders:    j.RepeatHeaders,
+		AvoidBreak:       j.AvoidBreak,
+		BreakBefore:      j.BreakBefore,
+		BreakAfter:       j.BreakAfter,
+		Margins:          j.Margins,
+		Media:            j.Media,
+		Delay:            j.Delay,
+		RasterDPI:        j.RasterDPI,
+		SnapshotMedia:    j.SnapshotMedia,
+		DPI:              j.DPI,
+		Format:           j.Format,
+		Flags:            append(c.Conf.Chrome.FlagsWith(j.ChromeFlags), e.flags()...),
+		Proxy:            e.proxy,
+		Block:            block,
+		BlockURLs:        blockURLs,
+		Locale:           j.Locale,
+		Timezone:         j.Timezone,
+		RequestID:        j.RequestID,
+		Report:           report,
+	}
+	if j.IncludeSource {
+		conversion.DOM = new(bytes.Buffer)
+	}
+	if j.IncludeArchive {
+		conversion.Archive = new(bytes.Buffer)
+	}
+	conversion.Attachments = j.Attachments
+	conversion.AttachSource = j.AttachSource
+	if j.OCR {
+		conversion.OCR = newOCR(c.Conf, j.OCRLanguages)
+	}
+	conversion.Recolor = newRecolor(c.Conf, j.Grayscale, j.ICCProfile)
+	conversion.Overlays, _ = codeOverlays(j.Codes)
+	conversion.TIFF = newTIFF(c.Conf, j.Format)
+	work := converter.NewWorkWithProgress(c.Queue, conversion, *source, conversionProgress(c.Statsd, c.Progress, j.ID, j.Tenant))
+	emitStarted(c.jobEvents(j), work, j.ID, j.URL)
+	m := newConversionStats(c.Statsd, c.Conf, "queue", "athenapdf", j.Format, j.Tenant)
+	m.throughput = c.Throughput
+
+	// The upload is tracked while the conversion is pending, so that it is
+	// recorded after the stages reported by the conversion.
+	converted := work.Converted()
+	for {
+		select {
+		case <-converted:
+			progress.Set(c.Progress, j.ID, j.Tenant, progress.Uploading, nil)
+			converted = nil
+		case <-work.Uploaded():
+			t.Send("job_duration")
+			recordHost(c.Breaker, c.Statsd, host, false)
+			m.record(OutcomeUploaded, t.Duration())
+			report.Time(work)
+			if c.Usage != nil && j.Tenant != "" {
+				c.Usage.Record(j.Tenant, time.Now(), report.Pages, report.Bytes, report.CPUTime)
+			}
+			cacheOutput(c.OutputCache, key, j.Tenant, j.Subject, *source, work.Output(), report.Pages)
+			sendNotifications(c.Notifiers, c.Statsd, j.Notify, outputNotification(c.Conf, j.ID, j.URL, j.Format, work.Output(), report, j.AWSS3.Object))
+			events.EmitOutput(c.jobEvents(j), events.Completed, j.ID, j.URL, report.Pages, report.Bytes)
+			events.EmitOutput(c.jobEvents(j), events.Uploaded, j.ID, j.URL, report.Pages, report.Bytes)
+			progress.Set(c.Progress, j.ID, j.Tenant, progress.Completed, nil)
+			return report, nil
+		case <-work.Success():
+			m.record(OutcomeSuccess, t.Duration())
+			return nil, ErrJobNotUploaded
+		case err := <-work.Error():
+			m.record(jobOutcome(err), t.Duration())
+			if err == converter.ErrConversionTimeout {
+				recordHost(c.Breaker, c.Statsd, host, true)
+			}
+			return report, err
+		}
+	}
+}
+
+// uploadCached uploads the cached output of a job whose URL has not been
+// modified, instead of converting it again.
+func (c Consumer) uploadCached(j queue.Job, cached outputcache.Entry) (*converter.Report, error) {
+	progress.Set(c.Progress, j.ID, j.Tenant, progress.Uploading, nil)
+	uploaded, err := converter.UploadConversion{AWSS3: j.AWSS3}.Upload(cached.Output)
+	if err != nil {
+		return nil, err
+	}
+	if !uploaded {
+		return nil, ErrJobNotUploaded
+	}
+	c.Statsd.Increment("output_cache_hit")
+	report := &converter.Report{Pages: cached.Pages, Bytes: len(cached.Output)}
+	if c.Usage != nil && j.Tenant != "" {
+		c.Usage.Record(j.Tenant, time.Now(), report.Pages, report.Bytes, 0)
+	}
+	events.EmitOutput(c.jobEvents(j), events.Completed, j.ID, j.URL, report.Pages, report.Bytes)
+	events.EmitOutput(c.jobEvents(j), events.Uploaded, j.ID, j.URL, report.Pages, report.Bytes)
+	progress.Set(c.Progress, j.ID, j.Tenant, progress.Completed, nil)
+	return report, nil
+}
+
+// jobOutcome returns the outcome of a failed job for its stats.
+func jobOutcome(err error) string {
+	if err == converter.ErrConversionTimeout {
+		return OutcomeTimeout
+	}
+	if _, ok := err.(awserr.Error); ok {
+		return OutcomeUploadError
+	}
+	return OutcomeError
+}
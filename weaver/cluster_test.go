@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+func TestJobDestination(t *testing.T) {
+	conf := Config{Queue: Queue{S3Bucket: "default-bucket", Region: "eu-west-1"}}
+	j := jobDestination(conf, queue.Job{ID: "test-job"})
+	if got, want := j.AWSS3.S3Bucket, "default-bucket"; got != want {
+		t.Errorf("expected job S3 bucket to be %s, got %s", want, got)
+	}
+	if got, want := j.AWSS3.S3Key, "test-job.pdf"; got != want {
+		t.Errorf("expected job S3 key to be %s, got %s", want, got)
+	}
+	if got, want := j.AWSS3.Region, "eu-west-1"; got != want {
+		t.Errorf("expected job region to be %s, got %s", want, got)
+	}
+}
+
+func TestJobDestination_override(t *testing.T) {
+	conf := Config{Queue: Queue{S3Bucket: "default-bucket"}}
+	j := queue.Job{ID: "test-job"}
+	j.AWSS3.S3Bucket = "job-bucket"
+	j.AWSS3.S3Key = "job-key"
+	j = jobDestination(conf, j)
+	if got, want := j.AWSS3.S3Bucket, "job-bucket"; got != want {
+		t.Errorf("expected job S3 bucket to be %s, got %s", want, got)
+	}
+	if got, want := j.AWSS3.S3Key, "job-key"; got != want {
+		t.Errorf("expected job S3 key to be %s, got %s", want, got)
+	}
+}
+
+func TestJobDestination_contentAddressed(t *testing.T) {
+	conf := Config{Queue: Queue{S3Bucket: "default-bucket"}}
+	j := queue.Job{ID: "test-job"}
+	j.AWSS3.ContentAddressed = true
+	j = jobDestination(conf, j)
+	if got, want := j.AWSS3.S3Key, ""; got != want {
+		t.Errorf("expected job S3 key prefix to be %q, got %q", want, got)
+	}
+}
+
+func TestNewBroker_unknownDriver(t *testing.T) {
+	if _, err := NewBroker(Config{Queue: Queue{Driver: "unknown"}}); err != queue.ErrUnknownDriver {
+		t.Errorf("expected an unknown driver error, got %+v", err)
+	}
+}
+
+func TestConsumerProcess_quota(t *testing.T) {
+	s, _ := statsd.New(statsd.Mute(true))
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "acme", Key: "acme-secret", Quota: tenant.Quota{Conversions: 1}}})
+	usage, _ := tenant.NewAccountant("")
+	usage.Record("acme", time.Now(), 1, 1, 0)
+	c := Consumer{Conf: defaultConfig(), Usage: usage, Tenants: tenants, Statsd: s}
+
+	_, err := c.process(queue.Job{ID: "test-job", URL: "http://example.com", Tenant: "acme"})
+	if err != tenant.ErrQuotaExceeded {
+		t.Errorf("expected %v, got %+v", tenant.ErrQuotaExceeded, err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{7, 640 * time.Second},
+		{8, 15 * time.Minute},
+		{100, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.delay {
+			t.Errorf("expected the delay after %d attempts to be %s, got %s", tt.attempts, tt.delay, got)
+		}
+	}
+}
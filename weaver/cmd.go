@@ -0,0 +1,458 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lachee/athenapdf/weaver/sandbox"
+	"github.com/lachee/athenapdf/weaver/sqlite"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	// ErrConfigInvalid should be returned when the configuration fails
+	// validation (see Config.Validate).
+	ErrConfigInvalid = errors.New("invalid configuration")
+	// ErrCheckFailed should be returned when any self-check fails.
+	ErrCheckFailed = errors.New("self-check failed")
+	// ErrSQLiteDisabled should be returned when the embedded SQLite
+	// database is required, but none is configured.
+	ErrSQLiteDisabled = errors.New("no SQLite database configured (WEAVER_SQLITE_PATH)")
+)
+
+// version is set at build time, e.g. '-ldflags "-X main.version=2.1.0"'.
+var version = "dev"
+
+// configEnv contains the environment variables that may also be set with
+// command-line flags (see flagName).
+var configEnv = []string{
+	"WEAVER_CONFIG_FILE",
+	"WEAVER_HTTP_ADDR",
+	"WEAVER_SOCKET",
+	"WEAVER_SOCKET_MODE",
+	"WEAVER_HTTPS_ADDR",
+	"WEAVER_HTTP_WITH_HTTPS",
+	"WEAVER_LISTEN_NETWORK",
+	"WEAVER_TRUSTED_PROXIES",
+	"WEAVER_TLS_CERT_FILE",
+	"WEAVER_TLS_KEY_FILE",
+	"WEAVER_AUTH_KEY",
+	"WEAVER_ATHENA_CMD",
+	"WEAVER_MAX_WORKERS",
+	"WEAVER_MAX_CONVERSION_QUEUE",
+	"WEAVER_WORKER_TIMEOUT",
+	"WEAVER_MAX_UPLOAD_BYTES",
+	"WEAVER_CONVERSION_FALLBACK",
+	"WEAVER_OFFLINE_UPLOADS",
+	"WEAVER_PLAYGROUND",
+	"WEAVER_SANITIZE_POLICY",
+	"WEAVER_FONTS_DIR",
+	"WEAVER_FONTS_MAX_BYTES",
+	"WEAVER_SCHEDULES_FILE",
+	"WEAVER_UPLOADS_DIR",
+	"WEAVER_UPLOADS_EXPIRY",
+	"WEAVER_S3_WATCH_QUEUE_URL",
+	"WEAVER_S3_WATCH_REGION",
+	"WEAVER_S3_WATCH_INPUT_PREFIX",
+	"WEAVER_S3_WATCH_OUTPUT_PREFIX",
+	"WEAVER_S3_WATCH_OUTPUT_BUCKET",
+	"WEAVER_S3_WATCH_EXTENSIONS",
+	"WEAVER_WATCH_DIR",
+	"WEAVER_WATCH_OUTPUT_DIR",
+	"WEAVER_WATCH_INTERVAL",
+	"WEAVER_WATCH_PARAMS",
+	"WEAVER_SMTP_ADDR",
+	"WEAVER_SMTP_HOSTNAME",
+	"WEAVER_SMTP_MAX_BYTES",
+	"WEAVER_EMAIL_SMTP_ADDR",
+	"WEAVER_EMAIL_USERNAME",
+	"WEAVER_EMAIL_PASSWORD",
+	"WEAVER_EMAIL_FROM",
+	"WEAVER_EMAIL_SUBJECT",
+	"WEAVER_EMAIL_BODY",
+	"WEAVER_EMAIL_MAX_ATTACHMENT_BYTES",
+	"WEAVER_NOTIFY_WEBHOOK_HOSTS",
+	"WEAVER_NOTIFY_WEBHOOK_SECRET",
+	"WEAVER_NOTIFY_WEBHOOK_RETRIES",
+	"WEAVER_NOTIFY_SLACK_WEBHOOK_URL",
+	"WEAVER_NOTIFY_SNS_TOPIC",
+	"WEAVER_NOTIFY_SNS_REGION",
+	"WEAVER_NOTIFY_KAFKA_TOPIC",
+	"WEAVER_HOOKS_PLUGINS",
+	"WEAVER_HOOKS_WASM",
+	"WEAVER_HOOKS_WEBHOOKS",
+	"WEAVER_HOOKS_TIMEOUT",
+	"WEAVER_HOOKS_RETRIES",
+	"WEAVER_HOOKS_ON_FAILURE",
+	"WEAVER_PRESETS_FILE",
+	"WEAVER_POLICY_SCRIPT",
+	"WEAVER_CACHE_CONTROL",
+	"WEAVER_CDN_BASE_URL",
+	"WEAVER_CDN_BUCKET",
+	"WEAVER_TENANTS_FILE",
+	"WEAVER_USAGE_FILE",
+	"WEAVER_SQLITE_PATH",
+	"WEAVER_SECRETS_REFRESH",
+	"WEAVER_CORS_ALLOWED_ORIGINS",
+	"WEAVER_CORS_ALLOWED_METHODS",
+	"WEAVER_CORS_ALLOWED_HEADERS",
+	"WEAVER_CORS_EXPOSED_HEADERS",
+	"WEAVER_CORS_ALLOW_CREDENTIALS",
+	"WEAVER_CORS_MAX_AGE",
+	"WEAVER_S3_ACCESS_KEY",
+	"WEAVER_S3_ACCESS_SECRET",
+	"CLOUDCONVERT_API",
+	"CLOUDCONVERT_KEY",
+	"STATSD_ADDRESS",
+	"STATSD_PREFIX",
+	"STATSD_TAGS_FORMAT",
+	"SENTRY_DSN",
+	"WEAVER_AUDIT_SINK",
+	"WEAVER_AUDIT_DIR",
+	"WEAVER_AUDIT_S3_BUCKET",
+	"WEAVER_AUDIT_S3_PREFIX",
+	"WEAVER_AUDIT_REGION",
+	"WEAVER_AUDIT_RETENTION_DAYS",
+	"WEAVER_HISTORY_DRIVER",
+	"WEAVER_HISTORY_DSN",
+	"WEAVER_HISTORY_MAX_JOBS",
+	"WEAVER_REGISTRY_DRIVER",
+	"WEAVER_REGISTRY_DSN",
+	"WEAVER_REGISTRY_MAX_RECORDS",
+	"WEAVER_REGISTRY_MAX_BYTES",
+	"WEAVER_REGISTRY_SIGNING_KEY",
+	"WEAVER_RETENTION_DAYS",
+	"WEAVER_RETENTION_DRIVER",
+	"WEAVER_RETENTION_DSN",
+	"WEAVER_RETENTION_INTERVAL",
+	"WEAVER_IDEMPOTENCY_TTL",
+	"WEAVER_IDEMPOTENCY_MAX_BYTES",
+	"WEAVER_FETCH_TIMEOUT",
+	"WEAVER_FETCH_RETRIES",
+	"WEAVER_FETCH_RETRY_DELAY",
+	"WEAVER_SPOOL_DIR",
+	"WEAVER_SPOOL_MAX_BYTES",
+	"WEAVER_SANDBOX_DIR",
+	"WEAVER_SANDBOX_UIDS",
+	"WEAVER_SANDBOX_USER_NAMESPACE",
+	"WEAVER_SANDBOX_SECCOMP",
+	"WEAVER_SANDBOX_APPARMOR",
+	"WEAVER_SANDBOX_RUNTIME",
+	"WEAVER_SANDBOX_RUNSC",
+	"WEAVER_SANDBOX_ROOTFS",
+	"WEAVER_SANDBOX_NETNS",
+	"WEAVER_SANDBOX_PLATFORM",
+	"WEAVER_SANDBOX_WARM",
+	"WEAVER_MERGE_MAX_SOURCES",
+	"WEAVER_MERGE_PARALLELISM",
+	"WEAVER_OCR_ENABLED",
+	"WEAVER_OCR_TESSERACT",
+	"WEAVER_OCR_RASTERIZER",
+	"WEAVER_OCR_LANGUAGES",
+	"WEAVER_COLOR_GHOSTSCRIPT",
+	"WEAVER_COLOR_PROFILES",
+	"WEAVER_REDACT_PATTERNS",
+	"WEAVER_REDACT_DEFAULT",
+	"WEAVER_TIFF_GHOSTSCRIPT",
+	"WEAVER_TIFF_RESOLUTION",
+	"WEAVER_EXPORT_GOOGLE_ENDPOINT",
+	"WEAVER_EXPORT_GRAPH_ENDPOINT",
+	"WEAVER_CHARTS_DIR",
+	"WEAVER_OUTPUT_CACHE_MAX_BYTES",
+	"WEAVER_OUTPUT_CACHE_TTL",
+	"WEAVER_BREAKER_THRESHOLD",
+	"WEAVER_BREAKER_COOLDOWN",
+	"WEAVER_POLITENESS_HOST_CONCURRENCY",
+	"WEAVER_POLITENESS_CRAWL_DELAY",
+	"WEAVER_POLITENESS_MAX_WAIT",
+	"WEAVER_QUEUE_DRIVER",
+	"WEAVER_QUEUE_URL",
+	"WEAVER_QUEUE_REGION",
+	"WEAVER_QUEUE_VISIBILITY_TIMEOUT",
+	"WEAVER_QUEUE_CONSUMERS",
+	"WEAVER_QUEUE_MAX_ATTEMPTS",
+	"WEAVER_QUEUE_HEADLESS",
+	"WEAVER_QUEUE_S3_BUCKET",
+	"WEAVER_QUEUE_SNS_TOPIC",
+	"WEAVER_KAFKA_BROKERS",
+	"WEAVER_KAFKA_TOPIC",
+	"WEAVER_CHROME_FLAGS",
+	"WEAVER_CHROME_ALLOWED_FLAGS",
+	"WEAVER_BLOCK",
+	"WEAVER_BLOCK_URLS",
+	"WEAVER_PROXY_URL",
+	"WEAVER_PROXY_ALLOWED_URLS",
+	"WEAVER_HOST_MAP",
+	"WEAVER_HOST_MAP_ALLOWED_CIDRS",
+	"WEAVER_SOURCE_CA_FILE",
+	"WEAVER_SOURCE_CERT_FILE",
+	"WEAVER_SOURCE_KEY_FILE",
+}
+
+// flagName returns the name of the flag mirroring an environment variable,
+// e.g. 'max-workers' for WEAVER_MAX_WORKERS.
+func flagName(env string) string {
+	return strings.Replace(strings.ToLower(strings.TrimPrefix(env, "WEAVER_")), "_", "-", -1)
+}
+
+// applyFlags sets the environment variables mirrored by the flags that were
+// set, so that flags override the environment, and survive reloads.
+func applyFlags(flags *pflag.FlagSet) {
+	for _, env := range configEnv {
+		if f := flags.Lookup(flagName(env)); f != nil && f.Changed {
+			os.Setenv(env, f.Value.String())
+		}
+	}
+}
+
+// newRootCmd creates the weaver command. It serves the microservice if no
+// subcommand is given.
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "weaver",
+		Short:         "A microservice for converting HTML documents to PDF",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			applyFlags(cmd.Flags())
+		},
+		RunE: runServe,
+	}
+	for _, env := range configEnv {
+		root.PersistentFlags().String(flagName(env), "", "overrides "+env)
+	}
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Serve the conversion API (or consume jobs in headless mode)",
+			Args:  cobra.NoArgs,
+			RunE:  runServe,
+		},
+		newConvertCmd(),
+		newTenantsCmd(),
+		&cobra.Command{
+			Use:   "validate-config",
+			Short: "Load the configuration, and report any errors",
+			Args:  cobra.NoArgs,
+			RunE:  runValidateConfig,
+		},
+		&cobra.Command{
+			Use:   "check",
+			Short: "Validate the configuration, storage, converter, and display before serving",
+			Args:  cobra.NoArgs,
+			RunE:  runCheck,
+		},
+		&cobra.Command{
+			Use:                sandbox.ConfineCommand + " -- <command>",
+			Short:              "Run a command under the seccomp filter, and AppArmor profile of a sandbox",
+			Hidden:             true,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				err := sandbox.Confine(args)
+				fmt.Fprintln(cmd.OutOrStderr(), "Unable to confine command:", err)
+				os.Exit(126)
+			},
+		},
+		&cobra.Command{
+			Use:   "version",
+			Short: "Print the version",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				fmt.Fprintf(cmd.OutOrStdout(), "weaver %s (%s)\n", version, runtime.Version())
+			},
+		},
+	)
+	return root
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	conf, err := NewConfig()
+	if err != nil {
+		fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+		return err
+	}
+	if errs := conf.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+		}
+		return ErrConfigInvalid
+	}
+	serve(conf)
+	return nil
+}
+
+func runValidateConfig(cmd *cobra.Command, args []string) error {
+	conf, err := NewConfig()
+	if err != nil {
+		fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+		return err
+	}
+	if errs := conf.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+		}
+		return ErrConfigInvalid
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+	return nil
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	conf, err := NewConfig()
+	if err != nil {
+		fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+		return err
+	}
+	// The converter may need a display to start
+	stop := startDisplay()
+	defer stop()
+	if !runChecks(conf, checks, cmd.OutOrStdout()) {
+		return ErrCheckFailed
+	}
+	return nil
+}
+
+func newTenantsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tenants",
+		Short: "Manage the tenants (API keys) stored in the SQLite database",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "import <file>",
+			Short: "Replace the tenants with the tenants in a JSON file (see WEAVER_TENANTS_FILE)",
+			Long: "Replace the tenants stored in the SQLite database with the tenants " +
+				"in a JSON file. Running instances pick them up on their next reload " +
+				"(SIGHUP, or POST /admin/reload).",
+			Args: cobra.ExactArgs(1),
+			RunE: runTenantsImport,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the tenants stored in the SQLite database",
+			Args:  cobra.NoArgs,
+			RunE:  runTenantsList,
+		},
+	)
+	return cmd
+}
+
+// openSQLite opens the embedded SQLite database of the configuration.
+func openSQLite() (*sql.DB, error) {
+	conf, err := NewConfig()
+	if err != nil {
+		return nil, err
+	}
+	if conf.SQLitePath == "" {
+		return nil, ErrSQLiteDisabled
+	}
+	return sqlite.Open(conf.SQLitePath)
+}
+
+func runTenantsImport(cmd *cobra.Command, args []string) error {
+	r, err := tenant.LoadRegistry(args[0])
+	if err != nil {
+		return err
+	}
+	db, err := openSQLite()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := tenant.WriteSQLiteTenants(db, r.List()); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported %d tenants\n", len(r.List()))
+	return nil
+}
+
+func runTenantsList(cmd *cobra.Command, args []string) error {
+	db, err := openSQLite()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tenants, err := tenant.ReadSQLiteTenants(db)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, t := range tenants {
+		fmt.Fprintf(w, "%s\t%s\n", t.ID, t.Name)
+	}
+	return w.Flush()
+}
+
+func newConvertCmd() *cobra.Command {
+	var (
+		opts       convertOptions
+		params     []string
+		format     string
+		pageSize   string
+		aggressive bool
+		landscape  bool
+		quiet      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "convert <url|file|->",
+		Short: "Convert a URL, or local file once, without starting the HTTP server",
+		Long: "Convert a URL, local file, or stdin ('-') once through the conversion " +
+			"routes (in-process), exactly as the microservice would, and exit. " +
+			"Any query parameter of the conversion routes may be set with --param.",
+		Example: "  weaver convert https://example.com -o example.pdf\n" +
+			"  weaver convert invoice.html -o invoice.pdf --page-size A4 --param block=ads\n" +
+			"  cat report.md | weaver convert - --param ext=md --format text",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := NewConfig()
+			if err != nil {
+				fmt.Fprintln(cmd.OutOrStderr(), "Invalid configuration:", err)
+				return err
+			}
+			if opts.Params, err = parseParams(params); err != nil {
+				fmt.Fprintln(cmd.OutOrStderr(), err)
+				return err
+			}
+			if format != "" {
+				opts.Params.Set("format", format)
+			}
+			if pageSize != "" {
+				opts.Params.Set("page_size", pageSize)
+			}
+			if aggressive {
+				opts.Params.Set("aggressive", "true")
+			}
+			if landscape {
+				opts.Params.Set("no_portrait", "true")
+			}
+			opts.Stdin = os.Stdin
+			if !quiet {
+				opts.Report = cmd.OutOrStderr()
+			}
+
+			stop := startDisplay()
+			defer stop()
+			if err := convert(conf, args[0], opts); err != nil {
+				fmt.Fprintln(cmd.OutOrStderr(), "Conversion failed:", err)
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", "-", "the output file ('-' for stdout)")
+	cmd.Flags().StringArrayVarP(&params, "param", "p", nil, "a query parameter of the conversion routes (key=value), repeatable")
+	cmd.Flags().StringVar(&format, "format", "", "the output format, e.g. 'text' (see 'format')")
+	cmd.Flags().StringVar(&pageSize, "page-size", "", "the page size, e.g. 'A4' (see 'page_size')")
+	cmd.Flags().BoolVar(&aggressive, "aggressive", false, "extract the main content only (see 'aggressive')")
+	cmd.Flags().BoolVar(&landscape, "landscape", false, "use the landscape orientation (see 'no_portrait')")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "do not print the conversion report")
+	return cmd
+}
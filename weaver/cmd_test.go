@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlagName(t *testing.T) {
+	tests := map[string]string{
+		"WEAVER_MAX_WORKERS": "max-workers",
+		"WEAVER_CONFIG_FILE": "config-file",
+		"STATSD_ADDRESS":     "statsd-address",
+		"SENTRY_DSN":         "sentry-dsn",
+	}
+	for env, want := range tests {
+		if got := flagName(env); got != want {
+			t.Errorf("expected flag of %s to be %s, got %s", env, want, got)
+		}
+	}
+}
+
+func TestRootCmd_flags(t *testing.T) {
+	defer os.Unsetenv("WEAVER_MAX_WORKERS")
+	out := new(bytes.Buffer)
+	cmd := newRootCmd()
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"validate-config", "--max-workers", "3"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("validate-config returned an unexpected error: %+v", err)
+	}
+	conf, _ := NewConfig()
+	if got, want := conf.MaxWorkers, 3; got != want {
+		t.Errorf("expected max workers to be %d, got %d", want, got)
+	}
+	if got, want := out.String(), "Configuration is valid\n"; got != want {
+		t.Errorf("expected output to be %q, got %q", want, got)
+	}
+}
+
+func TestRootCmd_invalidConfig(t *testing.T) {
+	cmd := newRootCmd()
+	cmd.SetOutput(new(bytes.Buffer))
+	cmd.SetArgs([]string{"validate-config", "--config-file", "/nonexistent/weaver.yaml"})
+	defer os.Unsetenv("WEAVER_CONFIG_FILE")
+	if err := cmd.Execute(); err == nil {
+		t.Errorf("expected validate-config to return an error")
+	}
+}
+
+func TestTenantsCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tenants")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("WEAVER_SQLITE_PATH")
+	p := filepath.Join(dir, "tenants.json")
+	ioutil.WriteFile(p, []byte(`[{"id": "acme", "name": "ACME Corp.", "key": "acme-secret"}]`), 0600)
+	db := filepath.Join(dir, "weaver.db")
+
+	out := new(bytes.Buffer)
+	cmd := newRootCmd()
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"tenants", "import", p, "--sqlite-path", db})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("tenants import returned an unexpected error: %+v", err)
+	}
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"tenants", "list", "--sqlite-path", db})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("tenants list returned an unexpected error: %+v", err)
+	}
+	if got, want := out.String(), "ID    NAME\nacme  ACME Corp.\n"; got != want {
+		t.Errorf("expected output to be %q, got %q", want, got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "convert")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "test.html")
+	ioutil.WriteFile(source, []byte("<h1>test convert</h1>"), 0644)
+	output := filepath.Join(dir, "test.pdf")
+
+	conf := defaultConfig()
+	conf.AthenaCMD = "echo"
+	if err := convert(conf, source, convertOptions{Output: output}); err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	// The echo "converter" outputs the path of the uploaded file
+	b, _ := ioutil.ReadFile(output)
+	if got := string(b); !strings.HasSuffix(strings.TrimSpace(got), ".html") {
+		t.Errorf("expected output to be the path of the uploaded file, got %q", got)
+	}
+
+	// Parameters are validated by the conversion routes
+	opts := convertOptions{Output: output, Params: url.Values{"format": {"docx"}}}
+	if err := convert(conf, source, opts); err == nil || !strings.Contains(err.Error(), ErrFormatInvalid.Error()) {
+		t.Errorf("expected an invalid format error, got %+v", err)
+	}
+
+	conf.AthenaCMD = "false"
+	if err := convert(conf, source, convertOptions{Output: output}); err == nil {
+		t.Errorf("expected a failing conversion to return an error")
+	}
+}
+
+func TestConvert_stdin(t *testing.T) {
+	f, err := ioutil.TempFile("", "convert")
+	if err != nil {
+		t.Fatalf("unable to create temporary file: %+v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	conf := defaultConfig()
+	conf.AthenaCMD = "echo"
+	report := new(bytes.Buffer)
+	opts := convertOptions{
+		Output: f.Name(),
+		Params: url.Values{"ext": {"md"}},
+		Stdin:  strings.NewReader("# test convert"),
+		Report: report,
+	}
+	if err := convert(conf, "-", opts); err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got := report.String(); !strings.HasPrefix(got, "Converted - in ") {
+		t.Errorf("expected a conversion report, got %q", got)
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	got, err := parseParams([]string{"block=ads", "block=fonts", "chrome_flag=lang=en-GB"})
+	if err != nil {
+		t.Fatalf("parse params returned an unexpected error: %+v", err)
+	}
+	want := url.Values{"block": {"ads", "fonts"}, "chrome_flag": {"lang=en-GB"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected params to be %v, got %v", want, got)
+	}
+	if _, err := parseParams([]string{"aggressive"}); err != ErrParamInvalid {
+		t.Errorf("expected an invalid parameter error, got %+v", err)
+	}
+}
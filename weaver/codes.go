@@ -0,0 +1,248 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/breaker"
+	"github.com/lachee/athenapdf/weaver/chart"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/email"
+	"github.com/lachee/athenapdf/weaver/export"
+	"github.com/lachee/athenapdf/weaver/fonts"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"github.com/lachee/athenapdf/weaver/idempotency"
+	"github.com/lachee/athenapdf/weaver/mhtml"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"github.com/lachee/athenapdf/weaver/ocr"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"github.com/lachee/athenapdf/weaver/policy"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/preset"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/report"
+	"github.com/lachee/athenapdf/weaver/scheduler"
+	"github.com/lachee/athenapdf/weaver/spool"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/lachee/athenapdf/weaver/tus"
+)
+
+// Error codes are stable, machine-readable identifiers of errors. They are
+// returned in the `code` field of JSON error bodies, and recorded in the
+// `errors.<code>` stats (in lower case).
+const (
+	CodeInvalidOptions    = "INVALID_OPTIONS"
+	CodeUnauthorized      = "UNAUTHORIZED"
+	CodeForbidden         = "FORBIDDEN"
+	CodeNotFound          = "NOT_FOUND"
+	CodeQuotaExceeded     = "QUOTA_EXCEEDED"
+	CodeConflict          = "CONFLICT"
+	CodeAsyncUnavailable  = "ASYNC_UNAVAILABLE"
+	CodeQueueUnavailable  = "QUEUE_UNAVAILABLE"
+	CodeSourceFetchFailed = "SOURCE_FETCH_FAILED"
+	CodeSourceUnavailable = "SOURCE_UNAVAILABLE"
+	CodeRenderFailed      = "RENDER_FAILED"
+	CodeRenderTimeout     = "RENDER_TIMEOUT"
+	CodeSpoolFull         = "SPOOL_FULL"
+	CodeUploadFailed      = "UPLOAD_FAILED"
+	CodeUploadTooLarge    = "UPLOAD_TOO_LARGE"
+	CodeClientClosed      = "CLIENT_CLOSED"
+	CodeHookFailed        = "HOOK_FAILED"
+	CodePolicyRejected    = "POLICY_REJECTED"
+	CodeInternal          = "INTERNAL_ERROR"
+)
+
+// errorCodes maps known errors to their codes.
+var errorCodes = map[error]string{
+	ErrURLInvalid:               CodeInvalidOptions,
+	ErrFileInvalid:              CodeInvalidOptions,
+	ErrAsyncNoUpload:            CodeInvalidOptions,
+	ErrEmailToInvalid:           CodeInvalidOptions,
+	ErrEmailDeliveryUnavailable: CodeInvalidOptions,
+	ErrNotifyTooMany:            CodeInvalidOptions,
+	notify.ErrUnknownTarget:     CodeInvalidOptions,
+	notify.ErrTargetInvalid:     CodeInvalidOptions,
+	ErrIncludeSourceNoUpload:    CodeInvalidOptions,
+	ErrIncludeArchiveNoUpload:   CodeInvalidOptions,
+	ErrFormatInvalid:            CodeInvalidOptions,
+	ErrChromeFlagNotAllowed:     CodeInvalidOptions,
+	ErrBlockTypeInvalid:         CodeInvalidOptions,
+	ErrOfflineURL:               CodeInvalidOptions,
+	ErrLocaleInvalid:            CodeInvalidOptions,
+	ErrTimezoneInvalid:          CodeInvalidOptions,
+	ErrMarginsInvalid:           CodeInvalidOptions,
+	ErrMediaInvalid:             CodeInvalidOptions,
+	ErrDelayInvalid:             CodeInvalidOptions,
+	ErrRasterDPIInvalid:         CodeInvalidOptions,
+	ErrDPIInvalid:               CodeInvalidOptions,
+	ErrPageSizeInvalid:          CodeInvalidOptions,
+	ErrProxyNotAllowed:          CodeInvalidOptions,
+	ErrHostMapNotAllowed:        CodeInvalidOptions,
+	ErrScheduleInvalid:          CodeInvalidOptions,
+	ErrDiffNoSources:            CodeInvalidOptions,
+	ErrDiffTolerance:            CodeInvalidOptions,
+	ErrInspectNoSource:          CodeInvalidOptions,
+	ErrMergeNoSources:           CodeInvalidOptions,
+	ErrMergeTooManySources:      CodeInvalidOptions,
+	ErrMergeFormat:              CodeInvalidOptions,
+	ErrMergeParallelism:         CodeInvalidOptions,
+	ErrDocumentNoSource:         CodeInvalidOptions,
+	pdf.ErrRangeInvalid:         CodeInvalidOptions,
+	ErrStampsInvalid:            CodeInvalidOptions,
+	ErrStampNoImage:             CodeInvalidOptions,
+	pdf.ErrImageInvalid:         CodeInvalidOptions,
+	pdf.ErrPositionInvalid:      CodeInvalidOptions,
+	pdf.ErrQRTooLong:            CodeInvalidOptions,
+	pdf.ErrBarcodeInvalid:       CodeInvalidOptions,
+	ErrCodesInvalid:             CodeInvalidOptions,
+	ErrCodesFormat:              CodeInvalidOptions,
+	ErrDigestInvalid:            CodeInvalidOptions,
+	ErrRetentionInvalid:         CodeInvalidOptions,
+	ErrRedactInvalid:            CodeInvalidOptions,
+	ErrRedactAttachSource:       CodeInvalidOptions,
+	ErrSubjectInvalid:           CodeInvalidOptions,
+	pdf.ErrFitInvalid:           CodeInvalidOptions,
+	ErrImagesMarginInvalid:      CodeInvalidOptions,
+	ErrImagesDPIInvalid:         CodeInvalidOptions,
+	ErrAttachmentsFormat:        CodeInvalidOptions,
+	ErrAttachmentsInvalid:       CodeInvalidOptions,
+	pdf.ErrAttachmentName:       CodeInvalidOptions,
+	pdf.ErrRelationshipInvalid:  CodeInvalidOptions,
+	ErrSinglePageFormat:         CodeInvalidOptions,
+	ErrBreakSelectorInvalid:     CodeInvalidOptions,
+	ErrSelectInvalid:            CodeInvalidOptions,
+	ErrLinkBaseInvalid:          CodeInvalidOptions,
+	ErrExportNoToken:            CodeInvalidOptions,
+	ErrEmailAttachmentsInvalid:  CodeInvalidOptions,
+	email.ErrNotMessage:         CodeInvalidOptions,
+	ErrReportNoRows:             CodeInvalidOptions,
+	report.ErrNoColumns:         CodeInvalidOptions,
+	report.ErrColumnInvalid:     CodeInvalidOptions,
+	report.ErrRowsInvalid:       CodeInvalidOptions,
+	export.ErrUnsupported:       CodeInvalidOptions,
+	chart.ErrTypeInvalid:        CodeInvalidOptions,
+	chart.ErrSpecInvalid:        CodeInvalidOptions,
+	chart.ErrSizeInvalid:        CodeInvalidOptions,
+	chart.ErrBackgroundInvalid:  CodeInvalidOptions,
+	chart.ErrUnavailable:        CodeInvalidOptions,
+	ErrSectionsUnsupported:      CodeInvalidOptions,
+	ErrSectionSourceMissing:     CodeInvalidOptions,
+	ErrSectionOrientation:       CodeInvalidOptions,
+	ErrColorDisabled:            CodeInvalidOptions,
+	ErrColorFormat:              CodeInvalidOptions,
+	ErrColorProfileUnknown:      CodeInvalidOptions,
+	ErrColorConflict:            CodeInvalidOptions,
+	ErrTIFFDisabled:             CodeInvalidOptions,
+	ErrOCRDisabled:              CodeInvalidOptions,
+	ErrOCRFormat:                CodeInvalidOptions,
+	ErrOCRLanguagesInvalid:      CodeInvalidOptions,
+	ocr.ErrNotImage:             CodeInvalidOptions,
+	ErrRequestInvalid:           CodeInvalidOptions,
+	ErrSourceInvalid:            CodeInvalidOptions,
+	ErrEncodingInvalid:          CodeInvalidOptions,
+	ErrAsyncContent:             CodeInvalidOptions,
+	ErrJobQueryInvalid:          CodeInvalidOptions,
+	ErrSubjectRequired:          CodeInvalidOptions,
+	ErrPresetUnknown:            CodeInvalidOptions,
+	ErrPresetInvalid:            CodeInvalidOptions,
+	preset.ErrNameInvalid:       CodeInvalidOptions,
+	preset.ErrOptionsInvalid:    CodeInvalidOptions,
+	scheduler.ErrCronInvalid:    CodeInvalidOptions,
+	fonts.ErrFontInvalid:        CodeInvalidOptions,
+	fonts.ErrFontName:           CodeInvalidOptions,
+	fonts.ErrFontTooLarge:       CodeUploadTooLarge,
+
+	ErrAuthorization:              CodeUnauthorized,
+	ErrAdminOnly:                  CodeForbidden,
+	export.ErrDenied:              CodeForbidden,
+	tenant.ErrDomainNotAllowed:    CodeForbidden,
+	scheduler.ErrScheduleNotFound: CodeNotFound,
+	fonts.ErrFontNotFound:         CodeNotFound,
+	preset.ErrNotFound:            CodeNotFound,
+	ErrJobNotFound:                CodeNotFound,
+	export.ErrNotFound:            CodeNotFound,
+	tenant.ErrQuotaExceeded:       CodeQuotaExceeded,
+	idempotency.ErrInProgress:     CodeConflict,
+	idempotency.ErrKeyReused:      CodeInvalidOptions,
+	ErrIdempotencyKeyInvalid:      CodeInvalidOptions,
+
+	ErrAsyncUnavailable:            CodeAsyncUnavailable,
+	queue.ErrBrokerClosed:          CodeQueueUnavailable,
+	queue.ErrQueueFull:             CodeQueueUnavailable,
+	breaker.ErrOpen:                CodeSourceUnavailable,
+	politeness.ErrBusy:             CodeSourceUnavailable,
+	politeness.ErrCancelled:        CodeClientClosed,
+	mhtml.ErrNoDocument:            CodeRenderFailed,
+	pdf.ErrNotPDF:                  CodeRenderFailed,
+	pdf.ErrNoPages:                 CodeRenderFailed,
+	pdf.ErrNoCatalog:               CodeRenderFailed,
+	pdf.ErrProfileInvalid:          CodeRenderFailed,
+	gcmd.ErrCmdTerminated:          CodeRenderFailed,
+	converter.ErrConversionTimeout: CodeRenderTimeout,
+	spool.ErrQuotaExceeded:         CodeSpoolFull,
+	ErrSourceTooLarge:              CodeSpoolFull,
+	ErrUploadTooLarge:              CodeUploadTooLarge,
+	ErrVerifyTooLarge:              CodeUploadTooLarge,
+	tus.ErrTooLarge:                CodeUploadTooLarge,
+	tus.ErrNotFound:                CodeNotFound,
+	tus.ErrOffsetMismatch:          CodeConflict,
+	tus.ErrLocked:                  CodeConflict,
+	tus.ErrIncomplete:              CodeConflict,
+	tus.ErrLengthInvalid:           CodeInvalidOptions,
+	tus.ErrMetadataInvalid:         CodeInvalidOptions,
+	ErrTusVersion:                  CodeInvalidOptions,
+	ErrTusContentType:              CodeInvalidOptions,
+	ErrTusOffsetInvalid:            CodeInvalidOptions,
+	export.ErrTooLarge:             CodeSpoolFull,
+	ErrDocumentFetch:               CodeSourceFetchFailed,
+	export.ErrFailed:               CodeSourceFetchFailed,
+	ErrJobNotUploaded:              CodeUploadFailed,
+	ErrClientClosed:                CodeClientClosed,
+}
+
+// statusCodes are the codes of errors without a known code, by the status of
+// the response.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidOptions,
+	http.StatusUnprocessableEntity: CodeInvalidOptions,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusGatewayTimeout:      CodeRenderTimeout,
+}
+
+// errorCode returns the code of an error returned with the status.
+func errorCode(err error, status int) string {
+	if code, ok := errorCodes[err]; ok {
+		return code
+	}
+	switch err.(type) {
+	case *url.Error:
+		return CodeSourceFetchFailed
+	case *gcmd.ExitError:
+		return CodeRenderFailed
+	case awserr.Error:
+		return CodeUploadFailed
+	case *hooks.Error:
+		return CodeHookFailed
+	case *policy.Rejection:
+		return CodePolicyRejected
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return CodeInternal
+}
+
+// lastErrorCode returns the code of the last error of a request, unless it is
+// overridden with a code set as the error's meta.
+func lastErrorCode(c *gin.Context, e *gin.Error) string {
+	if code, ok := e.Meta.(string); ok {
+		return code
+	}
+	return errorCode(e.Err, c.Writer.Status())
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		want   string
+	}{
+		{ErrFormatInvalid, http.StatusBadRequest, CodeInvalidOptions},
+		{ErrAuthorization, http.StatusUnauthorized, CodeUnauthorized},
+		{converter.ErrConversionTimeout, http.StatusGatewayTimeout, CodeRenderTimeout},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: errors.New("no such host")}, http.StatusOK, CodeSourceFetchFailed},
+		{&gcmd.ExitError{Err: errors.New("exit status 1"), ExitCode: 1}, http.StatusOK, CodeRenderFailed},
+		{errors.New("unknown public error"), http.StatusBadRequest, CodeInvalidOptions},
+		{errors.New("unknown error"), http.StatusOK, CodeInternal},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err, tt.status); got != tt.want {
+			t.Errorf("expected code of %v (%d) to be %s, got %s", tt.err, tt.status, tt.want, got)
+		}
+	}
+}
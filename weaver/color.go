@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/recolor"
+)
+
+var (
+	// ErrColorDisabled should be returned when a color conversion is
+	// requested, but Ghostscript is not configured.
+	ErrColorDisabled = errors.New("color conversion is not enabled")
+	// ErrColorFormat should be returned when a color conversion is requested
+	// for an output format other than PDF.
+	ErrColorFormat = errors.New("color conversion is only supported by the PDF format")
+	// ErrColorProfileUnknown should be returned when an ICC profile is
+	// requested that is not configured.
+	ErrColorProfileUnknown = errors.New("unknown ICC profile provided (icc_profile)")
+	// ErrColorConflict should be returned when both grayscale, and an ICC
+	// profile are requested.
+	ErrColorConflict = errors.New("grayscale, and icc_profile cannot be combined")
+)
+
+// newRecolor returns the color conversion of the configuration to grayscale,
+// or to the named ICC profile, or nil if neither is requested.
+func newRecolor(conf Config, gray bool, profile string) *recolor.Recolor {
+	if !gray && profile == "" {
+		return nil
+	}
+	return &recolor.Recolor{
+		Ghostscript: conf.Color.Ghostscript,
+		Gray:        gray,
+		Profile:     conf.Color.Profiles[profile],
+		ProfileName: profile,
+		Dir:         converter.Spool.Dir(),
+	}
+}
+
+// requestRecolor returns the color conversion of the output of a conversion
+// ('grayscale', or 'icc_profile'), or nil.
+func requestRecolor(c *gin.Context) (*recolor.Recolor, error) {
+	conf := c.MustGet("config").(Config)
+	gray, profile := queryFlag(c, "grayscale"), c.Query("icc_profile")
+	if !gray && profile == "" {
+		return nil, nil
+	}
+	if conf.Color.Ghostscript == "" {
+		return nil, ErrColorDisabled
+	}
+	if gray && profile != "" {
+		return nil, ErrColorConflict
+	}
+	if _, ok := conf.Color.Profiles[profile]; profile != "" && !ok {
+		return nil, ErrColorProfileUnknown
+	}
+	return newRecolor(conf, gray, profile), nil
+}
+
+// checkColor checks that the colors of the output of a conversion can be
+// converted.
+func checkColor(c *gin.Context) error {
+	r, err := requestRecolor(c)
+	if r == nil || err != nil {
+		return err
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+		return ErrColorFormat
+	}
+	return nil
+}
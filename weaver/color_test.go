@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestRecolor(t *testing.T) {
+	conf := Config{Color: Color{Ghostscript: "gs", Profiles: map[string]string{"fogra39": "/icc/coated.icc"}}}
+	tests := []struct {
+		query   string
+		profile string
+		err     error
+	}{
+		{"?grayscale=true", "", nil},
+		{"?icc_profile=fogra39", "/icc/coated.icc", nil},
+		{"?icc_profile=swop", "", ErrColorProfileUnknown},
+		{"?grayscale=true&icc_profile=fogra39", "", ErrColorConflict},
+		{"?grayscale=true&format=text", "", ErrColorFormat},
+	}
+	for _, tt := range tests {
+		var err error
+		r := gin.New()
+		r.Use(ConfigMiddleware(conf))
+		r.GET("/", func(c *gin.Context) {
+			if err = checkColor(c); err == nil {
+				rc, _ := requestRecolor(c)
+				if rc.Profile != tt.profile || rc.ProfileName != c.Query("icc_profile") {
+					t.Errorf("expected profile of %q to be %s, got %+v", tt.query, tt.profile, rc)
+				}
+			}
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if err != tt.err {
+			t.Errorf("expected options %q to return %v, got %v", tt.query, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+// outputETag returns the entity tag of an output: its SHA-256 digest
+// (computed if digest is empty).
+func outputETag(out []byte, digest string) string {
+	if digest == "" {
+		digest = converter.Digest(out)
+	}
+	return `"` + digest + `"`
+}
+
+// etagMatches returns true if an If-None-Match header matches an entity tag
+// (using the weak comparison).
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// sendOutput returns the output of a conversion with its ETag, and the
+// configured Cache-Control, if any (for GET requests without a data
+// subject), or '304 Not Modified' if the request already has the output
+// (If-None-Match).
+func sendOutput(c *gin.Context, contentType string, out []byte, digest string) {
+	etag := outputETag(out, digest)
+	c.Header("ETag", etag)
+	if c.Request.Method == http.MethodGet {
+		if _, ok := c.GetQuery("subject"); ok {
+			c.Header("Cache-Control", "private, no-store")
+		} else if cc := c.MustGet("config").(Config).CacheControl; cc != "" {
+			c.Header("Cache-Control", cc)
+		}
+	}
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, out)
+}
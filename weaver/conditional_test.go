@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"def", "abc"`, true},
+		{`*`, true},
+		{`"def"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("expected If-None-Match %q to match: %v, got %v", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestSendOutput(t *testing.T) {
+	out := []byte("%PDF-1.4")
+	etag := outputETag(out, "")
+	r := gin.New()
+	r.Use(ConfigMiddleware(Config{CacheControl: "private, max-age=300"}))
+	r.GET("/convert", func(c *gin.Context) {
+		sendOutput(c, "application/pdf", out, "")
+	})
+	r.POST("/convert", func(c *gin.Context) {
+		sendOutput(c, "application/pdf", out, "")
+	})
+
+	tests := []struct {
+		method, path, ifNoneMatch string
+		code                      int
+		cacheControl              string
+	}{
+		{"GET", "/convert", "", http.StatusOK, "private, max-age=300"},
+		{"GET", "/convert", etag, http.StatusNotModified, "private, max-age=300"},
+		{"GET", "/convert", `"stale"`, http.StatusOK, "private, max-age=300"},
+		{"GET", "/convert?subject=customer-42", "", http.StatusOK, "private, no-store"},
+		{"POST", "/convert", etag, http.StatusNotModified, ""},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		r.ServeHTTP(res, req)
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of %s %s (%q) to be %d, got %d", tt.method, tt.path, tt.ifNoneMatch, tt.code, got)
+		}
+		if got := res.Header().Get("ETag"); got != etag {
+			t.Errorf("expected ETag to be %s, got %s", etag, got)
+		}
+		if got := res.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("expected Cache-Control of %s %s to be %q, got %q", tt.method, tt.path, tt.cacheControl, got)
+		}
+		if tt.code == http.StatusNotModified && res.Body.Len() != 0 {
+			t.Errorf("expected no body with %d, got %d bytes", tt.code, res.Body.Len())
+		}
+	}
+}
+
+func TestSendOutput_defaultConfig(t *testing.T) {
+	r := gin.New()
+	r.Use(ConfigMiddleware(defaultConfig()))
+	r.GET("/convert", func(c *gin.Context) {
+		sendOutput(c, "application/pdf", []byte("%PDF-1.4"), "")
+	})
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/convert", nil))
+	// Shared caches must not store the outputs of authenticated requests
+	if got := res.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("expected no Cache-Control by default, got %q", got)
+	}
+}
@@ -6,6 +6,31 @@ if [ -w /etc/hosts ]; then
    cat conf/hosts >> /etc/hosts
 fi
 
+# Trust the source CA bundle, and present the client certificate in the
+# renderer (Chromium reads the NSS database)
+if [ -n "$WEAVER_SOURCE_CA_FILE" ] || [ -n "$WEAVER_SOURCE_CERT_FILE" ]; then
+   nssdb="sql:$HOME/.pki/nssdb"
+   mkdir -p "$HOME/.pki/nssdb"
+   [ -f "$HOME/.pki/nssdb/cert9.db" ] || certutil -d "$nssdb" -N --empty-password
+fi
+
+if [ -n "$WEAVER_SOURCE_CA_FILE" ]; then
+   tmp=$(mktemp -d)
+   csplit -s -z -f "$tmp/ca-" "$WEAVER_SOURCE_CA_FILE" '/-----BEGIN CERTIFICATE-----/' '{*}'
+   for ca in "$tmp"/ca-*; do
+      grep -q "BEGIN CERTIFICATE" "$ca" || continue
+      certutil -d "$nssdb" -A -t "C,," -n "weaver-source-$(basename "$ca")" -i "$ca"
+   done
+   rm -rf "$tmp"
+fi
+
+if [ -n "$WEAVER_SOURCE_CERT_FILE" ]; then
+   p12=$(mktemp)
+   openssl pkcs12 -export -passout pass: -in "$WEAVER_SOURCE_CERT_FILE" -inkey "$WEAVER_SOURCE_KEY_FILE" -out "$p12"
+   pk12util -d "$nssdb" -i "$p12" -W ""
+   rm -f "$p12"
+fi
+
 rm -f /tmp/.X99-lock
 export DISPLAY=:99
 
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// ErrParamInvalid should be returned when a conversion parameter is not a
+// 'key=value' pair.
+var ErrParamInvalid = errors.New("invalid parameter (use key=value)")
+
+// convertOptions are the options of a one-shot conversion.
+type convertOptions struct {
+	// The output file ('-' for stdout).
+	Output string
+	// The query parameters of the conversion route, e.g. 'format', or
+	// 'page_size'.
+	Params url.Values
+	// The document to convert if the source is '-'.
+	Stdin io.Reader
+	// Receives a summary of the conversion report, if set.
+	Report io.Writer
+}
+
+// parseParams parses 'key=value' pairs into query parameters.
+func parseParams(pairs []string) (url.Values, error) {
+	params := url.Values{}
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, ErrParamInvalid
+		}
+		params.Add(kv[0], kv[1])
+	}
+	return params, nil
+}
+
+// convert runs a single conversion of a URL, local file, or stdin ('-')
+// through the conversion routes (in-process), so that it is performed
+// exactly as the microservice would, and writes the output to a file.
+func convert(conf Config, source string, opts convertOptions) error {
+	gin.SetMode(gin.ReleaseMode)
+	pool := converter.NewPool(1, 1, conf.WorkerTimeout)
+	defer pool.Resize(0)
+	s, _ := statsd.New(statsd.Mute(true))
+
+	router := inProcessRouter(conf, Services{Queue: pool.Queue(), Statsd: s})
+
+	req, err := conversionRequest(conf, source, opts)
+	if err != nil {
+		return err
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(recorder{res}, req)
+	if res.Code != http.StatusOK {
+		return fmt.Errorf("%d %s: %s", res.Code, http.StatusText(res.Code), strings.TrimSpace(res.Body.String()))
+	}
+	if opts.Report != nil {
+		h := res.Header()
+		fmt.Fprintf(opts.Report, "Converted %s in %sms (queue wait: %sms, pages: %s, bytes: %s)\n",
+			source, h.Get("X-Conversion-Duration"), h.Get("X-Queue-Wait"), h.Get("X-Page-Count"), h.Get("X-Output-Bytes"))
+	}
+
+	if opts.Output == "" || opts.Output == "-" {
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	}
+	return ioutil.WriteFile(opts.Output, res.Body.Bytes(), 0644)
+}
+
+// inProcessRouter returns a router with the conversion routes only, for
+// conversions without an HTTP intake (e.g. one-shot conversions).
+func inProcessRouter(conf Config, svc Services) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	InitMiddleware(router, conf, svc)
+	InitSecureRoutes(router, conf, svc)
+	return router
+}
+
+// conversionError is the error of a failed in-process conversion.
+type conversionError struct {
+	Status  int
+	Message string `json:"error"`
+	Code    string `json:"code"`
+}
+
+func (e *conversionError) Error() string {
+	return e.Message
+}
+
+// serveConversion runs a conversion request through the handler (in-process),
+// and returns its response, or a conversionError if it failed.
+func serveConversion(handler http.Handler, req *http.Request) (*httptest.ResponseRecorder, error) {
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(recorder{res}, req)
+	if res.Code == http.StatusOK {
+		return res, nil
+	}
+	e := &conversionError{Status: res.Code}
+	if json.Unmarshal(res.Body.Bytes(), e); e.Message == "" {
+		e.Message = http.StatusText(res.Code)
+	}
+	return nil, e
+}
+
+// recorder records the response of an in-process conversion, whose client
+// never disconnects.
+type recorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r recorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// conversionRequest creates the request to convert a URL ('GET /convert'),
+// or upload a local file, or stdin ('POST /convert').
+func conversionRequest(conf Config, source string, opts convertOptions) (*http.Request, error) {
+	q := url.Values{}
+	for k, v := range opts.Params {
+		q[k] = v
+	}
+	q.Set("auth", conf.AuthKey)
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		q.Set("url", source)
+		return http.NewRequest("GET", "/convert?"+q.Encode(), nil)
+	}
+
+	var upload io.Reader
+	name := "stdin"
+	if source == "-" {
+		upload = opts.Stdin
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if fi, err := f.Stat(); err != nil {
+			return nil, err
+		} else if fi.IsDir() {
+			return nil, errors.New(source + " is a directory")
+		}
+		upload, name = f, filepath.Base(source)
+		if ext := strings.TrimPrefix(filepath.Ext(source), "."); ext != "" && q.Get("ext") == "" {
+			q.Set("ext", ext)
+		}
+	}
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, upload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", "/convert?"+q.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req, nil
+}
+
+// startDisplay starts Xvfb for a one-shot conversion if it is installed, and
+// the local display (DISPLAY, defaulting to ':99') is not running yet, e.g.
+// outside of the microservice's container. The returned function stops it.
+func startDisplay() func() {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		display = ":99"
+	}
+	if !strings.HasPrefix(display, ":") {
+		return func() {}
+	}
+	socket := "/tmp/.X11-unix/X" + strings.SplitN(display[1:], ".", 2)[0]
+	if _, err := os.Stat(socket); err == nil {
+		return func() {}
+	}
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		return func() {}
+	}
+
+	cmd := exec.Command("Xvfb", display, "-ac", "-screen", "0", "1024x768x24")
+	if err := cmd.Start(); err != nil {
+		log.Println("Unable to start Xvfb:", err)
+		return func() {}
+	}
+	os.Setenv("DISPLAY", display)
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
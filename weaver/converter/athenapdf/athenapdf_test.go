@@ -1,17 +1,25 @@
 package athenapdf
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"github.com/lachee/athenapdf/weaver/raster"
 	"github.com/lachee/athenapdf/weaver/testutil"
 )
 
 func TestConstructCMD(t *testing.T) {
-	got := constructCMD("athenapdf -S -T 120", "test_file.html", false, false, false, "")
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S -T 120"}, "test_file.html")
 	want := []string{"athenapdf", "-S", "-T", "120", "test_file.html"}
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
@@ -19,27 +27,133 @@ func TestConstructCMD(t *testing.T) {
 }
 
 func TestConstructCMD_aggressive(t *testing.T) {
-	cmd := constructCMD("athenapdf -S -T 60", "test_file.html", true, false, false, "")
+	cmd := constructCMD(AthenaPDF{CMD: "athenapdf -S -T 60", Aggressive: true}, "test_file.html")
 	if got, want := cmd[len(cmd)-1], "-A"; got != want {
 		t.Errorf("expected last argument of constructed athenapdf command to be %s, got %+v", want, got)
 	}
 }
 
 func TestConstructCMD_landscape(t *testing.T) {
-	cmd := constructCMD("athenapdf -S -T 60", "test_file.html", false, false, true, "")
+	cmd := constructCMD(AthenaPDF{CMD: "athenapdf -S -T 60", NoPortrait: true}, "test_file.html")
 	if got, want := cmd[len(cmd)-1], "--no-portrait"; got != want {
 		t.Errorf("expected last argument of constructed athenapdf command to be %s, got %+v", want, got)
 	}
 }
 
 func TestConstructCMD_pageSizeA3(t *testing.T) {
-	got := constructCMD("athenapdf -S -T 60", "test_file.html", false, false, false, "A3")
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S -T 60", PageSize: "A3"}, "test_file.html")
 	want := []string{"athenapdf", "-S", "-T", "60", "test_file.html", "-P", "A3"}
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
 	}
 }
 
+func TestConstructCMD_singlePage(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", PageSize: "Letter", SinglePage: true}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "-P", "Letter", "--single-page"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_pageBreaks(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", Select: "#report", RepeatHeaders: true, AvoidBreak: []string{"figure", ".card"}, BreakBefore: []string{"h1"}}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--select", "#report", "--repeat-table-headers", "--avoid-break", "figure", "--avoid-break", ".card", "--break-before", "h1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_links(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", LinkBase: "https://example.com/docs/", StripLinks: true}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--link-base", "https://example.com/docs/", "--strip-external-links"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_redact(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", Redact: []string{"email", "card"}, RedactPatterns: []string{`EMP-\d{6}`}}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--redact", "email", "--redact", "card", "--redact-pattern", `EMP-\d{6}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_markdown(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S -T 60", Aggressive: true, Format: FormatMarkdown}, "test_file.html")
+	want := []string{"athenapdf", "-S", "-T", "60", "test_file.html", "-A", "-F", "html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_flags(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", Flags: []string{"disable-gpu", "lang=en-GB"}}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "-C", "disable-gpu", "-C", "lang=en-GB"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_proxy(t *testing.T) {
+	cmd := constructCMD(AthenaPDF{CMD: "athenapdf -S", Proxy: "http://proxy:3128"}, "test_file.html")
+	if got, want := cmd[len(cmd)-2:], []string{"--proxy", "http://proxy:3128"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected last arguments of constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_layout(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", Margins: "none", Media: "screen", Delay: 500}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "-M", "none", "--media", "screen", "-D", "500"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_fidelity(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", RasterDPI: 300, SnapshotMedia: true}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--raster-dpi", "300", "--snapshot-media"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_dpi(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", DPI: 300}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--raster-dpi", "300"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+	// The raster resolution overrides the output resolution
+	got = constructCMD(AthenaPDF{CMD: "athenapdf -S", DPI: 300, RasterDPI: 150}, "test_file.html")
+	if want := []string{"athenapdf", "-S", "test_file.html", "--raster-dpi", "150"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_block(t *testing.T) {
+	got := constructCMD(AthenaPDF{CMD: "athenapdf -S", Block: []string{"ads", "fonts"}, BlockURLs: []string{"*/beacon/*"}}, "test_file.html")
+	want := []string{"athenapdf", "-S", "test_file.html", "--block", "ads", "--block", "fonts", "--block-url", "*/beacon/*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_offline(t *testing.T) {
+	cmd := constructCMD(AthenaPDF{CMD: "athenapdf -S", Offline: true}, "test_file.html")
+	if got, want := cmd[len(cmd)-1], "--offline"; got != want {
+		t.Errorf("expected last argument of constructed athenapdf command to be %s, got %+v", want, got)
+	}
+}
+
+func TestConstructCMD_locale(t *testing.T) {
+	cmd := constructCMD(AthenaPDF{CMD: "athenapdf -S", Locale: "de-DE", Timezone: "Europe/Berlin"}, "test_file.html")
+	if got, want := cmd[len(cmd)-4:], []string{"--locale", "de-DE", "--timezone", "Europe/Berlin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected last arguments of constructed athenapdf command to be %+v, got %+v", want, got)
+	}
+}
+
 func mockConversion(path string, tmp bool, cmd string) ([]byte, error) {
 	c := AthenaPDF{}
 	c.CMD = cmd
@@ -47,7 +161,7 @@ func mockConversion(path string, tmp bool, cmd string) ([]byte, error) {
 	s.URI = path
 	s.IsLocal = tmp
 	t := make(chan struct{}, 1)
-	return c.Convert(s, t)
+	return c.Convert(s, t, nil)
 }
 
 func TestConvert(t *testing.T) {
@@ -71,12 +185,18 @@ func TestConvert_local(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to get full temporary file path: %+v", err)
 	}
+	defer os.Remove(p)
 	got, err := mockConversion(p, true, "echo")
 	if err != nil {
 		t.Fatalf("convert returned an unexpected error: %+v", err)
 	}
-	if want := []byte(p + "\n"); !reflect.DeepEqual(got, want) {
-		t.Errorf("expected output of athenapdf conversion to be %s, got %s", want, got)
+	// Local sources are imported into the sandbox of the conversion
+	path := strings.TrimSpace(string(got))
+	if filepath.Base(path) != filepath.Base(p) || !strings.HasPrefix(filepath.Base(filepath.Dir(path)), "weaver-job-") {
+		t.Errorf("expected the source to be converted from a sandbox, got %s", path)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the sandbox to be removed, got %v", err)
 	}
 }
 
@@ -91,3 +211,276 @@ func TestConvert_badCMD(t *testing.T) {
 		t.Errorf("expected output of athenapdf conversion to be nil, got %s", got)
 	}
 }
+
+func TestConvert_report(t *testing.T) {
+	c := AthenaPDF{}
+	c.CMD = "echo"
+	c.Report = new(converter.Report)
+	s := converter.ConversionSource{URI: "test_file.html"}
+	out, err := c.Convert(s, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got, want := c.Report.Bytes, len(out); got != want {
+		t.Errorf("expected report bytes to be %d, got %d", want, got)
+	}
+}
+
+func TestConvert_requestID(t *testing.T) {
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("echo $WEAVER_REQUEST_ID\n")
+	f.Close()
+	c := AthenaPDF{}
+	c.CMD = "sh " + f.Name()
+	c.RequestID = "test-id"
+	got, err := c.Convert(converter.ConversionSource{URI: "test_file.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if want := []byte("test-id\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected output of athenapdf conversion to be %s, got %s", want, got)
+	}
+}
+
+func TestConvert_progress(t *testing.T) {
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("echo 'athenapdf:progress loaded' >&2\necho 'athenapdf:progress output 5' >&2\necho $@\n")
+	f.Close()
+	c := AthenaPDF{CMD: "sh " + f.Name(), Format: FormatMarkdown}
+	var got []converter.Progress
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), func(p converter.Progress) {
+		got = append(got, p)
+	})
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	want := []converter.Progress{
+		{Stage: converter.ProgressLoaded},
+		{Stage: converter.ProgressOutput, Bytes: 5},
+		{Stage: converter.ProgressPostProcessing, Bytes: 29},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reported progress to be %+v, got %+v", want, got)
+	}
+	if got, want := string(out), "--progress test.html -F html\n"; got != want {
+		t.Errorf("expected athenapdf command arguments to be %q, got %q", want, got)
+	}
+}
+
+func TestConvert_diagnostics(t *testing.T) {
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`echo 'athenapdf:diagnostic {"type":"exception","message":"Uncaught TypeError: x is undefined","url":"https://example.com/app.js","line":3}' >&2` + "\necho $@\n")
+	f.Close()
+	c := AthenaPDF{CMD: "sh " + f.Name(), Report: new(converter.Report)}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got, want := string(out), "--diagnostics test.html\n"; got != want {
+		t.Errorf("expected athenapdf command arguments to be %q, got %q", want, got)
+	}
+	want := []converter.Diagnostic{{Type: converter.DiagnosticException, Message: "Uncaught TypeError: x is undefined", URL: "https://example.com/app.js", Line: 3}}
+	if !reflect.DeepEqual(c.Report.Diagnostics, want) {
+		t.Errorf("expected diagnostics to be %+v, got %+v", want, c.Report.Diagnostics)
+	}
+}
+
+func TestConvert_dom(t *testing.T) {
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	// The path of the DOM is the last argument
+	f.WriteString("for p; do :; done\necho '<html></html>' > $p\necho pdf\n")
+	f.Close()
+	c := AthenaPDF{CMD: "sh " + f.Name(), DOM: new(bytes.Buffer)}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got, want := string(out), "pdf\n"; got != want {
+		t.Errorf("expected output of athenapdf conversion to be %q, got %q", want, got)
+	}
+	if got, want := c.DOM.String(), "<html></html>\n"; got != want {
+		t.Errorf("expected rendered DOM to be %q, got %q", want, got)
+	}
+}
+
+func TestConvert_archive(t *testing.T) {
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	// The path of the WARC file is the last argument
+	f.WriteString("for p; do :; done\necho 'WARC/1.1' > $p\necho pdf\n")
+	f.Close()
+	c := AthenaPDF{CMD: "sh " + f.Name(), Archive: new(bytes.Buffer)}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got, want := string(out), "pdf\n"; got != want {
+		t.Errorf("expected output of athenapdf conversion to be %q, got %q", want, got)
+	}
+	if got, want := c.Archive.String(), "WARC/1.1\n"; got != want {
+		t.Errorf("expected archive to be %q, got %q", want, got)
+	}
+}
+
+func TestConvert_attachments(t *testing.T) {
+	testPDF, err := filepath.Abs("../../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to find test PDF: %+v", err)
+	}
+	f, err := ioutil.TempFile("", "athenapdf")
+	if err != nil {
+		t.Fatalf("unable to create temporary file for testing: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("for p; do :; done\necho '<html></html>' > $p\ncat " + testPDF + "\n")
+	f.Close()
+	c := AthenaPDF{
+		CMD:          "sh " + f.Name(),
+		Attachments:  []pdf.Attachment{{Name: "invoice.xml", MimeType: "text/xml", Data: []byte("<invoice/>")}},
+		AttachSource: true,
+	}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if !bytes.Contains(out, []byte("/Names [(invoice.xml) ")) || !bytes.Contains(out, []byte("(source.html)")) {
+		t.Errorf("expected the output to have the attachments")
+	}
+	if got, want := pdf.PageCount(out), 1; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
+
+func TestConvert_tiff(t *testing.T) {
+	dir := t.TempDir()
+	testPDF, _ := filepath.Abs("../../testdata/test.pdf")
+	cli, gs := filepath.Join(dir, "athenapdf"), filepath.Join(dir, "gs")
+	ioutil.WriteFile(cli, []byte("cat "+testPDF+"\n"), 0600)
+	ioutil.WriteFile(gs, []byte("for p; do case $p in -sOutputFile=*) out=${p#-sOutputFile=};; esac; done\necho II > \"$out\"\n"), 0600)
+
+	c := AthenaPDF{CMD: "sh " + cli, Format: FormatTIFF, Report: new(converter.Report)}
+	if _, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil); err != ErrTIFFUnavailable {
+		t.Errorf("expected error to be %v, got %v", ErrTIFFUnavailable, err)
+	}
+	c.TIFF = &raster.TIFF{Ghostscript: "sh " + gs, Resolution: "204x196", Dir: dir}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if got, want := string(out), "II\n"; got != want {
+		t.Errorf("expected the output to be the TIFF image, got %q", got)
+	}
+	// The pages of the PDF are reported
+	if got, want := c.Report.Pages, 1; got != want {
+		t.Errorf("expected report pages to be %d, got %d", want, got)
+	}
+}
+
+func TestConvert_pngDPI(t *testing.T) {
+	dir := t.TempDir()
+	screenshot := filepath.Join(dir, "screenshot.png")
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	f, _ := os.Create(screenshot)
+	png.Encode(f, img)
+	f.Close()
+	cli := filepath.Join(dir, "athenapdf")
+	ioutil.WriteFile(cli, []byte("cat "+screenshot+"\n"), 0600)
+
+	c := AthenaPDF{CMD: "sh " + cli, Format: FormatPNG, DPI: 300}
+	out, err := c.Convert(converter.ConversionSource{URI: "test.html"}, make(chan struct{}, 1), nil)
+	if err != nil {
+		t.Fatalf("convert returned an unexpected error: %+v", err)
+	}
+	if !bytes.Contains(out, []byte("pHYs\x00\x00\x2e\x23")) {
+		t.Errorf("expected the screenshot to record its resolution")
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want converter.Progress
+		ok   bool
+	}{
+		{"athenapdf:progress printing", converter.Progress{Stage: "printing"}, true},
+		{"athenapdf:progress output 1024", converter.Progress{Stage: "output", Bytes: 1024}, true},
+		{"athenapdf:progress ", converter.Progress{}, false},
+		{"Failed to load: -105", converter.Progress{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseProgress(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("expected progress line %q to be parsed as %+v (%v), got %+v (%v)", tt.line, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestParseDiagnostic(t *testing.T) {
+	tests := []struct {
+		line string
+		want converter.Diagnostic
+		ok   bool
+	}{
+		{`athenapdf:diagnostic {"type":"request","message":"net::ERR_NAME_NOT_RESOLVED","url":"https://cdn.example.com/app.js"}`, converter.Diagnostic{Type: "request", Message: "net::ERR_NAME_NOT_RESOLVED", URL: "https://cdn.example.com/app.js"}, true},
+		{`athenapdf:diagnostic {"type":"request","message":"Not Found","status":404}`, converter.Diagnostic{Type: "request", Message: "Not Found", Status: 404}, true},
+		{"athenapdf:diagnostic {}", converter.Diagnostic{}, false},
+		{"athenapdf:diagnostic oops", converter.Diagnostic{}, false},
+		{"athenapdf:progress loaded", converter.Diagnostic{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDiagnostic(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("expected diagnostic line %q to be parsed as %+v (%v), got %+v (%v)", tt.line, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestAthenaPDF_runHook(t *testing.T) {
+	var got []string
+	p := hooks.New()
+	for _, stage := range []string{hooks.PostRender, hooks.PreUpload} {
+		p.Register(stage, hooks.HookFunc(func(pl hooks.Payload) (hooks.Payload, error) {
+			got = append(got, pl.Stage+" "+pl.ContentType+" "+pl.URL)
+			pl.Body = append(pl.Body, '!')
+			return pl, nil
+		}))
+	}
+	converter.Hooks = p
+	defer func() { converter.Hooks = nil }()
+
+	c := AthenaPDF{Format: FormatTIFF}
+	s := converter.ConversionSource{URI: "https://example.com"}
+	out, err := c.runHook(hooks.PostRender, s, []byte("%PDF"))
+	if err == nil {
+		out, err = c.runHook(hooks.PreUpload, s, out)
+	}
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if string(out) != "%PDF!!" {
+		t.Errorf("expected the output of both stages, got %q", out)
+	}
+	want := []string{"post-render application/pdf https://example.com", "pre-upload image/tiff https://example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hooks %v, got %v", want, got)
+	}
+}
@@ -193,7 +193,7 @@ func (p Process) StartConversion(c Conversion) ([]byte, error) {
 	return nil, nil
 }
 
-func (c CloudConvert) Convert(s converter.ConversionSource, done <-chan struct{}) ([]byte, error) {
+func (c CloudConvert) Convert(s converter.ConversionSource, done <-chan struct{}, progress converter.ProgressFunc) ([]byte, error) {
 	log.Printf("[CloudConvert] converting to PDF: %s\n", s.GetActualURI())
 
 	var b []byte
@@ -222,7 +222,9 @@ func (c CloudConvert) Convert(s converter.ConversionSource, done <-chan struct{}
 
 	u := uuid.NewV4()
 
-	if c.AWSS3.S3Bucket == "" || c.AWSS3.S3Key == "" {
+	// Content-addressed objects are named after the output, so they are
+	// uploaded by Upload
+	if c.AWSS3.S3Bucket == "" || c.AWSS3.S3Key == "" || c.AWSS3.ContentAddressed {
 		conv.Download = "inline"
 		conv.Filename = u.String() + ".html"
 	} else {
@@ -243,11 +245,12 @@ func (c CloudConvert) Convert(s converter.ConversionSource, done <-chan struct{}
 		return nil, err
 	}
 
+	progress.Report(converter.ProgressOutput, len(b))
 	return b, nil
 }
 
 func (c CloudConvert) Upload(b []byte) (bool, error) {
-	if c.AWSS3.S3Bucket == "" || c.AWSS3.S3Key == "" {
+	if !c.AWSS3.HasDestination() {
 		return false, nil
 	}
 
@@ -11,7 +11,9 @@ type Conversion struct{}
 // synchronously.
 // It should terminate any long-running processes (and Goroutines) if the done
 // channel is returned.
-func (c Conversion) Convert(s ConversionSource, done <-chan struct{}) ([]byte, error) {
+// It should report the progress stages it supports using the progress
+// function (see ProgressFunc.Report).
+func (c Conversion) Convert(s ConversionSource, done <-chan struct{}, progress ProgressFunc) ([]byte, error) {
 	return []byte{}, nil
 }
 
@@ -9,7 +9,7 @@ func TestConversion_Convert(t *testing.T) {
 	mockConversion := Conversion{}
 	mockSource := ConversionSource{}
 	mockDone := make(chan struct{}, 1)
-	got, err := mockConversion.Convert(mockSource, mockDone)
+	got, err := mockConversion.Convert(mockSource, mockDone, nil)
 	if err != nil {
 		t.Fatalf("convert returned an unexpected error: %+v", err)
 	}
@@ -1,6 +1,8 @@
 package converter
 
 type Converter interface {
-	Convert(ConversionSource, <-chan struct{}) ([]byte, error)
+	// Convert converts a source. It reports its progress to the progress
+	// function (which may be nil).
+	Convert(ConversionSource, <-chan struct{}, ProgressFunc) ([]byte, error)
 	Upload([]byte) (bool, error)
 }
@@ -0,0 +1,40 @@
+package converter
+
+// Progress stages reported to a ProgressFunc, in the order they normally
+// occur. Converters report the stages they support.
+const (
+	// ProgressRendering is reported by the worker when it starts a
+	// conversion.
+	ProgressRendering = "rendering"
+	// ProgressLoaded is reported when the page, and its resources have
+	// loaded.
+	ProgressLoaded = "loaded"
+	// ProgressPrinting is reported when the output has started to be
+	// generated.
+	ProgressPrinting = "printing"
+	// ProgressOutput is reported when the output has been produced, with
+	// its size.
+	ProgressOutput = "output"
+	// ProgressPostProcessing is reported when the output is being
+	// processed further (e.g. converted to Markdown).
+	ProgressPostProcessing = "post_processing"
+)
+
+// Progress is the coarse progress of a conversion.
+type Progress struct {
+	Stage string
+	// Bytes is the size of the output produced so far (if known).
+	Bytes int
+}
+
+// ProgressFunc is called with the progress of a conversion. It is called
+// from the goroutine running the conversion, so it must not block.
+type ProgressFunc func(Progress)
+
+// Report calls the function with a stage, and the size of the output (if
+// known). It does nothing if the function is nil.
+func (f ProgressFunc) Report(stage string, bytes int) {
+	if f != nil {
+		f(Progress{Stage: stage, Bytes: bytes})
+	}
+}
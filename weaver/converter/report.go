@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// Report contains metadata collected while running a conversion.
+// Converters that support it fill in a report (if they are given one) before
+// returning a successful conversion.
+type Report struct {
+	// CPUTime is the CPU time used by the conversion process.
+	CPUTime time.Duration
+	// Pages is the number of pages in the output.
+	Pages int
+	// Bytes is the size of the output.
+	Bytes int
+	// SHA256 is the hex SHA-256 digest of the output.
+	SHA256 string
+	// QueueWait is the time spent in the work queue.
+	QueueWait time.Duration
+	// Duration is the time spent converting (and uploading).
+	Duration time.Duration
+	// Diagnostics are the problems of the page seen while it was rendered
+	// (at most MaxDiagnostics), also when the conversion failed.
+	Diagnostics []Diagnostic
+}
+
+// Types of diagnostics.
+const (
+	// DiagnosticConsole is an error logged to the console by the page.
+	DiagnosticConsole = "console"
+	// DiagnosticException is an uncaught JavaScript exception.
+	DiagnosticException = "exception"
+	// DiagnosticRequest is a subresource that failed to load, or was
+	// loaded with an error status.
+	DiagnosticRequest = "request"
+)
+
+// MaxDiagnostics is the maximum number of diagnostics kept in a report.
+const MaxDiagnostics = 100
+
+// Diagnostic is a problem of a page seen while it was rendered, which may
+// explain why it rendered blank, or incomplete.
+type Diagnostic struct {
+	// Type is DiagnosticConsole, DiagnosticException, or DiagnosticRequest.
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// URL is the URL of the resource that failed to load, or of the script
+	// that logged the error (if known).
+	URL string `json:"url,omitempty"`
+	// Line is the line of the script (if known).
+	Line int `json:"line,omitempty"`
+	// Status is the HTTP status of a resource loaded with an error status.
+	Status int `json:"status,omitempty"`
+}
+
+// Diagnose adds a diagnostic to a report, unless it already has
+// MaxDiagnostics.
+func (r *Report) Diagnose(d Diagnostic) {
+	if len(r.Diagnostics) < MaxDiagnostics {
+		r.Diagnostics = append(r.Diagnostics, d)
+	}
+}
+
+// Time sets the timing metadata of a report using finished work.
+func (r *Report) Time(w Work) {
+	r.QueueWait = w.QueueWait()
+	r.Duration = time.Since(w.StartedAt())
+}
+
+// Fill sets the output metadata of a report using the conversion output.
+func (r *Report) Fill(out []byte) {
+	r.Pages = pdf.PageCount(out)
+	r.Bytes = len(out)
+	r.SHA256 = Digest(out)
+}
+
+// Digest returns the hex SHA-256 digest of an output.
+func Digest(out []byte) string {
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:])
+}
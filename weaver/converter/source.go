@@ -1,6 +1,10 @@
 package converter
 
 import (
+	"bytes"
+	"errors"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"github.com/lachee/athenapdf/weaver/spool"
 	"golang.org/x/net/publicsuffix"
 	"io"
 	"io/ioutil"
@@ -10,6 +14,27 @@ import (
 	"path/filepath"
 )
 
+// Spool holds the sources that are saved locally (and the outputs of
+// converters that support it). If it is nil, they are saved in the system
+// temporary directory without a quota.
+var Spool *spool.Spool
+
+// Hooks transform the sources, and outputs of conversions at the stages of
+// the conversion pipeline (see hooks.Pipeline). If it is nil, there are no
+// hooks.
+var Hooks *hooks.Pipeline
+
+// ErrNotModified should be returned when a remote resource has not been
+// modified since it was fetched with the given validators.
+var ErrNotModified = errors.New("source has not been modified")
+
+// Validators are the cache validators of a remote resource, used to make
+// conditional requests.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
 // ConversionSource contains the target resource path, and its MIME type.
 // It may contain additional metadata about the conversion source.
 type ConversionSource struct {
@@ -30,6 +55,8 @@ type ConversionSource struct {
 	// and false if the target is a remote source (that does not require
 	// pre-processing).
 	IsLocal bool
+	// Validators of the remote resource (if it sent any).
+	Validators Validators
 }
 
 // readerContentType attempts to determine the content type using bytes from a
@@ -50,7 +77,7 @@ func readerContentType(r io.Reader) (string, error) {
 // It returns the full temporary file path, and its mime type if successful.
 func readerTmpFile(r io.Reader) (string, string, error) {
 	// Create a temporary file
-	f, err := ioutil.TempFile("/tmp", "athena.tmp.*")
+	f, err := Spool.Create("athena.tmp.*")
 	if err != nil {
 		return "", "", err
 	}
@@ -58,6 +85,7 @@ func readerTmpFile(r io.Reader) (string, string, error) {
 
 	// Pipe bytes from a reader to a file writer
 	if _, err = io.Copy(f, r); err != nil {
+		f.Remove()
 		return "", "", err
 	}
 
@@ -100,21 +128,40 @@ func rawSource(s *ConversionSource, body io.Reader) error {
 // uriSource is a remote conversion strategy handler. It will attempt to fetch
 // the remote URI to determine: if it is accessible; its mime type; and
 // if it needs pre-processing (e.g. `octet-stream`).
-func uriSource(s *ConversionSource, uri string) error {
+// The request is conditional if validators are given.
+func uriSource(s *ConversionSource, uri string, c *http.Client, v Validators) error {
 	// Fetch URL with support for cookies (to handle session-based redirects)
 	opts := cookiejar.Options{PublicSuffixList: publicsuffix.List}
 	jar, err := cookiejar.New(&opts)
 	if err != nil {
 		return err
 	}
-	client := http.Client{Jar: jar}
-	res, err := client.Get(uri)
+	client := *c
+	client.Jar = jar
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	if res != nil {
 		defer res.Body.Close()
 	}
+	if res.StatusCode == http.StatusNotModified {
+		return ErrNotModified
+	}
+	s.Validators = Validators{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
 
 	// Save content locally (temporarily) if the HTTP header indicates that it
 	// is a binary stream.
@@ -123,7 +170,7 @@ func uriSource(s *ConversionSource, uri string) error {
 		// Set the OriginalURI as we are running a local conversion strategy
 		s.OriginalURI = uri
 		// Pipe HTTP response body to a temporary file via io.Reader
-		if rawSource(s, res.Body) != nil {
+		if err := rawSource(s, res.Body); err != nil {
 			return err
 		}
 	} else {
@@ -158,13 +205,30 @@ func setCustomExtension(s *ConversionSource, ext string) error {
 // The ConversionSource is prepared using one of two strategies: a local
 // conversion (see rawSource) or a remote conversion (see uriSource).
 func NewConversionSource(uri string, body io.Reader, ext string) (*ConversionSource, error) {
+	return NewConversionSourceWithClient(uri, body, ext, http.DefaultClient)
+}
+
+// NewConversionSourceWithClient is like NewConversionSource, but it fetches
+// remote resources using the given HTTP client (e.g. to use a proxy).
+func NewConversionSourceWithClient(uri string, body io.Reader, ext string, client *http.Client) (*ConversionSource, error) {
+	return newConversionSource(uri, body, ext, client, Validators{})
+}
+
+// NewConditionalSource is like NewConversionSourceWithClient for a remote
+// resource, but it returns ErrNotModified if the resource has not been
+// modified since it was fetched with the validators.
+func NewConditionalSource(uri, ext string, client *http.Client, v Validators) (*ConversionSource, error) {
+	return newConversionSource(uri, nil, ext, client, v)
+}
+
+func newConversionSource(uri string, body io.Reader, ext string, client *http.Client, v Validators) (*ConversionSource, error) {
 	s := new(ConversionSource)
 
 	var err error
 	if body != nil {
 		err = rawSource(s, body)
 	} else {
-		err = uriSource(s, uri)
+		err = uriSource(s, uri, client, v)
 	}
 
 	if err != nil {
@@ -182,6 +246,14 @@ func NewConversionSource(uri string, body io.Reader, ext string) (*ConversionSou
 	return s, nil
 }
 
+// Remove removes the local file of a source (if it has one).
+func (s ConversionSource) Remove() error {
+	if !s.IsLocal {
+		return nil
+	}
+	return Spool.Remove(s.URI)
+}
+
 // GetActualURI returns the original conversion target. The URI field may
 // not contain the original conversion target as it may be overwritten when
 // using a local conversion strategy.
@@ -192,3 +264,47 @@ func (s ConversionSource) GetActualURI() string {
 	}
 	return uri
 }
+
+// Transform runs the hooks of a stage on a source. A local source is given
+// the content of its file, and is copied to a new local file (which the
+// caller must remove) if the hooks change it. A remote source only has its
+// URL, which the hooks may rewrite.
+func (s ConversionSource) Transform(stage string) (ConversionSource, error) {
+	if !Hooks.Has(stage) {
+		return s, nil
+	}
+	if !s.IsLocal {
+		p, err := Hooks.Run(stage, hooks.Payload{URL: s.URI, ContentType: s.Mime})
+		if err != nil {
+			return s, err
+		}
+		s.URI = p.URL
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(s.URI)
+	if err != nil {
+		return s, err
+	}
+	p, err := Hooks.Run(stage, hooks.Payload{URL: s.GetActualURI(), ContentType: s.Mime, Body: b})
+	if err != nil {
+		return s, err
+	}
+	if bytes.Equal(p.Body, b) {
+		return s, nil
+	}
+	f, err := Spool.Create("athena.hook.*" + filepath.Ext(s.URI))
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	if _, err := f.Write(p.Body); err != nil {
+		f.Remove()
+		return s, err
+	}
+	if s.OriginalURI == "" {
+		s.OriginalURI = s.URI
+	}
+	s.URI = f.Name()
+	return s, nil
+}
@@ -3,6 +3,8 @@ package converter
 import (
 	"bytes"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -10,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"github.com/lachee/athenapdf/weaver/spool"
 	"github.com/lachee/athenapdf/weaver/testutil"
 )
 
@@ -120,6 +124,26 @@ func TestReaderTmpFile(t *testing.T) {
 	}
 }
 
+func TestReaderTmpFile_quota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Spool = spool.New(dir, 4)
+	defer func() { Spool = nil }()
+
+	if _, _, err := readerTmpFile(strings.NewReader("<!DOCTYPE HTML>")); err != spool.ErrQuotaExceeded {
+		t.Errorf("expected error to be %v, got %v", spool.ErrQuotaExceeded, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected partial file to be removed, got %d files", len(files))
+	}
+	if got := Spool.Used(); got != 0 {
+		t.Errorf("expected used bytes to be released, got %d", got)
+	}
+}
+
 func TestRawSource(t *testing.T) {
 	s := new(ConversionSource)
 	mockURI := "http://this-should-be-overwritten"
@@ -137,7 +161,7 @@ func TestUriSource(t *testing.T) {
 	s := new(ConversionSource)
 	ts := testutil.MockHTTPServer("", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>", false)
 	defer ts.Close()
-	err := uriSource(s, ts.URL)
+	err := uriSource(s, ts.URL, http.DefaultClient, Validators{})
 	if err != nil {
 		t.Fatalf("urisource returned an unexpected error: %+v", err)
 	}
@@ -150,7 +174,7 @@ func TestUriSource_basicAuth(t *testing.T) {
 	defer ts.Close()
 
 	// Test unauthenticated
-	err := uriSource(s, ts.URL)
+	err := uriSource(s, ts.URL, http.DefaultClient, Validators{})
 	if err != nil {
 		t.Fatalf("urisource (unauthenticated) returned an unexpected error: %+v", err)
 	}
@@ -166,7 +190,7 @@ func TestUriSource_basicAuth(t *testing.T) {
 	}
 
 	u.User = url.UserPassword("test", "test")
-	err = uriSource(s, u.String())
+	err = uriSource(s, u.String(), http.DefaultClient, Validators{})
 	if err != nil {
 		t.Fatalf("urisource (authenticated) returned an unexpected error: %+v", err)
 	}
@@ -181,7 +205,7 @@ func TestUriSource_octet(t *testing.T) {
 	mockData := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>"
 	ts := testutil.MockHTTPServer("application/octet-stream", mockData, false)
 	defer ts.Close()
-	err := uriSource(s, ts.URL)
+	err := uriSource(s, ts.URL, http.DefaultClient, Validators{})
 	if err != nil {
 		t.Fatalf("urisource returned an unexpected error: %+v", err)
 	}
@@ -276,6 +300,47 @@ func TestNewConversionSource_remote(t *testing.T) {
 	expectRemoteConversion(t, s, ts.URL, "text/xml; charset=utf-8")
 }
 
+func TestNewConversionSourceWithClient(t *testing.T) {
+	// The mock server acts as a proxy for any URL
+	proxy := testutil.MockHTTPServer("", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>", false)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	mockURI := "http://only-reachable-via-proxy"
+	s, err := NewConversionSourceWithClient(mockURI, nil, "", client)
+	if err != nil {
+		t.Fatalf("newconversionsourcewithclient returned an unexpected error: %+v", err)
+	}
+	expectRemoteConversion(t, s, mockURI, "text/xml; charset=utf-8")
+}
+
+func TestNewConditionalSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 04 Jun 2018 12:00:00 GMT")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+
+	s, err := NewConditionalSource(ts.URL, "", http.DefaultClient, Validators{})
+	if err != nil {
+		t.Fatalf("newconditionalsource returned an unexpected error: %+v", err)
+	}
+	want := Validators{ETag: `"v1"`, LastModified: "Mon, 04 Jun 2018 12:00:00 GMT"}
+	if got := s.Validators; got != want {
+		t.Errorf("expected validators of conversion source to be %+v, got %+v", want, got)
+	}
+
+	if _, err := NewConditionalSource(ts.URL, "", http.DefaultClient, s.Validators); err != ErrNotModified {
+		t.Errorf("expected error to be %v, got %+v", ErrNotModified, err)
+	}
+}
+
 func TestNewConversionSource_invalidURL(t *testing.T) {
 	s, err := NewConversionSource("http://invalid-url", nil, "")
 	if err == nil {
@@ -304,3 +369,43 @@ func TestGetActualURI_noOriginalURI(t *testing.T) {
 		t.Errorf("expected the original conversion target to be %s, got %s", want, got)
 	}
 }
+
+func TestConversionSource_Transform(t *testing.T) {
+	p := hooks.New()
+	p.Register(hooks.PreRender, hooks.HookFunc(func(pl hooks.Payload) (hooks.Payload, error) {
+		pl.URL = strings.Replace(pl.URL, "http:", "https:", 1)
+		pl.Body = bytes.ToUpper(pl.Body)
+		return pl, nil
+	}))
+	Hooks = p
+	defer func() { Hooks = nil }()
+
+	remote, err := ConversionSource{URI: "http://example.com"}.Transform(hooks.PreRender)
+	if err != nil || remote.URI != "https://example.com" {
+		t.Errorf("expected the URL of a remote source to be rewritten, got %+v (%v)", remote, err)
+	}
+
+	s, err := NewConversionSource("", strings.NewReader("<p>a</p>"), "html")
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	defer s.Remove()
+	local, err := s.Transform(hooks.PreRender)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	defer local.Remove()
+	if local.URI == s.URI || filepath.Ext(local.URI) != ".html" || local.OriginalURI != s.URI {
+		t.Errorf("expected a new local HTML file, got %+v", local)
+	}
+	if b, _ := ioutil.ReadFile(local.URI); string(b) != "<P>A</P>" {
+		t.Errorf("expected the transformed content, got %q", b)
+	}
+	if b, _ := ioutil.ReadFile(s.URI); string(b) != "<p>a</p>" {
+		t.Errorf("expected the original file to be unchanged, got %q", b)
+	}
+
+	if same, _ := local.Transform(hooks.PostFetch); same != local {
+		t.Errorf("expected a stage without hooks to leave the source unchanged, got %+v", same)
+	}
+}
@@ -2,15 +2,27 @@ package converter
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// RetentionTag is the tag of the objects uploaded with a retention period,
+// set to the number of days they are kept, so that they can be expired by
+// lifecycle rules of their bucket.
+const RetentionTag = "weaver-retention-days"
+
 type AWSS3 struct {
 	Region       string
 	AccessKey    string
@@ -18,6 +30,89 @@ type AWSS3 struct {
 	S3Bucket     string
 	S3Key        string
 	S3Acl        string
+	// ContentType of the uploaded object (defaults to application/pdf)
+	ContentType string
+	// Metadata of the uploaded object (stored as 'x-amz-meta-*' headers),
+	// e.g. the ID of the originating request
+	Metadata map[string]string
+	// ContentAddressed names the uploaded object by the SHA-256 hash of its
+	// content, with S3Key as a prefix (e.g. 'reports/'), and skips the upload
+	// if the object already exists
+	ContentAddressed bool
+	// RetentionDays is the number of days the uploaded object is kept (it is
+	// tagged with RetentionTag), or 0 if it is kept indefinitely
+	RetentionDays int
+	// Object is set to the uploaded (or existing) object, if it is not nil
+	Object *S3Object `json:"-"`
+}
+
+// S3Object is an object uploaded to S3.
+type S3Object struct {
+	Key string
+	URL string
+	// Existing is true if the object was already uploaded (see
+	// AWSS3.ContentAddressed)
+	Existing bool
+	Bucket   string
+	Region   string
+	// SHA256 is the hex SHA-256 digest of the content of the object
+	SHA256 string
+	// Expires is the end of the retention period of the object (see
+	// AWSS3.RetentionDays), or zero if it is kept indefinitely
+	Expires time.Time
+	// Source is the rendered source uploaded next to the object (if any)
+	Source *S3Object `json:",omitempty"`
+	// Archive is the WARC archive of the render uploaded next to the object
+	// (if any)
+	Archive *S3Object `json:",omitempty"`
+}
+
+// HasDestination returns true if the output should be uploaded.
+func (a AWSS3) HasDestination() bool {
+	return a.S3Bucket != "" && (a.S3Key != "" || a.ContentAddressed)
+}
+
+// ContentKey returns the key of a content-addressed object.
+func ContentKey(prefix string, b []byte) string {
+	sum := sha256.Sum256(b)
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// SourceKey returns the key of the rendered source (HTML) of an output
+// uploaded with a key, e.g. 'reports/a.source.html' for 'reports/a.pdf'.
+func SourceKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".source.html"
+}
+
+// ArchiveKey returns the key of the WARC archive of the render of an output
+// uploaded with a key, e.g. 'reports/a.warc' for 'reports/a.pdf'.
+func ArchiveKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".warc"
+}
+
+// ObjectURL returns the (virtual-hosted style) URL of an object.
+func ObjectURL(region, bucket, key string) string {
+	host := "s3.amazonaws.com"
+	if region != "" && region != "us-east-1" {
+		host = "s3." + region + ".amazonaws.com"
+	}
+	u := url.URL{Scheme: "https", Host: bucket + "." + host, Path: "/" + key}
+	return u.String()
+}
+
+// objectExists returns true if an object exists in a bucket.
+func objectExists(svc *s3.S3, bucket, key string) (bool, error) {
+	_, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+	if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() == 404 {
+		return false, nil
+	}
+	return false, err
 }
 
 type UploadConversion struct {
@@ -25,20 +120,15 @@ type UploadConversion struct {
 	AWSS3
 }
 
-func uploadToS3(awsConf AWSS3, b []byte) error {
-	log.Printf("[Converter] uploading conversion to S3 bucket '%s' with key '%s'\n", awsConf.S3Bucket, awsConf.S3Key)
-	st := time.Now()
-
+// newS3 returns a S3 client with the region, and credentials of a
+// destination (defaulting to us-east-1, and the default credentials), and
+// its region.
+func newS3(awsConf AWSS3) (*s3.S3, string, error) {
 	region := "us-east-1"
 	if awsConf.Region != "" {
 		region = awsConf.Region
 	}
 
-	acl := "public-read"
-	if awsConf.S3Acl != "" {
-		acl = awsConf.S3Acl
-	}
-
 	conf := aws.NewConfig().WithRegion(region).WithMaxRetries(3)
 
 	if awsConf.AccessKey != "" && awsConf.AccessSecret != "" {
@@ -47,22 +137,63 @@ func uploadToS3(awsConf AWSS3, b []byte) error {
 		// Credential 'Value'
 		_, err := creds.Get()
 		if err != nil {
-			return err
+			return nil, "", err
 		}
 
 		conf = conf.WithCredentials(creds)
 	}
 
 	sess := session.New(conf)
-	svc := s3.New(sess)
+	return s3.New(sess), region, nil
+}
+
+func uploadToS3(awsConf AWSS3, b []byte) error {
+	if awsConf.ContentAddressed {
+		awsConf.S3Key = ContentKey(awsConf.S3Key, b)
+	}
+	log.Printf("[Converter] uploading conversion to S3 bucket '%s' with key '%s'\n", awsConf.S3Bucket, awsConf.S3Key)
+	st := time.Now()
+
+	acl := "public-read"
+	if awsConf.S3Acl != "" {
+		acl = awsConf.S3Acl
+	}
+
+	contentType := "application/pdf"
+	if awsConf.ContentType != "" {
+		contentType = awsConf.ContentType
+	}
+
+	svc, region, err := newS3(awsConf)
+	if err != nil {
+		return err
+	}
+
+	if awsConf.ContentAddressed {
+		exists, err := objectExists(svc, awsConf.S3Bucket, awsConf.S3Key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.Printf("[Converter] skipped upload of existing object with key '%s'\n", awsConf.S3Key)
+			awsConf.setObject(region, true, b)
+			return nil
+		}
+	}
 
 	p := &s3.PutObjectInput{
 		Bucket:      aws.String(awsConf.S3Bucket),
 		Key:         aws.String(awsConf.S3Key),
 		ACL:         aws.String(acl),
-		ContentType: aws.String("application/pdf"),
+		ContentType: aws.String(contentType),
 		Body:        bytes.NewReader(b),
 	}
+	if len(awsConf.Metadata) > 0 {
+		p.Metadata = aws.StringMap(awsConf.Metadata)
+	}
+	if awsConf.RetentionDays > 0 {
+		p.Tagging = aws.String(RetentionTag + "=" + strconv.Itoa(awsConf.RetentionDays))
+	}
 
 	res, err := svc.PutObject(p)
 	if err != nil {
@@ -71,11 +202,80 @@ func uploadToS3(awsConf AWSS3, b []byte) error {
 
 	et := time.Now()
 	log.Printf("[Converter] uploaded to S3: %s (%s)\n", awsutil.StringValue(res), et.Sub(st))
+	awsConf.setObject(region, false, b)
 	return nil
 }
 
+// setObject sets the uploaded object (see AWSS3.Object) with content b.
+func (a AWSS3) setObject(region string, existing bool, b []byte) {
+	if a.Object == nil {
+		return
+	}
+	*a.Object = S3Object{
+		Key:      a.S3Key,
+		URL:      ObjectURL(region, a.S3Bucket, a.S3Key),
+		Existing: existing,
+		Bucket:   a.S3Bucket,
+		Region:   region,
+		SHA256:   Digest(b),
+	}
+	if a.RetentionDays > 0 {
+		a.Object.Expires = time.Now().UTC().AddDate(0, 0, a.RetentionDays)
+	}
+}
+
+// DeleteFromS3 deletes the object of a destination (S3Bucket, and S3Key).
+func DeleteFromS3(awsConf AWSS3) error {
+	svc, _, err := newS3(awsConf)
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(awsConf.S3Bucket),
+		Key:    aws.String(awsConf.S3Key),
+	})
+	return err
+}
+
+// UploadSource uploads the rendered source (HTML) of an output next to it
+// (see SourceKey). The output must have been uploaded with the same settings.
+func UploadSource(awsConf AWSS3, output []byte, html []byte) error {
+	o, err := uploadNextTo(awsConf, output, SourceKey, "text/html; charset=utf-8", html)
+	if err == nil && awsConf.Object != nil {
+		awsConf.Object.Source = o
+	}
+	return err
+}
+
+// UploadArchive uploads the WARC archive of the render of an output next to
+// it (see ArchiveKey). The output must have been uploaded with the same
+// settings.
+func UploadArchive(awsConf AWSS3, output []byte, warc []byte) error {
+	o, err := uploadNextTo(awsConf, output, ArchiveKey, "application/warc", warc)
+	if err == nil && awsConf.Object != nil {
+		awsConf.Object.Archive = o
+	}
+	return err
+}
+
+// uploadNextTo uploads content next to an uploaded output, with the key
+// derived from the key of the output, and returns the uploaded object.
+func uploadNextTo(awsConf AWSS3, output []byte, key func(string) string, contentType string, b []byte) (*S3Object, error) {
+	if awsConf.ContentAddressed {
+		awsConf.S3Key = ContentKey(awsConf.S3Key, output)
+		awsConf.ContentAddressed = false
+	}
+	awsConf.S3Key = key(awsConf.S3Key)
+	awsConf.ContentType = contentType
+	awsConf.Object = new(S3Object)
+	if err := uploadToS3(awsConf, b); err != nil {
+		return nil, err
+	}
+	return awsConf.Object, nil
+}
+
 func (c UploadConversion) Upload(b []byte) (bool, error) {
-	if c.AWSS3.S3Bucket == "" || c.AWSS3.S3Key == "" {
+	if !c.AWSS3.HasDestination() {
 		return false, nil
 	}
 
@@ -25,3 +25,81 @@ func TestUploadConversion_Upload_noS3Key(t *testing.T) {
 	mockConversion.AWSS3.S3Bucket = "s3-bucket-123456"
 	expectUploadToHalt(t, mockConversion)
 }
+
+func TestUploadConversion_Upload_contentAddressedNoS3Bucket(t *testing.T) {
+	mockConversion := UploadConversion{}
+	mockConversion.AWSS3.ContentAddressed = true
+	expectUploadToHalt(t, mockConversion)
+}
+
+func TestAWSS3_HasDestination(t *testing.T) {
+	tests := []struct {
+		awsConf AWSS3
+		want    bool
+	}{
+		{AWSS3{S3Bucket: "bucket", S3Key: "key.pdf"}, true},
+		{AWSS3{S3Bucket: "bucket"}, false},
+		{AWSS3{S3Bucket: "bucket", ContentAddressed: true}, true},
+		{AWSS3{S3Key: "reports/", ContentAddressed: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.awsConf.HasDestination(); got != tt.want {
+			t.Errorf("expected destination of %+v to be %v, got %v", tt.awsConf, tt.want, got)
+		}
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	got := ContentKey("reports/", []byte("test"))
+	if want := "reports/9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"; got != want {
+		t.Errorf("expected content key to be %s, got %s", want, got)
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"", "https://bucket.s3.amazonaws.com/reports/a%20b.pdf"},
+		{"us-east-1", "https://bucket.s3.amazonaws.com/reports/a%20b.pdf"},
+		{"eu-west-1", "https://bucket.s3.eu-west-1.amazonaws.com/reports/a%20b.pdf"},
+	}
+	for _, tt := range tests {
+		if got := ObjectURL(tt.region, "bucket", "reports/a b.pdf"); got != tt.want {
+			t.Errorf("expected URL of object in %q to be %s, got %s", tt.region, tt.want, got)
+		}
+	}
+}
+
+func TestSourceKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"reports/a.pdf", "reports/a.source.html"},
+		{"reports/a", "reports/a.source.html"},
+		{"a.b/c.png", "a.b/c.source.html"},
+	}
+	for _, tt := range tests {
+		if got := SourceKey(tt.key); got != tt.want {
+			t.Errorf("expected source key of %s to be %s, got %s", tt.key, tt.want, got)
+		}
+	}
+}
+
+func TestArchiveKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"reports/a.pdf", "reports/a.warc"},
+		{"reports/a", "reports/a.warc"},
+		{"a.b/c.png", "a.b/c.warc"},
+	}
+	for _, tt := range tests {
+		if got := ArchiveKey(tt.key); got != tt.want {
+			t.Errorf("expected archive key of %s to be %s, got %s", tt.key, tt.want, got)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package converter
 import (
 	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,37 +17,128 @@ type Worker struct {
 }
 
 func InitWorkers(maxWorkers, maxQueue, t int) chan<- Work {
-	wq := make(chan Work, maxQueue)
-
-	for i := 0; i < maxWorkers; i++ {
-		w := Worker{i}
-		go func(wq <-chan Work, w Worker, t int) {
-			for work := range wq {
-				log.Printf("[Worker #%d] processing conversion job (pending conversions: %d)\n", w.id, len(wq))
-				work.Process(t)
-			}
-		}(wq, w, t)
+	return NewPool(maxWorkers, maxQueue, t).Queue()
+}
+
+// Pool is a resizable pool of workers processing a work queue.
+type Pool struct {
+	wq     chan Work
+	t      int
+	mu     sync.Mutex
+	stops  []chan struct{}
+	nextID int
+	busy   int64
+}
+
+// NewPool starts a pool of workers processing a work queue that can hold up
+// to maxQueue jobs. Conversions time out after t seconds.
+func NewPool(maxWorkers, maxQueue, t int) *Pool {
+	p := &Pool{wq: make(chan Work, maxQueue), t: t}
+	p.Resize(maxWorkers)
+	return p
+}
+
+// Queue returns the work queue (write only) of the pool.
+func (p *Pool) Queue() chan<- Work {
+	return p.wq
+}
+
+// Size returns the number of workers in the pool.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// Busy returns the number of workers processing a conversion.
+func (p *Pool) Busy() int {
+	return int(atomic.LoadInt64(&p.busy))
+}
+
+// Pending returns the number of conversions waiting in the work queue.
+func (p *Pool) Pending() int {
+	return len(p.wq)
+}
+
+// Resize starts, or stops workers until there are n workers in the pool.
+// Stopped workers finish their current conversion first.
+func (p *Pool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		go p.work(Worker{p.nextID}, stop)
+		p.nextID++
+	}
+	for len(p.stops) > n && n >= 0 {
+		close(p.stops[len(p.stops)-1])
+		p.stops = p.stops[:len(p.stops)-1]
 	}
+}
 
-	return wq
+func (p *Pool) work(w Worker, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case work, ok := <-p.wq:
+			if !ok {
+				return
+			}
+			log.Printf("[Worker #%d] processing conversion job (pending conversions: %d)\n", w.id, len(p.wq))
+			atomic.AddInt64(&p.busy, 1)
+			work.Process(p.t)
+			atomic.AddInt64(&p.busy, -1)
+		}
+	}
 }
 
 type Work struct {
+	times     *workTimes
+	result    *workResult
 	converter Converter
+	progress  ProgressFunc
 	source    ConversionSource
 	out       chan []byte
 	err       chan error
 	uploaded  chan struct{}
+	started   chan struct{}
+	converted chan struct{}
 	done      chan struct{}
 }
 
+// workResult holds the output of a conversion. It is shared by all copies of
+// a Work.
+type workResult struct {
+	out []byte
+}
+
+// workTimes records when a conversion was queued, and started. It is shared
+// by all copies of a Work.
+type workTimes struct {
+	queued  time.Time
+	started time.Time
+}
+
 func NewWork(wq chan<- Work, c Converter, s ConversionSource) Work {
+	return NewWorkWithProgress(wq, c, s, nil)
+}
+
+// NewWorkWithProgress is the same as NewWork, but the progress of the
+// conversion is reported to a function (see ProgressFunc).
+func NewWorkWithProgress(wq chan<- Work, c Converter, s ConversionSource, progress ProgressFunc) Work {
 	w := Work{}
+	w.times = &workTimes{queued: time.Now()}
+	w.result = new(workResult)
 	w.converter = c
+	w.progress = progress
 	w.source = s
 	w.out = make(chan []byte, 1)
 	w.err = make(chan error, 1)
 	w.uploaded = make(chan struct{}, 1)
+	w.started = make(chan struct{})
+	w.converted = make(chan struct{})
 	w.done = make(chan struct{}, 1)
 	go func(wq chan<- Work, w Work) {
 		wq <- w
@@ -54,18 +147,37 @@ func NewWork(wq chan<- Work, c Converter, s ConversionSource) Work {
 }
 
 func (w Work) Process(t int) {
+	w.times.started = time.Now()
+	close(w.started)
+
 	done := make(chan struct{}, 1)
 	defer close(done)
 
 	wout := make(chan []byte, 1)
 	werr := make(chan error, 1)
 
+	// Progress is no longer reported once the conversion has finished (or
+	// timed out)
+	var progress ProgressFunc
+	if w.progress != nil {
+		progress = func(p Progress) {
+			select {
+			case <-done:
+			default:
+				w.progress(p)
+			}
+		}
+	}
+	progress.Report(ProgressRendering, 0)
+
 	go func(w Work, done <-chan struct{}, wout chan<- []byte, werr chan<- error) {
-		out, err := w.converter.Convert(w.source, done)
+		out, err := w.converter.Convert(w.source, done, progress)
 		if err != nil {
 			werr <- err
 			return
 		}
+		w.result.out = out
+		close(w.converted)
 
 		uploaded, err := w.converter.Upload(out)
 		if err != nil {
@@ -111,6 +223,37 @@ func (w Work) Uploaded() <-chan struct{} {
 	return w.uploaded
 }
 
+// Started returns a channel that will be closed when a worker has started
+// processing a conversion.
+func (w Work) Started() <-chan struct{} {
+	return w.started
+}
+
+// Converted returns a channel that will be closed when a conversion has
+// produced its output (before it is uploaded).
+func (w Work) Converted() <-chan struct{} {
+	return w.converted
+}
+
+// Output returns the output of a conversion (also if it has been uploaded).
+// It must only be called after the Converted channel is closed.
+func (w Work) Output() []byte {
+	return w.result.out
+}
+
+// QueueWait returns the time a conversion spent in the work queue before a
+// worker started processing it. It must only be called after the Started
+// channel has been closed.
+func (w Work) QueueWait() time.Duration {
+	return w.times.started.Sub(w.times.queued)
+}
+
+// StartedAt returns the time a worker started processing a conversion. It
+// must only be called after the Started channel has been closed.
+func (w Work) StartedAt() time.Time {
+	return w.times.started
+}
+
 // Cancel will close the done channel. This will indicate to child Goroutines
 // that the job has been terminated, and the results are no longer needed.
 func (w Work) Cancel() {
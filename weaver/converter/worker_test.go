@@ -19,11 +19,32 @@ func TestInitWorkers(t *testing.T) {
 	}
 }
 
+func TestPoolResize(t *testing.T) {
+	p := NewPool(4, 10, 10)
+	defer close(p.wq)
+	p.Resize(6)
+	if got, want := p.Size(), 6; got != want {
+		t.Errorf("expected pool size to be %d, got %d", want, got)
+	}
+	p.Resize(2)
+	if got, want := p.Size(), 2; got != want {
+		t.Errorf("expected pool size to be %d, got %d", want, got)
+	}
+
+	// The remaining workers still process work
+	w := NewWork(p.Queue(), TestConversion{}, ConversionSource{})
+	select {
+	case <-w.Success():
+	case <-time.After(time.Second):
+		t.Errorf("expected work to be processed after resizing")
+	}
+}
+
 type TestConversion struct {
 	Conversion
 }
 
-func (c TestConversion) Convert(s ConversionSource, done <-chan struct{}) ([]byte, error) {
+func (c TestConversion) Convert(s ConversionSource, done <-chan struct{}, progress ProgressFunc) ([]byte, error) {
 	return []byte("test work"), nil
 }
 
@@ -41,11 +62,44 @@ func TestNewWork(t *testing.T) {
 	if w.uploaded == nil {
 		t.Fatalf("expected work uploaded channel to be initialised, not nil")
 	}
+	if w.started == nil {
+		t.Fatalf("expected work started channel to be initialised, not nil")
+	}
 	if w.done == nil {
 		t.Fatalf("expected work done channel to be initialised, not nil")
 	}
 }
 
+func TestNewWork_started(t *testing.T) {
+	wq := InitWorkers(10, 10, 10)
+	defer close(wq)
+	w := NewWork(wq, TestConversion{}, ConversionSource{})
+	select {
+	case <-w.Started():
+		if w.QueueWait() < 0 {
+			t.Errorf("expected queue wait to be positive, got %s", w.QueueWait())
+		}
+		if w.StartedAt().IsZero() {
+			t.Errorf("expected started time to be set")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected work started channel to be closed before timeout")
+	}
+}
+
+func TestNewWorkWithProgress(t *testing.T) {
+	wq := InitWorkers(10, 10, 10)
+	defer close(wq)
+	stages := make(chan string, 1)
+	w := NewWorkWithProgress(wq, TestConversion{}, ConversionSource{}, func(p Progress) {
+		stages <- p.Stage
+	})
+	<-w.Success()
+	if got, want := <-stages, ProgressRendering; got != want {
+		t.Errorf("expected reported stage to be %s, got %s", want, got)
+	}
+}
+
 type TestConversionUpload struct {
 	Conversion
 }
@@ -65,6 +119,25 @@ func TestNewWork_upload(t *testing.T) {
 	case <-time.After(time.Second):
 		t.Errorf("expected work uploaded channel to be closed before timeout")
 	}
+	select {
+	case <-w.Converted():
+	default:
+		t.Errorf("expected work converted channel to be closed before upload")
+	}
+}
+
+func TestWork_Output(t *testing.T) {
+	wq := InitWorkers(1, 1, 10)
+	defer close(wq)
+	w := NewWork(wq, TestConversion{}, ConversionSource{})
+	select {
+	case <-w.Success():
+	case <-time.After(time.Second):
+		t.Fatalf("expected work to succeed before timeout")
+	}
+	if got, want := string(w.Output()), "test work"; got != want {
+		t.Errorf("expected work output to be %s, got %s", want, got)
+	}
 }
 
 type TestConversionError struct {
@@ -75,7 +148,7 @@ var (
 	ErrTestConversionError = errors.New("test conversion error")
 )
 
-func (c TestConversionError) Convert(s ConversionSource, done <-chan struct{}) ([]byte, error) {
+func (c TestConversionError) Convert(s ConversionSource, done <-chan struct{}, progress ProgressFunc) ([]byte, error) {
 	return []byte{}, ErrTestConversionError
 }
 
@@ -90,13 +163,18 @@ func TestNewWork_error(t *testing.T) {
 	case <-time.After(time.Second):
 		t.Errorf("expected to receive error before timeout")
 	}
+	select {
+	case <-w.Converted():
+		t.Errorf("expected work converted channel to remain open after an error")
+	default:
+	}
 }
 
 type TestConversionTimeout struct {
 	Conversion
 }
 
-func (c TestConversionTimeout) Convert(s ConversionSource, done <-chan struct{}) ([]byte, error) {
+func (c TestConversionTimeout) Convert(s ConversionSource, done <-chan struct{}, progress ProgressFunc) ([]byte, error) {
 	time.Sleep(time.Second * 2)
 	return []byte("test work timeout"), nil
 }
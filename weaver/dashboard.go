@@ -0,0 +1,119 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/history"
+)
+
+// dashboardHTML is the admin dashboard page. It reads the auth key from its
+// own URL, and polls GET /admin/dashboard/data.
+//
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+// dashboardErrors is the number of recent failed jobs on the dashboard.
+const dashboardErrors = 20
+
+// ThroughputPoint is the number of conversions finished in a minute.
+type ThroughputPoint struct {
+	Time      time.Time `json:"time"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+}
+
+// Throughput counts the conversions of the instance by minute over the last
+// hour. Conversions closed by the client are not counted.
+type Throughput struct {
+	mu      sync.Mutex
+	minutes [60]ThroughputPoint
+}
+
+// Record counts a conversion with the outcome (see the Outcome constants)
+// that finished at t.
+func (tp *Throughput) Record(outcome string, t time.Time) {
+	if outcome == OutcomeClientClosed {
+		return
+	}
+	m := t.UTC().Truncate(time.Minute)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	p := &tp.minutes[m.Unix()/60%60]
+	if p.Time.After(m) {
+		// The minute has already been reused
+		return
+	}
+	if !p.Time.Equal(m) {
+		*p = ThroughputPoint{Time: m}
+	}
+	if outcome == OutcomeSuccess || outcome == OutcomeUploaded {
+		p.Completed++
+	} else {
+		p.Failed++
+	}
+}
+
+// LastHour returns the conversions of every minute of the hour before now,
+// oldest first.
+func (tp *Throughput) LastHour(now time.Time) []ThroughputPoint {
+	now = now.UTC().Truncate(time.Minute)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	l := make([]ThroughputPoint, 60)
+	for i := range l {
+		m := now.Add(-time.Minute * time.Duration(59-i))
+		l[i] = ThroughputPoint{Time: m}
+		if p := tp.minutes[m.Unix()/60%60]; p.Time.Equal(m) {
+			l[i] = p
+		}
+	}
+	return l
+}
+
+// dashboardHandler serves the admin dashboard (admin only).
+func dashboardHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", dashboardHTML)
+}
+
+// dashboardDataHandler returns the live state of the instance shown on the
+// admin dashboard: its work queue, throughput, and recent failed jobs (if
+// the job history is enabled).
+func dashboardDataHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	data := gin.H{
+		"version":    version,
+		"goroutines": runtime.NumGoroutine(),
+		"pending":    len(c.MustGet("queue").(chan<- converter.Work)),
+		"max_queue":  conf.MaxConversionQueue,
+		"workers":    conf.MaxWorkers,
+		"queue":      conf.Queue.Driver,
+	}
+	if p, ok := c.Get("pool"); ok {
+		data["workers"] = p.(*converter.Pool).Size()
+		data["busy"] = p.(*converter.Pool).Busy()
+	}
+	if tp, ok := c.Get("throughput"); ok {
+		data["throughput"] = tp.(*Throughput).LastHour(time.Now())
+	}
+	if b := hostBreaker(c); b != nil {
+		data["open_circuits"] = b.Open()
+	}
+	if h, ok := c.Get("history"); ok {
+		jobs, err := h.(history.Store).Find(history.Query{Status: history.StatusFailed, Limit: dashboardErrors})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if jobs == nil {
+			jobs = []history.Job{}
+		}
+		data["errors"] = jobs
+	}
+	c.JSON(http.StatusOK, data)
+}
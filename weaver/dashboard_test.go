@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/history"
+)
+
+func TestThroughput(t *testing.T) {
+	tp := new(Throughput)
+	now := time.Date(2018, 6, 1, 10, 30, 15, 0, time.UTC)
+	tp.Record(OutcomeSuccess, now)
+	tp.Record(OutcomeUploaded, now)
+	tp.Record(OutcomeTimeout, now)
+	tp.Record(OutcomeClientClosed, now)
+	tp.Record(OutcomeSuccess, now.Add(-time.Minute))
+	// The same minute an hour ago does not reset the current minute
+	tp.Record(OutcomeError, now.Add(-time.Hour))
+
+	l := tp.LastHour(now)
+	if got, want := len(l), 60; got != want {
+		t.Fatalf("expected %d minutes, got %d", want, got)
+	}
+	last := l[59]
+	if got, want := last.Time, now.Truncate(time.Minute); !got.Equal(want) {
+		t.Errorf("expected the last minute to be %s, got %s", want, got)
+	}
+	if last.Completed != 2 || last.Failed != 1 {
+		t.Errorf("expected 2 completed, and 1 failed conversion in the last minute, got %+v", last)
+	}
+	if got, want := l[58].Completed, 1; got != want {
+		t.Errorf("expected %d completed conversion in the previous minute, got %d", want, got)
+	}
+}
+
+func TestDashboardDataHandler(t *testing.T) {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	pool := converter.NewPool(2, 10, 10)
+	jobs := history.NewMemoryStore(10)
+	jobs.Add(history.Job{ID: "failed-job", Time: time.Now(), Status: history.StatusFailed})
+	svc := Services{Queue: pool.Queue(), Pool: pool, Throughput: new(Throughput), History: jobs}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/dashboard/data?auth=123456", nil)
+	r.ServeHTTP(res, req)
+	var data struct {
+		Workers    int               `json:"workers"`
+		Throughput []ThroughputPoint `json:"throughput"`
+		Errors     []history.Job     `json:"errors"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &data); err != nil {
+		t.Fatalf("unable to decode dashboard data: %+v (%s)", err, res.Body)
+	}
+	if got, want := data.Workers, 2; got != want {
+		t.Errorf("expected %d workers, got %d", want, got)
+	}
+	if got, want := len(data.Throughput), 60; got != want {
+		t.Errorf("expected %d minutes of throughput, got %d", want, got)
+	}
+	if len(data.Errors) != 1 || data.Errors[0].ID != "failed-job" {
+		t.Errorf("expected the failed job, got %+v", data.Errors)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/admin/dashboard?auth=123456", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf("expected dashboard content type to be %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/mailer"
+	"github.com/lachee/athenapdf/weaver/notify"
+)
+
+var (
+	// ErrEmailToInvalid should be returned when the recipients of an output
+	// ('email_to') are not email addresses.
+	ErrEmailToInvalid = errors.New("invalid email recipients provided (use up to 10 comma-separated addresses)")
+	// ErrEmailDeliveryUnavailable should be returned when an output is to be
+	// emailed, but email delivery is not configured.
+	ErrEmailDeliveryUnavailable = errors.New("email delivery is not enabled")
+)
+
+// maxEmailRecipients is the maximum number of recipients of an output.
+const maxEmailRecipients = 10
+
+// The default templates of the messages delivering outputs (see
+// EmailDelivery).
+const (
+	defaultEmailSubject = "{{.Filename}} is ready"
+	defaultEmailBody    = `Your document {{.Filename}} is ready ({{.Pages}} page(s)).
+{{if .Attached}}
+It is attached to this message.
+{{else if .URL}}
+It is too large to be attached, download it from:
+{{.URL}}
+{{else}}
+It is too large to be attached to this message.
+{{end}}
+Source: {{.Source}}
+`
+)
+
+// deliveryData is the data of the templates of a message delivering an
+// output.
+type deliveryData struct {
+	// ID is the ID of the conversion job.
+	ID string
+	// Source is the URL (or the name of the file) that was converted.
+	Source string
+	// Filename is the name of the output.
+	Filename string
+	Pages    int
+	Bytes    int
+	// Attached is true if the output is attached to the message.
+	Attached bool
+	// URL is the URL of the output, if it was uploaded to S3.
+	URL string
+}
+
+// emailRecipients returns the recipients an output is emailed to
+// ('email_to').
+func emailRecipients(c *gin.Context) ([]string, error) {
+	v := c.Query("email_to")
+	if v == "" {
+		return nil, nil
+	}
+	conf := c.MustGet("config").(Config)
+	if conf.EmailDelivery.SMTPAddr == "" {
+		return nil, ErrEmailDeliveryUnavailable
+	}
+	return parseRecipients(v)
+}
+
+// parseRecipients parses up to maxEmailRecipients comma-separated addresses.
+func parseRecipients(v string) ([]string, error) {
+	list, err := mail.ParseAddressList(v)
+	if err != nil || len(list) > maxEmailRecipients {
+		return nil, ErrEmailToInvalid
+	}
+	to := make([]string, len(list))
+	for i, a := range list {
+		to[i] = a.Address
+	}
+	return to, nil
+}
+
+// emailNotifier emails outputs to the recipients of the 'email' target (see
+// NewNotifiers): up to 10 comma-separated addresses.
+type emailNotifier struct {
+	conf Config
+}
+
+func (e emailNotifier) Validate(to string) error {
+	if _, err := parseRecipients(to); err != nil {
+		return notify.ErrTargetInvalid
+	}
+	return nil
+}
+
+func (e emailNotifier) Notify(to string, n notify.Notification) error {
+	rcpts, err := parseRecipients(to)
+	if err != nil {
+		return err
+	}
+	m, err := deliveryMessage(e.conf, rcpts, n)
+	if err != nil {
+		return err
+	}
+	d := e.conf.EmailDelivery
+	return mailer.Client{Addr: d.SMTPAddr, Username: d.Username, Password: d.Password}.Send(m)
+}
+
+// deliveryMessage returns the message delivering an output. The output is
+// attached if it is at most EmailDelivery.MaxAttachmentBytes, or else linked
+// to if it was uploaded.
+func deliveryMessage(conf Config, to []string, n notify.Notification) (mailer.Message, error) {
+	e := conf.EmailDelivery
+	data := deliveryData{
+		ID:       n.JobID,
+		Source:   n.Source,
+		Filename: n.Filename,
+		Pages:    n.Pages,
+		Bytes:    len(n.Output),
+		Attached: len(n.Output) <= e.MaxAttachmentBytes,
+		URL:      n.URL,
+	}
+
+	m := mailer.Message{From: e.From, To: to}
+	var err error
+	if m.Subject, err = renderTemplate(e.Subject, data); err != nil {
+		return m, err
+	}
+	// Headers must be a single line
+	m.Subject = strings.Join(strings.Fields(m.Subject), " ")
+	if m.Body, err = renderTemplate(e.Body, data); err != nil {
+		return m, err
+	}
+	if data.Attached {
+		m.Attachments = []mailer.Attachment{{Name: data.Filename, ContentType: n.ContentType, Data: n.Output}}
+	}
+	return m, nil
+}
+
+// renderTemplate executes a template of a message.
+func renderTemplate(text string, data deliveryData) (string, error) {
+	t, err := template.New("email").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	b := new(bytes.Buffer)
+	if err := t.Execute(b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
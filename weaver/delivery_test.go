@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestEmailRecipients(t *testing.T) {
+	tests := []struct {
+		addr  string
+		query string
+		want  []string
+		err   error
+	}{
+		{"", "", nil, nil},
+		{"", "?email_to=a@example.com", nil, ErrEmailDeliveryUnavailable},
+		{"smtp.example.com:587", "", nil, nil},
+		{"smtp.example.com:587", "?email_to=a@example.com,B+<b@example.com>", []string{"a@example.com", "b@example.com"}, nil},
+		{"smtp.example.com:587", "?email_to=example.com", nil, ErrEmailToInvalid},
+		{"smtp.example.com:587", "?email_to=" + strings.Repeat("a@example.com,", 10) + "a@example.com", nil, ErrEmailToInvalid},
+	}
+	for _, tt := range tests {
+		var got []string
+		var err error
+		conf := defaultConfig()
+		conf.EmailDelivery.SMTPAddr = tt.addr
+		r := gin.New()
+		r.Use(ConfigMiddleware(conf))
+		r.GET("/", func(c *gin.Context) {
+			got, err = emailRecipients(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, tt.want) || err != tt.err {
+			t.Errorf("expected recipients of %q to be %v (%v), got %v (%v)", tt.query, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestDeliveryMessage(t *testing.T) {
+	conf := defaultConfig()
+	conf.EmailDelivery.From = "Weaver <weaver@example.com>"
+	conf.EmailDelivery.MaxAttachmentBytes = 8
+	n := outputNotification(conf, "job", "https://example.com", "", []byte("%PDF-1.4"), &converter.Report{Pages: 2}, nil)
+
+	m, err := deliveryMessage(conf, []string{"a@example.com"}, n)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := m.Subject, "document.pdf is ready"; got != want {
+		t.Errorf("expected subject %q, got %q", want, got)
+	}
+	if !strings.Contains(m.Body, "It is attached") || !strings.Contains(m.Body, "(2 page(s))") {
+		t.Errorf("expected the body to mention the attachment, got %q", m.Body)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "document.pdf" || m.Attachments[0].ContentType != "application/pdf" {
+		t.Errorf("expected the output to be attached, got %+v", m.Attachments)
+	}
+}
+
+func TestDeliveryMessage_link(t *testing.T) {
+	conf := defaultConfig()
+	conf.EmailDelivery.MaxAttachmentBytes = 4
+	o := &converter.S3Object{Key: "reports/q1.pdf", URL: "https://reports.s3.amazonaws.com/reports/q1.pdf"}
+	n := outputNotification(conf, "job", "", "", []byte("%PDF-1.4"), nil, o)
+
+	m, err := deliveryMessage(conf, nil, n)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if len(m.Attachments) != 0 {
+		t.Errorf("expected no attachments, got %d", len(m.Attachments))
+	}
+	if !strings.Contains(m.Body, o.URL) {
+		t.Errorf("expected the body to link to the output, got %q", m.Body)
+	}
+	if got, want := m.Subject, "q1.pdf is ready"; got != want {
+		t.Errorf("expected subject %q, got %q", want, got)
+	}
+
+	n = outputNotification(conf, "job", "", "", []byte("%PDF-1.4"), nil, nil)
+	if m, _ := deliveryMessage(conf, nil, n); !strings.Contains(m.Body, "too large to be attached to this message") {
+		t.Errorf("expected the body to mention the output is too large, got %q", m.Body)
+	}
+}
+
+func TestDeliveryMessage_templates(t *testing.T) {
+	conf := defaultConfig()
+	conf.EmailDelivery.Subject = "Report {{.ID}}\nready"
+	conf.EmailDelivery.Body = "{{.Bytes}} bytes from {{.Source}}"
+	n := outputNotification(conf, "42", "https://example.com", "png", []byte("%PDF"), nil, nil)
+	m, err := deliveryMessage(conf, nil, n)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := m.Subject, "Report 42 ready"; got != want {
+		t.Errorf("expected subject %q, got %q", want, got)
+	}
+	if got, want := m.Body, "4 bytes from https://example.com"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+	if got, want := m.Attachments[0].Name, "document.png"; got != want {
+		t.Errorf("expected attachment %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/imagediff"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrDiffNoSources should be returned when a comparison is requested
+	// without two URLs, or a URL and a baseline screenshot.
+	ErrDiffNoSources = errors.New("two URLs (a, and b), or a URL and a baseline PNG are required")
+	// ErrDiffTolerance should be returned when the tolerance of a comparison
+	// is invalid.
+	ErrDiffTolerance = errors.New("invalid tolerance provided (use 0-255)")
+)
+
+// screenshot renders a URL as a PNG in the work queue.
+func screenshot(c *gin.Context, url string) (image.Image, error) {
+	source, err := newURLSource(c, url)
+	if err != nil {
+		return nil, err
+	}
+	b, err := render(c, *source, athenapdf.FormatPNG)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(b))
+}
+
+// diffHandler renders two URLs (or a URL, and compares it to an uploaded
+// baseline screenshot), and returns an image highlighting the different
+// pixels. The difference score is returned in the X-Diff-Score header.
+func diffHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	if _, err := chromeFlags(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var tolerance uint8
+	if t := c.Query("tolerance"); t != "" {
+		n, err := strconv.ParseUint(t, 10, 8)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, ErrDiffTolerance).SetType(gin.ErrorTypePublic)
+			return
+		}
+		tolerance = uint8(n)
+	}
+
+	urls := []string{c.Query("a"), c.Query("b")}
+	var baseline image.Image
+	if file, _, err := c.Request.FormFile("baseline"); err == nil {
+		defer file.Close()
+		if baseline, err = png.Decode(file); err != nil {
+			c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+			s.Increment("invalid_file")
+			return
+		}
+		urls = []string{c.Query("url")}
+	}
+	for _, u := range urls {
+		if u == "" {
+			c.AbortWithError(http.StatusBadRequest, ErrDiffNoSources).SetType(gin.ErrorTypePublic)
+			return
+		}
+	}
+
+	// Render concurrently
+	images := make([]image.Image, len(urls))
+	errs := make(chan error, len(urls))
+	for i, u := range urls {
+		go func(i int, u string) {
+			var err error
+			images[i], err = screenshot(c, u)
+			errs <- err
+		}(i, u)
+	}
+	for range urls {
+		if err := <-errs; err != nil {
+			s.Increment("diff_error")
+			abortWithSourceError(c, err)
+			return
+		}
+	}
+	if baseline != nil {
+		images = append([]image.Image{baseline}, images...)
+	}
+
+	out, res := imagediff.Diff(images[0], images[1], tolerance)
+	var b bytes.Buffer
+	if err := png.Encode(&b, out); err != nil {
+		c.Error(err)
+		return
+	}
+
+	s.Increment("diff")
+	c.Header("X-Diff-Score", fmt.Sprintf("%.6f", res.Score))
+	c.Header("X-Diff-Pixels", strconv.Itoa(res.Pixels))
+	c.Header("X-Diff-Total", strconv.Itoa(res.Total))
+	c.Data(http.StatusOK, "image/png", b.Bytes())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func mockDiffRouter() *gin.Engine {
+	return mockRouter(Config{}, Services{}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/diff", diffHandler)
+	})
+}
+
+func TestDiffHandler_noSources(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/diff?a=http://example.com", nil)
+	mockDiffRouter().ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestDiffHandler_tolerance(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/diff?a=http://example.com&b=http://example.org&tolerance=256", nil)
+	mockDiffRouter().ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
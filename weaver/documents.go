@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+var (
+	// ErrDocumentNoSource should be returned when a PDF operation is
+	// requested without a document.
+	ErrDocumentNoSource = errors.New("a PDF file (file), or its URL (url) is required")
+	// ErrDocumentFetch should be returned when the URL of a PDF document
+	// responds with an error status.
+	ErrDocumentFetch = errors.New("unable to fetch the PDF document")
+)
+
+// maxDocumentMemory is the size of the uploaded documents of a request that
+// are held in memory while the form is parsed (the rest is saved to disk).
+const maxDocumentMemory = 32 << 20
+
+// fetchDocument fetches a PDF document from its URL (e.g. a pre-signed S3 URL)
+// with the egress settings, and the fetch timeout of the request, and returns
+// its body, and name.
+func fetchDocument(c *gin.Context, uri string) (io.ReadCloser, string, error) {
+	conf := c.MustGet("config").(Config)
+	e, err := requestEgress(c)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := e.client()
+	if err != nil {
+		return nil, "", err
+	}
+	client.Timeout = time.Second * time.Duration(conf.Fetch.Timeout)
+	res, err := client.Get(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	if res.StatusCode >= 400 {
+		res.Body.Close()
+		return nil, "", ErrDocumentFetch
+	}
+	return res.Body, path.Base(res.Request.URL.Path), nil
+}
+
+// readLimited reads a document, unless the used bytes would exceed the limit
+// (if positive), and adds its size to the used bytes.
+func readLimited(r io.Reader, limit int, used *int) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(limit-*used)+1))
+	if err != nil {
+		return nil, err
+	}
+	if *used+len(b) > limit {
+		return nil, ErrSourceTooLarge
+	}
+	*used += len(b)
+	return b, nil
+}
+
+// readDocument returns the PDF document of a request, uploaded as 'file', or
+// fetched from its URL ('url'), and its name. Documents larger than the spool
+// quota are rejected.
+func readDocument(c *gin.Context) ([]byte, string, error) {
+	conf := c.MustGet("config").(Config)
+	used := 0
+
+	if file, header, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+		return b, header.Filename, err
+	}
+	if uri := c.Query("url"); uri != "" {
+		body, name, err := fetchDocument(c, uri)
+		if err != nil {
+			return nil, "", err
+		}
+		defer body.Close()
+		b, err := readLimited(body, conf.Spool.MaxBytes, &used)
+		return b, name, err
+	}
+	return nil, "", ErrDocumentNoSource
+}
+
+// readDocuments returns the PDF documents of a request, uploaded as 'file',
+// followed by those fetched from their URLs ('url'), in order. Documents
+// larger than the spool quota (together) are rejected.
+func readDocuments(c *gin.Context) ([][]byte, error) {
+	conf := c.MustGet("config").(Config)
+	used := 0
+
+	var docs [][]byte
+	if err := c.Request.ParseMultipartForm(maxDocumentMemory); err == nil {
+		for _, header := range c.Request.MultipartForm.File["file"] {
+			file, err := header.Open()
+			if err != nil {
+				return nil, ErrFileInvalid
+			}
+			b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, b)
+		}
+	}
+	for _, uri := range c.QueryArray("url") {
+		body, _, err := fetchDocument(c, uri)
+		if err != nil {
+			return nil, err
+		}
+		b, err := readLimited(body, conf.Spool.MaxBytes, &used)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, b)
+	}
+	if len(docs) == 0 {
+		return nil, ErrDocumentNoSource
+	}
+	return docs, nil
+}
+
+// abortDocument aborts a PDF operation with the error of readDocument, or of
+// the pdf package.
+func abortDocument(c *gin.Context, err error) {
+	switch err {
+	case ErrDocumentNoSource, ErrFileInvalid, pdf.ErrRangeInvalid, ErrProxyNotAllowed, ErrHostMapNotAllowed,
+		ErrStampsInvalid, ErrStampNoImage, pdf.ErrImageInvalid, pdf.ErrPositionInvalid, pdf.ErrQRTooLong, pdf.ErrBarcodeInvalid:
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+	case ErrSourceTooLarge:
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+	case pdf.ErrNotPDF, pdf.ErrNoPages, pdf.ErrEncrypted:
+		// The document is invalid, rather than a rendered output
+		c.AbortWithError(http.StatusUnprocessableEntity, err).SetType(gin.ErrorTypePublic).SetMeta(CodeInvalidOptions)
+	default:
+		c.AbortWithError(http.StatusBadGateway, err).SetType(gin.ErrorTypePublic).SetMeta(CodeSourceFetchFailed)
+	}
+}
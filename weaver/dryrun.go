@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+)
+
+// uploadPath stands for the path of an uploaded source in the command of a
+// dry run, as uploads are not saved.
+const uploadPath = "<upload>"
+
+// RenderPlan describes how a conversion would be made, as returned by a dry
+// run ('dryRun'), so that clients can check the effect of their options.
+type RenderPlan struct {
+	DryRun bool `json:"dry_run"`
+	// Engine is the converter, and FallbackEngine is the converter used if it
+	// fails (if any).
+	Engine         string `json:"engine"`
+	FallbackEngine string `json:"fallback_engine,omitempty"`
+	Format         string `json:"format"`
+	ContentType    string `json:"content_type"`
+	// Command is the athenapdf CLI command (and its arguments), with the
+	// credentials of the proxy redacted, and Env are the environment
+	// variables it is executed with.
+	Command     []string        `json:"command"`
+	Env         []string        `json:"env,omitempty"`
+	Source      PlanSource      `json:"source"`
+	Timeouts    PlanTimeouts    `json:"timeouts"`
+	Destination PlanDestination `json:"destination"`
+	// Attachments are the names of the files embedded in the output.
+	Attachments []string `json:"attachments,omitempty"`
+	// OCRLanguages are the languages of the text recognized in the pages
+	// without text, if OCR is requested.
+	OCRLanguages string `json:"ocr_languages,omitempty"`
+}
+
+// PlanSource describes how the source of a dry run would be fetched.
+type PlanSource struct {
+	// URL is empty for uploads.
+	URL     string            `json:"url,omitempty"`
+	Proxy   string            `json:"proxy,omitempty"`
+	HostMap map[string]string `json:"host_map,omitempty"`
+	Offline bool              `json:"offline"`
+}
+
+// PlanTimeouts are the effective timeouts of a dry run, in seconds.
+type PlanTimeouts struct {
+	// Fetch applies to each attempt of the fetch stage (of URLs), which is
+	// retried FetchRetries times.
+	Fetch        int `json:"fetch"`
+	FetchRetries int `json:"fetch_retries"`
+	// Conversion applies to the conversion in a worker.
+	Conversion int `json:"conversion"`
+}
+
+// PlanDestination describes where the output of a dry run would be
+// delivered: 'response', 's3', or 'queue' (for asynchronous conversions,
+// uploaded to S3 by a consumer).
+type PlanDestination struct {
+	Type   string `json:"type"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	ACL    string `json:"acl,omitempty"`
+	Region string `json:"region,omitempty"`
+	Dedupe bool   `json:"dedupe,omitempty"`
+	// IncludeSource stores the rendered source (DOM) next to the output.
+	IncludeSource bool `json:"include_source,omitempty"`
+	// IncludeArchive stores the WARC archive of the render next to the
+	// output.
+	IncludeArchive bool `json:"include_archive,omitempty"`
+}
+
+// dryRun returns true if the request is a dry run ('dryRun').
+func dryRun(c *gin.Context) bool {
+	return queryFlag(c, "dryRun")
+}
+
+// renderPlan returns the render plan of a conversion of a URL (or an upload,
+// if uri is empty). The options must have been checked (see checkOptions).
+func renderPlan(c *gin.Context, uri string) RenderPlan {
+	conf := c.MustGet("config").(Config)
+	format, _ := outputFormat(c)
+
+	source := converter.ConversionSource{URI: uri}
+	path := uri
+	if uri == "" {
+		source = converter.ConversionSource{IsLocal: true}
+		path = uploadPath
+	}
+	athena := athenaConversion(c, source, format)
+	athena.Proxy = redactURL(athena.Proxy)
+	e, _ := requestEgress(c)
+
+	plan := RenderPlan{
+		DryRun:      true,
+		Engine:      "athenapdf",
+		Format:      format,
+		ContentType: athenapdf.ContentTypes[format],
+		// Conversions in the request report their progress
+		Command: athena.Command(path, true),
+		Env:     athena.Env(),
+		Source: PlanSource{
+			URL:     uri,
+			Proxy:   athena.Proxy,
+			HostMap: e.hosts,
+			Offline: athena.Offline,
+		},
+		Timeouts: PlanTimeouts{Conversion: conf.WorkerTimeout},
+	}
+	// CloudConvert only supports PDF output
+	if conf.ConversionFallback && format == athenapdf.FormatPDF {
+		plan.FallbackEngine = "cloudconvert"
+	}
+	if uri != "" {
+		plan.Timeouts.Fetch = conf.Fetch.Timeout
+		plan.Timeouts.FetchRetries = conf.Fetch.Retries
+	}
+
+	_, dedupe := c.GetQuery("s3_dedupe")
+	plan.Destination = PlanDestination{Type: "response"}
+	if c.Query("s3_bucket") != "" {
+		plan.Destination = PlanDestination{
+			Type:   "s3",
+			Bucket: c.Query("s3_bucket"),
+			Key:    c.Query("s3_key"),
+			ACL:    c.Query("s3_acl"),
+			Region: c.Query("aws_region"),
+			Dedupe: dedupe,
+		}
+	}
+	if _, async := c.GetQuery("async"); async {
+		plan.Destination.Type = "queue"
+	}
+	plan.Destination.IncludeSource = includeSource(c)
+	plan.Destination.IncludeArchive = includeArchive(c)
+	files, _ := requestAttachments(c)
+	for _, f := range files {
+		plan.Attachments = append(plan.Attachments, f.Name)
+	}
+	if attachSource(c) {
+		plan.Attachments = append(plan.Attachments, athenapdf.SourceAttachment)
+	}
+	if o, _ := requestOCR(c); o != nil {
+		plan.OCRLanguages = o.Languages
+	}
+	return plan
+}
+
+// dryRunHandler returns the render plan of a conversion instead of
+// converting it (see RenderPlan). Nothing is fetched, or executed.
+func dryRunHandler(c *gin.Context, uri string) {
+	if err := checkAsync(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.JSON(http.StatusOK, renderPlan(c, uri))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrProxyNotAllowed should be returned when a request chooses a proxy
+	// that is not in the operator's allowlist.
+	ErrProxyNotAllowed = errors.New("proxy not allowed")
+	// ErrHostMapNotAllowed should be returned when a request maps a host
+	// name to an address outside of the operator's allowed ranges.
+	ErrHostMapNotAllowed = errors.New("host mapping not allowed")
+	// ErrSourceCAInvalid should be returned when the CA bundle used to fetch
+	// sources contains no PEM certificates.
+	ErrSourceCAInvalid = errors.New("no certificates found in source CA bundle")
+)
+
+// Select returns the URL of the proxy to use for a request. The host selects
+// one of the allowed proxies by its HOST:PORT, otherwise the default proxy is
+// used.
+func (p Proxy) Select(host string) (string, error) {
+	if host == "" {
+		return p.URL, nil
+	}
+	for _, allowed := range p.AllowedURLs {
+		if u, err := url.Parse(allowed); err == nil && u.Host == host {
+			return allowed, nil
+		}
+	}
+	return "", ErrProxyNotAllowed
+}
+
+// With returns the configured host mappings, followed by the requested
+// mappings. Requested mappings must resolve to an address in one of the
+// allowed ranges.
+func (h Hosts) With(requested map[string]string) (map[string]string, error) {
+	hosts := make(map[string]string, len(h.Map)+len(requested))
+	for host, addr := range h.Map {
+		hosts[host] = addr
+	}
+	for host, addr := range requested {
+		if !h.allowed(addr) {
+			return nil, ErrHostMapNotAllowed
+		}
+		hosts[host] = addr
+	}
+	return hosts, nil
+}
+
+func (h Hosts) allowed(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range h.AllowedCIDRs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config returns the TLS configuration for fetching sources, or nil if the
+// defaults should be used.
+func (t SourceTLS) Config() (*tls.Config, error) {
+	if t.CAFile == "" && t.CertFile == "" {
+		return nil, nil
+	}
+	conf := &tls.Config{}
+	if t.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, ErrSourceCAInvalid
+		}
+		conf.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// egress describes how sources are fetched for a conversion.
+type egress struct {
+	// proxy is the URL of the proxy (if any).
+	proxy string
+	// hosts maps host names to addresses.
+	hosts map[string]string
+	// tls is the TLS configuration for HTTPS sources (if not the default).
+	tls *tls.Config
+}
+
+// newEgress returns the egress settings of a conversion, using the proxy,
+// and host mappings requested by a client (or job).
+func newEgress(conf Config, proxy string, hosts map[string]string) (egress, error) {
+	p, err := conf.Proxy.Select(proxy)
+	if err != nil {
+		return egress{}, err
+	}
+	h, err := conf.Hosts.With(hosts)
+	if err != nil {
+		return egress{}, err
+	}
+	t, err := conf.SourceTLS.Config()
+	if err != nil {
+		return egress{}, err
+	}
+	return egress{proxy: p, hosts: h, tls: t}, nil
+}
+
+// requestHostMap returns the host mappings requested with 'host_map'.
+func requestHostMap(c *gin.Context) map[string]string {
+	hosts := make(map[string]string)
+	for _, m := range c.QueryArray("host_map") {
+		if kv := strings.SplitN(m, "=", 2); len(kv) == 2 {
+			hosts[kv[0]] = kv[1]
+		} else {
+			// Unparseable mappings are never allowed
+			hosts[m] = ""
+		}
+	}
+	return hosts
+}
+
+// requestEgress returns the egress settings of a request.
+func requestEgress(c *gin.Context) (egress, error) {
+	conf := c.MustGet("config").(Config)
+	return newEgress(conf, c.Query("proxy"), requestHostMap(c))
+}
+
+// jobEgress returns the egress settings of an asynchronous job.
+func jobEgress(conf Config, j queue.Job) (egress, error) {
+	return newEgress(conf, j.Proxy, j.HostMap)
+}
+
+// client returns the HTTP client used to fetch conversion sources.
+// Without a proxy, the standard proxy environment variables apply.
+// Host mappings do not apply to requests through a proxy, as the proxy
+// resolves the host.
+func (e egress) client() (*http.Client, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if e.proxy != "" {
+		u, err := url.Parse(e.proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if e.tls != nil {
+		t.TLSClientConfig = e.tls
+	}
+	if len(e.hosts) > 0 {
+		dialer := &net.Dialer{}
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(addr); err == nil {
+				if mapped, ok := e.hosts[host]; ok {
+					addr = net.JoinHostPort(mapped, port)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// flags returns the renderer flags needed to apply the settings.
+func (e egress) flags() []string {
+	if len(e.hosts) == 0 {
+		return nil
+	}
+	rules := make([]string, 0, len(e.hosts))
+	for host, addr := range e.hosts {
+		rules = append(rules, fmt.Sprintf("MAP %s %s", host, addr))
+	}
+	sort.Strings(rules)
+	return []string{"host-resolver-rules=" + strings.Join(rules, ", ")}
+}
+
+// newURLSource prepares a remote conversion source, fetching it with the
+// egress settings of the request.
+func newURLSource(c *gin.Context, uri string) (*converter.ConversionSource, error) {
+	return newConditionalURLSource(c, uri, converter.Validators{})
+}
+
+// newConditionalURLSource is like newURLSource, but it fetches the source
+// with a conditional request (see converter.NewConditionalSource).
+func newConditionalURLSource(c *gin.Context, uri string, v converter.Validators) (*converter.ConversionSource, error) {
+	if err := allowedSource(c, uri); err != nil {
+		return nil, err
+	}
+	e, err := requestEgress(c)
+	if err != nil {
+		return nil, err
+	}
+	conf := c.MustGet("config").(Config)
+	s := c.MustGet("statsd").(*statsd.Client)
+	return fetchSource(conf, s, e, uri, c.Query("ext"), v, c.Request.Context().Done())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/email"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrEmailAttachmentsInvalid should be returned when the handling of the
+	// attachments of an email message is unknown.
+	ErrEmailAttachmentsInvalid = errors.New("invalid email attachments provided (use list, embed, or append)")
+)
+
+// Handling of the attachments of email messages ('email_attachments').
+const (
+	// emailAttachmentsList lists the names of the attachments in the header
+	// block of the message.
+	emailAttachmentsList = "list"
+	// emailAttachmentsEmbed also embeds the attachments in the PDF (see
+	// pdf.Attach).
+	emailAttachmentsEmbed = "embed"
+	// emailAttachmentsAppend also appends the pages of PDF, and image
+	// attachments to the PDF, and embeds the others.
+	emailAttachmentsAppend = "append"
+)
+
+// emailAttachments returns the handling of the attachments of an email
+// message ('email_attachments').
+func emailAttachments(c *gin.Context) (string, error) {
+	switch v := c.DefaultQuery("email_attachments", emailAttachmentsList); v {
+	case emailAttachmentsList, emailAttachmentsEmbed, emailAttachmentsAppend:
+		return v, nil
+	}
+	return "", ErrEmailAttachmentsInvalid
+}
+
+// emailUpload returns an uploaded email message (see email.IsMessage) as a
+// HTML document, with a header block of its sender, recipients, date, and
+// subject, and sets it up to be converted: its attachments are embedded in
+// the output, or appended to it ('email_attachments'), and the document is
+// converted as HTML. The message must fit in the spool quota.
+func emailUpload(c *gin.Context, file io.Reader) (io.Reader, error) {
+	conf := c.MustGet("config").(Config)
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	mode, err := emailAttachments(c)
+	if err != nil {
+		return nil, err
+	}
+	used := 0
+	b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+	if err != nil {
+		return nil, err
+	}
+	m, err := email.Parse(b)
+	if err != nil {
+		s.Increment("email_error")
+		return nil, err
+	}
+
+	var embedded []pdf.Attachment
+	var appended [][]byte
+	for _, a := range m.Files() {
+		if mode == emailAttachmentsAppend {
+			if doc, ok := appendableAttachment(c, a); ok {
+				appended = append(appended, doc)
+				continue
+			}
+		}
+		if mode != emailAttachmentsList {
+			embedded = append(embedded, pdf.Attachment{Name: a.Name, MimeType: a.MimeType, Relationship: "Supplement", Data: a.Data})
+		}
+	}
+	if len(appended) > 0 {
+		if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+			return nil, ErrAttachmentsFormat
+		}
+		c.Set("appended", appended)
+	}
+	if len(embedded) > 0 {
+		files, err := requestAttachments(c)
+		if err != nil {
+			return nil, err
+		}
+		c.Set("attachments", append(files[:len(files):len(files)], embedded...))
+	}
+
+	// The message is converted as the HTML document
+	q := c.Request.URL.Query()
+	q.Set("ext", "html")
+	c.Request.URL.RawQuery = q.Encode()
+	s.Increment("email")
+	return bytes.NewReader(m.Document()), nil
+}
+
+// appendableAttachment returns the attachment of an email message as a PDF
+// document, if it is a PDF document, or an image (on a page of the size of
+// the request).
+func appendableAttachment(c *gin.Context, a email.Attachment) ([]byte, bool) {
+	if pdf.IsPDF(a.Data) {
+		// The document must be readable to be merged
+		if _, err := pdf.Merge(a.Data); err != nil {
+			return nil, false
+		}
+		return a.Data, true
+	}
+	if !isImage(a.Data) {
+		return nil, false
+	}
+	im, err := pdf.NewImage(a.Data)
+	if err != nil {
+		return nil, false
+	}
+	size, ok := pdf.PaperSize(c.Query("page_size"), false)
+	if !ok {
+		size, _ = pdf.PaperSize("A4", false)
+	}
+	doc, err := pdf.FromImages([]*pdf.Image{im}, pdf.ImageLayout{Size: size, Margin: 36})
+	if err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// appendedDocuments returns the documents appended to the output of a
+// conversion (see emailUpload).
+func appendedDocuments(c *gin.Context) [][]byte {
+	if docs, ok := c.Get("appended"); ok {
+		return docs.([][]byte)
+	}
+	return nil
+}
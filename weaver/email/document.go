@@ -0,0 +1,100 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Document returns the message as a HTML document: its header block (see
+// headerBlock), followed by its HTML body, or its text body. The images the
+// HTML body references by their content ID are inlined as data URIs, and its
+// scripts are removed (as email clients do).
+func (m *Message) Document() []byte {
+	if m.HTML == "" {
+		var b bytes.Buffer
+		b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>`)
+		template.HTMLEscape(&b, []byte(m.Subject))
+		b.WriteString(`</title></head><body>`)
+		b.WriteString(m.headerBlock())
+		b.WriteString(`<pre style="white-space: pre-wrap; word-wrap: break-word; font: 13px/1.4 monospace">`)
+		template.HTMLEscape(&b, []byte(m.Text))
+		b.WriteString(`</pre></body></html>`)
+		return b.Bytes()
+	}
+
+	// The parser does not fail on invalid HTML, only on read errors
+	doc, _ := html.Parse(strings.NewReader(m.HTML))
+	cids := make(map[string]Attachment)
+	for _, a := range m.Attachments {
+		if a.ContentID != "" {
+			cids["cid:"+a.ContentID] = a
+		}
+	}
+	var head, body *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.DataAtom == atom.Script:
+				n.RemoveChild(c)
+			case c.DataAtom == atom.Meta && (hasAttr(c, "charset") || strings.EqualFold(attr(c, "http-equiv"), "content-type")):
+				// The document is UTF-8, whatever the charset of the message
+				n.RemoveChild(c)
+			default:
+				switch c.DataAtom {
+				case atom.Head:
+					head = c
+				case atom.Body:
+					body = c
+				}
+				for i, a := range c.Attr {
+					if f, ok := cids[a.Val]; ok && (a.Key == "src" || a.Key == "background") {
+						c.Attr[i].Val = "data:" + f.MimeType + ";base64," + base64.StdEncoding.EncodeToString(f.Data)
+					}
+				}
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(doc)
+
+	// The parser always adds a head, and a body
+	if head != nil {
+		head.InsertBefore(&html.Node{Type: html.ElementNode, Data: "meta", DataAtom: atom.Meta,
+			Attr: []html.Attribute{{Key: "charset", Val: "utf-8"}}}, head.FirstChild)
+	}
+	if body != nil {
+		header, _ := html.ParseFragment(strings.NewReader(m.headerBlock()), body)
+		for i := len(header) - 1; i >= 0; i-- {
+			body.InsertBefore(header[i], body.FirstChild)
+		}
+	}
+	var b bytes.Buffer
+	html.Render(&b, doc)
+	return b.Bytes()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Package email reads email messages (MIME messages, i.e. '.eml' files, and
+// Outlook '.msg' files), and renders them as HTML documents, with a header
+// block of their sender, recipients, date, and subject, so that they can be
+// converted to PDF like any other document.
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotMessage is returned when a file is not an email message.
+var ErrNotMessage = errors.New("the file is not an email message (.eml, or .msg)")
+
+// Message is an email message.
+type Message struct {
+	From    string
+	To      string
+	Cc      string
+	Date    time.Time
+	Subject string
+	// Text, and HTML are the bodies of the message (either may be empty).
+	Text string
+	HTML string
+	// Attachments are the attachments of the message, with unique names,
+	// including the images the HTML body references by their content ID.
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Name     string
+	MimeType string
+	// ContentID is the ID the HTML body references the file by ('cid:').
+	ContentID string
+	Data      []byte
+}
+
+// Inline returns true if the attachment is referenced by the HTML body of
+// the message (e.g. an image of a signature), rather than attached to it.
+func (m *Message) Inline(a Attachment) bool {
+	return a.ContentID != "" && strings.Contains(m.HTML, "cid:"+a.ContentID)
+}
+
+// Files returns the attachments of the message that are not inline.
+func (m *Message) Files() []Attachment {
+	var files []Attachment
+	for _, a := range m.Attachments {
+		if !m.Inline(a) {
+			files = append(files, a)
+		}
+	}
+	return files
+}
+
+// Parse reads a MIME message, or an Outlook message (detected by its
+// signature).
+func Parse(b []byte) (*Message, error) {
+	var m *Message
+	var err error
+	if bytes.HasPrefix(b, cfbSignature) {
+		m, err = parseMSG(b)
+	} else {
+		m, err = parseEML(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.uniqueNames()
+	for i, a := range m.Attachments {
+		if a.MimeType == "" || a.MimeType == "application/octet-stream" {
+			if t := mime.TypeByExtension(path.Ext(a.Name)); t != "" {
+				m.Attachments[i].MimeType = t
+			} else {
+				m.Attachments[i].MimeType = http.DetectContentType(a.Data)
+			}
+		}
+	}
+	return m, nil
+}
+
+// IsMessage returns true if a file name, or an extension (e.g. of the 'ext'
+// option of a conversion) is of an email message.
+func IsMessage(name, ext string) bool {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "eml", "msg":
+		return true
+	case "":
+		name = strings.ToLower(name)
+		return strings.HasSuffix(name, ".eml") || strings.HasSuffix(name, ".msg")
+	}
+	return false
+}
+
+// uniqueNames names the attachments without a name, and renames the
+// attachments with the name of a previous attachment, e.g. 'scan (2).pdf'.
+func (m *Message) uniqueNames() {
+	seen := make(map[string]bool, len(m.Attachments))
+	for i := range m.Attachments {
+		a := &m.Attachments[i]
+		if a.Name == "" {
+			a.Name = "attachment-" + strconv.Itoa(i+1)
+		}
+		name := a.Name
+		for n := 2; seen[name]; n++ {
+			ext := ""
+			if j := strings.LastIndex(a.Name, "."); j > 0 {
+				ext = a.Name[j:]
+			}
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(a.Name, ext), n, ext)
+		}
+		a.Name = name
+		seen[name] = true
+	}
+}
+
+// decodeCharset returns text in a charset as UTF-8. Text in unknown
+// charsets is returned as is if it is valid UTF-8, and as Windows-1252
+// otherwise (the most common charset of legacy messages).
+func decodeCharset(b []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	var s strings.Builder
+	for _, c := range b {
+		if c >= 0x80 && c < 0xa0 && cp1252[c-0x80] != 0 {
+			s.WriteRune(cp1252[c-0x80])
+			continue
+		}
+		s.WriteRune(rune(c))
+	}
+	return s.String()
+}
+
+// cp1252 are the characters of Windows-1252 that are not those of ISO
+// 8859-1 (0x80-0x9f).
+var cp1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// headerFields returns the fields of the header block of the message.
+func (m *Message) headerFields() [][2]string {
+	fields := [][2]string{{"From", m.From}, {"To", m.To}, {"Cc", m.Cc}}
+	if !m.Date.IsZero() {
+		fields = append(fields, [2]string{"Date", m.Date.Format("Mon, 2 Jan 2006 15:04:05 -0700")})
+	}
+	fields = append(fields, [2]string{"Subject", m.Subject})
+	var names []string
+	for _, a := range m.Files() {
+		names = append(names, a.Name)
+	}
+	return append(fields, [2]string{"Attachments", strings.Join(names, ", ")})
+}
+
+// headerBlock returns the header block of the message, as HTML.
+func (m *Message) headerBlock() string {
+	var b strings.Builder
+	b.WriteString(`<div class="weaver-email-header" style="font: 13px/1.4 sans-serif; color: #000; margin: 0 0 16px; padding: 0 0 8px; border-bottom: 1px solid #999; break-inside: avoid">`)
+	if m.Subject != "" {
+		fmt.Fprintf(&b, `<h1 style="font-size: 18px; margin: 0 0 8px">%s</h1>`, html.EscapeString(m.Subject))
+	}
+	b.WriteString(`<table style="border-collapse: collapse">`)
+	for _, f := range m.headerFields() {
+		if f[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, `<tr><th style="text-align: left; vertical-align: top; padding: 0 12px 0 0">%s</th><td>%s</td></tr>`,
+			f[0], html.EscapeString(f[1]))
+	}
+	b.WriteString(`</table></div>`)
+	return b.String()
+}
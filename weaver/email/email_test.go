@@ -0,0 +1,148 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEML = "From: =?utf-8?q?Ren=C3=A9e?= <renee@example.com>\r\n" +
+	"To: Bob <bob@example.com>\r\n" +
+	"Cc: carol@example.com\r\n" +
+	"Date: Fri, 01 Jun 2018 11:30:00 +0200\r\n" +
+	"Subject: =?iso-8859-1?q?Caf=E9?= order\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: multipart/alternative; boundary=alt\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Two coffees, please.\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html; charset=windows-1252\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><head><meta charset=3D\"windows-1252\"><script>alert(1)</script></head>=\r\n" +
+	"<body><p>Two caf=E9s, please =96 thanks.</p><img src=3D\"cid:logo@example\"></body></html>\r\n" +
+	"--alt--\r\n" +
+	"--inner\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <logo@example>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"order.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"order.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQ=\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"order.pdf\"\r\n" +
+	"\r\n" +
+	"not a PDF\r\n" +
+	"--outer--\r\n"
+
+func TestParse_eml(t *testing.T) {
+	m, err := Parse([]byte(testEML))
+	if err != nil {
+		t.Fatalf("unable to parse message: %+v", err)
+	}
+	for _, tt := range [][2]string{
+		{m.From, "Renée <renee@example.com>"},
+		{m.To, "Bob <bob@example.com>"},
+		{m.Cc, "carol@example.com"},
+		{m.Subject, "Café order"},
+		{m.Text, "Two coffees, please."},
+	} {
+		if tt[0] != tt[1] {
+			t.Errorf("expected %q, got %q", tt[1], tt[0])
+		}
+	}
+	if !strings.Contains(m.HTML, "Two cafés, please – thanks.") {
+		t.Errorf("expected the HTML body to be decoded, got %q", m.HTML)
+	}
+	if want := time.Date(2018, 6, 1, 9, 30, 0, 0, time.UTC); !m.Date.Equal(want) {
+		t.Errorf("expected date to be %v, got %v", want, m.Date)
+	}
+
+	var names []string
+	for _, a := range m.Attachments {
+		names = append(names, a.Name)
+	}
+	if got, want := strings.Join(names, ","), "attachment-1,order.pdf,order (2).pdf"; got != want {
+		t.Errorf("expected attachments to be %s, got %s", want, got)
+	}
+	if got, want := string(m.Attachments[1].Data), "%PDF-1.4"; got != want {
+		t.Errorf("expected attachment to be %q, got %q", want, got)
+	}
+	if got, want := len(m.Files()), 2; got != want {
+		t.Errorf("expected %d files (without the inline image), got %d", want, got)
+	}
+}
+
+func TestParse_notMessage(t *testing.T) {
+	for _, b := range []string{"", "%PDF-1.4\n", "<html><body>Hello</body></html>"} {
+		if _, err := Parse([]byte(b)); err != ErrNotMessage {
+			t.Errorf("expected error of %q to be %v, got %v", b, ErrNotMessage, err)
+		}
+	}
+}
+
+func TestMessage_Document(t *testing.T) {
+	m, err := Parse([]byte(testEML))
+	if err != nil {
+		t.Fatalf("unable to parse message: %+v", err)
+	}
+	doc := string(m.Document())
+	for _, s := range []string{
+		`<meta charset="utf-8"/>`,
+		`<th style="text-align: left; vertical-align: top; padding: 0 12px 0 0">From</th><td>Renée &lt;renee@example.com&gt;</td>`,
+		`<td>order.pdf, order (2).pdf</td>`,
+		`<img src="data:image/png;base64,iVBORw0KGgo="/>`,
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("expected the document to contain %q, got %s", s, doc)
+		}
+	}
+	if i, j := strings.Index(doc, "weaver-email-header"), strings.Index(doc, "Two cafés"); i < 0 || i > j {
+		t.Errorf("expected the header block to precede the body, got %s", doc)
+	}
+	for _, s := range []string{"<script>", "windows-1252"} {
+		if strings.Contains(doc, s) {
+			t.Errorf("expected the document not to contain %q", s)
+		}
+	}
+
+	m.HTML = ""
+	m.Text = "<b>plain</b>"
+	if doc := string(m.Document()); !strings.Contains(doc, "&lt;b&gt;plain&lt;/b&gt;</pre>") {
+		t.Errorf("expected the text body to be escaped, got %s", doc)
+	}
+}
+
+func TestIsMessage(t *testing.T) {
+	tests := []struct {
+		name, ext string
+		want      bool
+	}{
+		{"mail.eml", "", true},
+		{"MAIL.MSG", "", true},
+		{"document", "eml", true},
+		{"mail.eml", "html", false},
+		{"page.html", "", false},
+	}
+	for _, tt := range tests {
+		if got := IsMessage(tt.name, tt.ext); got != tt.want {
+			t.Errorf("expected %s (%s) to be %t, got %t", tt.name, tt.ext, tt.want, got)
+		}
+	}
+}
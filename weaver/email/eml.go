@@ -0,0 +1,130 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// maxPartDepth is the maximum depth of nested multipart parts of a message.
+const maxPartDepth = 16
+
+// wordDecoder decodes the encoded words of headers (RFC 2047), in the
+// charsets of decodeCharset.
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, r io.Reader) (io.Reader, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeCharset(b, charset)), nil
+	},
+}
+
+// decodeHeader returns a header with its encoded words decoded.
+func decodeHeader(s string) string {
+	if d, err := wordDecoder.DecodeHeader(s); err == nil {
+		return d
+	}
+	return s
+}
+
+// parseEML reads a MIME message (RFC 5322).
+func parseEML(b []byte) (*Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrNotMessage
+	}
+	h := msg.Header
+	if h.Get("From") == "" && h.Get("Subject") == "" && h.Get("Date") == "" {
+		return nil, ErrNotMessage
+	}
+	m := &Message{
+		From:    decodeHeader(h.Get("From")),
+		To:      decodeHeader(h.Get("To")),
+		Cc:      decodeHeader(h.Get("Cc")),
+		Subject: decodeHeader(h.Get("Subject")),
+	}
+	m.Date, _ = h.Date()
+	if err := m.readPart(textproto.MIMEHeader(h), msg.Body, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readPart reads a part of a message: its body, or an attachment, or the
+// parts of a multipart part.
+func (m *Message) readPart(h textproto.MIMEHeader, r io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth {
+			return nil
+		}
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("unable to read the parts of the message: %v", err)
+			}
+			if err := m.readPart(p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Quoted-printable parts of multipart parts are already decoded
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to read the message: %v", err)
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	name = path.Base(strings.Replace(decodeHeader(name), `\`, "/", -1))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if disposition != "attachment" && name == "" {
+		switch {
+		case mediaType == "text/html" && m.HTML == "":
+			m.HTML = decodeCharset(b, params["charset"])
+			return nil
+		case mediaType == "text/plain" && m.Text == "":
+			m.Text = decodeCharset(b, params["charset"])
+			return nil
+		case mediaType == "message/rfc822":
+			name = "message.eml"
+		}
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		Name:      name,
+		MimeType:  mediaType,
+		ContentID: strings.Trim(h.Get("Content-Id"), "<> "),
+		Data:      b,
+	})
+	return nil
+}
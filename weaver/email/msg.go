@@ -0,0 +1,373 @@
+package email
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// cfbSignature is the signature of compound files (the container of Outlook
+// messages).
+var cfbSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// Special sector numbers of compound files.
+const (
+	maxSector  = 0xfffffffa
+	endOfChain = 0xfffffffe
+	noStream   = 0xffffffff
+)
+
+// cfbEntry is an entry (a storage, or a stream) of the directory of a
+// compound file.
+type cfbEntry struct {
+	name     string
+	kind     byte
+	children []int
+	child    uint32
+	left     uint32
+	right    uint32
+	start    uint32
+	size     uint64
+}
+
+// Kinds of entries.
+const (
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+// cfb is a compound file (MS-CFB).
+type cfb struct {
+	b          []byte
+	sectorSize int
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	cutoff     uint64
+	entries    []cfbEntry
+}
+
+// parseCFB reads the allocation tables, and the directory of a compound file.
+func parseCFB(b []byte) (*cfb, bool) {
+	if len(b) < 512 {
+		return nil, false
+	}
+	shift := binary.LittleEndian.Uint16(b[0x1e:])
+	if shift != 9 && shift != 12 {
+		return nil, false
+	}
+	f := &cfb{b: b, sectorSize: 1 << shift, cutoff: uint64(binary.LittleEndian.Uint32(b[0x38:]))}
+
+	// The sectors of the FAT are listed in the header, and in the DIFAT
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(b[0x4c+4*i:]))
+	}
+	perSector := f.sectorSize / 4
+	difat := binary.LittleEndian.Uint32(b[0x44:])
+	for n := 0; difat <= maxSector && n < len(b)/f.sectorSize; n++ {
+		s, ok := f.sector(difat)
+		if !ok {
+			return nil, false
+		}
+		for i := 0; i < perSector-1; i++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(s[4*i:]))
+		}
+		difat = binary.LittleEndian.Uint32(s[4*(perSector-1):])
+	}
+	for _, sector := range fatSectors {
+		if sector > maxSector {
+			continue
+		}
+		s, ok := f.sector(sector)
+		if !ok {
+			return nil, false
+		}
+		for i := 0; i < perSector; i++ {
+			f.fat = append(f.fat, binary.LittleEndian.Uint32(s[4*i:]))
+		}
+	}
+
+	dir, ok := f.chain(binary.LittleEndian.Uint32(b[0x30:]), f.fat, f.sector)
+	if !ok {
+		return nil, false
+	}
+	for i := 0; i+128 <= len(dir); i += 128 {
+		e := dir[i : i+128]
+		n := int(binary.LittleEndian.Uint16(e[64:]))/2 - 1
+		if n < 0 || n > 31 {
+			n = 0
+		}
+		name := make([]uint16, n)
+		for j := range name {
+			name[j] = binary.LittleEndian.Uint16(e[2*j:])
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  string(utf16.Decode(name)),
+			kind:  e[66],
+			left:  binary.LittleEndian.Uint32(e[68:]),
+			right: binary.LittleEndian.Uint32(e[72:]),
+			child: binary.LittleEndian.Uint32(e[76:]),
+			start: binary.LittleEndian.Uint32(e[116:]),
+			size:  binary.LittleEndian.Uint64(e[120:]) & 0xffffffff,
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].kind != cfbRoot {
+		return nil, false
+	}
+	for i := range f.entries {
+		if f.entries[i].kind == cfbStorage || f.entries[i].kind == cfbRoot {
+			f.entries[i].children = f.siblings(f.entries[i].child, nil, 0)
+		}
+	}
+
+	// The streams smaller than the cutoff are in the mini stream, the
+	// stream of the root
+	mini, ok := f.chain(binary.LittleEndian.Uint32(b[0x3c:]), f.fat, f.sector)
+	if !ok {
+		return nil, false
+	}
+	for i := 0; i+4 <= len(mini); i += 4 {
+		f.miniFAT = append(f.miniFAT, binary.LittleEndian.Uint32(mini[i:]))
+	}
+	if f.miniStream, ok = f.chain(f.entries[0].start, f.fat, f.sector); !ok {
+		return nil, false
+	}
+	return f, true
+}
+
+// sector returns a sector of the file.
+func (f *cfb) sector(n uint32) ([]byte, bool) {
+	off := (int(n) + 1) * f.sectorSize
+	if n > maxSector || off+f.sectorSize > len(f.b) {
+		return nil, false
+	}
+	return f.b[off : off+f.sectorSize], true
+}
+
+// miniSector returns a sector of the mini stream.
+func (f *cfb) miniSector(n uint32) ([]byte, bool) {
+	off := int(n) * 64
+	if n > maxSector || off+64 > len(f.miniStream) {
+		return nil, false
+	}
+	return f.miniStream[off : off+64], true
+}
+
+// chain returns the sectors of a chain of an allocation table, in order.
+func (f *cfb) chain(start uint32, table []uint32, sector func(uint32) ([]byte, bool)) ([]byte, bool) {
+	var out []byte
+	for n, next := 0, start; next != endOfChain && next != noStream; n++ {
+		if int(next) >= len(table) || n > len(table) {
+			return nil, false
+		}
+		s, ok := sector(next)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, s...)
+		next = table[next]
+	}
+	return out, true
+}
+
+// siblings returns the entries of the red-black tree of the children of a
+// storage, from one of them.
+func (f *cfb) siblings(id uint32, out []int, depth int) []int {
+	if id > maxSector || int(id) >= len(f.entries) || depth > len(f.entries) {
+		return out
+	}
+	out = f.siblings(f.entries[id].left, out, depth+1)
+	out = append(out, int(id))
+	return f.siblings(f.entries[id].right, out, depth+1)
+}
+
+// stream returns the content of a stream entry.
+func (f *cfb) stream(e cfbEntry) []byte {
+	var b []byte
+	var ok bool
+	if e.size < f.cutoff {
+		b, ok = f.chain(e.start, f.miniFAT, f.miniSector)
+	} else {
+		b, ok = f.chain(e.start, f.fat, f.sector)
+	}
+	if !ok || uint64(len(b)) < e.size {
+		return nil
+	}
+	return b[:e.size]
+}
+
+// properties are the properties of a MAPI object (a message, or an
+// attachment) of an Outlook message, by their tag.
+type properties struct {
+	f       *cfb
+	streams map[string]cfbEntry
+	// fixed are the values of the properties of fixed length (e.g. times),
+	// by their tag.
+	fixed map[uint32][]byte
+	// storages are the storages of the object (e.g. its attachments).
+	storages []cfbEntry
+}
+
+// newProperties returns the properties of a storage, whose property stream
+// has a header of the length.
+func newProperties(f *cfb, storage cfbEntry, header int) properties {
+	p := properties{f: f, streams: make(map[string]cfbEntry), fixed: make(map[uint32][]byte)}
+	for _, i := range storage.children {
+		e := f.entries[i]
+		switch {
+		case e.kind == cfbStorage:
+			p.storages = append(p.storages, e)
+		case e.name == "__properties_version1.0":
+			b := f.stream(e)
+			for i := header; i+16 <= len(b); i += 16 {
+				p.fixed[binary.LittleEndian.Uint32(b[i:])] = b[i+8 : i+16]
+			}
+		case strings.HasPrefix(e.name, "__substg1.0_"):
+			p.streams[strings.ToUpper(e.name[len("__substg1.0_"):])] = e
+		}
+	}
+	return p
+}
+
+// Property types.
+const (
+	ptString8 = 0x001e
+	ptUnicode = 0x001f
+	ptBinary  = 0x0102
+	ptSysTime = 0x0040
+)
+
+// binary returns a binary property.
+func (p properties) binary(id uint16) []byte {
+	if e, ok := p.streams[propertyName(id, ptBinary)]; ok {
+		return p.f.stream(e)
+	}
+	return nil
+}
+
+// string returns a string property (in Unicode, or 8-bit strings).
+func (p properties) string(id uint16) string {
+	if e, ok := p.streams[propertyName(id, ptUnicode)]; ok {
+		b := p.f.stream(e)
+		s := make([]uint16, len(b)/2)
+		for i := range s {
+			s[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(s)), "\x00")
+	}
+	if e, ok := p.streams[propertyName(id, ptString8)]; ok {
+		return strings.TrimRight(decodeCharset(p.f.stream(e), ""), "\x00")
+	}
+	return ""
+}
+
+// time returns a time property.
+func (p properties) time(id uint16) time.Time {
+	v, ok := p.fixed[uint32(id)<<16|ptSysTime]
+	if !ok {
+		return time.Time{}
+	}
+	// A FILETIME is the number of 100 nanoseconds since 1601
+	ft := binary.LittleEndian.Uint64(v)
+	if ft == 0 {
+		return time.Time{}
+	}
+	const epoch = 116444736000000000
+	return time.Unix(0, 0).Add(time.Duration(int64(ft-epoch)) * 100).UTC()
+}
+
+// propertyName returns the name of the stream of a property.
+func propertyName(id, kind uint16) string {
+	const hex = "0123456789ABCDEF"
+	tag := uint32(id)<<16 | uint32(kind)
+	var b [8]byte
+	for i := 7; i >= 0; i-- {
+		b[i] = hex[tag&0xf]
+		tag >>= 4
+	}
+	return string(b[:])
+}
+
+// MAPI properties of messages.
+const (
+	propSubject        = 0x0037
+	propSubmitTime     = 0x0039
+	propSenderName     = 0x0c1a
+	propSenderEmail    = 0x0c1f
+	propSenderSMTP     = 0x5d01
+	propDisplayCc      = 0x0e03
+	propDisplayTo      = 0x0e04
+	propDeliveryTime   = 0x0e06
+	propBody           = 0x1000
+	propHTML           = 0x1013
+	propAttachData     = 0x3701
+	propAttachFilename = 0x3704
+	propAttachLongName = 0x3707
+	propAttachMimeType = 0x370e
+	propAttachCID      = 0x3712
+)
+
+// parseMSG reads an Outlook message (MS-OXMSG).
+func parseMSG(b []byte) (*Message, error) {
+	f, ok := parseCFB(b)
+	if !ok {
+		return nil, ErrNotMessage
+	}
+	p := newProperties(f, f.entries[0], 32)
+	if len(p.streams) == 0 {
+		return nil, ErrNotMessage
+	}
+
+	m := &Message{
+		To:      p.string(propDisplayTo),
+		Cc:      p.string(propDisplayCc),
+		Subject: p.string(propSubject),
+		Text:    p.string(propBody),
+	}
+	name, addr := p.string(propSenderName), p.string(propSenderSMTP)
+	if addr == "" {
+		addr = p.string(propSenderEmail)
+	}
+	switch {
+	case name != "" && addr != "" && name != addr:
+		m.From = name + " <" + addr + ">"
+	case addr != "":
+		m.From = addr
+	default:
+		m.From = name
+	}
+	if m.Date = p.time(propSubmitTime); m.Date.IsZero() {
+		m.Date = p.time(propDeliveryTime)
+	}
+	if h := p.binary(propHTML); h != nil {
+		m.HTML = decodeCharset(h, "")
+	} else {
+		m.HTML = p.string(propHTML)
+	}
+
+	for _, s := range p.storages {
+		if !strings.HasPrefix(s.name, "__attach_version1.0_") {
+			continue
+		}
+		a := newProperties(f, s, 8)
+		data := a.binary(propAttachData)
+		if data == nil {
+			// Embedded messages, and OLE objects are not files
+			continue
+		}
+		name := a.string(propAttachLongName)
+		if name == "" {
+			name = a.string(propAttachFilename)
+		}
+		m.Attachments = append(m.Attachments, Attachment{
+			Name:      name,
+			MimeType:  a.string(propAttachMimeType),
+			ContentID: a.string(propAttachCID),
+			Data:      data,
+		})
+	}
+	return m, nil
+}
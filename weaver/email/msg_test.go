@@ -0,0 +1,287 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// testStorage is a storage of a compound file (see writeCFB).
+type testStorage struct {
+	name     string
+	streams  map[string][]byte
+	storages []testStorage
+}
+
+// writeCFB returns a compound file (version 3, with 512 byte sectors) of the
+// root storage. Streams smaller than 4096 bytes are in the mini stream.
+func writeCFB(root testStorage) []byte {
+	type entry struct {
+		name               string
+		kind               byte
+		left, right, child uint32
+		data               []byte
+		start              uint32
+		size               int
+	}
+	entries := []*entry{{name: "Root Entry", kind: cfbRoot, left: noStream, right: noStream, child: noStream}}
+	var add func(s testStorage, parent *entry)
+	add = func(s testStorage, parent *entry) {
+		var children []*entry
+		names := make([]string, 0, len(s.streams))
+		for name := range s.streams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := &entry{name: name, kind: cfbStream, left: noStream, right: noStream, child: noStream, data: s.streams[name]}
+			entries = append(entries, e)
+			children = append(children, e)
+		}
+		for _, sub := range s.storages {
+			e := &entry{name: sub.name, kind: cfbStorage, left: noStream, right: noStream, child: noStream}
+			entries = append(entries, e)
+			children = append(children, e)
+			add(sub, e)
+		}
+		// The children are a chain of right siblings
+		id := func(e *entry) uint32 {
+			for i, x := range entries {
+				if x == e {
+					return uint32(i)
+				}
+			}
+			return noStream
+		}
+		for i, c := range children {
+			if i == 0 {
+				parent.child = id(c)
+			}
+			if i+1 < len(children) {
+				c.right = id(children[i+1])
+			}
+		}
+	}
+	add(root, entries[0])
+
+	// The mini stream, and its allocation table
+	var mini []byte
+	var miniFAT []uint32
+	var large []*entry
+	for _, e := range entries {
+		e.size = len(e.data)
+		switch {
+		case e.kind != cfbStream:
+		case len(e.data) >= 4096:
+			large = append(large, e)
+		case len(e.data) == 0:
+			e.start = endOfChain
+		default:
+			e.start = uint32(len(mini) / 64)
+			n := (len(e.data) + 63) / 64
+			for i := 0; i < n; i++ {
+				next := uint32(len(miniFAT) + 1)
+				if i == n-1 {
+					next = endOfChain
+				}
+				miniFAT = append(miniFAT, next)
+			}
+			mini = append(mini, e.data...)
+			mini = append(mini, make([]byte, n*64-len(e.data))...)
+		}
+	}
+	entries[0].data, entries[0].size = mini, len(mini)
+
+	sectors := func(n int) int { return (n + 511) / 512 }
+	dirSectors := sectors(len(entries) * 128)
+	miniFATSectors := sectors(len(miniFAT) * 4)
+	data := dirSectors + miniFATSectors + sectors(len(mini))
+	for _, e := range large {
+		data += sectors(len(e.data))
+	}
+	fatSectors := 1
+	for (data+fatSectors+127)/128 > fatSectors {
+		fatSectors++
+	}
+
+	var fat []uint32
+	for i := 0; i < fatSectors; i++ {
+		fat = append(fat, 0xfffffffd)
+	}
+	var body []byte
+	// alloc appends a chain of sectors to the file, and returns its start
+	alloc := func(b []byte) uint32 {
+		n := sectors(len(b))
+		if n == 0 {
+			return endOfChain
+		}
+		start := uint32(len(fat))
+		for i := 0; i < n; i++ {
+			next := uint32(len(fat) + 1)
+			if i == n-1 {
+				next = endOfChain
+			}
+			fat = append(fat, next)
+		}
+		body = append(body, b...)
+		body = append(body, make([]byte, n*512-len(b))...)
+		return start
+	}
+
+	var dir bytes.Buffer
+	for i := 0; i < dirSectors*4; i++ {
+		var b [128]byte
+		binary.LittleEndian.PutUint32(b[68:], noStream)
+		binary.LittleEndian.PutUint32(b[72:], noStream)
+		binary.LittleEndian.PutUint32(b[76:], noStream)
+		dir.Write(b[:])
+	}
+	dirStart := alloc(dir.Bytes())
+	var mf bytes.Buffer
+	for _, n := range miniFAT {
+		binary.Write(&mf, binary.LittleEndian, n)
+	}
+	for mf.Len()%512 != 0 {
+		binary.Write(&mf, binary.LittleEndian, uint32(noStream))
+	}
+	miniFATStart := alloc(mf.Bytes())
+	entries[0].start = alloc(mini)
+	for _, e := range large {
+		e.start = alloc(e.data)
+	}
+
+	// The directory is written once the streams have their sectors
+	d := body[:dirSectors*512]
+	for i, e := range entries {
+		b := d[i*128 : (i+1)*128]
+		name := utf16.Encode([]rune(e.name))
+		for j, c := range name {
+			binary.LittleEndian.PutUint16(b[2*j:], c)
+		}
+		binary.LittleEndian.PutUint16(b[64:], uint16(2*len(name)+2))
+		b[66], b[67] = e.kind, 1
+		binary.LittleEndian.PutUint32(b[68:], e.left)
+		binary.LittleEndian.PutUint32(b[72:], e.right)
+		binary.LittleEndian.PutUint32(b[76:], e.child)
+		binary.LittleEndian.PutUint32(b[116:], e.start)
+		binary.LittleEndian.PutUint64(b[120:], uint64(e.size))
+	}
+
+	header := make([]byte, 512)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x18:], 0x3e)
+	binary.LittleEndian.PutUint16(header[0x1a:], 3)
+	binary.LittleEndian.PutUint16(header[0x1c:], 0xfffe)
+	binary.LittleEndian.PutUint16(header[0x1e:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x2c:], uint32(fatSectors))
+	binary.LittleEndian.PutUint32(header[0x30:], dirStart)
+	binary.LittleEndian.PutUint32(header[0x38:], 4096)
+	binary.LittleEndian.PutUint32(header[0x3c:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[0x40:], uint32(miniFATSectors))
+	binary.LittleEndian.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		v := uint32(noStream)
+		if i < fatSectors {
+			v = uint32(i)
+		}
+		binary.LittleEndian.PutUint32(header[0x4c+4*i:], v)
+	}
+	for len(fat)%128 != 0 || len(fat) < fatSectors*128 {
+		fat = append(fat, noStream)
+	}
+	out := bytes.NewBuffer(header)
+	for _, n := range fat {
+		binary.Write(out, binary.LittleEndian, n)
+	}
+	out.Write(body)
+	return out.Bytes()
+}
+
+// unicode returns a Unicode string property.
+func unicode(s string) []byte {
+	var b bytes.Buffer
+	for _, c := range utf16.Encode([]rune(s)) {
+		binary.Write(&b, binary.LittleEndian, c)
+	}
+	return b.Bytes()
+}
+
+// testMSG returns an Outlook message with an HTML body, an inline image, and
+// two attachments (one of them in regular sectors).
+func testMSG(sent time.Time) []byte {
+	props := make([]byte, 32+16)
+	binary.LittleEndian.PutUint32(props[32:], propSubmitTime<<16|ptSysTime)
+	binary.LittleEndian.PutUint64(props[40:], uint64(sent.UnixNano()/100+116444736000000000))
+	return writeCFB(testStorage{
+		streams: map[string][]byte{
+			"__properties_version1.0":                                props,
+			"__substg1.0_" + propertyName(propSubject, ptUnicode):    unicode("Quarterly report"),
+			"__substg1.0_" + propertyName(propSenderName, ptUnicode): unicode("Alice"),
+			"__substg1.0_" + propertyName(propSenderSMTP, ptUnicode): unicode("alice@example.com"),
+			"__substg1.0_" + propertyName(propDisplayTo, ptUnicode):  unicode("Bob"),
+			"__substg1.0_" + propertyName(propBody, ptUnicode):       unicode("Hello Bob"),
+			"__substg1.0_" + propertyName(propHTML, ptBinary):        []byte(`<p>Hello <b>Bob</b><img src="cid:logo"></p>`),
+		},
+		storages: []testStorage{
+			{name: "__attach_version1.0_#00000000", streams: map[string][]byte{
+				"__substg1.0_" + propertyName(propAttachLongName, ptUnicode): unicode("logo.png"),
+				"__substg1.0_" + propertyName(propAttachCID, ptUnicode):      unicode("logo"),
+				"__substg1.0_" + propertyName(propAttachData, ptBinary):      []byte("\x89PNG\r\n\x1a\n"),
+			}},
+			{name: "__attach_version1.0_#00000001", streams: map[string][]byte{
+				"__substg1.0_" + propertyName(propAttachLongName, ptUnicode): unicode("report.pdf"),
+				"__substg1.0_" + propertyName(propAttachData, ptBinary):      append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("%"), 5000)...),
+			}},
+			{name: "__recip_version1.0_#00000000", streams: map[string][]byte{
+				"__substg1.0_" + propertyName(0x3001, ptUnicode): unicode("Bob"),
+			}},
+		},
+	})
+}
+
+func TestParse_msg(t *testing.T) {
+	sent := time.Date(2018, 6, 1, 9, 30, 0, 0, time.UTC)
+	m, err := Parse(testMSG(sent))
+	if err != nil {
+		t.Fatalf("unable to parse message: %+v", err)
+	}
+	for _, tt := range [][2]string{
+		{m.Subject, "Quarterly report"},
+		{m.From, "Alice <alice@example.com>"},
+		{m.To, "Bob"},
+		{m.Text, "Hello Bob"},
+		{m.HTML, `<p>Hello <b>Bob</b><img src="cid:logo"></p>`},
+	} {
+		if tt[0] != tt[1] {
+			t.Errorf("expected %q, got %q", tt[1], tt[0])
+		}
+	}
+	if !m.Date.Equal(sent) {
+		t.Errorf("expected date to be %v, got %v", sent, m.Date)
+	}
+	if got, want := len(m.Attachments), 2; got != want {
+		t.Fatalf("expected %d attachments, got %d", want, got)
+	}
+	if got, want := m.Attachments[0].MimeType, "image/png"; got != want {
+		t.Errorf("expected type of the image to be %s, got %s", want, got)
+	}
+	if got, want := len(m.Attachments[1].Data), 5009; got != want {
+		t.Errorf("expected size of the document to be %d, got %d", want, got)
+	}
+	if files := m.Files(); len(files) != 1 || files[0].Name != "report.pdf" {
+		t.Errorf("expected the files to be report.pdf, got %+v", files)
+	}
+}
+
+func TestParse_msgInvalid(t *testing.T) {
+	b := testMSG(time.Now())
+	for _, doc := range [][]byte{b[:600], append(append([]byte{}, cfbSignature...), make([]byte, 504)...)} {
+		if _, err := Parse(doc); err != ErrNotMessage {
+			t.Errorf("expected error to be %v, got %v", ErrNotMessage, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// testMessage returns an email message with a PDF attachment.
+func testMessage() []byte {
+	return []byte("From: Alice <alice@example.com>\r\n" +
+		"To: Bob <bob@example.com>\r\n" +
+		"Date: Fri, 01 Jun 2018 11:30:00 +0200\r\n" +
+		"Subject: Contract\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Please find the contract attached.\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=contract.pdf\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(onePagePDF)) + "\r\n" +
+		"--b--\r\n")
+}
+
+func TestConvertByFileHandler_email(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The mock converter keeps the document it converts
+	script := filepath.Join(dir, "converter.sh")
+	ioutil.WriteFile(script, []byte("for a; do case \"$a\" in *.html) cp \"$a\" "+dir+"/source.html;; esac; done\n"+
+		"cat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	tests := []struct {
+		query string
+		name  string
+		file  []byte
+		code  int
+		pages int
+		want  string
+	}{
+		{"", "mail.eml", testMessage(), http.StatusOK, 1, ""},
+		{"&email_attachments=append", "mail.eml", testMessage(), http.StatusOK, 2, ""},
+		{"&email_attachments=embed", "MAIL.EML", testMessage(), http.StatusOK, 1, "/EmbeddedFiles"},
+		{"&ext=eml&email_attachments=embed", "document", testMessage(), http.StatusOK, 1, "(contract.pdf)"},
+		{"&email_attachments=forward", "mail.eml", testMessage(), http.StatusBadRequest, 0, ""},
+		{"", "mail.msg", []byte("not a message"), http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		os.Remove(filepath.Join(dir, "source.html"))
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, uploadRequest("/convert?auth=123456"+tt.query, tt.name, tt.file))
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s%s to be %d, got %d: %s", tt.name, tt.query, want, got, res.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if got, want := pdf.PageCount(res.Body.Bytes()), tt.pages; got != want {
+			t.Errorf("expected PDF of %s%s to have %d pages, got %d", tt.name, tt.query, want, got)
+		}
+		if tt.want != "" && !bytes.Contains(res.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("expected PDF of %s%s to contain %q", tt.name, tt.query, tt.want)
+		}
+		source, _ := ioutil.ReadFile(filepath.Join(dir, "source.html"))
+		if tt.name == "mail.eml" && !strings.Contains(string(source), "<td>Alice &lt;alice@example.com&gt;</td>") {
+			t.Errorf("expected the message of %s%s to be converted with its header block, got %s", tt.name, tt.query, source)
+		}
+	}
+}
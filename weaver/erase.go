@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// maxSubjectLength is the maximum length of a data subject identifier.
+const maxSubjectLength = 128
+
+// eraseBatchSize is the number of jobs erased at once.
+const eraseBatchSize = 100
+
+var (
+	// ErrSubjectInvalid should be returned when the data subject of a
+	// conversion, or of an erasure is not a valid identifier.
+	ErrSubjectInvalid = errors.New("invalid subject provided (expected an identifier of at most 128 printable characters)")
+	// ErrSubjectRequired should be returned when an erasure does not
+	// identify its data subject.
+	ErrSubjectRequired = errors.New("subject is required to erase data")
+)
+
+// newDeleter returns the deleter of the stored outputs of erased jobs. It is
+// a variable so that tests do not need S3.
+var newDeleter = func(conf Config) retention.Deleter {
+	return s3Deleter{conf}
+}
+
+// validSubject returns true if s is a valid data subject identifier.
+func validSubject(s string) bool {
+	if s == "" || len(s) > maxSubjectLength {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSubject checks the data subject of a conversion ('subject'), if any.
+func checkSubject(c *gin.Context) error {
+	if s, ok := c.GetQuery("subject"); ok && !validSubject(s) {
+		return ErrSubjectInvalid
+	}
+	return nil
+}
+
+// ErasureFailure is a job whose stored output could not be deleted. Its
+// record is kept, so that the erasure can be retried.
+type ErasureFailure struct {
+	Job    string `json:"job"`
+	Object string `json:"object"`
+	Error  string `json:"error"`
+}
+
+// Erasure is the report of the erasure of the data of a subject.
+type Erasure struct {
+	Subject string `json:"subject"`
+	// Tenant is the tenant whose data was erased (all tenants if it is
+	// empty).
+	Tenant string `json:"tenant,omitempty"`
+	// Jobs is the number of erased job records.
+	Jobs int `json:"jobs"`
+	// Outputs are the 's3://' URLs of the deleted outputs.
+	Outputs []string `json:"outputs"`
+	// SharedOutputs is the number of outputs that were kept, as jobs of
+	// other subjects, or tenants reference them (see s3_dedupe).
+	SharedOutputs int `json:"shared_outputs"`
+	// Documents is the number of erased document registry records.
+	Documents int `json:"documents"`
+	// CachedOutputs is the number of erased outputs of the output cache.
+	CachedOutputs int              `json:"cached_outputs"`
+	Failed        []ErasureFailure `json:"failed,omitempty"`
+	// Complete is false if some data could not be erased.
+	Complete bool `json:"complete"`
+}
+
+// eraseOutputs deletes the uploaded output of an erased job, its rendered
+// source, and its archive, and cancels their scheduled deletions, unless a
+// remaining job references the output (the keys of deduplicated outputs are
+// shared by the jobs of any subject, and tenant, see s3_dedupe). The record
+// of the job must be removed first. It returns whether the output was
+// deleted, and the object that could not be deleted, and the error.
+func eraseOutputs(c *gin.Context, d retention.Deleter, jobs history.Store, j history.Job) (bool, string, error) {
+	if j.S3Bucket == "" || j.S3Key == "" {
+		return false, "", nil
+	}
+	object := fmt.Sprintf("s3://%s/%s", j.S3Bucket, j.S3Key)
+	refs, err := jobs.Find(history.Query{S3Bucket: j.S3Bucket, S3Key: j.S3Key, Limit: 1})
+	if err != nil {
+		return false, object, err
+	}
+	if len(refs) > 0 {
+		return false, "", nil
+	}
+	for _, key := range []string{j.S3Key, converter.SourceKey(j.S3Key), converter.ArchiveKey(j.S3Key)} {
+		object := fmt.Sprintf("s3://%s/%s", j.S3Bucket, key)
+		if err := d.Delete(retention.Deletion{Region: j.S3Region, Bucket: j.S3Bucket, Key: key, Job: j.ID, Tenant: j.Tenant}); err != nil {
+			return false, object, err
+		}
+		if s, ok := c.Get("retention"); ok {
+			if err := s.(retention.Store).Remove(j.S3Bucket, key); err != nil {
+				return false, object, err
+			}
+		}
+	}
+	return true, "", nil
+}
+
+// eraseHandler erases the data of a subject: the records of their jobs, the
+// uploaded outputs (and rendered sources, and archives) of the jobs that no
+// other job references, the registry records of their documents, and their
+// cached outputs. It requires the admin key (see AdminMiddleware), and
+// erases the data of the subject of a tenant ('tenant'), or of every tenant.
+// It returns the report of the erasure.
+func eraseHandler(c *gin.Context) {
+	subject, ok := c.GetQuery("subject")
+	if !ok {
+		c.AbortWithError(http.StatusBadRequest, ErrSubjectRequired).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if !validSubject(subject) {
+		c.AbortWithError(http.StatusBadRequest, ErrSubjectInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	q := history.Query{Tenant: c.Query("tenant"), Subject: subject, Limit: eraseBatchSize}
+
+	e := Erasure{Subject: subject, Tenant: q.Tenant, Outputs: []string{}}
+	jobs := c.MustGet("history").(history.Store)
+	d := newDeleter(c.MustGet("config").(Config))
+	failed := make(map[string]bool)
+	// Outputs are shared by the jobs of a subject too, so outputs that are
+	// kept may be deleted with a later job
+	deleted, shared := make(map[string]bool), make(map[string]bool)
+	for {
+		found, err := jobs.Find(q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		var erased []history.Job
+		var ids []string
+		for _, j := range found {
+			if !failed[j.ID] {
+				erased = append(erased, j)
+				ids = append(ids, j.ID)
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if r, ok := c.Get("registry"); ok {
+			n, err := r.(registry.Store).Remove(ids)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			e.Documents += n
+		}
+		if err := jobs.Remove(ids); err != nil {
+			c.Error(err)
+			return
+		}
+		for _, j := range erased {
+			output := fmt.Sprintf("s3://%s/%s", j.S3Bucket, j.S3Key)
+			if deleted[output] {
+				e.Jobs++
+				continue
+			}
+			ok, object, err := eraseOutputs(c, d, jobs, j)
+			if err != nil {
+				log.Printf("[Erase] unable to delete %s of job %s: %+v\n", object, j.ID, err)
+				failed[j.ID] = true
+				e.Failed = append(e.Failed, ErasureFailure{Job: j.ID, Object: object, Error: err.Error()})
+				// The record is restored, so that the erasure can be retried
+				if err := jobs.Add(j); err != nil {
+					c.Error(err)
+					return
+				}
+				continue
+			}
+			if ok {
+				deleted[output] = true
+				delete(shared, output)
+				e.Outputs = append(e.Outputs, output)
+			} else if j.S3Bucket != "" && j.S3Key != "" {
+				shared[output] = true
+			}
+			e.Jobs++
+		}
+		if len(found) < eraseBatchSize {
+			break
+		}
+	}
+	if s := outputCache(c); s != nil {
+		e.CachedOutputs = s.Erase(q.Tenant, subject)
+	}
+	e.SharedOutputs = len(shared)
+	e.Complete = len(e.Failed) == 0
+
+	c.MustGet("statsd").(*statsd.Client).Count("erased_jobs", e.Jobs)
+	log.Printf("[Erase] erased %d jobs, %d outputs (%d shared outputs kept), %d documents, and %d cached outputs of a subject (tenant %q, %d failed)\n", e.Jobs, len(e.Outputs), e.SharedOutputs, e.Documents, e.CachedOutputs, q.Tenant, len(e.Failed))
+	c.JSON(http.StatusOK, e)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+// mockDeleter fails to delete the objects in failing.
+type mockDeleter struct {
+	deleted []string
+	failing map[string]bool
+}
+
+func (m *mockDeleter) Delete(d retention.Deletion) error {
+	if m.failing[d.Key] {
+		return errors.New("access denied")
+	}
+	m.deleted = append(m.deleted, d.Bucket+"/"+d.Key)
+	return nil
+}
+
+func TestCheckSubject(t *testing.T) {
+	for _, s := range []string{"customer-42", "jane@example.com"} {
+		if !validSubject(s) {
+			t.Errorf("expected subject %q to be valid", s)
+		}
+	}
+	for _, s := range []string{"", "a\nb", string(make([]byte, maxSubjectLength+1))} {
+		if validSubject(s) {
+			t.Errorf("expected subject %q to be invalid", s)
+		}
+	}
+}
+
+func TestEraseHandler(t *testing.T) {
+	d := &mockDeleter{failing: map[string]bool{"failing.pdf": true}}
+	defer func(f func(Config) retention.Deleter) { newDeleter = f }(newDeleter)
+	newDeleter = func(Config) retention.Deleter { return d }
+
+	now := time.Now().UTC()
+	jobs := history.NewMemoryStore(20)
+	jobs.Add(history.Job{ID: "1", Time: now, Tenant: "acme", Subject: "customer-42", S3Bucket: "reports", S3Key: "a.pdf"})
+	jobs.Add(history.Job{ID: "2", Time: now, Tenant: "acme", Subject: "customer-42"})
+	jobs.Add(history.Job{ID: "3", Time: now, Tenant: "acme", Subject: "customer-42", S3Bucket: "reports", S3Key: "failing.pdf"})
+	jobs.Add(history.Job{ID: "4", Time: now, Tenant: "acme", Subject: "customer-7"})
+	jobs.Add(history.Job{ID: "5", Time: now, Tenant: "globex", Subject: "customer-42"})
+	// Deduplicated outputs shared with the job of another tenant, and by
+	// jobs of the subject
+	jobs.Add(history.Job{ID: "6", Time: now, Tenant: "acme", Subject: "customer-42", S3Bucket: "reports", S3Key: "shared.pdf"})
+	jobs.Add(history.Job{ID: "7", Time: now, Tenant: "globex", Subject: "customer-9", S3Bucket: "reports", S3Key: "shared.pdf"})
+	jobs.Add(history.Job{ID: "8", Time: now, Tenant: "acme", Subject: "customer-42", S3Bucket: "reports", S3Key: "b.pdf"})
+	jobs.Add(history.Job{ID: "9", Time: now, Tenant: "acme", Subject: "customer-42", S3Bucket: "reports", S3Key: "b.pdf"})
+	documents := registry.NewMemoryStore(10)
+	documents.Add(registry.Record{SHA256: "a", Job: "1"})
+	documents.Add(registry.Record{SHA256: "b", Job: "4"})
+	deletions := retention.NewMemoryStore()
+	deletions.Add(retention.Deletion{Bucket: "reports", Key: "a.pdf", Due: now})
+	cache := outputcache.NewStore(time.Hour, 1024)
+	cache.Put("a", outputcache.Entry{ETag: `"a"`, Output: []byte("%PDF"), Tenant: "acme", Subject: "customer-42"})
+	cache.Put("b", outputcache.Entry{ETag: `"b"`, Output: []byte("%PDF"), Tenant: "globex", Subject: "customer-42"})
+	svc := Services{History: jobs, Registry: documents, Retention: deletions, OutputCache: cache}
+	r := mockRouter(Config{}, svc, func(r *gin.Engine, _ Config, _ Services) {
+		r.DELETE("/data", eraseHandler)
+	})
+
+	for _, query := range []string{"", "?subject=a%0Ab"} {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest("DELETE", "/data"+query, nil))
+		if got, want := res.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected response code of %q to be %d, got %d", query, want, got)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("DELETE", "/data?subject=customer-42&tenant=acme", nil))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	var e Erasure
+	if err := json.Unmarshal(res.Body.Bytes(), &e); err != nil {
+		t.Fatalf("unable to decode erasure: %+v", err)
+	}
+	if e.Tenant != "acme" || e.Jobs != 5 || e.Documents != 1 || e.CachedOutputs != 1 || e.Complete {
+		t.Errorf("expected 5 jobs, a document, and a cached output of acme to be erased, got %+v", e)
+	}
+	sort.Strings(e.Outputs)
+	if want := []string{"s3://reports/a.pdf", "s3://reports/b.pdf"}; !reflect.DeepEqual(e.Outputs, want) {
+		t.Errorf("expected the outputs of jobs 1, 8, and 9 to be deleted, got %v", e.Outputs)
+	}
+	if got, want := e.SharedOutputs, 1; got != want {
+		t.Errorf("expected %d shared output to be kept, got %d", want, got)
+	}
+	if len(e.Failed) != 1 || e.Failed[0].Job != "3" || e.Failed[0].Object != "s3://reports/failing.pdf" {
+		t.Errorf("expected the output of job 3 not to be deleted, got %+v", e.Failed)
+	}
+	if got, want := len(d.deleted), 6; got != want {
+		t.Errorf("expected the outputs of jobs 1, and 8, their sources, and their archives to be deleted once, got %v", d.deleted)
+	}
+	for _, object := range d.deleted {
+		if strings.HasPrefix(object, "reports/shared.pdf") {
+			t.Errorf("expected the output shared with another tenant to be kept, got %s deleted", object)
+		}
+	}
+
+	remaining, _ := jobs.Find(history.Query{})
+	if len(remaining) != 4 {
+		t.Errorf("expected jobs 3, 4, 5, and 7 to remain, got %+v", remaining)
+	}
+	if _, err := documents.Get("b"); err != nil {
+		t.Errorf("expected the document of another subject to remain, got %v", err)
+	}
+	if due, _ := deletions.Due(now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the deletion of the erased output to be cancelled, got %+v", due)
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Errorf("expected the cached output of another tenant to remain")
+	}
+
+	// The output is deleted with the last job referencing it
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("DELETE", "/data?subject=customer-9", nil))
+	e = Erasure{}
+	json.Unmarshal(res.Body.Bytes(), &e)
+	if len(e.Outputs) != 1 || e.Outputs[0] != "s3://reports/shared.pdf" || e.SharedOutputs != 0 {
+		t.Errorf("expected the shared output to be deleted, got %+v", e)
+	}
+}
+
+func TestEraseHandler_tenant(t *testing.T) {
+	reg, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "acme", Key: "acme-key"}})
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	r := mockRouter(conf, Services{Tenants: reg, History: history.NewMemoryStore(10)}, InitSecureRoutes)
+
+	// Only the admin key may erase data
+	for key, want := range map[string]int{"acme-key": http.StatusForbidden, "123456": http.StatusOK} {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest("DELETE", "/data?subject=customer-42&auth="+key, nil))
+		if got := res.Code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d: %s", key, want, got, res.Body.String())
+		}
+	}
+}
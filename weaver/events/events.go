@@ -0,0 +1,136 @@
+// Package events publishes conversion lifecycle events, so that downstream
+// systems can build audit trails, and billing without polling.
+package events
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// SchemaVersion is the version of the event JSON schema. It must be
+// incremented whenever a field is removed or its meaning is changed.
+const SchemaVersion = 1
+
+// Lifecycle event types, in the order they normally occur.
+const (
+	// Received is published when a conversion request is received.
+	Received = "received"
+	// Queued is published when a conversion is added to a work queue or
+	// a shared job queue.
+	Queued = "queued"
+	// Started is published when a worker starts processing a conversion.
+	Started = "started"
+	// Completed is published when a conversion has succeeded.
+	Completed = "completed"
+	// Failed is published when a conversion has failed.
+	Failed = "failed"
+	// Uploaded is published when the output of a conversion has been
+	// uploaded to S3.
+	Uploaded = "uploaded"
+	// Deleted is published when the uploaded output of a conversion has
+	// been deleted at the end of its retention period.
+	Deleted = "deleted"
+)
+
+var hostname, _ = os.Hostname()
+
+// Event is a single conversion lifecycle event.
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	JobID         string    `json:"job_id"`
+	Time          time.Time `json:"time"`
+	Instance      string    `json:"instance"`
+	// Tenant is the ID of the tenant the job is accounted to (if any).
+	Tenant string `json:"tenant,omitempty"`
+	// Source is the source of the job, redacted by the publisher (see
+	// WithRedaction).
+	Source string `json:"source,omitempty"`
+	// Pages, and Bytes are the size of the output of completed, and uploaded
+	// jobs.
+	Pages int    `json:"pages,omitempty"`
+	Bytes int    `json:"bytes,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// New creates an event of the given type for a job.
+func New(t, jobID, source string, err error) Event {
+	e := Event{
+		SchemaVersion: SchemaVersion,
+		ID:            uuid.NewV4().String(),
+		Type:          t,
+		JobID:         jobID,
+		Time:          time.Now().UTC(),
+		Instance:      hostname,
+		Source:        source,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Publisher publishes lifecycle events.
+type Publisher interface {
+	Publish(Event) error
+}
+
+// Emit creates, and publishes an event using the publisher. It does nothing
+// if the publisher is nil. Errors are logged, and never interrupt a
+// conversion.
+func Emit(p Publisher, t, jobID, source string, err error) {
+	publish(p, New(t, jobID, source, err))
+}
+
+// EmitOutput creates, and publishes an event with the size of the output of
+// a job (e.g. a completed event), like Emit.
+func EmitOutput(p Publisher, t, jobID, source string, pages, bytes int) {
+	e := New(t, jobID, source, nil)
+	e.Pages, e.Bytes = pages, bytes
+	publish(p, e)
+}
+
+func publish(p Publisher, e Event) {
+	if p == nil {
+		return
+	}
+	if err := p.Publish(e); err != nil {
+		log.Printf("[Events] unable to publish %s event for job %s: %+v\n", e.Type, e.JobID, err)
+	}
+}
+
+// PublisherFunc is a function publishing events.
+type PublisherFunc func(Event) error
+
+// Publish calls f(e).
+func (f PublisherFunc) Publish(e Event) error {
+	return f(e)
+}
+
+// WithTenant returns a publisher that accounts the events it publishes to a
+// tenant (unless it is empty), or nil if p is nil.
+func WithTenant(p Publisher, tenant string) Publisher {
+	if p == nil || tenant == "" {
+		return p
+	}
+	return PublisherFunc(func(e Event) error {
+		e.Tenant = tenant
+		return p.Publish(e)
+	})
+}
+
+// WithRedaction returns a publisher that redacts the sources of the events
+// it publishes (e.g. the credentials of URLs), or nil if p is nil.
+func WithRedaction(p Publisher, redact func(string) string) Publisher {
+	if p == nil {
+		return nil
+	}
+	return PublisherFunc(func(e Event) error {
+		e.Source = redact(e.Source)
+		return p.Publish(e)
+	})
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type mockPublisher struct {
+	events []Event
+	err    error
+}
+
+func (p *mockPublisher) Publish(e Event) error {
+	p.events = append(p.events, e)
+	return p.err
+}
+
+func TestNew(t *testing.T) {
+	e := New(Started, "test-job", "http://example.com", nil)
+	if got, want := e.SchemaVersion, SchemaVersion; got != want {
+		t.Errorf("expected event schema version to be %d, got %d", want, got)
+	}
+	if e.ID == "" {
+		t.Errorf("expected event ID to be set")
+	}
+	if got, want := e.Type, Started; got != want {
+		t.Errorf("expected event type to be %s, got %s", want, got)
+	}
+	if got := e.Error; got != "" {
+		t.Errorf("expected event error to be empty, got %s", got)
+	}
+}
+
+func TestNew_error(t *testing.T) {
+	e := New(Failed, "test-job", "", errors.New("test error"))
+	if got, want := e.Error, "test error"; got != want {
+		t.Errorf("expected event error to be %s, got %s", want, got)
+	}
+}
+
+func TestEmit(t *testing.T) {
+	p := &mockPublisher{err: errors.New("test publish error")}
+	Emit(p, Queued, "test-job", "", nil)
+	if got, want := len(p.events), 1; got != want {
+		t.Fatalf("expected %d published event, got %d", want, got)
+	}
+	if got, want := p.events[0].JobID, "test-job"; got != want {
+		t.Errorf("expected event job ID to be %s, got %s", want, got)
+	}
+}
+
+func TestEmit_nilPublisher(t *testing.T) {
+	Emit(nil, Queued, "test-job", "", nil)
+}
+
+func TestEmitOutput(t *testing.T) {
+	p := &mockPublisher{}
+	EmitOutput(p, Completed, "test-job", "", 3, 1024)
+	if got := p.events[0]; got.Type != Completed || got.Pages != 3 || got.Bytes != 1024 {
+		t.Errorf("expected a completed event of 3 pages, and 1024 bytes, got %+v", got)
+	}
+}
+
+func TestWithTenant(t *testing.T) {
+	p := &mockPublisher{}
+	Emit(WithTenant(p, "acme"), Queued, "test-job", "", nil)
+	Emit(WithTenant(p, ""), Queued, "test-job", "", nil)
+	if got := p.events[0].Tenant + "," + p.events[1].Tenant; got != "acme," {
+		t.Errorf("expected the tenants of the events to be acme, and none, got %s", got)
+	}
+	if WithTenant(nil, "acme") != nil {
+		t.Errorf("expected a nil publisher to stay nil")
+	}
+}
+
+func TestWithRedaction(t *testing.T) {
+	p := &mockPublisher{}
+	redact := func(s string) string { return strings.ToUpper(s) }
+	Emit(WithRedaction(p, redact), Queued, "test-job", "http://example.com", nil)
+	if got, want := p.events[0].Source, "HTTP://EXAMPLE.COM"; got != want {
+		t.Errorf("expected event source to be %s, got %s", want, got)
+	}
+	if WithRedaction(nil, redact) != nil {
+		t.Errorf("expected a nil publisher to stay nil")
+	}
+}
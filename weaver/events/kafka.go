@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes events as JSON messages to a Kafka topic.
+// Messages are keyed by job ID so that the events of a job are ordered.
+// Messages are written asynchronously, and delivery errors are logged.
+type KafkaPublisher struct {
+	w *kafka.Writer
+}
+
+// NewKafkaPublisher creates a new publisher for the topic on the given
+// brokers (HOST:PORT).
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		w: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+			Async:    true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Printf("[Events] unable to write %d event(s) to Kafka: %+v\n", len(messages), err)
+				}
+			},
+		},
+	}
+}
+
+// Publish writes an event to the Kafka topic.
+func (p *KafkaPublisher) Publish(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.w.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(e.JobID),
+		Value: b,
+	})
+}
+
+// Close flushes pending events, and closes the connection to the brokers.
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/export"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// ErrExportNoToken should be returned when a document is exported without the
+// OAuth access token of its provider.
+var ErrExportNoToken = errors.New("an OAuth access token (X-Source-Token header) is required")
+
+// sourceTokenHeader is the header of the OAuth access token granting access
+// to an exported document. It is not a query parameter, so that it is not
+// logged with the URL of the request.
+const sourceTokenHeader = "X-Source-Token"
+
+// exportConversion exports a document through the API of its provider in the
+// work queue, so that exports are limited by the workers, and their timeout,
+// and the document can be uploaded to S3. The source of the conversion is
+// ignored.
+type exportConversion struct {
+	converter.UploadConversion
+	client export.Client
+	doc    export.Document
+	token  string
+}
+
+func (c exportConversion) Convert(s converter.ConversionSource, done <-chan struct{}, progress converter.ProgressFunc) ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	out, err := c.client.Export(ctx, c.doc, c.token)
+	if err != nil {
+		return nil, err
+	}
+	if !pdf.IsPDF(out) {
+		return nil, export.ErrFailed
+	}
+	return out, nil
+}
+
+// exportClient returns the client exporting the documents of a request, with
+// the egress settings, and the fetch timeout of the request, limited by the
+// spool quota.
+func exportClient(c *gin.Context) (export.Client, error) {
+	conf := c.MustGet("config").(Config)
+	e, err := requestEgress(c)
+	if err != nil {
+		return export.Client{}, err
+	}
+	client, err := e.client()
+	if err != nil {
+		return export.Client{}, err
+	}
+	client.Timeout = time.Second * time.Duration(conf.Fetch.Timeout)
+	return export.Client{
+		HTTP:           client,
+		GoogleEndpoint: conf.Export.GoogleEndpoint,
+		GraphEndpoint:  conf.Export.GraphEndpoint,
+		MaxBytes:       int64(conf.Spool.MaxBytes),
+	}, nil
+}
+
+// exportHandler exports a Google Docs, Sheets, Slides, or Drawings document,
+// or a SharePoint, or OneDrive document ('url') to PDF through the API of its
+// provider, with the OAuth access token of the request (X-Source-Token), so
+// that office documents are converted by their own provider, behind the same
+// API as conversions. Like conversions, the document is uploaded to S3 if
+// requested.
+func exportHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	wq := c.MustGet("queue").(chan<- converter.Work)
+
+	doc, err := export.Parse(c.Query("url"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	token := c.GetHeader(sourceTokenHeader)
+	if token == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrExportNoToken).SetType(gin.ErrorTypePublic)
+		return
+	}
+	client, err := exportClient(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+
+	if err := checkRetention(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	awsConf := requestAWSS3(c, athenapdf.FormatPDF)
+	conversion := exportConversion{
+		UploadConversion: converter.UploadConversion{AWSS3: awsConf},
+		client:           client,
+		doc:              doc,
+		token:            token,
+	}
+	work := converter.NewWork(wq, conversion, converter.ConversionSource{})
+	select {
+	case <-c.Writer.CloseNotify():
+		work.Cancel()
+	case <-work.Uploaded():
+		s.Increment("export")
+		c.JSON(http.StatusOK, uploadedResponse(c, awsConf.Object))
+	case out := <-work.Success():
+		s.Increment("export")
+		c.Header("X-Page-Count", strconv.Itoa(pdf.PageCount(out)))
+		c.Data(http.StatusOK, "application/pdf", out)
+	case err := <-work.Error():
+		s.Increment("export_error")
+		switch err {
+		case converter.ErrConversionTimeout:
+			c.AbortWithError(http.StatusGatewayTimeout, err).SetType(gin.ErrorTypePublic)
+		case export.ErrDenied:
+			c.AbortWithError(http.StatusForbidden, err).SetType(gin.ErrorTypePublic)
+		case export.ErrNotFound:
+			c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+		case export.ErrTooLarge:
+			c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+		default:
+			c.AbortWithError(http.StatusBadGateway, err).SetType(gin.ErrorTypePublic).SetMeta(CodeSourceFetchFailed)
+		}
+	}
+}
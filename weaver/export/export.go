@@ -0,0 +1,168 @@
+// Package export exports documents of online office suites (Google Docs,
+// Sheets, Slides, and Drawings, and SharePoint, and OneDrive documents) to PDF
+// through their APIs, with the OAuth access token of their owner.
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned when the URL of a document is not a
+	// Google Docs, SharePoint, or OneDrive URL.
+	ErrUnsupported = errors.New("the URL is not a Google Docs, SharePoint, or OneDrive document")
+	// ErrDenied is returned when the provider rejects the access token,
+	// or the token does not grant access to the document.
+	ErrDenied = errors.New("the access token does not grant access to the document")
+	// ErrNotFound is returned when the provider does not find the
+	// document.
+	ErrNotFound = errors.New("the document was not found")
+	// ErrFailed is returned when the provider is unable to export the
+	// document.
+	ErrFailed = errors.New("unable to export the document")
+	// ErrTooLarge is returned when an exported document exceeds the
+	// maximum size of the client.
+	ErrTooLarge = errors.New("the exported document is too large")
+)
+
+// Provider is an online office suite.
+type Provider string
+
+// Providers.
+const (
+	Google    Provider = "google"
+	Microsoft Provider = "microsoft"
+)
+
+// Default API endpoints.
+const (
+	DefaultGoogleEndpoint = "https://www.googleapis.com/drive/v3"
+	DefaultGraphEndpoint  = "https://graph.microsoft.com/v1.0"
+)
+
+var (
+	googlePath = regexp.MustCompile(`^/(?:document|spreadsheets|presentation|drawings|file)/(?:u/\d+/)?d/([A-Za-z0-9_-]+)`)
+	googleID   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Document is a document of a provider.
+type Document struct {
+	Provider Provider
+	// ID is the file ID of a Google document.
+	ID string
+	// URL is the sharing URL of a Microsoft document.
+	URL string
+}
+
+// Parse returns the document of its URL, e.g.
+// 'https://docs.google.com/document/d/<id>/edit', or
+// 'https://contoso.sharepoint.com/:w:/s/team/<token>'.
+func Parse(uri string) (Document, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Scheme != "https" {
+		return Document{}, ErrUnsupported
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "docs.google.com" || host == "drive.google.com":
+		if m := googlePath.FindStringSubmatch(u.Path); m != nil {
+			return Document{Provider: Google, ID: m[1]}, nil
+		}
+		if id := u.Query().Get("id"); host == "drive.google.com" && googleID.MatchString(id) {
+			return Document{Provider: Google, ID: id}, nil
+		}
+	case strings.HasSuffix(host, ".sharepoint.com"), host == "onedrive.live.com", host == "1drv.ms":
+		return Document{Provider: Microsoft, URL: u.String()}, nil
+	}
+	return Document{}, ErrUnsupported
+}
+
+// Client exports documents.
+type Client struct {
+	// HTTP is the client of the requests. Defaults to http.DefaultClient.
+	HTTP *http.Client
+	// GoogleEndpoint is the endpoint of the Google Drive API. Defaults to
+	// DefaultGoogleEndpoint.
+	GoogleEndpoint string
+	// GraphEndpoint is the endpoint of the Microsoft Graph API. Defaults to
+	// DefaultGraphEndpoint.
+	GraphEndpoint string
+	// MaxBytes is the maximum size of an exported document, if positive.
+	MaxBytes int64
+}
+
+// request returns the export request of a document.
+func (c Client) request(ctx context.Context, doc Document) (*http.Request, error) {
+	var uri string
+	switch doc.Provider {
+	case Google:
+		endpoint := c.GoogleEndpoint
+		if endpoint == "" {
+			endpoint = DefaultGoogleEndpoint
+		}
+		uri = fmt.Sprintf("%s/files/%s/export?mimeType=application%%2Fpdf", strings.TrimSuffix(endpoint, "/"), url.PathEscape(doc.ID))
+	case Microsoft:
+		endpoint := c.GraphEndpoint
+		if endpoint == "" {
+			endpoint = DefaultGraphEndpoint
+		}
+		// Sharing URLs are encoded as share IDs, see
+		// https://learn.microsoft.com/graph/api/shares-get
+		share := "u!" + base64.RawURLEncoding.EncodeToString([]byte(doc.URL))
+		uri = fmt.Sprintf("%s/shares/%s/driveItem/content?format=pdf", strings.TrimSuffix(endpoint, "/"), share)
+	default:
+		return nil, ErrUnsupported
+	}
+	return http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+}
+
+// Export returns a document exported to PDF, with an OAuth access token
+// granting access to it.
+func (c Client) Export(ctx context.Context, doc Document, token string) ([]byte, error) {
+	req, err := c.request(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/pdf")
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, ErrDenied
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case res.StatusCode >= 300:
+		return nil, ErrFailed
+	}
+
+	var body io.Reader = res.Body
+	if c.MaxBytes > 0 {
+		body = io.LimitReader(res.Body, c.MaxBytes+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBytes > 0 && int64(len(b)) > c.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want Document
+	}{
+		{"https://docs.google.com/document/d/1aBc-_9/edit#heading=h.1", Document{Provider: Google, ID: "1aBc-_9"}},
+		{"https://docs.google.com/spreadsheets/u/1/d/sheet1/edit", Document{Provider: Google, ID: "sheet1"}},
+		{"https://drive.google.com/file/d/file1/view", Document{Provider: Google, ID: "file1"}},
+		{"https://drive.google.com/open?id=file2", Document{Provider: Google, ID: "file2"}},
+		{"https://contoso.sharepoint.com/:w:/s/team/EaBc", Document{Provider: Microsoft, URL: "https://contoso.sharepoint.com/:w:/s/team/EaBc"}},
+		{"https://1drv.ms/w/s!AbC", Document{Provider: Microsoft, URL: "https://1drv.ms/w/s!AbC"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.uri)
+		if err != nil {
+			t.Errorf("unable to parse %s: %+v", tt.uri, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expected %s to be %+v, got %+v", tt.uri, tt.want, got)
+		}
+	}
+}
+
+func TestParse_unsupported(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com/document/d/1",
+		"http://docs.google.com/document/d/1/edit",
+		"https://docs.google.com/forms/d/1/edit",
+		"https://drive.google.com/open?id=../1",
+		"https://sharepoint.com.example.com/doc",
+	} {
+		if _, err := Parse(uri); err != ErrUnsupported {
+			t.Errorf("expected error of %s to be %v, got %v", uri, ErrUnsupported, err)
+		}
+	}
+}
+
+func TestClient_Export(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		paths = append(paths, r.URL.RequestURI())
+		w.Write([]byte("%PDF-1.4"))
+	}))
+	defer ts.Close()
+
+	c := Client{GoogleEndpoint: ts.URL + "/drive/v3", GraphEndpoint: ts.URL + "/v1.0/"}
+	for _, doc := range []Document{
+		{Provider: Google, ID: "doc1"},
+		{Provider: Microsoft, URL: "https://1drv.ms/w/s!AbC"},
+	} {
+		out, err := c.Export(context.Background(), doc, "token")
+		if err != nil {
+			t.Fatalf("unable to export %+v: %+v", doc, err)
+		}
+		if got, want := string(out), "%PDF-1.4"; got != want {
+			t.Errorf("expected document to be %q, got %q", want, got)
+		}
+	}
+	want := []string{
+		"/drive/v3/files/doc1/export?mimeType=application%2Fpdf",
+		"/v1.0/shares/u!aHR0cHM6Ly8xZHJ2Lm1zL3cvcyFBYkM/driveItem/content?format=pdf",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("expected requests to be %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("expected request to be %s, got %s", want[i], paths[i])
+		}
+	}
+}
+
+func TestClient_Export_errors(t *testing.T) {
+	tests := []struct {
+		status int
+		token  string
+		max    int64
+		want   error
+	}{
+		{http.StatusOK, "invalid", 0, ErrDenied},
+		{http.StatusForbidden, "token", 0, ErrDenied},
+		{http.StatusNotFound, "token", 0, ErrNotFound},
+		{http.StatusBadRequest, "token", 0, ErrFailed},
+		{http.StatusOK, "token", 4, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(tt.status)
+			w.Write([]byte("%PDF-1.4"))
+		}))
+		c := Client{GoogleEndpoint: ts.URL, MaxBytes: tt.max}
+		if _, err := c.Export(context.Background(), Document{Provider: Google, ID: "doc1"}, tt.token); err != tt.want {
+			t.Errorf("expected error of status %d to be %v, got %v", tt.status, tt.want, err)
+		}
+		ts.Close()
+	}
+}
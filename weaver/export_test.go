@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func mockExportRouter(endpoint string) *gin.Engine {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.Export.GoogleEndpoint = endpoint
+	conf.Export.GraphEndpoint = endpoint
+	pool := converter.NewPool(1, 10, 10)
+	svc := Services{Queue: pool.Queue(), Pool: pool}
+	return mockRouter(conf, svc, InitSecureRoutes)
+}
+
+func TestExportHandler(t *testing.T) {
+	doc := mockDocument(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/files/doc1/export":
+			w.Write(doc)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	r := mockExportRouter(ts.URL)
+
+	tests := []struct {
+		url   string
+		token string
+		code  int
+	}{
+		{"https://docs.google.com/document/d/doc1/edit", "token", http.StatusOK},
+		{"https://docs.google.com/document/d/doc1/edit", "expired", http.StatusForbidden},
+		{"https://docs.google.com/document/d/doc2/edit", "token", http.StatusNotFound},
+		{"https://contoso.sharepoint.com/:w:/s/team/EaBc", "token", http.StatusNotFound},
+		{"https://docs.google.com/document/d/doc1/edit", "", http.StatusBadRequest},
+		{"https://example.com/document/d/doc1", "token", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/export?auth=123456&url="+tt.url, nil)
+		if tt.token != "" {
+			req.Header.Set("X-Source-Token", tt.token)
+		}
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s (%s) to be %d, got %d: %s", tt.url, tt.token, want, got, res.Body.String())
+			continue
+		}
+		if tt.code == http.StatusOK {
+			if got, want := res.Header().Get("X-Page-Count"), "2"; got != want {
+				t.Errorf("expected page count to be %s, got %s", want, got)
+			}
+		}
+	}
+}
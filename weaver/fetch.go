@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// fetchSource runs the fetch stage of a URL conversion: the source is fetched
+// with the egress settings, and the fetch timeout, and attempts that could not
+// reach the source are retried (see Fetch). A conditional fetch returns
+// converter.ErrNotModified if the source has not been modified. Retries stop
+// once done is closed. The pre-fetch, and post-fetch hooks (see
+// converter.Hooks) run before, and after the source is fetched.
+func fetchSource(conf Config, s *statsd.Client, e egress, uri, ext string, v converter.Validators, done <-chan struct{}) (*converter.ConversionSource, error) {
+	client, err := e.client()
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = time.Second * time.Duration(conf.Fetch.Timeout)
+
+	p, err := converter.Hooks.Run(hooks.PreFetch, hooks.Payload{URL: uri})
+	if err != nil {
+		return nil, err
+	}
+	uri = p.URL
+
+	t := s.NewTiming()
+	delay := time.Millisecond * time.Duration(conf.Fetch.RetryDelay)
+	for attempt := 0; ; attempt++ {
+		source, err := converter.NewConditionalSource(uri, ext, client, v)
+		if err == nil || err == converter.ErrNotModified {
+			t.Send("fetch_duration")
+			if err == nil && converter.Hooks.Has(hooks.PostFetch) {
+				return postFetch(client, *source, ext)
+			}
+			return source, err
+		}
+		if ue, ok := err.(*url.Error); ok && ue.Timeout() {
+			s.Increment("fetch_timeout")
+		}
+		if !sourceFailed(err) || attempt >= conf.Fetch.Retries {
+			s.Increment("fetch_error")
+			return nil, err
+		}
+
+		s.Increment("fetch_retry")
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-done:
+			s.Increment("fetch_error")
+			return nil, err
+		}
+	}
+}
+
+// postFetch runs the post-fetch hooks on the body of a fetched source. The
+// body of a remote source is downloaded for them, and the transformed body is
+// converted as a local source, with a base URL if it is an HTML document, so
+// that its relative links still resolve.
+func postFetch(client *http.Client, source converter.ConversionSource, ext string) (*converter.ConversionSource, error) {
+	if source.IsLocal {
+		t, err := source.Transform(hooks.PostFetch)
+		if err != nil {
+			return nil, err
+		}
+		if t.URI != source.URI {
+			source.Remove()
+		}
+		return &t, nil
+	}
+
+	res, err := client.Get(source.URI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("fetching %s failed: %s", source.URI, res.Status)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	p, err := converter.Hooks.Run(hooks.PostFetch, hooks.Payload{URL: source.URI, ContentType: res.Header.Get("Content-Type"), Body: b})
+	if err != nil {
+		return nil, err
+	}
+	body := p.Body
+	if strings.HasPrefix(source.Mime, "text/html") {
+		body = withBase(body, p.URL)
+	}
+	t, err := converter.NewConversionSource("", bytes.NewReader(body), ext)
+	if err != nil {
+		return nil, err
+	}
+	t.OriginalURI, t.Validators = source.URI, source.Validators
+	return t, nil
+}
+
+var (
+	baseElement = regexp.MustCompile(`(?i)<base[\s>]`)
+	headElement = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+)
+
+// withBase adds a base element with a URL to an HTML document, unless it has
+// one.
+func withBase(doc []byte, uri string) []byte {
+	if baseElement.Match(doc) {
+		return doc
+	}
+	base := []byte(fmt.Sprintf(`<base href="%s">`, html.EscapeString(uri)))
+	if loc := headElement.FindIndex(doc); loc != nil {
+		return append(append(append([]byte{}, doc[:loc[1]]...), base...), doc[loc[1]:]...)
+	}
+	return append(base, doc...)
+}
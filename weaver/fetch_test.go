@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+func TestFetchSource(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			// Drop the connection, so that the fetch fails
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+	s, _ := statsd.New(statsd.Mute(true))
+
+	tests := []struct {
+		retries  int
+		ok       bool
+		attempts int
+	}{
+		{1, false, 2},
+		{2, true, 3},
+	}
+	for _, tt := range tests {
+		attempts = 0
+		conf := Config{Fetch: Fetch{Timeout: 5, Retries: tt.retries}}
+		source, err := fetchSource(conf, s, egress{}, ts.URL, "", converter.Validators{}, nil)
+		if got := err == nil; got != tt.ok {
+			t.Errorf("expected fetch with %d retries to succeed: %v, got %+v", tt.retries, tt.ok, err)
+		}
+		if tt.ok && source.URI != ts.URL {
+			t.Errorf("expected source URI to be %s, got %s", ts.URL, source.URI)
+		}
+		if got := attempts; got != tt.attempts {
+			t.Errorf("expected %d attempts with %d retries, got %d", tt.attempts, tt.retries, got)
+		}
+	}
+}
+
+func TestFetchSource_hooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>Report</title></head><body><img src=\"a.png\"></body></html>"))
+	}))
+	defer ts.Close()
+	s, _ := statsd.New(statsd.Mute(true))
+
+	p := hooks.New()
+	p.Register(hooks.PreFetch, hooks.HookFunc(func(pl hooks.Payload) (hooks.Payload, error) {
+		pl.URL = ts.URL + "/report"
+		return pl, nil
+	}))
+	p.Register(hooks.PostFetch, hooks.HookFunc(func(pl hooks.Payload) (hooks.Payload, error) {
+		pl.Body = bytes.Replace(pl.Body, []byte("Report"), []byte("Q1 report"), 1)
+		return pl, nil
+	}))
+	converter.Hooks = p
+	defer func() { converter.Hooks = nil }()
+
+	conf := Config{Fetch: Fetch{Timeout: 5}}
+	source, err := fetchSource(conf, s, egress{}, "https://example.com", "", converter.Validators{}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	defer source.Remove()
+	if !source.IsLocal || source.OriginalURI != ts.URL+"/report" {
+		t.Errorf("expected a local source of the rewritten URL, got %+v", source)
+	}
+	b, _ := ioutil.ReadFile(source.URI)
+	want := `<html><head><base href="` + ts.URL + `/report"><title>Q1 report</title></head>`
+	if !strings.HasPrefix(string(b), want) {
+		t.Errorf("expected the transformed source to start with %q, got %q", want, b)
+	}
+
+	failed := errors.New("blocked")
+	p.Register(hooks.PreFetch, hooks.HookFunc(func(pl hooks.Payload) (hooks.Payload, error) { return pl, failed }))
+	if _, err := fetchSource(conf, s, egress{}, "https://example.com", "", converter.Validators{}, nil); errorCode(err, 0) != CodeHookFailed {
+		t.Errorf("expected the hook to fail the fetch with %s, got %+v", CodeHookFailed, err)
+	}
+}
+
+func TestWithBase(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{"<html><HEAD lang=\"en\"><title>a</title>", "<html><HEAD lang=\"en\"><base href=\"https://example.com/?a=1&amp;b=2\"><title>a</title>"},
+		{"<p>a</p>", "<base href=\"https://example.com/?a=1&amp;b=2\"><p>a</p>"},
+		{"<head><base href=\"/\"></head>", "<head><base href=\"/\"></head>"},
+	}
+	for _, tt := range tests {
+		if got := string(withBase([]byte(tt.doc), "https://example.com/?a=1&b=2")); got != tt.want {
+			t.Errorf("expected %q with a base, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/fonts"
+)
+
+// listFontsHandler returns the fonts installed at runtime.
+func listFontsHandler(c *gin.Context) {
+	store := c.MustGet("fonts").(*fonts.Store)
+	list, err := store.List()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fonts": list})
+}
+
+// maxFontFormOverhead is the size of the multipart form of a font upload
+// allowed beyond the font limit (its headers, and boundaries).
+const maxFontFormOverhead = 64 << 10
+
+// installFontHandler installs an uploaded TTF, OTF, or TTC font, and
+// refreshes the font cache, so that it is used by subsequent conversions.
+// Fonts larger than the font limit are rejected before they are read in
+// full.
+func installFontHandler(c *gin.Context) {
+	store := c.MustGet("fonts").(*fonts.Store)
+
+	if store.MaxBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, store.MaxBytes+maxFontFormOverhead)
+	}
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithError(http.StatusRequestEntityTooLarge, fonts.ErrFontTooLarge).SetType(gin.ErrorTypePublic)
+			return
+		}
+		c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	defer file.Close()
+
+	f, err := store.Install(header.Filename, file)
+	switch err {
+	case nil:
+		c.JSON(http.StatusCreated, f)
+	case fonts.ErrFontInvalid, fonts.ErrFontName:
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+	case fonts.ErrFontTooLarge:
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+	default:
+		c.Error(err)
+	}
+}
+
+// removeFontHandler removes a font installed at runtime.
+func removeFontHandler(c *gin.Context) {
+	store := c.MustGet("fonts").(*fonts.Store)
+	switch err := store.Remove(c.Param("name")); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case fonts.ErrFontNotFound:
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+	default:
+		c.Error(err)
+	}
+}
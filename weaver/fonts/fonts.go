@@ -0,0 +1,157 @@
+// Package fonts installs fonts into the rendering environment at runtime.
+package fonts
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFontInvalid is returned when an uploaded file is not a TrueType, or
+	// OpenType font.
+	ErrFontInvalid = errors.New("invalid font provided (use a TTF, OTF, or TTC file)")
+	// ErrFontName is returned when a font file name is invalid.
+	ErrFontName = errors.New("invalid font name provided (use letters, digits, '-', '_', or '.')")
+	// ErrFontNotFound is returned when a font is not installed.
+	ErrFontNotFound = errors.New("font not found")
+	// ErrFontTooLarge is returned when a font is larger than the limit of
+	// the store.
+	ErrFontTooLarge = errors.New("font is larger than the font limit (WEAVER_FONTS_MAX_BYTES)")
+)
+
+// Font is an installed font file.
+type Font struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// fileName matches safe font file names.
+var fileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.(ttf|otf|ttc)$`)
+
+// Signatures of TrueType, OpenType, and TrueType collection files.
+var signatures = [][]byte{
+	{0x00, 0x01, 0x00, 0x00},
+	[]byte("true"),
+	[]byte("OTTO"),
+	[]byte("ttcf"),
+}
+
+// Store manages the fonts in a directory read by fontconfig.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+	// Refresh rebuilds the font cache after fonts are installed, or removed.
+	// It defaults to running 'fc-cache' on the directory.
+	Refresh func(dir string) error
+	// MaxBytes is the maximum size of a font, or 0 for no limit.
+	MaxBytes int64
+}
+
+// NewStore creates a store for a fonts directory, creating it if needed.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, Refresh: fcCache}, nil
+}
+
+func fcCache(dir string) error {
+	return exec.Command("fc-cache", "-f", dir).Run()
+}
+
+// Install writes a font to the store, replacing any font with the same name.
+// It returns ErrFontTooLarge if the font is larger than MaxBytes.
+func (s *Store) Install(name string, r io.Reader) (Font, error) {
+	name = strings.ToLower(name)
+	if !fileName.MatchString(name) {
+		return Font{}, ErrFontName
+	}
+	if s.MaxBytes > 0 {
+		r = io.LimitReader(r, s.MaxBytes+1)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Font{}, err
+	}
+	if s.MaxBytes > 0 && int64(len(b)) > s.MaxBytes {
+		return Font{}, ErrFontTooLarge
+	}
+	if !isFont(b) {
+		return Font{}, ErrFontInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := filepath.Join(s.dir, name)
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		return Font{}, err
+	}
+	if err := s.Refresh(s.dir); err != nil {
+		return Font{}, err
+	}
+	return stat(p)
+}
+
+// List returns the installed fonts ordered by name.
+func (s *Store) List() ([]Font, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	fonts := []Font{}
+	for _, fi := range infos {
+		if fi.Mode().IsRegular() && fileName.MatchString(fi.Name()) {
+			fonts = append(fonts, Font{Name: fi.Name(), Size: fi.Size(), Modified: fi.ModTime().UTC()})
+		}
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].Name < fonts[j].Name })
+	return fonts, nil
+}
+
+// Remove deletes an installed font.
+func (s *Store) Remove(name string) error {
+	name = strings.ToLower(name)
+	if !fileName.MatchString(name) {
+		return ErrFontNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrFontNotFound
+		}
+		return err
+	}
+	return s.Refresh(s.dir)
+}
+
+func isFont(b []byte) bool {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(b, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+func stat(p string) (Font, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return Font{}, err
+	}
+	return Font{Name: fi.Name(), Size: fi.Size(), Modified: fi.ModTime().UTC()}, nil
+}
@@ -0,0 +1,95 @@
+package fonts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var mockFont = append([]byte("OTTO"), make([]byte, 60)...)
+
+func mockStore(t *testing.T) (*Store, *int) {
+	dir, err := ioutil.TempDir("", "fonts")
+	if err != nil {
+		t.Fatalf("unable to create fonts directory: %+v", err)
+	}
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("unable to create store: %+v", err)
+	}
+	refreshed := new(int)
+	s.Refresh = func(string) error {
+		*refreshed++
+		return nil
+	}
+	return s, refreshed
+}
+
+func TestStore(t *testing.T) {
+	s, refreshed := mockStore(t)
+	defer os.RemoveAll(s.dir)
+
+	f, err := s.Install("Brand-Sans.OTF", bytes.NewReader(mockFont))
+	if err != nil {
+		t.Fatalf("unable to install font: %+v", err)
+	}
+	if got, want := f.Name, "brand-sans.otf"; got != want {
+		t.Errorf("expected font name to be %s, got %s", want, got)
+	}
+
+	fonts, err := s.List()
+	if err != nil {
+		t.Fatalf("unable to list fonts: %+v", err)
+	}
+	if got, want := len(fonts), 1; got != want {
+		t.Fatalf("expected %d font to be installed, got %d", want, got)
+	}
+	if got, want := fonts[0].Size, int64(len(mockFont)); got != want {
+		t.Errorf("expected font size to be %d, got %d", want, got)
+	}
+
+	if err := s.Remove("brand-sans.otf"); err != nil {
+		t.Fatalf("unable to remove font: %+v", err)
+	}
+	if err := s.Remove("brand-sans.otf"); err != ErrFontNotFound {
+		t.Errorf("expected error to be %+v, got %+v", ErrFontNotFound, err)
+	}
+	if got, want := *refreshed, 2; got != want {
+		t.Errorf("expected font cache to be refreshed %d times, got %d", want, got)
+	}
+}
+
+func TestStoreInstall_invalid(t *testing.T) {
+	s, _ := mockStore(t)
+	defer os.RemoveAll(s.dir)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"../../etc/fonts.ttf", mockFont, ErrFontName},
+		{"brand.woff", mockFont, ErrFontName},
+		{"brand.ttf", []byte("<html>"), ErrFontInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := s.Install(tt.name, bytes.NewReader(tt.data)); err != tt.err {
+			t.Errorf("expected installing %s to return %+v, got %+v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestStoreInstall_tooLarge(t *testing.T) {
+	s, _ := mockStore(t)
+	defer os.RemoveAll(s.dir)
+	s.MaxBytes = int64(len(mockFont))
+
+	if _, err := s.Install("brand.ttf", bytes.NewReader(mockFont)); err != nil {
+		t.Errorf("expected a font within the limit to be installed, got %+v", err)
+	}
+	large := append(append([]byte{}, mockFont...), 0)
+	if _, err := s.Install("large.ttf", bytes.NewReader(large)); err != ErrFontTooLarge {
+		t.Errorf("expected installing a font over the limit to return %+v, got %+v", ErrFontTooLarge, err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/fonts"
+)
+
+func mockFontsRouter(t *testing.T) (*gin.Engine, string) {
+	dir, err := ioutil.TempDir("", "fonts")
+	if err != nil {
+		t.Fatalf("unable to create fonts directory: %+v", err)
+	}
+	store, _ := fonts.NewStore(dir)
+	store.Refresh = func(string) error { return nil }
+	r := mockRouter(Config{}, Services{Fonts: store}, func(r *gin.Engine, _ Config, _ Services) {
+		r.GET("/admin/fonts", listFontsHandler)
+		r.POST("/admin/fonts", installFontHandler)
+		r.DELETE("/admin/fonts/:name", removeFontHandler)
+	})
+	return r, dir
+}
+
+func uploadFont(r *gin.Engine, name string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", name)
+	part.Write(data)
+	w.Close()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/fonts", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	r.ServeHTTP(res, req)
+	return res
+}
+
+func TestFontHandlers(t *testing.T) {
+	r, dir := mockFontsRouter(t)
+	defer os.RemoveAll(dir)
+
+	res := uploadFont(r, "NotoSansCJK.otf", append([]byte("OTTO"), make([]byte, 16)...))
+	if got, want := res.Code, http.StatusCreated; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/fonts", nil)
+	r.ServeHTTP(res, req)
+	var list struct {
+		Fonts []fonts.Font `json:"fonts"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unable to decode font list: %+v", err)
+	}
+	if len(list.Fonts) != 1 || list.Fonts[0].Name != "notosanscjk.otf" {
+		t.Errorf("expected installed font to be listed, got %+v", list.Fonts)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/admin/fonts/notosanscjk.otf", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusNoContent; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/admin/fonts/notosanscjk.otf", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusNotFound; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestInstallFontHandler_invalid(t *testing.T) {
+	r, dir := mockFontsRouter(t)
+	defer os.RemoveAll(dir)
+
+	res := uploadFont(r, "brand.ttf", []byte("<!DOCTYPE html>"))
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestInstallFontHandler_tooLarge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fonts")
+	if err != nil {
+		t.Fatalf("unable to create fonts directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := fonts.NewStore(dir)
+	store.Refresh = func(string) error { return nil }
+	store.MaxBytes = 1024
+	r := mockRouter(Config{}, Services{Fonts: store}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/admin/fonts", installFontHandler)
+	})
+
+	tests := []struct {
+		size int
+		code int
+	}{
+		// Over the limit, but within the form overhead
+		{2048, http.StatusRequestEntityTooLarge},
+		// Over the form overhead
+		{1 << 20, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		res := uploadFont(r, "large.ttf", append([]byte("true"), make([]byte, tt.size)...))
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of a %d bytes font to be %d, got %d", tt.size, tt.code, got)
+		}
+	}
+}
@@ -4,54 +4,243 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
+	"strings"
 	"syscall"
+	"time"
 )
 
 var (
 	ErrCmdTerminated = errors.New("command terminated")
+	// ErrUserNamespaceCredential is returned when a command is isolated in
+	// a user namespace without a credential to map.
+	ErrUserNamespaceCredential = errors.New("a user namespace requires the credential of the command")
+	// ErrUserNamespaceUnsupported is returned when a command is isolated in
+	// a user namespace on a system without them.
+	ErrUserNamespaceUnsupported = errors.New("user namespaces are only supported on Linux")
 )
 
+// MaxStderr is the maximum number of bytes of standard error retained from a
+// command. Only the last bytes are retained, as they usually contain the
+// cause of a failure.
+var MaxStderr = 64 * 1024
+
+// ExitError is returned when a command fails. It contains the exit code, and
+// the standard error of the command.
+type ExitError struct {
+	Err error
+	// ExitCode is the exit code of the command, or -1 if it did not exit
+	// normally (e.g. it could not be started, or it was killed by a signal).
+	ExitCode int
+	// Stderr is the standard error of the command (at most MaxStderr
+	// bytes).
+	Stderr string
+	// Truncated is true if the start of the standard error was discarded.
+	Truncated bool
+}
+
+func (e *ExitError) Error() string {
+	if e.Truncated {
+		return fmt.Sprintf("%+v : ...%+v", e.Err, e.Stderr)
+	}
+	return fmt.Sprintf("%+v : %+v", e.Err, e.Stderr)
+}
+
+// Tail returns at most the last n bytes of the standard error of the command.
+func (e *ExitError) Tail(n int) string {
+	if len(e.Stderr) <= n {
+		return e.Stderr
+	}
+	return e.Stderr[len(e.Stderr)-n:]
+}
+
+// tailWriter retains the last n bytes written to it.
+type tailWriter struct {
+	n         int
+	buf       []byte
+	truncated bool
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if over := len(w.buf) - w.n; over > 0 {
+		copy(w.buf, w.buf[over:])
+		w.buf = w.buf[:w.n]
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
+// lineWriter passes every complete line written to it to a function.
+type lineWriter struct {
+	f   func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		w.f(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Usage contains the resources used by an executed command.
+type Usage struct {
+	// CPUTime is the user, and system CPU time of the command.
+	CPUTime time.Duration
+}
+
 // Execute is a concurrent wrapper around Go's os/exec Output() method.
 // It runs a command, and returns its standard output as a byte slice.
 // If a long-running command is being executed, it can easily be killed at
 // any time using the terminate channel as the process is spawned in a
 // Goroutine.
 func Execute(c []string, terminate <-chan struct{}) ([]byte, error) {
+	out, _, err := ExecuteWithUsage(c, terminate)
+	return out, err
+}
+
+// ExecuteWithUsage is the same as Execute, but it also returns the resources
+// used by a successful command.
+func ExecuteWithUsage(c []string, terminate <-chan struct{}) ([]byte, Usage, error) {
+	return ExecuteWithEnv(c, nil, terminate)
+}
+
+// ExecuteWithEnv is the same as ExecuteWithUsage, but the command also
+// receives the environment variables in env ('KEY=value'), in addition to
+// the environment of the current process.
+func ExecuteWithEnv(c []string, env []string, terminate <-chan struct{}) ([]byte, Usage, error) {
+	return ExecuteWithStderr(c, env, nil, terminate)
+}
+
+// ExecuteWithStderr is the same as ExecuteWithEnv, but every line written to
+// the standard error of the command is also passed to the lines function (if
+// it is not nil) as it is written, e.g. to follow the progress of the
+// command.
+func ExecuteWithStderr(c []string, env []string, lines func(string), terminate <-chan struct{}) ([]byte, Usage, error) {
+	out := new(bytes.Buffer)
+	u, err := ExecuteToWriter(c, env, out, lines, terminate)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	return out.Bytes(), u, nil
+}
+
+// errWriter writes to w until it returns an error. The rest is discarded,
+// so that a command writing to it is not blocked.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// ExecuteToWriter is the same as ExecuteWithStderr, but the standard output
+// of the command is written to w as it is produced (e.g. to a file), instead
+// of being returned. If w returns an error, the rest of the output is
+// discarded, and the error is returned when the command exits.
+func ExecuteToWriter(c []string, env []string, w io.Writer, lines func(string), terminate <-chan struct{}) (Usage, error) {
+	return ExecuteIsolated(c, env, Isolation{}, w, lines, terminate)
+}
+
+// Isolation controls where, and as whom a command runs (see the sandbox
+// package). The zero value runs it in the working directory of the current
+// process, as its user.
+type Isolation struct {
+	// Dir is the working directory of the command.
+	Dir string
+	// Credential is the user, and group the command runs as (nil for the
+	// user of the current process, which must be privileged otherwise).
+	Credential *syscall.Credential
+	// UserNamespace runs the command in a new user namespace, where only
+	// its user, and group are mapped (Linux only).
+	UserNamespace bool
+	// Files are open files inherited by the command, as file descriptor 3
+	// onwards.
+	Files []*os.File
+	// Stdin is the standard input of the command. It has none if it is nil.
+	Stdin io.Reader
+}
+
+// ExecuteIsolated is the same as ExecuteToWriter, but the command runs with
+// an isolation. The command is started in its own process group, which is
+// killed as a whole if it is terminated.
+func ExecuteIsolated(c []string, env []string, iso Isolation, w io.Writer, lines func(string), terminate <-chan struct{}) (Usage, error) {
 	cmd := exec.Command(c[0], c[1:]...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Dir = iso.Dir
+	cmd.ExtraFiles = iso.Files
+	cmd.Stdin = iso.Stdin
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
+		Setpgid:    true,
+		Credential: iso.Credential,
 	}
-	cout := make(chan []byte, 1)
+	if iso.UserNamespace {
+		if err := userNamespace(cmd.SysProcAttr); err != nil {
+			return Usage{}, err
+		}
+	}
+	cout := make(chan struct{}, 1)
 	cerr := make(chan error, 1)
 
-	go func(cmd *exec.Cmd, cout chan<- []byte, cerr chan<- error) {
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-		out, err := cmd.Output()
+	go func(cmd *exec.Cmd, cout chan<- struct{}, cerr chan<- error) {
+		stdout := &errWriter{w: w}
+		cmd.Stdout = stdout
+		stderr := &tailWriter{n: MaxStderr}
+		cmd.Stderr = stderr
+		if lines != nil {
+			cmd.Stderr = io.MultiWriter(stderr, &lineWriter{f: lines})
+		}
+		err := cmd.Run()
 		if err != nil {
-			cerr <- fmt.Errorf("%+v : %+v", err, stderr.String())
+			code := -1
+			if cmd.ProcessState != nil {
+				code = cmd.ProcessState.ExitCode()
+			}
+			cerr <- &ExitError{Err: err, ExitCode: code, Stderr: string(stderr.buf), Truncated: stderr.truncated}
+			return
+		}
+		if stdout.err != nil {
+			cerr <- stdout.err
 			return
 		}
-		cout <- out
+		cout <- struct{}{}
 	}(cmd, cout, cerr)
 
 	select {
-	case out := <-cout:
+	case <-cout:
 		close(cerr)
-		return out, nil
+		u := Usage{CPUTime: cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()}
+		return u, nil
 	case err := <-cerr:
 		close(cout)
-		return nil, err
+		return Usage{}, err
 	case <-terminate:
 		log.Println("exiting")
 		// if (cmd.ProcessState == nil || cmd.ProcessState.Exited() == false) && cmd.Process != nil {
 		if cmd.Process != nil {
-			if err := cmd.Process.Kill(); err != nil {
-				return nil, err
+			// The processes started by the command (e.g. the renderer
+			// processes of Electron) are in its process group
+			if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+				return Usage{}, err
 			}
 		}
-		return nil, ErrCmdTerminated
+		return Usage{}, ErrCmdTerminated
 	}
 }
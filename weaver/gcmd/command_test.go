@@ -1,7 +1,9 @@
 package gcmd
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +46,116 @@ func TestExecute_done(t *testing.T) {
 		t.Errorf("expected output of executed command to be nil, got %+v", got)
 	}
 }
+
+func TestExecuteWithUsage(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	got, u, err := ExecuteWithUsage([]string{"echo", "test usage"}, mockTerminate)
+	if err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if want := []byte("test usage\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected output of executed command to be %+v, got %+v", want, got)
+	}
+	if u.CPUTime < 0 {
+		t.Errorf("expected CPU time of executed command to be positive, got %s", u.CPUTime)
+	}
+}
+
+func TestExecuteWithEnv(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	got, _, err := ExecuteWithEnv([]string{"sh", "-c", "echo $WEAVER_REQUEST_ID"}, []string{"WEAVER_REQUEST_ID=test-id"}, mockTerminate)
+	if err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if want := []byte("test-id\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected output of executed command to be %+v, got %+v", want, got)
+	}
+}
+
+func TestExecuteWithStderr(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	var got []string
+	_, _, err := ExecuteWithStderr([]string{"sh", "-c", "printf 'first\\nsec' >&2; printf 'ond\\n' >&2"}, nil, func(line string) {
+		got = append(got, line)
+	}, mockTerminate)
+	if err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected stderr lines to be %+v, got %+v", want, got)
+	}
+}
+
+// limitWriter fails once more than n bytes are written to it.
+type limitWriter struct {
+	n   int
+	buf []byte
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(w.buf)+len(p) > w.n {
+		return 0, errors.New("limit exceeded")
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func TestExecuteToWriter(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	w := &limitWriter{n: 1024}
+	if _, err := ExecuteToWriter([]string{"echo", "test execute"}, nil, w, nil, mockTerminate); err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if got, want := string(w.buf), "test execute\n"; got != want {
+		t.Errorf("expected output to be %q, got %q", want, got)
+	}
+}
+
+func TestExecuteIsolated_stdin(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	w := &limitWriter{n: 1024}
+	iso := Isolation{Stdin: strings.NewReader("test execute")}
+	if _, err := ExecuteIsolated([]string{"tr", "a-z", "A-Z"}, nil, iso, w, nil, mockTerminate); err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if got, want := string(w.buf), "TEST EXECUTE"; got != want {
+		t.Errorf("expected output to be %q, got %q", want, got)
+	}
+}
+
+func TestExecuteToWriter_err(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	// The command is not blocked by the failing writer
+	w := &limitWriter{n: 4}
+	_, err := ExecuteToWriter([]string{"head", "-c", "1000000", "/dev/zero"}, nil, w, nil, mockTerminate)
+	if err == nil || err.Error() != "limit exceeded" {
+		t.Errorf("expected the error of the writer, got %+v", err)
+	}
+}
+
+func TestExecute_exitError(t *testing.T) {
+	mockTerminate := make(chan struct{}, 1)
+	_, err := Execute([]string{"sh", "-c", "echo failed >&2; exit 3"}, mockTerminate)
+	e, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("expected an exit error, got %+v", err)
+	}
+	if got, want := e.ExitCode, 3; got != want {
+		t.Errorf("expected exit code to be %d, got %d", want, got)
+	}
+	if got, want := e.Tail(4), "led\n"; got != want {
+		t.Errorf("expected stderr tail to be %q, got %q", want, got)
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	w := &tailWriter{n: 4}
+	w.Write([]byte("abc"))
+	w.Write([]byte("defg"))
+	if got, want := string(w.buf), "defg"; got != want {
+		t.Errorf("expected retained output to be %q, got %q", want, got)
+	}
+	if !w.truncated {
+		t.Errorf("expected retained output to be truncated")
+	}
+}
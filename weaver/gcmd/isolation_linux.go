@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package gcmd
+
+import "syscall"
+
+// userNamespace sets the attributes of a command started in a new user
+// namespace, where only the user, and group of its credential are mapped.
+func userNamespace(attr *syscall.SysProcAttr) error {
+	if attr.Credential == nil {
+		return ErrUserNamespaceCredential
+	}
+	uid, gid := int(attr.Credential.Uid), int(attr.Credential.Gid)
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	// Supplementary groups cannot be set without mapping them
+	attr.Credential.NoSetGroups = true
+	return nil
+}
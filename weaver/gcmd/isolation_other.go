@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package gcmd
+
+import "syscall"
+
+// userNamespace returns ErrUserNamespaceUnsupported, as user namespaces are
+// only supported by Linux.
+func userNamespace(attr *syscall.SysProcAttr) error {
+	return ErrUserNamespaceUnsupported
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/getsentry/raven-go"
 	"github.com/gin-gonic/gin"
 	"github.com/lachee/athenapdf/weaver/converter"
 	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
 	"github.com/lachee/athenapdf/weaver/converter/cloudconvert"
+	"github.com/lachee/athenapdf/weaver/email"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/sanitize"
+	"github.com/lachee/athenapdf/weaver/spool"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/lachee/athenapdf/weaver/tus"
+	"github.com/satori/go.uuid"
 	"gopkg.in/alexcesaro/statsd.v2"
 )
 
@@ -22,8 +39,77 @@ var (
 	ErrURLInvalid = errors.New("invalid URL provided")
 	// ErrFileInvalid should be returned when a conversion file is invalid.
 	ErrFileInvalid = errors.New("invalid file provided")
+	// ErrAsyncUnavailable should be returned when an asynchronous conversion
+	// is requested, but the clustered mode is disabled.
+	ErrAsyncUnavailable = errors.New("asynchronous conversions are not enabled")
+	// ErrAsyncNoUpload should be returned when an asynchronous conversion is
+	// requested without an S3 destination.
+	ErrAsyncNoUpload = errors.New("asynchronous conversions require an S3 bucket, and key (or s3_dedupe)")
+	// ErrIncludeSourceNoUpload should be returned when the rendered source is
+	// requested for a conversion without an S3 destination.
+	ErrIncludeSourceNoUpload = errors.New("includeSource requires an S3 bucket, and key (or s3_dedupe)")
+	// ErrIncludeArchiveNoUpload should be returned when the WARC archive of
+	// the render is requested for a conversion without an S3 destination.
+	ErrIncludeArchiveNoUpload = errors.New("includeArchive requires an S3 bucket, and key (or s3_dedupe)")
+	// ErrSinglePageFormat should be returned when a single page output is
+	// requested for an output format other than PDF, or TIFF.
+	ErrSinglePageFormat = errors.New("single_page is only supported by the PDF, and TIFF formats")
+	// ErrLinkBaseInvalid should be returned when the base URL of relative
+	// links is not an absolute HTTP, or HTTPS URL.
+	ErrLinkBaseInvalid = errors.New("invalid link base provided (link_base, use an absolute http, or https URL)")
+	// ErrSelectInvalid should be returned when the selector of the elements
+	// to print is not a CSS selector that can be inserted in a script.
+	ErrSelectInvalid = errors.New("invalid selector provided (select)")
+	// ErrBreakSelectorInvalid should be returned when a page break selector
+	// is not a CSS selector that can be inserted in a stylesheet.
+	ErrBreakSelectorInvalid = errors.New("invalid selector provided (avoid_break, break_before, or break_after)")
+	// ErrClientClosed is recorded when a client closes its connection before
+	// a conversion has finished.
+	ErrClientClosed = errors.New("client closed the connection")
+	// ErrFormatInvalid should be returned when an unsupported output format
+	// is requested.
+	ErrFormatInvalid = errors.New("invalid format provided (use pdf, text, markdown, mhtml, html, or png)")
+	// ErrChromeFlagNotAllowed should be returned when a renderer flag is
+	// requested that is not in the operator's allowlist.
+	ErrChromeFlagNotAllowed = errors.New("chrome flag not allowed")
+	// ErrBlockTypeInvalid should be returned when an unsupported resource
+	// type is requested to be blocked.
+	ErrBlockTypeInvalid = errors.New("invalid block type provided (use ads, trackers, fonts, images, media, or scripts)")
+	// ErrOfflineURL should be returned when the offline mode is requested
+	// for a URL conversion.
+	ErrOfflineURL = errors.New("offline mode is only supported for uploaded documents")
+	// ErrLocaleInvalid should be returned when an invalid locale (language
+	// tag) is requested.
+	ErrLocaleInvalid = errors.New("invalid locale provided (use a language tag, e.g. en-GB)")
+	// ErrTimezoneInvalid should be returned when an unknown timezone is
+	// requested.
+	ErrTimezoneInvalid = errors.New("invalid timezone provided (use an IANA timezone, e.g. Europe/London)")
+	// ErrMarginsInvalid should be returned when unsupported page margins are
+	// requested.
+	ErrMarginsInvalid = errors.New("invalid margins provided (use standard, none, or minimal)")
+	// ErrMediaInvalid should be returned when an unsupported CSS media type
+	// is requested.
+	ErrMediaInvalid = errors.New("invalid media type provided (use print, or screen)")
+	// ErrDelayInvalid should be returned when the requested delay before
+	// saving a page is not a number of milliseconds within the limit.
+	ErrDelayInvalid = errors.New("invalid delay provided (use 0-10000 milliseconds)")
+	// ErrRasterDPIInvalid should be returned when the requested raster
+	// resolution is not a number of DPI within the limits.
+	ErrRasterDPIInvalid = errors.New("invalid raster resolution provided (use 96-600 DPI)")
+	// ErrDPIInvalid should be returned when the requested output resolution
+	// is not a number of DPI within the limits.
+	ErrDPIInvalid = errors.New("invalid resolution provided (use 96-600 DPI)")
+	// ErrPageSizeInvalid should be returned when the requested page size is
+	// not supported by athenapdf CLI.
+	ErrPageSizeInvalid = errors.New("invalid page size provided (use A3, A4, A5, Legal, Letter, or Tabloid)")
 )
 
+// maxDelay is the maximum delay (in milliseconds) before saving a page.
+const maxDelay = 10000
+
+// languageTag matches BCP 47 language tags (loosely).
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
 // indexHandler returns a JSON string indicating that the microservice is online.
 // It does not actually check if conversions are working. It is nevertheless,
 // used for monitoring.
@@ -42,106 +128,897 @@ func statsHandler(c *gin.Context) {
 	})
 }
 
-func conversionHandler(c *gin.Context, source converter.ConversionSource) {
-	// GC if converting temporary file
-	if source.IsLocal {
-		defer os.Remove(source.URI)
+// publisher returns the lifecycle event publisher from the context, which
+// accounts events to the tenant of the request, or nil if lifecycle events
+// are disabled.
+func publisher(c *gin.Context) events.Publisher {
+	if p, ok := c.Get("events"); ok {
+		return events.WithTenant(p.(events.Publisher), tenantID(c))
+	}
+	return nil
+}
+
+// tracker returns the job progress tracker from the context, or nil if job
+// progress is not tracked.
+func tracker(c *gin.Context) *progress.Tracker {
+	if t, ok := c.Get("progress"); ok {
+		return t.(*progress.Tracker)
+	}
+	return nil
+}
+
+// newJob assigns a new job ID to the request, and publishes a received event.
+func newJob(c *gin.Context, source string) string {
+	id := uuid.NewV4().String()
+	c.Set("job", id)
+	c.Set("source", source)
+	addBreadcrumb(c, "conversion", "received", map[string]interface{}{"job": id})
+	events.Emit(publisher(c), events.Received, id, source, nil)
+	return id
+}
+
+// tenantID returns the ID of the tenant of the request, or an empty string if
+// multi-tenancy is disabled or the admin key is used.
+func tenantID(c *gin.Context) string {
+	if t, ok := c.Get("tenant"); ok {
+		return t.(tenant.Tenant).ID
+	}
+	return ""
+}
+
+// s3Metadata returns the metadata stored with an uploaded output, so that it
+// can be traced back to the request with the ID.
+func s3Metadata(requestID string) map[string]string {
+	if requestID == "" {
+		return nil
+	}
+	return map[string]string{"request-id": requestID}
+}
+
+// recordUsage accounts a successful conversion to the tenant of the request.
+func recordUsage(c *gin.Context, report *converter.Report) {
+	a, ok := c.Get("usage")
+	id := tenantID(c)
+	if !ok || id == "" {
+		return
+	}
+	a.(*tenant.Accountant).Record(id, time.Now(), report.Pages, report.Bytes, report.CPUTime)
+}
+
+// setReportHeaders sets the metadata of a finished conversion as response
+// headers. Durations are in milliseconds.
+func setReportHeaders(c *gin.Context, r *converter.Report) {
+	c.Header("X-Conversion-Duration", strconv.FormatInt(int64(r.Duration/time.Millisecond), 10))
+	c.Header("X-Queue-Wait", strconv.FormatInt(int64(r.QueueWait/time.Millisecond), 10))
+	c.Header("X-Page-Count", strconv.Itoa(r.Pages))
+	c.Header("X-Output-Bytes", strconv.Itoa(r.Bytes))
+	c.Header("X-Output-SHA256", r.SHA256)
+}
+
+// awsCredentials returns the AWS credentials of a request, defaulting to the
+// configured S3 credentials (if any).
+func awsCredentials(c *gin.Context) (string, string) {
+	id, secret := c.Query("aws_id"), c.Query("aws_secret")
+	if id == "" && secret == "" {
+		conf := c.MustGet("config").(Config)
+		return conf.S3.AccessKey, conf.S3.AccessSecret
+	}
+	return id, secret
+}
+
+// requestAWSS3 returns the S3 destination of a request for an output format,
+// and sets the uploaded object in the context (see RecordJobMiddleware). Its
+// retention period must have been checked (see checkRetention).
+func requestAWSS3(c *gin.Context, format string) converter.AWSS3 {
+	awsID, awsSecret := awsCredentials(c)
+	days, _ := retentionDays(c)
+	awsConf := converter.AWSS3{
+		Region:        c.Query("aws_region"),
+		AccessKey:     awsID,
+		AccessSecret:  awsSecret,
+		S3Bucket:      c.Query("s3_bucket"),
+		S3Key:         c.Query("s3_key"),
+		S3Acl:         c.Query("s3_acl"),
+		ContentType:   athenapdf.ContentTypes[format],
+		Metadata:      s3Metadata(c.GetString("request_id")),
+		Object:        new(converter.S3Object),
+		RetentionDays: days,
+	}
+	_, awsConf.ContentAddressed = c.GetQuery("s3_dedupe")
+	c.Set("s3_object", awsConf.Object)
+	return awsConf
+}
+
+// uploadedResponse returns the response to a conversion uploaded to S3.
+func uploadedResponse(c *gin.Context, o *converter.S3Object) gin.H {
+	conf := c.MustGet("config").(Config)
+	res := gin.H{
+		"status":   "uploaded",
+		"key":      o.Key,
+		"existing": o.Existing,
+	}
+	objectURLs(conf, res, o)
+	if o.Source != nil {
+		source := gin.H{"key": o.Source.Key}
+		objectURLs(conf, source, o.Source)
+		res["source"] = source
+	}
+	if o.Archive != nil {
+		archive := gin.H{"key": o.Archive.Key}
+		objectURLs(conf, archive, o.Archive)
+		res["archive"] = archive
+	}
+	if !o.Expires.IsZero() {
+		res["expires_at"] = o.Expires
+	}
+	return res
+}
+
+// queryFlag returns true if a flag is set in the query string, unless it is
+// set to 'false', or '0'.
+func queryFlag(c *gin.Context, key string) bool {
+	v, ok := c.GetQuery(key)
+	return ok && v != "false" && v != "0"
+}
+
+// includeSource returns true if the rendered source (DOM) of a conversion
+// should be stored next to its output ('includeSource').
+func includeSource(c *gin.Context) bool {
+	return queryFlag(c, "includeSource")
+}
+
+// checkIncludeSource checks that the output of a conversion that includes its
+// source is uploaded to S3, as the source is stored next to it.
+func checkIncludeSource(c *gin.Context) error {
+	if includeSource(c) && !uploaded(c) {
+		return ErrIncludeSourceNoUpload
+	}
+	return nil
+}
+
+// includeArchive returns true if the network requests, and responses of the
+// render of a conversion should be recorded as a WARC archive, stored next
+// to its output ('includeArchive').
+func includeArchive(c *gin.Context) bool {
+	return queryFlag(c, "includeArchive")
+}
+
+// checkIncludeArchive checks that the output of a conversion that includes
+// its archive is uploaded to S3, as the archive is stored next to it.
+func checkIncludeArchive(c *gin.Context) error {
+	if includeArchive(c) && !uploaded(c) {
+		return ErrIncludeArchiveNoUpload
+	}
+	return nil
+}
+
+// uploaded returns true if the output of a conversion is uploaded to S3.
+func uploaded(c *gin.Context) bool {
+	_, dedupe := c.GetQuery("s3_dedupe")
+	return c.Query("s3_bucket") != "" && (c.Query("s3_key") != "" || dedupe)
+}
+
+// singlePage returns true if the output should be a single page, as long as
+// the rendered page ('single_page').
+func singlePage(c *gin.Context) bool {
+	return queryFlag(c, "single_page")
+}
+
+// pageBreaks returns the CSS selectors of the elements to avoid page breaks
+// inside of, and to break pages before, and after ('avoid_break',
+// 'break_before', and 'break_after').
+func pageBreaks(c *gin.Context) (avoid, before, after []string, err error) {
+	avoid, before, after = c.QueryArray("avoid_break"), c.QueryArray("break_before"), c.QueryArray("break_after")
+	for _, selectors := range [][]string{avoid, before, after} {
+		for _, s := range selectors {
+			if !validSelector(s) {
+				return nil, nil, nil, ErrBreakSelectorInvalid
+			}
+		}
+	}
+	return avoid, before, after, nil
+}
+
+// validSelector returns true if a CSS selector cannot end the rule it is
+// inserted in.
+func validSelector(s string) bool {
+	if strings.TrimSpace(s) == "" || len(s) > 256 {
+		return false
+	}
+	return !strings.ContainsAny(s, "{};@<") && !strings.Contains(s, "/*")
+}
+
+// linkOptions returns the base URL relative links are resolved against
+// ('link_base'), and whether links leaving the page are removed
+// ('strip_external_links').
+func linkOptions(c *gin.Context) (string, bool, error) {
+	base := c.Query("link_base")
+	if base != "" {
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", false, ErrLinkBaseInvalid
+		}
+	}
+	return base, queryFlag(c, "strip_external_links"), nil
+}
+
+// checkLinks checks the link options of a request.
+func checkLinks(c *gin.Context) error {
+	_, _, err := linkOptions(c)
+	return err
+}
+
+// checkSelect checks the selector of the elements to print ('select').
+func checkSelect(c *gin.Context) error {
+	if s, ok := c.GetQuery("select"); ok && !validSelector(s) {
+		return ErrSelectInvalid
+	}
+	return nil
+}
+
+// checkPageBreaks checks the page break selectors of a request.
+func checkPageBreaks(c *gin.Context) error {
+	_, _, _, err := pageBreaks(c)
+	return err
+}
+
+// checkSinglePage checks that the output of a conversion can be a single
+// page.
+func checkSinglePage(c *gin.Context) error {
+	if !singlePage(c) {
+		return nil
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF && format != athenapdf.FormatTIFF {
+		return ErrSinglePageFormat
+	}
+	return nil
+}
+
+// outputFormat returns the requested output format, defaulting to PDF.
+func outputFormat(c *gin.Context) (string, error) {
+	f := strings.ToLower(c.DefaultQuery("format", athenapdf.FormatPDF))
+	if _, ok := athenapdf.ContentTypes[f]; !ok {
+		return "", ErrFormatInvalid
+	}
+	return f, nil
+}
+
+// chromeFlags returns the renderer flags requested with 'chrome_flag'.
+// Flags must be allowed by the configuration.
+func chromeFlags(c *gin.Context) ([]string, error) {
+	conf := c.MustGet("config").(Config)
+	var flags []string
+	for _, f := range c.QueryArray("chrome_flag") {
+		f = strings.TrimLeft(f, "-")
+		if !conf.Chrome.Allowed(f) {
+			return nil, ErrChromeFlagNotAllowed
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// blockedResources returns the resource types, and URL patterns requested
+// to be blocked with 'block', and 'block_url'.
+func blockedResources(c *gin.Context) ([]string, []string, error) {
+	types := c.QueryArray("block")
+	for _, t := range types {
+		if !validBlockType(t) {
+			return nil, nil, ErrBlockTypeInvalid
+		}
+	}
+	return types, c.QueryArray("block_url"), nil
+}
+
+func validBlockType(t string) bool {
+	for _, valid := range athenapdf.BlockTypes {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// localeOptions returns the locale, and timezone requested with 'locale', and
+// 'timezone'.
+func localeOptions(c *gin.Context) (string, string, error) {
+	locale, timezone := c.Query("locale"), c.Query("timezone")
+	if locale != "" && !languageTag.MatchString(locale) {
+		return "", "", ErrLocaleInvalid
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return "", "", ErrTimezoneInvalid
+		}
+	}
+	return locale, timezone, nil
+}
+
+// layoutOptions returns the page margins, CSS media type, and delay (in
+// milliseconds) before saving the page requested with 'margins', 'media',
+// and 'delay'.
+func layoutOptions(c *gin.Context) (string, string, int, error) {
+	margins, media := strings.ToLower(c.Query("margins")), strings.ToLower(c.Query("media"))
+	switch margins {
+	case "", "standard", "none", "minimal":
+	default:
+		return "", "", 0, ErrMarginsInvalid
+	}
+	switch media {
+	case "", "print", "screen":
+	default:
+		return "", "", 0, ErrMediaInvalid
+	}
+	var delay int
+	if d := c.Query("delay"); d != "" {
+		var err error
+		if delay, err = strconv.Atoi(d); err != nil || delay < 0 || delay > maxDelay {
+			return "", "", 0, ErrDelayInvalid
+		}
+	}
+	return margins, media, delay, nil
+}
+
+// fidelityOptions returns the resolution content rasterized while printing
+// is rendered at, and whether canvases, and videos are replaced with images,
+// requested with 'raster_dpi', and 'snapshot_media'.
+func fidelityOptions(c *gin.Context) (int, bool, error) {
+	var dpi int
+	if d := c.Query("raster_dpi"); d != "" {
+		var err error
+		if dpi, err = strconv.Atoi(d); err != nil || dpi < 96 || dpi > 600 {
+			return 0, false, ErrRasterDPIInvalid
+		}
+	}
+	return dpi, queryFlag(c, "snapshot_media"), nil
+}
+
+// outputDPI returns the resolution of the output requested with 'dpi' (see
+// athenapdf.AthenaPDF.DPI), or 0.
+func outputDPI(c *gin.Context) (int, error) {
+	d := c.Query("dpi")
+	if d == "" {
+		return 0, nil
+	}
+	dpi, err := strconv.Atoi(d)
+	if err != nil || dpi < 96 || dpi > 600 {
+		return 0, ErrDPIInvalid
+	}
+	return dpi, nil
+}
+
+// checkPageSize validates the page size requested with 'page_size'. athenapdf
+// CLI falls back to A4 for page sizes it does not support.
+func checkPageSize(c *gin.Context) error {
+	size := c.Query("page_size")
+	if size == "" {
+		return nil
+	}
+	for _, s := range athenapdf.PageSizes {
+		if strings.EqualFold(size, s) {
+			return nil
+		}
+	}
+	return ErrPageSizeInvalid
+}
+
+// offline returns true if a local source should be rendered without network
+// access, as requested with 'offline', or enforced by the configuration.
+func offline(c *gin.Context, source converter.ConversionSource) bool {
+	conf := c.MustGet("config").(Config)
+	_, requested := c.GetQuery("offline")
+	return source.IsLocal && (requested || conf.OfflineUploads)
+}
+
+// sanitizePolicy returns the name of the sanitization policy for uploads of
+// the request, or an empty string if uploads are not sanitized.
+func sanitizePolicy(c *gin.Context) string {
+	if t, ok := c.Get("tenant"); ok && t.(tenant.Tenant).Sanitize != "" {
+		return t.(tenant.Tenant).Sanitize
+	}
+	return c.MustGet("config").(Config).SanitizePolicy
+}
+
+// sanitizeUpload sanitizes an uploaded HTML document using the policy of the
+// request. Other documents are returned as is.
+func sanitizeUpload(c *gin.Context, r io.Reader) (io.Reader, error) {
+	name := sanitizePolicy(c)
+	if name == "" {
+		return r, nil
+	}
+	p, err := sanitize.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	// Only the start of the document is needed to determine its type, so
+	// other documents are streamed to the spool as is
+	br := bufio.NewReader(r)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	ext := strings.ToLower(c.Query("ext"))
+	if ext != "html" && ext != "htm" && !strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		return br, nil
+	}
+	b, err := p.HTML(br)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// optionChecks validate the conversion options of a request (see
+// checkOptions).
+var optionChecks = []func(*gin.Context) error{
+	func(c *gin.Context) error { _, err := outputFormat(c); return err },
+	func(c *gin.Context) error { _, err := chromeFlags(c); return err },
+	func(c *gin.Context) error { _, _, err := blockedResources(c); return err },
+	func(c *gin.Context) error { _, _, err := localeOptions(c); return err },
+	func(c *gin.Context) error { _, _, _, err := layoutOptions(c); return err },
+	func(c *gin.Context) error { _, _, err := fidelityOptions(c); return err },
+	func(c *gin.Context) error { _, err := outputDPI(c); return err },
+	checkPageSize,
+	func(c *gin.Context) error { _, err := requestEgress(c); return err },
+	checkIncludeSource,
+	checkIncludeArchive,
+	checkAttachments,
+	func(c *gin.Context) error { _, err := emailAttachments(c); return err },
+	checkOCR,
+	checkColor,
+	checkTIFF,
+	checkSinglePage,
+	checkPageBreaks,
+	checkSelect,
+	checkLinks,
+	checkCodes,
+	checkRetention,
+	checkRedact,
+	checkSubject,
+	func(c *gin.Context) error { _, err := notifyTargets(c); return err },
+}
+
+// checkOptions validates the conversion options of a request. It returns the
+// first invalid option.
+func checkOptions(c *gin.Context) error {
+	for _, check := range optionChecks {
+		if err := check(c); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// athenaConversion returns the athenapdf CLI conversion of a source to the
+// given format, with the options of the request. The options must have been
+// checked (see checkOptions).
+func athenaConversion(c *gin.Context, source converter.ConversionSource, format string) athenapdf.AthenaPDF {
+	conf := c.MustGet("config").(Config)
 
 	_, aggressive := c.GetQuery("aggressive")
 	_, waitForStatus := c.GetQuery("waitForStatus")
 	_, noPortrait := c.GetQuery("no_portrait")
-	pageSize := c.Query("page_size")
+	margins, media, delay, _ := layoutOptions(c)
+	rasterDPI, snapshotMedia, _ := fidelityOptions(c)
+	dpi, _ := outputDPI(c)
+	avoidBreak, breakBefore, breakAfter, _ := pageBreaks(c)
+	linkBase, stripLinks, _ := linkOptions(c)
+	flags, _ := chromeFlags(c)
+	block, blockURLs, _ := blockedResources(c)
+	block, blockURLs = conf.Blocking.With(block, blockURLs)
+	locale, timezone, _ := localeOptions(c)
+	e, _ := requestEgress(c)
+	redactions, _ := redaction(c)
+	redact, redactPatterns := redactOptions(conf, redactions)
+
+	return athenapdf.AthenaPDF{
+		CMD: conf.AthenaCMD,
+		// Text, and Markdown are extracted from the readable content of the page
+		Aggressive:     aggressive || athenapdf.Readable(format),
+		WaitForStatus:  waitForStatus,
+		NoPortrait:     noPortrait,
+		PageSize:       c.Query("page_size"),
+		Margins:        margins,
+		Media:          media,
+		Delay:          delay,
+		RasterDPI:      rasterDPI,
+		SnapshotMedia:  snapshotMedia,
+		DPI:            dpi,
+		SinglePage:     singlePage(c),
+		Select:         c.Query("select"),
+		LinkBase:       linkBase,
+		StripLinks:     stripLinks,
+		Redact:         redact,
+		RedactPatterns: redactPatterns,
+		RepeatHeaders:  queryFlag(c, "repeat_table_headers"),
+		AvoidBreak:     avoidBreak,
+		BreakBefore:    breakBefore,
+		BreakAfter:     breakAfter,
+		Format:         format,
+		Flags:          append(conf.Chrome.FlagsWith(flags), e.flags()...),
+		Proxy:          e.proxy,
+		Block:          block,
+		BlockURLs:      blockURLs,
+		Offline:        offline(c, source),
+		Locale:         locale,
+		Timezone:       timezone,
+		RequestID:      c.GetString("request_id"),
+	}
+}
+
+func conversionHandler(c *gin.Context, source converter.ConversionSource) {
+	// GC if converting temporary file
+	defer source.Remove()
+
+	format, _ := outputFormat(c)
 
 	conf := c.MustGet("config").(Config)
 	wq := c.MustGet("queue").(chan<- converter.Work)
 	s := c.MustGet("statsd").(*statsd.Client)
-	r, ravenOk := c.Get("sentry")
+	p := publisher(c)
+	id := c.GetString("job")
 
 	t := s.NewTiming()
 
-	awsConf := converter.AWSS3{
-		c.Query("aws_region"),
-		c.Query("aws_id"),
-		c.Query("aws_secret"),
-		c.Query("s3_bucket"),
-		c.Query("s3_key"),
-		c.Query("s3_acl"),
-	}
+	awsConf := requestAWSS3(c, format)
 
 	var conversion converter.Converter
 	var work converter.Work
+	var engine string
 	attempts := 0
+	report := new(converter.Report)
+	c.Set("report", report)
 
 	baseConversion := converter.Conversion{}
-	uploadConversion := converter.UploadConversion{baseConversion, awsConf}
+	uploadConversion := converter.UploadConversion{Conversion: baseConversion, AWSS3: awsConf}
 
 StartConversion:
-	conversion = athenapdf.AthenaPDF{uploadConversion, conf.AthenaCMD, aggressive, waitForStatus, noPortrait, pageSize}
+	engine = "athenapdf"
+	athena := athenaConversion(c, source, format)
+	athena.UploadConversion = uploadConversion
+	athena.Report = report
+	if includeSource(c) {
+		athena.DOM = new(bytes.Buffer)
+	}
+	if includeArchive(c) {
+		athena.Archive = new(bytes.Buffer)
+	}
+	athena.Append = appendedDocuments(c)
+	athena.Overlays, _ = requestCodes(c)
+	athena.Attachments, _ = requestAttachments(c)
+	athena.AttachSource = attachSource(c)
+	athena.OCR, _ = requestOCR(c)
+	athena.Recolor, _ = requestRecolor(c)
+	athena.TIFF = newTIFF(conf, format)
+	conversion = athena
 	if attempts != 0 {
 		cc := cloudconvert.Client{
-			conf.CloudConvert.APIUrl,
-			conf.CloudConvert.APIKey,
-			time.Second * time.Duration(conf.WorkerTimeout+5),
+			BaseURL: conf.CloudConvert.APIUrl,
+			APIKey:  conf.CloudConvert.APIKey,
+			Timeout: time.Second * time.Duration(conf.WorkerTimeout+5),
 		}
-		conversion = cloudconvert.CloudConvert{uploadConversion, cc}
+		engine = "cloudconvert"
+		conversion = cloudconvert.CloudConvert{UploadConversion: uploadConversion, Client: cc}
 	}
-	work = converter.NewWork(wq, conversion, source)
+	c.Set("engine", engine)
+	work = converter.NewWorkWithProgress(wq, conversion, source, conversionProgress(s, nil, "", ""))
+	m := newConversionStats(s, conf, c.Request.URL.Path, engine, format, tenantID(c))
+	if tp, ok := c.Get("throughput"); ok {
+		m.throughput = tp.(*Throughput)
+	}
+	started := time.Now()
+	addBreadcrumb(c, "conversion", "queued", map[string]interface{}{"engine": engine})
+	events.Emit(p, events.Queued, id, source.GetActualURI(), nil)
+	emitStarted(p, work, id, source.GetActualURI())
 
 	select {
 	case <-c.Writer.CloseNotify():
 		work.Cancel()
+		m.record(OutcomeClientClosed, time.Since(started))
+		events.Emit(p, events.Failed, id, source.GetActualURI(), ErrClientClosed)
 	case <-work.Uploaded():
 		t.Send("conversion_duration")
 		s.Increment("success")
-		c.JSON(200, gin.H{"status": "uploaded"})
+		recordSource(c, false)
+		m.record(OutcomeUploaded, time.Since(started))
+		events.EmitOutput(p, events.Completed, id, source.GetActualURI(), report.Pages, report.Bytes)
+		events.EmitOutput(p, events.Uploaded, id, source.GetActualURI(), report.Pages, report.Bytes)
+		cacheOutput(outputCache(c), c.GetString("output_cache_key"), tenantID(c), c.Query("subject"), source, work.Output(), report.Pages)
+		report.Time(work)
+		recordUsage(c, report)
+		setReportHeaders(c, report)
+		notifyOutput(c, format, work.Output(), report, awsConf.Object)
+		c.JSON(200, uploadedResponse(c, awsConf.Object))
 	case out := <-work.Success():
 		t.Send("conversion_duration")
 		s.Increment("success")
-		c.Data(200, "application/pdf", out)
+		recordSource(c, false)
+		m.record(OutcomeSuccess, time.Since(started))
+		// Converters without reporting support (e.g. CloudConvert)
+		if report.Bytes == 0 {
+			report.Fill(out)
+		}
+		events.EmitOutput(p, events.Completed, id, source.GetActualURI(), report.Pages, report.Bytes)
+		cacheOutput(outputCache(c), c.GetString("output_cache_key"), tenantID(c), c.Query("subject"), source, out, report.Pages)
+		report.Time(work)
+		recordUsage(c, report)
+		setReportHeaders(c, report)
+		notifyOutput(c, format, out, report, nil)
+		sendOutput(c, athenapdf.ContentTypes[format], out, report.SHA256)
 	case err := <-work.Error():
 		// log.Println(err)
 
 		// Log, and stats collection
 		if err == converter.ErrConversionTimeout {
 			s.Increment("conversion_timeout")
+			recordSource(c, true)
+			m.record(OutcomeTimeout, time.Since(started))
+			addBreadcrumb(c, "conversion", "timed out", map[string]interface{}{"engine": engine})
 		} else if _, awsError := err.(awserr.Error); awsError {
 			s.Increment("s3_upload_error")
-			if ravenOk {
-				r.(*raven.Client).CaptureError(err, map[string]string{"url": source.GetActualURI()})
-			}
+			m.record(OutcomeUploadError, time.Since(started))
+			captureError(c, err, source.GetActualURI(), engine, &work)
 		} else {
 			s.Increment("conversion_error")
-			if ravenOk {
-				r.(*raven.Client).CaptureError(err, map[string]string{"url": source.GetActualURI()})
-			}
+			m.record(OutcomeError, time.Since(started))
+			captureError(c, err, source.GetActualURI(), engine, &work)
 		}
 
-		if attempts == 0 && conf.ConversionFallback {
+		// CloudConvert only supports PDF output, and it cannot redact the
+		// page
+		if attempts == 0 && conf.ConversionFallback && format == athenapdf.FormatPDF && len(athena.Redact)+len(athena.RedactPatterns) == 0 {
 			s.Increment("cloudconvert")
+			addBreadcrumb(c, "conversion", "falling back to CloudConvert", nil)
 			log.Println("falling back to CloudConvert...")
 			attempts++
 			goto StartConversion
 		}
 
 		s.Increment("conversion_failed")
+		events.Emit(p, events.Failed, id, source.GetActualURI(), err)
 
 		if err == converter.ErrConversionTimeout {
 			c.AbortWithError(http.StatusGatewayTimeout, converter.ErrConversionTimeout).SetType(gin.ErrorTypePublic)
 			return
 		}
 
+		// The output did not fit in the spool (see WEAVER_SPOOL_MAX_BYTES)
+		if err == spool.ErrQuotaExceeded {
+			s.Increment("spool_full")
+			c.AbortWithError(http.StatusServiceUnavailable, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+
 		c.Error(err)
 	}
 }
 
+// render converts a source to the given format in the work queue, and returns
+// its output (without uploading it).
+func render(c *gin.Context, source converter.ConversionSource, format string) ([]byte, error) {
+	defer source.Remove()
+
+	conversion, err := renderConversion(c, source, format)
+	if err != nil {
+		return nil, err
+	}
+	wq := c.MustGet("queue").(chan<- converter.Work)
+	return awaitRender(c, converter.NewWork(wq, conversion, source))
+}
+
+// renderConversion returns the conversion of a source to the given format
+// with the options of a request (see render). The options are validated.
+func renderConversion(c *gin.Context, source converter.ConversionSource, format string) (athenapdf.AthenaPDF, error) {
+	conf := c.MustGet("config").(Config)
+
+	_, aggressive := c.GetQuery("aggressive")
+	_, waitForStatus := c.GetQuery("waitForStatus")
+	_, noPortrait := c.GetQuery("no_portrait")
+	flags, err := chromeFlags(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	block, blockURLs, err := blockedResources(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	block, blockURLs = conf.Blocking.With(block, blockURLs)
+	locale, timezone, err := localeOptions(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	margins, media, delay, err := layoutOptions(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	rasterDPI, snapshotMedia, err := fidelityOptions(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	dpi, err := outputDPI(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	avoidBreak, breakBefore, breakAfter, err := pageBreaks(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	linkBase, stripLinks, err := linkOptions(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	e, err := requestEgress(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	redactions, err := redaction(c)
+	if err != nil {
+		return athenapdf.AthenaPDF{}, err
+	}
+	redact, redactPatterns := redactOptions(conf, redactions)
+
+	return athenapdf.AthenaPDF{
+		CMD:            conf.AthenaCMD,
+		Aggressive:     aggressive,
+		WaitForStatus:  waitForStatus,
+		NoPortrait:     noPortrait,
+		PageSize:       c.Query("page_size"),
+		Margins:        margins,
+		Media:          media,
+		Delay:          delay,
+		RasterDPI:      rasterDPI,
+		SnapshotMedia:  snapshotMedia,
+		DPI:            dpi,
+		Select:         c.Query("select"),
+		LinkBase:       linkBase,
+		StripLinks:     stripLinks,
+		Redact:         redact,
+		RedactPatterns: redactPatterns,
+		RepeatHeaders:  queryFlag(c, "repeat_table_headers"),
+		AvoidBreak:     avoidBreak,
+		BreakBefore:    breakBefore,
+		BreakAfter:     breakAfter,
+		Format:         format,
+		Flags:          append(conf.Chrome.FlagsWith(flags), e.flags()...),
+		Proxy:          e.proxy,
+		Block:          block,
+		BlockURLs:      blockURLs,
+		Offline:        offline(c, source),
+		Locale:         locale,
+		Timezone:       timezone,
+		RequestID:      c.GetString("request_id"),
+	}, nil
+}
+
+// awaitRender returns the output of a rendering, and cancels it if the client
+// closes the connection.
+func awaitRender(c *gin.Context, work converter.Work) ([]byte, error) {
+	select {
+	case <-c.Writer.CloseNotify():
+		work.Cancel()
+		return nil, ErrClientClosed
+	case out := <-work.Success():
+		return out, nil
+	case err := <-work.Error():
+		return nil, err
+	}
+}
+
+// asyncConversionHandler publishes a conversion job to the shared broker
+// instead of converting it in the request. The job will be consumed by any
+// weaver instance in the cluster, and its output will be uploaded to S3.
+func asyncConversionHandler(c *gin.Context, url string, ext string) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	b, ok := c.Get("broker")
+	if !ok {
+		c.AbortWithError(http.StatusBadRequest, ErrAsyncUnavailable).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	_, aggressive := c.GetQuery("aggressive")
+	_, waitForStatus := c.GetQuery("waitForStatus")
+	_, noPortrait := c.GetQuery("no_portrait")
+	format, _ := outputFormat(c)
+	flags, _ := chromeFlags(c)
+	block, blockURLs, _ := blockedResources(c)
+	locale, timezone, _ := localeOptions(c)
+	margins, media, delay, _ := layoutOptions(c)
+	rasterDPI, snapshotMedia, _ := fidelityOptions(c)
+	dpi, _ := outputDPI(c)
+	avoidBreak, breakBefore, breakAfter, _ := pageBreaks(c)
+	linkBase, stripLinks, _ := linkOptions(c)
+	attachments, _ := requestAttachments(c)
+	retention, _ := retentionDays(c)
+	redactions, _ := redaction(c)
+	targets, _ := notifyTargets(c)
+
+	job := queue.Job{
+		ID:             c.GetString("job"),
+		URL:            url,
+		Ext:            ext,
+		Aggressive:     aggressive || athenapdf.Readable(format),
+		WaitForStatus:  waitForStatus,
+		NoPortrait:     noPortrait,
+		PageSize:       c.Query("page_size"),
+		Margins:        margins,
+		Media:          media,
+		Delay:          delay,
+		RasterDPI:      rasterDPI,
+		SnapshotMedia:  snapshotMedia,
+		DPI:            dpi,
+		SinglePage:     singlePage(c),
+		Select:         c.Query("select"),
+		LinkBase:       linkBase,
+		StripLinks:     stripLinks,
+		RepeatHeaders:  queryFlag(c, "repeat_table_headers"),
+		AvoidBreak:     avoidBreak,
+		BreakBefore:    breakBefore,
+		BreakAfter:     breakAfter,
+		Format:         format,
+		ChromeFlags:    flags,
+		Block:          block,
+		BlockURLs:      blockURLs,
+		Locale:         locale,
+		Timezone:       timezone,
+		Proxy:          c.Query("proxy"),
+		HostMap:        requestHostMap(c),
+		Tenant:         tenantID(c),
+		Subject:        c.Query("subject"),
+		RequestID:      c.GetString("request_id"),
+		IncludeSource:  includeSource(c),
+		IncludeArchive: includeArchive(c),
+		Attachments:    attachments,
+		AttachSource:   attachSource(c),
+		OCR:            queryFlag(c, "ocr"),
+		OCRLanguages:   c.Query("ocr_languages"),
+		Grayscale:      queryFlag(c, "grayscale"),
+		ICCProfile:     c.Query("icc_profile"),
+		Codes:          c.Query("codes"),
+		Redact:         strings.Join(redactions, ","),
+		Notify:         targets,
+		HostLimit:      tenantHostLimit(c),
+		AWSS3: converter.AWSS3{
+			Region:        c.Query("aws_region"),
+			AccessKey:     c.Query("aws_id"),
+			AccessSecret:  c.Query("aws_secret"),
+			S3Bucket:      c.Query("s3_bucket"),
+			S3Key:         c.Query("s3_key"),
+			S3Acl:         c.Query("s3_acl"),
+			ContentType:   athenapdf.ContentTypes[format],
+			RetentionDays: retention,
+		},
+	}
+	_, job.AWSS3.ContentAddressed = c.GetQuery("s3_dedupe")
+
+	if !job.AWSS3.HasDestination() {
+		c.AbortWithError(http.StatusBadRequest, ErrAsyncNoUpload).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	progress.Set(tracker(c), job.ID, job.Tenant, progress.Queued, nil)
+	if err := b.(queue.Broker).Publish(job); err != nil {
+		progress.Set(tracker(c), job.ID, job.Tenant, progress.Failed, err)
+		s.Increment("job_publish_error")
+		if err == queue.ErrQueueFull {
+			c.AbortWithError(http.StatusServiceUnavailable, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		c.Error(err).SetMeta(CodeQueueUnavailable)
+		return
+	}
+
+	s.Increment("job_queued")
+	events.Emit(publisher(c), events.Queued, job.ID, job.URL, nil)
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "id": job.ID})
+}
+
 // convertByURLHandler is the main v1 API handler for converting a HTML to a PDF
 // via a GET request. It can either return a JSON string indicating that the
 // output of the conversion has been uploaded or it can return the output of
 // the conversion to the client (raw bytes).
 func convertByURLHandler(c *gin.Context) {
 	s := c.MustGet("statsd").(*statsd.Client)
-	r, ravenOk := c.Get("sentry")
 
 	url := c.Query("url")
 	if url == "" {
@@ -150,15 +1027,62 @@ func convertByURLHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := c.GetQuery("offline"); ok {
+		c.AbortWithError(http.StatusBadRequest, ErrOfflineURL).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if err := checkOptions(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if dryRun(c) {
+		dryRunHandler(c, url)
+		return
+	}
+
+	id := newJob(c, url)
+
 	ext := c.Query("ext")
 
-	source, err := converter.NewConversionSource(url, nil, ext)
+	if _, async := c.GetQuery("async"); async {
+		asyncConversionHandler(c, url, ext)
+		return
+	}
+
+	if err := allowSource(c, url); err != nil {
+		s.Increment("circuit_open")
+		events.Emit(publisher(c), events.Failed, id, url, err)
+		c.AbortWithError(http.StatusServiceUnavailable, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	release, err := acquireSource(c, url)
+	if err == politeness.ErrCancelled {
+		events.Emit(publisher(c), events.Failed, id, url, ErrClientClosed)
+		c.Abort()
+		return
+	}
 	if err != nil {
+		s.Increment("host_busy")
+		events.Emit(publisher(c), events.Failed, id, url, err)
+		c.AbortWithError(http.StatusServiceUnavailable, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	defer release()
+
+	source, cached, err := newCachedURLSource(c, url)
+	if err != nil {
+		recordSource(c, sourceFailed(err))
+		events.Emit(publisher(c), events.Failed, id, url, err)
 		s.Increment("conversion_error")
-		if ravenOk {
-			r.(*raven.Client).CaptureError(err, map[string]string{"url": url})
-		}
-		c.Error(err)
+		captureError(c, err, url, "", nil)
+		abortWithSourceError(c, err)
+		return
+	}
+	if cached != nil {
+		cachedConversionHandler(c, *cached)
 		return
 	}
 
@@ -167,23 +1091,78 @@ func convertByURLHandler(c *gin.Context) {
 
 func convertByFileHandler(c *gin.Context) {
 	s := c.MustGet("statsd").(*statsd.Client)
-	r, ravenOk := c.Get("sentry")
 
-	file, header, err := c.Request.FormFile("file")
+	file, name, err := receiveUpload(c)
+	switch err {
+	case ErrUploadTooLarge:
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+		s.Increment("upload_too_large")
+		return
+	case tus.ErrNotFound, tus.ErrIncomplete:
+		abortUpload(c, err)
+		return
+	}
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
 		s.Increment("invalid_file")
 		return
 	}
+	defer file.Close()
+
+	convertUpload(c, name, file)
+}
+
+// convertUpload converts an uploaded document (see convertByFileHandler).
+func convertUpload(c *gin.Context, name string, file io.Reader) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	if email.IsMessage(name, c.Query("ext")) {
+		doc, err := emailUpload(c, file)
+		switch err {
+		case nil:
+			file = doc
+		case ErrSourceTooLarge, ErrUploadTooLarge:
+			c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+			return
+		default:
+			c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+	}
+
+	if err := checkOptions(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if dryRun(c) {
+		dryRunHandler(c, "")
+		return
+	}
+
+	id := newJob(c, name)
 
 	ext := c.Query("ext")
 
-	source, err := converter.NewConversionSource("", file, ext)
+	// Hash the uploaded file while it is being saved (for auditing)
+	h := sha256.New()
+	upload, err := sanitizeUpload(c, io.TeeReader(file, h))
+	var source *converter.ConversionSource
+	if err == nil {
+		source, err = converter.NewConversionSource("", upload, ext)
+	}
+	c.Set("source_hash", hex.EncodeToString(h.Sum(nil)))
+	if err == ErrUploadTooLarge {
+		// The body of the request was streamed past the upload limit
+		events.Emit(publisher(c), events.Failed, id, name, err)
+		s.Increment("upload_too_large")
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+		return
+	}
 	if err != nil {
+		events.Emit(publisher(c), events.Failed, id, name, err)
 		s.Increment("conversion_error")
-		if ravenOk {
-			r.(*raven.Client).CaptureError(err, map[string]string{"url": header.Filename})
-		}
+		captureError(c, err, name, "", nil)
 		c.Error(err)
 		return
 	}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/spool"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func TestSetReportHeaders(t *testing.T) {
+	r := gin.Default()
+	r.GET("/", func(c *gin.Context) {
+		setReportHeaders(c, &converter.Report{
+			Pages:     3,
+			Bytes:     2048,
+			SHA256:    "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			QueueWait: time.Millisecond * 20,
+			Duration:  time.Millisecond * 1500,
+		})
+	})
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(res, req)
+	want := map[string]string{
+		"X-Conversion-Duration": "1500",
+		"X-Queue-Wait":          "20",
+		"X-Page-Count":          "3",
+		"X-Output-Bytes":        "2048",
+		"X-Output-SHA256":       "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	for k, v := range want {
+		if got := res.Header().Get(k); got != v {
+			t.Errorf("expected %s header to be %s, got %s", k, v, got)
+		}
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   error
+	}{
+		{"", "pdf", nil},
+		{"?format=text", "text", nil},
+		{"?format=Markdown", "markdown", nil},
+		{"?format=mhtml", "mhtml", nil},
+		{"?format=docx", "", ErrFormatInvalid},
+	}
+	for _, tt := range tests {
+		var got string
+		var err error
+		r := gin.Default()
+		r.GET("/", func(c *gin.Context) {
+			got, err = outputFormat(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want || err != tt.err {
+			t.Errorf("expected format of %q to be %q (%v), got %q (%v)", tt.query, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestChromeFlags(t *testing.T) {
+	conf := Config{Chrome: Chrome{Flags: []string{"disable-gpu"}, AllowedFlags: []string{"lang"}}}
+	tests := []struct {
+		query string
+		want  []string
+		err   error
+	}{
+		{"", nil, nil},
+		{"?chrome_flag=lang=en-GB", []string{"lang=en-GB"}, nil},
+		{"?chrome_flag=--lang=en-GB", []string{"lang=en-GB"}, nil},
+		{"?chrome_flag=lang=en-GB&chrome_flag=no-sandbox", nil, ErrChromeFlagNotAllowed},
+	}
+	for _, tt := range tests {
+		var got []string
+		var err error
+		r := gin.Default()
+		r.Use(ConfigMiddleware(conf))
+		r.GET("/", func(c *gin.Context) {
+			got, err = chromeFlags(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, tt.want) || err != tt.err {
+			t.Errorf("expected flags of %q to be %v (%v), got %v (%v)", tt.query, tt.want, tt.err, got, err)
+		}
+	}
+
+	if got, want := conf.Chrome.FlagsWith([]string{"lang=en-GB"}), []string{"disable-gpu", "lang=en-GB"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected flags to be %v, got %v", want, got)
+	}
+}
+
+func TestConvertByURLHandler_invalidOptions(t *testing.T) {
+	r := mockRouter(Config{}, Services{}, func(r *gin.Engine, _ Config, _ Services) {
+		r.GET("/convert", convertByURLHandler)
+	})
+
+	for _, query := range []string{"format=docx", "proxy=proxy.internal:3128"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/convert?url=http://example.com&"+query, nil)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, http.StatusBadRequest; got != want {
+			t.Errorf("expected response code of %q to be %d, got %d", query, want, got)
+		}
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"", nil},
+		{"?format=text", nil},
+		{"?format=docx", ErrFormatInvalid},
+		{"?chrome_flag=no-sandbox", ErrChromeFlagNotAllowed},
+		{"?block=ads&block=fonts&block_url=*/beacon/*", nil},
+		{"?block=popups", ErrBlockTypeInvalid},
+		{"?locale=en-GB&timezone=Europe/London", nil},
+		{"?locale=en_GB", ErrLocaleInvalid},
+		{"?timezone=Mars/Olympus", ErrTimezoneInvalid},
+		{"?proxy=proxy.internal:3128", ErrProxyNotAllowed},
+		{"?margins=none&media=screen&delay=2000", nil},
+		{"?margins=wide", ErrMarginsInvalid},
+		{"?media=tv", ErrMediaInvalid},
+		{"?delay=60000", ErrDelayInvalid},
+		{"?delay=soon", ErrDelayInvalid},
+		{"?raster_dpi=300&snapshot_media=true", nil},
+		{"?raster_dpi=72", ErrRasterDPIInvalid},
+		{"?raster_dpi=high", ErrRasterDPIInvalid},
+		{"?dpi=300&format=png", nil},
+		{"?dpi=1200", ErrDPIInvalid},
+		{"?page_size=letter", nil},
+		{"?page_size=B5", ErrPageSizeInvalid},
+		{"?includeSource=true&s3_bucket=reports&s3_key=a.pdf", nil},
+		{"?includeSource=true&s3_bucket=reports&s3_dedupe", nil},
+		{"?includeSource=false", nil},
+		{"?includeSource=true", ErrIncludeSourceNoUpload},
+		{"?includeArchive=true&s3_bucket=reports&s3_key=a.pdf", nil},
+		{"?includeArchive=true", ErrIncludeArchiveNoUpload},
+		{"?attachSource=true", nil},
+		{"?attachSource=true&format=text", ErrAttachmentsFormat},
+		{"?ocr=true", ErrOCRDisabled},
+		{"?ocr=false", nil},
+		{"?grayscale=true", ErrColorDisabled},
+		{"?single_page=true", nil},
+		{"?single_page=true&format=png", ErrSinglePageFormat},
+		{"?avoid_break=figure&avoid_break=.card&break_before=h1:not(:first-of-type)", nil},
+		{"?break_after=h1{color:red", ErrBreakSelectorInvalid},
+		{"?avoid_break=", ErrBreakSelectorInvalid},
+		{"?select=%23report%20table", nil},
+		{"?select=*/**/", ErrSelectInvalid},
+		{"?link_base=https://example.com/docs/&strip_external_links=true", nil},
+		{"?link_base=/docs/", ErrLinkBaseInvalid},
+		{"?link_base=javascript:alert(1)", ErrLinkBaseInvalid},
+		{"?email_attachments=append", nil},
+		{"?email_attachments=forward", ErrEmailAttachmentsInvalid},
+		{`?codes=[{"type":"barcode","text":"INV-42","pages":"2-"}]`, nil},
+		{`?codes=[{"type":"image"}]`, ErrCodesInvalid},
+		{`?codes={}`, ErrCodesInvalid},
+		{`?codes=[{"type":"barcode","text":"INV-42"}]&format=markdown`, ErrCodesFormat},
+		{"?retention_days=30", nil},
+		{"?retention_days=0", ErrRetentionInvalid},
+		{"?retention_days=forever", ErrRetentionInvalid},
+		{"?redact=email,card", nil},
+		{"?redact=ssn", ErrRedactInvalid},
+		{"?redact=email&attachSource=true", ErrRedactAttachSource},
+		{"?subject=customer-42", nil},
+		{"?subject=%0A", ErrSubjectInvalid},
+	}
+	for _, tt := range tests {
+		var err error
+		r := gin.Default()
+		r.Use(ConfigMiddleware(Config{}))
+		r.GET("/", func(c *gin.Context) {
+			err = checkOptions(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if err != tt.err {
+			t.Errorf("expected options %q to return %v, got %v", tt.query, tt.err, err)
+		}
+	}
+}
+
+func TestBlockingWith(t *testing.T) {
+	b := Blocking{Types: []string{"ads"}, URLs: []string{"*/beacon/*"}}
+	types, urls := b.With([]string{"fonts"}, nil)
+	if want := []string{"ads", "fonts"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("expected blocked types to be %v, got %v", want, types)
+	}
+	if want := []string{"*/beacon/*"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("expected blocked URLs to be %v, got %v", want, urls)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	tests := []struct {
+		conf  Config
+		query string
+		local bool
+		want  bool
+	}{
+		{Config{}, "", true, false},
+		{Config{}, "?offline", true, true},
+		{Config{}, "?offline", false, false},
+		{Config{OfflineUploads: true}, "", true, true},
+		{Config{OfflineUploads: true}, "", false, false},
+	}
+	for _, tt := range tests {
+		var got bool
+		r := gin.Default()
+		r.Use(ConfigMiddleware(tt.conf))
+		r.GET("/", func(c *gin.Context) {
+			got = offline(c, converter.ConversionSource{IsLocal: tt.local})
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("expected offline mode of %q (local: %v, enforced: %v) to be %v, got %v", tt.query, tt.local, tt.conf.OfflineUploads, tt.want, got)
+		}
+	}
+}
+
+func TestSanitizeUpload(t *testing.T) {
+	doc := `<html><body><script>alert(1)</script><p>hello</p></body></html>`
+	tests := []struct {
+		conf   Config
+		tenant *tenant.Tenant
+		query  string
+		doc    string
+		want   string
+	}{
+		{Config{}, nil, "", doc, doc},
+		{Config{SanitizePolicy: "scripts"}, nil, "", doc, `<html><head></head><body><p>hello</p></body></html>`},
+		{Config{SanitizePolicy: "scripts"}, nil, "", "plain <script>", "plain <script>"},
+		{Config{SanitizePolicy: "scripts"}, nil, "?ext=html", "plain <script>", `<html><head></head><body>plain </body></html>`},
+		{Config{}, &tenant.Tenant{ID: "acme", Sanitize: "scripts"}, "", doc, `<html><head></head><body><p>hello</p></body></html>`},
+	}
+	for _, tt := range tests {
+		var got []byte
+		r := gin.Default()
+		r.Use(ConfigMiddleware(tt.conf))
+		r.GET("/", func(c *gin.Context) {
+			if tt.tenant != nil {
+				c.Set("tenant", *tt.tenant)
+			}
+			upload, err := sanitizeUpload(c, strings.NewReader(tt.doc))
+			if err != nil {
+				t.Fatalf("unable to sanitize upload: %+v", err)
+			}
+			got, _ = ioutil.ReadAll(upload)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if string(got) != tt.want {
+			t.Errorf("expected sanitized upload to be %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestConvertByURLHandler_spoolFull(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The output of the mock converter (the URL) does not fit in the spool
+	converter.Spool = spool.New(dir, 8)
+	defer func() { converter.Spool = nil }()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "echo"
+	svc := Services{Queue: converter.InitWorkers(1, 1, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := streamRecorder{httptest.NewRecorder()}
+	req, _ := http.NewRequest("GET", "/convert?auth=123456&url="+ts.URL, nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+	if !strings.Contains(res.Body.String(), CodeSpoolFull) {
+		t.Errorf("expected error code to be %s, got %s", CodeSpoolFull, res.Body.String())
+	}
+	if got := converter.Spool.Used(); got != 0 {
+		t.Errorf("expected spool to be empty after the conversion, got %d bytes", got)
+	}
+}
+
+func TestPlaygroundRoute(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		r := gin.New()
+		InitSimpleRoutes(r, Config{Playground: enabled})
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/playground", nil)
+		r.ServeHTTP(res, req)
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		if got := res.Code; got != want {
+			t.Errorf("expected playground (enabled: %v) to return %d, got %d", enabled, want, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore appends job records as JSON lines to a file. Queries scan the
+// whole file, so it is only suitable for a modest history on a single
+// instance.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore creates a file store at the given path. The file is created if
+// it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &FileStore{path: path}, nil
+}
+
+// Add appends a job record to the file.
+func (s *FileStore) Add(j Job) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Find returns the jobs matching a query, newest first. Malformed lines are
+// skipped.
+func (s *FileStore) Find(q Query) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var jobs []Job
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var j Job
+		if err := json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			continue
+		}
+		if q.Match(j) {
+			jobs = append(jobs, j)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newest(jobs, q), nil
+}
+
+// Remove deletes the records of jobs by ID, rewriting the file (atomically).
+// Malformed lines are kept.
+func (s *FileStore) Remove(ids []string) error {
+	removed := idSet(ids)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var kept bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		var j Job
+		if err := json.Unmarshal(line, &j); err == nil && removed[j.ID] {
+			continue
+		}
+		kept.Write(line)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), ".history")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(kept.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
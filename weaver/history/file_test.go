@@ -0,0 +1,44 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(filepath.Join(dir, "jobs.log"))
+	if err != nil {
+		t.Fatalf("unable to create file store: %+v", err)
+	}
+	now := time.Now().UTC()
+	s.Add(Job{ID: "1", Time: now.Add(-time.Minute), Status: StatusCompleted, Tenant: "acme"})
+	s.Add(Job{ID: "2", Time: now, Status: StatusFailed, Tenant: "acme"})
+	s.Add(Job{ID: "3", Time: now, Status: StatusCompleted, Tenant: "globex"})
+
+	jobs, err := s.Find(Query{Tenant: "acme"})
+	if err != nil {
+		t.Fatalf("find returned an unexpected error: %+v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "2" || jobs[1].ID != "1" {
+		t.Errorf("expected jobs of acme (newest first), got %+v", jobs)
+	}
+	if !jobs[0].Time.Equal(now) {
+		t.Errorf("expected job time to be %s, got %s", now, jobs[0].Time)
+	}
+
+	if err := s.Remove([]string{"1", "3"}); err != nil {
+		t.Fatalf("remove returned an unexpected error: %+v", err)
+	}
+	if jobs, _ := s.Find(Query{}); len(jobs) != 1 || jobs[0].ID != "2" {
+		t.Errorf("expected job 2 to remain, got %+v", jobs)
+	}
+}
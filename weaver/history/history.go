@@ -0,0 +1,178 @@
+// Package history stores the metadata of finished conversion jobs (not their
+// output), so that they can be searched.
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+// DefaultLimit is the number of jobs returned by a query without a limit.
+const DefaultLimit = 100
+
+// Statuses of a finished job.
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Job is the record of a finished conversion job.
+type Job struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+	Status    string    `json:"status"`
+	// Tenant is the ID of the tenant the job is accounted to (if any).
+	Tenant string `json:"tenant,omitempty"`
+	// Subject identifies the person the document is about (if any), so that
+	// their data can be erased.
+	Subject string `json:"subject,omitempty"`
+	// Source is the URL (without credentials, and query values), or the
+	// name of the uploaded file.
+	Source string `json:"source,omitempty"`
+	// Domain is the host of a source URL.
+	Domain string `json:"domain,omitempty"`
+	Format string `json:"format,omitempty"`
+	Engine string `json:"engine,omitempty"`
+	// Code, and Error describe why a job failed (see the error codes).
+	Code        string `json:"code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Pages       int    `json:"pages,omitempty"`
+	Bytes       int    `json:"bytes,omitempty"`
+	DurationMS  int64  `json:"duration_ms"`
+	QueueWaitMS int64  `json:"queue_wait_ms"`
+	S3Region    string `json:"s3_region,omitempty"`
+	S3Bucket    string `json:"s3_bucket,omitempty"`
+	S3Key       string `json:"s3_key,omitempty"`
+	// Diagnostics are the problems of the page seen while it was rendered
+	// (see converter.Diagnostic).
+	Diagnostics Diagnostics `json:"diagnostics,omitempty"`
+}
+
+// Diagnostics are the diagnostics of a job. They are stored as JSON in SQL
+// databases.
+type Diagnostics []converter.Diagnostic
+
+// Value implements driver.Valuer.
+func (d Diagnostics) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(d)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (d *Diagnostics) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+	default:
+		return fmt.Errorf("history: unable to scan diagnostics from %T", src)
+	}
+	*d = nil
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, d)
+}
+
+// Query filters jobs. Empty fields match all jobs.
+type Query struct {
+	// From, and To limit the time range of the jobs (To is exclusive).
+	From time.Time
+	To   time.Time
+	// Status is StatusCompleted, or StatusFailed.
+	Status  string
+	Tenant  string
+	Subject string
+	// Domain matches the domain of a source, and its subdomains.
+	Domain string
+	// S3Bucket, and S3Key match the jobs of an uploaded output (the keys of
+	// deduplicated outputs are shared by jobs).
+	S3Bucket string
+	S3Key    string
+	// Limit is the maximum number of jobs returned.
+	// Defaults to DefaultLimit.
+	Limit int
+}
+
+// Match returns true if the job matches the query.
+func (q Query) Match(j Job) bool {
+	if !q.From.IsZero() && j.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !j.Time.Before(q.To) {
+		return false
+	}
+	if q.Status != "" && j.Status != q.Status {
+		return false
+	}
+	if q.Tenant != "" && j.Tenant != q.Tenant {
+		return false
+	}
+	if q.Subject != "" && j.Subject != q.Subject {
+		return false
+	}
+	if q.S3Bucket != "" && j.S3Bucket != q.S3Bucket {
+		return false
+	}
+	if q.S3Key != "" && j.S3Key != q.S3Key {
+		return false
+	}
+	if q.Domain != "" {
+		d, jd := strings.ToLower(q.Domain), strings.ToLower(j.Domain)
+		if jd != d && !strings.HasSuffix(jd, "."+d) {
+			return false
+		}
+	}
+	return true
+}
+
+// limit returns the maximum number of jobs returned by the query.
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	return q.Limit
+}
+
+// Store stores job records.
+type Store interface {
+	// Add stores a job record.
+	Add(Job) error
+	// Find returns the jobs matching a query, newest first.
+	Find(Query) ([]Job, error)
+	// Remove deletes the records of jobs by ID.
+	Remove(ids []string) error
+}
+
+// idSet returns a set of job IDs.
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// newest sorts jobs newest first, and returns at most the limit of the query.
+func newest(jobs []Job, q Query) []Job {
+	sort.SliceStable(jobs, func(i, k int) bool {
+		return jobs[i].Time.After(jobs[k].Time)
+	})
+	if len(jobs) > q.limit() {
+		jobs = jobs[:q.limit()]
+	}
+	return jobs
+}
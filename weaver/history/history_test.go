@@ -0,0 +1,57 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Now()
+	j := Job{ID: "test-job", Time: now, Status: StatusFailed, Tenant: "acme", Subject: "customer-42", Domain: "invoices.example.com", S3Bucket: "reports", S3Key: "a.pdf"}
+	tests := []struct {
+		q    Query
+		want bool
+	}{
+		{Query{}, true},
+		{Query{From: now.Add(-time.Hour), To: now.Add(time.Hour)}, true},
+		{Query{From: now.Add(time.Second)}, false},
+		{Query{To: now}, false},
+		{Query{Status: StatusFailed, Tenant: "acme"}, true},
+		{Query{Status: StatusCompleted}, false},
+		{Query{Tenant: "globex"}, false},
+		{Query{Tenant: "acme", Subject: "customer-42"}, true},
+		{Query{Subject: "customer-7"}, false},
+		{Query{Domain: "example.com"}, true},
+		{Query{Domain: "Invoices.Example.com"}, true},
+		{Query{Domain: "ample.com"}, false},
+		{Query{S3Bucket: "reports", S3Key: "a.pdf"}, true},
+		{Query{S3Key: "b.pdf"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Match(j); got != tt.want {
+			t.Errorf("expected query %+v to match (%v), got %v", tt.q, tt.want, got)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(2)
+	now := time.Now()
+	s.Add(Job{ID: "1", Time: now.Add(-time.Minute * 2)})
+	s.Add(Job{ID: "2", Time: now.Add(-time.Minute)})
+	s.Add(Job{ID: "3", Time: now})
+	jobs, err := s.Find(Query{})
+	if err != nil {
+		t.Fatalf("find returned an unexpected error: %+v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "3" || jobs[1].ID != "2" {
+		t.Errorf("expected the 2 newest jobs (newest first), got %+v", jobs)
+	}
+	if jobs, _ := s.Find(Query{Limit: 1}); len(jobs) != 1 {
+		t.Errorf("expected 1 job, got %d", len(jobs))
+	}
+	s.Remove([]string{"3"})
+	if jobs, _ := s.Find(Query{}); len(jobs) != 1 || jobs[0].ID != "2" {
+		t.Errorf("expected job 2 to remain, got %+v", jobs)
+	}
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"sync"
+)
+
+// MemoryStore keeps the most recent job records in memory. It is lost on
+// restart, and it is not shared between instances.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs []Job
+	max  int
+}
+
+// NewMemoryStore creates a memory store keeping at most max records (the
+// oldest are dropped first).
+func NewMemoryStore(max int) *MemoryStore {
+	return &MemoryStore{max: max}
+}
+
+// Add stores a job record.
+func (s *MemoryStore) Add(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.jobs) == s.max {
+		s.jobs = s.jobs[1:]
+	}
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// Find returns the jobs matching a query, newest first.
+func (s *MemoryStore) Find(q Query) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []Job
+	for _, j := range s.jobs {
+		if q.Match(j) {
+			jobs = append(jobs, j)
+		}
+	}
+	return newest(jobs, q), nil
+}
+
+// Remove deletes the records of jobs by ID.
+func (s *MemoryStore) Remove(ids []string) error {
+	removed := idSet(ids)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := s.jobs[:0]
+	for _, j := range s.jobs {
+		if !removed[j.ID] {
+			jobs = append(jobs, j)
+		}
+	}
+	s.jobs = jobs
+	return nil
+}
@@ -0,0 +1,144 @@
+package history
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// jobColumns are the columns of the 'weaver_history' table, in the order
+// they are scanned into a Job.
+const jobColumns = "id, request_id, time, status, tenant, source, domain, format, engine, code, error, pages, bytes, duration_ms, queue_wait_ms, s3_bucket, s3_key, subject, s3_region, diagnostics"
+
+// upsertJob inserts (or replaces) a job record. It is supported by both
+// PostgreSQL, and SQLite (3.24+).
+const upsertJob = `INSERT INTO weaver_history (` + jobColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	ON CONFLICT (id) DO UPDATE SET
+		request_id = EXCLUDED.request_id, time = EXCLUDED.time,
+		status = EXCLUDED.status, tenant = EXCLUDED.tenant,
+		source = EXCLUDED.source, domain = EXCLUDED.domain,
+		format = EXCLUDED.format, engine = EXCLUDED.engine,
+		code = EXCLUDED.code, error = EXCLUDED.error,
+		pages = EXCLUDED.pages, bytes = EXCLUDED.bytes,
+		duration_ms = EXCLUDED.duration_ms, queue_wait_ms = EXCLUDED.queue_wait_ms,
+		s3_bucket = EXCLUDED.s3_bucket, s3_key = EXCLUDED.s3_key,
+		subject = EXCLUDED.subject, s3_region = EXCLUDED.s3_region,
+		diagnostics = EXCLUDED.diagnostics`
+
+// PostgresStore stores job records in the 'weaver_history' table of a
+// PostgreSQL database (see the postgres package), so that the history is
+// shared by all instances.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store using a migrated database.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db}
+}
+
+// Add stores a job record. The record of a job that is retried (e.g. a
+// redelivered asynchronous job) replaces the previous one.
+func (s *PostgresStore) Add(j Job) error {
+	_, err := s.db.Exec(upsertJob,
+		j.ID, j.RequestID, j.Time, j.Status, j.Tenant, j.Source, j.Domain,
+		j.Format, j.Engine, j.Code, j.Error, j.Pages, j.Bytes, j.DurationMS,
+		j.QueueWaitMS, j.S3Bucket, j.S3Key, j.Subject, j.S3Region,
+		j.Diagnostics,
+	)
+	return err
+}
+
+// Find returns the jobs matching a query, newest first.
+func (s *PostgresStore) Find(q Query) ([]Job, error) {
+	where, args := q.where()
+	rows, err := s.db.Query("SELECT "+jobColumns+" FROM weaver_history"+where+
+		" ORDER BY time DESC LIMIT "+strconv.Itoa(q.limit()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(
+			&j.ID, &j.RequestID, &j.Time, &j.Status, &j.Tenant, &j.Source,
+			&j.Domain, &j.Format, &j.Engine, &j.Code, &j.Error, &j.Pages,
+			&j.Bytes, &j.DurationMS, &j.QueueWaitMS, &j.S3Bucket, &j.S3Key,
+			&j.Subject, &j.S3Region, &j.Diagnostics,
+		); err != nil {
+			return nil, err
+		}
+		j.Time = j.Time.UTC()
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Remove deletes the records of jobs by ID.
+func (s *PostgresStore) Remove(ids []string) error {
+	return removeJobs(s.db, ids)
+}
+
+// removeJobs deletes the records of jobs by ID from the 'weaver_history'
+// table.
+func removeJobs(db *sql.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	_, err := db.Exec("DELETE FROM weaver_history WHERE id IN ("+strings.Join(placeholders, ", ")+")", args...)
+	return err
+}
+
+// where returns the SQL WHERE clause (with placeholders), and its arguments
+// matching the same jobs as Match.
+func (q Query) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "time >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "time < "+arg(q.To))
+	}
+	if q.Status != "" {
+		conds = append(conds, "status = "+arg(q.Status))
+	}
+	if q.Tenant != "" {
+		conds = append(conds, "tenant = "+arg(q.Tenant))
+	}
+	if q.Subject != "" {
+		conds = append(conds, "subject = "+arg(q.Subject))
+	}
+	if q.S3Bucket != "" {
+		conds = append(conds, "s3_bucket = "+arg(q.S3Bucket))
+	}
+	if q.S3Key != "" {
+		conds = append(conds, "s3_key = "+arg(q.S3Key))
+	}
+	if q.Domain != "" {
+		d := strings.ToLower(q.Domain)
+		conds = append(conds, "(domain = "+arg(d)+" OR domain LIKE "+arg("%."+escapeLike(d))+` ESCAPE '\')`)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
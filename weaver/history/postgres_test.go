@@ -0,0 +1,42 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryWhere(t *testing.T) {
+	from := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		q     Query
+		where string
+		args  []interface{}
+	}{
+		{Query{}, "", nil},
+		{
+			Query{From: from, Status: StatusFailed, Tenant: "acme"},
+			" WHERE time >= $1 AND status = $2 AND tenant = $3",
+			[]interface{}{from, StatusFailed, "acme"},
+		},
+		{
+			Query{Tenant: "acme", S3Bucket: "reports", S3Key: "a.pdf"},
+			" WHERE tenant = $1 AND s3_bucket = $2 AND s3_key = $3",
+			[]interface{}{"acme", "reports", "a.pdf"},
+		},
+		{
+			Query{Domain: "My_Example.com"},
+			` WHERE (domain = $1 OR domain LIKE $2 ESCAPE '\')`,
+			[]interface{}{"my_example.com", `%.my\_example.com`},
+		},
+	}
+	for _, tt := range tests {
+		where, args := tt.q.where()
+		if where != tt.where {
+			t.Errorf("expected query %+v to be %q, got %q", tt.q, tt.where, where)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("expected query %+v arguments to be %v, got %v", tt.q, tt.args, args)
+		}
+	}
+}
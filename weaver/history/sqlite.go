@@ -0,0 +1,69 @@
+package history
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// SQLiteStore stores job records in the 'weaver_history' table of an
+// embedded SQLite database (see the sqlite package). Times are stored as
+// Unix nanoseconds, so that they are ordered correctly.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore creates a store using a migrated database.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db}
+}
+
+// Add stores a job record. The record of a job that is retried (e.g. a
+// redelivered asynchronous job) replaces the previous one.
+func (s *SQLiteStore) Add(j Job) error {
+	_, err := s.db.Exec(upsertJob,
+		j.ID, j.RequestID, j.Time.UnixNano(), j.Status, j.Tenant, j.Source,
+		j.Domain, j.Format, j.Engine, j.Code, j.Error, j.Pages, j.Bytes,
+		j.DurationMS, j.QueueWaitMS, j.S3Bucket, j.S3Key, j.Subject, j.S3Region,
+		j.Diagnostics,
+	)
+	return err
+}
+
+// Find returns the jobs matching a query, newest first.
+func (s *SQLiteStore) Find(q Query) ([]Job, error) {
+	where, args := q.where()
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.UnixNano()
+		}
+	}
+	rows, err := s.db.Query("SELECT "+jobColumns+" FROM weaver_history"+where+
+		" ORDER BY time DESC LIMIT "+strconv.Itoa(q.limit()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		var t int64
+		if err := rows.Scan(
+			&j.ID, &j.RequestID, &t, &j.Status, &j.Tenant, &j.Source,
+			&j.Domain, &j.Format, &j.Engine, &j.Code, &j.Error, &j.Pages,
+			&j.Bytes, &j.DurationMS, &j.QueueWaitMS, &j.S3Bucket, &j.S3Key,
+			&j.Subject, &j.S3Region, &j.Diagnostics,
+		); err != nil {
+			return nil, err
+		}
+		j.Time = time.Unix(0, t).UTC()
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Remove deletes the records of jobs by ID.
+func (s *SQLiteStore) Remove(ids []string) error {
+	return removeJobs(s.db, ids)
+}
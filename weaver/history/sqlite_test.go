@@ -0,0 +1,68 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/sqlite"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sqlite.Open(filepath.Join(dir, "weaver.db"))
+	if err != nil {
+		t.Fatalf("unable to open database: %+v", err)
+	}
+	defer db.Close()
+	s := NewSQLiteStore(db)
+
+	now := time.Now().UTC()
+	s.Add(Job{ID: "1", Time: now.Add(-time.Minute), Status: StatusCompleted, Tenant: "acme", Domain: "example.com"})
+	s.Add(Job{ID: "2", Time: now, Status: StatusFailed, Tenant: "acme", Domain: "invoices.example.com", Diagnostics: Diagnostics{{Type: converter.DiagnosticConsole, Message: "app failed to start"}}})
+	s.Add(Job{ID: "3", Time: now, Status: StatusCompleted, Tenant: "globex", Subject: "customer-42", Domain: "example.org", S3Region: "eu-west-1"})
+	// A retried job replaces its record
+	s.Add(Job{ID: "1", Time: now.Add(-time.Second), Status: StatusCompleted, Tenant: "acme", Domain: "example.com", Pages: 2})
+
+	jobs, err := s.Find(Query{Tenant: "acme", Domain: "example.com", From: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("find returned an unexpected error: %+v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "2" || jobs[1].ID != "1" {
+		t.Fatalf("expected jobs of acme (newest first), got %+v", jobs)
+	}
+	if !jobs[0].Time.Equal(now) {
+		t.Errorf("expected job time to be %s, got %s", now, jobs[0].Time)
+	}
+	if got := jobs[0].Diagnostics; len(got) != 1 || got[0].Message != "app failed to start" {
+		t.Errorf("expected the diagnostics of job 2, got %+v", got)
+	}
+	if got := jobs[1].Diagnostics; got != nil {
+		t.Errorf("expected job 1 to have no diagnostics, got %+v", got)
+	}
+	if got, want := jobs[1].Pages, 2; got != want {
+		t.Errorf("expected pages of the retried job to be %d, got %d", want, got)
+	}
+	if jobs, _ := s.Find(Query{Status: StatusFailed, To: now}); len(jobs) != 0 {
+		t.Errorf("expected no failed jobs before %s, got %+v", now, jobs)
+	}
+
+	jobs, _ = s.Find(Query{Subject: "customer-42"})
+	if len(jobs) != 1 || jobs[0].ID != "3" || jobs[0].S3Region != "eu-west-1" {
+		t.Fatalf("expected the job of the subject, got %+v", jobs)
+	}
+	if err := s.Remove([]string{"1", "3"}); err != nil {
+		t.Fatalf("remove returned an unexpected error: %+v", err)
+	}
+	if jobs, _ := s.Find(Query{}); len(jobs) != 1 || jobs[0].ID != "2" {
+		t.Errorf("expected job 2 to remain, got %+v", jobs)
+	}
+}
@@ -0,0 +1,138 @@
+// Package hooks runs operator-provided transformations at the stages of the
+// conversion pipeline (e.g. to rewrite the HTML of a source, or to
+// post-process an output), so that the pipeline can be customized without
+// forking weaver. Hooks are Go plugins (see LoadPlugin), sandboxed
+// WebAssembly plugins (see WASM), or external transformers called over HTTP
+// (see Webhook).
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// The stages of the conversion pipeline, in the order they are run.
+const (
+	// PreFetch runs before a URL source is fetched. Hooks may rewrite its
+	// URL, the body is empty.
+	PreFetch = "pre-fetch"
+	// PostFetch runs once a URL source has been fetched, with its body.
+	PostFetch = "post-fetch"
+	// PreRender runs before any source is rendered, with its body if it is
+	// a local file (e.g. an upload), or else its URL only.
+	PreRender = "pre-render"
+	// PostRender runs once the renderer has produced the output, before it
+	// is post-processed (e.g. OCR, stamps, or attachments).
+	PostRender = "post-render"
+	// PreUpload runs on the final output, before it is uploaded (or
+	// returned).
+	PreUpload = "pre-upload"
+)
+
+// Stages are the stages of the conversion pipeline.
+var Stages = []string{PreFetch, PostFetch, PreRender, PostRender, PreUpload}
+
+// ErrUnknownStage is returned when a hook is registered for a stage that does
+// not exist.
+var ErrUnknownStage = errors.New("unknown hook stage")
+
+// Payload is the data transformed by the hooks of a stage.
+type Payload struct {
+	Stage string
+	// URL is the URL of the source (or its path, if it is a local file).
+	URL string
+	// ContentType is the type of the body (if any).
+	ContentType string
+	// Body is the source, or the output, depending on the stage.
+	Body []byte
+}
+
+// Hook transforms the payload of a stage. It returns the payload unchanged if
+// it has nothing to do.
+type Hook interface {
+	Run(Payload) (Payload, error)
+}
+
+// HookFunc is a function used as a Hook.
+type HookFunc func(Payload) (Payload, error)
+
+// Run calls the function.
+func (f HookFunc) Run(p Payload) (Payload, error) {
+	return f(p)
+}
+
+// Error is returned when a hook fails. The conversion fails with it.
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s hook failed: %v", e.Stage, e.Err)
+}
+
+// Pipeline contains the hooks of every stage. A nil pipeline has no hooks.
+type Pipeline struct {
+	mu    sync.RWMutex
+	hooks map[string][]Hook
+}
+
+// New creates a pipeline without hooks.
+func New() *Pipeline {
+	return &Pipeline{hooks: make(map[string][]Hook)}
+}
+
+// Register adds a hook to a stage. The hooks of a stage run in the order they
+// were registered.
+func (p *Pipeline) Register(stage string, h Hook) error {
+	if !ValidStage(stage) {
+		return ErrUnknownStage
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks[stage] = append(p.hooks[stage], h)
+	return nil
+}
+
+// Has returns true if a stage has hooks.
+func (p *Pipeline) Has(stage string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.hooks[stage]) > 0
+}
+
+// Run runs the hooks of a stage on a payload, each hook receiving the payload
+// returned by the previous one. It returns the payload unchanged if the stage
+// has no hooks, or an *Error if a hook fails.
+func (p *Pipeline) Run(stage string, pl Payload) (Payload, error) {
+	if p == nil {
+		return pl, nil
+	}
+	p.mu.RLock()
+	hooks := p.hooks[stage]
+	p.mu.RUnlock()
+	pl.Stage = stage
+	for _, h := range hooks {
+		out, err := h.Run(pl)
+		if err != nil {
+			return pl, &Error{Stage: stage, Err: err}
+		}
+		pl = out
+		pl.Stage = stage
+	}
+	return pl, nil
+}
+
+// ValidStage returns true if a stage exists.
+func ValidStage(stage string) bool {
+	for _, s := range Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package hooks
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendHook(s string) HookFunc {
+	return func(p Payload) (Payload, error) {
+		p.Body = append(p.Body, s...)
+		return p, nil
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := New()
+	p.Register(PostFetch, appendHook("a"))
+	p.Register(PostFetch, appendHook("b"))
+	if err := p.Register("post-fetching", appendHook("c")); err != ErrUnknownStage {
+		t.Errorf("expected %v, got %v", ErrUnknownStage, err)
+	}
+
+	if !p.Has(PostFetch) || p.Has(PreFetch) {
+		t.Errorf("expected only %s to have hooks", PostFetch)
+	}
+	pl, err := p.Run(PostFetch, Payload{Body: []byte("<")})
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := string(pl.Body), "<ab"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+	if pl.Stage != PostFetch {
+		t.Errorf("expected stage %q, got %q", PostFetch, pl.Stage)
+	}
+
+	pl, err = p.Run(PreUpload, Payload{Body: []byte("%PDF")})
+	if err != nil || string(pl.Body) != "%PDF" {
+		t.Errorf("expected the payload to be unchanged, got %q (%v)", pl.Body, err)
+	}
+}
+
+func TestPipeline_error(t *testing.T) {
+	p := New()
+	failed := errors.New("rejected")
+	p.Register(PreFetch, HookFunc(func(pl Payload) (Payload, error) { return pl, failed }))
+	p.Register(PreFetch, appendHook("a"))
+
+	pl, err := p.Run(PreFetch, Payload{URL: "https://example.com"})
+	if e, ok := err.(*Error); !ok || e.Err != failed || e.Stage != PreFetch {
+		t.Fatalf("expected the error of the hook, got %+v", err)
+	}
+	if got, want := err.Error(), "pre-fetch hook failed: rejected"; got != want {
+		t.Errorf("expected error %q, got %q", want, got)
+	}
+	if len(pl.Body) != 0 {
+		t.Errorf("expected the hooks to stop at the error, got %q", pl.Body)
+	}
+}
+
+func TestPipeline_nil(t *testing.T) {
+	var p *Pipeline
+	if p.Has(PreRender) {
+		t.Error("expected a nil pipeline to have no hooks")
+	}
+	if pl, err := p.Run(PreRender, Payload{URL: "a"}); err != nil || pl.URL != "a" {
+		t.Errorf("expected the payload to be unchanged, got %+v (%v)", pl, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		switch r.Header.Get("X-Weaver-Stage") {
+		case PreFetch:
+			w.Header().Set("X-Weaver-Source-URL", strings.Replace(r.Header.Get("X-Weaver-Source-URL"), "http:", "https:", 1))
+			w.WriteHeader(http.StatusNoContent)
+		case PostFetch:
+			if r.Header.Get("Content-Type") != "text/html" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(strings.ToUpper(string(b))))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	w := Webhook{URL: ts.URL, Timeout: time.Second * 5}
+	pl, err := w.Run(Payload{Stage: PreFetch, URL: "http://example.com"})
+	if err != nil || pl.URL != "https://example.com" {
+		t.Errorf("expected the URL to be rewritten, got %+v (%v)", pl, err)
+	}
+
+	pl, err = w.Run(Payload{Stage: PostFetch, URL: "https://example.com", ContentType: "text/html", Body: []byte("<p>a</p>")})
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if string(pl.Body) != "<P>A</P>" || pl.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("expected the body to be replaced, got %q (%s)", pl.Body, pl.ContentType)
+	}
+
+	if _, err := w.Run(Payload{Stage: PreUpload}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestLoadPlugin(t *testing.T) {
+	if err := LoadPlugin(New(), "testdata/missing.so"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestWebhook_policy(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		w     Webhook
+		calls int
+		body  string
+		err   bool
+	}{
+		{Webhook{URL: ts.URL}, 1, "%PDF-1.4", true},
+		{Webhook{URL: ts.URL, OnFailure: FailureSkip}, 1, "%PDF-1.4", false},
+		{Webhook{URL: ts.URL, Retries: 1}, 2, "%PDF-1.7", false},
+		{Webhook{URL: "http://127.0.0.1:1", Retries: 0, OnFailure: FailureSkip}, 0, "%PDF-1.4", false},
+	}
+	for i, tt := range tests {
+		calls = 0
+		pl, err := tt.w.Run(Payload{Stage: PostRender, ContentType: "application/pdf", Body: []byte("%PDF-1.4")})
+		if (err != nil) != tt.err || string(pl.Body) != tt.body || calls != tt.calls {
+			t.Errorf("#%d: expected %q after %d call(s) (error: %v), got %q after %d (%v)", i, tt.body, tt.calls, tt.err, pl.Body, calls, err)
+		}
+	}
+}
+
+func TestWebhook_types(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	w := Webhook{URL: ts.URL, Types: []string{"text/html"}}
+	payloads := []struct {
+		p        Payload
+		received bool
+	}{
+		{Payload{Stage: PostFetch, ContentType: "text/html; charset=utf-8", Body: []byte("<p>")}, true},
+		{Payload{Stage: PostFetch, ContentType: "application/pdf", Body: []byte("%PDF")}, false},
+		{Payload{Stage: PreRender, ContentType: "text/html; charset=utf-8", URL: "https://example.com"}, false},
+		{Payload{Stage: PreFetch, URL: "https://example.com"}, true},
+	}
+	for _, tt := range payloads {
+		calls = 0
+		if _, err := w.Run(tt.p); err != nil {
+			t.Fatalf("expected no error, got %+v", err)
+		}
+		if got := calls == 1; got != tt.received {
+			t.Errorf("expected %s payload of %q to be received: %v, got %v", tt.p.Stage, tt.p.ContentType, tt.received, got)
+		}
+	}
+}
+
+// buildWASM builds the WASM plugin of the tests (see testdata/plugin), or
+// skips the test if the Go toolchain cannot.
+func buildWASM(t *testing.T) string {
+	out := filepath.Join(t.TempDir(), "plugin.wasm")
+	cmd := exec.Command("go", "build", "-o", out, ".")
+	cmd.Dir = "testdata/plugin"
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GO111MODULE=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build the WASM plugin: %v: %s", err, b)
+	}
+	return out
+}
+
+func TestWASM(t *testing.T) {
+	w, err := LoadWASM(buildWASM(t), time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	tests := []struct {
+		stage string
+		body  string
+		err   bool
+	}{
+		{PostFetch, "<P>A</P>", false},
+		{PostRender, "<p>a</p>", false},
+		{PreFetch, "", false},
+		{PreUpload, "<p>a</p>", true},
+		{PreRender, "<p>a</p>", true},
+	}
+	for _, tt := range tests {
+		pl, err := w.Run(Payload{Stage: tt.stage, ContentType: "text/html", Body: []byte("<p>a</p>")})
+		if (err != nil) != tt.err || string(pl.Body) != tt.body {
+			t.Errorf("expected %s body %q (error: %v), got %q (%v)", tt.stage, tt.body, tt.err, pl.Body, err)
+		}
+	}
+
+	_, err = w.Run(Payload{Stage: PreRender, Body: []byte("<p>a</p>")})
+	if err != ErrWASMTimeout {
+		t.Errorf("expected %v, got %+v", ErrWASMTimeout, err)
+	}
+	if _, err := w.Run(Payload{Stage: PreUpload, Body: []byte("%PDF")}); err == nil || !strings.Contains(err.Error(), "invalid PDF") {
+		t.Errorf("expected the standard error of the plugin, got %+v", err)
+	}
+}
+
+func TestLoadWASM_invalid(t *testing.T) {
+	if _, err := LoadWASM("testdata/plugin/main.go", time.Second); err == nil {
+		t.Error("expected an error for an invalid module")
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	if _, err := b.Write([]byte("abc")); err != nil || b.overflow {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if _, err := b.Write([]byte("de")); err != errWASMOutputTooLarge || !b.overflow {
+		t.Errorf("expected %v, got %+v", errWASMOutputTooLarge, err)
+	}
+	if b.String() != "abc" {
+		t.Errorf("expected the output within the limit, got %q", b.String())
+	}
+}
@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginSymbol is the name of the function a Go plugin exports to register
+// its hooks, i.e.
+//
+//	func RegisterHooks(p *hooks.Pipeline) error
+//
+// The plugin must be built (with 'go build -buildmode=plugin') against the
+// same version of weaver.
+const PluginSymbol = "RegisterHooks"
+
+// LoadPlugin opens the Go plugin at a path, and registers its hooks to the
+// pipeline. Plugins are only supported on Linux, and macOS (with cgo).
+func LoadPlugin(p *Pipeline, path string) error {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := plug.Lookup(PluginSymbol)
+	if err != nil {
+		return err
+	}
+	register, ok := sym.(func(*Pipeline) error)
+	if !ok {
+		return fmt.Errorf("%s of plugin %s must be a func(*hooks.Pipeline) error", PluginSymbol, path)
+	}
+	return register(p)
+}
@@ -0,0 +1,32 @@
+// Command plugin is the WASM plugin of the tests, built with
+// 'GOOS=wasip1 GOARCH=wasm go build': the body is transformed depending on
+// the stage.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	body, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "post-fetch":
+		os.Stdout.Write(bytes.ToUpper(body))
+	case "post-render":
+		os.Exit(100)
+	case "pre-fetch":
+		// An empty body.
+	case "pre-upload":
+		fmt.Fprintln(os.Stderr, "invalid PDF")
+		os.Exit(3)
+	default:
+		for {
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// ExitUnchanged is the exit code with which a WASM plugin leaves the body
+// unchanged (its standard output is then ignored).
+const ExitUnchanged = 100
+
+// MaxMemoryPages is the maximum memory of a WASM plugin, in pages of 64 KiB
+// (256 MiB), rather than the 4 GiB a module may declare.
+const MaxMemoryPages = 4096
+
+// maxErrorBytes is the maximum size of the standard error of a WASM plugin
+// kept for its error.
+const maxErrorBytes = 4 << 10
+
+// limitedBuffer is a buffer that fails writes beyond its limit, and keeps
+// whether it has overflowed.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		b.overflow = true
+		return 0, errWASMOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// errWASMOutputTooLarge fails the writes of a WASM plugin beyond the limit
+// of its output.
+var errWASMOutputTooLarge = errors.New("WASM plugin output is too large")
+
+// ErrWASMTimeout is returned when a WASM plugin does not exit in time.
+var ErrWASMTimeout = errors.New("WASM plugin timed out")
+
+// WASM is a WebAssembly plugin: a WASI command module (e.g. built with
+// 'GOOS=wasip1 GOARCH=wasm go build', or 'cargo build --target wasm32-wasi'),
+// run in-process by wazero. The module is sandboxed: it has no access to the
+// file system, or the network, only to its arguments, and standard streams,
+// which are its ABI:
+//
+//   - its arguments are the stage, the content type of the body, and the URL
+//     of the source (see Payload),
+//   - its standard input is the body,
+//   - its standard output replaces the body (even if it is empty), unless it
+//     exits with ExitUnchanged, in which case the body is unchanged,
+//   - it fails if it exits with any other non-zero code, with its standard
+//     error.
+//
+// Each run instantiates the module anew, so runs share no memory. Its
+// memory is limited to MaxMemoryPages, and its standard output to the size
+// of the responses of webhooks.
+type WASM struct {
+	// Module is the path of the module.
+	Module  string
+	Timeout time.Duration
+	// Types are the content types the plugin receives (see Webhook.Types).
+	Types []string
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// LoadWASM compiles the module at path as a WASM plugin.
+func LoadWASM(path string, timeout time.Duration) (*WASM, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(MaxMemoryPages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	compiled, err := r.CompileModule(ctx, b)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("WASM plugin %s: %v", path, err)
+	}
+	return &WASM{Module: path, Timeout: timeout, runtime: r, compiled: compiled}, nil
+}
+
+// Run runs the module on the payload, if it receives it.
+func (w *WASM) Run(p Payload) (Payload, error) {
+	if !receives(w.Types, p) {
+		return p, nil
+	}
+	ctx := context.Background()
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	out, errOut := &limitedBuffer{limit: maxResponseBytes}, &limitedBuffer{limit: maxErrorBytes}
+	conf := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(w.Module, p.Stage, p.ContentType, p.URL).
+		WithStdin(bytes.NewReader(p.Body)).
+		WithStdout(out).
+		WithStderr(errOut)
+	m, err := w.runtime.InstantiateModule(ctx, w.compiled, conf)
+	if m != nil {
+		m.Close(ctx)
+	}
+	if out.overflow {
+		return p, errWASMOutputTooLarge
+	}
+	code := uint32(0)
+	if err != nil {
+		var exit *sys.ExitError
+		if !errors.As(err, &exit) {
+			return p, err
+		}
+		code = exit.ExitCode()
+	}
+	switch code {
+	case 0:
+		p.Body = out.Bytes()
+		return p, nil
+	case ExitUnchanged:
+		return p, nil
+	case sys.ExitCodeDeadlineExceeded:
+		return p, ErrWASMTimeout
+	}
+	return p, fmt.Errorf("WASM plugin exited with code %d: %s", code, strings.TrimSpace(errOut.String()))
+}
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes is the maximum size of the body returned by a webhook.
+const maxResponseBytes = 256 << 20
+
+// The failure policies of a webhook.
+const (
+	// FailureFail fails the conversion when the webhook fails.
+	FailureFail = "fail"
+	// FailureSkip leaves the payload unchanged when the webhook fails, so
+	// that the conversion continues without the transformation.
+	FailureSkip = "skip"
+)
+
+// Webhook is an external transformer: the body of the payload is POSTed to
+// its URL, with the 'X-Weaver-Stage', and 'X-Weaver-Source-URL' headers, and
+// the body of a '200' response (with its Content-Type) replaces it. A '204'
+// response leaves the body unchanged. The URL is rewritten if the response
+// has an 'X-Weaver-Source-URL' header (e.g. by a PreFetch hook).
+type Webhook struct {
+	URL     string
+	Timeout time.Duration
+	// Retries is the number of times a call is retried after a network
+	// error, or a 5xx response, after 1, 2, 4… seconds.
+	Retries int
+	// OnFailure is the failure policy (FailureFail, or FailureSkip).
+	// Defaults to FailureFail.
+	OnFailure string
+	// Types are the content types the webhook receives (e.g. 'text/html'),
+	// matched without their parameters. Payloads of other types, or without
+	// a body are left unchanged, except at PreFetch. Any type is received if
+	// it is empty.
+	Types []string
+}
+
+// Run calls the webhook, if it receives the payload.
+func (w Webhook) Run(p Payload) (Payload, error) {
+	if !receives(w.Types, p) {
+		return p, nil
+	}
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		out, retry, err := w.call(p)
+		if err == nil {
+			return out, nil
+		}
+		if !retry || attempt >= w.Retries {
+			if w.OnFailure == FailureSkip {
+				log.Printf("[Hooks] skipping %s transformer %s: %+v\n", p.Stage, w.URL, err)
+				return p, nil
+			}
+			return p, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// receives returns true if a payload is of one of the types (see
+// Webhook.Types).
+func receives(types []string, p Payload) bool {
+	if len(types) == 0 || p.Stage == PreFetch {
+		return true
+	}
+	if len(p.Body) == 0 {
+		return false
+	}
+	t := strings.TrimSpace(strings.SplitN(p.ContentType, ";", 2)[0])
+	for _, want := range types {
+		if strings.EqualFold(t, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// call sends the payload to the webhook, and returns the transformed
+// payload, or an error, and whether it may be retried.
+func (w Webhook) call(p Payload) (Payload, bool, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(p.Body))
+	if err != nil {
+		return p, false, err
+	}
+	if p.ContentType != "" {
+		req.Header.Set("Content-Type", p.ContentType)
+	}
+	req.Header.Set("X-Weaver-Stage", p.Stage)
+	req.Header.Set("X-Weaver-Source-URL", p.URL)
+	res, err := (&http.Client{Timeout: w.Timeout}).Do(req)
+	if err != nil {
+		return p, true, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseBytes+1))
+		if err != nil {
+			return p, true, err
+		}
+		if len(b) > maxResponseBytes {
+			return p, false, fmt.Errorf("response of %s is too large", w.URL)
+		}
+		p.Body = b
+		if ct := res.Header.Get("Content-Type"); ct != "" {
+			p.ContentType = ct
+		}
+	case http.StatusNoContent:
+	default:
+		return p, res.StatusCode >= 500, fmt.Errorf("%s responded with %s", w.URL, res.Status)
+	}
+	if u := res.Header.Get("X-Weaver-Source-URL"); u != "" {
+		p.URL = u
+	}
+	return p, false, nil
+}
+
+// ValidFailure returns true if a failure policy exists. An empty policy is
+// FailureFail.
+func ValidFailure(policy string) bool {
+	return policy == "" || policy == FailureFail || policy == FailureSkip
+}
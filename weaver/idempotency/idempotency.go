@@ -0,0 +1,141 @@
+// Package idempotency stores the responses of requests by their idempotency
+// key, so that retried requests return the original response instead of
+// being processed again.
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInProgress should be returned when a request with the same key is
+	// still being processed.
+	ErrInProgress = errors.New("a request with the same idempotency key is still in progress")
+	// ErrKeyReused should be returned when a key is reused for a different
+	// request.
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// Response is a stored response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	// response is nil while the request is in progress.
+	response *Response
+	time     time.Time
+}
+
+// Store keeps responses in memory for a ttl, up to a maximum total size of
+// their bodies (the oldest are dropped first). It is not shared between
+// instances.
+type Store struct {
+	mu       sync.Mutex
+	entries  map[string]*entry
+	order    []string
+	size     int
+	ttl      time.Duration
+	maxBytes int
+}
+
+// NewStore creates a store.
+func NewStore(ttl time.Duration, maxBytes int) *Store {
+	return &Store{entries: make(map[string]*entry), ttl: ttl, maxBytes: maxBytes}
+}
+
+// Begin claims a key for a request identified by its fingerprint (e.g. its
+// method, and URL). It returns the stored response if the key has already
+// been used for the same request. Otherwise, the key is claimed, and the
+// caller must either Finish, or Release it.
+func (s *Store) Begin(key, fingerprint string) (*Response, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+
+	if e, ok := s.entries[key]; ok {
+		if e.fingerprint != fingerprint {
+			return nil, ErrKeyReused
+		}
+		if e.response == nil {
+			return nil, ErrInProgress
+		}
+		return e.response, nil
+	}
+	s.entries[key] = &entry{fingerprint: fingerprint, time: now}
+	s.order = append(s.order, key)
+	return nil, nil
+}
+
+// Finish stores the response of a claimed key. A response larger than the
+// maximum size is not stored (the key is released).
+func (s *Store) Finish(key string, r Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if len(r.Body) > s.maxBytes {
+		s.remove(key)
+		return
+	}
+	e.response = &r
+	s.size += len(r.Body)
+	s.evict(func(*entry) bool { return s.size > s.maxBytes })
+}
+
+// Release releases a claimed key without storing a response, so that the
+// request can be retried.
+func (s *Store) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.response == nil {
+		s.remove(key)
+	}
+}
+
+// expire removes the responses older than the ttl.
+func (s *Store) expire(now time.Time) {
+	s.evict(func(e *entry) bool { return now.Sub(e.time) > s.ttl })
+}
+
+// evict removes the stored responses, oldest first, while more is true.
+// Requests in progress are kept.
+func (s *Store) evict(more func(*entry) bool) {
+	for i := 0; i < len(s.order); {
+		e := s.entries[s.order[i]]
+		if !more(e) {
+			return
+		}
+		if e.response == nil {
+			i++
+			continue
+		}
+		s.remove(s.order[i])
+	}
+}
+
+func (s *Store) remove(key string) {
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if e.response != nil {
+		s.size -= len(e.response.Body)
+	}
+	delete(s.entries, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(time.Hour, 1024)
+	if r, err := s.Begin("test-key", "GET /convert"); r != nil || err != nil {
+		t.Fatalf("expected key to be claimed, got %+v, %v", r, err)
+	}
+	if _, err := s.Begin("test-key", "GET /convert"); err != ErrInProgress {
+		t.Errorf("expected error to be %v, got %v", ErrInProgress, err)
+	}
+
+	s.Finish("test-key", Response{Status: 200, Body: []byte("test")})
+	r, err := s.Begin("test-key", "GET /convert")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got, want := string(r.Body), "test"; got != want {
+		t.Errorf("expected stored body to be %s, got %s", want, got)
+	}
+	if _, err := s.Begin("test-key", "GET /convert?ext=md"); err != ErrKeyReused {
+		t.Errorf("expected error to be %v, got %v", ErrKeyReused, err)
+	}
+}
+
+func TestStore_release(t *testing.T) {
+	s := NewStore(time.Hour, 1024)
+	s.Begin("test-key", "GET /convert")
+	s.Release("test-key")
+	if r, err := s.Begin("test-key", "GET /convert?ext=md"); r != nil || err != nil {
+		t.Errorf("expected released key to be claimed again, got %+v, %v", r, err)
+	}
+}
+
+func TestStore_expire(t *testing.T) {
+	s := NewStore(time.Millisecond, 1024)
+	s.Begin("test-key", "GET /convert")
+	s.Finish("test-key", Response{Status: 200})
+	time.Sleep(5 * time.Millisecond)
+	if r, err := s.Begin("test-key", "GET /convert"); r != nil || err != nil {
+		t.Errorf("expected expired key to be claimed again, got %+v, %v", r, err)
+	}
+}
+
+func TestStore_maxBytes(t *testing.T) {
+	s := NewStore(time.Hour, 8)
+	s.Begin("first", "GET /convert")
+	s.Finish("first", Response{Status: 200, Body: []byte("12345")})
+	s.Begin("second", "GET /convert")
+	s.Finish("second", Response{Status: 200, Body: []byte("12345")})
+	if r, _ := s.Begin("first", "GET /convert"); r != nil {
+		t.Errorf("expected oldest response to be evicted")
+	}
+	if r, _ := s.Begin("second", "GET /convert"); r == nil {
+		t.Errorf("expected newest response to be kept")
+	}
+
+	s.Begin("large", "GET /convert")
+	s.Finish("large", Response{Status: 200, Body: []byte("123456789")})
+	if r, err := s.Begin("large", "GET /convert"); r != nil || err != nil {
+		t.Errorf("expected response larger than the maximum size not to be stored, got %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package imagediff compares rendered pages pixel by pixel.
+package imagediff
+
+import (
+	"image"
+	"image/color"
+)
+
+// Highlight is the colour of different pixels in a diff image.
+var Highlight = color.RGBA{R: 255, A: 255}
+
+// Result is the outcome of a comparison.
+type Result struct {
+	// Pixels is the number of different pixels.
+	Pixels int `json:"pixels"`
+	// Total is the number of pixels compared (the area of the larger image).
+	Total int `json:"total"`
+	// Score is the fraction of different pixels (between 0, and 1).
+	Score float64 `json:"score"`
+}
+
+// Diff compares two images, and returns an image highlighting the differences
+// on top of a faded copy of the first image. Pixels differ if any of their
+// channels differ by more than the tolerance (0-255). Images of different
+// sizes are compared over the larger of the two, and pixels outside of either
+// image are treated as different.
+func Diff(a, b image.Image, tolerance uint8) (*image.RGBA, Result) {
+	ab, bb := a.Bounds(), b.Bounds()
+	w, h := max(ab.Dx(), bb.Dx()), max(ab.Dy(), bb.Dy())
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	res := Result{Total: w * h}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pa := image.Pt(ab.Min.X+x, ab.Min.Y+y)
+			pb := image.Pt(bb.Min.X+x, bb.Min.Y+y)
+			inA, inB := pa.In(ab), pb.In(bb)
+
+			if inA && inB && !differ(a.At(pa.X, pa.Y), b.At(pb.X, pb.Y), tolerance) {
+				out.Set(x, y, fade(a.At(pa.X, pa.Y)))
+				continue
+			}
+			res.Pixels++
+			out.Set(x, y, Highlight)
+		}
+	}
+
+	if res.Total > 0 {
+		res.Score = float64(res.Pixels) / float64(res.Total)
+	}
+	return out, res
+}
+
+// differ returns true if any channel of the colours differs by more than the
+// tolerance.
+func differ(c1, c2 color.Color, tolerance uint8) bool {
+	r1, g1, b1, a1 := c1.RGBA()
+	r2, g2, b2, a2 := c2.RGBA()
+	t := uint32(tolerance) << 8
+	return absDiff(r1, r2) > t || absDiff(g1, g2) > t || absDiff(b1, b2) > t || absDiff(a1, a2) > t
+}
+
+// fade returns a light grey version of a colour, so that highlighted
+// differences stand out.
+func fade(c color.Color) color.Color {
+	g := color.GrayModel.Convert(c).(color.Gray)
+	return color.Gray{Y: 192 + g.Y/4}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,42 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func mockImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDiff(t *testing.T) {
+	a := mockImage(10, 10, color.White)
+	b := mockImage(10, 10, color.White)
+	b.Set(1, 1, color.Black)
+	b.Set(2, 2, color.RGBA{R: 250, G: 250, B: 250, A: 255})
+
+	out, res := Diff(a, b, 8)
+	if got, want := res, (Result{Pixels: 1, Total: 100, Score: 0.01}); got != want {
+		t.Errorf("expected result to be %+v, got %+v", want, got)
+	}
+	if got := out.At(1, 1); got != Highlight {
+		t.Errorf("expected different pixel to be highlighted, got %+v", got)
+	}
+	if got := out.At(2, 2); got == Highlight {
+		t.Errorf("expected pixel within tolerance not to be highlighted")
+	}
+}
+
+func TestDiff_size(t *testing.T) {
+	_, res := Diff(mockImage(10, 10, color.White), mockImage(10, 20, color.White), 0)
+	if got, want := res, (Result{Pixels: 100, Total: 200, Score: 0.5}); got != want {
+		t.Errorf("expected result to be %+v, got %+v", want, got)
+	}
+}
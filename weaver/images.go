@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrImagesMarginInvalid should be returned when the margin of the pages
+	// of images is not a non-negative number of points.
+	ErrImagesMarginInvalid = errors.New("invalid margin provided (margin)")
+	// ErrImagesDPIInvalid should be returned when the resolution of images is
+	// not a positive number.
+	ErrImagesDPIInvalid = errors.New("invalid resolution provided (dpi)")
+)
+
+// imageLayout returns the layout of the pages of images of a request
+// ('page_size', 'fit', 'margin', and 'dpi').
+func imageLayout(c *gin.Context) (pdf.ImageLayout, error) {
+	var l pdf.ImageLayout
+	if err := checkPageSize(c); err != nil {
+		return l, err
+	}
+	l.Size, _ = pdf.PaperSize(c.Query("page_size"), false)
+	if l.Fit = pdf.Fit(c.Query("fit")); !l.Fit.Valid() {
+		return l, pdf.ErrFitInvalid
+	}
+	if v := c.Query("margin"); v != "" {
+		margin, err := strconv.ParseFloat(v, 64)
+		if err != nil || margin < 0 {
+			return l, ErrImagesMarginInvalid
+		}
+		l.Margin = margin
+	}
+	if v := c.Query("dpi"); v != "" {
+		dpi, err := strconv.ParseFloat(v, 64)
+		if err != nil || dpi <= 0 {
+			return l, ErrImagesDPIInvalid
+		}
+		l.DPI = dpi
+	}
+	return l, nil
+}
+
+// imagesConversion converts images to a PDF document in the work queue, so
+// that conversions are limited by the workers, and their timeout, and the
+// document can be uploaded to S3. The source of the conversion is ignored.
+type imagesConversion struct {
+	converter.UploadConversion
+	images [][]byte
+	layout pdf.ImageLayout
+}
+
+func (c imagesConversion) Convert(s converter.ConversionSource, done <-chan struct{}, progress converter.ProgressFunc) ([]byte, error) {
+	images := make([]*pdf.Image, 0, len(c.images))
+	for _, b := range c.images {
+		im, err := pdf.NewImage(b)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, im)
+	}
+	return pdf.FromImages(images, c.layout)
+}
+
+// imagesHandler converts images (PNG, JPEG, or TIFF, uploaded as 'file', and
+// fetched from their URLs, 'url') to a PDF document with a page for every
+// image, in order. The pages have the size of their image, or a paper size
+// ('page_size', in the orientation of the image), and images are scaled to
+// them ('fit', 'margin', and 'dpi', see pdf.ImageLayout). Like conversions,
+// the document is uploaded to S3 if requested.
+func imagesHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	wq := c.MustGet("queue").(chan<- converter.Work)
+
+	layout, err := imageLayout(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	images, err := readDocuments(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	for _, b := range images {
+		if !isImage(b) {
+			c.AbortWithError(http.StatusBadRequest, pdf.ErrImageInvalid).SetType(gin.ErrorTypePublic)
+			return
+		}
+	}
+
+	if err := checkRetention(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	awsConf := requestAWSS3(c, athenapdf.FormatPDF)
+	conversion := imagesConversion{
+		UploadConversion: converter.UploadConversion{AWSS3: awsConf},
+		images:           images,
+		layout:           layout,
+	}
+	work := converter.NewWork(wq, conversion, converter.ConversionSource{})
+	select {
+	case <-c.Writer.CloseNotify():
+		work.Cancel()
+	case <-work.Uploaded():
+		s.Increment("images")
+		c.JSON(http.StatusOK, uploadedResponse(c, awsConf.Object))
+	case out := <-work.Success():
+		s.Increment("images")
+		c.Header("X-Page-Count", strconv.Itoa(pdf.PageCount(out)))
+		c.Data(http.StatusOK, "application/pdf", out)
+	case err := <-work.Error():
+		s.Increment("images_error")
+		switch err {
+		case converter.ErrConversionTimeout:
+			c.AbortWithError(http.StatusGatewayTimeout, err).SetType(gin.ErrorTypePublic)
+		case pdf.ErrImageInvalid:
+			c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		default:
+			c.Error(err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func mockImagesRouter() *gin.Engine {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	pool := converter.NewPool(1, 10, 10)
+	svc := Services{Queue: pool.Queue(), Pool: pool}
+	return mockRouter(conf, svc, InitSecureRoutes)
+}
+
+func TestImagesHandler(t *testing.T) {
+	r := mockImagesRouter()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	f, _ := w.CreateFormFile("file", "scan.png")
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 200, 100)))
+	f, _ = w.CreateFormFile("file", "photo.jpg")
+	jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 100, 200)), nil)
+	w.Close()
+	req, _ := http.NewRequest("POST", "/pdf/images?auth=123456&page_size=A4&fit=cover&margin=36", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	res := streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	if got, want := res.Header().Get("X-Page-Count"), "2"; got != want {
+		t.Errorf("expected page count to be %s, got %s", want, got)
+	}
+	// The page of the wide image is in landscape
+	for _, s := range []string{"/MediaBox [0 0 842 595]", "/MediaBox [0 0 595 842]", "/Filter /DCTDecode"} {
+		if !bytes.Contains(res.Body.Bytes(), []byte(s)) {
+			t.Errorf("expected the document to contain %q", s)
+		}
+	}
+}
+
+func TestImagesHandler_invalid(t *testing.T) {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 10, 10)))
+	tests := []struct {
+		target string
+		file   []byte
+		code   int
+	}{
+		{"/pdf/images?auth=123456&fit=tile", img.Bytes(), http.StatusBadRequest},
+		{"/pdf/images?auth=123456&margin=-1", img.Bytes(), http.StatusBadRequest},
+		{"/pdf/images?auth=123456&dpi=0", img.Bytes(), http.StatusBadRequest},
+		{"/pdf/images?auth=123456&page_size=B52", img.Bytes(), http.StatusBadRequest},
+		{"/pdf/images?auth=123456", []byte("%PDF-1.4"), http.StatusBadRequest},
+		{"/pdf/images?auth=123456", []byte("GIF89a"), http.StatusBadRequest},
+	}
+	r := mockImagesRouter()
+	for _, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, uploadRequest(tt.target, "image", tt.file))
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d: %s", tt.target, want, got, res.Body.String())
+		}
+	}
+}
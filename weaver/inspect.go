@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// ErrInspectNoSource should be returned when an inspection is requested
+// without a file, or URL.
+var ErrInspectNoSource = errors.New("a PDF file, HTML file, or URL is required")
+
+// inspectHandler returns the page count, page sizes, fonts, and (optionally)
+// text of a PDF. The PDF may be uploaded, or converted from an uploaded HTML
+// file, or URL first.
+func inspectHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	_, text := c.GetQuery("text")
+
+	if _, err := chromeFlags(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var b []byte
+	if file, header, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		if b, err = ioutil.ReadAll(file); err != nil {
+			c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+			s.Increment("invalid_file")
+			return
+		}
+		if !pdf.IsPDF(b) {
+			newJob(c, header.Filename)
+			upload, err := sanitizeUpload(c, bytes.NewReader(b))
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			source, err := converter.NewConversionSource("", upload, c.Query("ext"))
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			if b, err = render(c, *source, athenapdf.FormatPDF); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+	} else if url := c.Query("url"); url != "" {
+		newJob(c, url)
+		source, err := newURLSource(c, url)
+		if err != nil {
+			abortWithSourceError(c, err)
+			return
+		}
+		if b, err = render(c, *source, athenapdf.FormatPDF); err != nil {
+			c.Error(err)
+			return
+		}
+	} else {
+		c.AbortWithError(http.StatusBadRequest, ErrInspectNoSource).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	info, err := pdf.Inspect(b, text)
+	if err != nil {
+		c.AbortWithError(http.StatusUnprocessableEntity, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	s.Increment("inspect")
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+func mockInspectRouter() *gin.Engine {
+	return mockRouter(Config{}, Services{}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/inspect", inspectHandler)
+	})
+}
+
+func TestInspectHandler(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	f, _ := w.CreateFormFile("file", "test.pdf")
+	f.Write(b)
+	w.Close()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/inspect?text", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	mockInspectRouter().ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+
+	var info pdf.Info
+	if err := json.Unmarshal(res.Body.Bytes(), &info); err != nil {
+		t.Fatalf("unable to decode response: %+v", err)
+	}
+	if got, want := info.PageCount, 1; got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+	if got, want := info.Pages[0].Text, "hello world"; got != want {
+		t.Errorf("expected page text to be %q, got %q", want, got)
+	}
+}
+
+func TestInspectHandler_noSource(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/inspect", nil)
+	mockInspectRouter().ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+)
+
+// maxJobsLimit is the maximum number of jobs returned by GET /jobs.
+const maxJobsLimit = 1000
+
+// keepAliveInterval is the interval of the comments sent to keep job event
+// streams open through proxies.
+var keepAliveInterval = 15 * time.Second
+
+var (
+	// ErrJobQueryInvalid should be returned when the filters of a job
+	// history query are invalid.
+	ErrJobQueryInvalid = errors.New("invalid job query (use from, and to as RFC 3339 times or YYYY-MM-DD dates, status as completed or failed, and limit as 1-1000)")
+	// ErrJobNotFound should be returned when the progress of a job is not
+	// known (by this instance).
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// sourceDomain returns the host of a source URL, or an empty string for
+// uploaded files.
+func sourceDomain(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// RecordJobMiddleware records the conversion of a request to the job store
+// once it has finished. Asynchronous conversions are recorded by the
+// consumer instead.
+func RecordJobMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		id := c.GetString("job")
+		if id == "" || c.Writer.Status() == http.StatusAccepted {
+			return
+		}
+		format, _ := outputFormat(c)
+		source := c.GetString("source")
+		j := history.Job{
+			ID:         id,
+			RequestID:  c.GetString("request_id"),
+			Time:       time.Now().UTC(),
+			Status:     history.StatusCompleted,
+			Tenant:     tenantID(c),
+			Subject:    c.Query("subject"),
+			Source:     redactURL(source),
+			Domain:     sourceDomain(source),
+			Format:     format,
+			Engine:     c.GetString("engine"),
+			DurationMS: int64(time.Since(start) / time.Millisecond),
+			S3Region:   c.Query("aws_region"),
+			S3Bucket:   c.Query("s3_bucket"),
+			S3Key:      c.Query("s3_key"),
+		}
+		if report, ok := c.Get("report"); ok {
+			fillJob(&j, report.(*converter.Report))
+		}
+		if o, ok := c.Get("s3_object"); ok && o.(*converter.S3Object).Key != "" {
+			j.S3Region = o.(*converter.S3Object).Region
+			j.S3Key = o.(*converter.S3Object).Key
+		}
+		if lastError := c.Errors.Last(); lastError != nil {
+			j.Status = history.StatusFailed
+			j.Code = lastErrorCode(c, lastError)
+			j.Error = lastError.Error()
+		} else if c.Writer.Status() >= 400 {
+			j.Status = history.StatusFailed
+		}
+
+		if err := c.MustGet("history").(history.Store).Add(j); err != nil {
+			log.Printf("[History] unable to record job %s: %+v\n", id, err)
+		}
+	}
+}
+
+// fillJob sets the output metadata of a job record from a conversion report.
+func fillJob(j *history.Job, r *converter.Report) {
+	j.Pages = r.Pages
+	j.Bytes = r.Bytes
+	j.QueueWaitMS = int64(r.QueueWait / time.Millisecond)
+	j.Diagnostics = r.Diagnostics
+	if r.Duration > 0 {
+		j.DurationMS = int64(r.Duration / time.Millisecond)
+	}
+}
+
+// asyncJob returns the record of a finished asynchronous job.
+func asyncJob(j queue.Job, r *converter.Report, err error) history.Job {
+	h := history.Job{
+		ID:        j.ID,
+		RequestID: j.RequestID,
+		Time:      time.Now().UTC(),
+		Status:    history.StatusCompleted,
+		Tenant:    j.Tenant,
+		Subject:   j.Subject,
+		Source:    redactURL(j.URL),
+		Domain:    sourceDomain(j.URL),
+		Format:    j.Format,
+		Engine:    "athenapdf",
+		S3Region:  j.AWSS3.Region,
+		S3Bucket:  j.AWSS3.S3Bucket,
+		S3Key:     j.AWSS3.S3Key,
+	}
+	if h.Format == "" {
+		h.Format = athenapdf.FormatPDF
+	}
+	if o := j.AWSS3.Object; o != nil && o.Key != "" {
+		h.S3Region = o.Region
+		h.S3Key = o.Key
+	}
+	if r != nil {
+		fillJob(&h, r)
+	}
+	if err != nil {
+		h.Status = history.StatusFailed
+		h.Code = errorCode(err, http.StatusInternalServerError)
+		h.Error = err.Error()
+	}
+	return h
+}
+
+// parseJobTime parses an RFC 3339 time, or a YYYY-MM-DD date (UTC).
+func parseJobTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// jobQuery returns the job history query of a request. Tenants may only
+// query their own jobs.
+func jobQuery(c *gin.Context) (history.Query, error) {
+	q := history.Query{
+		Status: c.Query("status"),
+		Tenant: c.Query("tenant"),
+		Domain: c.Query("domain"),
+	}
+	if id := tenantID(c); id != "" {
+		q.Tenant = id
+	}
+	if q.Status != "" && q.Status != history.StatusCompleted && q.Status != history.StatusFailed {
+		return q, ErrJobQueryInvalid
+	}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if q.From, err = parseJobTime(from); err != nil {
+			return q, ErrJobQueryInvalid
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if q.To, err = parseJobTime(to); err != nil {
+			return q, ErrJobQueryInvalid
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 || q.Limit > maxJobsLimit {
+			return q, ErrJobQueryInvalid
+		}
+	}
+	return q, nil
+}
+
+// jobsHandler returns the finished jobs matching the query, newest first.
+func jobsHandler(c *gin.Context) {
+	q, err := jobQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	jobs, err := c.MustGet("history").(history.Store).Find(q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if jobs == nil {
+		jobs = []history.Job{}
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// jobEventsHandler streams the stages of an asynchronous job as server-sent
+// events, until the job has completed or failed. Each event is named after
+// its stage, and its ID is the sequence number of the update, so that a
+// reconnecting client (with a Last-Event-ID header) only receives the
+// updates it has missed.
+func jobEventsHandler(c *gin.Context) {
+	t := c.MustGet("progress").(*progress.Tracker)
+	id := c.Param("id")
+	updates, ch, cancel, ok := t.Subscribe(id, tenantID(c))
+	if !ok {
+		c.AbortWithError(http.StatusNotFound, ErrJobNotFound).SetType(gin.ErrorTypePublic)
+		return
+	}
+	defer cancel()
+
+	last, _ := strconv.Atoi(c.Request.Header.Get("Last-Event-ID"))
+	send := func(w io.Writer, updates ...progress.Update) {
+		for _, u := range updates {
+			if u.Seq <= last {
+				continue
+			}
+			b, _ := json.Marshal(u)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", u.Seq, u.Stage, b)
+			last = u.Seq
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	send(c.Writer, updates...)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case u, ok := <-ch:
+			if !ok {
+				// The final update may have been dropped
+				send(w, t.Updates(id)...)
+				return false
+			}
+			send(w, u)
+			return true
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func TestJobQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		tenant string
+		want   string
+		err    error
+	}{
+		{"", "", "", nil},
+		{"?tenant=acme&status=failed&from=2018-06-01&to=2018-06-02T12:00:00Z&limit=10", "", "acme", nil},
+		{"?tenant=globex", "acme", "acme", nil},
+		{"?status=queued", "", "", ErrJobQueryInvalid},
+		{"?from=yesterday", "", "", ErrJobQueryInvalid},
+		{"?limit=1001", "", "", ErrJobQueryInvalid},
+	}
+	for _, tt := range tests {
+		var got history.Query
+		var err error
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			if tt.tenant != "" {
+				c.Set("tenant", tenant.Tenant{ID: tt.tenant})
+			}
+			got, err = jobQuery(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if err != tt.err {
+			t.Errorf("expected query %q to return %v, got %v", tt.query, tt.err, err)
+		}
+		if err == nil && got.Tenant != tt.want {
+			t.Errorf("expected tenant of query %q to be %q, got %q", tt.query, tt.want, got.Tenant)
+		}
+	}
+}
+
+func TestRecordJobMiddleware(t *testing.T) {
+	store := history.NewMemoryStore(10)
+	r := gin.New()
+	r.Use(HistoryMiddleware(store))
+	r.Use(RecordJobMiddleware())
+	r.GET("/convert", func(c *gin.Context) {
+		newJob(c, c.Query("url"))
+		c.AbortWithError(http.StatusBadRequest, ErrFormatInvalid).SetType(gin.ErrorTypePublic)
+	})
+	r.GET("/jobs", jobsHandler)
+
+	req, _ := http.NewRequest("GET", "/convert?url=https%3A%2F%2Fuser%3Apass%40invoices.example.com%2F1%3Ftoken%3Dsecret", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	res := httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/jobs?status=failed&domain=example.com", nil)
+	r.ServeHTTP(res, req)
+	var body struct {
+		Jobs []history.Job `json:"jobs"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unable to decode jobs: %+v", err)
+	}
+	if len(body.Jobs) != 1 {
+		t.Fatalf("expected 1 job, got %+v", body.Jobs)
+	}
+	j := body.Jobs[0]
+	if got, want := j.Source, "https://REDACTED@invoices.example.com/1?token=REDACTED"; got != want {
+		t.Errorf("expected job source to be %s, got %s", want, got)
+	}
+	if got, want := j.Code, CodeInvalidOptions; got != want {
+		t.Errorf("expected job code to be %s, got %s", want, got)
+	}
+}
+
+func TestAsyncJob(t *testing.T) {
+	j := asyncJob(queue.Job{ID: "test-job", URL: "https://example.com"}, nil, errors.New("test error"))
+	if got, want := j.Status, history.StatusFailed; got != want {
+		t.Errorf("expected job status to be %s, got %s", want, got)
+	}
+	if got, want := j.Format, "pdf"; got != want {
+		t.Errorf("expected job format to be %s, got %s", want, got)
+	}
+}
+
+func TestAsyncJob_contentAddressed(t *testing.T) {
+	qj := queue.Job{ID: "test-job", URL: "https://example.com"}
+	qj.AWSS3.S3Key = "reports/"
+	qj.AWSS3.Object = &converter.S3Object{Key: "reports/0123abcd"}
+	j := asyncJob(qj, nil, nil)
+	if got, want := j.S3Key, "reports/0123abcd"; got != want {
+		t.Errorf("expected job S3 key to be %s, got %s", want, got)
+	}
+}
+
+// streamRecorder is a response recorder for streaming handlers, which
+// require a close notifier.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func TestJobEventsHandler(t *testing.T) {
+	tr := progress.NewTracker(time.Hour)
+	tr.Set("test-job", "acme", progress.Queued, nil)
+	tr.Set("test-job", "acme", progress.Rendering, nil)
+	r := gin.New()
+	r.Use(ProgressMiddleware(tr))
+	r.GET("/jobs/:id/events", func(c *gin.Context) {
+		if id := c.Query("tenant"); id != "" {
+			c.Set("tenant", tenant.Tenant{ID: id})
+		}
+		jobEventsHandler(c)
+	})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tr.Set("test-job", "acme", progress.Completed, nil)
+	}()
+
+	tests := []struct {
+		path        string
+		lastEventID string
+		code        int
+		stages      []string
+	}{
+		{"/jobs/test-job/events", "", http.StatusOK, []string{"queued", "rendering", "completed"}},
+		{"/jobs/test-job/events?tenant=acme", "2", http.StatusOK, []string{"completed"}},
+		{"/jobs/test-job/events?tenant=globex", "", http.StatusNotFound, nil},
+		{"/jobs/unknown-job/events", "", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Last-Event-ID", tt.lastEventID)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected %s to return %d, got %d", tt.path, want, got)
+			continue
+		}
+		var stages []string
+		for _, line := range strings.Split(res.Body.String(), "\n") {
+			if strings.HasPrefix(line, "event: ") {
+				stages = append(stages, strings.TrimPrefix(line, "event: "))
+			}
+		}
+		if got, want := strings.Join(stages, ","), strings.Join(tt.stages, ","); got != want {
+			t.Errorf("expected %s to stream %s, got %s", tt.path, want, got)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxSocketPath is the maximum length of the path of a Unix socket
+// (sun_path, without its terminating null byte).
+const maxSocketPath = 107
+
+// defaultSocketMode is the default permissions of the Unix socket: the user,
+// and group of weaver (e.g. shared with the reverse proxy) may connect.
+const defaultSocketMode os.FileMode = 0660
+
+// ErrSocketInUse should be returned when the path of the Unix socket exists,
+// and is not a socket (which is removed, if it was left behind).
+var ErrSocketInUse = errors.New("the path of the Unix socket exists, and is not a socket")
+
+// socketMode returns the permissions of the Unix socket.
+func (c Config) socketMode() (os.FileMode, error) {
+	if c.SocketMode == "" {
+		return defaultSocketMode, nil
+	}
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, strconv.ErrSyntax
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenUnix listens on the Unix socket at path, with the given permissions.
+// A socket left behind by a previous process (which did not exit cleanly) is
+// removed first. The socket is removed once the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, ErrSocketInUse
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// listenAddrs splits a comma-separated list of listen addresses.
+func listenAddrs(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// listenNetwork returns the network of the HTTP, and HTTPS listeners.
+func (c Config) listenNetwork() string {
+	if c.ListenNetwork == "" {
+		return "tcp"
+	}
+	return c.ListenNetwork
+}
+
+// listener is a listener of a server of the microservice.
+type listener struct {
+	net.Listener
+	srv *http.Server
+	// secure is whether the listener serves HTTPS.
+	secure bool
+}
+
+// startServers listens on every address of the HTTPS server, and of the HTTP
+// server (or its Unix socket), if it is served, and serves handler on them.
+// Every listener is opened before any is served, so that an address in use
+// fails the startup. An error of a listener once it is served is fatal.
+func startServers(conf Config, handler http.Handler) ([]*http.Server, error) {
+	var listeners []listener
+	fail := func(err error) ([]*http.Server, error) {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return nil, err
+	}
+
+	for _, addr := range listenAddrs(conf.HTTPSAddr) {
+		srv, err := newHTTPSServer(addr, handler)
+		if err != nil {
+			return fail(err)
+		}
+		ln, err := net.Listen(conf.listenNetwork(), addr)
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, listener{ln, srv, true})
+	}
+
+	if conf.HTTPSAddr == "" || conf.HTTPWithHTTPS {
+		if conf.Socket != "" {
+			mode, err := conf.socketMode()
+			if err != nil {
+				return fail(err)
+			}
+			ln, err := listenUnix(conf.Socket, mode)
+			if err != nil {
+				return fail(err)
+			}
+			listeners = append(listeners, listener{ln, &http.Server{Addr: conf.Socket, Handler: handler}, false})
+		} else {
+			for _, addr := range listenAddrs(conf.HTTPAddr) {
+				ln, err := net.Listen(conf.listenNetwork(), addr)
+				if err != nil {
+					return fail(err)
+				}
+				listeners = append(listeners, listener{ln, &http.Server{Addr: addr, Handler: handler}, false})
+			}
+		}
+	}
+
+	servers := make([]*http.Server, len(listeners))
+	for i, ln := range listeners {
+		servers[i] = ln.srv
+		log.Printf("Listening on %s (%s)\n", ln.Addr(), ln.Addr().Network())
+		go func(ln listener) {
+			var err error
+			if ln.secure {
+				err = ln.srv.ServeTLS(ln, conf.TLSCertFile, conf.TLSKeyFile)
+			} else {
+				err = ln.srv.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}(ln)
+	}
+	return servers, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocketMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want os.FileMode
+		ok   bool
+	}{
+		{"", 0660, true},
+		{"0600", 0600, true},
+		{"777", 0777, true},
+		{"0999", 0, false},
+		{"01777", 0, false},
+		{"rw", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Config{SocketMode: tt.mode}.socketMode()
+		if (err == nil) != tt.ok {
+			t.Errorf("expected mode %q to be valid: %v, got %+v", tt.mode, tt.ok, err)
+		} else if got != tt.want {
+			t.Errorf("expected mode %q to be %o, got %o", tt.mode, tt.want, got)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weaver-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "weaver.sock")
+
+	// A socket left behind is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("expected listener, got %+v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("expected socket mode %o, got %o", want, got)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go srv.Serve(ln)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := client.Get("http://weaver/")
+	if err != nil {
+		t.Fatalf("expected response over the socket, got %+v", err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if got, want := string(b), "ok"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+
+	srv.Shutdown(context.Background())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed on shutdown, got %+v", err)
+	}
+}
+
+func TestListenUnixInUse(t *testing.T) {
+	f, err := ioutil.TempFile("", "weaver-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if _, err := listenUnix(f.Name(), 0660); err != ErrSocketInUse {
+		t.Errorf("expected %v, got %+v", ErrSocketInUse, err)
+	}
+}
+
+// freeAddr returns an address of the loopback interface nothing listens on.
+func freeAddr(t *testing.T, network, host string) string {
+	ln, err := net.Listen(network, net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("%s is not available: %v", network, err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// writeTestCertificate writes the certificate, and key of httptest to dir.
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	cert := srv.TLS.Certificates[0]
+	srv.Close()
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+	return certFile, keyFile
+}
+
+func TestListenAddrs(t *testing.T) {
+	got := listenAddrs(" 127.0.0.1:8080, [::1]:8080,,")
+	if len(got) != 2 || got[0] != "127.0.0.1:8080" || got[1] != "[::1]:8080" {
+		t.Errorf("expected 2 addresses, got %q", got)
+	}
+	if got := listenAddrs(""); len(got) != 0 {
+		t.Errorf("expected no addresses, got %q", got)
+	}
+}
+
+func TestStartServers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weaver-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	httpAddr, httpsAddr := freeAddr(t, "tcp4", "127.0.0.1"), freeAddr(t, "tcp6", "::1")
+	conf := Config{
+		HTTPAddr:      httpAddr,
+		HTTPSAddr:     httpsAddr,
+		HTTPWithHTTPS: true,
+		TLSCertFile:   certFile,
+		TLSKeyFile:    keyFile,
+	}
+	servers, err := startServers(conf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if err != nil {
+		t.Fatalf("expected servers, got %+v", err)
+	}
+	defer shutdownServers(servers, time.Second*5)
+	if got, want := len(servers), 2; got != want {
+		t.Fatalf("expected %d servers, got %d", want, got)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	tests := []struct {
+		url   string
+		proto string
+	}{
+		{"http://" + httpAddr + "/", "HTTP/1.1"},
+		{"https://" + httpsAddr + "/", "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		res, err := client.Get(tt.url)
+		if err != nil {
+			t.Errorf("expected response from %s, got %+v", tt.url, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if got := string(b); got != tt.proto {
+			t.Errorf("expected %s from %s, got %s", tt.proto, tt.url, got)
+		}
+	}
+}
+
+func TestStartServersAddrInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	free := freeAddr(t, "tcp", "127.0.0.1")
+	conf := Config{HTTPAddr: free + "," + ln.Addr().String()}
+	if _, err := startServers(conf, http.NotFoundHandler()); err == nil {
+		t.Fatal("expected an address in use to fail")
+	}
+	// The listeners opened before are closed
+	ln2, err := net.Listen("tcp", free)
+	if err != nil {
+		t.Errorf("expected %s to be closed, got %+v", free, err)
+	} else {
+		ln2.Close()
+	}
+}
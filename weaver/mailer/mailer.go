@@ -0,0 +1,183 @@
+// Package mailer sends email messages, with attachments, through an SMTP
+// server (e.g. the relay of a domain, or a transactional email service).
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// dialTimeout is the timeout of connecting to the SMTP server.
+	dialTimeout = time.Second * 30
+	// sendTimeout is the timeout of sending a message, once connected.
+	sendTimeout = time.Minute * 2
+)
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email message, with a plain text body.
+type Message struct {
+	From        string
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Bytes returns the message as a MIME message (RFC 5322), with its
+// attachments as base64 encoded parts.
+func (m Message) Bytes() []byte {
+	b := new(bytes.Buffer)
+	h := textproto.MIMEHeader{}
+	h.Set("From", m.From)
+	h.Set("To", strings.Join(m.To, ", "))
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("Message-Id", messageID(m.From))
+	h.Set("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(b, h)
+		writeText(b, m.Body)
+		return b.Bytes()
+	}
+
+	w := multipart.NewWriter(b)
+	h.Set("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	writeHeader(b, h)
+	part, _ := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	writeText(part, m.Body)
+	for _, a := range m.Attachments {
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		writeBase64(part, a.Data)
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+func writeHeader(b *bytes.Buffer, h textproto.MIMEHeader) {
+	for _, k := range []string{"From", "To", "Subject", "Date", "Message-Id", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		fmt.Fprintf(b, "%s: %s\r\n", k, h.Get(k))
+	}
+	b.WriteString("\r\n")
+}
+
+func writeText(w io.Writer, s string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(strings.Replace(s, "\n", "\r\n", -1)))
+	qp.Close()
+}
+
+// writeBase64 writes base64 encoded data in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	s := base64.StdEncoding.EncodeToString(data)
+	for len(s) > 76 {
+		w.Write([]byte(s[:76] + "\r\n"))
+		s = s[76:]
+	}
+	w.Write([]byte(s + "\r\n"))
+}
+
+// messageID returns a unique message ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "weaver"
+	if a, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndexByte(a.Address, '@'); i >= 0 {
+			domain = a.Address[i+1:]
+		}
+	}
+	r := make([]byte, 16)
+	rand.Read(r)
+	return fmt.Sprintf("<%x.%d@%s>", r, time.Now().UnixNano(), domain)
+}
+
+// Client sends messages through an SMTP server. The connection is upgraded
+// with STARTTLS if the server supports it, which is required to
+// authenticate, unless the server is on localhost.
+type Client struct {
+	// Addr is the HOST:PORT address of the SMTP server.
+	Addr     string
+	Username string
+	Password string
+}
+
+// Send sends a message to its recipients.
+func (c Client) Send(m Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", c.Addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/smtpd"
+)
+
+func TestMessageBytes(t *testing.T) {
+	m := Message{
+		From:        "Weaver <weaver@example.com>",
+		To:          []string{"a@example.com", "b@example.com"},
+		Subject:     "Rapport trimestriel prêt",
+		Body:        "Your document is ready.\n",
+		Attachments: []Attachment{{Name: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")}},
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := new(mime.WordDecoder)
+	if got, _ := dec.DecodeHeader(msg.Header.Get("Subject")); got != m.Subject {
+		t.Errorf("expected subject %q, got %q", m.Subject, got)
+	}
+	if got, want := msg.Header.Get("To"), "a@example.com, b@example.com"; got != want {
+		t.Errorf("expected to %q, got %q", want, got)
+	}
+	if msg.Header.Get("Message-Id") == "" {
+		t.Error("expected a message ID")
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(quotedprintable.NewReader(body)); string(b) != "Your document is ready.\r\n" {
+		t.Errorf("expected the body, got %q", b)
+	}
+	attachment, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := attachment.FileName(), "report.pdf"; got != want {
+		t.Errorf("expected file name %q, got %q", want, got)
+	}
+	if b, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment)); string(b) != "%PDF-1.4" {
+		t.Errorf("expected the attachment, got %q", b)
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan smtpd.Envelope, 1)
+	s := &smtpd.Server{Hostname: "mail.test", MaxBytes: 1 << 20, Handle: func(e smtpd.Envelope) error {
+		received <- e
+		return nil
+	}}
+	go s.Serve(l)
+	defer s.Close()
+
+	m := Message{From: "Weaver <weaver@example.com>", To: []string{"a@example.com"}, Subject: "Ready", Body: "Hello"}
+	if err := (Client{Addr: l.Addr().String()}).Send(m); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	e := <-received
+	if got, want := e.From, "weaver@example.com"; got != want {
+		t.Errorf("expected from %q, got %q", want, got)
+	}
+	if len(e.To) != 1 || e.To[0] != "a@example.com" {
+		t.Errorf("expected to [a@example.com], got %v", e.To)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(e.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := msg.Header.Get("Subject"), "Ready"; got != want {
+		t.Errorf("expected subject %q, got %q", want, got)
+	}
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,40 +21,531 @@ import (
 	"github.com/getsentry/raven-go"
 	"github.com/gin-gonic/contrib/sentry"
 	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/audit"
+	"github.com/lachee/athenapdf/weaver/breaker"
 	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/fonts"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"github.com/lachee/athenapdf/weaver/idempotency"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/policy"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/postgres"
+	"github.com/lachee/athenapdf/weaver/preset"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"github.com/lachee/athenapdf/weaver/sandbox"
+	"github.com/lachee/athenapdf/weaver/scheduler"
+	"github.com/lachee/athenapdf/weaver/spool"
+	"github.com/lachee/athenapdf/weaver/sqlite"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/lachee/athenapdf/weaver/tus"
+	"golang.org/x/net/http2"
 	"gopkg.in/alexcesaro/statsd.v2"
 )
 
-// InitMiddleware sets up the necessary middlewares for the microservice.
-// These include middlewares to establish a sane context containing access to
-// the configuration, worker queue, statsd client, and Sentry client (Raven).
-// The latter two are disabled in debugging mode to avoid contaminating
-// production stats.
-// It will also set up a middleware for catching, and handling errors thrown
-// from a route.
-func InitMiddleware(router *gin.Engine, conf Config) {
-	// Config
-	router.Use(ConfigMiddleware(conf))
+var (
+	// ErrUnknownAuditSink should be returned when an unsupported audit sink
+	// is configured.
+	ErrUnknownAuditSink = errors.New("unknown audit sink")
+	// ErrUnknownHistoryDriver should be returned when an unsupported job
+	// store is configured.
+	ErrUnknownHistoryDriver = errors.New("unknown history driver")
+	// ErrUnknownRegistryDriver should be returned when an unsupported
+	// document registry store is configured.
+	ErrUnknownRegistryDriver = errors.New("unknown registry driver")
+	// ErrUnknownRetentionDriver should be returned when an unsupported store
+	// of scheduled deletions is configured.
+	ErrUnknownRetentionDriver = errors.New("unknown retention driver")
+)
 
-	// Worker queue
-	wq := converter.InitWorkers(conf.MaxWorkers, conf.MaxConversionQueue, conf.WorkerTimeout)
-	router.Use(WorkQueueMiddleware(wq))
+// progressTTL is the time the progress of a job is kept after its last
+// update.
+const progressTTL = time.Hour
 
-	// Statsd
+// NewStatsd creates a statsd client using the statsd configuration.
+// It is muted in debugging mode to avoid contaminating production stats.
+func NewStatsd(conf Config) *statsd.Client {
 	muteStatsd := gin.IsDebugging()
 	if conf.Statsd.Address == "" {
 		muteStatsd = true
 	}
-	s, err := statsd.New(
+	opts := []statsd.Option{
 		statsd.Address(conf.Statsd.Address),
 		statsd.Prefix(conf.Statsd.Prefix),
-		statsd.FlushPeriod(time.Millisecond*500),
+		statsd.FlushPeriod(time.Millisecond * 500),
 		statsd.Mute(muteStatsd),
-	)
+	}
+	if tf, ok := conf.Statsd.TagFormat(); ok {
+		opts = append(opts, statsd.TagsFormat(tf))
+	}
+	s, err := statsd.New(opts...)
 	if err != nil {
 		panic(err)
 	}
-	router.Use(StatsdMiddleware(s))
+	return s
+}
+
+// NewPublisher creates a lifecycle event publisher using the Kafka
+// configuration, which redacts the sources of events (as the job history
+// does). It returns a nil publisher if no Kafka brokers are configured.
+func NewPublisher(conf Config) events.Publisher {
+	if len(conf.Kafka.Brokers) == 0 {
+		return nil
+	}
+	return events.WithRedaction(events.NewKafkaPublisher(conf.Kafka.Brokers, conf.Kafka.Topic), redactURL)
+}
+
+// NewSQLite opens the embedded SQLite database. It returns a nil database if
+// none is configured.
+func NewSQLite(conf Config) (*sql.DB, error) {
+	if conf.SQLitePath == "" {
+		return nil, nil
+	}
+	return sqlite.Open(conf.SQLitePath)
+}
+
+// NewTenants creates the tenant registry, and usage accountant using the
+// multi-tenancy configuration. Tenants are read from the tenants file, or
+// the SQLite database (db), which also stores their usage. It returns nil
+// for both if multi-tenancy is disabled.
+func NewTenants(conf Config, db *sql.DB) (*tenant.Registry, *tenant.Accountant, error) {
+	var r *tenant.Registry
+	var err error
+	switch {
+	case conf.TenantsFile != "":
+		r, err = tenant.LoadRegistry(conf.TenantsFile)
+	case db != nil:
+		r, err = tenant.LoadSQLiteRegistry(db)
+	default:
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var a *tenant.Accountant
+	if db != nil {
+		a, err = tenant.NewStoreAccountant(tenant.NewSQLiteUsageStore(db))
+	} else {
+		a, err = tenant.NewAccountant(conf.UsageFile)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, a, nil
+}
+
+// NewFonts creates the runtime font store. It returns a nil store if the
+// fonts API is disabled.
+func NewFonts(conf Config) (*fonts.Store, error) {
+	if conf.FontsDir == "" {
+		return nil, nil
+	}
+	store, err := fonts.NewStore(conf.FontsDir)
+	if err != nil {
+		return nil, err
+	}
+	store.MaxBytes = conf.FontsMaxBytes
+	return store, nil
+}
+
+// NewAuditSink creates an audit sink using the audit configuration, and
+// starts enforcing its retention period. It returns a nil sink if auditing
+// is disabled.
+func NewAuditSink(conf Config, done <-chan struct{}) (audit.Sink, error) {
+	var sink audit.Sink
+	switch conf.Audit.Sink {
+	case "":
+		return nil, nil
+	case "file":
+		s, err := audit.NewFileSink(conf.Audit.Dir)
+		if err != nil {
+			return nil, err
+		}
+		sink = s
+	case "s3":
+		sink = audit.NewS3Sink(conf.Audit.Region, conf.Audit.S3Bucket, conf.Audit.S3Prefix, time.Minute, done)
+	default:
+		return nil, ErrUnknownAuditSink
+	}
+	audit.StartRetention(sink, time.Hour*24*time.Duration(conf.Audit.RetentionDays), done)
+	return sink, nil
+}
+
+// NewHistory creates the job store using the history configuration, and the
+// SQLite database (db) for the 'sqlite' driver. It returns a nil store if the
+// history is disabled.
+func NewHistory(conf Config, db *sql.DB) (history.Store, error) {
+	switch conf.History.Driver {
+	case "":
+		return nil, nil
+	case "memory":
+		return history.NewMemoryStore(conf.History.MaxJobs), nil
+	case "file":
+		s, err := history.NewFileStore(conf.History.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "postgres":
+		db, err := postgres.Open(conf.History.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return history.NewPostgresStore(db), nil
+	case "sqlite":
+		if db == nil {
+			return nil, ErrSQLiteDisabled
+		}
+		return history.NewSQLiteStore(db), nil
+	}
+	return nil, ErrUnknownHistoryDriver
+}
+
+// NewRegistry creates the document registry using the registry
+// configuration, and the SQLite database (db) for the 'sqlite' driver. It
+// returns a nil store if the registry is disabled.
+func NewRegistry(conf Config, db *sql.DB) (registry.Store, error) {
+	switch conf.Registry.Driver {
+	case "":
+		return nil, nil
+	case "memory":
+		return registry.NewMemoryStore(conf.Registry.MaxRecords), nil
+	case "file":
+		s, err := registry.NewFileStore(conf.Registry.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "postgres":
+		db, err := postgres.Open(conf.Registry.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return registry.NewSQLStore(db), nil
+	case "sqlite":
+		if db == nil {
+			return nil, ErrSQLiteDisabled
+		}
+		return registry.NewSQLStore(db), nil
+	}
+	return nil, ErrUnknownRegistryDriver
+}
+
+// NewRetention creates the store of the scheduled deletions of uploaded
+// outputs using the retention configuration, and an optional SQLite database
+// (see NewSQLite). It returns a nil store if the janitor is disabled.
+func NewRetention(conf Config, db *sql.DB) (retention.Store, error) {
+	switch conf.Retention.Driver {
+	case "":
+		return nil, nil
+	case "memory":
+		return retention.NewMemoryStore(), nil
+	case "file":
+		s, err := retention.NewFileStore(conf.Retention.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "postgres":
+		db, err := postgres.Open(conf.Retention.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return retention.NewSQLStore(db), nil
+	case "sqlite":
+		if db == nil {
+			return nil, ErrSQLiteDisabled
+		}
+		return retention.NewSQLStore(db), nil
+	}
+	return nil, ErrUnknownRetentionDriver
+}
+
+// NewIdempotency creates the store of responses to requests with an
+// idempotency key. It returns nil if idempotency keys are disabled.
+func NewIdempotency(conf Config) *idempotency.Store {
+	if conf.Idempotency.TTL == 0 {
+		return nil
+	}
+	return idempotency.NewStore(time.Second*time.Duration(conf.Idempotency.TTL), conf.Idempotency.MaxBytes)
+}
+
+// NewSpool creates the spool of intermediate artifacts (creating its
+// directory). It returns nil if the system temporary directory is used
+// without a quota.
+func NewSpool(conf Config) (*spool.Spool, error) {
+	if conf.Spool.Dir == "" && conf.Spool.MaxBytes == 0 {
+		return nil, nil
+	}
+	if conf.Spool.Dir != "" {
+		if err := os.MkdirAll(conf.Spool.Dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return spool.New(conf.Spool.Dir, int64(conf.Spool.MaxBytes)), nil
+}
+
+// NewSandboxes creates the pool of sandboxes of conversions (see Sandbox),
+// confined by the seccomp filter, and AppArmor profile, or running in gVisor
+// containers, if any.
+func NewSandboxes(conf Config) (*sandbox.Pool, error) {
+	dir := conf.Sandbox.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "weaver-sandbox")
+	}
+	first, last, err := conf.Sandbox.uidRange()
+	if err != nil {
+		return nil, err
+	}
+	p, err := sandbox.NewPool(dir, first, last, conf.Sandbox.UserNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Sandbox.Seccomp != "" || conf.Sandbox.AppArmor != "" {
+		// Conversions are confined by running them through weaver
+		launcher, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		c := sandbox.Confinement{Seccomp: conf.Sandbox.Seccomp, AppArmor: conf.Sandbox.AppArmor}
+		if err := p.Confine(launcher, c); err != nil {
+			return nil, fmt.Errorf("unable to confine conversions: %v", err)
+		}
+	}
+	if conf.Sandbox.Runtime == "gvisor" {
+		g := sandbox.GVisor{
+			Runsc:    conf.Sandbox.Runsc,
+			Rootfs:   conf.Sandbox.Rootfs,
+			NetNS:    conf.Sandbox.NetNS,
+			Platform: conf.Sandbox.Platform,
+			Warm:     conf.Sandbox.warm(conf.MaxWorkers),
+		}
+		if g.Runsc == "" {
+			g.Runsc = "runsc"
+		}
+		if err := p.UseGVisor(g); err != nil {
+			return nil, fmt.Errorf("unable to use gVisor: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// NewOutputCache creates the cache of conversion outputs. It returns nil if
+// the cache is disabled.
+func NewOutputCache(conf Config) *outputcache.Store {
+	if conf.OutputCache.MaxBytes == 0 {
+		return nil
+	}
+	return outputcache.NewStore(time.Second*time.Duration(conf.OutputCache.TTL), conf.OutputCache.MaxBytes)
+}
+
+// NewBreaker creates the circuit breakers of source hosts. It returns nil if
+// they are disabled.
+func NewBreaker(conf Config) *breaker.Breaker {
+	if conf.Breaker.Threshold == 0 {
+		return nil
+	}
+	return breaker.New(conf.Breaker.Threshold, time.Second*time.Duration(conf.Breaker.Cooldown))
+}
+
+// NewHooks creates the hooks of the conversion pipeline: the hooks of the Go
+// plugins, followed by the WASM plugins, and the external transformers (the
+// webhooks, and then the transformers of the config file). It returns nil if
+// there are none.
+func NewHooks(conf Config) (*hooks.Pipeline, error) {
+	if len(conf.Hooks.Plugins) == 0 && len(conf.Hooks.WASM) == 0 && len(conf.Hooks.Webhooks) == 0 && len(conf.Hooks.Transformers) == 0 {
+		return nil, nil
+	}
+	p := hooks.New()
+	for _, path := range conf.Hooks.Plugins {
+		if err := hooks.LoadPlugin(p, path); err != nil {
+			return nil, err
+		}
+	}
+	timeout := time.Second * time.Duration(conf.Hooks.Timeout)
+	for _, w := range conf.Hooks.WASM {
+		kv := strings.SplitN(w, "=", 2)
+		m, err := hooks.LoadWASM(kv[1], timeout)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Register(kv[0], m); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range conf.Hooks.Webhooks {
+		kv := strings.SplitN(w, "=", 2)
+		w := hooks.Webhook{URL: kv[1], Timeout: timeout, Retries: conf.Hooks.Retries, OnFailure: conf.Hooks.OnFailure}
+		if err := p.Register(kv[0], w); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range conf.Hooks.Transformers {
+		w := hooks.Webhook{URL: t.URL, Timeout: timeout, Retries: conf.Hooks.Retries, OnFailure: conf.Hooks.OnFailure, Types: t.Types}
+		if t.Timeout > 0 {
+			w.Timeout = time.Second * time.Duration(t.Timeout)
+		}
+		if t.Retries > 0 {
+			w.Retries = t.Retries
+		}
+		if t.OnFailure != "" {
+			w.OnFailure = t.OnFailure
+		}
+		if err := p.Register(t.Stage, w); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Services contains the shared services that are set in the context by
+// InitMiddleware. Optional services are nil if they are disabled.
+type Services struct {
+	Queue       chan<- converter.Work
+	Statsd      *statsd.Client
+	Pool        *converter.Pool
+	Throughput  *Throughput
+	Broker      queue.Broker
+	Events      events.Publisher
+	Scheduler   *scheduler.Scheduler
+	Tenants     *tenant.Registry
+	Usage       *tenant.Accountant
+	Audit       audit.Sink
+	History     history.Store
+	Registry    registry.Store
+	Retention   retention.Store
+	Progress    *progress.Tracker
+	Idempotency *idempotency.Store
+	OutputCache *outputcache.Store
+	Breaker     *breaker.Breaker
+	Politeness  *politeness.Limiter
+	Fonts       *fonts.Store
+	Presets     *preset.Store
+	Uploads     *tus.Store
+	Notifiers   *notify.Registry
+	Policy      *policy.Script
+	Reloader    *Reloader
+}
+
+// InitMiddleware sets up the necessary middlewares for the microservice.
+// These include middlewares to establish a sane context containing access to
+// the configuration, worker queue, job broker, event publisher, scheduler,
+// statsd client, and Sentry client (Raven).
+// The latter is disabled in debugging mode to avoid contaminating
+// production stats.
+// It will also set up a middleware for catching, and handling errors thrown
+// from a route.
+func InitMiddleware(router *gin.Engine, conf Config, svc Services) {
+	// Config (reloadable at runtime)
+	if svc.Reloader != nil {
+		router.Use(LiveConfigMiddleware(svc.Reloader.Config))
+		router.Use(ReloaderMiddleware(svc.Reloader))
+	} else {
+		router.Use(ConfigMiddleware(conf))
+	}
+
+	// Client IP (forwarded by trusted proxies only)
+	router.ForwardedByClientIP = false
+	router.Use(ClientIPMiddleware())
+
+	// Request ID
+	router.Use(RequestIDMiddleware())
+
+	// CORS (uses the current config)
+	router.Use(CORSMiddleware())
+
+	// Worker queue
+	router.Use(WorkQueueMiddleware(svc.Queue))
+	if svc.Pool != nil {
+		router.Use(PoolMiddleware(svc.Pool))
+	}
+	if svc.Throughput != nil {
+		router.Use(ThroughputMiddleware(svc.Throughput))
+	}
+
+	// Job broker (clustered mode)
+	if svc.Broker != nil {
+		router.Use(BrokerMiddleware(svc.Broker))
+	}
+
+	// Lifecycle events
+	if svc.Events != nil {
+		router.Use(EventsMiddleware(svc.Events))
+	}
+
+	// Scheduler
+	if svc.Scheduler != nil {
+		router.Use(SchedulerMiddleware(svc.Scheduler))
+	}
+
+	// Runtime fonts
+	if svc.Fonts != nil {
+		router.Use(FontsMiddleware(svc.Fonts))
+	}
+
+	// Conversion presets
+	if svc.Presets != nil {
+		router.Use(PresetsMiddleware(svc.Presets))
+	}
+
+	// Notification targets
+	if svc.Notifiers != nil {
+		router.Use(NotifiersMiddleware(svc.Notifiers))
+	}
+
+	// Resumable uploads
+	if svc.Uploads != nil {
+		router.Use(UploadsMiddleware(svc.Uploads))
+	}
+
+	// Job history
+	if svc.History != nil {
+		router.Use(HistoryMiddleware(svc.History))
+	}
+
+	// Document registry
+	if svc.Registry != nil {
+		router.Use(RegistryMiddleware(svc.Registry))
+	}
+
+	// Scheduled deletions of uploaded outputs
+	if svc.Retention != nil {
+		router.Use(RetentionMiddleware(svc.Retention))
+	}
+
+	// Job progress
+	if svc.Progress != nil {
+		router.Use(ProgressMiddleware(svc.Progress))
+	}
+
+	// Conversion output cache
+	if svc.OutputCache != nil {
+		router.Use(OutputCacheMiddleware(svc.OutputCache))
+	}
+
+	// Circuit breakers of source hosts
+	if svc.Breaker != nil {
+		router.Use(BreakerMiddleware(svc.Breaker))
+	}
+	// Limits of the conversions of source hosts
+	if svc.Politeness != nil {
+		router.Use(PolitenessMiddleware(svc.Politeness))
+	}
+
+	// Tenant usage accounting
+	if svc.Usage != nil {
+		router.Use(UsageMiddleware(svc.Usage))
+	}
+
+	// Statsd
+	router.Use(StatsdMiddleware(svc.Statsd))
 
 	// Sentry (crash reporting)
 	if !gin.IsDebugging() && conf.SentryDSN != "" {
@@ -66,11 +563,137 @@ func InitMiddleware(router *gin.Engine, conf Config) {
 
 // InitSecureRoutes creates the necessary conversion routes with a middleware
 // to restrict access via an auth key (defined in the environment config).
-func InitSecureRoutes(router *gin.Engine, conf Config) {
+// If multi-tenancy is enabled, tenants may also use their own auth keys, and
+// conversions are subject to their quotas.
+func InitSecureRoutes(router *gin.Engine, conf Config, svc Services) {
 	authorized := router.Group("/")
-	authorized.Use(AuthorizationMiddleware(conf.AuthKey))
-	authorized.GET("/convert", convertByURLHandler)
-	authorized.POST("/convert", convertByFileHandler)
+	authorize(authorized, svc)
+	if svc.Tenants != nil {
+		authorized.GET("/usage", usageHandler)
+		authorized.GET("/usage/export", AdminMiddleware(), exportUsageHandler)
+	}
+	convert := authorized.Group("/", PresetMiddleware(), ProfileMiddleware())
+	if svc.Policy != nil {
+		convert.Use(PolicyMiddleware(svc.Policy))
+	}
+	if svc.Audit != nil {
+		convert.Use(AuditMiddleware(svc.Audit))
+	}
+	if svc.History != nil {
+		convert.Use(RecordJobMiddleware())
+	}
+	if svc.Registry != nil {
+		convert.Use(RecordDocumentMiddleware())
+	}
+	if svc.Retention != nil {
+		convert.Use(ScheduleDeletionMiddleware())
+	}
+	if svc.Idempotency != nil {
+		convert.Use(IdempotencyMiddleware(svc.Idempotency))
+	}
+	convert.GET("/convert", QuotaMiddleware(), convertByURLHandler)
+	convert.POST("/convert", QuotaMiddleware(), convertByFileHandler)
+	convert.POST("/inspect", QuotaMiddleware(), inspectHandler)
+	convert.POST("/diff", QuotaMiddleware(), diffHandler)
+	convert.GET("/merge", QuotaMiddleware(), mergeHandler)
+	convert.POST("/pdf/split", QuotaMiddleware(), splitHandler)
+	convert.POST("/pdf/merge", QuotaMiddleware(), mergeDocumentsHandler)
+	convert.POST("/pdf/stamp", QuotaMiddleware(), stampHandler)
+	convert.POST("/pdf/ocr", QuotaMiddleware(), ocrHandler)
+	convert.POST("/pdf/images", QuotaMiddleware(), imagesHandler)
+	convert.GET("/export", QuotaMiddleware(), exportHandler)
+	convert.POST("/report", QuotaMiddleware(), reportHandler)
+	convert.POST("/chart", QuotaMiddleware(), chartHandler)
+
+	// v2 API, where conversion options are a JSON body (the request is
+	// decoded before it is authorized)
+	conversions := router.Group("/api/v2/conversions", ConversionRequestMiddleware())
+	authorize(conversions, svc)
+	conversions.Use(PresetMiddleware(), ProfileMiddleware())
+	if svc.Policy != nil {
+		conversions.Use(PolicyMiddleware(svc.Policy))
+	}
+	if svc.Audit != nil {
+		conversions.Use(AuditMiddleware(svc.Audit))
+	}
+	if svc.History != nil {
+		conversions.Use(RecordJobMiddleware())
+	}
+	if svc.Registry != nil {
+		conversions.Use(RecordDocumentMiddleware())
+	}
+	if svc.Retention != nil {
+		conversions.Use(ScheduleDeletionMiddleware())
+	}
+	if svc.Idempotency != nil {
+		conversions.Use(IdempotencyMiddleware(svc.Idempotency))
+	}
+	conversions.POST("", QuotaMiddleware(), convertV2Handler)
+
+	// Preflight checks of conversion options, which may also be a v2 JSON
+	// body (decoded before the request is authorized)
+	preflight := router.Group("/convert/validate", PreflightRequestMiddleware())
+	authorize(preflight, svc)
+	preflight.Use(PresetMiddleware(), ProfileMiddleware())
+	if svc.Policy != nil {
+		preflight.Use(PolicyMiddleware(svc.Policy))
+	}
+	preflight.POST("", preflightHandler)
+
+	if svc.History != nil {
+		authorized.GET("/jobs", jobsHandler)
+		authorized.DELETE("/data", AdminMiddleware(), eraseHandler)
+	}
+	// Recipients verify documents without an auth key
+	if svc.Registry != nil {
+		router.GET("/verify/:sha256", verifyHandler)
+		router.POST("/verify", verifyDocumentHandler)
+		router.GET("/verification-key", verificationKeyHandler)
+	}
+	if svc.Progress != nil {
+		authorized.GET("/jobs/:id/events", jobEventsHandler)
+	}
+
+	if svc.Presets != nil {
+		authorized.GET("/presets", listPresetsHandler)
+		authorized.GET("/presets/:name", getPresetHandler)
+		authorized.PUT("/presets/:name", AdminMiddleware(), putPresetHandler)
+		authorized.DELETE("/presets/:name", AdminMiddleware(), deletePresetHandler)
+	}
+	if svc.Uploads != nil {
+		// Resumable uploads (tus), discovered without authorization
+		router.OPTIONS("/uploads", TusResumableMiddleware(), uploadOptionsHandler)
+		uploads := authorized.Group("/uploads", TusResumableMiddleware())
+		uploads.POST("", createUploadHandler)
+		uploads.HEAD("/:id", headUploadHandler)
+		uploads.PATCH("/:id", patchUploadHandler)
+		uploads.DELETE("/:id", deleteUploadHandler)
+	}
+	authorized.GET("/schedules", listSchedulesHandler)
+	authorized.POST("/schedules", createScheduleHandler)
+	authorized.GET("/schedules/:id", getScheduleHandler)
+	authorized.DELETE("/schedules/:id", deleteScheduleHandler)
+	admin := authorized.Group("/admin", AdminMiddleware())
+	admin.GET("/dashboard", dashboardHandler)
+	admin.GET("/dashboard/data", dashboardDataHandler)
+	if svc.Reloader != nil {
+		admin.POST("/reload", reloadHandler)
+	}
+	if svc.Fonts != nil {
+		admin.GET("/fonts", listFontsHandler)
+		admin.POST("/fonts", installFontHandler)
+		admin.DELETE("/fonts/:name", removeFontHandler)
+	}
+}
+
+// authorize restricts access to a group of routes via an auth key, or the
+// keys of tenants if multi-tenancy is enabled.
+func authorize(g *gin.RouterGroup, svc Services) {
+	if svc.Tenants != nil {
+		g.Use(TenantAuthorizationMiddleware(svc.Tenants))
+	} else {
+		g.Use(AuthorizationMiddleware())
+	}
 }
 
 // InitSimpleRoutes creates non-essential routes for monitoring and/or
@@ -78,6 +701,9 @@ func InitSecureRoutes(router *gin.Engine, conf Config) {
 func InitSimpleRoutes(router *gin.Engine, conf Config) {
 	router.GET("/", indexHandler)
 	router.GET("/stats", statsHandler)
+	if conf.Playground {
+		router.GET("/playground", playgroundHandler)
+	}
 
 	if gin.IsDebugging() {
 		ginpprof.Wrapper(router)
@@ -93,14 +719,217 @@ func StartX() {
 	log.Fatal("Xvfb exited:", err)
 }
 
+// waitForShutdown blocks until an interrupt or termination signal is received.
+func waitForShutdown() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	<-sigChan
+	log.Println("Received sigterm, gracefully shutting down")
+}
+
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the microservice (or the headless queue consumer) until an
+// interrupt, or termination signal is received.
+func serve(conf Config) {
 	router := gin.Default()
-	// Get config vars from the environment
-	conf := NewEnvConfig()
-	InitMiddleware(router, conf)
-	InitSecureRoutes(router, conf)
+
+	sp, err := NewSpool(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	converter.Spool = sp
+	sb, err := NewSandboxes(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	athenapdf.Sandboxes = sb
+	h, err := NewHooks(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	converter.Hooks = h
+
+	pool := converter.NewPool(conf.MaxWorkers, conf.MaxConversionQueue, conf.WorkerTimeout)
+	wq := pool.Queue()
+	s := NewStatsd(conf)
+	b, err := NewBroker(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := NewPublisher(conf)
+	db, err := NewSQLite(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tenants, usage, err := NewTenants(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jobs, err := NewHistory(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	documents, err := NewRegistry(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deletions, err := NewRetention(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	throughput := new(Throughput)
+	tracker := progress.NewTracker(progressTTL)
+	outputCache := NewOutputCache(conf)
+	hosts := NewBreaker(conf)
+	limiter := politeness.New()
+	notifiers := NewNotifiers(conf)
+	done := make(chan struct{})
+	consumer := Consumer{
+		Conf:        conf,
+		Broker:      b,
+		Notifier:    NewNotifier(conf),
+		Events:      p,
+		Usage:       usage,
+		Tenants:     tenants,
+		History:     jobs,
+		Registry:    documents,
+		Retention:   deletions,
+		Queue:       wq,
+		Statsd:      s,
+		Throughput:  throughput,
+		Progress:    tracker,
+		OutputCache: outputCache,
+		Breaker:     hosts,
+		Politeness:  limiter,
+		Notifiers:   notifiers,
+	}
+	if b != nil {
+		consumer.Start(done)
+	}
+	StartS3Watch(conf, consumer, done)
+	if deletions != nil {
+		NewJanitor(conf, deletions, s, p).Start(time.Second*time.Duration(conf.Retention.Interval), done)
+	}
+
+	if conf.Queue.Headless {
+		if b == nil && conf.S3Watch.QueueURL == "" && conf.WatchFolder.Dir == "" && conf.SMTP.Addr == "" {
+			log.Fatal("No queue driver (WEAVER_QUEUE_DRIVER), watched bucket (WEAVER_S3_WATCH_QUEUE_URL), watch folder (WEAVER_WATCH_DIR), or SMTP listener (WEAVER_SMTP_ADDR) provided for headless mode")
+		}
+		inProcess := inProcessRouter(conf, Services{Queue: wq, Statsd: s, Pool: pool, Notifiers: notifiers})
+		wf, err := NewWatchFolder(conf, inProcess)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if wf != nil {
+			wf.Start(time.Second*time.Duration(conf.WatchFolder.Interval), done)
+		}
+		smtpServer, err := StartSMTP(conf, inProcess, s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Running in headless mode, consuming jobs from the queue")
+		go StartX()
+		waitForShutdown()
+		close(done)
+		if smtpServer != nil {
+			smtpServer.Close()
+		}
+		return
+	}
+
+	auditSink, err := NewAuditSink(conf, done)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fontStore, err := NewFonts(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	presets, err := preset.NewStore(conf.PresetsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var pol *policy.Script
+	if conf.PolicyScript != "" {
+		if pol, err = policy.Load(conf.PolicyScript); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var uploads *tus.Store
+	if conf.Uploads.Dir != "" {
+		uploads, err = tus.NewStore(conf.Uploads.Dir, time.Hour*time.Duration(conf.Uploads.Expiry))
+		if err != nil {
+			log.Fatal(err)
+		}
+		uploads.Start(time.Hour, done)
+	}
+
+	sch, err := scheduler.New(consumer.Run, conf.SchedulesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sch.Start(done)
+
+	reloader := &Reloader{
+		Config:    NewLiveConfig(conf),
+		Pool:      pool,
+		Tenants:   tenants,
+		TenantsDB: db,
+	}
+	reloader.Start(time.Second*5, done)
+
+	svc := Services{
+		Queue:       wq,
+		Statsd:      s,
+		Pool:        pool,
+		Throughput:  throughput,
+		Broker:      b,
+		Events:      p,
+		Scheduler:   sch,
+		Presets:     presets,
+		Policy:      pol,
+		Uploads:     uploads,
+		Tenants:     tenants,
+		Usage:       usage,
+		Audit:       auditSink,
+		History:     jobs,
+		Registry:    documents,
+		Retention:   deletions,
+		Progress:    tracker,
+		Idempotency: NewIdempotency(conf),
+		OutputCache: outputCache,
+		Breaker:     hosts,
+		Politeness:  limiter,
+		Fonts:       fontStore,
+		Notifiers:   notifiers,
+		Reloader:    reloader,
+	}
+	InitMiddleware(router, conf, svc)
+	InitSecureRoutes(router, conf, svc)
 	InitSimpleRoutes(router, conf)
 
+	wf, err := NewWatchFolder(conf, router)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if wf != nil {
+		wf.Start(time.Second*time.Duration(conf.WatchFolder.Interval), done)
+	}
+	smtpServer, err := StartSMTP(conf, router, s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if conf.HTTPSAddr != "" {
 		if conf.TLSCertFile == "" {
 			log.Fatal("No TLS cert file provided (WEAVER_TLS_CERT_FILE)")
@@ -109,51 +938,67 @@ func main() {
 		if conf.TLSKeyFile == "" {
 			log.Fatal("No TLS key file provided (WEAVER_TLS_KEY_FILE)")
 		}
+	}
 
-		go func() {
-			srv := &http.Server{
-				Addr:    conf.HTTPSAddr,
-				Handler: router,
-			}
-			srv.TLSConfig = &tls.Config{
-				PreferServerCipherSuites: true,
-				MinVersion:               tls.VersionTLS12,
-				CipherSuites: []uint16{
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-					tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-					tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-				},
-			}
-			log.Fatal(srv.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile))
-		}()
-	} else {
-		// fallback to http server if no https config
-		server := &http.Server{
-			Addr:    conf.HTTPAddr,
-			Handler: router,
-		}
-
-		go func() {
-			log.Println(server.ListenAndServe())
-		}()
+	servers, err := startServers(conf, router)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	go StartX()
 
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	waitForShutdown()
+	close(done)
+	if smtpServer != nil {
+		smtpServer.Close()
+	}
+	shutdownServers(servers, 120*time.Second)
+}
 
-	<-sigChan
-	log.Println("Received sigterm, gracefully shutting down")
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Println("Error:", err)
+// newHTTPSServer returns the HTTPS server of the microservice, which
+// negotiates HTTP/2 with clients supporting it (and HTTP/1.1 otherwise).
+func newHTTPSServer(addr string, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	srv.TLSConfig = &tls.Config{
+		PreferServerCipherSuites: true,
+		MinVersion:               tls.VersionTLS12,
+		CipherSuites: []uint16{
+			// HTTP/2 requires TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, and
+			// prohibits the CBC suites, which are kept for HTTP/1.1 clients
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		},
+	}
+	if err := http2.ConfigureServer(srv, nil); err != nil {
+		return nil, err
 	}
+	return srv, nil
+}
 
+// shutdownServers gracefully shuts down the servers at once: they stop
+// accepting connections, and wait for the requests in progress (e.g. long
+// conversions) to complete, for up to timeout.
+func shutdownServers(servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Println("Error:", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
 }
@@ -1,10 +1,105 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/hooks"
+	"gopkg.in/alexcesaro/statsd.v2"
 )
 
 func TestMain(t *testing.T) {
 	gin.SetMode("test")
 }
+
+// mockRouter returns a router with the middlewares of the microservice, using
+// a muted statsd client (unless svc has one), and the routes registered by
+// routes (e.g. InitSecureRoutes).
+func mockRouter(conf Config, svc Services, routes func(*gin.Engine, Config, Services)) *gin.Engine {
+	if svc.Statsd == nil {
+		svc.Statsd, _ = statsd.New(statsd.Mute(true))
+	}
+	r := gin.New()
+	InitMiddleware(r, conf, svc)
+	routes(r, conf, svc)
+	return r
+}
+
+func TestNewHTTPSServer(t *testing.T) {
+	srv, err := newHTTPSServer(":8443", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("expected HTTPS server, got %+v", err)
+	}
+	if got := srv.TLSConfig.NextProtos; len(got) == 0 || got[0] != "h2" {
+		t.Errorf("expected HTTP/2 to be negotiated first, got %v", got)
+	}
+}
+
+func TestShutdownServers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var servers []*http.Server
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+		})}
+		servers = append(servers, srv)
+		go srv.Serve(ln)
+		go http.Get("http://" + ln.Addr().String())
+		<-started
+	}
+
+	done := make(chan struct{})
+	go func() {
+		shutdownServers(servers, time.Second*5)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected shutdown to wait for the requests in progress")
+	case <-time.After(time.Millisecond * 100):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected servers to shut down")
+	}
+	for _, srv := range servers {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			t.Errorf("expected server to be closed, got %+v", err)
+		}
+	}
+}
+
+func TestNewHooks(t *testing.T) {
+	conf := defaultConfig()
+	if p, err := NewHooks(conf); p != nil || err != nil {
+		t.Errorf("expected no hooks, got %+v (%v)", p, err)
+	}
+
+	conf.Hooks.Transformers = []Transformer{{Stage: hooks.PostRender, URL: "http://127.0.0.1:1", OnFailure: hooks.FailureSkip}}
+	p, err := NewHooks(conf)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if !p.Has(hooks.PostRender) || p.Has(hooks.PostFetch) {
+		t.Errorf("expected only %s to have hooks", hooks.PostRender)
+	}
+	if pl, err := p.Run(hooks.PostRender, hooks.Payload{Body: []byte("%PDF")}); err != nil || string(pl.Body) != "%PDF" {
+		t.Errorf("expected the failed transformer to be skipped, got %q (%v)", pl.Body, err)
+	}
+
+	conf.Hooks.WASM = []string{"post-render=testdata/missing.wasm"}
+	if _, err := NewHooks(conf); err == nil {
+		t.Error("expected an error for a missing WASM module")
+	}
+}
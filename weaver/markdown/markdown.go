@@ -0,0 +1,248 @@
+// Package markdown converts (extracted) HTML documents to Markdown.
+package markdown
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	whitespace = regexp.MustCompile(`\s+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	emptyLines = regexp.MustCompile(`(?m)^[ \t]+$`)
+)
+
+// skipped elements are not rendered, as they do not contain readable content.
+var skipped = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Input:    true,
+}
+
+// FromHTML returns a HTML document as Markdown. Elements without a Markdown
+// equivalent are rendered as their content.
+func FromHTML(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	md := emptyLines.ReplaceAllString(block(doc, 0), "")
+	return strings.TrimSpace(blankLines.ReplaceAllString(md, "\n\n")) + "\n", nil
+}
+
+// block renders the children of a node, separating block elements by blank
+// lines. depth is the list nesting depth.
+func block(n *html.Node, depth int) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(render(c, depth))
+	}
+	return b.String()
+}
+
+// inline renders the children of a node on a single line.
+func inline(n *html.Node, depth int) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(block(n, depth), " "))
+}
+
+func render(n *html.Node, depth int) string {
+	switch n.Type {
+	case html.TextNode:
+		return escape(whitespace.ReplaceAllString(n.Data, " "))
+	case html.DocumentNode:
+		return block(n, depth)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if skipped[n.DataAtom] {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		return "\n\n" + strings.Repeat("#", level) + " " + inline(n, depth) + "\n\n"
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+		atom.Footer, atom.Aside, atom.Nav, atom.Figure, atom.Figcaption, atom.Dl:
+		return "\n\n" + block(n, depth) + "\n\n"
+	case atom.Dt:
+		return "\n\n**" + inline(n, depth) + "**\n"
+	case atom.Dd:
+		return "\n: " + inline(n, depth) + "\n"
+	case atom.Br:
+		return "  \n"
+	case atom.Hr:
+		return "\n\n---\n\n"
+	case atom.Strong, atom.B:
+		return wrap(inline(n, depth), "**")
+	case atom.Em, atom.I:
+		return wrap(inline(n, depth), "_")
+	case atom.Del, atom.S:
+		return wrap(inline(n, depth), "~~")
+	case atom.Code:
+		return wrap(textContent(n), "`")
+	case atom.A:
+		text := inline(n, depth)
+		href := attr(n, "href")
+		if href == "" || strings.HasPrefix(href, "javascript:") {
+			return text
+		}
+		if text == "" {
+			text = href
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return ""
+		}
+		return "![" + escape(attr(n, "alt")) + "](" + src + ")"
+	case atom.Pre:
+		return "\n\n```\n" + strings.Trim(textContent(n), "\n") + "\n```\n\n"
+	case atom.Blockquote:
+		lines := strings.Split(strings.TrimSpace(block(n, depth)), "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight("> "+l, " ")
+		}
+		return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+	case atom.Ul, atom.Ol:
+		return list(n, depth)
+	case atom.Table:
+		return table(n, depth)
+	}
+
+	return block(n, depth)
+}
+
+// list renders an ordered, or unordered list. Nested lists are indented.
+func list(n *html.Node, depth int) string {
+	var b strings.Builder
+	indent := strings.Repeat("  ", depth)
+	i := 1
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(i) + ". "
+			i++
+		}
+
+		// Render nested lists separately from the item text
+		var text, nested strings.Builder
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			if cc.DataAtom == atom.Ul || cc.DataAtom == atom.Ol {
+				nested.WriteString(strings.Trim(list(cc, depth+1), "\n"))
+				continue
+			}
+			text.WriteString(render(cc, depth+1))
+		}
+
+		b.WriteString("\n" + indent + marker + strings.TrimSpace(whitespace.ReplaceAllString(text.String(), " ")))
+		if nested.Len() > 0 {
+			b.WriteString("\n" + nested.String())
+		}
+	}
+	if depth > 0 {
+		return b.String()
+	}
+	return "\n" + b.String() + "\n\n"
+}
+
+// table renders a table as a pipe table. The first row is used as the header.
+func table(n *html.Node, depth int) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, strings.Replace(inline(cell, depth), "|", `\|`, -1))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	cols := 0
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\n")
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		b.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString(strings.Repeat("| --- ", cols) + "|\n")
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// wrap surrounds text with a Markdown delimiter, unless it is empty.
+func wrap(text, delim string) string {
+	if text == "" {
+		return ""
+	}
+	return delim + text + delim
+}
+
+// textContent returns the raw text of a node, preserving whitespace.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+var special = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+// escape escapes characters in text that would otherwise be read as Markdown.
+func escape(s string) string {
+	return special.Replace(s)
+}
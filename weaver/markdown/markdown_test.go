@@ -0,0 +1,44 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromHTML(t *testing.T) {
+	in := `<html><head><title>Ignored</title><style>p {}</style></head><body>
+<h1>Title</h1>
+<p>Some <strong>bold</strong>, and <em>emphasised</em> text with a <a href="https://example.com">link</a>.</p>
+<ul><li>One</li><li>Two<ol><li>Nested</li></ol></li></ul>
+<pre>x := 1
+y := 2</pre>
+<blockquote><p>Quoted</p></blockquote>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>
+<script>alert(1)</script>
+</body></html>`
+
+	want := "# Title\n\n" +
+		"Some **bold**, and _emphasised_ text with a [link](https://example.com).\n\n" +
+		"- One\n- Two\n  1. Nested\n\n" +
+		"```\nx := 1\ny := 2\n```\n\n" +
+		"> Quoted\n\n" +
+		"| A | B |\n| --- | --- |\n| 1 | 2 |\n"
+
+	got, err := FromHTML(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unable to convert HTML: %+v", err)
+	}
+	if got != want {
+		t.Errorf("expected Markdown to be:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFromHTML_escape(t *testing.T) {
+	got, err := FromHTML(strings.NewReader("<p>2 * 3 = [6]</p>"))
+	if err != nil {
+		t.Fatalf("unable to convert HTML: %+v", err)
+	}
+	if want := "2 \\* 3 = \\[6\\]\n"; got != want {
+		t.Errorf("expected Markdown to be %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrMergeNoSources should be returned when a merged conversion is
+	// requested without URLs.
+	ErrMergeNoSources = errors.New("at least one URL (url) is required")
+	// ErrMergeTooManySources should be returned when a merged conversion has
+	// more URLs than allowed.
+	ErrMergeTooManySources = errors.New("too many URLs provided (see WEAVER_MERGE_MAX_SOURCES)")
+	// ErrMergeFormat should be returned when a merged conversion is
+	// requested in a format other than PDF.
+	ErrMergeFormat = errors.New("merged conversions only support the PDF format")
+	// ErrMergeParallelism should be returned when the parallelism of a merged
+	// conversion is invalid.
+	ErrMergeParallelism = errors.New("invalid parallelism provided (use a positive number)")
+)
+
+// mergeParallelism returns the number of URLs of a merged conversion that
+// are rendered at the same time: the configured parallelism, or the lower
+// parallelism requested.
+func mergeParallelism(c *gin.Context) (int, error) {
+	conf := c.MustGet("config").(Config)
+	n := conf.Merge.Parallelism
+	if n < 1 {
+		n = 1
+	}
+	if p := c.Query("parallelism"); p != "" {
+		requested, err := strconv.Atoi(p)
+		if err != nil || requested < 1 {
+			return 0, ErrMergeParallelism
+		}
+		if requested < n {
+			n = requested
+		}
+	}
+	return n, nil
+}
+
+// renderSections fetches, and renders URLs as PDFs in the work queue, with
+// at most n of them at the same time. The outputs are returned in the order
+// of the URLs. Once a URL has failed (or the client has closed the
+// connection), the URLs that have not started yet are skipped, the renders
+// in progress are cancelled, and its error is returned after they have
+// stopped.
+func renderSections(c *gin.Context, urls []string, n int) ([][]byte, error) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	b := hostBreaker(c)
+	wq := c.MustGet("queue").(chan<- converter.Work)
+
+	g, ctx := errgroup.WithContext(c.Request.Context())
+	out := make([][]byte, len(urls))
+	slots := make(chan struct{}, n)
+	for i, u := range urls {
+		// The renders use a copy of the context, whose request is cancelled
+		// with the others
+		rc := c.Copy()
+		rc.Request = c.Request.WithContext(ctx)
+		i, u := i, u
+		g.Go(func() error {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			defer func() { <-slots }()
+
+			host := sourceDomain(u)
+			source, err := newURLSource(rc, u)
+			if err != nil {
+				recordHost(b, s, host, sourceFailed(err))
+				return err
+			}
+			defer source.Remove()
+			conversion, err := renderConversion(rc, *source, athenapdf.FormatPDF)
+			if err != nil {
+				return err
+			}
+			out[i], err = awaitSection(ctx, converter.NewWork(wq, conversion, *source))
+			if err != ErrClientClosed {
+				recordHost(b, s, host, err == converter.ErrConversionTimeout)
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// awaitSection returns the output of the rendering of a section, and cancels
+// it once the context is done (i.e. another section has failed, or the
+// client has closed the connection).
+func awaitSection(ctx context.Context, work converter.Work) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		work.Cancel()
+		return nil, ErrClientClosed
+	case out := <-work.Success():
+		return out, nil
+	case err := <-work.Error():
+		return nil, err
+	}
+}
+
+// mergeHandler renders several URLs (in the 'url' query parameters)
+// concurrently across the worker pool, and returns them concatenated into a
+// single PDF, in order. It takes the same options as '/convert', and links
+// between the URLs go to their pages with 'link_sources'.
+func mergeHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	conf := c.MustGet("config").(Config)
+
+	urls := c.Request.URL.Query()["url"]
+	if len(urls) == 0 {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeNoSources).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if conf.Merge.MaxSources > 0 && len(urls) > conf.Merge.MaxSources {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeTooManySources).SetType(gin.ErrorTypePublic)
+		return
+	}
+	for _, u := range urls {
+		if u == "" {
+			c.AbortWithError(http.StatusBadRequest, ErrURLInvalid).SetType(gin.ErrorTypePublic)
+			s.Increment("invalid_url")
+			return
+		}
+	}
+	if _, ok := c.GetQuery("offline"); ok {
+		c.AbortWithError(http.StatusBadRequest, ErrOfflineURL).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if err := checkOptions(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeFormat).SetType(gin.ErrorTypePublic)
+		return
+	}
+	n, err := mergeParallelism(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	// Every host must be allowed by its circuit breaker
+	if b := hostBreaker(c); b != nil {
+		hosts := make(map[string]bool)
+		for _, u := range urls {
+			host := sourceDomain(u)
+			if host == "" || hosts[host] {
+				continue
+			}
+			hosts[host] = true
+			if err := b.Allow(host); err != nil {
+				s.Increment("circuit_open")
+				c.AbortWithError(http.StatusServiceUnavailable, err).SetType(gin.ErrorTypePublic)
+				return
+			}
+		}
+	}
+
+	id := newJob(c, urls[0])
+	started := time.Now()
+	sections, err := renderSections(c, urls, n)
+	var out []byte
+	if err == nil {
+		if queryFlag(c, "link_sources") {
+			out, err = pdf.MergeLinked(urls, sections...)
+		} else {
+			out, err = pdf.Merge(sections...)
+		}
+	}
+	if err != nil {
+		s.Increment("merge_error")
+		events.Emit(publisher(c), events.Failed, id, urls[0], err)
+		if err == converter.ErrConversionTimeout {
+			c.AbortWithError(http.StatusGatewayTimeout, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		abortWithSourceError(c, err)
+		return
+	}
+
+	report := &converter.Report{Duration: time.Since(started)}
+	report.Fill(out)
+	c.Set("report", report)
+	s.Increment("merge")
+	s.Timing("merge_duration", int(report.Duration/time.Millisecond))
+	events.EmitOutput(publisher(c), events.Completed, id, urls[0], report.Pages, report.Bytes)
+	recordUsage(c, report)
+	setReportHeaders(c, report)
+	sendOutput(c, athenapdf.ContentTypes[athenapdf.FormatPDF], out, report.SHA256)
+}
+
+// mergeDocumentsHandler concatenates PDF documents (uploaded as 'file', and
+// fetched from their URLs, 'url') into a single document, in order. With a
+// page size ('page_size', and 'no_portrait'), the content of every page is
+// scaled to fit it, so that every page has the same size.
+func mergeDocumentsHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	conf := c.MustGet("config").(Config)
+
+	if err := checkPageSize(c); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	// URLs are counted before they are fetched
+	if conf.Merge.MaxSources > 0 && len(c.QueryArray("url")) > conf.Merge.MaxSources {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeTooManySources).SetType(gin.ErrorTypePublic)
+		return
+	}
+	docs, err := readDocuments(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	if conf.Merge.MaxSources > 0 && len(docs) > conf.Merge.MaxSources {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeTooManySources).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var size pdf.Size
+	if name := c.Query("page_size"); name != "" {
+		_, landscape := c.GetQuery("no_portrait")
+		size, _ = pdf.PaperSize(name, landscape)
+	}
+	out, err := pdf.MergeTo(size, docs...)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+
+	s.Increment("pdf_merge")
+	c.Header("X-Page-Count", strconv.Itoa(pdf.PageCount(out)))
+	c.Data(http.StatusOK, "application/pdf", out)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// onePagePDF is printed by the mock converter of merged conversions.
+const onePagePDF = `%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >> endobj
+trailer << /Root 1 0 R >>
+`
+
+func TestMergeHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+	f, err := ioutil.TempFile("", "converter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("cat <<'PDF'\n" + onePagePDF + "PDF\n")
+	f.Close()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + f.Name()
+	svc := Services{Queue: converter.InitWorkers(2, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	tests := []struct {
+		query string
+		code  int
+		pages int
+	}{
+		{"", http.StatusBadRequest, 0},
+		{"&url=" + ts.URL + "&url=" + ts.URL + "/b&url=" + ts.URL + "/c", http.StatusOK, 3},
+		{"&url=" + ts.URL + "&parallelism=1", http.StatusOK, 1},
+		{"&url=" + ts.URL + "&parallelism=0", http.StatusBadRequest, 0},
+		{"&url=" + ts.URL + "&format=text", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		req, _ := http.NewRequest("GET", "/merge?auth=123456"+tt.query, nil)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %q to be %d, got %d", tt.query, want, got)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if got, want := pdf.PageCount(res.Body.Bytes()), tt.pages; got != want {
+			t.Errorf("expected merged PDF of %q to have %d pages, got %d", tt.query, want, got)
+		}
+		if got, want := res.Header().Get("X-Page-Count"), strconv.Itoa(tt.pages); got != want {
+			t.Errorf("expected page count header of %q to be %s, got %s", tt.query, want, got)
+		}
+	}
+}
+
+func TestMergeHandler_linkSources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+	f, err := ioutil.TempFile("", "converter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// Every section links to the appendix
+	f.WriteString("cat <<'PDF'\n" + strings.Replace(onePagePDF, "/MediaBox [0 0 595 842]", "/MediaBox [0 0 595 842] /Annots [4 0 R]", 1) +
+		"4 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (" + ts.URL + "/appendix) >> >> endobj\nPDF\n")
+	f.Close()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + f.Name()
+	svc := Services{Queue: converter.InitWorkers(2, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"", "/S /URI /URI (" + ts.URL + "/appendix)"},
+		{"&link_sources=true", "/S /GoTo /D /WvDoc2"},
+	} {
+		res := streamRecorder{httptest.NewRecorder()}
+		req, _ := http.NewRequest("GET", "/merge?auth=123456&url="+ts.URL+"&url="+ts.URL+"/appendix"+tt.query, nil)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, http.StatusOK; got != want {
+			t.Fatalf("expected response code of %q to be %d, got %d", tt.query, want, got)
+		}
+		if !bytes.Contains(res.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("expected the merged PDF of %q to contain %q, got %s", tt.query, tt.want, res.Body.String())
+		}
+	}
+}
+
+func TestMergeHandler_failed(t *testing.T) {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "false"
+	conf.Fetch.Retries = 0
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := streamRecorder{httptest.NewRecorder()}
+	req, _ := http.NewRequest("GET", "/merge?auth=123456&url=http://127.0.0.1:1/a&url=http://127.0.0.1:1/b", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestMergeDocumentsHandler(t *testing.T) {
+	doc := mockDocument(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(onePagePDF))
+	}))
+	defer ts.Close()
+	r := mockDocumentRouter()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		f, _ := w.CreateFormFile("file", name)
+		f.Write(doc)
+	}
+	w.Close()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/pdf/merge?auth=123456&page_size=A4&url="+ts.URL, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+
+	info, err := pdf.Inspect(res.Body.Bytes(), false)
+	if err != nil {
+		t.Fatalf("unable to inspect merged PDF: %+v", err)
+	}
+	if got, want := info.PageCount, 5; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+	for _, p := range info.Pages {
+		if p.Size != "A4" {
+			t.Errorf("expected page %d to be normalized to A4, got %+v", p.Number, p)
+		}
+	}
+}
+
+func TestMergeDocumentsHandler_invalid(t *testing.T) {
+	r := mockDocumentRouter()
+	tests := []struct {
+		req  *http.Request
+		code int
+	}{
+		{uploadRequest("/pdf/merge?auth=123456&page_size=B5", "a.pdf", mockDocument(t)), http.StatusBadRequest},
+		{uploadRequest("/pdf/merge?auth=123456", "a.html", []byte("<html></html>")), http.StatusUnprocessableEntity},
+		{httptest.NewRequest("POST", "/pdf/merge?auth=123456", nil), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, tt.req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d", tt.req.URL, want, got)
+		}
+	}
+}
+
+func TestRenderSections_failed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<p>section</p>"))
+	}))
+	defer ts.Close()
+	conf := defaultConfig()
+	conf.AthenaCMD = "false"
+	// A worker that keeps the first render in progress while the second one
+	// fails
+	wq := make(chan converter.Work)
+	held := make(chan converter.Work, 1)
+	go func() {
+		w := <-wq
+		held <- w
+		(<-wq).Process(10)
+	}()
+
+	var err error
+	r := mockRouter(conf, Services{Queue: wq}, func(r *gin.Engine, _ Config, _ Services) {
+		r.GET("/merge", func(c *gin.Context) {
+			_, err = renderSections(c, []string{ts.URL + "/a", ts.URL + "/b"}, 2)
+		})
+	})
+	req, _ := http.NewRequest("GET", "/merge", nil)
+	r.ServeHTTP(streamRecorder{httptest.NewRecorder()}, req)
+	if err == nil || err == ErrClientClosed {
+		t.Fatalf("expected the error of the failed render, got %+v", err)
+	}
+
+	// The render in progress was cancelled before returning
+	select {
+	case <-(<-held).Cancelled():
+	default:
+		t.Errorf("expected the render in progress to be cancelled")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// Conversion outcomes recorded in the conversion stats.
+const (
+	OutcomeSuccess      = "success"
+	OutcomeUploaded     = "uploaded"
+	OutcomeTimeout      = "timeout"
+	OutcomeUploadError  = "upload_error"
+	OutcomeError        = "error"
+	OutcomeClientClosed = "client_closed"
+)
+
+// conversionStats records conversions broken down by route, engine, output
+// format, tenant, and outcome.
+// If stats are tagged (see Statsd), the breakdown is recorded as the tags of
+// the 'conversions', and 'conversions.duration' buckets. Otherwise, it is
+// part of the bucket names (without the route), e.g.
+// 'conversions.athenapdf.pdf.acme.timeout'.
+type conversionStats struct {
+	s      *statsd.Client
+	tagged bool
+	route  string
+	engine string
+	format string
+	tenant string
+	// throughput is optional. If it is set, conversions are also counted
+	// for the admin dashboard.
+	throughput *Throughput
+}
+
+// newConversionStats creates the stats of a conversion. The format defaults
+// to PDF, and the tenant is empty for conversions without a tenant.
+func newConversionStats(s *statsd.Client, conf Config, route, engine, format, tenant string) conversionStats {
+	_, tagged := conf.Statsd.TagFormat()
+	if format == "" {
+		format = athenapdf.FormatPDF
+	}
+	return conversionStats{s: s, tagged: tagged, route: route, engine: engine, format: format, tenant: tenant}
+}
+
+// record records a conversion with the outcome, and its duration.
+func (m conversionStats) record(outcome string, d time.Duration) {
+	if m.throughput != nil {
+		m.throughput.Record(outcome, time.Now())
+	}
+	ms := int(d / time.Millisecond)
+	tenant := m.tenant
+	if tenant == "" {
+		tenant = "none"
+	}
+	if m.tagged {
+		s := m.s.Clone(statsd.Tags(
+			"route", m.route,
+			"engine", m.engine,
+			"format", m.format,
+			"tenant", tenant,
+			"outcome", outcome,
+		))
+		s.Increment("conversions")
+		s.Timing("conversions.duration", ms)
+		return
+	}
+	bucket := "conversions." + strings.Join([]string{
+		bucketName(m.engine),
+		bucketName(m.format),
+		bucketName(tenant),
+		outcome,
+	}, ".")
+	m.s.Increment(bucket)
+	m.s.Timing(bucket+".duration", ms)
+}
+
+// conversionProgress returns a progress function recording the time from the
+// start of a conversion to each of its later stages as the
+// 'conversion_progress.<stage>' timings. If a tracker is given, the stages
+// are also recorded to the progress of the job.
+func conversionProgress(s *statsd.Client, t *progress.Tracker, jobID, tenant string) converter.ProgressFunc {
+	var start time.Time
+	return func(p converter.Progress) {
+		if p.Stage == converter.ProgressRendering {
+			start = time.Now()
+		} else if !start.IsZero() {
+			s.Timing("conversion_progress."+bucketName(p.Stage), int(time.Since(start)/time.Millisecond))
+		}
+		if t != nil {
+			t.Report(jobID, tenant, p.Stage, p.Bytes)
+		}
+	}
+}
+
+// bucketName replaces the characters of a statsd bucket name segment with a
+// special meaning ('.', ':', '|', and '@') with underscores.
+func bucketName(s string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_").Replace(s)
+}
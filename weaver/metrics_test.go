@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// receiveStats records the conversion with a statsd client sending to a local
+// UDP server, and returns the received stats.
+func receiveStats(t *testing.T, conf Config, outcome string, opts ...statsd.Option) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen for stats: %+v", err)
+	}
+	defer conn.Close()
+	s, err := statsd.New(append(opts, statsd.Address(conn.LocalAddr().String()))...)
+	if err != nil {
+		t.Fatalf("unable to create statsd client: %+v", err)
+	}
+	defer s.Close()
+
+	newConversionStats(s, conf, "/convert", "athenapdf", "", "acme.io").record(outcome, time.Second)
+	s.Flush()
+
+	// The client sends an empty packet when it is created
+	b := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("unable to receive stats: %+v", err)
+		}
+		if n > 0 {
+			return string(b[:n])
+		}
+	}
+}
+
+func TestConversionStats(t *testing.T) {
+	got := receiveStats(t, Config{}, OutcomeTimeout)
+	want := "conversions.athenapdf.pdf.acme_io.timeout:1|c\nconversions.athenapdf.pdf.acme_io.timeout.duration:1000|ms"
+	if got != want {
+		t.Errorf("expected stats to be %q, got %q", want, got)
+	}
+}
+
+func TestConversionStats_tagged(t *testing.T) {
+	conf := Config{Statsd: Statsd{TagsFormat: "datadog"}}
+	got := receiveStats(t, conf, OutcomeSuccess, statsd.TagsFormat(statsd.Datadog))
+	tags := "|#route:/convert,engine:athenapdf,format:pdf,tenant:acme.io,outcome:success"
+	if !strings.HasPrefix(got, "conversions:1|c"+tags) {
+		t.Errorf("expected stats to be tagged with %q, got %q", tags, got)
+	}
+}
+
+func TestConversionProgress(t *testing.T) {
+	s, _ := statsd.New(statsd.Mute(true))
+	tr := progress.NewTracker(time.Hour)
+	f := conversionProgress(s, tr, "test-job", "acme")
+	f.Report(converter.ProgressRendering, 0)
+	f.Report(converter.ProgressOutput, 1024)
+	updates := tr.Updates("test-job")
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %+v", updates)
+	}
+	if got, want := updates[1].Stage, progress.Output; got != want {
+		t.Errorf("expected stage to be %s, got %s", want, got)
+	}
+	if got, want := updates[1].Bytes, 1024; got != want {
+		t.Errorf("expected output size to be %d, got %d", want, got)
+	}
+}
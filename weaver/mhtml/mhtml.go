@@ -0,0 +1,114 @@
+// Package mhtml converts MHTML snapshots into single-file HTML documents.
+package mhtml
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"sort"
+	"strings"
+)
+
+// ErrNoDocument is returned when a snapshot does not contain a HTML document.
+var ErrNoDocument = errors.New("MHTML snapshot does not contain a HTML document")
+
+// resource is a part of a snapshot.
+type resource struct {
+	location    string
+	contentType string
+	data        []byte
+}
+
+// Inline returns the main HTML document of a MHTML snapshot, with the other
+// resources of the snapshot (e.g. images, stylesheets, and frames) inlined as
+// data URIs.
+func Inline(r io.Reader) ([]byte, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	var main *resource
+	var resources []*resource
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Quoted-printable parts are decoded by the multipart reader
+		var body io.Reader = p
+		if strings.EqualFold(p.Header.Get("Content-Transfer-Encoding"), "base64") {
+			body = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+
+		res := &resource{
+			location:    p.Header.Get("Content-Location"),
+			contentType: p.Header.Get("Content-Type"),
+			data:        data,
+		}
+		if id := strings.Trim(p.Header.Get("Content-ID"), "<>"); id != "" {
+			res.location = "cid:" + id
+		}
+		if main == nil && strings.HasPrefix(res.contentType, "text/html") {
+			main = res
+			continue
+		}
+		resources = append(resources, res)
+	}
+
+	if main == nil {
+		return nil, ErrNoDocument
+	}
+
+	// Inline resources into stylesheets, and frames first, as they may
+	// reference other resources
+	uris := dataURIs(resources)
+	for _, res := range resources {
+		if strings.HasPrefix(res.contentType, "text/") {
+			res.data = []byte(uris.Replace(string(res.data)))
+		}
+	}
+
+	return []byte(dataURIs(resources).Replace(string(main.data))), nil
+}
+
+// dataURIs returns a replacer of resource locations with data URIs. Longer
+// locations are replaced first, so that a location is not replaced by a data
+// URI of another resource with a prefix of its location.
+func dataURIs(resources []*resource) *strings.Replacer {
+	sorted := make([]*resource, len(resources))
+	copy(sorted, resources)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].location) > len(sorted[j].location) })
+
+	var pairs []string
+	for _, res := range sorted {
+		if res.location == "" {
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(res.contentType)
+		uri := "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(res.data)
+		pairs = append(pairs, res.location, uri)
+		// Locations in HTML attributes may be escaped
+		if escaped := html.EscapeString(res.location); escaped != res.location {
+			pairs = append(pairs, escaped, uri)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,60 @@
+package mhtml
+
+import (
+	"strings"
+	"testing"
+)
+
+const snapshot = "From: <Saved by Blink>\r\n" +
+	"Subject: Test\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/related;\r\n" +
+	"\ttype=\"text/html\";\r\n" +
+	"\tboundary=\"----boundary\"\r\n" +
+	"\r\n" +
+	"------boundary\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"Content-Location: https://example.com/\r\n" +
+	"\r\n" +
+	"<html><head><link rel=3D\"stylesheet\" href=3D\"https://example.com/a.css\"></h=\r\n" +
+	"ead><body><img src=3D\"https://example.com/a.png?x=3D1&amp;y=3D2\"></body></html>\r\n" +
+	"------boundary\r\n" +
+	"Content-Type: text/css\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"Content-Location: https://example.com/a.css\r\n" +
+	"\r\n" +
+	"body { color: red; }\r\n" +
+	"------boundary\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Location: https://example.com/a.png?x=1&y=2\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"------boundary--\r\n"
+
+func TestInline(t *testing.T) {
+	b, err := Inline(strings.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("unable to inline snapshot: %+v", err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		`href="data:text/css;base64,Ym9keSB7IGNvbG9yOiByZWQ7IH0="`,
+		`src="data:image/png;base64,iVBORw0KGgo="`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected inlined document to contain %s, got %s", want, got)
+		}
+	}
+	if strings.Contains(got, "https://example.com/") {
+		t.Errorf("expected all resources to be inlined, got %s", got)
+	}
+}
+
+func TestInline_noDocument(t *testing.T) {
+	s := strings.Replace(snapshot, "Content-Type: text/html\r\n", "Content-Type: text/plain\r\n", 1)
+	if _, err := Inline(strings.NewReader(s)); err != ErrNoDocument {
+		t.Errorf("expected error to be %+v, got %+v", ErrNoDocument, err)
+	}
+}
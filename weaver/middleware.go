@@ -1,22 +1,56 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/getsentry/raven-go"
 	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/audit"
+	"github.com/lachee/athenapdf/weaver/breaker"
 	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/fonts"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+	"github.com/lachee/athenapdf/weaver/history"
+	"github.com/lachee/athenapdf/weaver/idempotency"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"github.com/lachee/athenapdf/weaver/outputcache"
+	"github.com/lachee/athenapdf/weaver/policy"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/preset"
+	"github.com/lachee/athenapdf/weaver/progress"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"github.com/lachee/athenapdf/weaver/scheduler"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/lachee/athenapdf/weaver/tus"
+	"github.com/satori/go.uuid"
 	"gopkg.in/alexcesaro/statsd.v2"
 )
 
 var (
 	// ErrAuthorization should be returned when the authorization key is invalid.
 	ErrAuthorization = errors.New("invalid authorization key provided")
+	// ErrAdminOnly should be returned when a tenant requests a route that
+	// requires the admin authorization key.
+	ErrAdminOnly = errors.New("admin authorization key required")
 	// ErrInternalServer should be returned when a private error is returned
 	// from a handler.
 	ErrInternalServer = errors.New("PDF conversion failed due to an internal server error")
+	// ErrIdempotencyKeyInvalid should be returned when an Idempotency-Key
+	// header is too long.
+	ErrIdempotencyKeyInvalid = errors.New("invalid idempotency key (use at most 255 characters)")
 )
 
 // ConfigMiddleware sets the config in the context.
@@ -26,6 +60,53 @@ func ConfigMiddleware(conf Config) gin.HandlerFunc {
 	}
 }
 
+// LiveConfigMiddleware sets the current configuration in the context. A
+// request keeps using the same configuration if it is reloaded meanwhile.
+func LiveConfigMiddleware(l *LiveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("config", l.Get())
+	}
+}
+
+// CORSMiddleware adds the CORS headers for requests from allowed origins
+// (see CORS), and answers preflight requests.
+func CORSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := c.MustGet("config").(Config).CORS
+		origin := c.Request.Header.Get("Origin")
+		if origin == "" || len(conf.AllowedOrigins) == 0 {
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		allowed, ok := conf.AllowedOrigin(origin)
+		if !ok {
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", allowed)
+		if conf.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if c.Request.Method == "OPTIONS" && c.Request.Header.Get("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", strings.Join(conf.AllowedMethods, ", "))
+			c.Header("Access-Control-Allow-Headers", strings.Join(conf.AllowedHeaders, ", "))
+			c.Header("Access-Control-Max-Age", strconv.Itoa(conf.MaxAge))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if len(conf.ExposedHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(conf.ExposedHeaders, ", "))
+		}
+	}
+}
+
+// ReloaderMiddleware sets the configuration reloader in the context.
+func ReloaderMiddleware(r *Reloader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("reloader", r)
+	}
+}
+
 // WorkQueueMiddleware sets the work queue (write only) in the context.
 func WorkQueueMiddleware(q chan<- converter.Work) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -33,25 +114,191 @@ func WorkQueueMiddleware(q chan<- converter.Work) gin.HandlerFunc {
 	}
 }
 
-// SentryMiddleware sets the Sentry client (Raven) in the context.
+// PoolMiddleware sets the worker pool in the context.
+func PoolMiddleware(p *converter.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("pool", p)
+	}
+}
+
+// ThroughputMiddleware sets the conversion throughput counter in the
+// context.
+func ThroughputMiddleware(tp *Throughput) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("throughput", tp)
+	}
+}
+
+// BrokerMiddleware sets the job broker (clustered mode) in the context.
+func BrokerMiddleware(b queue.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("broker", b)
+	}
+}
+
+// EventsMiddleware sets the lifecycle event publisher in the context.
+func EventsMiddleware(p events.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("events", p)
+	}
+}
+
+// NotifiersMiddleware sets the registry of notification targets in the
+// context.
+func NotifiersMiddleware(r *notify.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("notifiers", r)
+	}
+}
+
+// SchedulerMiddleware sets the conversion scheduler in the context.
+func SchedulerMiddleware(s *scheduler.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("scheduler", s)
+	}
+}
+
+// FontsMiddleware sets the runtime font store in the context.
+func FontsMiddleware(s *fonts.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("fonts", s)
+	}
+}
+
+// PresetsMiddleware sets the preset store in the context.
+func PresetsMiddleware(s *preset.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("presets", s)
+	}
+}
+
+// UploadsMiddleware sets the store of resumable uploads in the context.
+func UploadsMiddleware(s *tus.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("uploads", s)
+	}
+}
+
+// HistoryMiddleware sets the job store in the context.
+func HistoryMiddleware(s history.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("history", s)
+	}
+}
+
+// RegistryMiddleware sets the document registry in the context.
+func RegistryMiddleware(s registry.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("registry", s)
+	}
+}
+
+// RetentionMiddleware sets the store of scheduled deletions in the context.
+func RetentionMiddleware(s retention.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("retention", s)
+	}
+}
+
+// ProgressMiddleware sets the job progress tracker in the context.
+func ProgressMiddleware(t *progress.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("progress", t)
+	}
+}
+
+// OutputCacheMiddleware sets the conversion output cache in the context.
+func OutputCacheMiddleware(s *outputcache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("output_cache", s)
+	}
+}
+
+// BreakerMiddleware sets the circuit breakers of source hosts in the
+// context.
+func BreakerMiddleware(b *breaker.Breaker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("breaker", b)
+	}
+}
+
+// PolitenessMiddleware sets the limiter of source hosts in the context.
+func PolitenessMiddleware(l *politeness.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("politeness", l)
+	}
+}
+
+// UsageMiddleware sets the tenant usage accountant in the context.
+func UsageMiddleware(a *tenant.Accountant) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("usage", a)
+	}
+}
+
+// SentryMiddleware sets the Sentry client (Raven), and the breadcrumbs of the
+// request (reported with its errors) in the context.
 func SentryMiddleware(r *raven.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("sentry", r)
+		c.Set("breadcrumbs", new(breadcrumbs))
 	}
 }
 
-// StatsdMiddleware sets the Statsd client in the context.
+// StatsdMiddleware sets the Statsd client in the context. If stats are
+// tagged (see Statsd), the stats of a request are tagged with its request ID.
 func StatsdMiddleware(s *statsd.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if conf, ok := c.Get("config"); ok {
+			id := c.GetString("request_id")
+			if _, ok := conf.(Config).Statsd.TagFormat(); ok && id != "" {
+				c.Set("statsd", s.Clone(statsd.Tags("request_id", id)))
+				return
+			}
+		}
 		c.Set("statsd", s)
 	}
 }
 
+// RequestIDMiddleware assigns an ID to the request, which is passed to the
+// converter, tagged on its stats, and errors, and stored with its uploaded
+// output. A valid X-Request-ID header (e.g. from a load balancer) is used as
+// the ID, otherwise a new one is generated. It is returned in the
+// X-Request-ID header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Request.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewV4().String()
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+	}
+}
+
+// validRequestID returns true if the ID is at most 128 letters, digits, '.',
+// '_', or '-'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // ErrorMiddleware runs after all handlers have been executed, and it handles
 // any errors returned from the handlers. It will return an internal server
 // error with a predefined message if the last error type is not public.
 // Otherwise, it will display the last error message it received, and the
-// associated HTTP status code.
+// associated HTTP status code. Both include the code of the error (see
+// errorCode), unless it is overridden with a code set as the error's meta.
 func ErrorMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
@@ -64,18 +311,31 @@ func ErrorMiddleware() gin.HandlerFunc {
 			log.Println("captured errors:")
 			log.Printf("%+v\n", c.Errors)
 
+			code := lastErrorCode(c, lastError)
+			if s, ok := c.Get("statsd"); ok {
+				s.(*statsd.Client).Increment("errors." + strings.ToLower(code))
+			}
+
 			// Public errors
 			if lastError.IsType(gin.ErrorTypePublic) {
 				c.JSON(statusCode, gin.H{
 					"error": lastError.Error(),
+					"code":  code,
 				})
 				return
 			}
 
-			// Private errors
-			c.JSON(500, gin.H{
-				"error": ErrInternalServer.Error(),
-			})
+			// Private errors (with the converter's diagnostics in debugging
+			// mode)
+			res := gin.H{"error": ErrInternalServer.Error(), "code": code}
+			if e, ok := lastError.Err.(*gcmd.ExitError); ok && gin.IsDebugging() {
+				res["exit_code"] = e.ExitCode
+				res["stderr"] = e.Stderr
+			}
+			if r, ok := c.Get("report"); ok && gin.IsDebugging() && len(r.(*converter.Report).Diagnostics) > 0 {
+				res["diagnostics"] = r.(*converter.Report).Diagnostics
+			}
+			c.JSON(500, res)
 		}
 	}
 }
@@ -83,12 +343,331 @@ func ErrorMiddleware() gin.HandlerFunc {
 // AuthorizationMiddleware is a simple authorization middleware which matches
 // an authentication key, provided via a query parameter, against a defined
 // authentication key in the environment config.
-func AuthorizationMiddleware(k string) gin.HandlerFunc {
+func AuthorizationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Query("auth") != k {
+		conf := c.MustGet("config").(Config)
+		if c.Query("auth") != conf.AuthKey {
 			c.AbortWithError(http.StatusUnauthorized, ErrAuthorization).SetType(gin.ErrorTypePublic)
 		}
 
 		c.Next()
 	}
 }
+
+// TenantAuthorizationMiddleware is an authorization middleware for
+// multi-tenancy. It matches an authentication key, provided via a query
+// parameter, against the admin key (defined in the environment config), and
+// the keys of all tenants. The matched tenant is set in the context.
+func TenantAuthorizationMiddleware(r *tenant.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := c.MustGet("config").(Config)
+		auth := c.Query("auth")
+		if t, ok := r.ByKey(auth); ok {
+			c.Set("tenant", t)
+		} else if auth != conf.AuthKey {
+			c.AbortWithError(http.StatusUnauthorized, ErrAuthorization).SetType(gin.ErrorTypePublic)
+		}
+
+		c.Next()
+	}
+}
+
+// QuotaMiddleware rejects requests from tenants that have exceeded their
+// monthly quota. It does nothing for requests without a tenant (e.g. when
+// using the admin key).
+func QuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, ok := c.Get("tenant")
+		a, accounting := c.Get("usage")
+		if !ok || !accounting {
+			return
+		}
+
+		tt := t.(tenant.Tenant)
+		u := a.(*tenant.Accountant).Usage(tt.ID, tenant.Month(time.Now()))
+		if u.Exceeds(tt.Quota) {
+			c.AbortWithError(http.StatusTooManyRequests, tenant.ErrQuotaExceeded).SetType(gin.ErrorTypePublic)
+		}
+	}
+}
+
+// ProfileMiddleware applies the default conversion options of the profile of
+// the tenant (see tenant.Profile) to the query of the request, and rejects
+// requests that override its fixed options, or convert URLs outside of its
+// allowed domains. It does nothing for requests without a tenant, or
+// profile.
+func ProfileMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, ok := c.Get("tenant")
+		if !ok || t.(tenant.Tenant).Profile == nil {
+			return
+		}
+		p := t.(tenant.Tenant).Profile
+
+		q := c.Request.URL.Query()
+		if name, err := p.Apply(q); err != nil {
+			c.AbortWithError(http.StatusBadRequest, fmt.Errorf("%v: %s", err, name)).SetType(gin.ErrorTypePublic)
+			return
+		}
+		for _, s := range q["url"] {
+			if !profileAllows(p, s) {
+				c.AbortWithError(http.StatusForbidden, tenant.ErrDomainNotAllowed).SetType(gin.ErrorTypePublic)
+				return
+			}
+		}
+		c.Request.URL.RawQuery = q.Encode()
+	}
+}
+
+// profileAllows returns true if the host of a URL is in the allowed domains
+// of a profile.
+func profileAllows(p *tenant.Profile, uri string) bool {
+	u, err := url.Parse(uri)
+	return err != nil || u.Host == "" || p.AllowsHost(u.Hostname())
+}
+
+// allowedSource returns tenant.ErrDomainNotAllowed if a source URL is not in
+// the allowed domains of the profile of the tenant of the request. Every
+// fetched URL is checked, as not all of them are options of the request
+// (e.g. the sections of v2 requests, or the URLs of diffs).
+func allowedSource(c *gin.Context, uri string) error {
+	t, ok := c.Get("tenant")
+	if !ok || t.(tenant.Tenant).Profile == nil || profileAllows(t.(tenant.Tenant).Profile, uri) {
+		return nil
+	}
+	return tenant.ErrDomainNotAllowed
+}
+
+// abortWithSourceError fails a request with the error of its source, which
+// is forbidden if its URL is not in the allowed domains of the tenant.
+func abortWithSourceError(c *gin.Context, err error) {
+	if err == tenant.ErrDomainNotAllowed {
+		c.AbortWithError(http.StatusForbidden, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.Error(err)
+}
+
+// PolicyMiddleware runs the policy script on the request, and replaces its
+// query with the options returned by the script. Requests rejected by the
+// script are forbidden.
+func PolicyMiddleware(s *policy.Script) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		options, err := s.Run(policy.Request{
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			ClientIP: c.ClientIP(),
+			Tenant:   tenantID(c),
+			Header:   c.Request.Header,
+			Options:  c.Request.URL.Query(),
+			Sources:  sourceURLs(c),
+		})
+		if err != nil {
+			if _, ok := err.(*policy.Rejection); ok {
+				c.AbortWithError(http.StatusForbidden, err).SetType(gin.ErrorTypePublic)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Request.URL.RawQuery = options.Encode()
+	}
+}
+
+// sourceURLs returns the URLs a request fetches: its 'url' options (e.g.
+// every URL of a merge), the URLs of a diff, and the sections of a v2
+// request.
+func sourceURLs(c *gin.Context) []string {
+	q := c.Request.URL.Query()
+	var urls []string
+	for _, k := range []string{"url", "a", "b"} {
+		for _, v := range q[k] {
+			if v != "" {
+				urls = append(urls, v)
+			}
+		}
+	}
+	if req, ok := c.Get("conversion_request"); ok {
+		for _, s := range req.(ConversionRequest).Sections {
+			if s.URL != "" {
+				urls = append(urls, s.URL)
+			}
+		}
+	}
+	return urls
+}
+
+// maxIdempotencyKey is the maximum length of an Idempotency-Key header.
+const maxIdempotencyKey = 255
+
+// bodyWriter keeps a copy of the response body.
+type bodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint identifies a request by its method, path, query (without
+// the auth key), and body (e.g. an uploaded document, or a v2 conversion
+// request with its sections, and attachments). The body is buffered within
+// the upload limit.
+func requestFingerprint(c *gin.Context) (string, error) {
+	body, err := bufferBody(c)
+	if err != nil {
+		return "", err
+	}
+	q := c.Request.URL.Query()
+	q.Del("auth")
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", c.Request.Method, c.Request.URL.Path, q.Encode())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replayedHeader returns the headers of a response to replay. The request ID,
+// and CORS headers belong to the original request, so they are omitted.
+func replayedHeader(h http.Header) http.Header {
+	replayed := make(http.Header, len(h))
+	for k, v := range h {
+		if k == "X-Request-Id" || strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		replayed[k] = append([]string(nil), v...)
+	}
+	return replayed
+}
+
+// IdempotencyMiddleware returns the original response to a request with the
+// same Idempotency-Key header (per tenant) instead of processing it again.
+// Only successful responses are kept, so failed requests can be retried. It
+// must be used after the authorization middleware.
+func IdempotencyMiddleware(s *idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get("Idempotency-Key")
+		if key == "" {
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.AbortWithError(http.StatusBadRequest, ErrIdempotencyKeyInvalid).SetType(gin.ErrorTypePublic)
+			return
+		}
+		key = tenantID(c) + "\x00" + key
+
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			abortUpload(c, err)
+			return
+		}
+		r, err := s.Begin(key, fingerprint)
+		switch err {
+		case idempotency.ErrInProgress:
+			c.AbortWithError(http.StatusConflict, err).SetType(gin.ErrorTypePublic)
+			return
+		case idempotency.ErrKeyReused:
+			c.AbortWithError(http.StatusUnprocessableEntity, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		if r != nil {
+			for k, v := range r.Header {
+				c.Writer.Header()[k] = v
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Writer.WriteHeader(r.Status)
+			c.Writer.Write(r.Body)
+			c.Abort()
+			return
+		}
+		defer s.Release(key)
+
+		w := &bodyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		if len(c.Errors) > 0 || w.Status() >= 500 {
+			return
+		}
+		s.Finish(key, idempotency.Response{
+			Status: w.Status(),
+			Header: replayedHeader(w.Header()),
+			Body:   w.body.Bytes(),
+		})
+	}
+}
+
+// AdminMiddleware rejects requests from tenants. It must be used after
+// TenantAuthorizationMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("tenant"); ok {
+			c.AbortWithError(http.StatusForbidden, ErrAdminOnly).SetType(gin.ErrorTypePublic)
+		}
+	}
+}
+
+// auditedOptions returns the query parameters of a request without the
+// source URL, and secrets.
+func auditedOptions(c *gin.Context) map[string]string {
+	opts := make(map[string]string)
+	for k, v := range c.Request.URL.Query() {
+		switch k {
+		case "url", "auth", "aws_id", "aws_secret":
+			continue
+		}
+		opts[k] = strings.Join(v, ",")
+	}
+	return opts
+}
+
+// AuditMiddleware records every request to an audit sink once it has been
+// handled. Handlers may set the 'job', 'source', 'source_hash', and 'report'
+// context keys to complete the record.
+func AuditMiddleware(sink audit.Sink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		r := audit.Record{
+			Time:       start.UTC(),
+			JobID:      c.GetString("job"),
+			Tenant:     tenantID(c),
+			RemoteAddr: c.ClientIP(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Source:     c.GetString("source"),
+			SourceHash: c.GetString("source_hash"),
+			Options:    auditedOptions(c),
+			Status:     c.Writer.Status(),
+			Outcome:    audit.OutcomeSuccess,
+			DurationMS: int64(time.Since(start) / time.Millisecond),
+		}
+		if report, ok := c.Get("report"); ok {
+			r.OutputBytes = report.(*converter.Report).Bytes
+		}
+		if r.Status == http.StatusAccepted {
+			r.Outcome = audit.OutcomeQueued
+		}
+		if lastError := c.Errors.Last(); lastError != nil {
+			r.Outcome = audit.OutcomeFailed
+			r.Error = lastError.Error()
+			// See ErrorMiddleware
+			if !lastError.IsType(gin.ErrorTypePublic) {
+				r.Status = http.StatusInternalServerError
+			}
+		} else if r.Status >= 400 {
+			r.Outcome = audit.OutcomeFailed
+		}
+
+		if err := sink.Write(r); err != nil {
+			log.Printf("[Audit] unable to write record: %+v\n", err)
+		}
+	}
+}
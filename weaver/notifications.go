@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// ErrNotifyTooMany should be returned when a request has more notification
+// targets than maxNotifyTargets.
+var ErrNotifyTooMany = errors.New("too many notification targets provided (use up to 5)")
+
+// maxNotifyTargets is the maximum number of notification targets of a
+// request.
+const maxNotifyTargets = 5
+
+// NewNotifiers creates the registry of notification targets using the
+// notification, and email delivery configuration. Webhooks are always
+// available, while the other targets are only registered if they are
+// configured.
+func NewNotifiers(conf Config) *notify.Registry {
+	r := notify.NewRegistry()
+	r.Register("webhook", notify.Webhook{
+		Hosts:   conf.Notify.WebhookHosts,
+		Secret:  conf.Notify.WebhookSecret,
+		Retries: conf.Notify.WebhookRetries,
+	})
+	if conf.EmailDelivery.SMTPAddr != "" {
+		r.Register("email", emailNotifier{conf: conf})
+	}
+	if conf.Notify.SlackWebhookURL != "" {
+		r.Register("slack", notify.Slack{URL: conf.Notify.SlackWebhookURL})
+	}
+	if conf.Notify.SNSTopic != "" {
+		r.Register("sns", notify.NewSNS(conf.Notify.SNSRegion, conf.Notify.SNSTopic))
+	}
+	if conf.Notify.KafkaTopic != "" {
+		r.Register("kafka", notify.NewKafka(conf.Kafka.Brokers, conf.Notify.KafkaTopic))
+	}
+	return r
+}
+
+// notifiers returns the registry of notification targets in the context, or
+// nil if there is none.
+func notifiers(c *gin.Context) *notify.Registry {
+	if r, ok := c.Get("notifiers"); ok {
+		return r.(*notify.Registry)
+	}
+	return nil
+}
+
+// notifyTargets returns the targets the output of a conversion is announced
+// to: the 'notify' options (NAME, or NAME:RECIPIENT), and the recipients of
+// 'email_to'.
+func notifyTargets(c *gin.Context) ([]notify.Target, error) {
+	var targets []notify.Target
+	for _, v := range c.QueryArray("notify") {
+		targets = append(targets, notify.ParseTarget(v))
+	}
+	to, err := emailRecipients(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(to) > 0 {
+		targets = append(targets, notify.Target{Name: "email", To: c.Query("email_to")})
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	if len(targets) > maxNotifyTargets {
+		return nil, ErrNotifyTooMany
+	}
+	if err := notifiers(c).Validate(targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// outputNotification returns the notification of a completed conversion.
+func outputNotification(conf Config, id, source, format string, out []byte, r *converter.Report, o *converter.S3Object) notify.Notification {
+	ext, ok := outputExtensions[format]
+	if !ok {
+		ext = ".pdf"
+	}
+	contentType := athenapdf.ContentTypes[format]
+	if contentType == "" {
+		contentType = athenapdf.ContentTypes[athenapdf.FormatPDF]
+	}
+	n := notify.Notification{
+		Event:       notify.Completed,
+		JobID:       id,
+		Source:      source,
+		Format:      format,
+		ContentType: contentType,
+		Filename:    "document" + ext,
+		Bytes:       len(out),
+		Time:        time.Now().UTC(),
+		Output:      out,
+	}
+	if r != nil {
+		n.Pages, n.SHA256 = r.Pages, r.SHA256
+	}
+	if o != nil {
+		n.Filename = path.Base(o.Key)
+		n.S3Bucket, n.S3Key = o.Bucket, o.Key
+		res := map[string]interface{}{}
+		objectURLs(conf, res, o)
+		n.URL, _ = res["url"].(string)
+	}
+	return n
+}
+
+// notifyOutput announces the output of a conversion to the targets of the
+// request (if any), in the background.
+func notifyOutput(c *gin.Context, format string, out []byte, r *converter.Report, o *converter.S3Object) {
+	targets, _ := notifyTargets(c)
+	if len(targets) == 0 {
+		return
+	}
+	conf := c.MustGet("config").(Config)
+	source, _ := c.Get("source")
+	src, _ := source.(string)
+	n := outputNotification(conf, c.GetString("job"), src, format, out, r, o)
+	sendNotifications(notifiers(c), c.MustGet("statsd").(*statsd.Client), targets, n)
+}
+
+// sendNotifications delivers a notification to every target in the
+// background, counting the deliveries in the '<target>_sent', and
+// '<target>_error' stats. Failures are logged, as the conversion has already
+// completed.
+func sendNotifications(r *notify.Registry, s *statsd.Client, targets []notify.Target, n notify.Notification) {
+	for _, t := range targets {
+		go func(t notify.Target) {
+			if err := r.Notify(t, n); err != nil {
+				log.Printf("[Notify] unable to notify %s of job %s: %+v\n", t.Name, n.JobID, err)
+				s.Increment(t.Name + "_error")
+				return
+			}
+			s.Increment(t.Name + "_sent")
+		}(t)
+	}
+}
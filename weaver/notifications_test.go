@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+func TestNewNotifiers(t *testing.T) {
+	conf := defaultConfig()
+	if got, want := NewNotifiers(conf).Names(), []string{"webhook"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notifiers %v, got %v", want, got)
+	}
+
+	conf.EmailDelivery.SMTPAddr = "smtp.example.com:587"
+	conf.Notify.SlackWebhookURL = "https://hooks.slack.com/services/x"
+	conf.Notify.SNSTopic = "arn:aws:sns:us-east-1:123456789012:weaver"
+	if got, want := NewNotifiers(conf).Names(), []string{"email", "slack", "sns", "webhook"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notifiers %v, got %v", want, got)
+	}
+}
+
+func TestNotifyTargets(t *testing.T) {
+	conf := defaultConfig()
+	conf.EmailDelivery.SMTPAddr = "smtp.example.com:587"
+	conf.Notify.WebhookHosts = []string{"hooks.example.com"}
+
+	tests := []struct {
+		query string
+		want  []notify.Target
+		err   error
+	}{
+		{"", nil, nil},
+		{"?notify=webhook:https://hooks.example.com/a", []notify.Target{{Name: "webhook", To: "https://hooks.example.com/a"}}, nil},
+		{
+			"?notify=email:a@example.com&email_to=b@example.com",
+			[]notify.Target{{Name: "email", To: "a@example.com"}, {Name: "email", To: "b@example.com"}},
+			nil,
+		},
+		{"?notify=webhook:https://example.com/a", nil, notify.ErrTargetInvalid},
+		{"?notify=email:example.com", nil, notify.ErrTargetInvalid},
+		{"?notify=slack", nil, notify.ErrUnknownTarget},
+		{"?email_to=example.com", nil, ErrEmailToInvalid},
+		{"?notify=webhook:https://hooks.example.com/a&notify=webhook:https://hooks.example.com/b&notify=webhook:https://hooks.example.com/c&notify=webhook:https://hooks.example.com/d&notify=webhook:https://hooks.example.com/e&notify=webhook:https://hooks.example.com/f", nil, ErrNotifyTooMany},
+	}
+	for _, tt := range tests {
+		var got []notify.Target
+		var err error
+		r := gin.New()
+		r.Use(ConfigMiddleware(conf), NotifiersMiddleware(NewNotifiers(conf)))
+		r.GET("/", func(c *gin.Context) {
+			got, err = notifyTargets(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, tt.want) || err != tt.err {
+			t.Errorf("expected targets of %q to be %v (%v), got %v (%v)", tt.query, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestOutputNotification(t *testing.T) {
+	conf := defaultConfig()
+	o := &converter.S3Object{Bucket: "reports", Key: "2018/q1.png", URL: "https://reports.s3.amazonaws.com/2018/q1.png"}
+	n := outputNotification(conf, "42", "https://example.com", "png", []byte("PNG"), &converter.Report{Pages: 1, SHA256: "abc"}, o)
+
+	want := notify.Notification{
+		Event:       notify.Completed,
+		JobID:       "42",
+		Source:      "https://example.com",
+		Format:      "png",
+		ContentType: "image/png",
+		Filename:    "q1.png",
+		Pages:       1,
+		Bytes:       3,
+		SHA256:      "abc",
+		S3Bucket:    "reports",
+		S3Key:       "2018/q1.png",
+		URL:         o.URL,
+		Time:        n.Time,
+		Output:      []byte("PNG"),
+	}
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("expected notification %+v, got %+v", want, n)
+	}
+}
+
+func TestSendNotifications(t *testing.T) {
+	received := make(chan notify.Notification, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notify.Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		received <- n
+	}))
+	defer ts.Close()
+
+	s, _ := statsd.New(statsd.Mute(true))
+	targets := []notify.Target{{Name: "webhook", To: ts.URL}}
+	n := outputNotification(defaultConfig(), "42", "https://example.com", "", []byte("%PDF"), nil, nil)
+	sendNotifications(NewNotifiers(defaultConfig()), s, targets, n)
+
+	select {
+	case got := <-received:
+		if got.JobID != "42" || got.Filename != "document.pdf" || got.Bytes != 4 {
+			t.Errorf("expected the notification of job 42, got %+v", got)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the webhook to be notified")
+	}
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka publishes notifications as JSON messages to a Kafka topic, keyed by
+// job ID.
+type Kafka struct {
+	w *kafka.Writer
+}
+
+// NewKafka creates a new Kafka notifier for the topic on the given brokers
+// (HOST:PORT).
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{
+		w: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		},
+	}
+}
+
+// Validate returns ErrTargetInvalid if there is a recipient, as the topic is
+// configured.
+func (k *Kafka) Validate(to string) error {
+	if to != "" {
+		return ErrTargetInvalid
+	}
+	return nil
+}
+
+// Notify writes a notification to the Kafka topic.
+func (k *Kafka) Notify(to string, n Notification) error {
+	if err := k.Validate(to); err != nil {
+		return err
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return k.w.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(n.JobID),
+		Value: b,
+	})
+}
+
+// Close closes the connection to the brokers.
+func (k *Kafka) Close() error {
+	return k.w.Close()
+}
@@ -0,0 +1,147 @@
+// Package notify announces the outputs of conversions to the targets chosen
+// by their requests (e.g. a webhook, or a Slack channel). Targets are
+// registered by name, so that a new kind of target only has to implement
+// Notifier.
+package notify
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Completed is the event of a notification of a completed conversion.
+const Completed = "completed"
+
+var (
+	// ErrUnknownTarget is returned when a target is not registered.
+	ErrUnknownTarget = errors.New("unknown notification target")
+	// ErrTargetInvalid is returned when the recipient of a target is
+	// invalid (e.g. a webhook without a URL).
+	ErrTargetInvalid = errors.New("invalid notification target")
+)
+
+// Notification announces the output of a conversion.
+type Notification struct {
+	Event       string `json:"event"`
+	JobID       string `json:"job_id"`
+	Source      string `json:"source,omitempty"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	// Filename is the name of the output: the base name of its S3 key, or
+	// 'document' with the extension of its format.
+	Filename string `json:"filename"`
+	Pages    int    `json:"pages"`
+	Bytes    int    `json:"bytes"`
+	SHA256   string `json:"sha256,omitempty"`
+	// S3Bucket, S3Key, and URL locate the output, if it was uploaded.
+	S3Bucket string    `json:"s3_bucket,omitempty"`
+	S3Key    string    `json:"s3_key,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Time     time.Time `json:"time"`
+	// Output is the output itself, for targets delivering it (e.g. email).
+	Output []byte `json:"-"`
+}
+
+// Notifier delivers notifications to the recipients of a kind of target.
+type Notifier interface {
+	// Validate returns ErrTargetInvalid if a recipient is invalid.
+	Validate(to string) error
+	// Notify delivers a notification to a recipient.
+	Notify(to string, n Notification) error
+}
+
+// Target is a notifier, and its recipient (which is empty for targets with
+// a configured recipient, e.g. a Slack channel).
+type Target struct {
+	Name string `json:"name"`
+	To   string `json:"to,omitempty"`
+}
+
+// ParseTarget parses a target as NAME, or NAME:RECIPIENT, e.g.
+// 'webhook:https://example.com/hook'.
+func ParseTarget(s string) Target {
+	kv := strings.SplitN(s, ":", 2)
+	t := Target{Name: strings.ToLower(strings.TrimSpace(kv[0]))}
+	if len(kv) == 2 {
+		t.To = strings.TrimSpace(kv[1])
+	}
+	return t
+}
+
+func (t Target) String() string {
+	if t.To == "" {
+		return t.Name
+	}
+	return t.Name + ":" + t.To
+}
+
+// Registry contains the available notifiers, by name. A nil registry has no
+// notifiers.
+type Registry struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{notifiers: make(map[string]Notifier)}
+}
+
+// Register adds a notifier, replacing the notifier of the same name (if any).
+func (r *Registry) Register(name string, n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[strings.ToLower(name)] = n
+}
+
+// Names returns the names of the registered notifiers, sorted.
+func (r *Registry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.notifiers))
+	for name := range r.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) get(name string) (Notifier, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.notifiers[name]
+	return n, ok
+}
+
+// Validate returns an error if a target is not registered, or if its
+// recipient is invalid.
+func (r *Registry) Validate(targets []Target) error {
+	for _, t := range targets {
+		n, ok := r.get(t.Name)
+		if !ok {
+			return ErrUnknownTarget
+		}
+		if err := n.Validate(t.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notify delivers a notification to a target.
+func (r *Registry) Notify(t Target, n Notification) error {
+	notifier, ok := r.get(t.Name)
+	if !ok {
+		return ErrUnknownTarget
+	}
+	return notifier.Notify(t.To, n)
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordingNotifier struct {
+	got []string
+}
+
+func (r *recordingNotifier) Validate(to string) error {
+	if to == "" {
+		return ErrTargetInvalid
+	}
+	return nil
+}
+
+func (r *recordingNotifier) Notify(to string, n Notification) error {
+	r.got = append(r.got, to+" "+n.JobID)
+	return nil
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Target
+	}{
+		{"slack", Target{Name: "slack"}},
+		{" Webhook:https://example.com:8443/hook", Target{Name: "webhook", To: "https://example.com:8443/hook"}},
+		{"email:a@example.com,b@example.com", Target{Name: "email", To: "a@example.com,b@example.com"}},
+	}
+	for _, tt := range tests {
+		got := ParseTarget(tt.s)
+		if got != tt.want {
+			t.Errorf("expected %q to be parsed as %+v, got %+v", tt.s, tt.want, got)
+		}
+		if got.String() != strings.TrimSpace(strings.Replace(tt.s, "Webhook", "webhook", 1)) {
+			t.Errorf("expected %+v to be formatted as %q, got %q", got, tt.s, got.String())
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	rec := new(recordingNotifier)
+	r.Register("Test", rec)
+	r.Register("other", rec)
+
+	if got, want := r.Names(), []string{"other", "test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected names %v, got %v", want, got)
+	}
+	if err := r.Validate([]Target{{Name: "test", To: "a"}}); err != nil {
+		t.Errorf("expected target to be valid, got %+v", err)
+	}
+	if err := r.Validate([]Target{{Name: "test"}}); err != ErrTargetInvalid {
+		t.Errorf("expected %v, got %v", ErrTargetInvalid, err)
+	}
+	if err := r.Validate([]Target{{Name: "pager", To: "a"}}); err != ErrUnknownTarget {
+		t.Errorf("expected %v, got %v", ErrUnknownTarget, err)
+	}
+	if err := r.Notify(Target{Name: "test", To: "a"}, Notification{JobID: "1"}); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := rec.got, []string{"a 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notifications %v, got %v", want, got)
+	}
+
+	var nilRegistry *Registry
+	if err := nilRegistry.Validate([]Target{{Name: "test", To: "a"}}); err != ErrUnknownTarget {
+		t.Errorf("expected %v from a nil registry, got %v", ErrUnknownTarget, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var body []byte
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer ts.Close()
+
+	w := Webhook{Secret: "s3cret"}
+	n := Notification{Event: Completed, JobID: "42", Filename: "document.pdf", Pages: 2, Output: []byte("%PDF")}
+	if err := w.Notify(ts.URL+"/hook", n); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("expected a JSON body, got %q", body)
+	}
+	if got["job_id"] != "42" || got["event"] != Completed || got["output"] != nil {
+		t.Errorf("expected the notification (without its output), got %v", got)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := header.Get("X-Weaver-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("expected signature %q, got %q", want, got)
+	}
+	if got, want := header.Get("X-Weaver-Event"), Completed; got != want {
+		t.Errorf("expected event header %q, got %q", want, got)
+	}
+}
+
+func TestWebhook_retries(t *testing.T) {
+	tests := []struct {
+		retries  int
+		codes    []int
+		attempts int
+		ok       bool
+	}{
+		{1, []int{http.StatusBadGateway, http.StatusOK}, 2, true},
+		{0, []int{http.StatusBadGateway, http.StatusOK}, 1, false},
+		// Client errors are not retried
+		{3, []int{http.StatusBadRequest, http.StatusOK}, 1, false},
+	}
+	for _, tt := range tests {
+		var attempts int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.codes[attempts])
+			attempts++
+		}))
+		err := (Webhook{Retries: tt.retries}).Notify(ts.URL, Notification{})
+		ts.Close()
+		if (err == nil) != tt.ok || attempts != tt.attempts {
+			t.Errorf("expected %d attempt(s) with %v (success: %v), got %d (%v)", tt.attempts, tt.codes, tt.ok, attempts, err)
+		}
+	}
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	w := Webhook{Hosts: []string{"hooks.example.com"}}
+	tests := []struct {
+		to  string
+		err error
+	}{
+		{"https://hooks.example.com/a", nil},
+		{"http://HOOKS.example.com:8080/a", nil},
+		{"https://example.com/a", ErrTargetInvalid},
+		{"ftp://hooks.example.com/a", ErrTargetInvalid},
+		{"", ErrTargetInvalid},
+	}
+	for _, tt := range tests {
+		if err := w.Validate(tt.to); err != tt.err {
+			t.Errorf("expected %q to be %v, got %v", tt.to, tt.err, err)
+		}
+	}
+}
+
+func TestSlack(t *testing.T) {
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer ts.Close()
+
+	s := Slack{URL: ts.URL}
+	if err := s.Validate("#general"); err != ErrTargetInvalid {
+		t.Errorf("expected %v, got %v", ErrTargetInvalid, err)
+	}
+	n := Notification{Filename: "q1.pdf", Pages: 3, URL: "https://cdn.example.com/q1.pdf", Source: "https://example.com"}
+	if err := s.Notify("", n); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if want := "<https://cdn.example.com/q1.pdf|q1.pdf> is ready (3 page(s)), converted from https://example.com"; got["text"] != want {
+		t.Errorf("expected text %q, got %q", want, got["text"])
+	}
+}
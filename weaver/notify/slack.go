@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Slack posts notifications as messages to a Slack channel, through its
+// incoming webhook.
+type Slack struct {
+	// URL is the URL of the incoming webhook of the channel.
+	URL string
+}
+
+// Validate returns ErrTargetInvalid if there is a recipient, as the channel
+// is the one of the webhook.
+func (s Slack) Validate(to string) error {
+	if to != "" {
+		return ErrTargetInvalid
+	}
+	return nil
+}
+
+// Notify posts a message announcing the output, linking to it if it was
+// uploaded.
+func (s Slack) Notify(to string, n Notification) error {
+	if err := s.Validate(to); err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{"text": slackText(n)})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	_, err = post(s.URL, header, b)
+	return err
+}
+
+// slackText returns the text of the message of a notification.
+func slackText(n Notification) string {
+	name := n.Filename
+	if n.URL != "" {
+		name = fmt.Sprintf("<%s|%s>", n.URL, n.Filename)
+	}
+	text := fmt.Sprintf("%s is ready (%d page(s))", name, n.Pages)
+	if n.Source != "" {
+		text += fmt.Sprintf(", converted from %s", n.Source)
+	}
+	return text
+}
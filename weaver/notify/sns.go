@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// SNS publishes notifications as JSON messages to an Amazon SNS topic.
+type SNS struct {
+	svc *sns.SNS
+	// TopicARN is the ARN of the SNS topic.
+	TopicARN string
+}
+
+// NewSNS creates a new SNS notifier for the topic in the given region.
+// Credentials are resolved using the default AWS credential chain.
+func NewSNS(region, topicARN string) *SNS {
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	return &SNS{svc: sns.New(sess), TopicARN: topicARN}
+}
+
+// Validate returns ErrTargetInvalid if there is a recipient, as the topic is
+// configured.
+func (s *SNS) Validate(to string) error {
+	if to != "" {
+		return ErrTargetInvalid
+	}
+	return nil
+}
+
+// Notify publishes a notification to the SNS topic. The event is set as a
+// message attribute so that subscribers can filter on it.
+func (s *SNS) Notify(to string, n Notification) error {
+	if err := s.Validate(to); err != nil {
+		return err
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = s.svc.Publish(&sns.PublishInput{
+		TopicArn: aws.String(s.TopicARN),
+		Message:  aws.String(string(b)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"event": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(n.Event),
+			},
+		},
+	})
+	return err
+}
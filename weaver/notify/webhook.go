@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookTimeout is the timeout of a request to a webhook, or Slack.
+const webhookTimeout = time.Second * 10
+
+// Webhook POSTs notifications as JSON to the URL of the recipient.
+type Webhook struct {
+	// Hosts are the hosts that webhooks may be sent to. Any host is allowed
+	// if it is empty.
+	Hosts []string
+	// Secret signs the notifications (if set): the 'X-Weaver-Signature'
+	// header is 'sha256=' followed by the hex encoded HMAC-SHA256 of the
+	// body.
+	Secret string
+	// Retries is the number of times a failed request is retried, after 1,
+	// 2, 4… seconds. Responses other than 5xx are not retried.
+	Retries int
+}
+
+// Validate returns ErrTargetInvalid if the recipient is not an HTTP(S) URL of
+// an allowed host.
+func (w Webhook) Validate(to string) error {
+	u, err := url.Parse(to)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrTargetInvalid
+	}
+	if len(w.Hosts) == 0 {
+		return nil
+	}
+	for _, h := range w.Hosts {
+		if strings.EqualFold(h, u.Hostname()) || strings.EqualFold(h, u.Host) {
+			return nil
+		}
+	}
+	return ErrTargetInvalid
+}
+
+// Notify POSTs a notification to the URL of the recipient.
+func (w Webhook) Notify(to string, n Notification) error {
+	if err := w.Validate(to); err != nil {
+		return err
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Weaver-Event", n.Event)
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(b)
+		header.Set("X-Weaver-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := post(to, header, b)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends a request, and returns its error, and whether it may be
+// retried.
+func post(to string, header http.Header, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", to, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = header
+	res, err := (&http.Client{Timeout: webhookTimeout}).Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode >= 500, fmt.Errorf("notifying %s failed: %s", to, res.Status)
+	}
+	return false, nil
+}
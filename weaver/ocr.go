@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+	"github.com/lachee/athenapdf/weaver/ocr"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrOCRDisabled should be returned when OCR is requested, but it is not
+	// enabled.
+	ErrOCRDisabled = errors.New("OCR is not enabled")
+	// ErrOCRFormat should be returned when OCR is requested for an output
+	// format other than PDF.
+	ErrOCRFormat = errors.New("OCR is only supported by the PDF format")
+	// ErrOCRLanguagesInvalid should be returned when the OCR languages of a
+	// request are invalid.
+	ErrOCRLanguagesInvalid = errors.New("invalid OCR languages provided (expected languages joined by '+', e.g. 'eng+fra')")
+)
+
+// newOCR returns the OCR of the configuration, with the languages (or the
+// configured languages if empty).
+func newOCR(conf Config, languages string) *ocr.OCR {
+	if languages == "" {
+		languages = conf.OCR.Languages
+	}
+	return &ocr.OCR{
+		Tesseract:  conf.OCR.Tesseract,
+		Rasterizer: conf.OCR.Rasterizer,
+		Languages:  languages,
+		Dir:        converter.Spool.Dir(),
+	}
+}
+
+// requestOCR returns the OCR requested for the output of a conversion
+// ('ocr', in the languages of 'ocr_languages'), or nil.
+func requestOCR(c *gin.Context) (*ocr.OCR, error) {
+	if !queryFlag(c, "ocr") {
+		return nil, nil
+	}
+	return documentOCR(c)
+}
+
+// documentOCR returns the OCR of a request, in the languages of
+// 'ocr_languages'.
+func documentOCR(c *gin.Context) (*ocr.OCR, error) {
+	conf := c.MustGet("config").(Config)
+	if !conf.OCR.Enabled {
+		return nil, ErrOCRDisabled
+	}
+	languages := c.Query("ocr_languages")
+	if languages != "" && !ocr.ValidLanguages(languages) {
+		return nil, ErrOCRLanguagesInvalid
+	}
+	return newOCR(conf, languages), nil
+}
+
+// checkOCR checks that OCR can be applied to the output of a conversion.
+func checkOCR(c *gin.Context) error {
+	o, err := requestOCR(c)
+	if o == nil || err != nil {
+		return err
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+		return ErrOCRFormat
+	}
+	return nil
+}
+
+// isImage returns true if data is an image (including TIFF images, which are
+// common for scans).
+func isImage(b []byte) bool {
+	if bytes.HasPrefix(b, []byte("II*\x00")) || bytes.HasPrefix(b, []byte("MM\x00*")) {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(b), "image/")
+}
+
+// ocrConversion recognizes the text of a document in the work queue, so that
+// OCR is limited by the workers, and their timeout. The source of the
+// conversion is ignored.
+type ocrConversion struct {
+	converter.Conversion
+	ocr *ocr.OCR
+	doc []byte
+	// pages is set to the number of recognized pages.
+	pages *int
+}
+
+func (c ocrConversion) Convert(s converter.ConversionSource, done <-chan struct{}, progress converter.ProgressFunc) ([]byte, error) {
+	if !pdf.IsPDF(c.doc) {
+		*c.pages = 1
+		return c.ocr.Image(c.doc, done)
+	}
+	out, n, err := c.ocr.PDF(c.doc, done)
+	*c.pages = n
+	return out, err
+}
+
+// ocrHandler adds a searchable text layer to the pages of a PDF document
+// without text (e.g. scans), or converts an image to a PDF document with its
+// text, using tesseract. Pages with text are not modified.
+func ocrHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	wq := c.MustGet("queue").(chan<- converter.Work)
+
+	o, err := documentOCR(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	b, _, err := readDocument(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	if !pdf.IsPDF(b) && !isImage(b) {
+		c.AbortWithError(http.StatusUnprocessableEntity, ocr.ErrNotImage).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	pages := 0
+	work := converter.NewWork(wq, ocrConversion{ocr: o, doc: b, pages: &pages}, converter.ConversionSource{})
+	select {
+	case <-c.Writer.CloseNotify():
+		work.Cancel()
+	case out := <-work.Success():
+		s.Increment("ocr")
+		c.Header("X-OCR-Pages", strconv.Itoa(pages))
+		c.Header("X-Page-Count", strconv.Itoa(pdf.PageCount(out)))
+		c.Data(http.StatusOK, "application/pdf", out)
+	case err := <-work.Error():
+		s.Increment("ocr_error")
+		switch err {
+		case converter.ErrConversionTimeout, gcmd.ErrCmdTerminated:
+			c.AbortWithError(http.StatusGatewayTimeout, converter.ErrConversionTimeout).SetType(gin.ErrorTypePublic)
+		case pdf.ErrNotPDF, pdf.ErrNoPages, pdf.ErrEncrypted:
+			abortDocument(c, err)
+		default:
+			c.Error(err)
+		}
+	}
+}
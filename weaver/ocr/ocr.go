@@ -0,0 +1,136 @@
+// Package ocr adds a searchable text layer to scanned, or image-based
+// documents (i.e. pages without extractable text) using tesseract.
+package ocr
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// ErrNotImage should be returned when a document is neither a PDF document,
+// nor an image.
+var ErrNotImage = errors.New("OCR requires a PDF document, or an image")
+
+var languagesPattern = regexp.MustCompile(`^[A-Za-z_]+(\+[A-Za-z_]+)*$`)
+
+// ValidLanguages returns true if languages are tesseract languages, joined
+// by '+' (e.g. 'eng+fra').
+func ValidLanguages(languages string) bool {
+	return languagesPattern.MatchString(languages)
+}
+
+// OCR recognizes the text of images, and pages without text.
+type OCR struct {
+	// Tesseract is the tesseract command, e.g. 'tesseract --oem 1'. The
+	// image, the output base name, the languages ('-l'), and the 'pdf'
+	// configuration are appended to it.
+	Tesseract string
+	// Rasterizer is the command rendering a page of a PDF document as a PNG
+	// image, e.g. 'pdftoppm -r 300 -png -singlefile'. The page ('-f', and
+	// '-l'), the document, and the output prefix are appended to it.
+	Rasterizer string
+	// Languages are the languages of the text, joined by '+'.
+	Languages string
+	// Dir is the directory of the temporary files. Defaults to the system
+	// temporary directory.
+	Dir string
+}
+
+// Image returns a single page PDF document of an image, with its recognized
+// text as an invisible layer above it.
+func (o OCR) Image(b []byte, done <-chan struct{}) ([]byte, error) {
+	dir, err := ioutil.TempDir(o.Dir, "ocr")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image")
+	if err := ioutil.WriteFile(image, b, 0600); err != nil {
+		return nil, err
+	}
+	return o.tesseract(image, filepath.Join(dir, "out"), done)
+}
+
+// PDF adds a text layer to the pages of a PDF document without text, and
+// returns the document, and the number of pages that were recognized. The
+// document is returned unchanged if every page has text. Other pages are not
+// modified.
+func (o OCR) PDF(b []byte, done <-chan struct{}) ([]byte, int, error) {
+	info, err := pdf.Inspect(b, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	var pages []int
+	for _, p := range info.Pages {
+		if strings.TrimSpace(p.Text) == "" {
+			pages = append(pages, p.Number)
+		}
+	}
+	if len(pages) == 0 {
+		return b, 0, nil
+	}
+
+	dir, err := ioutil.TempDir(o.Dir, "ocr")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.pdf")
+	if err := ioutil.WriteFile(in, b, 0600); err != nil {
+		return nil, 0, err
+	}
+	docs, err := pdf.Split(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, n := range pages {
+		prefix := filepath.Join(dir, "page-"+strconv.Itoa(n))
+		page := strconv.Itoa(n)
+		cmd := append(strings.Fields(o.Rasterizer), "-f", page, "-l", page, in, prefix)
+		if _, err := gcmd.Execute(cmd, done); err != nil {
+			return nil, 0, err
+		}
+		out, err := o.tesseract(prefix+".png", prefix, done)
+		if err != nil {
+			return nil, 0, err
+		}
+		docs[n-1] = out
+	}
+	out, err := pdf.Merge(docs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, len(pages), nil
+}
+
+// tesseract recognizes the text of an image, and returns the PDF document
+// written to the output base name.
+func (o OCR) tesseract(image, out string, done <-chan struct{}) ([]byte, error) {
+	cmd := append(strings.Fields(o.Tesseract), image, out)
+	if o.Languages != "" {
+		cmd = append(cmd, "-l", o.Languages)
+	}
+	cmd = append(cmd, "pdf")
+	if _, err := gcmd.Execute(cmd, done); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(out + ".pdf")
+	if err != nil {
+		return nil, err
+	}
+	if !pdf.IsPDF(b) || !bytes.Contains(b, []byte("%%EOF")) {
+		return nil, pdf.ErrNotPDF
+	}
+	return b, nil
+}
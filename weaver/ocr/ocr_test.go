@@ -0,0 +1,132 @@
+package ocr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// scannedPDF has a page without text (e.g. a scan), and a page with text.
+const scannedPDF = `%PDF-1.3
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 612 792] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R >> endobj
+4 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 6 0 R >> endobj
+5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj
+6 0 obj << /Length 39 >>
+stream
+BT /F1 12 Tf 72 700 Td (Typed) Tj ET
+endstream
+endobj
+trailer << /Root 1 0 R >>
+%%EOF`
+
+// recognizedPDF is the output of the tesseract stub.
+const recognizedPDF = `%PDF-1.3
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >> endobj
+4 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj
+5 0 obj << /Length 44 >>
+stream
+BT 3 Tr /F1 12 Tf 72 700 Td (Scanned) Tj ET
+endstream
+endobj
+trailer << /Root 1 0 R >>
+%%EOF`
+
+// mockOCR returns an OCR with stubs of tesseract, and the rasterizer, which
+// record their arguments in 'args'.
+func mockOCR(t *testing.T) (OCR, string) {
+	dir := t.TempDir()
+	write := func(name, s string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(s), 0600); err != nil {
+			t.Fatalf("unable to write %s: %+v", name, err)
+		}
+		return p
+	}
+	recognized := write("recognized.pdf", recognizedPDF)
+	args := filepath.Join(dir, "args")
+	tesseract := write("tesseract", "test -f \"$1\" || exit 1\necho tesseract \"$3\" \"$4\" >> "+args+"\ncp "+recognized+" \"$2.pdf\"\n")
+	rasterizer := write("rasterizer", "echo rasterizer \"$2\" >> "+args+"\nfor p; do :; done\necho png > \"$p.png\"\n")
+	return OCR{Tesseract: "sh " + tesseract, Rasterizer: "sh " + rasterizer, Languages: "eng+fra", Dir: dir}, args
+}
+
+func TestPDF(t *testing.T) {
+	o, args := mockOCR(t)
+	out, n, err := o.PDF([]byte(scannedPDF), make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to recognize text: %+v", err)
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("expected %d recognized page, got %d", want, got)
+	}
+	info, err := pdf.Inspect(out, true)
+	if err != nil {
+		t.Fatalf("unable to inspect output: %+v", err)
+	}
+	if got, want := len(info.Pages), 2; got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+	if got, want := info.Pages[0].Text, "Scanned"; got != want {
+		t.Errorf("expected text of the first page to be %q, got %q", want, got)
+	}
+	if got, want := info.Pages[1].Text, "Typed"; got != want {
+		t.Errorf("expected text of the second page to be %q, got %q", want, got)
+	}
+	b, _ := ioutil.ReadFile(args)
+	if got, want := string(b), "rasterizer 1\ntesseract -l eng+fra\n"; got != want {
+		t.Errorf("expected commands to be %q, got %q", want, got)
+	}
+}
+
+func TestPDF_text(t *testing.T) {
+	o, args := mockOCR(t)
+	doc := []byte(recognizedPDF)
+	out, n, err := o.PDF(doc, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to recognize text: %+v", err)
+	}
+	if n != 0 || !bytes.Equal(out, doc) {
+		t.Errorf("expected a document with text to be unchanged, got %d recognized pages", n)
+	}
+	if b, _ := ioutil.ReadFile(args); len(b) > 0 {
+		t.Errorf("expected no commands to be executed, got %q", b)
+	}
+}
+
+func TestImage(t *testing.T) {
+	o, _ := mockOCR(t)
+	out, err := o.Image([]byte("png"), make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to recognize text: %+v", err)
+	}
+	if got, want := pdf.PageCount(out), 1; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+
+	o.Tesseract = "false"
+	if _, err := o.Image([]byte("png"), make(chan struct{})); err == nil {
+		t.Errorf("expected an error if tesseract fails")
+	}
+}
+
+func TestValidLanguages(t *testing.T) {
+	tests := map[string]bool{
+		"eng":         true,
+		"eng+fra":     true,
+		"chi_sim+eng": true,
+		"":            false,
+		"eng+":        false,
+		"eng --psm":   false,
+	}
+	for languages, want := range tests {
+		if got := ValidLanguages(languages); got != want {
+			t.Errorf("expected %q to be valid: %t, got %t", languages, want, got)
+		}
+	}
+}
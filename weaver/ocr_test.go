@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+// mockOCRRouter returns a router with OCR enabled, where tesseract is a stub
+// writing the test PDF.
+func mockOCRRouter(t *testing.T) *gin.Engine {
+	testPDF, err := filepath.Abs("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to find test PDF: %+v", err)
+	}
+	tesseract := filepath.Join(t.TempDir(), "tesseract")
+	if err := ioutil.WriteFile(tesseract, []byte("cp "+testPDF+" \"$2.pdf\"\n"), 0600); err != nil {
+		t.Fatalf("unable to write tesseract stub: %+v", err)
+	}
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.OCR.Enabled = true
+	conf.OCR.Tesseract = "sh " + tesseract
+	pool := converter.NewPool(1, 10, 10)
+	svc := Services{Queue: pool.Queue(), Pool: pool}
+	return mockRouter(conf, svc, InitSecureRoutes)
+}
+
+func TestOCRHandler(t *testing.T) {
+	r := mockOCRRouter(t)
+
+	// An image is converted to a PDF document
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 10, 10)))
+	res := streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(res, uploadRequest("/pdf/ocr?auth=123456&ocr_languages=eng%2Bfra", "scan.png", img.Bytes()))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	if got, want := res.Header().Get("X-OCR-Pages"), "1"; got != want {
+		t.Errorf("expected recognized pages to be %s, got %s", want, got)
+	}
+
+	// A document with text is unchanged
+	doc := mockDocument(t)
+	res = streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(res, uploadRequest("/pdf/ocr?auth=123456", "report.pdf", doc))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	if got, want := res.Header().Get("X-OCR-Pages"), "0"; got != want {
+		t.Errorf("expected recognized pages to be %s, got %s", want, got)
+	}
+	if !bytes.Equal(res.Body.Bytes(), doc) {
+		t.Errorf("expected the document to be unchanged")
+	}
+}
+
+func TestOCRHandler_invalid(t *testing.T) {
+	tests := []struct {
+		target string
+		file   []byte
+		code   int
+	}{
+		{"/pdf/ocr?auth=123456&ocr_languages=eng+--psm", []byte("%PDF-1.4"), http.StatusBadRequest},
+		{"/pdf/ocr?auth=123456", []byte("plain text"), http.StatusUnprocessableEntity},
+	}
+	r := mockOCRRouter(t)
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, uploadRequest(tt.target, "document", tt.file))
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d", tt.target, want, got)
+		}
+	}
+
+	// OCR is disabled by default
+	res := httptest.NewRecorder()
+	mockDocumentRouter().ServeHTTP(res, uploadRequest("/pdf/ocr?auth=123456", "report.pdf", mockDocument(t)))
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,111 @@
+// Package outputcache stores the outputs of conversions with the cache
+// validators (ETag, and Last-Modified) of their sources, so that a
+// conversion of an unchanged source can return its previous output.
+package outputcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is a cached output.
+type Entry struct {
+	// ETag, and LastModified are the validators of the source.
+	ETag         string
+	LastModified string
+	Output       []byte
+	// Pages is the number of pages of the output (if known).
+	Pages int
+	// Time is when the output was cached.
+	Time time.Time
+	// Tenant, and Subject identify the person the output is about (if any),
+	// so that it can be erased.
+	Tenant  string
+	Subject string
+}
+
+// Store keeps outputs in memory for a ttl, up to a maximum total size (the
+// oldest are dropped first). It is not shared between instances.
+type Store struct {
+	mu       sync.Mutex
+	entries  map[string]Entry
+	order    []string
+	size     int
+	ttl      time.Duration
+	maxBytes int
+}
+
+// NewStore creates a store.
+func NewStore(ttl time.Duration, maxBytes int) *Store {
+	return &Store{entries: make(map[string]Entry), ttl: ttl, maxBytes: maxBytes}
+}
+
+// Get returns the output cached for a key.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+// Put caches an output for a key, replacing any previous output. Outputs of
+// sources without validators, and outputs larger than the maximum size are
+// not cached.
+func (s *Store) Put(key string, e Entry) {
+	if e.ETag == "" && e.LastModified == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if len(e.Output) > s.maxBytes {
+		return
+	}
+	e.Time = time.Now()
+	s.entries[key] = e
+	s.order = append(s.order, key)
+	s.size += len(e.Output)
+	for s.size > s.maxBytes {
+		s.remove(s.order[0])
+	}
+}
+
+// Erase removes the outputs of a subject (of any tenant if tenant is empty),
+// and returns their number.
+func (s *Store) Erase(tenant, subject string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k, e := range s.entries {
+		if e.Subject == subject && (tenant == "" || e.Tenant == tenant) {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		s.remove(k)
+	}
+	return len(keys)
+}
+
+// expire removes the outputs older than the ttl.
+func (s *Store) expire(now time.Time) {
+	for len(s.order) > 0 && now.Sub(s.entries[s.order[0]].Time) > s.ttl {
+		s.remove(s.order[0])
+	}
+}
+
+func (s *Store) remove(key string) {
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.size -= len(e.Output)
+	delete(s.entries, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package outputcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(time.Hour, 1024)
+	s.Put("test-key", Entry{ETag: `"v1"`, Output: []byte("test")})
+	e, ok := s.Get("test-key")
+	if !ok {
+		t.Fatalf("expected output to be cached")
+	}
+	if got, want := string(e.Output), "test"; got != want {
+		t.Errorf("expected cached output to be %s, got %s", want, got)
+	}
+
+	s.Put("test-key", Entry{ETag: `"v2"`, Output: []byte("test 2")})
+	if e, _ := s.Get("test-key"); e.ETag != `"v2"` {
+		t.Errorf("expected cached output to be replaced, got %+v", e)
+	}
+	if got, want := s.size, 6; got != want {
+		t.Errorf("expected size of the cache to be %d, got %d", want, got)
+	}
+}
+
+func TestStore_noValidators(t *testing.T) {
+	s := NewStore(time.Hour, 1024)
+	s.Put("test-key", Entry{Output: []byte("test")})
+	if _, ok := s.Get("test-key"); ok {
+		t.Errorf("expected output of a source without validators not to be cached")
+	}
+}
+
+func TestStore_expire(t *testing.T) {
+	s := NewStore(time.Millisecond, 1024)
+	s.Put("test-key", Entry{LastModified: "Mon, 04 Jun 2018 12:00:00 GMT", Output: []byte("test")})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := s.Get("test-key"); ok {
+		t.Errorf("expected output to expire")
+	}
+}
+
+func TestStore_maxBytes(t *testing.T) {
+	s := NewStore(time.Hour, 8)
+	s.Put("first", Entry{ETag: `"1"`, Output: []byte("12345")})
+	s.Put("second", Entry{ETag: `"2"`, Output: []byte("12345")})
+	if _, ok := s.Get("first"); ok {
+		t.Errorf("expected oldest output to be evicted")
+	}
+	if _, ok := s.Get("second"); !ok {
+		t.Errorf("expected newest output to be kept")
+	}
+	s.Put("large", Entry{ETag: `"3"`, Output: []byte("123456789")})
+	if _, ok := s.Get("large"); ok {
+		t.Errorf("expected output larger than the maximum size not to be cached")
+	}
+}
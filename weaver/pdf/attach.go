@@ -0,0 +1,153 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	// ErrAttachmentName is returned when attachments do not have unique
+	// names.
+	ErrAttachmentName = errors.New("attachments must have unique, non-empty names")
+	// ErrRelationshipInvalid is returned when an attachment has an unknown
+	// relationship.
+	ErrRelationshipInvalid = errors.New("invalid attachment relationship provided (use Source, Data, Alternative, Supplement, or Unspecified)")
+	// ErrNoCatalog is returned when attaching files to a document without a
+	// catalog.
+	ErrNoCatalog = errors.New("PDF document has no catalog")
+)
+
+// relationships are the relationships of attachments to a document (the
+// AFRelationship of PDF/A-3).
+var relationships = map[string]bool{
+	"Source": true, "Data": true, "Alternative": true, "Supplement": true, "Unspecified": true,
+}
+
+// Attachment is a file embedded in a document (see Attach).
+type Attachment struct {
+	Name string `json:"name"`
+	// MimeType is the type of the file, e.g. 'text/xml'. Defaults to
+	// 'application/octet-stream'.
+	MimeType    string `json:"mime_type,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Relationship is the relationship of the file to the document: 'Source'
+	// (e.g. the HTML it was rendered from), 'Data' (e.g. the XML invoice of
+	// ZUGFeRD, or Factur-X documents), 'Alternative', 'Supplement', or
+	// 'Unspecified' (default).
+	Relationship string `json:"relationship,omitempty"`
+	Data         []byte `json:"data"`
+}
+
+// CheckAttachments returns an error if files cannot be attached to a
+// document together.
+func CheckAttachments(files []Attachment) error {
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if f.Name == "" || seen[f.Name] {
+			return ErrAttachmentName
+		}
+		seen[f.Name] = true
+		if f.Relationship != "" && !relationships[f.Relationship] {
+			return ErrRelationshipInvalid
+		}
+	}
+	return nil
+}
+
+// Attach embeds files in a PDF document, as an incremental update, so that
+// the document is otherwise unchanged. The files are listed in the embedded
+// files of the document, and its associated files (as required by PDF/A-3),
+// replacing any existing embedded files.
+func Attach(b []byte, files ...Attachment) ([]byte, error) {
+	if len(files) == 0 {
+		return b, nil
+	}
+	if err := CheckAttachments(files); err != nil {
+		return nil, err
+	}
+	d, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := d.get(d.root)
+	if !ok || name(catalog.dict, "Type") != "Catalog" {
+		return nil, ErrNoCatalog
+	}
+
+	// The names of embedded files must be sorted
+	files = append([]Attachment(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	u := newUpdate(b, d)
+	var tree, af []string
+	for _, f := range files {
+		mime, rel := f.MimeType, f.Relationship
+		if mime == "" {
+			mime = "application/octet-stream"
+		}
+		if rel == "" {
+			rel = "Unspecified"
+		}
+		file := u.add(fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /%s /Params << /Size %d >> /Filter /FlateDecode >>", encodeName(mime), len(f.Data)), deflate(f.Data))
+
+		spec := fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /EF << /F %d 0 R /UF %d 0 R >> /AFRelationship /%s", textString(f.Name), textString(f.Name), file, file, rel)
+		if f.Description != "" {
+			spec += " /Desc " + textString(f.Description)
+		}
+		id := u.add(spec+" >>", nil)
+
+		tree = append(tree, fmt.Sprintf("%s %d 0 R", textString(f.Name), id))
+		af = append(af, fmt.Sprintf("%d 0 R", id))
+	}
+
+	// The catalog is replaced by a catalog with the files
+	dict := bytes.TrimSpace(catalog.dict)
+	names := d.resolve(value(dict, "Names"))
+	names = setEntry(names, "EmbeddedFiles", []byte("<< /Names ["+strings.Join(tree, " ")+"] >>"))
+	dict = setEntry(dict, "Names", names)
+	dict = setEntry(dict, "AF", []byte("["+strings.Join(af, " ")+"]"))
+	u.write(d.root, string(dict), nil)
+	return u.bytes(), nil
+}
+
+// encodeName returns a string as the characters of a PDF name (e.g.
+// 'text/xml' is 'text#2Fxml').
+func encodeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' || strings.IndexByte("#/()<>[]{}%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// textString returns text as a PDF text string: a literal string if it is
+// ASCII, or a UTF-16 hexadecimal string otherwise.
+func textString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + escapeText(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		b.WriteString(strings.ToUpper(strconv.FormatUint(uint64(u)|0x10000, 16)[1:]))
+	}
+	b.WriteString(">")
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestAttach(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	out, err := Attach(b,
+		Attachment{Name: "source.html", MimeType: "text/html", Relationship: "Source", Data: []byte("<p>hello world</p>")},
+		Attachment{Name: "factur-x.xml", MimeType: "text/xml", Relationship: "Data", Description: "Factur-X invoice", Data: []byte("<rsm:CrossIndustryInvoice/>")},
+	)
+	if err != nil {
+		t.Fatalf("unable to attach files: %+v", err)
+	}
+
+	// The document is updated incrementally
+	if !bytes.HasPrefix(out, b) {
+		t.Errorf("expected the document to be unchanged")
+	}
+	if got, want := PageCount(out), PageCount(b); got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+
+	d := parse(out)
+	catalog, _ := d.get(d.root)
+	files := array(subdict(subdict(catalog.dict, "Names"), "EmbeddedFiles"), "Names")
+	if m := regexp.MustCompile(`\((.*?)\)`).FindAllSubmatch(files, -1); len(m) != 2 || string(m[0][1]) != "factur-x.xml" || string(m[1][1]) != "source.html" {
+		t.Errorf("expected the embedded files to be sorted by name, got %s", files)
+	}
+	if got, want := len(refList(array(catalog.dict, "AF"))), 2; got != want {
+		t.Errorf("expected %d associated files, got %d", want, got)
+	}
+	for _, s := range []string{"/Subtype /text#2Fxml", "/AFRelationship /Data", "/Desc (Factur-X invoice)"} {
+		if !bytes.Contains(out, []byte(s)) {
+			t.Errorf("expected the document to contain %q", s)
+		}
+	}
+	spec, _ := d.get(refList(files)[0])
+	stream, _ := d.get(refList(subdict(spec.dict, "EF"))[0])
+	if data, err := decode(stream); err != nil || string(data) != "<rsm:CrossIndustryInvoice/>" {
+		t.Errorf("expected the embedded file to be the invoice, got %q (%v)", data, err)
+	}
+
+	// Every entry of the new cross-reference section points to its object
+	section := out[bytes.LastIndex(out, []byte("xref\n")):]
+	for _, e := range regexp.MustCompile(`(\d+) 1\n(\d{10}) 00000 n`).FindAllSubmatch(section, -1) {
+		offset, _ := strconv.Atoi(string(e[2]))
+		if header := fmt.Sprintf("%s 0 obj", e[1]); !bytes.HasPrefix(out[offset:], []byte(header)) {
+			t.Errorf("expected object %s at offset %d, got %q", e[1], offset, out[offset:offset+10])
+		}
+	}
+	if !regexp.MustCompile(`/Prev \d+ >>\nstartxref\n\d+\n%%EOF\n$`).Match(out) {
+		t.Errorf("expected the trailer to refer to the previous section, got %q", out[len(out)-80:])
+	}
+}
+
+func TestAttach_invalid(t *testing.T) {
+	tests := []struct {
+		files []Attachment
+		err   error
+	}{
+		{[]Attachment{{Name: "a.xml"}, {Name: "a.xml"}}, ErrAttachmentName},
+		{[]Attachment{{Name: ""}}, ErrAttachmentName},
+		{[]Attachment{{Name: "a.xml", Relationship: "Invoice"}}, ErrRelationshipInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Attach([]byte(simplePDF), tt.files...); err != tt.err {
+			t.Errorf("expected error of %+v to be %v, got %v", tt.files, tt.err, err)
+		}
+	}
+	if _, err := Attach([]byte("%PDF-1.4\n1 0 obj << /Type /Page >> endobj"), Attachment{Name: "a.xml"}); err != ErrNoCatalog {
+		t.Errorf("expected error to be %v, got %v", ErrNoCatalog, err)
+	}
+}
+
+func TestTextString(t *testing.T) {
+	if got, want := textString("invoice (1).xml"), `(invoice \(1\).xml)`; got != want {
+		t.Errorf("expected text string to be %s, got %s", want, got)
+	}
+	if got, want := textString("facture-é.xml"), "<FEFF0066006100630074007500720065002D00E9002E0078006D006C>"; got != want {
+		t.Errorf("expected text string to be %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,116 @@
+package pdf
+
+import "errors"
+
+// ErrBarcodeInvalid is returned when the content of a barcode cannot be
+// encoded as a Code 128 barcode.
+var ErrBarcodeInvalid = errors.New("barcode content must be printable ASCII characters (at most 80)")
+
+// maxBarcodeLength is the maximum number of characters of a barcode, as
+// longer barcodes are not read reliably.
+const maxBarcodeLength = 80
+
+// code128Patterns are the widths of the bars, and spaces of the symbols of
+// Code 128, in modules, by value. The last one is the stop symbol.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Values of the special symbols of Code 128.
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// digits returns the number of digits at the start of s.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// code128 returns the values of the symbols of the Code 128 barcode of s,
+// with its start, check, and stop symbols. Runs of digits are encoded in
+// pairs (code set C), and other characters in code set B.
+func code128(s string) ([]int, error) {
+	if s == "" || len(s) > maxBarcodeLength {
+		return nil, ErrBarcodeInvalid
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 32 || s[i] > 127 {
+			return nil, ErrBarcodeInvalid
+		}
+	}
+
+	var values []int
+	setC := false
+	if n := digits(s); n >= 4 || (n == len(s) && n%2 == 0) {
+		setC = true
+		values = append(values, code128StartC)
+	} else {
+		values = append(values, code128StartB)
+	}
+	for i := 0; i < len(s); {
+		n := digits(s[i:])
+		switch {
+		case setC && n >= 2:
+			values = append(values, int(s[i]-'0')*10+int(s[i+1]-'0'))
+			i += 2
+			continue
+		case setC:
+			setC = false
+			values = append(values, code128CodeB)
+		case n >= 6 || (n >= 4 && i+n == len(s)):
+			// An odd digit is encoded in code set B first
+			if n%2 == 1 {
+				values = append(values, int(s[i])-32)
+				i++
+			}
+			setC = true
+			values = append(values, code128CodeC)
+			continue
+		}
+		values = append(values, int(s[i])-32)
+		i++
+	}
+
+	check := values[0]
+	for i, v := range values[1:] {
+		check += (i + 1) * v
+	}
+	return append(values, check%103, code128Stop), nil
+}
+
+// barcodeModules returns the widths of the alternating bars, and spaces of
+// the Code 128 barcode of s (starting with a bar), in modules, and its total
+// width, without quiet zones.
+func barcodeModules(s string) ([]int, int, error) {
+	values, err := code128(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	var widths []int
+	total := 0
+	for _, v := range values {
+		for _, w := range code128Patterns[v] {
+			widths = append(widths, int(w-'0'))
+			total += int(w - '0')
+		}
+	}
+	return widths, total, nil
+}
@@ -0,0 +1,48 @@
+package pdf
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	for v, p := range code128Patterns {
+		want := 11
+		if v == code128Stop {
+			want = 13
+		}
+		got := 0
+		for _, w := range p {
+			got += int(w - '0')
+		}
+		if got != want {
+			t.Errorf("expected symbol %d to be %d modules wide, got %d", v, want, got)
+		}
+	}
+}
+
+func TestCode128(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		err  error
+	}{
+		{"PJJ123C", "[104 48 42 42 17 18 19 35 55 106]", nil},
+		{"1234", "[105 12 34 82 106]", nil},
+		{"12345", "[105 12 34 100 21 54 106]", nil},
+		{"INV-0012345678", "[104 41 46 54 13 99 0 12 34 56 78 11 106]", nil},
+		{"", "", ErrBarcodeInvalid},
+		{"tab\t", "", ErrBarcodeInvalid},
+		{"naïve", "", ErrBarcodeInvalid},
+	}
+	for _, tt := range tests {
+		values, err := code128(tt.s)
+		if err != tt.err {
+			t.Errorf("expected error of %q to be %v, got %v", tt.s, tt.err, err)
+			continue
+		}
+		if got := fmt.Sprint(values); tt.err == nil && got != tt.want {
+			t.Errorf("expected %q to be encoded as %s, got %s", tt.s, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrFitInvalid is returned when images are laid out with an unknown fit.
+var ErrFitInvalid = errors.New("invalid fit provided (use contain, cover, fill, or none)")
+
+// Fit is how an image is scaled to the page it is drawn on (see FromImages).
+type Fit string
+
+const (
+	// FitContain scales the image to fit within the page, keeping its aspect
+	// ratio.
+	FitContain Fit = "contain"
+	// FitCover scales the image to cover the page, keeping its aspect ratio,
+	// and clips the overflow.
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the page.
+	FitFill Fit = "fill"
+	// FitNone draws the image at its actual size (see ImageLayout.DPI), and
+	// clips the overflow.
+	FitNone Fit = "none"
+)
+
+// Valid returns true if the fit is known, or empty.
+func (f Fit) Valid() bool {
+	switch f {
+	case "", FitContain, FitCover, FitFill, FitNone:
+		return true
+	}
+	return false
+}
+
+// ImageLayout is the layout of the pages of images (see FromImages).
+type ImageLayout struct {
+	// Size is the size of the pages in portrait. The pages of images wider
+	// than they are tall are in landscape. If it is zero, every page has
+	// the actual size of its image, and its margins.
+	Size Size
+	// Fit is how images are scaled to the area of the pages within the
+	// margins. Defaults to FitContain.
+	Fit Fit
+	// Margin is the margin of the pages, in points.
+	Margin float64
+	// DPI is the resolution of the images, which sets their actual size.
+	// Defaults to 96.
+	DPI float64
+}
+
+// FromImages returns a document with a page for every image, in order.
+func FromImages(images []*Image, l ImageLayout) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, ErrNoPages
+	}
+	if !l.Fit.Valid() {
+		return nil, ErrFitInvalid
+	}
+	if l.DPI <= 0 {
+		l.DPI = 96
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := []int{0, 0}
+	next := 3
+	writeObject := objectWriter(&out, &offsets, &next)
+
+	var kids []int
+	for _, im := range images {
+		// The actual size of the image, in points
+		iw, ih := float64(im.width)*72/l.DPI, float64(im.height)*72/l.DPI
+		pw, ph := l.Size.Width, l.Size.Height
+		switch {
+		case l.Size == (Size{}):
+			pw, ph = iw+2*l.Margin, ih+2*l.Margin
+		case (iw > ih) != (pw > ph):
+			pw, ph = ph, pw
+		}
+		bw, bh := math.Max(pw-2*l.Margin, 1), math.Max(ph-2*l.Margin, 1)
+
+		w, h := iw, ih
+		switch l.Fit {
+		case "", FitContain:
+			s := math.Min(bw/iw, bh/ih)
+			w, h = iw*s, ih*s
+		case FitCover:
+			s := math.Max(bw/iw, bh/ih)
+			w, h = iw*s, ih*s
+		case FitFill:
+			w, h = bw, bh
+		}
+		// The image is centered within the margins, and clipped to them
+		x, y := l.Margin+(bw-w)/2, l.Margin+(bh-h)/2
+		content := fmt.Sprintf("q %s %s %s %s re W n %s 0 0 %s %s %s cm /WvImage Do Q",
+			formatNumber(l.Margin), formatNumber(l.Margin), formatNumber(bw), formatNumber(bh), formatNumber(w), formatNumber(h), formatNumber(x), formatNumber(y))
+
+		image := writeImage(im, writeObject)
+		contents := writeObject("", []byte(content))
+		kids = append(kids, writeObject(fmt.Sprintf(" /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /WvImage %d 0 R >> >> /Contents %d 0 R",
+			formatNumber(pw), formatNumber(ph), image, contents), nil))
+	}
+	writeTrailer(&out, offsets, kids, "")
+	return out.Bytes(), nil
+}
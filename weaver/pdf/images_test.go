@@ -0,0 +1,76 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// testImage returns a TIFF image of the size, in pixels.
+func testImage(t *testing.T, w, h int) *Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.RGBA{B: 0xff, A: 0xff})
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("unable to encode image: %+v", err)
+	}
+	im, err := NewImage(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unable to read image: %+v", err)
+	}
+	return im
+}
+
+func TestFromImages(t *testing.T) {
+	images := []*Image{testImage(t, 200, 100), testImage(t, 100, 200)}
+	out, err := FromImages(images, ImageLayout{Size: Size{200, 400}, Margin: 10})
+	if err != nil {
+		t.Fatalf("unable to convert images: %+v", err)
+	}
+	if got, want := PageCount(out), 2; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+	// The page of the wide image is in landscape
+	for _, s := range []string{
+		"/MediaBox [0 0 400 200]", "q 10 10 380 180 re W n 360 0 0 180 20 10 cm /WvImage Do Q",
+		"/MediaBox [0 0 200 400]", "q 10 10 180 380 re W n 180 0 0 360 10 20 cm /WvImage Do Q",
+	} {
+		if !bytes.Contains(out, []byte(s)) {
+			t.Errorf("expected the document to contain %q", s)
+		}
+	}
+}
+
+func TestFromImages_fit(t *testing.T) {
+	tests := []struct {
+		layout ImageLayout
+		want   string
+	}{
+		{ImageLayout{}, "/MediaBox [0 0 150 75]"},
+		{ImageLayout{DPI: 144, Margin: 5}, "q 5 5 100 50 re W n 100 0 0 50 5 5 cm"},
+		{ImageLayout{Size: Size{100, 100}, Fit: FitCover}, "q 0 0 100 100 re W n 200 0 0 100 -50 0 cm"},
+		{ImageLayout{Size: Size{100, 100}, Fit: FitFill}, "q 0 0 100 100 re W n 100 0 0 100 0 0 cm"},
+		{ImageLayout{Size: Size{100, 100}, Fit: FitNone, DPI: 72}, "q 0 0 100 100 re W n 200 0 0 100 -50 0 cm"},
+	}
+	for _, tt := range tests {
+		out, err := FromImages([]*Image{testImage(t, 200, 100)}, tt.layout)
+		if err != nil {
+			t.Fatalf("unable to convert images: %+v", err)
+		}
+		if !bytes.Contains(out, []byte(tt.want)) {
+			t.Errorf("expected %+v to contain %q, got %s", tt.layout, tt.want, out)
+		}
+	}
+}
+
+func TestFromImages_invalid(t *testing.T) {
+	if _, err := FromImages(nil, ImageLayout{}); err != ErrNoPages {
+		t.Errorf("expected error to be %v, got %v", ErrNoPages, err)
+	}
+	if _, err := FromImages([]*Image{testImage(t, 1, 1)}, ImageLayout{Fit: "tile"}); err != ErrFitInvalid {
+		t.Errorf("expected error to be %v, got %v", ErrFitInvalid, err)
+	}
+}
@@ -0,0 +1,255 @@
+package pdf
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotPDF is returned when inspecting data that is not a PDF document.
+var ErrNotPDF = errors.New("data is not a PDF document")
+
+// Info describes a PDF document.
+type Info struct {
+	Version   string `json:"version"`
+	PageCount int    `json:"page_count"`
+	Pages     []Page `json:"pages"`
+	Fonts     []Font `json:"fonts"`
+}
+
+// Page describes a page of a PDF document. Dimensions are in points, and take
+// the page rotation into account.
+type Page struct {
+	Number int     `json:"number"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Size is the name of the matching standard paper size (e.g. A4), if any.
+	Size      string `json:"size,omitempty"`
+	Landscape bool   `json:"landscape"`
+	Text      string `json:"text,omitempty"`
+}
+
+// Font describes a font used in a PDF document.
+type Font struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Embedded bool   `json:"embedded"`
+	// Subset is true if only the glyphs used in the document are embedded.
+	Subset bool `json:"subset"`
+}
+
+// paperSizes are the standard paper sizes (in portrait) in points.
+var paperSizes = []struct {
+	name          string
+	width, height float64
+}{
+	{"A3", 842, 1191},
+	{"A4", 595, 842},
+	{"A5", 420, 595},
+	{"Letter", 612, 792},
+	{"Legal", 612, 1008},
+	{"Tabloid", 792, 1224},
+}
+
+// paperSize returns the name of the standard paper size matching the page
+// dimensions, allowing for rounding by the producer.
+func paperSize(w, h float64) string {
+	if w > h {
+		w, h = h, w
+	}
+	for _, s := range paperSizes {
+		if math.Abs(s.width-w) <= 1.5 && math.Abs(s.height-h) <= 1.5 {
+			return s.name
+		}
+	}
+	return ""
+}
+
+var version = regexp.MustCompile(`^%PDF-(\d\.\d)`)
+
+// Inspect returns the page sizes, and fonts of a PDF document. If text is
+// true, the text of each page is extracted as well.
+// Encrypted documents, and streams with filters other than FlateDecode are
+// not supported, so their text will be missing.
+func Inspect(b []byte, text bool) (*Info, error) {
+	if !IsPDF(b) {
+		return nil, ErrNotPDF
+	}
+
+	d := parse(b)
+	info := &Info{Pages: []Page{}, Fonts: d.fonts()}
+	if m := version.FindSubmatch(b); m != nil {
+		info.Version = string(m[1])
+	}
+
+	for i, id := range d.pages() {
+		p := Page{Number: i + 1}
+		if box := d.inherited(id, func(dict []byte) []byte { return array(dict, "MediaBox") }); box != nil {
+			p.Width, p.Height = dimensions(box)
+		}
+		if r := d.inherited(id, func(dict []byte) []byte { return []byte(number(dict, "Rotate")) }); r != nil {
+			if deg, _ := strconv.Atoi(string(r)); deg%180 != 0 {
+				p.Width, p.Height = p.Height, p.Width
+			}
+		}
+		p.Size = paperSize(p.Width, p.Height)
+		p.Landscape = p.Width > p.Height
+		if text {
+			p.Text = d.text(id)
+		}
+		info.Pages = append(info.Pages, p)
+	}
+	info.PageCount = len(info.Pages)
+
+	return info, nil
+}
+
+// dimensions returns the width, and height of a rectangle.
+func dimensions(rect []byte) (float64, float64) {
+	f := strings.Fields(string(rect))
+	if len(f) != 4 {
+		return 0, 0
+	}
+	var v [4]float64
+	for i := range f {
+		v[i], _ = strconv.ParseFloat(f[i], 64)
+	}
+	return math.Abs(v[2] - v[0]), math.Abs(v[3] - v[1])
+}
+
+// pages returns the IDs of the page objects in document order, by walking the
+// page tree. If the page tree cannot be found, page objects are returned in
+// the order they appear in the file.
+func (d *document) pages() []int {
+	var ids []int
+	seen := make(map[int]bool)
+
+	var walk func(id int)
+	walk = func(id int) {
+		obj, ok := d.get(id)
+		if !ok || seen[id] {
+			return
+		}
+		seen[id] = true
+		switch name(obj.dict, "Type") {
+		case "Pages":
+			for _, kid := range refList(array(obj.dict, "Kids")) {
+				walk(kid)
+			}
+		case "Page":
+			ids = append(ids, id)
+		}
+	}
+
+	if catalog, ok := d.get(d.root); ok {
+		if root, ok := ref(catalog.dict, "Pages"); ok {
+			walk(root)
+		}
+	}
+	if len(ids) > 0 {
+		return ids
+	}
+
+	for id, obj := range d.objects {
+		if name(obj.dict, "Type") == "Page" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// maxDepth limits how far inherited attributes are looked up the page tree,
+// in case of cycles.
+const maxDepth = 32
+
+// inherited returns the value of a page attribute, looking it up the page
+// tree if the page does not define it.
+func (d *document) inherited(id int, get func(dict []byte) []byte) []byte {
+	for i := 0; i < maxDepth; i++ {
+		obj, ok := d.get(id)
+		if !ok {
+			return nil
+		}
+		if v := get(obj.dict); len(v) > 0 {
+			return v
+		}
+		if id, ok = ref(obj.dict, "Parent"); !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// dict returns the dictionary of an entry, which may be inline, or an
+// indirect reference.
+func (d *document) dict(dict []byte, key string) []byte {
+	if id, ok := ref(dict, key); ok {
+		if obj, ok := d.get(id); ok {
+			return obj.dict
+		}
+		return nil
+	}
+	return subdict(dict, key)
+}
+
+// pageFonts returns the font object IDs of a page by resource name.
+func (d *document) pageFonts(id int) map[string]int {
+	res := d.inherited(id, func(dict []byte) []byte { return d.dict(dict, "Resources") })
+	return refMap(d.dict(res, "Font"))
+}
+
+var fontFile = regexp.MustCompile(`/FontFile[23]?\b`)
+
+// fonts returns the fonts defined in the document, sorted by name. The
+// descendants of composite fonts are not listed separately.
+func (d *document) fonts() []Font {
+	descendants := make(map[int]bool)
+	for _, obj := range d.objects {
+		if name(obj.dict, "Type") == "Font" {
+			for _, id := range refList(array(obj.dict, "DescendantFonts")) {
+				descendants[id] = true
+			}
+		}
+	}
+
+	byName := make(map[string]Font)
+	for id, obj := range d.objects {
+		if descendants[id] || name(obj.dict, "Type") != "Font" {
+			continue
+		}
+		base := name(obj.dict, "BaseFont")
+		if base == "" {
+			// Type 3 fonts have no base font
+			continue
+		}
+
+		f := Font{Name: base, Type: name(obj.dict, "Subtype")}
+		// Subset fonts are prefixed with six uppercase letters (e.g. ABCDEF+)
+		if i := strings.IndexByte(base, '+'); i == 6 && strings.ToUpper(base[:6]) == base[:6] {
+			f.Name, f.Subset = base[7:], true
+		}
+
+		candidates := append([]int{id}, refList(array(obj.dict, "DescendantFonts"))...)
+		for _, c := range candidates {
+			font, _ := d.get(c)
+			if fontFile.Match(d.dict(font.dict, "FontDescriptor")) {
+				f.Embedded = true
+			}
+		}
+
+		if existing, ok := byName[f.Name]; !ok || (!existing.Embedded && f.Embedded) {
+			byName[f.Name] = f
+		}
+	}
+
+	fonts := make([]Font, 0, len(byName))
+	for _, f := range byName {
+		fonts = append(fonts, f)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].Name < fonts[j].Name })
+	return fonts
+}
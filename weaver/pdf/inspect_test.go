@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// simplePDF has a page tree with an inherited media box, an uncompressed
+// content stream, and a standard (non-embedded) font.
+const simplePDF = `%PDF-1.3
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 /MediaBox [0 0 612 792] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Rotate 90 /Resources << /Font << /F1 5 0 R >> >> /Contents 6 0 R >> endobj
+4 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] >> endobj
+5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj
+6 0 obj << /Length 80 >>
+stream
+BT /F1 12 Tf 72 700 Td (Hello) Tj [(wor) -30 (ld)] TJ 0 -14 Td (\(again\)) Tj ET
+endstream
+endobj
+trailer << /Root 1 0 R >>
+%%EOF`
+
+func TestInspect(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+
+	info, err := Inspect(b, true)
+	if err != nil {
+		t.Fatalf("unable to inspect test PDF: %+v", err)
+	}
+
+	if got, want := info.PageCount, 1; got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+	if got, want := info.Pages[0].Size, "A4"; got != want {
+		t.Errorf("expected page size to be %s, got %s", want, got)
+	}
+	if got, want := info.Pages[0].Text, "hello world"; got != want {
+		t.Errorf("expected page text to be %q, got %q", want, got)
+	}
+	if got, want := len(info.Fonts), 1; got != want {
+		t.Fatalf("expected %d font, got %d", want, got)
+	}
+	if got, want := info.Fonts[0], (Font{Name: "CourierNewPSMT", Type: "Type0", Embedded: true}); got != want {
+		t.Errorf("expected font to be %+v, got %+v", want, got)
+	}
+}
+
+func TestInspect_pageTree(t *testing.T) {
+	info, err := Inspect([]byte(simplePDF), true)
+	if err != nil {
+		t.Fatalf("unable to inspect PDF: %+v", err)
+	}
+
+	if got, want := info.PageCount, 2; got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+
+	// Pages are ordered by the page tree, not the file
+	if got, want := info.Pages[0], (Page{Number: 1, Width: 300, Height: 400}); got != want {
+		t.Errorf("expected first page to be %+v, got %+v", want, got)
+	}
+	want := Page{Number: 2, Width: 792, Height: 612, Size: "Letter", Landscape: true, Text: "Helloworld\n(again)"}
+	if got := info.Pages[1]; got != want {
+		t.Errorf("expected second page to be %+v, got %+v", want, got)
+	}
+
+	if got, want := info.Fonts, []Font{{Name: "Helvetica", Type: "Type1"}}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected fonts to be %+v, got %+v", want, got)
+	}
+}
+
+func TestInspect_notPDF(t *testing.T) {
+	if _, err := Inspect([]byte("<html></html>"), false); err != ErrNotPDF {
+		t.Errorf("expected error to be %+v, got %+v", ErrNotPDF, err)
+	}
+}
+
+func TestParseCMap(t *testing.T) {
+	m := parseCMap([]byte(`1 begincodespacerange <00> <FF> endcodespacerange
+1 beginbfchar <01> <0041> endbfchar
+2 beginbfrange <02> <04> <0062> <05> <06> [<00660066> <D83DDE00>] endbfrange`))
+
+	if got, want := m.decode([]byte{1, 2, 3, 4, 5, 6, 7}), "Abcdff😀"; got != want {
+		t.Errorf("expected decoded text to be %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,61 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrProfileInvalid is returned when an ICC profile cannot be read.
+var ErrProfileInvalid = errors.New("invalid ICC profile (expected a gray, RGB, or CMYK profile)")
+
+// iccColorSpaces are the color spaces of ICC profiles (in their header), and
+// the number of their components.
+var iccColorSpaces = map[string]int{"GRAY": 1, "RGB ": 3, "CMYK": 4}
+
+// ICCProfile is an ICC color profile, e.g. of the printing condition of a
+// print shop.
+type ICCProfile struct {
+	// ColorSpace is 'GRAY', 'RGB', or 'CMYK'.
+	ColorSpace string
+	// n is the number of color components.
+	n    int
+	data []byte
+}
+
+// ParseICCProfile reads an ICC profile of a gray, RGB, or CMYK color space.
+func ParseICCProfile(b []byte) (*ICCProfile, error) {
+	// The header is 128 bytes, with the signature 'acsp' at 36
+	if len(b) < 128 || string(b[36:40]) != "acsp" {
+		return nil, ErrProfileInvalid
+	}
+	n, ok := iccColorSpaces[string(b[16:20])]
+	if !ok {
+		return nil, ErrProfileInvalid
+	}
+	return &ICCProfile{ColorSpace: string(bytes.TrimSpace(b[16:20])), n: n, data: b}, nil
+}
+
+// SetOutputIntent embeds an ICC profile in a document as its output intent
+// (the printing condition its colors are intended for), as an incremental
+// update, replacing any existing output intents. The identifier names the
+// printing condition, e.g. 'FOGRA39'. The colors of the document are not
+// converted.
+func SetOutputIntent(b []byte, p *ICCProfile, identifier string) ([]byte, error) {
+	d, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := d.get(d.root)
+	if !ok || name(catalog.dict, "Type") != "Catalog" {
+		return nil, ErrNoCatalog
+	}
+
+	u := newUpdate(b, d)
+	profile := u.add(fmt.Sprintf("<< /N %d /Filter /FlateDecode >>", p.n), deflate(p.data))
+	intent := u.add(fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFX /OutputConditionIdentifier %s /Info %s /DestOutputProfile %d 0 R >>",
+		textString(identifier), textString(identifier), profile), nil)
+	dict := setEntry(bytes.TrimSpace(catalog.dict), "OutputIntents", []byte(fmt.Sprintf("[%d 0 R]", intent)))
+	u.write(d.root, string(dict), nil)
+	return u.bytes(), nil
+}
@@ -0,0 +1,66 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// mockProfile returns the header of an ICC profile of a color space.
+func mockProfile(space string) []byte {
+	b := make([]byte, 128)
+	copy(b[16:], space)
+	copy(b[36:], "acsp")
+	return b
+}
+
+func TestParseICCProfile(t *testing.T) {
+	tests := []struct {
+		b     []byte
+		space string
+		err   error
+	}{
+		{mockProfile("CMYK"), "CMYK", nil},
+		{mockProfile("RGB "), "RGB", nil},
+		{mockProfile("GRAY"), "GRAY", nil},
+		{mockProfile("Lab "), "", ErrProfileInvalid},
+		{[]byte("not a profile"), "", ErrProfileInvalid},
+	}
+	for _, tt := range tests {
+		p, err := ParseICCProfile(tt.b)
+		if err != tt.err {
+			t.Errorf("expected error of %q to be %v, got %v", tt.b[16:20], tt.err, err)
+			continue
+		}
+		if p != nil && p.ColorSpace != tt.space {
+			t.Errorf("expected color space to be %s, got %s", tt.space, p.ColorSpace)
+		}
+	}
+}
+
+func TestSetOutputIntent(t *testing.T) {
+	p, _ := ParseICCProfile(mockProfile("CMYK"))
+	out, err := SetOutputIntent([]byte(simplePDF), p, "FOGRA39")
+	if err != nil {
+		t.Fatalf("unable to set output intent: %+v", err)
+	}
+	if !bytes.HasPrefix(out, []byte(simplePDF)) {
+		t.Errorf("expected the document to be unchanged")
+	}
+
+	d := parse(out)
+	catalog, _ := d.get(d.root)
+	intent, _ := d.get(refList(array(catalog.dict, "OutputIntents"))[0])
+	if got, want := name(intent.dict, "S"), "GTS_PDFX"; got != want {
+		t.Errorf("expected output intent subtype to be %s, got %s", want, got)
+	}
+	if !bytes.Contains(intent.dict, []byte("/OutputConditionIdentifier (FOGRA39)")) {
+		t.Errorf("expected output condition to be identified, got %s", intent.dict)
+	}
+	profile, _ := d.get(refList(value(intent.dict, "DestOutputProfile"))[0])
+	if got, want := number(profile.dict, "N"), "4"; got != want {
+		t.Errorf("expected profile components to be %s, got %s", want, got)
+	}
+	if data, err := decode(profile); err != nil || !bytes.Equal(data, mockProfile("CMYK")) {
+		t.Errorf("expected the profile to be embedded (%v)", err)
+	}
+}
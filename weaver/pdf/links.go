@@ -0,0 +1,290 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrLinkedSources is returned when the number of URLs of linked
+	// documents is not the number of documents.
+	ErrLinkedSources = errors.New("every merged document requires a URL")
+
+	pdfString   = `\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>`
+	pdfName     = `/[^\s/<>\[\]()]+`
+	destValue   = `\[[^\]]*\]|\d+\s+\d+\s+R|<<\s*/D\s*\[[^\]]*\][^>]*>>`
+	destEntry   = regexp.MustCompile(`/(Dest|D)\b\s*(` + pdfName + `|` + pdfString + `)`)
+	namedDest   = regexp.MustCompile(`(` + pdfName + `)\s*(` + destValue + `)`)
+	treeDest    = regexp.MustCompile(`(` + pdfString + `)\s*(` + destValue + `)`)
+	uriEntry    = regexp.MustCompile(`/URI\s*(` + pdfString + `)`)
+	linkSubtype = regexp.MustCompile(`/Subtype\s*/Link\b`)
+	goToAction  = regexp.MustCompile(`/S\s*/GoTo\b`)
+	uriAction   = regexp.MustCompile(`/S\s*/URI\b`)
+)
+
+// destKey returns the key of a named destination (a name, or a string) in
+// the destinations of a document (see destinations), e.g. '/intro' for
+// '/intro', and '(intro)' for '(intro)', or '<696E74726F>'.
+func destKey(token []byte) string {
+	switch {
+	case bytes.HasPrefix(token, []byte("/")):
+		var b strings.Builder
+		b.WriteByte('/')
+		for i := 1; i < len(token); i++ {
+			if token[i] == '#' && i+2 < len(token) {
+				if c, err := strconv.ParseUint(string(token[i+1:i+3]), 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 2
+					continue
+				}
+			}
+			b.WriteByte(token[i])
+		}
+		return b.String()
+	case bytes.HasPrefix(token, []byte("(")):
+		s, _ := literalString(token)
+		return "(" + string(s) + ")"
+	case bytes.HasPrefix(token, []byte("<")):
+		h := bytes.Map(func(r rune) rune {
+			if r == '<' || r == '>' || isSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, token)
+		if len(h)%2 == 1 {
+			h = append(h, '0')
+		}
+		s, _ := hex.DecodeString(string(h))
+		return "(" + string(s) + ")"
+	}
+	return string(token)
+}
+
+// destinations returns the explicit destinations (arrays) of the named
+// destinations of the document, in the destinations dictionary of its
+// catalog, and its name tree, by key (see destKey).
+func (d *document) destinations() map[string][]byte {
+	dests := make(map[string][]byte)
+	root, ok := d.get(d.root)
+	if !ok {
+		return dests
+	}
+	for _, m := range namedDest.FindAllSubmatch(d.dict(root.dict, "Dests"), -1) {
+		if dest := d.destination(m[2]); dest != nil {
+			dests[destKey(m[1])] = dest
+		}
+	}
+	if names := d.dict(root.dict, "Names"); names != nil {
+		d.destinationTree(d.dict(names, "Dests"), dests, 0)
+	}
+	return dests
+}
+
+// destinationTree adds the destinations of a node of a name tree (see
+// destinations), and of its kids.
+func (d *document) destinationTree(node []byte, dests map[string][]byte, depth int) {
+	if node == nil || depth > maxDepth {
+		return
+	}
+	for _, m := range treeDest.FindAllSubmatch(node, -1) {
+		if dest := d.destination(m[2]); dest != nil {
+			dests[destKey(m[1])] = dest
+		}
+	}
+	for _, id := range refList(array(node, "Kids")) {
+		if obj, ok := d.get(id); ok {
+			d.destinationTree(obj.dict, dests, depth+1)
+		}
+	}
+}
+
+// destination returns the explicit destination of a named destination: an
+// array, a dictionary with the array (as 'D'), or a reference to either.
+func (d *document) destination(v []byte) []byte {
+	v = bytes.TrimSpace(v)
+	if bytes.HasSuffix(v, []byte("R")) {
+		obj, ok := d.get(refList(v)[0])
+		if !ok {
+			return nil
+		}
+		v = bytes.TrimSpace(obj.dict)
+	}
+	if bytes.HasPrefix(v, []byte("<<")) {
+		if a := array(v, "D"); a != nil {
+			return []byte("[" + string(a) + "]")
+		}
+		return nil
+	}
+	if bytes.HasPrefix(v, []byte("[")) {
+		return v
+	}
+	return nil
+}
+
+// resolveDest returns a link annotation, or a go-to action with its named
+// destination replaced by its explicit destination, as the named
+// destinations of the document are not kept when it is written.
+func resolveDest(dict []byte, dests map[string][]byte) []byte {
+	if len(dests) == 0 || (!linkSubtype.Match(dict) && !goToAction.Match(dict)) {
+		return dict
+	}
+	return destEntry.ReplaceAllFunc(dict, func(m []byte) []byte {
+		sm := destEntry.FindSubmatch(m)
+		if dest, ok := dests[destKey(sm[2])]; ok {
+			return append([]byte("/"+string(sm[1])+" "), dest...)
+		}
+		return m
+	})
+}
+
+// documentKey returns the key of the URL of a document (without its
+// fragment), so that the links to the document match it, or an empty string
+// if it is not an absolute URL.
+func documentKey(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || !u.IsAbs() {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// linkTarget is a destination in a merged document: the first page of a
+// part, or the named destination of a fragment of the part.
+type linkTarget struct {
+	part     int
+	fragment string
+}
+
+// destName returns the name of the destination in the merged document.
+func (t linkTarget) destName() string {
+	if t.fragment == "" {
+		return fmt.Sprintf("/WvDoc%d", t.part+1)
+	}
+	return fmt.Sprintf("/WvDoc%d.%s", t.part+1, encodeName(t.fragment))
+}
+
+// links resolves the links between the parts of a merged document (see
+// MergeLinked).
+type links struct {
+	parts   map[string]int
+	dests   []map[string][]byte
+	targets map[linkTarget]bool
+}
+
+// dest returns the explicit destination of the fragment of a part, which may
+// be named by a name, or a string.
+func (l *links) dest(part int, fragment string) ([]byte, bool) {
+	if dest, ok := l.dests[part]["/"+fragment]; ok {
+		return dest, true
+	}
+	dest, ok := l.dests[part]["("+fragment+")"]
+	return dest, ok
+}
+
+// newLinks returns the links between the parts, by their URLs, and
+// destinations (see destinations), or nil if they have no URLs.
+func newLinks(parts []part, dests []map[string][]byte) *links {
+	l := &links{parts: make(map[string]int), dests: dests, targets: make(map[linkTarget]bool)}
+	for i, p := range parts {
+		if k := documentKey(p.url); k != "" {
+			if _, ok := l.parts[k]; !ok {
+				l.parts[k] = i
+			}
+		}
+	}
+	if len(l.parts) == 0 {
+		return nil
+	}
+	return l
+}
+
+// resolve returns a link annotation, or a URI action with its URI replaced
+// by a go-to action to the part it links to (if any).
+func (l *links) resolve(dict []byte) []byte {
+	if l == nil || !uriAction.Match(dict) {
+		return dict
+	}
+	m := uriEntry.FindSubmatch(dict)
+	if m == nil {
+		return dict
+	}
+	uri := destKey(m[1])
+	uri = uri[1 : len(uri)-1]
+	i, ok := l.parts[documentKey(uri)]
+	if !ok {
+		return dict
+	}
+	t := linkTarget{part: i}
+	if u, err := url.Parse(uri); err == nil && u.Fragment != "" {
+		if _, ok := l.dest(i, u.Fragment); ok {
+			t.fragment = u.Fragment
+		}
+	}
+	l.targets[t] = true
+
+	action := []byte("<< /S /GoTo /D " + t.destName() + " >>")
+	if linkSubtype.Match(dict) {
+		return setEntry(dict, "A", action)
+	}
+	return action
+}
+
+// write writes the destinations of the links between the parts (by their
+// first page, and renumbered objects), and returns the entry of the catalog
+// referencing them.
+func (l *links) write(first []int, renumbered []map[int]int, writeObject func(dict string, stream []byte) int) string {
+	if l == nil || len(l.targets) == 0 {
+		return ""
+	}
+	targets := make([]linkTarget, 0, len(l.targets))
+	for t := range l.targets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].destName() < targets[j].destName() })
+
+	var dests strings.Builder
+	for _, t := range targets {
+		dest := fmt.Sprintf("[%d 0 R /Fit]", first[t.part])
+		if d, ok := l.dest(t.part, t.fragment); ok {
+			dest = string(refs.ReplaceAllFunc(d, func(m []byte) []byte {
+				old, _ := strconv.Atoi(string(refs.FindSubmatch(m)[1]))
+				if id, ok := renumbered[t.part][old]; ok {
+					return []byte(strconv.Itoa(id) + " 0 R")
+				}
+				return []byte("null")
+			}))
+		}
+		fmt.Fprintf(&dests, " %s %s", t.destName(), dest)
+	}
+	return fmt.Sprintf(" /Dests %d 0 R", writeObject(dests.String(), nil))
+}
+
+// MergeLinked is like Merge, but the links between the documents go to the
+// pages of the documents they link to, by the URLs of the documents (in
+// order): to the destination of the fragment of a link if the document has a
+// named destination with its name, or to the first page of the document.
+func MergeLinked(urls []string, docs ...[]byte) ([]byte, error) {
+	if len(urls) != len(docs) {
+		return nil, ErrLinkedSources
+	}
+	parts, err := mergeParts(docs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range parts {
+		parts[i].url = urls[i]
+	}
+	return write(parts, layout{}), nil
+}
@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+// linkedPDF has links to a named destination (as Chromium prints links to
+// fragments of the page), and to other documents.
+const linkedPDF = `%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R /Dests 7 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 595 842] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Annots [5 0 R 6 0 R 8 0 R 9 0 R] >> endobj
+4 0 obj << /Type /Page /Parent 2 0 R >> endobj
+5 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest /section#2D2 >> endobj
+6 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (https://example.com/appendix#notes) >> >> endobj
+7 0 obj << /section#2D2 [4 0 R /XYZ 0 600 0] >> endobj
+8 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (https://EXAMPLE.com/appendix/) >> >> endobj
+9 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (https://example.org/) >> >> endobj
+trailer << /Root 1 0 R >>
+%%EOF`
+
+// appendixPDF has a named destination in the name tree of its catalog.
+const appendixPDF = `%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R /Names << /Dests 4 0 R >> >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 595 842] >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R >> endobj
+4 0 obj << /Kids [5 0 R] >> endobj
+5 0 obj << /Limits [(notes) (notes)] /Names [<6E6F746573> << /D [3 0 R /XYZ 0 300 0] >>] >> endobj
+trailer << /Root 1 0 R >>
+%%EOF`
+
+// annot returns the dictionary of the object with the (unique) entry.
+func annot(t *testing.T, out []byte, entry string) string {
+	m := regexp.MustCompile(`\d+ 0 obj\n(<<[^\n]*` + regexp.QuoteMeta(entry) + `[^\n]*)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("expected an object with %q, got %s", entry, out)
+	}
+	return string(m[1])
+}
+
+func TestMerge_namedDestinations(t *testing.T) {
+	out, err := Merge([]byte(linkedPDF))
+	if err != nil {
+		t.Fatalf("unable to merge PDFs: %+v", err)
+	}
+	// The second page is object 4, renumbered as the second object
+	if got, want := annot(t, out, "/Dest "), "/Dest [4 0 R /XYZ 0 600 0]"; !bytes.Contains([]byte(got), []byte(want)) {
+		t.Errorf("expected the link to have %q, got %s", want, got)
+	}
+}
+
+func TestMergeLinked(t *testing.T) {
+	urls := []string{"https://example.com/report", "https://example.com/appendix"}
+	out, err := MergeLinked(urls, []byte(linkedPDF), []byte(appendixPDF))
+	if err != nil {
+		t.Fatalf("unable to merge PDFs: %+v", err)
+	}
+	for _, want := range []string{
+		"/A << /S /GoTo /D /WvDoc2.notes >>",
+		"/A << /S /GoTo /D /WvDoc2 >>",
+		"/URI (https://example.org/)",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expected the merged document to contain %q", want)
+		}
+	}
+	catalog := annot(t, out, "/Type /Catalog")
+	m := regexp.MustCompile(`/Dests (\d+) 0 R`).FindStringSubmatch(catalog)
+	if m == nil {
+		t.Fatalf("expected the catalog to have destinations, got %s", catalog)
+	}
+	// The page of the appendix is the third page, renumbered after the
+	// objects of the first document
+	dests := annot(t, out, "/WvDoc2 [")
+	kids := regexp.MustCompile(`/Kids \[\d+ 0 R \d+ 0 R (\d+) 0 R\]`).FindStringSubmatch(string(out))
+	if kids == nil {
+		t.Fatalf("expected the merged document to have 3 pages")
+	}
+	for _, want := range []string{"/WvDoc2 [" + kids[1] + " 0 R /Fit]", "/WvDoc2.notes [" + kids[1] + " 0 R /XYZ 0 300 0]"} {
+		if !bytes.Contains([]byte(dests), []byte(want)) {
+			t.Errorf("expected the destinations to contain %q, got %s", want, dests)
+		}
+	}
+
+	if _, err := MergeLinked(urls[:1], []byte(linkedPDF), []byte(appendixPDF)); err != ErrLinkedSources {
+		t.Errorf("expected error to be %v, got %v", ErrLinkedSources, err)
+	}
+}
@@ -0,0 +1,417 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoPages is returned when merging a document without pages.
+	ErrNoPages = errors.New("PDF document has no pages")
+	// ErrEncrypted is returned when merging an encrypted document.
+	ErrEncrypted = errors.New("encrypted PDF documents are not supported")
+
+	encryptRef  = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+	lengthEntry = regexp.MustCompile(`/Length\b\s*\d+(\s+\d+\s+R)?`)
+	parentEntry = regexp.MustCompile(`/Parent\s+\d+\s+\d+\s+R`)
+)
+
+// inheritable are the page attributes that may be inherited from the page
+// tree. They are copied to the pages of a merged document, as its page tree
+// is flat.
+var inheritable = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// skipped are the types of objects that are not copied to a merged (or split)
+// document, as it has its own catalog, page tree, and cross-reference table.
+var skipped = map[string]bool{"Catalog": true, "Pages": true, "ObjStm": true, "XRef": true}
+
+// value returns the raw value of a dictionary entry (a reference, inline
+// dictionary, array, or number), or nil if it has none.
+func value(dict []byte, key string) []byte {
+	if id, ok := ref(dict, key); ok {
+		return []byte(strconv.Itoa(id) + " 0 R")
+	}
+	if d := subdict(dict, key); d != nil {
+		return append(append([]byte("<<"), d...), ">>"...)
+	}
+	if a := array(dict, key); a != nil {
+		return append(append([]byte("["), a...), ']')
+	}
+	if n := number(dict, key); n != "" {
+		return []byte(n)
+	}
+	return nil
+}
+
+// pageDict returns the dictionary of a page with its inherited attributes,
+// and without its parent.
+func (d *document) pageDict(id int) []byte {
+	obj, _ := d.get(id)
+	dict := bytes.TrimSpace(obj.dict)
+	dict = bytes.TrimSuffix(dict, []byte(">>"))
+	dict = parentEntry.ReplaceAll(dict, nil)
+	for _, key := range inheritable {
+		if keyPattern(key, "").Match(obj.dict) {
+			continue
+		}
+		if v := d.inherited(id, func(dict []byte) []byte { return value(dict, key) }); v != nil {
+			dict = append(dict, fmt.Sprintf(" /%s %s", key, v)...)
+		}
+	}
+	return append(dict, " >>"...)
+}
+
+// Size is the size of a page in points.
+type Size struct {
+	Width  float64
+	Height float64
+}
+
+// PaperSize returns the size of a standard paper size (e.g. 'A4', case
+// insensitive), in portrait, or in landscape.
+func PaperSize(name string, landscape bool) (Size, bool) {
+	for _, p := range paperSizes {
+		if strings.EqualFold(p.name, name) {
+			if landscape {
+				return Size{p.height, p.width}, true
+			}
+			return Size{p.width, p.height}, true
+		}
+	}
+	return Size{}, false
+}
+
+// boxEntries are the page boundaries, which are replaced by the media box of
+// a normalized page.
+var boxEntries = []string{"MediaBox", "CropBox", "BleedBox", "TrimBox", "ArtBox"}
+
+// withoutEntry returns a dictionary without an entry whose value is a
+// reference, an array, or a number.
+func withoutEntry(dict []byte, key string) []byte {
+	for _, v := range []string{`\d+\s+\d+\s+R`, `\[[^\]]*\]`, `-?\d+(?:\.\d*)?`} {
+		if loc := keyPattern(key, v).FindIndex(dict); loc != nil {
+			return append(append([]byte(nil), dict[:loc[0]]...), dict[loc[1]:]...)
+		}
+	}
+	return dict
+}
+
+// normalize scales the content of a page (with its inherited attributes, see
+// pageDict) to fit the size, and centers it. It returns the page, and the
+// transform its contents must be wrapped with (see wrapContents).
+func (d *document) normalize(id int, dict []byte, size Size) ([]byte, []byte) {
+	x0, y0, w, h := 0.0, 0.0, 612.0, 792.0
+	if box := d.inherited(id, func(dict []byte) []byte { return array(dict, "MediaBox") }); box != nil {
+		f := strings.Fields(string(box))
+		if len(f) == 4 {
+			x0, _ = strconv.ParseFloat(f[0], 64)
+			y0, _ = strconv.ParseFloat(f[1], 64)
+			w, h = dimensions(box)
+		}
+	}
+	// Rotated pages are displayed with their width, and height swapped
+	if r := number(dict, "Rotate"); r != "" {
+		if deg, _ := strconv.Atoi(r); deg%180 != 0 {
+			size.Width, size.Height = size.Height, size.Width
+		}
+	}
+	scale := 1.0
+	if w > 0 && h > 0 {
+		scale = math.Min(size.Width/w, size.Height/h)
+	}
+	tx := (size.Width-w*scale)/2 - x0*scale
+	ty := (size.Height-h*scale)/2 - y0*scale
+
+	dict = bytes.TrimSuffix(bytes.TrimSpace(dict), []byte(">>"))
+	for _, key := range boxEntries {
+		dict = withoutEntry(dict, key)
+	}
+	dict = append(dict, fmt.Sprintf(" /MediaBox [0 0 %s %s] >>", formatNumber(size.Width), formatNumber(size.Height))...)
+	transform := fmt.Sprintf("q %s 0 0 %s %s %s cm\n", formatNumber(scale), formatNumber(scale), formatNumber(tx), formatNumber(ty))
+	return dict, []byte(transform)
+}
+
+// wrapContents wraps the contents of a page by the contents with the IDs of
+// pre, and post.
+func wrapContents(dict []byte, pre, post int) []byte {
+	contents := value(dict, "Contents")
+	contents = bytes.TrimSuffix(bytes.TrimPrefix(contents, []byte("[")), []byte("]"))
+	dict = withoutEntry(bytes.TrimSuffix(bytes.TrimSpace(dict), []byte(">>")), "Contents")
+	return append(dict, fmt.Sprintf(" /Contents [%d 0 R %s %d 0 R] >>", pre, contents, post)...)
+}
+
+// formatNumber formats a number for a content stream.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Merge concatenates the pages of PDF documents into a single document, in
+// order. Only the pages (and the objects they use) are kept, so document
+// level features (e.g. outlines, and forms) are dropped. Links to named
+// destinations go to their explicit destinations.
+func Merge(docs ...[]byte) ([]byte, error) {
+	return MergeTo(Size{}, docs...)
+}
+
+// MergeTo is like Merge, but the content of every page is scaled to fit the
+// size, and centered, so that every page has the same size (unless the size
+// is zero). Annotations are not moved with the content.
+func MergeTo(size Size, docs ...[]byte) ([]byte, error) {
+	parts, err := mergeParts(docs)
+	if err != nil {
+		return nil, err
+	}
+	return write(parts, layout{size: size}), nil
+}
+
+// mergeParts returns the parts of the documents of a merge, with all of
+// their pages.
+func mergeParts(docs [][]byte) ([]part, error) {
+	parts := make([]part, 0, len(docs))
+	for _, b := range docs {
+		d, err := parseDocument(b)
+		if err != nil {
+			return nil, err
+		}
+		pages := d.pages()
+		if len(pages) == 0 {
+			return nil, ErrNoPages
+		}
+		parts = append(parts, part{d: d, pages: pages})
+	}
+	return parts, nil
+}
+
+// parseDocument parses a PDF document that can be merged, or split.
+func parseDocument(b []byte) (*document, error) {
+	if !IsPDF(b) {
+		return nil, ErrNotPDF
+	}
+	if encryptRef.Match(b) {
+		return nil, ErrEncrypted
+	}
+	return parse(b), nil
+}
+
+// part is a selection of pages (by object ID) of a document, with the URL
+// of the document, if links to it are resolved (see MergeLinked).
+type part struct {
+	d     *document
+	pages []int
+	url   string
+}
+
+// reachable returns the IDs of the objects used by the pages of a part, in
+// order: the pages, and the objects they reference (directly, or not). Other
+// pages, and skipped objects are not followed.
+func (p part) reachable() []int {
+	selected := make(map[int]bool, len(p.pages))
+	for _, id := range p.pages {
+		selected[id] = true
+	}
+	seen := make(map[int]bool)
+	queue := append([]int(nil), p.pages...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		obj, ok := p.d.get(id)
+		if !ok || seen[id] {
+			continue
+		}
+		typ := name(obj.dict, "Type")
+		if skipped[typ] || (typ == "Page" && !selected[id]) {
+			continue
+		}
+		seen[id] = true
+		dict := obj.dict
+		if selected[id] {
+			dict = p.d.pageDict(id)
+		}
+		queue = append(queue, refList(dict)...)
+	}
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// layout are the changes made to the pages of a written document.
+type layout struct {
+	// size normalizes the pages, unless it is zero (see normalize).
+	size Size
+	// overlays are drawn over the pages (see Stamp).
+	overlays []Overlay
+}
+
+// changes returns true if the pages are changed.
+func (l layout) changes() bool {
+	return l.size != (Size{}) || len(l.overlays) > 0
+}
+
+// write returns a document with the pages of the parts, in order, changed by
+// the layout.
+func write(parts []part, l layout) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object 1 is the catalog, and object 2 is the page tree. They are
+	// written last, when the pages are known.
+	offsets := []int{0, 0}
+	next := 3
+	writeObject := objectWriter(&out, &offsets, &next)
+
+	// The resources of the overlays are shared by the pages
+	var res overlayResources
+	if len(l.overlays) > 0 {
+		res = writeResources(l.overlays, writeObject)
+	}
+	total := 0
+	dests := make([]map[string][]byte, len(parts))
+	for i, p := range parts {
+		total += len(p.pages)
+		dests[i] = p.d.destinations()
+	}
+	links := newLinks(parts, dests)
+	first := make([]int, len(parts))
+	renumberedParts := make([]map[int]int, len(parts))
+
+	var kids []int
+	for i, p := range parts {
+		d := p.d
+
+		// Objects are renumbered in order after those of the previous
+		// parts. References to objects that are not copied become null.
+		ids := p.reachable()
+		renumbered := make(map[int]int, len(ids))
+		for _, id := range ids {
+			renumbered[id] = next
+			next++
+		}
+		isPage := make(map[int]bool, len(p.pages))
+		index := make(map[int]int, len(p.pages))
+		for i, id := range p.pages {
+			isPage[id] = true
+			index[id] = i
+		}
+		// The overlay of a page is referenced by an ID unused by the
+		// document (see withOverlay), renumbered for every page
+		overlayRef := d.unusedID()
+
+		// The contents wrapping the changed pages, and their overlays are
+		// written after the objects of the part
+		var extra []object
+
+		for _, id := range ids {
+			obj := d.objects[id]
+			dict := obj.dict
+			if isPage[id] {
+				dict = d.pageDict(id)
+			}
+			if obj.stream != nil {
+				dict = lengthEntry.ReplaceAll(dict, []byte("/Length "+strconv.Itoa(len(obj.stream))))
+			}
+			dict = links.resolve(resolveDest(dict, dests[i]))
+			pre := next + len(extra)
+			if isPage[id] && len(l.overlays) > 0 {
+				dict = d.withOverlay(dict, overlayRef)
+				renumbered[overlayRef] = pre + 2
+			}
+			dict = refs.ReplaceAllFunc(dict, func(m []byte) []byte {
+				old, _ := strconv.Atoi(string(refs.FindSubmatch(m)[1]))
+				if id, ok := renumbered[old]; ok {
+					return []byte(strconv.Itoa(id) + " 0 R")
+				}
+				return []byte("null")
+			})
+			if isPage[id] && l.changes() {
+				transform := []byte("q\n")
+				if l.size != (Size{}) {
+					dict, transform = d.normalize(id, dict, l.size)
+				}
+				dict = wrapContents(dict, pre, pre+1)
+				extra = append(extra, object{stream: transform})
+				if len(l.overlays) > 0 {
+					form, content := res.overlay(dict, l.overlays, len(kids)+index[id]+1, total)
+					extra = append(extra, object{stream: []byte("\nQ\nq /WvOverlay Do Q")}, object{dict: form, stream: content})
+				} else {
+					extra = append(extra, object{stream: []byte("\nQ")})
+				}
+			}
+			if isPage[id] {
+				dict = append(bytes.TrimSuffix(bytes.TrimSpace(dict), []byte(">>")), " /Parent 2 0 R >>"...)
+			}
+
+			offsets = append(offsets, out.Len())
+			fmt.Fprintf(&out, "%d 0 obj\n", renumbered[id])
+			out.Write(bytes.TrimSpace(dict))
+			if obj.stream != nil {
+				out.WriteString("\nstream\n")
+				out.Write(obj.stream)
+				out.WriteString("\nendstream")
+			}
+			out.WriteString("\nendobj\n")
+		}
+		for _, e := range extra {
+			writeObject(string(e.dict), e.stream)
+		}
+		for _, id := range p.pages {
+			kids = append(kids, renumbered[id])
+		}
+		first[i] = renumbered[p.pages[0]]
+		renumberedParts[i] = renumbered
+	}
+
+	writeTrailer(&out, offsets, kids, links.write(first, renumberedParts, writeObject))
+	return out.Bytes()
+}
+
+// objectWriter returns a function writing an object with the dictionary
+// entries (and stream, if any) after the objects written so far, and
+// returning its ID.
+func objectWriter(out *bytes.Buffer, offsets *[]int, next *int) func(dict string, stream []byte) int {
+	return func(dict string, stream []byte) int {
+		*offsets = append(*offsets, out.Len())
+		if stream == nil {
+			fmt.Fprintf(out, "%d 0 obj\n<<%s >>\nendobj\n", *next, dict)
+		} else {
+			fmt.Fprintf(out, "%d 0 obj\n<<%s /Length %d >>\nstream\n", *next, dict, len(stream))
+			out.Write(stream)
+			out.WriteString("\nendstream\nendobj\n")
+		}
+		*next++
+		return *next - 1
+	}
+}
+
+// writeTrailer writes the catalog (object 1, with the entries of catalog, if
+// any), and the page tree of the pages (object 2) at the offsets reserved for
+// them, followed by the cross reference table of the objects, and the
+// trailer.
+func writeTrailer(out *bytes.Buffer, offsets []int, kids []int, catalog string) {
+	offsets[0] = out.Len()
+	fmt.Fprintf(out, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R%s >>\nendobj\n", catalog)
+	offsets[1] = out.Len()
+	out.WriteString("2 0 obj\n<< /Type /Pages /Kids [")
+	for i, id := range kids {
+		if i > 0 {
+			out.WriteByte(' ')
+		}
+		fmt.Fprintf(out, "%d 0 R", id)
+	}
+	fmt.Fprintf(out, "] /Count %d >>\nendobj\n", len(kids))
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+}
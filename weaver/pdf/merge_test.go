@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+
+	out, err := Merge(b, []byte(simplePDF))
+	if err != nil {
+		t.Fatalf("unable to merge PDFs: %+v", err)
+	}
+	info, err := Inspect(out, true)
+	if err != nil {
+		t.Fatalf("unable to inspect merged PDF: %+v", err)
+	}
+
+	// The pages are those of the documents, in order (with the media box
+	// inherited from the page tree of the second document)
+	var want []Page
+	for _, doc := range [][]byte{b, []byte(simplePDF)} {
+		i, _ := Inspect(doc, true)
+		want = append(want, i.Pages...)
+	}
+	if got, want := info.PageCount, len(want); got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+	for i, p := range info.Pages {
+		want[i].Number = i + 1
+		if p != want[i] {
+			t.Errorf("expected page %d to be %+v, got %+v", i+1, want[i], p)
+		}
+	}
+	if got, want := len(info.Fonts), 2; got != want {
+		t.Errorf("expected %d fonts, got %d", want, got)
+	}
+}
+
+func TestMerge_xref(t *testing.T) {
+	out, err := Merge([]byte(simplePDF), []byte(simplePDF))
+	if err != nil {
+		t.Fatalf("unable to merge PDFs: %+v", err)
+	}
+
+	// Every entry of the cross-reference table points to its object
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out, -1)
+	if got, want := len(entries), 2+2*4; got != want {
+		t.Fatalf("expected %d objects, got %d", want, got)
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if header := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(out[offset:], []byte(header)) {
+			t.Errorf("expected object %d at offset %d, got %q", i+1, offset, out[offset:offset+10])
+		}
+	}
+	if got, want := PageCount(out), 4; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
+
+func TestMerge_invalid(t *testing.T) {
+	if _, err := Merge([]byte(simplePDF), []byte("<html></html>")); err != ErrNotPDF {
+		t.Errorf("expected error to be %v, got %v", ErrNotPDF, err)
+	}
+	if _, err := Merge([]byte("%PDF-1.4\ntrailer << /Root 1 0 R >>")); err != ErrNoPages {
+		t.Errorf("expected error to be %v, got %v", ErrNoPages, err)
+	}
+	if _, err := Merge([]byte("%PDF-1.4\ntrailer << /Root 1 0 R /Encrypt 2 0 R >>")); err != ErrEncrypted {
+		t.Errorf("expected error to be %v, got %v", ErrEncrypted, err)
+	}
+}
+
+func TestMergeTo(t *testing.T) {
+	a4, ok := PaperSize("a4", false)
+	if !ok {
+		t.Fatalf("expected A4 to be a paper size")
+	}
+	out, err := MergeTo(a4, []byte(simplePDF))
+	if err != nil {
+		t.Fatalf("unable to merge PDFs: %+v", err)
+	}
+	info, err := Inspect(out, true)
+	if err != nil {
+		t.Fatalf("unable to inspect merged PDF: %+v", err)
+	}
+
+	// Every page is displayed in A4 portrait, including the rotated page
+	for _, p := range info.Pages {
+		if p.Size != "A4" || p.Landscape {
+			t.Errorf("expected page %d to be A4 in portrait, got %+v", p.Number, p)
+		}
+	}
+	if got, want := info.Pages[1].Text, "Helloworld\n(again)"; got != want {
+		t.Errorf("expected text of the scaled page to be %q, got %q", want, got)
+	}
+	// The 300x400 page is scaled up to the width of A4, and centered
+	if !bytes.Contains(out, []byte("q 1.9833333333333334 0 0 1.9833333333333334 0 24.333333333333314 cm")) {
+		t.Errorf("expected the content of the first page to be scaled, got %s", out)
+	}
+}
@@ -0,0 +1,278 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var (
+	// ErrUnsupportedFilter is returned when a stream is encoded with a filter
+	// other than FlateDecode.
+	ErrUnsupportedFilter = errors.New("unsupported stream filter")
+
+	objectHeader  = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	streamKeyword = regexp.MustCompile(`>>\s*stream\b`)
+	streamLength  = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	rootRef       = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	objStmHeader  = regexp.MustCompile(`(\d+)\s+(\d+)`)
+)
+
+// object is an indirect PDF object. Its dictionary (or value) is kept as raw
+// text, and its stream (if any) is kept encoded.
+type object struct {
+	dict   []byte
+	stream []byte
+}
+
+// document is a naive parser of the objects in a PDF document. It scans the
+// file for objects rather than relying on the cross-reference table, so it
+// will cope with most truncated, or slightly damaged files.
+type document struct {
+	objects map[int]object
+	root    int
+}
+
+// parse scans the data for indirect objects, including those in compressed
+// object streams.
+func parse(b []byte) *document {
+	d := &document{objects: make(map[int]object)}
+
+	for pos := 0; pos < len(b); {
+		loc := objectHeader.FindSubmatchIndex(b[pos:])
+		if loc == nil {
+			break
+		}
+		id, _ := strconv.Atoi(string(b[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[1]
+
+		end := bytes.Index(b[start:], []byte("endobj"))
+		if end < 0 {
+			end = len(b)
+		} else {
+			end += start
+		}
+
+		obj := object{dict: b[start:end]}
+		if s := streamKeyword.FindIndex(obj.dict); s != nil {
+			obj.dict = b[start : start+s[0]+2]
+			// Continue after the stream, as binary data may contain anything
+			obj.stream, end = readStream(b, start+s[1])
+		}
+		d.objects[id] = obj
+		pos = end
+	}
+
+	if m := lastSubmatch(rootRef, b); m != nil {
+		d.root, _ = strconv.Atoi(string(m[1]))
+	}
+
+	for _, obj := range d.objects {
+		if name(obj.dict, "Type") == "ObjStm" {
+			d.expand(obj)
+		}
+	}
+
+	return d
+}
+
+// readStream returns the raw stream data following the stream keyword at i,
+// and the position of the end of the stream.
+func readStream(b []byte, i int) ([]byte, int) {
+	// The keyword is followed by CRLF, or LF
+	if bytes.HasPrefix(b[i:], []byte("\r\n")) {
+		i += 2
+	} else if i < len(b) && (b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+
+	// Trust a direct length, otherwise search for the end of the stream
+	dictStart := bytes.LastIndex(b[:i], []byte("obj"))
+	if m := streamLength.FindSubmatch(b[dictStart:i]); m != nil && m[2] == nil {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && i+n <= len(b) {
+			return b[i : i+n], i + n
+		}
+	}
+	if end := bytes.Index(b[i:], []byte("endstream")); end >= 0 {
+		return bytes.TrimRight(b[i:i+end], "\r\n"), i + end
+	}
+	return b[i:], len(b)
+}
+
+// expand adds the objects stored in a compressed object stream.
+func (d *document) expand(stm object) {
+	data, err := decode(stm)
+	if err != nil {
+		return
+	}
+	first, err := strconv.Atoi(number(stm.dict, "First"))
+	if err != nil || first > len(data) {
+		return
+	}
+	n, _ := strconv.Atoi(number(stm.dict, "N"))
+
+	pairs := objStmHeader.FindAllSubmatch(data[:first], n)
+	for i, p := range pairs {
+		id, _ := strconv.Atoi(string(p[1]))
+		start, _ := strconv.Atoi(string(p[2]))
+		end := len(data) - first
+		if i+1 < len(pairs) {
+			end, _ = strconv.Atoi(string(pairs[i+1][2]))
+		}
+		if start > end || first+end > len(data) {
+			continue
+		}
+		if _, ok := d.objects[id]; !ok {
+			d.objects[id] = object{dict: data[first+start : first+end]}
+		}
+	}
+}
+
+// get returns the object with the given ID.
+func (d *document) get(id int) (object, bool) {
+	obj, ok := d.objects[id]
+	return obj, ok
+}
+
+// decode returns the decoded stream data of an object.
+func decode(obj object) ([]byte, error) {
+	var filters []string
+	if a := array(obj.dict, "Filter"); a != nil {
+		for _, m := range names.FindAllSubmatch(a, -1) {
+			filters = append(filters, string(m[1]))
+		}
+	} else if f := name(obj.dict, "Filter"); f != "" {
+		filters = append(filters, f)
+	}
+
+	switch {
+	case len(filters) == 0:
+		return obj.stream, nil
+	case len(filters) > 1 || filters[0] != "FlateDecode":
+		return nil, ErrUnsupportedFilter
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(obj.stream))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+var (
+	names = regexp.MustCompile(`/([^\s/<>\[\]()]+)`)
+
+	patterns   = make(map[string]*regexp.Regexp)
+	patternsMu sync.Mutex
+)
+
+// keyPattern returns a pattern matching the given dictionary key followed by
+// a value pattern. Patterns are cached, as keys are reused across objects.
+func keyPattern(key, value string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+
+	k := key + "\x00" + value
+	if p, ok := patterns[k]; ok {
+		return p
+	}
+	p := regexp.MustCompile(`/` + key + `\b\s*` + value)
+	patterns[k] = p
+	return p
+}
+
+// name returns the value of a name entry (e.g. /Type /Page returns "Page").
+func name(dict []byte, key string) string {
+	if m := keyPattern(key, `/([^\s/<>\[\]()]+)`).FindSubmatch(dict); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// number returns the (unparsed) value of a numeric entry.
+func number(dict []byte, key string) string {
+	if m := keyPattern(key, `(-?\d+(?:\.\d*)?)`).FindSubmatch(dict); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// ref returns the object ID referenced by an entry.
+func ref(dict []byte, key string) (int, bool) {
+	if m := keyPattern(key, `(\d+)\s+\d+\s+R`).FindSubmatch(dict); m != nil {
+		id, err := strconv.Atoi(string(m[1]))
+		return id, err == nil
+	}
+	return 0, false
+}
+
+// array returns the raw contents of an array entry.
+func array(dict []byte, key string) []byte {
+	if m := keyPattern(key, `\[([^\]]*)\]`).FindSubmatch(dict); m != nil {
+		return m[1]
+	}
+	return nil
+}
+
+// subdict returns the raw contents of an inline dictionary entry.
+func subdict(dict []byte, key string) []byte {
+	loc := keyPattern(key, `<<`).FindIndex(dict)
+	if loc == nil {
+		return nil
+	}
+	depth := 1
+	for i := loc[1]; i < len(dict)-1; i++ {
+		switch {
+		case dict[i] == '<' && dict[i+1] == '<':
+			depth++
+			i++
+		case dict[i] == '>' && dict[i+1] == '>':
+			if depth--; depth == 0 {
+				return dict[loc[1]:i]
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+var refs = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+
+// refList returns the object IDs referenced in an array.
+func refList(b []byte) []int {
+	var ids []int
+	for _, m := range refs.FindAllSubmatch(b, -1) {
+		if id, err := strconv.Atoi(string(m[1])); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+var namedRefs = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+
+// refMap returns the object IDs referenced by name in a dictionary.
+func refMap(b []byte) map[string]int {
+	ids := make(map[string]int)
+	for _, m := range namedRefs.FindAllSubmatch(b, -1) {
+		if id, err := strconv.Atoi(string(m[2])); err == nil {
+			ids[string(m[1])] = id
+		}
+	}
+	return ids
+}
+
+// lastSubmatch returns the submatches of the last match of a pattern, as
+// incremental updates append a new trailer to the end of the file.
+func lastSubmatch(p *regexp.Regexp, b []byte) [][]byte {
+	all := p.FindAllSubmatch(b, -1)
+	if len(all) == 0 {
+		return nil
+	}
+	return all[len(all)-1]
+}
@@ -0,0 +1,25 @@
+// Package pdf provides light-weight inspection of PDF documents.
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// pageObject matches page objects (but not page tree nodes, i.e. /Pages).
+var pageObject = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// IsPDF returns true if the data starts with a PDF header.
+func IsPDF(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("%PDF-"))
+}
+
+// PageCount returns the number of pages in a PDF document by counting its
+// page objects. It returns 0 if the data is not a PDF.
+// Pages in compressed object streams are not counted.
+func PageCount(b []byte) int {
+	if !IsPDF(b) {
+		return 0
+	}
+	return len(pageObject.FindAllIndex(b, -1))
+}
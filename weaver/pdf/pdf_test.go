@@ -0,0 +1,29 @@
+package pdf
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestPageCount(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	if got := PageCount(b); got < 1 {
+		t.Errorf("expected page count of test PDF to be at least 1, got %d", got)
+	}
+}
+
+func TestPageCount_notPDF(t *testing.T) {
+	if got := PageCount([]byte("<html>/Type /Page </html>")); got != 0 {
+		t.Errorf("expected page count of non-PDF data to be 0, got %d", got)
+	}
+}
+
+func TestPageCount_pageTree(t *testing.T) {
+	b := []byte("%PDF-1.4\n1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] >>\n2 0 obj << /Type /Page >>\n3 0 obj << /Type/Page >>\n")
+	if got, want := PageCount(b), 2; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
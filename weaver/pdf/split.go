@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeInvalid is returned when a page range is malformed, or outside of
+// the pages of a document.
+var ErrRangeInvalid = errors.New("invalid page range provided (use e.g. 1-3,4,5-)")
+
+// Range is an inclusive range of page numbers, starting at 1. A range To 0
+// ends at the last page.
+type Range struct {
+	From int
+	To   int
+}
+
+// ParseRanges parses comma-separated page ranges, e.g. '1-3,4,5-' (pages 1
+// to 3, page 4, and pages 5 to the last page).
+func ParseRanges(spec string) ([]Range, error) {
+	var ranges []Range
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		bounds := strings.SplitN(s, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 1 {
+			return nil, ErrRangeInvalid
+		}
+		r := Range{From: from, To: from}
+		if len(bounds) == 2 {
+			if bounds[1] == "" {
+				r.To = 0
+			} else if r.To, err = strconv.Atoi(bounds[1]); err != nil || r.To < from {
+				return nil, ErrRangeInvalid
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// Split returns a document for each page range of a PDF document, with the
+// pages of the range (and the objects they use). Without ranges, it returns
+// a document for each page.
+func Split(b []byte, ranges ...Range) ([][]byte, error) {
+	d, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	pages := d.pages()
+	if len(pages) == 0 {
+		return nil, ErrNoPages
+	}
+	if len(ranges) == 0 {
+		for i := range pages {
+			ranges = append(ranges, Range{i + 1, i + 1})
+		}
+	}
+
+	docs := make([][]byte, 0, len(ranges))
+	for _, r := range ranges {
+		if r.To == 0 {
+			r.To = len(pages)
+		}
+		if r.From < 1 || r.To < r.From || r.To > len(pages) {
+			return nil, ErrRangeInvalid
+		}
+		docs = append(docs, write([]part{{d: d, pages: pages[r.From-1 : r.To]}}, layout{}))
+	}
+	return docs, nil
+}
@@ -0,0 +1,78 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []Range
+		err  error
+	}{
+		{"1-3,4, 5-", []Range{{1, 3}, {4, 4}, {5, 0}}, nil},
+		{"2", []Range{{2, 2}}, nil},
+		{"", nil, ErrRangeInvalid},
+		{"0-2", nil, ErrRangeInvalid},
+		{"3-1", nil, ErrRangeInvalid},
+		{"1-a", nil, ErrRangeInvalid},
+		{"-2", nil, ErrRangeInvalid},
+	}
+	for _, tt := range tests {
+		got, err := ParseRanges(tt.spec)
+		if err != tt.err {
+			t.Errorf("expected ranges %q to return %v, got %v", tt.spec, tt.err, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected ranges %q to be %v, got %v", tt.spec, tt.want, got)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	docs, err := Split([]byte(simplePDF), Range{2, 0}, Range{1, 2})
+	if err != nil {
+		t.Fatalf("unable to split PDF: %+v", err)
+	}
+	if got, want := len(docs), 2; got != want {
+		t.Fatalf("expected %d documents, got %d", want, got)
+	}
+
+	// The second page (with the font, and content stream) is kept by itself
+	info, err := Inspect(docs[0], true)
+	if err != nil {
+		t.Fatalf("unable to inspect split PDF: %+v", err)
+	}
+	original, _ := Inspect([]byte(simplePDF), true)
+	want := original.Pages[1]
+	want.Number = 1
+	if got := info.Pages; len(got) != 1 || got[0] != want {
+		t.Errorf("expected pages to be [%+v], got %+v", want, got)
+	}
+	if got, want := len(info.Fonts), 1; got != want {
+		t.Errorf("expected %d fonts, got %d", want, got)
+	}
+	if got, want := PageCount(docs[1]), 2; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+
+	// The first page does not use the objects of the second page
+	first, _ := Split([]byte(simplePDF), Range{1, 1})
+	if got, want := len(objectHeader.FindAll(first[0], -1)), 3; got != want {
+		t.Errorf("expected %d objects, got %d", want, got)
+	}
+}
+
+func TestSplit_pages(t *testing.T) {
+	docs, err := Split([]byte(simplePDF))
+	if err != nil {
+		t.Fatalf("unable to split PDF: %+v", err)
+	}
+	if got, want := len(docs), 2; got != want {
+		t.Fatalf("expected a document per page, got %d", got)
+	}
+	if _, err := Split([]byte(simplePDF), Range{2, 3}); err != ErrRangeInvalid {
+		t.Errorf("expected error to be %v, got %v", ErrRangeInvalid, err)
+	}
+}
@@ -0,0 +1,514 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	// PNG, JPEG, and TIFF images can be drawn in overlays
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/tiff"
+	"rsc.io/qr"
+)
+
+var (
+	// ErrImageInvalid is returned when an image is not a PNG, JPEG, or TIFF
+	// image.
+	ErrImageInvalid = errors.New("invalid image provided (use a PNG, JPEG, or TIFF image)")
+	// ErrPositionInvalid is returned when an overlay has an unknown position.
+	ErrPositionInvalid = errors.New("invalid position provided (e.g. center, top, or bottom-right)")
+	// ErrQRTooLong is returned when the content of a QR code is too long to
+	// be encoded.
+	ErrQRTooLong = errors.New("QR code content is too long")
+)
+
+// Position is where an overlay is placed on a page: 'center', an edge
+// ('top', 'bottom', 'left', or 'right'), or a corner (e.g. 'top-left').
+type Position string
+
+// positions are the valid positions. The empty position is the center.
+var positions = map[Position]bool{
+	"": true, "center": true, "top": true, "bottom": true, "left": true, "right": true,
+	"top-left": true, "top-right": true, "bottom-left": true, "bottom-right": true,
+}
+
+// Valid returns true if the position is known.
+func (p Position) Valid() bool {
+	return positions[p]
+}
+
+// place returns the lower left corner of a box placed on a page, at the
+// distance of the margin from the edges.
+func (p Position) place(pageWidth, pageHeight, w, h, margin float64) (float64, float64) {
+	x, y := (pageWidth-w)/2, (pageHeight-h)/2
+	s := string(p)
+	if strings.HasSuffix(s, "left") {
+		x = margin
+	} else if strings.HasSuffix(s, "right") {
+		x = pageWidth - margin - w
+	}
+	if strings.HasPrefix(s, "top") {
+		y = pageHeight - margin - h
+	} else if strings.HasPrefix(s, "bottom") {
+		y = margin
+	}
+	return x, y
+}
+
+// Bates numbers the pages of a document from Start, with at least Digits
+// digits (e.g. '000042').
+type Bates struct {
+	Start  int
+	Digits int
+}
+
+// number returns the Bates number of a page.
+func (b Bates) number(page int) string {
+	return fmt.Sprintf("%0*d", b.Digits, b.Start+page-1)
+}
+
+// Overlay is drawn over the pages of a document (see Stamp): text (e.g. a
+// watermark, or Bates numbers), an image, a QR code, or a barcode.
+type Overlay struct {
+	// Text is drawn in Helvetica (characters outside of the WinAnsi encoding
+	// are replaced by '?'), or encoded as a QR code with QR, or a Code 128
+	// barcode with Barcode. '{page}', '{pages}', and '{bates}' are replaced
+	// by the page number, the page count, and the Bates number of the page.
+	Text    string
+	QR      bool
+	Barcode bool
+	Bates   Bates
+	// Image is drawn instead of the text, if set.
+	Image    *Image
+	Position Position
+	// Size is the font size of text, or the width of an image, QR code, or
+	// barcode, in points. Defaults to 12 for text, 72 for QR codes, 144 for
+	// barcodes, and the width of images in pixels.
+	Size float64
+	// Height is the height of barcodes, in points. Defaults to a third of
+	// their width.
+	Height float64
+	// Pages are the pages the overlay is drawn on. Defaults to every page.
+	Pages []Range
+	// Margin is the distance from the edges of the page, in points.
+	Margin float64
+	// Rotation is the counterclockwise rotation around the center of the
+	// overlay, in degrees.
+	Rotation float64
+	// Opacity is between 0, and 1. Zero is opaque, as a transparent overlay
+	// would not be visible.
+	Opacity float64
+	// Color is the RGB color of text, with components between 0, and 1.
+	Color [3]float64
+}
+
+// onPage returns true if the overlay is drawn on a page.
+func (o Overlay) onPage(page int) bool {
+	if len(o.Pages) == 0 {
+		return true
+	}
+	for _, r := range o.Pages {
+		if page >= r.From && (r.To == 0 || page <= r.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error if the overlay cannot be drawn on the pages of a
+// document of the page count: if its position is unknown, or its content
+// cannot be encoded as a QR code, or barcode.
+func (o Overlay) Validate(pages int) error {
+	if !o.Position.Valid() {
+		return ErrPositionInvalid
+	}
+	// The content of the last page is the longest
+	text := o.text(pages, pages)
+	if o.QR {
+		if _, err := qr.Encode(text, qr.M); err != nil {
+			return ErrQRTooLong
+		}
+	}
+	if o.Barcode {
+		if _, _, err := barcodeModules(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// text returns the text of an overlay on a page.
+func (o Overlay) text(page, pages int) string {
+	return strings.NewReplacer(
+		"{page}", strconv.Itoa(page),
+		"{pages}", strconv.Itoa(pages),
+		"{bates}", o.Bates.number(page),
+	).Replace(o.Text)
+}
+
+// Image is the image of an overlay, or of a page (see FromImages).
+type Image struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+	// mask is the alpha channel, unless the image is opaque.
+	mask []byte
+}
+
+// NewImage returns the image of a PNG, JPEG, or TIFF file. Only the first
+// image of a multi-page TIFF file is read.
+func NewImage(b []byte) (*Image, error) {
+	conf, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || (format != "png" && format != "jpeg" && format != "tiff") {
+		return nil, ErrImageInvalid
+	}
+	// JPEG images are embedded as is, unless they are CMYK images (which
+	// are often inverted)
+	if format == "jpeg" {
+		switch conf.ColorModel {
+		case color.YCbCrModel:
+			return &Image{conf.Width, conf.Height, "DeviceRGB", "DCTDecode", b, nil}, nil
+		case color.GrayModel:
+			return &Image{conf.Width, conf.Height, "DeviceGray", "DCTDecode", b, nil}, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrImageInvalid
+	}
+	bounds := img.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+	im := &Image{bounds.Dx(), bounds.Dy(), "DeviceRGB", "FlateDecode", deflate(rgb), nil}
+	if !opaque {
+		im.mask = deflate(alpha)
+	}
+	return im, nil
+}
+
+// deflate returns the data compressed for the FlateDecode filter.
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Stamp draws the overlays over the pages of a PDF document (every page, or
+// the pages of each overlay), in order. The content of the pages is kept as is (it is not rendered again), but as for
+// Merge, document level features are dropped.
+func Stamp(b []byte, overlays ...Overlay) ([]byte, error) {
+	d, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	pages := d.pages()
+	if len(pages) == 0 {
+		return nil, ErrNoPages
+	}
+	for _, o := range overlays {
+		if err := o.Validate(len(pages)); err != nil {
+			return nil, err
+		}
+	}
+	return write([]part{{d: d, pages: pages}}, layout{overlays: overlays}), nil
+}
+
+// overlayResources are the IDs of the objects shared by the overlays of the
+// pages of a document: the font, and the images (by overlay).
+type overlayResources struct {
+	font   int
+	images map[int]int
+}
+
+// writeResources writes the objects shared by the overlays with the object
+// writer of a document (see write).
+func writeResources(overlays []Overlay, writeObject func(dict string, stream []byte) int) overlayResources {
+	res := overlayResources{images: make(map[int]int)}
+	res.font = writeObject(" /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding", nil)
+	for i, o := range overlays {
+		im := o.Image
+		if im == nil {
+			continue
+		}
+		res.images[i] = writeImage(im, writeObject)
+	}
+	return res
+}
+
+// writeImage writes the image XObject of an image (and of its mask, if any)
+// with the object writer of a document, and returns its ID.
+func writeImage(im *Image, writeObject func(dict string, stream []byte) int) int {
+	dict := fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s", im.width, im.height, im.colorSpace, im.filter)
+	if im.mask == nil {
+		return writeObject(dict, im.data)
+	}
+	// The mask is written first, as objects are written in order
+	mask := writeObject(fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", im.width, im.height), im.mask)
+	return writeObject(fmt.Sprintf("%s /SMask %d 0 R", dict, mask), im.data)
+}
+
+// overlay returns the form XObject drawing the overlays over a page (with
+// its attributes, see pageDict): its dictionary entries, and its content.
+// The overlays are drawn upright, as the page is displayed.
+func (r overlayResources) overlay(dict []byte, overlays []Overlay, page, pages int) ([]byte, []byte) {
+	box := array(dict, "CropBox")
+	if box == nil {
+		box = array(dict, "MediaBox")
+	}
+	x0, y0, w, h := 0.0, 0.0, 612.0, 792.0
+	if f := strings.Fields(string(box)); len(f) == 4 {
+		x0, _ = strconv.ParseFloat(f[0], 64)
+		y0, _ = strconv.ParseFloat(f[1], 64)
+		w, h = dimensions(box)
+	}
+	rotate, _ := strconv.Atoi(number(dict, "Rotate"))
+	rotate = (rotate%360 + 360) % 360
+
+	// The matrix maps the displayed page to the page
+	width, height := w, h
+	matrix := [6]float64{1, 0, 0, 1, 0, 0}
+	switch rotate {
+	case 90:
+		width, height = h, w
+		matrix = [6]float64{0, 1, -1, 0, w, 0}
+	case 180:
+		matrix = [6]float64{-1, 0, 0, -1, w, h}
+	case 270:
+		width, height = h, w
+		matrix = [6]float64{0, -1, 1, 0, 0, h}
+	}
+	matrix[4] += x0
+	matrix[5] += y0
+
+	var content bytes.Buffer
+	var states, xobjects strings.Builder
+	for i, o := range overlays {
+		if !o.onPage(page) {
+			continue
+		}
+		text := o.text(page, pages)
+		size := o.Size
+		var ow, oh float64
+		switch {
+		case o.Image != nil:
+			if size <= 0 {
+				size = float64(o.Image.width)
+			}
+			ow, oh = size, size*float64(o.Image.height)/float64(o.Image.width)
+		case o.QR:
+			if size <= 0 {
+				size = 72
+			}
+			ow, oh = size, size
+		case o.Barcode:
+			if size <= 0 {
+				size = 144
+			}
+			ow, oh = size, o.Height
+			if oh <= 0 {
+				oh = size / 3
+			}
+		default:
+			if size <= 0 {
+				size = 12
+			}
+			ow, oh = textWidth(text)*size/1000, size
+		}
+		x, y := o.Position.place(width, height, ow, oh, o.Margin)
+
+		content.WriteString("q\n")
+		if o.Opacity > 0 && o.Opacity < 1 {
+			fmt.Fprintf(&states, "/WvGS%d << /ca %s /CA %s >> ", i, formatNumber(o.Opacity), formatNumber(o.Opacity))
+			fmt.Fprintf(&content, "/WvGS%d gs\n", i)
+		}
+		// Overlays are drawn around their center, as they are rotated
+		rad := o.Rotation * math.Pi / 180
+		cos, sin := math.Cos(rad), math.Sin(rad)
+		fmt.Fprintf(&content, "%s %s %s %s %s %s cm\n", formatNumber(cos), formatNumber(sin), formatNumber(-sin), formatNumber(cos), formatNumber(x+ow/2), formatNumber(y+oh/2))
+
+		switch {
+		case o.Image != nil:
+			fmt.Fprintf(&xobjects, "/WvIm%d %d 0 R ", i, r.images[i])
+			fmt.Fprintf(&content, "%s 0 0 %s %s %s cm /WvIm%d Do\n", formatNumber(ow), formatNumber(oh), formatNumber(-ow/2), formatNumber(-oh/2), i)
+		case o.QR:
+			code, err := qr.Encode(text, qr.M)
+			if err != nil {
+				break
+			}
+			// The code has a quiet zone of 4 modules
+			module := ow / float64(code.Size+8)
+			fmt.Fprintf(&content, "1 1 1 rg %s %s %s %s re f\n0 0 0 rg\n", formatNumber(-ow/2), formatNumber(-oh/2), formatNumber(ow), formatNumber(oh))
+			for cy := 0; cy < code.Size; cy++ {
+				for cx := 0; cx < code.Size; cx++ {
+					if code.Black(cx, cy) {
+						fmt.Fprintf(&content, "%s %s %s %s re\n", formatNumber(-ow/2+float64(cx+4)*module), formatNumber(oh/2-float64(cy+5)*module), formatNumber(module), formatNumber(module))
+					}
+				}
+			}
+			content.WriteString("f\n")
+		case o.Barcode:
+			widths, total, err := barcodeModules(text)
+			if err != nil {
+				break
+			}
+			// The barcode has quiet zones of 10 modules
+			module := ow / float64(total+20)
+			fmt.Fprintf(&content, "1 1 1 rg %s %s %s %s re f\n0 0 0 rg\n", formatNumber(-ow/2), formatNumber(-oh/2), formatNumber(ow), formatNumber(oh))
+			x := -ow/2 + 10*module
+			for j, w := range widths {
+				if j%2 == 0 {
+					fmt.Fprintf(&content, "%s %s %s %s re\n", formatNumber(x), formatNumber(-oh/2), formatNumber(float64(w)*module), formatNumber(oh))
+				}
+				x += float64(w) * module
+			}
+			content.WriteString("f\n")
+		default:
+			// The baseline is above the descenders
+			fmt.Fprintf(&content, "BT /WvF %s Tf %s %s %s rg %s %s Td (%s) Tj ET\n", formatNumber(size), formatNumber(o.Color[0]), formatNumber(o.Color[1]), formatNumber(o.Color[2]), formatNumber(-ow/2), formatNumber(-oh/2+size*0.2), escapeText(text))
+		}
+		content.WriteString("Q\n")
+	}
+
+	form := fmt.Sprintf(" /Type /XObject /Subtype /Form /BBox [0 0 %s %s] /Matrix [%s %s %s %s %s %s] /Resources << /Font << /WvF %d 0 R >> /XObject << %s>> /ExtGState << %s>> >>",
+		formatNumber(width), formatNumber(height),
+		formatNumber(matrix[0]), formatNumber(matrix[1]), formatNumber(matrix[2]), formatNumber(matrix[3]), formatNumber(matrix[4]), formatNumber(matrix[5]),
+		r.font, xobjects.String(), states.String())
+	return []byte(form), bytes.TrimSpace(content.Bytes())
+}
+
+// unusedID returns an object ID that is not used by the document.
+func (d *document) unusedID() int {
+	max := 0
+	for id := range d.objects {
+		if id > max {
+			max = id
+		}
+	}
+	return max + 1
+}
+
+// withOverlay returns a page (see pageDict) with the overlay with the ID of
+// ref in its XObject resources, as '/WvOverlay'. Resources that are
+// references are copied into the page.
+func (d *document) withOverlay(dict []byte, ref int) []byte {
+	res := d.resolve(value(dict, "Resources"))
+	xobjects := d.resolve(value(res, "XObject"))
+	xobjects = append(append([]byte(nil), bytes.TrimSuffix(xobjects, []byte(">>"))...), fmt.Sprintf(" /WvOverlay %d 0 R >>", ref)...)
+	return setEntry(dict, "Resources", setEntry(res, "XObject", xobjects))
+}
+
+// resolve returns a dictionary value (see value): an inline dictionary, or
+// the dictionary of the object it references. Other values are empty
+// dictionaries.
+func (d *document) resolve(v []byte) []byte {
+	if ids := refList(v); len(ids) == 1 && bytes.HasSuffix(v, []byte("R")) {
+		obj, _ := d.get(ids[0])
+		v = obj.dict
+	}
+	v = bytes.TrimSpace(v)
+	if !bytes.HasPrefix(v, []byte("<<")) || !bytes.HasSuffix(v, []byte(">>")) {
+		return []byte("<< >>")
+	}
+	return v
+}
+
+// setEntry returns a copy of a dictionary with the value of an entry
+// replaced.
+func setEntry(dict []byte, key string, v []byte) []byte {
+	dict = append([]byte(nil), bytes.TrimSuffix(bytes.TrimSpace(dict), []byte(">>"))...)
+	if loc := keyPattern(key, `<<`).FindIndex(dict); loc != nil {
+		depth := 1
+		for i := loc[1]; i < len(dict)-1 && depth > 0; i++ {
+			switch {
+			case dict[i] == '<' && dict[i+1] == '<':
+				depth++
+				i++
+			case dict[i] == '>' && dict[i+1] == '>':
+				if depth--; depth == 0 {
+					dict = append(append([]byte(nil), dict[:loc[0]]...), dict[i+2:]...)
+				}
+				i++
+			}
+		}
+	} else {
+		dict = withoutEntry(dict, key)
+	}
+	return append(append(dict, fmt.Sprintf(" /%s ", key)...), append(v, " >>"...)...)
+}
+
+// winAnsi are the characters of the WinAnsi encoding outside of Latin-1.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// escapeText returns text as the content of a PDF string in the WinAnsi
+// encoding.
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c, ok := winAnsi[r]
+		switch {
+		case ok:
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			c = byte(r)
+		default:
+			c = '?'
+		}
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth returns the width of text in Helvetica, in thousandths of the
+// font size. Characters outside of ASCII are about as wide as a digit.
+func textWidth(s string) float64 {
+	w := 0
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			w += helveticaWidths[r-0x20]
+		} else {
+			w += 556
+		}
+	}
+	return float64(w)
+}
@@ -0,0 +1,130 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStamp(t *testing.T) {
+	out, err := Stamp([]byte(simplePDF),
+		Overlay{Text: "CONFIDENTIAL", Size: 48, Rotation: 45, Opacity: 0.3},
+		Overlay{Text: "ACME-{bates}", Bates: Bates{Start: 41, Digits: 6}, Position: "bottom-right", Margin: 36},
+		Overlay{Text: "page {page} of {pages}", QR: true, Position: "top-left"},
+	)
+	if err != nil {
+		t.Fatalf("unable to stamp PDF: %+v", err)
+	}
+	info, err := Inspect(out, true)
+	if err != nil {
+		t.Fatalf("unable to inspect stamped PDF: %+v", err)
+	}
+
+	// The pages, and their content are unchanged
+	want, _ := Inspect([]byte(simplePDF), true)
+	if got, want := info.PageCount, want.PageCount; got != want {
+		t.Fatalf("expected page count to be %d, got %d", want, got)
+	}
+	for i, p := range info.Pages {
+		if p != want.Pages[i] {
+			t.Errorf("expected page %d to be %+v, got %+v", i+1, want.Pages[i], p)
+		}
+	}
+
+	for _, s := range []string{"(ACME-000041) Tj", "(ACME-000042) Tj", "/WvGS0 gs", "/ca 0.3"} {
+		if !bytes.Contains(out, []byte(s)) {
+			t.Errorf("expected stamped PDF to contain %q, got %s", s, out)
+		}
+	}
+	// The overlay of the rotated page is drawn upright
+	if !bytes.Contains(out, []byte("/BBox [0 0 792 612] /Matrix [0 1 -1 0 612 0]")) {
+		t.Errorf("expected the overlay of the rotated page to be rotated, got %s", out)
+	}
+
+	// Every entry of the cross-reference table points to its object
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out, -1)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if header := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(out[offset:], []byte(header)) {
+			t.Errorf("expected object %d at offset %d, got %q", i+1, offset, out[offset:offset+10])
+		}
+	}
+}
+
+func TestStamp_image(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.NRGBA{R: 0xff, A: 0x80})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("unable to encode image: %+v", err)
+	}
+	im, err := NewImage(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unable to read image: %+v", err)
+	}
+	if im.mask == nil {
+		t.Errorf("expected the transparent image to have a mask")
+	}
+
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	out, err := Stamp(b, Overlay{Image: im, Size: 100, Position: "top"})
+	if err != nil {
+		t.Fatalf("unable to stamp PDF: %+v", err)
+	}
+	// The image is scaled to the size, keeping its aspect ratio
+	if !bytes.Contains(out, []byte("100 0 0 50 -50 -25 cm /WvIm0 Do")) {
+		t.Errorf("expected the image to be drawn, got %s", out)
+	}
+	if got, want := PageCount(out), 1; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
+
+func TestStamp_pages(t *testing.T) {
+	out, err := Stamp([]byte(simplePDF),
+		Overlay{Text: "FIRST", Pages: []Range{{1, 1}}},
+		Overlay{Text: "INV-{page}", Barcode: true, Size: 130, Height: 40, Position: "top-right", Pages: []Range{{2, 0}}},
+	)
+	if err != nil {
+		t.Fatalf("unable to stamp PDF: %+v", err)
+	}
+	if got, want := bytes.Count(out, []byte("(FIRST) Tj")), 1; got != want {
+		t.Errorf("expected the text to be drawn on %d page, got %d", want, got)
+	}
+	// The barcode (with quiet zones) is drawn on the second page only, on a
+	// white background
+	if got, want := bytes.Count(out, []byte("1 1 1 rg -65 -20 130 40 re f")), 1; got != want {
+		t.Errorf("expected the barcode to be drawn on %d page, got %d: %s", want, got, out)
+	}
+}
+
+func TestStamp_invalid(t *testing.T) {
+	if _, err := Stamp([]byte(simplePDF), Overlay{Text: "draft", Position: "middle"}); err != ErrPositionInvalid {
+		t.Errorf("expected error to be %v, got %v", ErrPositionInvalid, err)
+	}
+	if _, err := Stamp([]byte(simplePDF), Overlay{Text: strings.Repeat("x", 3000), QR: true}); err != ErrQRTooLong {
+		t.Errorf("expected error to be %v, got %v", ErrQRTooLong, err)
+	}
+	if _, err := Stamp([]byte(simplePDF), Overlay{Text: "page {page}\n", Barcode: true}); err != ErrBarcodeInvalid {
+		t.Errorf("expected error to be %v, got %v", ErrBarcodeInvalid, err)
+	}
+	if _, err := NewImage([]byte("GIF89a")); err != ErrImageInvalid {
+		t.Errorf("expected error to be %v, got %v", ErrImageInvalid, err)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	if got, want := escapeText("(50%) off — naïve ✓"), `\(50%\) off \227 na\357ve ?`; got != want {
+		t.Errorf("expected escaped text to be %q, got %q", want, got)
+	}
+}
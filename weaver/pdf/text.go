@@ -0,0 +1,395 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// cmap maps character codes to Unicode text, as defined by a ToUnicode CMap.
+type cmap struct {
+	width int
+	codes map[uint32]string
+}
+
+var (
+	codespace = regexp.MustCompile(`(?s)begincodespacerange\s*<([0-9A-Fa-f]+)>`)
+	bfchar    = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	bfrange   = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	charPair  = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]*)>`)
+	rangeDef  = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f]*>|\[[^\]]*\])`)
+	hexString = regexp.MustCompile(`<([0-9A-Fa-f]*)>`)
+)
+
+// parseCMap parses the bfchar, and bfrange mappings of a ToUnicode CMap.
+func parseCMap(b []byte) *cmap {
+	m := &cmap{width: 1, codes: make(map[uint32]string)}
+	if cs := codespace.FindSubmatch(b); cs != nil && len(cs[1]) > 2 {
+		m.width = len(cs[1]) / 2
+	}
+
+	for _, section := range bfchar.FindAllSubmatch(b, -1) {
+		for _, p := range charPair.FindAllSubmatch(section[1], -1) {
+			m.codes[hexCode(p[1])] = utf16Hex(p[2])
+		}
+	}
+
+	for _, section := range bfrange.FindAllSubmatch(b, -1) {
+		for _, r := range rangeDef.FindAllSubmatch(section[1], -1) {
+			lo, hi := hexCode(r[1]), hexCode(r[2])
+			if hi < lo || hi-lo > 0xffff {
+				continue
+			}
+			if r[3][0] == '[' {
+				for i, dst := range hexString.FindAllSubmatch(r[3], -1) {
+					m.codes[lo+uint32(i)] = utf16Hex(dst[1])
+				}
+				continue
+			}
+			// Consecutive codes map to consecutive characters
+			dst := utf16Units(hexString.FindSubmatch(r[3])[1])
+			for code := lo; code <= hi && len(dst) > 0; code++ {
+				m.codes[code] = string(utf16.Decode(dst))
+				dst = append([]uint16(nil), dst...)
+				dst[len(dst)-1]++
+			}
+		}
+	}
+
+	return m
+}
+
+// decode returns the text of a string shown with the font of the cmap.
+func (m *cmap) decode(s []byte) string {
+	var b strings.Builder
+	for i := 0; i+m.width <= len(s); i += m.width {
+		var code uint32
+		for _, c := range s[i : i+m.width] {
+			code = code<<8 | uint32(c)
+		}
+		b.WriteString(m.codes[code])
+	}
+	return b.String()
+}
+
+func hexCode(h []byte) uint32 {
+	n, _ := strconv.ParseUint(string(h), 16, 32)
+	return uint32(n)
+}
+
+func utf16Units(h []byte) []uint16 {
+	b, _ := hex.DecodeString(string(h))
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return u
+}
+
+func utf16Hex(h []byte) string {
+	return string(utf16.Decode(utf16Units(h)))
+}
+
+// latin1 decodes a string shown with a simple font without a ToUnicode CMap.
+// This is correct for the printable ASCII range of the standard encodings.
+func latin1(s []byte) string {
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// text extracts the text of a page. Text is returned in the order it is drawn,
+// with a line break whenever the text line changes.
+func (d *document) text(page int) string {
+	obj, ok := d.get(page)
+	if !ok {
+		return ""
+	}
+
+	fonts := make(map[string]*cmap)
+	for res, id := range d.pageFonts(page) {
+		font, _ := d.get(id)
+		if id, ok := ref(font.dict, "ToUnicode"); ok {
+			if cm, ok := d.get(id); ok {
+				if data, err := decode(cm); err == nil {
+					fonts[res] = parseCMap(data)
+				}
+			}
+		}
+	}
+
+	var contents []int
+	if id, ok := ref(obj.dict, "Contents"); ok {
+		contents = []int{id}
+	} else {
+		contents = refList(array(obj.dict, "Contents"))
+	}
+
+	// Content streams of a page are concatenated
+	var content []byte
+	for _, id := range contents {
+		if cs, ok := d.get(id); ok {
+			if data, err := decode(cs); err == nil {
+				content = append(append(content, data...), '\n')
+			}
+		}
+	}
+
+	return extract(content, fonts)
+}
+
+// textWriter accumulates the text shown by a content stream.
+type textWriter struct {
+	strings.Builder
+	font *cmap
+	y    float64
+	// moved is true once the text position has been set
+	moved bool
+}
+
+func (w *textWriter) show(s []byte) {
+	if w.font != nil {
+		w.WriteString(w.font.decode(s))
+		return
+	}
+	w.WriteString(latin1(s))
+}
+
+func (w *textWriter) newline() {
+	if w.Len() > 0 && !strings.HasSuffix(w.String(), "\n") {
+		w.WriteByte('\n')
+	}
+}
+
+func (w *textWriter) space() {
+	if w.Len() > 0 && !strings.HasSuffix(w.String(), " ") && !strings.HasSuffix(w.String(), "\n") {
+		w.WriteByte(' ')
+	}
+}
+
+// moveTo starts a new line if the text moves vertically.
+func (w *textWriter) moveTo(y float64) {
+	if w.moved && w.y != y {
+		w.newline()
+	}
+	w.y, w.moved = y, true
+}
+
+// kerning beyond this (in thousandths of an em) is treated as a word space.
+const wordSpacing = -250
+
+// extract returns the text shown by the text operators of a content stream.
+func extract(content []byte, fonts map[string]*cmap) string {
+	w := &textWriter{}
+	var operands []token
+
+	for _, t := range tokenize(content) {
+		if t.kind != operator {
+			operands = append(operands, t)
+			continue
+		}
+
+		switch string(t.value) {
+		case "Tf":
+			if len(operands) >= 2 {
+				w.font = fonts[string(operands[len(operands)-2].value)]
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := strconv.ParseFloat(string(operands[len(operands)-1].value), 64)
+				w.moveTo(y)
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, _ := strconv.ParseFloat(string(operands[len(operands)-1].value), 64); ty != 0 {
+					w.newline()
+				}
+			}
+		case "T*":
+			w.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				w.show(operands[len(operands)-1].value)
+			}
+		case "'", "\"":
+			w.newline()
+			if len(operands) >= 1 {
+				w.show(operands[len(operands)-1].value)
+			}
+		case "TJ":
+			for _, e := range operands {
+				switch e.kind {
+				case str:
+					w.show(e.value)
+				case num:
+					if n, _ := strconv.ParseFloat(string(e.value), 64); n < wordSpacing {
+						w.space()
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	// Chromium shows spaces as non-breaking spaces
+	return strings.TrimSpace(strings.Replace(w.String(), "\u00a0", " ", -1))
+}
+
+type tokenKind int
+
+const (
+	operator tokenKind = iota
+	num
+	str
+	nameToken
+	other
+)
+
+type token struct {
+	kind  tokenKind
+	value []byte
+}
+
+const delimiters = "()<>[]{}/%"
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// tokenize splits a content stream into tokens. The elements of arrays are
+// returned as operands; the brackets are skipped. Strings are returned
+// decoded.
+func tokenize(b []byte) []token {
+	var tokens []token
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case isSpace(c), c == '[', c == ']', c == '{', c == '}':
+			i++
+		case c == '%':
+			for i < len(b) && b[i] != '\n' && b[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := literalString(b[i:])
+			tokens = append(tokens, token{str, s})
+			i += n
+		case c == '<' && i+1 < len(b) && b[i+1] == '<', c == '>' && i+1 < len(b) && b[i+1] == '>':
+			tokens = append(tokens, token{other, b[i : i+2]})
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(b[i:], '>')
+			if end < 0 {
+				end = len(b) - i
+			}
+			h := bytes.Map(func(r rune) rune {
+				if isSpace(byte(r)) {
+					return -1
+				}
+				return r
+			}, b[i+1:i+end])
+			if len(h)%2 == 1 {
+				h = append(h, '0')
+			}
+			s, _ := hex.DecodeString(string(h))
+			tokens = append(tokens, token{str, s})
+			i += end + 1
+		default:
+			start := i
+			if c == '/' {
+				i++
+			}
+			for i < len(b) && !isSpace(b[i]) && !strings.ContainsRune(delimiters, rune(b[i])) {
+				i++
+			}
+			if i == start {
+				// Stray delimiter
+				i++
+				continue
+			}
+			v := b[start:i]
+			switch {
+			case c == '/':
+				tokens = append(tokens, token{nameToken, v[1:]})
+			case strings.ContainsRune("+-.0123456789", rune(c)):
+				tokens = append(tokens, token{num, v})
+			default:
+				tokens = append(tokens, token{operator, v})
+				if string(v) == "ID" {
+					// Skip inline image data
+					if end := bytes.Index(b[i:], []byte("EI")); end >= 0 {
+						i += end + 2
+					} else {
+						i = len(b)
+					}
+				}
+			}
+		}
+	}
+	return tokens
+}
+
+// literalString decodes a literal string at the start of b, returning the
+// string and the number of bytes consumed.
+func literalString(b []byte) ([]byte, int) {
+	var s []byte
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				s = append(s, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s, i + 1
+			}
+			s = append(s, c)
+		case '\\':
+			i++
+			if i >= len(b) {
+				break
+			}
+			switch e := b[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case '\r', '\n':
+				// Line continuation
+				if e == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					j := i
+					for ; j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7'; j++ {
+						n = n*8 + int(b[j]-'0')
+					}
+					s = append(s, byte(n))
+					i = j - 1
+				} else {
+					s = append(s, e)
+				}
+			}
+		default:
+			s = append(s, c)
+		}
+	}
+	return s, len(b)
+}
@@ -0,0 +1,87 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	startXRef = regexp.MustCompile(`startxref\s+(\d+)`)
+	infoRef   = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	idArray   = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+)
+
+// update writes objects as an incremental update of a document, so that its
+// other objects are unchanged (e.g. its named destinations are kept).
+type update struct {
+	b       []byte
+	d       *document
+	out     bytes.Buffer
+	offsets map[int]int
+	// next is the ID of the next new object.
+	next int
+}
+
+// newUpdate returns an incremental update of a parsed document.
+func newUpdate(b []byte, d *document) *update {
+	u := &update{b: b, d: d, offsets: make(map[int]int), next: d.unusedID()}
+	u.out.Write(b)
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		u.out.WriteByte('\n')
+	}
+	return u
+}
+
+// add writes a new object, and returns its ID.
+func (u *update) add(dict string, stream []byte) int {
+	id := u.next
+	u.next++
+	u.write(id, dict, stream)
+	return id
+}
+
+// write writes an object, replacing the object of the ID (if any). Streams
+// are written as they are, so the dictionary must describe their encoding,
+// and the length is set.
+func (u *update) write(id int, dict string, stream []byte) {
+	u.offsets[id] = u.out.Len()
+	if stream == nil {
+		fmt.Fprintf(&u.out, "%d 0 obj\n%s\nendobj\n", id, dict)
+		return
+	}
+	dict = string(setEntry([]byte(dict), "Length", []byte(strconv.Itoa(len(stream)))))
+	fmt.Fprintf(&u.out, "%d 0 obj\n%s\nstream\n", id, dict)
+	u.out.Write(stream)
+	u.out.WriteString("\nendstream\nendobj\n")
+}
+
+// bytes returns the updated document, with the cross-reference section, and
+// the trailer of the update.
+func (u *update) bytes() []byte {
+	ids := make([]int, 0, len(u.offsets))
+	for id := range u.offsets {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	xref := u.out.Len()
+	u.out.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, id := range ids {
+		fmt.Fprintf(&u.out, "%d 1\n%010d 00000 n \n", id, u.offsets[id])
+	}
+	fmt.Fprintf(&u.out, "trailer\n<< /Size %d /Root %d 0 R", u.next, u.d.root)
+	if m := lastSubmatch(infoRef, u.b); m != nil {
+		fmt.Fprintf(&u.out, " /Info %s 0 R", m[1])
+	}
+	if ids := idArray.FindAll(u.b, -1); len(ids) > 0 {
+		u.out.WriteByte(' ')
+		u.out.Write(ids[len(ids)-1])
+	}
+	if m := lastSubmatch(startXRef, u.b); m != nil {
+		fmt.Fprintf(&u.out, " /Prev %s", m[1])
+	}
+	fmt.Fprintf(&u.out, " >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return u.out.Bytes()
+}
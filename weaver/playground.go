@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playgroundHTML is the playground page. It converts with the v2 API, so
+// that the request it shows can be reused as is.
+//
+//go:embed playground/index.html
+var playgroundHTML []byte
+
+// playgroundHandler serves the playground page.
+func playgroundHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", playgroundHTML)
+}
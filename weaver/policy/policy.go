@@ -0,0 +1,345 @@
+// Package policy runs operator-provided policy scripts, which inspect the
+// requests of conversions, and rewrite, or validate their options centrally
+// (e.g. to force a page size, inject a footer, or reject domains).
+//
+// Scripts are written in Lua 5.1, and run by gopher-lua in a restricted
+// environment: only the base, string, table, and math libraries are opened,
+// without the functions loading code, or files (dofile, loadfile, load,
+// loadstring, require, module), or getting around the environment (getfenv,
+// setfenv), and each run has its own state, and a time limit (see
+// Script.Timeout). For example:
+//
+//	for _, s in ipairs(sources) do
+//	  if host_matches(s.host, "*.internal.example.com") then
+//	    reject("internal hosts may not be converted")
+//	  end
+//	end
+//	options.page_size = "A4"
+//	if options.footer_template == nil then
+//	  options.footer_template = [[<div style="font-size: 8px">Example Corp.</div>]]
+//	end
+//
+// Besides the libraries, a script has the following globals:
+//
+//   - options, the options of the conversion (its query parameters), which
+//     it may change, or remove (by setting them to nil),
+//   - sources, an array of the 'url', 'scheme', 'host', and 'path' of every
+//     URL the conversion fetches (as they were before the script ran), e.g.
+//     every URL of a merge, or every section of a v2 request,
+//   - source, the first of the sources, or an empty table,
+//   - request, the 'method', 'path', 'client_ip', 'tenant', and 'headers' (by
+//     lower-case name) of the request,
+//   - reject(message), which rejects the request,
+//   - log(…), which logs its arguments,
+//   - starts_with(s, prefix), ends_with(s, suffix), contains(s, substring),
+//     matches(s, regexp) (a Go regular expression), and host_matches(host,
+//     domain) (a domain, or '*.domain' for its subdomains too).
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// DefaultTimeout is the default time limit of a run of a script.
+const DefaultTimeout = time.Second
+
+// chunkName is the name of scripts in the errors of gopher-lua.
+const chunkName = "policy"
+
+// Error is returned when a script is invalid, or fails.
+type Error struct {
+	// Line is the line of the error, or 0 if it has none.
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return "policy: " + e.Msg
+	}
+	return fmt.Sprintf("policy: line %d: %s", e.Line, e.Msg)
+}
+
+// Rejection is returned when a script rejects a request. Its message is
+// the message passed to reject.
+type Rejection struct {
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Script is a compiled policy script. It is safe for concurrent use: each run
+// has its own Lua state.
+type Script struct {
+	proto *lua.FunctionProto
+	// Timeout is the time limit of a run, after which it fails. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Compile compiles the source of a script.
+func Compile(src string) (*Script, error) {
+	chunk, err := parse.Parse(strings.NewReader(src), chunkName)
+	if err != nil {
+		if e, ok := err.(*parse.Error); ok {
+			if e.Pos.Line == parse.EOF {
+				line := strings.Count(strings.TrimRight(src, "\n"), "\n") + 1
+				return nil, &Error{Line: line, Msg: e.Message + " near <eof>"}
+			}
+			return nil, &Error{Line: e.Pos.Line, Msg: fmt.Sprintf("%s near '%s'", e.Message, e.Token)}
+		}
+		return nil, &Error{Msg: err.Error()}
+	}
+	proto, err := lua.Compile(chunk, chunkName)
+	if err != nil {
+		if e, ok := err.(*lua.CompileError); ok {
+			return nil, &Error{Line: e.Line, Msg: e.Message}
+		}
+		return nil, &Error{Msg: err.Error()}
+	}
+	return &Script{proto: proto, Timeout: DefaultTimeout}, nil
+}
+
+// Load compiles the script in a file.
+func Load(path string) (*Script, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(string(b))
+}
+
+// Request is the request of a conversion, as seen by a script.
+type Request struct {
+	Method   string
+	Path     string
+	ClientIP string
+	Tenant   string
+	Header   http.Header
+	// Options are the options of the conversion (its query parameters).
+	Options url.Values
+	// Sources are the URLs the conversion fetches, or nil for the 'url'
+	// options.
+	Sources []string
+}
+
+// Run runs the script on a request, and returns its options, as rewritten by
+// the script. Options that are not changed keep all their values, while the
+// script only sees the first. It returns a *Rejection if the script rejects
+// the request, or an *Error if it fails, or does not finish in time.
+func (s *Script) Run(r Request) (url.Values, error) {
+	L := newState()
+	defer L.Close()
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	L.SetContext(ctx)
+
+	options := L.NewTable()
+	for k, v := range r.Options {
+		if len(v) > 0 {
+			options.RawSetString(k, lua.LString(v[0]))
+		}
+	}
+	urls := r.Sources
+	if urls == nil {
+		urls = r.Options["url"]
+	}
+	sources := L.NewTable()
+	for _, uri := range urls {
+		if u, err := url.Parse(uri); err == nil && u.Host != "" {
+			source := L.NewTable()
+			source.RawSetString("url", lua.LString(u.String()))
+			source.RawSetString("scheme", lua.LString(u.Scheme))
+			source.RawSetString("host", lua.LString(u.Hostname()))
+			source.RawSetString("path", lua.LString(u.Path))
+			sources.Append(source)
+		}
+	}
+	source := L.NewTable()
+	if first, ok := sources.RawGetInt(1).(*lua.LTable); ok {
+		source = first
+	}
+	headers := L.NewTable()
+	for k, v := range r.Header {
+		if len(v) > 0 {
+			headers.RawSetString(strings.ToLower(k), lua.LString(v[0]))
+		}
+	}
+	request := L.NewTable()
+	request.RawSetString("method", lua.LString(r.Method))
+	request.RawSetString("path", lua.LString(r.Path))
+	request.RawSetString("client_ip", lua.LString(r.ClientIP))
+	request.RawSetString("tenant", lua.LString(r.Tenant))
+	request.RawSetString("headers", headers)
+	L.SetGlobal("options", options)
+	L.SetGlobal("sources", sources)
+	L.SetGlobal("source", source)
+	L.SetGlobal("request", request)
+
+	// A rejection is kept aside, so that it stands even if the script
+	// catches the error raised by reject with pcall.
+	var rejection *Rejection
+	L.SetGlobal("reject", L.NewFunction(func(L *lua.LState) int {
+		rejection = &Rejection{Message: "rejected by policy"}
+		if v := L.Get(1); v != lua.LNil {
+			rejection.Message = L.ToStringMeta(v).String()
+		}
+		L.RaiseError("%s", rejection.Message)
+		return 0
+	}))
+
+	L.Push(L.NewFunctionFromProto(s.proto))
+	err := L.PCall(0, lua.MultRet, nil)
+	if rejection != nil {
+		return nil, rejection
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &Error{Msg: fmt.Sprintf("timed out after %v", timeout)}
+		}
+		return nil, runError(err)
+	}
+
+	keys := make([]string, 0)
+	values := make(map[string]string)
+	var bad error
+	options.ForEach(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok || bad != nil {
+			return
+		}
+		switch v.(type) {
+		case lua.LString, lua.LNumber, lua.LBool:
+			keys = append(keys, string(key))
+			values[string(key)] = v.String()
+		default:
+			bad = &Error{Msg: fmt.Sprintf("option '%s' must be a string (got a %s)", key, v.Type())}
+		}
+	})
+	if bad != nil {
+		return nil, bad
+	}
+	sort.Strings(keys)
+
+	out := make(url.Values, len(r.Options))
+	for k, v := range r.Options {
+		if _, ok := values[k]; ok || len(v) == 0 {
+			out[k] = v
+		}
+	}
+	for _, k := range keys {
+		v := values[k]
+		if old, ok := r.Options[k]; !ok || len(old) == 0 || old[0] != v {
+			out.Set(k, v)
+		}
+	}
+	return out, nil
+}
+
+// unsafeGlobals are the functions of the base library removed from scripts,
+// which load code, or files, or get around the environment.
+var unsafeGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "getfenv", "setfenv", "collectgarbage", "print", "_printregs", "newproxy"}
+
+// unsafeStrings are the functions of the string library removed from
+// scripts: string.rep allocates strings of any size at once, which the time
+// limit cannot stop, and string.dump is of no use without load.
+var unsafeStrings = []string{"dump", "rep"}
+
+// newState creates the restricted Lua state of a run.
+func newState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 200, RegistryMaxSize: 1 << 16})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.StringLibName, lua.OpenString},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+	str := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	for _, name := range unsafeStrings {
+		str.RawSetString(name, lua.LNil)
+	}
+
+	L.SetGlobal("log", L.NewFunction(func(L *lua.LState) int {
+		s := make([]string, L.GetTop())
+		for i := range s {
+			s[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		log.Printf("[Policy] %s\n", strings.Join(s, " "))
+		return 0
+	}))
+	stringFunc := func(f func(a, b string) bool) *lua.LFunction {
+		return L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LBool(f(L.CheckString(1), L.CheckString(2))))
+			return 1
+		})
+	}
+	L.SetGlobal("starts_with", stringFunc(strings.HasPrefix))
+	L.SetGlobal("ends_with", stringFunc(strings.HasSuffix))
+	L.SetGlobal("contains", stringFunc(strings.Contains))
+	L.SetGlobal("host_matches", stringFunc(hostMatches))
+	L.SetGlobal("matches", L.NewFunction(func(L *lua.LState) int {
+		s, expr := L.CheckString(1), L.CheckString(2)
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		L.Push(lua.LBool(re.MatchString(s)))
+		return 1
+	}))
+	return L
+}
+
+// runErrorPrefix matches the position prefixed to the errors of a run.
+var runErrorPrefix = regexp.MustCompile(`^` + chunkName + `:(\d+): `)
+
+// runError converts an error of a run to an *Error.
+func runError(err error) error {
+	msg := err.Error()
+	if e, ok := err.(*lua.ApiError); ok {
+		msg = e.Object.String()
+	}
+	if m := runErrorPrefix.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &Error{Line: line, Msg: msg[len(m[0]):]}
+	}
+	return &Error{Msg: msg}
+}
+
+// hostMatches returns true if a host is a domain, or a subdomain of it if
+// the domain starts with '*.'.
+func hostMatches(host, domain string) bool {
+	host, domain = strings.ToLower(strings.TrimSuffix(host, ".")), strings.ToLower(domain)
+	if strings.HasPrefix(domain, "*.") {
+		return host == domain[2:] || strings.HasSuffix(host, domain[1:])
+	}
+	return host == domain
+}
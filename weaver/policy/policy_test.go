@@ -0,0 +1,286 @@
+package policy
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, src string, r Request) (url.Values, error) {
+	s, err := Compile(src)
+	if err != nil {
+		t.Fatalf("expected %q to compile, got %+v", src, err)
+	}
+	return s.Run(r)
+}
+
+func TestScript_options(t *testing.T) {
+	src := `
+-- Force A4, and a footer
+options.page_size = "A4"
+if options.footer_template == nil then
+  options.footer_template = [[
+<div>Example Corp.</div>]]
+end
+options.delay = nil
+if request.tenant == "free" and options.format ~= "pdf" then
+  options.format = "pdf"
+end
+options.dpi = (tonumber(options.dpi) or 96) * 2
+`
+	r := Request{
+		Tenant: "free",
+		Options: url.Values{
+			"url":       {"https://example.com/a"},
+			"page_size": {"Letter"},
+			"delay":     {"5"},
+			"format":    {"png"},
+			"notify":    {"webhook:a", "webhook:b"},
+		},
+	}
+	got, err := run(t, src, r)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	want := url.Values{
+		"url":             {"https://example.com/a"},
+		"page_size":       {"A4"},
+		"footer_template": {"<div>Example Corp.</div>"},
+		"format":          {"pdf"},
+		"notify":          {"webhook:a", "webhook:b"},
+		"dpi":             {"192"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected options %v, got %v", want, got)
+	}
+	if r.Options.Get("page_size") != "Letter" {
+		t.Error("expected the options of the request to be unchanged")
+	}
+}
+
+func TestScript_reject(t *testing.T) {
+	src := `
+if host_matches(source.host, "*.internal.example.com") then
+  reject("internal hosts may not be converted")
+elseif request.headers["x-team"] == nil then
+  reject()
+end
+do return end
+reject("unreachable")
+`
+	tests := []struct {
+		url    string
+		header http.Header
+		err    string
+	}{
+		{"https://wiki.internal.example.com/a", nil, "internal hosts may not be converted"},
+		{"https://INTERNAL.example.com", nil, "internal hosts may not be converted"},
+		{"https://example.com", nil, "rejected by policy"},
+		{"https://example.com", http.Header{"X-Team": {"docs"}}, ""},
+	}
+	for _, tt := range tests {
+		_, err := run(t, src, Request{Header: tt.header, Options: url.Values{"url": {tt.url}}})
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("expected %s to be accepted, got %+v", tt.url, err)
+			}
+			continue
+		}
+		if r, ok := err.(*Rejection); !ok || r.Message != tt.err {
+			t.Errorf("expected %s to be rejected with %q, got %+v", tt.url, tt.err, err)
+		}
+	}
+}
+
+func TestScript_sources(t *testing.T) {
+	src := `
+local hosts = {}
+for _, s in ipairs(sources) do
+  table.insert(hosts, s.host)
+end
+options.hosts = table.concat(hosts, ",")
+options.first = source.host
+`
+	tests := []struct {
+		r     Request
+		hosts string
+		first string
+	}{
+		{Request{Options: url.Values{"url": {"https://a.example.com", "https://b.example.com"}}}, "a.example.com,b.example.com", "a.example.com"},
+		{Request{Options: url.Values{"url": {"https://a.example.com"}}, Sources: []string{"https://b.example.com", "not a URL", "https://c.example.com/x"}}, "b.example.com,c.example.com", "b.example.com"},
+		{Request{Options: url.Values{}}, "", ""},
+	}
+	for _, tt := range tests {
+		got, err := run(t, src, tt.r)
+		if err != nil {
+			t.Fatalf("expected no error, got %+v", err)
+		}
+		if got.Get("hosts") != tt.hosts || got.Get("first") != tt.first {
+			t.Errorf("expected sources %q (first %q), got %q (%q)", tt.hosts, tt.first, got.Get("hosts"), got.Get("first"))
+		}
+	}
+}
+
+func TestScript_expressions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`1 + 2 * 3`, "7"},
+		{`(1 + 2) * 3`, "9"},
+		{`7 % 3 .. ""`, "1"},
+		{`10 / 4`, "2.5"},
+		{`-2 - -3`, "1"},
+		{`"a" .. "b" .. 1`, "ab1"},
+		{`#"abc"`, "3"},
+		{`"10" + 1`, "11"},
+		{`1 < 2 and "yes" or "no"`, "yes"},
+		{`nil or false`, "false"},
+		{`not nil`, "true"},
+		{`"a" < "b"`, "true"},
+		{`1 == "1"`, "false"},
+		{`("Weaver"):lower()`, "weaver"},
+		{`string.upper("a")`, "A"},
+		{`string.sub("weaver", 2, -2)`, "eave"},
+		{`("weaver"):sub(-3)`, "ver"},
+		{`starts_with("weaver", "we")`, "true"},
+		{`ends_with("weaver", "x")`, "false"},
+		{`contains("weaver", "ave")`, "true"},
+		{`matches("A4", "^[AB][0-9]$")`, "true"},
+		{`type(options)`, "table"},
+		{`tostring(nil)`, "nil"},
+		{`tonumber("x")`, "nil"},
+	}
+	for _, tt := range tests {
+		got, err := run(t, "local v = "+tt.expr+"\noptions.v = tostring(v)", Request{})
+		if err != nil {
+			t.Errorf("expected %s to be evaluated, got %+v", tt.expr, err)
+			continue
+		}
+		if got.Get("v") != tt.want {
+			t.Errorf("expected %s to be %q, got %q", tt.expr, tt.want, got.Get("v"))
+		}
+	}
+}
+
+func TestScript_scopes(t *testing.T) {
+	got, err := run(t, `
+local a = "outer"
+do
+  local a = "inner"
+  b = a
+end
+if true then
+  a = a .. "!"
+end
+options.a, options.b, options.url = a, b, nil
+`, Request{Options: url.Values{"url": {"https://example.com"}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	want := url.Values{"a": {"outer!"}, "b": {"inner"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected options %v, got %v", want, got)
+	}
+}
+
+func TestScript_lua(t *testing.T) {
+	got, err := run(t, `
+local blocked = {"a.example.com", "b.example.com"}
+local function blocked_host(host)
+  for _, h in ipairs(blocked) do
+    if host == h then return true end
+  end
+  return false
+end
+options.blocked = blocked_host(source.host)
+options.parts = table.concat({string.format("%02d", 7), string.rep and "rep" or "norep"}, ",")
+options.max = math.max(1, 2)
+`, Request{Options: url.Values{"url": {"https://b.example.com/a"}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got.Get("blocked") != "true" || got.Get("parts") != "07,norep" || got.Get("max") != "2" {
+		t.Errorf("expected blocked, parts, and max to be %q, %q, and %q, got %v", "true", "07,norep", "2", got)
+	}
+}
+
+func TestScript_sandbox(t *testing.T) {
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "getfenv", "setfenv", "os", "io", "debug", "package", "channel", "coroutine"} {
+		got, err := run(t, "options.v = type("+name+")", Request{})
+		if err != nil {
+			t.Fatalf("expected no error, got %+v", err)
+		}
+		if got.Get("v") != "nil" {
+			t.Errorf("expected %s to be nil, got a %s", name, got.Get("v"))
+		}
+	}
+}
+
+func TestScript_timeout(t *testing.T) {
+	s, err := Compile("while true do end")
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	s.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err = s.Run(Request{})
+	if e, ok := err.(*Error); !ok || !strings.Contains(e.Msg, "timed out") {
+		t.Errorf("expected the script to time out, got %+v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the script to be stopped after its timeout, got %v", d)
+	}
+}
+
+func TestScript_rejectCaught(t *testing.T) {
+	_, err := run(t, `pcall(reject, "no")`, Request{})
+	if r, ok := err.(*Rejection); !ok || r.Message != "no" {
+		t.Errorf("expected a caught rejection to stand, got %+v", err)
+	}
+}
+
+func TestCompile_err(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"options.a = ", "policy: line 1: syntax error near <eof>"},
+		{"if a then\nb = 1", "policy: line 2: syntax error near <eof>"},
+		{"a = 'b", "policy: line 1: unterminated string near <eof>"},
+		{"a = [[b", "policy: line 1: unterminated multiline string near <eof>"},
+		{"return\na = 1", "policy: line 2: syntax error near '='"},
+		{"\nf() = 1", "policy: line 2: syntax error near '='"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("expected %q to fail with %q, got %v", tt.src, tt.err, err)
+		}
+	}
+}
+
+func TestScript_runErr(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"local a = missing.field", "policy: line 1: attempt to index a non-table object(nil) with key 'field'"},
+		{"\nlocal a = options.x .. 'a'", "policy: line 2: cannot perform concat operation between nil and string"},
+		{"local a = 1 + options.x", "policy: line 1: cannot perform add operation between number and nil"},
+		{"undefined()", "policy: line 1: attempt to call a non-function object"},
+		{"local a = matches('a', '(')", "policy: line 1: error parsing regexp: missing closing ): `(`"},
+		{"local a = starts_with('a')", "policy: line 1: bad argument #2 to starts_with (string expected, got nil)"},
+		{"error('custom')", "policy: line 1: custom"},
+		{"options.a = options", "policy: option 'a' must be a string (got a table)"},
+	}
+	for _, tt := range tests {
+		_, err := run(t, tt.src, Request{})
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("expected %q to fail with %q, got %v", tt.src, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+// hostLimiter returns the limiter of source hosts from the context, or nil
+// if it is not set.
+func hostLimiter(c *gin.Context) *politeness.Limiter {
+	if l, ok := c.Get("politeness"); ok {
+		return l.(*politeness.Limiter)
+	}
+	return nil
+}
+
+// tenantHostLimit returns the host limit of the tenant of a request, or nil
+// if it has none of its own.
+func tenantHostLimit(c *gin.Context) *politeness.Limit {
+	if t, ok := c.Get("tenant"); ok {
+		return t.(tenant.Tenant).HostLimit
+	}
+	return nil
+}
+
+// hostLimit returns the key the conversions of a tenant are counted by, and
+// their limit: the tenant's own (see tenant.Tenant), or the default limit.
+func hostLimit(conf Config, tenantID string, own *politeness.Limit) (string, politeness.Limit) {
+	if own != nil {
+		return tenantID, *own
+	}
+	return "", conf.Politeness.Limit()
+}
+
+// acquireSource waits until a conversion of the host of a source URL can
+// start, and returns a function that must be called once it has finished. It
+// returns politeness.ErrBusy (and sets a Retry-After header) if the request
+// would wait longer than the maximum wait.
+func acquireSource(c *gin.Context, uri string) (func(), error) {
+	l := hostLimiter(c)
+	host := sourceDomain(uri)
+	if l == nil || host == "" {
+		return func() {}, nil
+	}
+	conf := c.MustGet("config").(Config)
+	key, limit := hostLimit(conf, tenantID(c), tenantHostLimit(c))
+	maxWait := time.Second * time.Duration(conf.Politeness.MaxWait)
+	release, err := l.Acquire(key, host, limit, maxWait, c.Request.Context().Done())
+	if err == politeness.ErrBusy {
+		retry := math.Max(1, math.Ceil(float64(limit.DelayMS)/1000))
+		c.Header("Retry-After", strconv.Itoa(int(retry)))
+	}
+	return release, err
+}
+
+// acquireJob waits until the conversion of a job can start (see
+// acquireSource). Jobs wait for as long as needed.
+func acquireJob(l *politeness.Limiter, conf Config, j queue.Job, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	key, limit := hostLimit(conf, j.Tenant, j.HostLimit)
+	return l.Acquire(key, host, limit, 0, nil)
+}
@@ -0,0 +1,170 @@
+// Package politeness limits the conversions of each source host, so that bulk
+// conversions of a site do not overload it (or get weaver blocked by it): the
+// number of concurrent conversions of a host is capped, and their starts may
+// be spaced by a crawl delay.
+package politeness
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBusy is returned when a conversion of a host could not start
+	// within the maximum wait.
+	ErrBusy = errors.New("too many conversions of the source host, try again later")
+	// ErrCancelled is returned when a conversion is cancelled while it
+	// waits for its host.
+	ErrCancelled = errors.New("cancelled while waiting for the source host")
+)
+
+// Limit is the limit of the conversions of a host. The zero value is
+// unlimited.
+type Limit struct {
+	// Concurrency is the maximum number of concurrent conversions of a
+	// host, or 0 for any number.
+	Concurrency int `json:"concurrency,omitempty"`
+	// DelayMS is the minimum delay between the starts of two conversions
+	// of a host in milliseconds (a crawl delay).
+	DelayMS int `json:"delay_ms,omitempty"`
+}
+
+// IsZero returns true if the limit is unlimited.
+func (l Limit) IsZero() bool {
+	return l.Concurrency <= 0 && l.DelayMS <= 0
+}
+
+func (l Limit) delay() time.Duration {
+	return time.Millisecond * time.Duration(l.DelayMS)
+}
+
+// bucket contains the conversions of a host, for a key.
+type bucket struct {
+	active  int
+	waiting int
+	// next is the earliest start of the next conversion.
+	next time.Time
+	// released is closed, and replaced when a conversion finishes.
+	released chan struct{}
+}
+
+// Limiter limits the conversions of hosts. Conversions are counted per key,
+// and host, so that clients with their own limits (e.g. tenants) do not share
+// the conversions of a host with others.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// New creates a limiter.
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Acquire waits until a conversion of a host can start under a limit, and
+// returns a function that must be called once it has finished. It returns
+// ErrBusy if it would wait longer than maxWait (0 waits for as long as
+// needed), or ErrCancelled if cancel is closed first.
+func (l *Limiter) Acquire(key, host string, limit Limit, maxWait time.Duration, cancel <-chan struct{}) (func(), error) {
+	if limit.IsZero() || host == "" {
+		return func() {}, nil
+	}
+	var deadline <-chan time.Time
+	if maxWait > 0 {
+		t := time.NewTimer(maxWait)
+		defer t.Stop()
+		deadline = t.C
+	}
+	k := key + "\x00" + host
+	for {
+		l.mu.Lock()
+		b, ok := l.buckets[k]
+		if !ok {
+			b = &bucket{released: make(chan struct{})}
+			l.buckets[k] = b
+		}
+		now := l.now()
+		free := limit.Concurrency <= 0 || b.active < limit.Concurrency
+		if free && !now.Before(b.next) {
+			b.active++
+			b.next = now.Add(limit.delay())
+			l.mu.Unlock()
+			return l.releaser(k, b), nil
+		}
+		// Wait for a conversion to finish, or for the crawl delay
+		var delayed <-chan time.Time
+		var timer *time.Timer
+		if free {
+			timer = time.NewTimer(b.next.Sub(now))
+			delayed = timer.C
+		}
+		released := b.released
+		b.waiting++
+		l.mu.Unlock()
+
+		var err error
+		select {
+		case <-released:
+		case <-delayed:
+		case <-deadline:
+			err = ErrBusy
+		case <-cancel:
+			err = ErrCancelled
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		l.mu.Lock()
+		b.waiting--
+		if err != nil {
+			l.prune(k, b)
+		}
+		l.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *Limiter) releaser(k string, b *bucket) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			b.active--
+			close(b.released)
+			b.released = make(chan struct{})
+			l.prune(k, b)
+		})
+	}
+}
+
+// prune removes a bucket without conversions once its crawl delay has
+// passed. It must be called with the lock held.
+func (l *Limiter) prune(k string, b *bucket) {
+	if b.active > 0 || b.waiting > 0 || l.buckets[k] != b {
+		return
+	}
+	if d := b.next.Sub(l.now()); d > 0 {
+		time.AfterFunc(d, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.prune(k, b)
+		})
+		return
+	}
+	delete(l.buckets, k)
+}
+
+// Active returns the number of conversions of a host for a key.
+func (l *Limiter) Active(key, host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key+"\x00"+host]; ok {
+		return b.active
+	}
+	return 0
+}
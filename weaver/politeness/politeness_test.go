@@ -0,0 +1,117 @@
+package politeness
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_concurrency(t *testing.T) {
+	l := New()
+	limit := Limit{Concurrency: 2}
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire("", "example.com", limit, time.Second, nil)
+		if err != nil {
+			t.Fatalf("expected conversion %d to start, got %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if got := l.Active("", "example.com"); got != 2 {
+		t.Errorf("expected 2 active conversions, got %d", got)
+	}
+	if _, err := l.Acquire("", "example.com", limit, time.Millisecond*50, nil); err != ErrBusy {
+		t.Errorf("expected error to be %v, got %v", ErrBusy, err)
+	}
+	// Other hosts, and keys have their own conversions
+	for _, k := range [][2]string{{"", "other.example.com"}, {"acme", "example.com"}} {
+		release, err := l.Acquire(k[0], k[1], limit, time.Millisecond*50, nil)
+		if err != nil {
+			t.Errorf("expected conversion of %s (%q) to start, got %v", k[1], k[0], err)
+			continue
+		}
+		release()
+	}
+
+	started := make(chan struct{})
+	go func() {
+		release, err := l.Acquire("", "example.com", limit, 0, nil)
+		if err != nil {
+			t.Errorf("expected the waiting conversion to start, got %v", err)
+			return
+		}
+		release()
+		close(started)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	releases[0]()
+	releases[0]()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting conversion to start once another finished")
+	}
+	releases[1]()
+	if got := l.Active("", "example.com"); got != 0 {
+		t.Errorf("expected no active conversions, got %d", got)
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("expected the buckets to be pruned, got %d", len(l.buckets))
+	}
+}
+
+func TestLimiter_delay(t *testing.T) {
+	l := New()
+	limit := Limit{DelayMS: 100}
+	start := time.Now()
+	var mu sync.Mutex
+	var starts []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire("", "example.com", limit, time.Second*5, nil)
+			if err != nil {
+				t.Errorf("expected the conversion to start, got %v", err)
+				return
+			}
+			mu.Lock()
+			starts = append(starts, time.Since(start))
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+	if len(starts) != 3 {
+		t.Fatalf("expected 3 conversions, got %d", len(starts))
+	}
+	if last := starts[2]; last < time.Millisecond*200 {
+		t.Errorf("expected the starts to be spaced by the crawl delay, got %v", starts)
+	}
+}
+
+func TestLimiter_cancel(t *testing.T) {
+	l := New()
+	limit := Limit{Concurrency: 1}
+	release, _ := l.Acquire("", "example.com", limit, 0, nil)
+	defer release()
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, err := l.Acquire("", "example.com", limit, 0, cancel); err != ErrCancelled {
+		t.Errorf("expected error to be %v, got %v", ErrCancelled, err)
+	}
+}
+
+func TestLimiter_unlimited(t *testing.T) {
+	l := New()
+	for i := 0; i < 10; i++ {
+		if _, err := l.Acquire("", "example.com", Limit{}, time.Millisecond, nil); err != nil {
+			t.Fatalf("expected conversions to be unlimited, got %v", err)
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("expected unlimited conversions not to be counted, got %d buckets", len(l.buckets))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/politeness"
+	"github.com/lachee/athenapdf/weaver/queue"
+)
+
+func TestConvertByURLHandler_hostBusy(t *testing.T) {
+	l := politeness.New()
+	release, _ := l.Acquire("", "example.com", politeness.Limit{Concurrency: 1}, 0, nil)
+	defer release()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.Politeness = Politeness{HostConcurrency: 1, MaxWait: 1}
+	svc := Services{Queue: converter.InitWorkers(1, 1, 10), Politeness: l}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/convert?auth=123456&url=https://example.com/page", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+	if got, want := res.Header().Get("Retry-After"), "1"; got != want {
+		t.Errorf("expected Retry-After header to be %s, got %s", want, got)
+	}
+	if got := l.Active("", "example.com"); got != 1 {
+		t.Errorf("expected 1 active conversion of the host, got %d", got)
+	}
+	if got, want := errorCode(politeness.ErrBusy, http.StatusServiceUnavailable), CodeSourceUnavailable; got != want {
+		t.Errorf("expected error code to be %s, got %s", want, got)
+	}
+}
+
+func TestHostLimit(t *testing.T) {
+	conf := defaultConfig()
+	conf.Politeness = Politeness{HostConcurrency: 2, CrawlDelay: 500}
+	key, limit := hostLimit(conf, "acme", nil)
+	if want := (politeness.Limit{Concurrency: 2, DelayMS: 500}); key != "" || limit != want {
+		t.Errorf("expected the default limit %+v, got %q %+v", want, key, limit)
+	}
+	own := &politeness.Limit{Concurrency: 5}
+	key, limit = hostLimit(conf, "acme", own)
+	if key != "acme" || limit != *own {
+		t.Errorf("expected the tenant's limit %+v, got %q %+v", *own, key, limit)
+	}
+}
+
+func TestAcquireJob(t *testing.T) {
+	l := politeness.New()
+	conf := defaultConfig()
+	j := queue.Job{Tenant: "acme", HostLimit: &politeness.Limit{Concurrency: 1}}
+	release, err := acquireJob(l, conf, j, "example.com")
+	if err != nil {
+		t.Fatalf("acquire returned an unexpected error: %+v", err)
+	}
+	if got := l.Active("acme", "example.com"); got != 1 {
+		t.Errorf("expected 1 active conversion for the tenant, got %d", got)
+	}
+	release()
+	if got := l.Active("acme", "example.com"); got != 0 {
+		t.Errorf("expected no active conversions for the tenant, got %d", got)
+	}
+}
@@ -0,0 +1,140 @@
+// Package postgres connects to a PostgreSQL database shared by weaver
+// instances, and migrates its schema.
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Registers the 'postgres' database/sql driver
+	_ "github.com/lib/pq"
+)
+
+// lockID is the key of the advisory lock held while migrating, so that
+// instances starting at the same time do not run the same migration twice.
+const lockID = 0x77656176 // "weav"
+
+// migrations are the statements applied to the database in order. The
+// version of a migration is its index + 1. Existing migrations must never be
+// changed; append a new one instead.
+var migrations = []string{
+	// 1: job history (see history.PostgresStore)
+	`CREATE TABLE weaver_history (
+		id            TEXT PRIMARY KEY,
+		request_id    TEXT NOT NULL DEFAULT '',
+		time          TIMESTAMPTZ NOT NULL,
+		status        TEXT NOT NULL,
+		tenant        TEXT NOT NULL DEFAULT '',
+		source        TEXT NOT NULL DEFAULT '',
+		domain        TEXT NOT NULL DEFAULT '',
+		format        TEXT NOT NULL DEFAULT '',
+		engine        TEXT NOT NULL DEFAULT '',
+		code          TEXT NOT NULL DEFAULT '',
+		error         TEXT NOT NULL DEFAULT '',
+		pages         INTEGER NOT NULL DEFAULT 0,
+		bytes         BIGINT NOT NULL DEFAULT 0,
+		duration_ms   BIGINT NOT NULL DEFAULT 0,
+		queue_wait_ms BIGINT NOT NULL DEFAULT 0,
+		s3_bucket     TEXT NOT NULL DEFAULT '',
+		s3_key        TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX weaver_history_time ON weaver_history (time DESC);
+	CREATE INDEX weaver_history_tenant_time ON weaver_history (tenant, time DESC);`,
+	// 2: job queue (see queue.PostgresBroker)
+	`CREATE TABLE weaver_queue (
+		seq        BIGSERIAL PRIMARY KEY,
+		job        JSONB NOT NULL,
+		attempts   INTEGER NOT NULL DEFAULT 0,
+		visible_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX weaver_queue_visible_at ON weaver_queue (visible_at);`,
+	// 3: document registry (see registry.SQLStore)
+	`CREATE TABLE weaver_registry (
+		sha256 TEXT PRIMARY KEY,
+		time   BIGINT NOT NULL,
+		job    TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		format TEXT NOT NULL DEFAULT '',
+		pages  INTEGER NOT NULL DEFAULT 0,
+		bytes  BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE INDEX weaver_registry_tenant ON weaver_registry (tenant);`,
+	// 4: scheduled deletions of uploaded outputs (see retention.SQLStore)
+	`CREATE TABLE weaver_retention (
+		bucket TEXT NOT NULL,
+		key    TEXT NOT NULL,
+		region TEXT NOT NULL DEFAULT '',
+		due    BIGINT NOT NULL,
+		job    TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (bucket, key)
+	);
+	CREATE INDEX weaver_retention_due ON weaver_retention (due);`,
+	// 5: data subjects of jobs, and the regions of their outputs (see
+	// history.Job), and the documents of jobs (to erase them)
+	`ALTER TABLE weaver_history ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+	ALTER TABLE weaver_history ADD COLUMN s3_region TEXT NOT NULL DEFAULT '';
+	CREATE INDEX weaver_history_tenant_subject ON weaver_history (tenant, subject);
+	CREATE INDEX weaver_registry_job ON weaver_registry (job);`,
+	// 6: diagnostics of jobs (see history.Job)
+	`ALTER TABLE weaver_history ADD COLUMN diagnostics TEXT NOT NULL DEFAULT '';`,
+	// 7: jobs of uploaded outputs (to erase outputs no job references)
+	`CREATE INDEX weaver_history_s3_key ON weaver_history (s3_key, s3_bucket);`,
+	// 8: jobs of the queue that failed too many times (see
+	// queue.PostgresBroker), which are no longer claimed
+	`ALTER TABLE weaver_queue ADD COLUMN dead_at TIMESTAMPTZ;
+	DROP INDEX weaver_queue_visible_at;
+	CREATE INDEX weaver_queue_visible_at ON weaver_queue (visible_at) WHERE dead_at IS NULL;`,
+}
+
+// Open connects to the database with the data source name (e.g.
+// 'postgres://weaver:secret@db:5432/weaver?sslmode=require'), and applies
+// any pending migrations.
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the pending migrations to the database in a single
+// transaction. The applied versions are recorded in the 'weaver_migrations'
+// table.
+func Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS weaver_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM weaver_migrations").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %+v", i+1, err)
+		}
+		if _, err := tx.Exec("INSERT INTO weaver_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMigrate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Only the migrations after the recorded version are applied
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS weaver_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(len(migrations) - 1))
+	mock.ExpectExec(regexp.QuoteMeta(migrations[len(migrations)-1])).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO weaver_migrations").WithArgs(len(migrations)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate returned an unexpected error: %+v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrate_newerSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS weaver_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(len(migrations) + 1))
+	mock.ExpectRollback()
+	if err := Migrate(db); err == nil {
+		t.Errorf("expected a newer schema to return an error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestOpen applies the migrations to the disposable database named by
+// WEAVER_TEST_POSTGRES_URL, twice (as instances starting at the same time
+// would).
+func TestOpen(t *testing.T) {
+	dsn := os.Getenv("WEAVER_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("WEAVER_TEST_POSTGRES_URL is not set")
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			db, err := Open(dsn)
+			if err == nil {
+				db.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("open returned an unexpected error: %+v", err)
+		}
+	}
+
+	db, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version, n int
+	if err := db.QueryRow("SELECT MAX(version), COUNT(*) FROM weaver_migrations").Scan(&version, &n); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) || n != len(migrations) {
+		t.Errorf("expected %d migrations to be applied once, got version %d (%d applied)", len(migrations), version, n)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/breaker"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// ErrSourceTooLarge should be returned when a source that is saved locally
+// is larger than the spool quota.
+var ErrSourceTooLarge = errors.New("source is larger than the spool quota (WEAVER_SPOOL_MAX_BYTES)")
+
+// ValidationError is a problem with a conversion request found by a preflight
+// check.
+type ValidationError struct {
+	// Param is the query parameter of the invalid option (e.g. 'page_size'),
+	// if the problem is with a single option.
+	Param string `json:"param,omitempty"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// SourceInfo describes how a source URL responded to a preflight check.
+type SourceInfo struct {
+	Status        int    `json:"status"`
+	ContentType   string `json:"content_type,omitempty"`
+	ContentLength int64  `json:"content_length,omitempty"`
+}
+
+// optionParams are the query parameters of the options that errors of
+// option checks refer to.
+var optionParams = map[error]string{
+	ErrURLInvalid:              "url",
+	ErrFormatInvalid:           "format",
+	ErrChromeFlagNotAllowed:    "chrome_flag",
+	ErrBlockTypeInvalid:        "block",
+	ErrLocaleInvalid:           "locale",
+	ErrTimezoneInvalid:         "timezone",
+	ErrMarginsInvalid:          "margins",
+	ErrMediaInvalid:            "media",
+	ErrDelayInvalid:            "delay",
+	ErrRasterDPIInvalid:        "raster_dpi",
+	ErrDPIInvalid:              "dpi",
+	ErrPageSizeInvalid:         "page_size",
+	ErrProxyNotAllowed:         "proxy",
+	ErrHostMapNotAllowed:       "host_map",
+	ErrOfflineURL:              "offline",
+	ErrAsyncUnavailable:        "async",
+	ErrAsyncNoUpload:           "async",
+	ErrIncludeSourceNoUpload:   "includeSource",
+	ErrIncludeArchiveNoUpload:  "includeArchive",
+	ErrAttachmentsFormat:       "format",
+	ErrAttachmentsInvalid:      "attachment",
+	pdf.ErrAttachmentName:      "attachment",
+	pdf.ErrRelationshipInvalid: "attachment_relationship",
+	ErrSinglePageFormat:        "single_page",
+	ErrSelectInvalid:           "select",
+	ErrLinkBaseInvalid:         "link_base",
+	ErrEmailAttachmentsInvalid: "email_attachments",
+	ErrCodesInvalid:            "codes",
+	ErrCodesFormat:             "format",
+	pdf.ErrRangeInvalid:        "codes",
+	pdf.ErrPositionInvalid:     "codes",
+	pdf.ErrQRTooLong:           "codes",
+	pdf.ErrBarcodeInvalid:      "codes",
+	ErrRetentionInvalid:        "retention_days",
+	ErrRedactInvalid:           "redact",
+	ErrRedactAttachSource:      "attachSource",
+	ErrSubjectInvalid:          "subject",
+	ErrColorDisabled:           "grayscale",
+	ErrColorFormat:             "format",
+	ErrColorProfileUnknown:     "icc_profile",
+	ErrColorConflict:           "icc_profile",
+	ErrTIFFDisabled:            "format",
+	ErrOCRDisabled:             "ocr",
+	ErrOCRFormat:               "format",
+	ErrOCRLanguagesInvalid:     "ocr_languages",
+}
+
+// validationError returns the validation error of a failed check of a
+// parameter (or of the parameter the error refers to).
+func validationError(param string, err error) ValidationError {
+	if p, ok := optionParams[err]; ok {
+		param = p
+	}
+	return ValidationError{Param: param, Code: errorCode(err, http.StatusBadRequest), Error: err.Error()}
+}
+
+// PreflightRequestMiddleware decodes the JSON body of a preflight request (a
+// v2 conversion request) if it has one, and its options replace the query
+// parameters (see ConversionRequestMiddleware). Unlike conversions, invalid
+// requests are not aborted: the problems are set in the context, so that
+// they are returned with the other validation errors.
+func PreflightRequestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.ContentLength == 0 {
+			return
+		}
+		var req ConversionRequest
+		err := json.NewDecoder(c.Request.Body).Decode(&req)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			c.Set("preflight_errors", []ValidationError{validationError("", ErrRequestInvalid)})
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.Set("preflight_errors", []ValidationError{validationError("source", err)})
+		}
+		auth := c.Query("auth")
+		setRequestQuery(c, req)
+		if c.Query("auth") == "" && auth != "" {
+			q := c.Request.URL.Query()
+			q.Set("auth", auth)
+			c.Request.URL.RawQuery = q.Encode()
+		}
+		c.Set("conversion_request", req)
+	}
+}
+
+// checkSource checks that a source URL can be fetched with a HEAD request
+// (using the egress settings, and fetch timeout of the request), and that it
+// fits in the spool if it is saved locally.
+func checkSource(c *gin.Context, uri string) (*SourceInfo, *ValidationError) {
+	if b := hostBreaker(c); b != nil {
+		host := sourceDomain(uri)
+		for _, h := range b.Open() {
+			if h == host {
+				e := validationError("url", breaker.ErrOpen)
+				return nil, &e
+			}
+		}
+	}
+
+	e, err := requestEgress(c)
+	if err != nil {
+		// The egress settings are reported by the option checks
+		return nil, nil
+	}
+	client, err := e.client()
+	if err != nil {
+		v := validationError("url", err)
+		return nil, &v
+	}
+	conf := c.MustGet("config").(Config)
+	client.Timeout = time.Second * time.Duration(conf.Fetch.Timeout)
+	req, err := http.NewRequest("HEAD", uri, nil)
+	if err != nil {
+		v := validationError("url", ErrURLInvalid)
+		return nil, &v
+	}
+	res, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		v := validationError("url", err)
+		return nil, &v
+	}
+	res.Body.Close()
+
+	info := &SourceInfo{
+		Status:        res.StatusCode,
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentLength: res.ContentLength,
+	}
+	// Servers without support for HEAD requests may still be converted
+	if res.StatusCode >= 400 && res.StatusCode != http.StatusMethodNotAllowed {
+		return info, &ValidationError{
+			Param: "url",
+			Code:  CodeSourceFetchFailed,
+			Error: fmt.Sprintf("source responded with %s", res.Status),
+		}
+	}
+	// Binary sources are downloaded to the spool
+	if info.ContentType == "application/octet-stream" && conf.Spool.MaxBytes > 0 && info.ContentLength > int64(conf.Spool.MaxBytes) {
+		v := validationError("url", ErrSourceTooLarge)
+		return info, &v
+	}
+	return info, nil
+}
+
+// checkAsync checks that an asynchronous conversion can be queued.
+func checkAsync(c *gin.Context) error {
+	if _, async := c.GetQuery("async"); !async {
+		return nil
+	}
+	if _, ok := c.Get("broker"); !ok {
+		return ErrAsyncUnavailable
+	}
+	_, dedupe := c.GetQuery("s3_dedupe")
+	if c.Query("s3_bucket") == "" || (c.Query("s3_key") == "" && !dedupe) {
+		return ErrAsyncNoUpload
+	}
+	return nil
+}
+
+// preflightHandler checks the options of a conversion request without
+// converting it (or using a worker): the options are validated as they would
+// be by '/convert', the source URL is fetched with a HEAD request, and the
+// size of the source is checked. All problems are returned as validation
+// errors.
+func preflightHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	errs := []ValidationError{}
+	if e, ok := c.Get("preflight_errors"); ok {
+		errs = append(errs, e.([]ValidationError)...)
+	}
+
+	for _, check := range optionChecks {
+		if err := check(c); err != nil {
+			errs = append(errs, validationError("", err))
+		}
+	}
+	if err := checkAsync(c); err != nil {
+		errs = append(errs, validationError("", err))
+	}
+
+	var info *SourceInfo
+	var source SourceOptions
+	if req, ok := c.Get("conversion_request"); ok {
+		source = req.(ConversionRequest).Source
+	}
+	if uri := c.Query("url"); uri != "" {
+		if _, ok := c.GetQuery("offline"); ok {
+			errs = append(errs, validationError("", ErrOfflineURL))
+		}
+		var v *ValidationError
+		if info, v = checkSource(c, uri); v != nil {
+			errs = append(errs, *v)
+		}
+	} else if source.Content != "" {
+		size := len(source.Content)
+		if source.Encoding == "base64" {
+			size = base64.StdEncoding.DecodedLen(size)
+		}
+		if conf.Spool.MaxBytes > 0 && size > conf.Spool.MaxBytes {
+			errs = append(errs, validationError("source", ErrSourceTooLarge))
+		}
+	} else if _, ok := c.Get("preflight_errors"); !ok {
+		errs = append(errs, validationError("", ErrURLInvalid))
+	}
+
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	res := gin.H{"valid": len(errs) == 0, "errors": errs}
+	if info != nil {
+		res["source"] = info
+	}
+	c.JSON(status, res)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreflightHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("expected source to be fetched with a HEAD request, got %s", r.Method)
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer ts.Close()
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.Fetch.Retries = 0
+	// Without a work queue, as no conversion is made
+	r := mockRouter(conf, Services{}, InitSecureRoutes)
+
+	tests := []struct {
+		query  string
+		body   string
+		code   int
+		params []string
+	}{
+		{"&url=" + ts.URL + "&page_size=a4", "", http.StatusOK, nil},
+		{"&url=" + ts.URL + "&page_size=B5&margins=wide&async", "", http.StatusUnprocessableEntity, []string{"margins", "page_size", "async"}},
+		{"&url=" + ts.URL + "/missing", "", http.StatusUnprocessableEntity, []string{"url"}},
+		{"", "", http.StatusUnprocessableEntity, []string{"url"}},
+		{"", `{"source": {"url": "` + ts.URL + `"}, "page": {"size": "Letter"}}`, http.StatusOK, nil},
+		{"", `{"source": {"content": "<html></html>"}, "engine": {"locale": "en_GB"}}`, http.StatusUnprocessableEntity, []string{"locale"}},
+		{"", `{"source": {}}`, http.StatusUnprocessableEntity, []string{"source"}},
+		{"", `not json`, http.StatusUnprocessableEntity, []string{""}},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/convert/validate?auth=123456"+tt.query, strings.NewReader(tt.body))
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %q %s to be %d, got %d", tt.query, tt.body, want, got)
+		}
+		var body struct {
+			Valid  bool
+			Errors []ValidationError
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("unable to decode response: %+v", err)
+		}
+		var params []string
+		for _, e := range body.Errors {
+			params = append(params, e.Param)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("expected invalid params of %q %s to be %v, got %v", tt.query, tt.body, tt.params, params)
+		}
+		if body.Valid != (len(tt.params) == 0) {
+			t.Errorf("expected %q %s to be valid: %v", tt.query, tt.body, len(tt.params) == 0)
+		}
+	}
+}
+
+func TestPreflightHandler_unreachable(t *testing.T) {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	r := mockRouter(conf, Services{}, InitSecureRoutes)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/convert/validate?auth=123456&url=http://127.0.0.1:1/", nil)
+	r.ServeHTTP(res, req)
+	if !strings.Contains(res.Body.String(), CodeSourceFetchFailed) {
+		t.Errorf("expected error code to be %s, got %s", CodeSourceFetchFailed, res.Body.String())
+	}
+}
@@ -0,0 +1,156 @@
+// Package preset stores named sets of conversion options (e.g. 'invoice-a4'),
+// which conversions select with the 'preset' query parameter, so that
+// options can change without redeploying every client.
+package preset
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a preset does not exist.
+	ErrNotFound = errors.New("preset not found")
+	// ErrNameInvalid is returned when the name of a preset is invalid.
+	ErrNameInvalid = errors.New("invalid preset name provided (use at most 64 lower case letters, digits, '-', or '_')")
+	// ErrOptionsInvalid is returned when the options of a preset are
+	// invalid.
+	ErrOptionsInvalid = errors.New("invalid preset options provided (expected query parameters other than auth, and preset)")
+)
+
+// name matches valid preset names.
+var name = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Preset is a named set of conversion options.
+type Preset struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Options are the query parameters of the conversion options (e.g.
+	// 'page_size', or 'margins').
+	Options map[string]string `json:"options"`
+	Updated time.Time         `json:"updated"`
+}
+
+// Validate checks the name, and options of a preset.
+func (p Preset) Validate() error {
+	if !name.MatchString(p.Name) {
+		return ErrNameInvalid
+	}
+	for o := range p.Options {
+		if o == "" || o == "auth" || o == "preset" {
+			return ErrOptionsInvalid
+		}
+	}
+	return nil
+}
+
+// Store keeps track of presets.
+type Store struct {
+	mu      sync.RWMutex
+	presets map[string]Preset
+	path    string
+}
+
+// NewStore creates a store of presets. If a path is given, presets are
+// persisted to it as JSON, and loaded from it (if it exists).
+func NewStore(path string) (*Store, error) {
+	s := &Store{presets: make(map[string]Preset), path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var presets []Preset
+	if err := json.Unmarshal(b, &presets); err != nil {
+		return nil, err
+	}
+	for _, p := range presets {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		s.presets[p.Name] = p
+	}
+	return s, nil
+}
+
+// save persists the presets. It must be called with the lock held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, b, 0600)
+}
+
+// list returns the presets ordered by name. It must be called with the lock
+// held.
+func (s *Store) list() []Preset {
+	l := make([]Preset, 0, len(s.presets))
+	for _, p := range s.presets {
+		l = append(l, p)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
+
+// Put creates a preset, or replaces the preset with the same name. It
+// returns the preset, and true if it was created.
+func (s *Store) Put(p Preset) (Preset, bool, error) {
+	if err := p.Validate(); err != nil {
+		return Preset{}, false, err
+	}
+	if p.Options == nil {
+		p.Options = make(map[string]string)
+	}
+	p.Updated = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.presets[p.Name]
+	s.presets[p.Name] = p
+	return p, !exists, s.save()
+}
+
+// Get returns a preset by name.
+func (s *Store) Get(name string) (Preset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.presets[name]
+	if !ok {
+		return Preset{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Remove removes a preset.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.presets[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.presets, name)
+	return s.save()
+}
+
+// List returns all presets ordered by name.
+func (s *Store) List() []Preset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list()
+}
@@ -0,0 +1,76 @@
+package preset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_Put(t *testing.T) {
+	s, _ := NewStore("")
+	p, created, err := s.Put(Preset{Name: "invoice-a4", Options: map[string]string{"page_size": "A4"}})
+	if err != nil {
+		t.Fatalf("put returned an unexpected error: %+v", err)
+	}
+	if !created || p.Updated.IsZero() {
+		t.Errorf("expected preset to be created, got %+v (created: %v)", p, created)
+	}
+	if _, created, _ := s.Put(Preset{Name: "invoice-a4"}); created {
+		t.Errorf("expected preset to be replaced")
+	}
+	if got, _ := s.Get("invoice-a4"); len(got.Options) != 0 {
+		t.Errorf("expected options of the preset to be replaced, got %v", got.Options)
+	}
+}
+
+func TestStore_Put_invalid(t *testing.T) {
+	s, _ := NewStore("")
+	tests := []struct {
+		p    Preset
+		want error
+	}{
+		{Preset{Name: "Invoice A4"}, ErrNameInvalid},
+		{Preset{Name: ""}, ErrNameInvalid},
+		{Preset{Name: "invoice", Options: map[string]string{"auth": "key"}}, ErrOptionsInvalid},
+		{Preset{Name: "invoice", Options: map[string]string{"preset": "other"}}, ErrOptionsInvalid},
+	}
+	for _, tt := range tests {
+		if _, _, err := s.Put(tt.p); err != tt.want {
+			t.Errorf("expected error of %+v to be %v, got %v", tt.p, tt.want, err)
+		}
+	}
+}
+
+func TestStore_Remove(t *testing.T) {
+	s, _ := NewStore("")
+	s.Put(Preset{Name: "invoice-a4"})
+	if err := s.Remove("invoice-a4"); err != nil {
+		t.Fatalf("remove returned an unexpected error: %+v", err)
+	}
+	if err := s.Remove("invoice-a4"); err != ErrNotFound {
+		t.Errorf("expected a preset not found error, got %+v", err)
+	}
+}
+
+func TestStore_persisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preset")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "presets.json")
+
+	s, _ := NewStore(path)
+	s.Put(Preset{Name: "report-letter-landscape", Options: map[string]string{"page_size": "Letter", "no_portrait": ""}})
+	s.Put(Preset{Name: "invoice-a4", Options: map[string]string{"page_size": "A4"}})
+
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("unable to load presets: %+v", err)
+	}
+	l := s.List()
+	if len(l) != 2 || l[0].Name != "invoice-a4" || l[1].Options["page_size"] != "Letter" {
+		t.Errorf("expected presets to be loaded by name, got %+v", l)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/preset"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+var (
+	// ErrPresetUnknown should be returned when a conversion selects a
+	// preset that does not exist.
+	ErrPresetUnknown = errors.New("unknown preset provided")
+	// ErrPresetInvalid should be returned when a preset request can not be
+	// decoded.
+	ErrPresetInvalid = errors.New("invalid preset provided")
+)
+
+// PresetMiddleware applies the options of the preset selected by a
+// conversion ('preset', or the 'preset' option of the profile of its
+// tenant) that the query does not set. It must be used before the
+// ProfileMiddleware, so that the options of the preset are checked against
+// the profile as if the request had set them.
+func PresetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := c.Request.URL.Query()
+		name := q.Get("preset")
+		if t, ok := c.Get("tenant"); ok && name == "" && t.(tenant.Tenant).Profile != nil {
+			name = t.(tenant.Tenant).Profile.Options["preset"]
+		}
+		if name == "" {
+			return
+		}
+		s, ok := c.Get("presets")
+		if !ok {
+			c.AbortWithError(http.StatusBadRequest, ErrPresetUnknown).SetType(gin.ErrorTypePublic)
+			return
+		}
+		p, err := s.(*preset.Store).Get(name)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, ErrPresetUnknown).SetType(gin.ErrorTypePublic)
+			return
+		}
+		for o, v := range p.Options {
+			if _, ok := q[o]; !ok {
+				q.Set(o, v)
+			}
+		}
+		c.Request.URL.RawQuery = q.Encode()
+	}
+}
+
+// listPresetsHandler returns all presets ordered by name.
+func listPresetsHandler(c *gin.Context) {
+	s := c.MustGet("presets").(*preset.Store)
+	c.JSON(http.StatusOK, gin.H{"presets": s.List()})
+}
+
+func getPresetHandler(c *gin.Context) {
+	s := c.MustGet("presets").(*preset.Store)
+	p, err := s.Get(c.Param("name"))
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// putPresetHandler creates, or replaces the preset with the name in the
+// path.
+func putPresetHandler(c *gin.Context) {
+	s := c.MustGet("presets").(*preset.Store)
+	var p preset.Preset
+	if err := c.BindJSON(&p); err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrPresetInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	p.Name = c.Param("name")
+	p, created, err := s.Put(p)
+	switch err {
+	case nil:
+	case preset.ErrNameInvalid, preset.ErrOptionsInvalid:
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	default:
+		c.Error(err)
+		return
+	}
+	if created {
+		c.JSON(http.StatusCreated, p)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func deletePresetHandler(c *gin.Context) {
+	s := c.MustGet("presets").(*preset.Store)
+	switch err := s.Remove(c.Param("name")); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case preset.ErrNotFound:
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+	default:
+		c.Error(err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/preset"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func TestPresetHandlers(t *testing.T) {
+	s, _ := preset.NewStore("")
+	r := gin.New()
+	r.Use(ErrorMiddleware(), PresetsMiddleware(s))
+	r.GET("/presets", listPresetsHandler)
+	r.GET("/presets/:name", getPresetHandler)
+	r.PUT("/presets/:name", putPresetHandler)
+	r.DELETE("/presets/:name", deletePresetHandler)
+
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/presets/invoice-a4", `{"options": {"page_size": "A4"}}`, http.StatusCreated},
+		{"PUT", "/presets/invoice-a4", `{"options": {"page_size": "A4", "margins": "1cm"}}`, http.StatusOK},
+		{"PUT", "/presets/Invoice", `{}`, http.StatusBadRequest},
+		{"PUT", "/presets/invoice", `{"options": {"auth": "key"}}`, http.StatusBadRequest},
+		{"PUT", "/presets/invoice", `invalid`, http.StatusBadRequest},
+		{"GET", "/presets/invoice-a4", "", http.StatusOK},
+		{"GET", "/presets", "", http.StatusOK},
+		{"DELETE", "/presets/invoice-a4", "", http.StatusNoContent},
+		{"GET", "/presets/invoice-a4", "", http.StatusNotFound},
+		{"DELETE", "/presets/invoice-a4", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of %s %s to be %d, got %d: %s", tt.method, tt.path, tt.code, got, res.Body.String())
+		}
+	}
+}
+
+func TestPresetMiddleware(t *testing.T) {
+	s, _ := preset.NewStore("")
+	s.Put(preset.Preset{Name: "invoice-a4", Options: map[string]string{"page_size": "A4", "margins": "1cm"}})
+	s.Put(preset.Preset{Name: "report-letter", Options: map[string]string{"page_size": "Letter"}})
+	reg, _ := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "acme", Key: "acme-key", Profile: &tenant.Profile{Options: map[string]string{"preset": "invoice-a4", "page_size": "A4"}, Overridable: []string{"preset"}}},
+	})
+
+	r := gin.New()
+	r.Use(ConfigMiddleware(Config{AuthKey: "123456"}), PresetsMiddleware(s), TenantAuthorizationMiddleware(reg))
+	r.GET("/", PresetMiddleware(), ProfileMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "%s %s", c.Query("page_size"), c.Query("margins"))
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/?auth=123456&preset=invoice-a4", http.StatusOK, "A4 1cm"},
+		{"/?auth=123456&preset=invoice-a4&margins=2cm", http.StatusOK, "A4 2cm"},
+		{"/?auth=123456&preset=unknown", http.StatusBadRequest, ""},
+		// The preset of the profile of the tenant
+		{"/?auth=acme-key", http.StatusOK, "A4 1cm"},
+		// Presets can not override the fixed options of the profile
+		{"/?auth=acme-key&preset=report-letter", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest("GET", tt.path, nil))
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of %s to be %d, got %d", tt.path, tt.code, got)
+		}
+		if got := res.Body.String(); tt.body != "" && got != tt.body {
+			t.Errorf("expected options of %s to be %q, got %q", tt.path, tt.body, got)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package progress tracks the stages of asynchronous conversion jobs, so
+// that they can be streamed to clients while the jobs are running.
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages of a job, in the order they normally occur.
+const (
+	// Queued is set when a job has been published to a job queue.
+	Queued = "queued"
+	// Fetching is set when the source of a job is being downloaded.
+	Fetching = "fetching"
+	// Rendering is set when a worker has started converting a job.
+	Rendering = "rendering"
+	// Loaded is set when the page of a job, and its resources have loaded.
+	Loaded = "loaded"
+	// Printing is set when the output of a job has started to be generated.
+	Printing = "printing"
+	// Output is set when the output of a job has been produced (with its
+	// size).
+	Output = "output"
+	// PostProcessing is set when the output of a job is being processed
+	// further (e.g. converted to Markdown).
+	PostProcessing = "post_processing"
+	// Uploading is set when the output of a job is being uploaded.
+	Uploading = "uploading"
+	// Completed is set when a job has succeeded (it is final).
+	Completed = "completed"
+	// Failed is set when an attempt of a job has failed (it is final).
+	Failed = "failed"
+)
+
+// bufferSize is the number of updates buffered for a subscriber.
+const bufferSize = 32
+
+// Update is a stage transition of a job.
+type Update struct {
+	// Seq is the sequence number of the update (starting at 1) within the
+	// job.
+	Seq   int       `json:"seq"`
+	JobID string    `json:"job_id"`
+	Stage string    `json:"stage"`
+	Time  time.Time `json:"time"`
+	// Bytes is the size of the output produced so far (if known).
+	Bytes int    `json:"bytes,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Final returns true if no further updates follow the update (unless the
+// job is retried).
+func (u Update) Final() bool {
+	return u.Stage == Completed || u.Stage == Failed
+}
+
+type job struct {
+	tenant  string
+	updates []Update
+	subs    map[chan Update]struct{}
+}
+
+// last returns the last update of the job.
+func (j *job) last() Update {
+	return j.updates[len(j.updates)-1]
+}
+
+// Tracker keeps the updates of recent jobs in memory, and broadcasts them to
+// subscribers. It is not shared between instances.
+type Tracker struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	ttl  time.Duration
+}
+
+// NewTracker creates a tracker. Jobs are forgotten once they have not been
+// updated for the ttl.
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{jobs: make(map[string]*job), ttl: ttl}
+}
+
+// Set records a stage of a job (accounted to the tenant, if any). A final
+// stage closes the channels of the subscribers of the job.
+func (t *Tracker) Set(jobID, tenant, stage string, err error) {
+	u := Update{Stage: stage}
+	if err != nil {
+		u.Error = err.Error()
+	}
+	t.add(jobID, tenant, u)
+}
+
+// Report records a stage of a job with the size of its output so far.
+func (t *Tracker) Report(jobID, tenant, stage string, bytes int) {
+	t.add(jobID, tenant, Update{Stage: stage, Bytes: bytes})
+}
+
+func (t *Tracker) add(jobID, tenant string, u Update) {
+	now := time.Now().UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+
+	j, ok := t.jobs[jobID]
+	if !ok {
+		j = &job{tenant: tenant, subs: make(map[chan Update]struct{})}
+		t.jobs[jobID] = j
+	}
+	u.Seq, u.JobID, u.Time = len(j.updates)+1, jobID, now
+	j.updates = append(j.updates, u)
+
+	for ch := range j.subs {
+		select {
+		case ch <- u:
+		default:
+		}
+		if u.Final() {
+			close(ch)
+			delete(j.subs, ch)
+		}
+	}
+}
+
+// expire forgets the jobs that have not been updated for the ttl.
+func (t *Tracker) expire(now time.Time) {
+	for id, j := range t.jobs {
+		if len(j.subs) == 0 && now.Sub(j.last().Time) > t.ttl {
+			delete(t.jobs, id)
+		}
+	}
+}
+
+// Subscribe returns the updates of a job so far, and a channel receiving its
+// next updates. The channel is closed after a final update (it may be
+// dropped if the subscriber is too slow, so use Updates to catch up), or
+// when cancel is called. It returns false if the job is unknown, or if it is
+// not accounted to the tenant (unless the tenant is empty).
+func (t *Tracker) Subscribe(jobID, tenant string) (updates []Update, ch <-chan Update, cancel func(), ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, ok := t.jobs[jobID]
+	if !ok || (tenant != "" && j.tenant != tenant) {
+		return nil, nil, nil, false
+	}
+
+	c := make(chan Update, bufferSize)
+	updates = append([]Update(nil), j.updates...)
+	if j.last().Final() {
+		close(c)
+		return updates, c, func() {}, true
+	}
+	j.subs[c] = struct{}{}
+	cancel = func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := j.subs[c]; ok {
+			close(c)
+			delete(j.subs, c)
+		}
+	}
+	return updates, c, cancel, true
+}
+
+// Updates returns the updates of a job so far.
+func (t *Tracker) Updates(jobID string) []Update {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if j, ok := t.jobs[jobID]; ok {
+		return append([]Update(nil), j.updates...)
+	}
+	return nil
+}
+
+// Set records a stage of a job using the tracker. It does nothing if the
+// tracker is nil.
+func Set(t *Tracker, jobID, tenant, stage string, err error) {
+	if t == nil {
+		return
+	}
+	t.Set(jobID, tenant, stage, err)
+}
@@ -0,0 +1,85 @@
+package progress
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(time.Hour)
+	tr.Set("test-job", "acme", Queued, nil)
+	updates, ch, cancel, ok := tr.Subscribe("test-job", "acme")
+	if !ok {
+		t.Fatalf("expected job to be known")
+	}
+	defer cancel()
+	if got, want := len(updates), 1; got != want {
+		t.Fatalf("expected %d update, got %d", want, got)
+	}
+
+	tr.Set("test-job", "acme", Rendering, nil)
+	tr.Set("test-job", "acme", Failed, errors.New("test error"))
+	var got []Update
+	for u := range ch {
+		got = append(got, u)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 updates before the channel is closed, got %+v", got)
+	}
+	if got, want := got[1].Seq, 3; got != want {
+		t.Errorf("expected sequence number of the final update to be %d, got %d", want, got)
+	}
+	if got, want := got[1].Error, "test error"; got != want {
+		t.Errorf("expected error of the final update to be %s, got %s", want, got)
+	}
+}
+
+func TestTracker_report(t *testing.T) {
+	tr := NewTracker(time.Hour)
+	tr.Report("test-job", "", Output, 1024)
+	updates := tr.Updates("test-job")
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 update, got %+v", updates)
+	}
+	if got, want := updates[0].Bytes, 1024; got != want {
+		t.Errorf("expected output size of the update to be %d, got %d", want, got)
+	}
+}
+
+func TestTracker_subscribeFinished(t *testing.T) {
+	tr := NewTracker(time.Hour)
+	tr.Set("test-job", "", Completed, nil)
+	_, ch, _, ok := tr.Subscribe("test-job", "")
+	if !ok {
+		t.Fatalf("expected job to be known")
+	}
+	if _, open := <-ch; open {
+		t.Errorf("expected channel of a finished job to be closed")
+	}
+}
+
+func TestTracker_tenant(t *testing.T) {
+	tr := NewTracker(time.Hour)
+	tr.Set("test-job", "acme", Queued, nil)
+	if _, _, _, ok := tr.Subscribe("test-job", "globex"); ok {
+		t.Errorf("expected job of another tenant to be unknown")
+	}
+	if _, _, _, ok := tr.Subscribe("unknown-job", ""); ok {
+		t.Errorf("expected unknown job to be unknown")
+	}
+}
+
+func TestTracker_expire(t *testing.T) {
+	tr := NewTracker(0)
+	tr.Set("old-job", "", Completed, nil)
+	time.Sleep(time.Millisecond)
+	tr.Set("new-job", "", Queued, nil)
+	if got := tr.Updates("old-job"); got != nil {
+		t.Errorf("expected expired job to be forgotten, got %+v", got)
+	}
+}
+
+func TestSet_nilTracker(t *testing.T) {
+	Set(nil, "test-job", "", Queued, nil)
+}
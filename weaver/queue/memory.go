@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process broker. It is only shared between the
+// consumers of a single instance, but it follows the same at-least-once, and
+// visibility timeout semantics as a distributed broker.
+type MemoryBroker struct {
+	mu         sync.Mutex
+	jobs       chan *memoryDelivery
+	visibility time.Duration
+	closed     bool
+}
+
+// NewMemoryBroker creates a new in-process broker with a buffer of size n.
+// Publishing to a full buffer fails with ErrQueueFull. Received jobs that are
+// not acknowledged within the visibility timeout will be redelivered.
+func NewMemoryBroker(n int, visibility time.Duration) *MemoryBroker {
+	return &MemoryBroker{
+		jobs:       make(chan *memoryDelivery, n),
+		visibility: visibility,
+	}
+}
+
+type memoryDelivery struct {
+	b        *MemoryBroker
+	job      Job
+	attempts int
+	mu       sync.Mutex
+	settled  bool
+	timer    *time.Timer
+}
+
+func (d *memoryDelivery) Job() Job {
+	return d.job
+}
+
+func (d *memoryDelivery) Attempts() int {
+	return d.attempts
+}
+
+// settle marks the delivery as processed. It returns false if the delivery
+// has already been settled or its visibility timeout has expired.
+func (d *memoryDelivery) settle() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.settled {
+		return false
+	}
+	d.settled = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	return true
+}
+
+func (d *memoryDelivery) Ack() error {
+	d.settle()
+	return nil
+}
+
+func (d *memoryDelivery) Nack(delay time.Duration) error {
+	if d.settle() {
+		return d.b.requeue(d, delay)
+	}
+	return nil
+}
+
+// requeue redelivers a received job once the delay has passed. Unlike
+// published jobs, it waits for room in the buffer, since the job already
+// counted against it before it was received (so there can be no more
+// waiting than there are consumers).
+func (b *MemoryBroker) requeue(d *memoryDelivery, delay time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	r := &memoryDelivery{b: b, job: d.job, attempts: d.attempts}
+	time.AfterFunc(delay, func() {
+		b.jobs <- r
+	})
+	return nil
+}
+
+// Publish adds a job to the queue, or fails with ErrQueueFull if its buffer
+// is full.
+func (b *MemoryBroker) Publish(j Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	select {
+	case b.jobs <- &memoryDelivery{b: b, job: j}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Receive blocks until a job is available or the done channel is closed.
+func (b *MemoryBroker) Receive(done <-chan struct{}) (Delivery, error) {
+	select {
+	case <-done:
+		return nil, nil
+	case d, ok := <-b.jobs:
+		if !ok {
+			return nil, ErrBrokerClosed
+		}
+		d.attempts++
+		if b.visibility > 0 {
+			d.mu.Lock()
+			d.timer = time.AfterFunc(b.visibility, func() {
+				if d.settle() {
+					b.requeue(d, 0)
+				}
+			})
+			d.mu.Unlock()
+		}
+		return d, nil
+	}
+}
+
+// Close stops the broker from accepting new jobs.
+func (b *MemoryBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, b Broker) Delivery {
+	done := make(chan struct{})
+	timer := time.AfterFunc(time.Second, func() { close(done) })
+	defer timer.Stop()
+	d, err := b.Receive(done)
+	if err != nil {
+		t.Fatalf("receive returned an unexpected error: %+v", err)
+	}
+	if d == nil {
+		t.Fatalf("expected to receive a job before timeout")
+	}
+	return d
+}
+
+func TestMemoryBroker_Publish(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	if err := b.Publish(Job{ID: "test-job"}); err != nil {
+		t.Fatalf("publish returned an unexpected error: %+v", err)
+	}
+	d := receive(t, b)
+	if got, want := d.Job().ID, "test-job"; got != want {
+		t.Errorf("expected received job ID to be %s, got %s", want, got)
+	}
+	if got, want := d.Attempts(), 1; got != want {
+		t.Errorf("expected delivery attempts to be %d, got %d", want, got)
+	}
+}
+
+func TestMemoryBroker_Nack(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	b.Publish(Job{ID: "test-job"})
+	if err := receive(t, b).Nack(0); err != nil {
+		t.Fatalf("nack returned an unexpected error: %+v", err)
+	}
+	if got, want := receive(t, b).Attempts(), 2; got != want {
+		t.Errorf("expected redelivery attempts to be %d, got %d", want, got)
+	}
+}
+
+func TestMemoryBroker_NackDelay(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	b.Publish(Job{ID: "test-job"})
+	receive(t, b).Nack(time.Millisecond * 50)
+	done := make(chan struct{})
+	time.AfterFunc(time.Millisecond*10, func() { close(done) })
+	if d, _ := b.Receive(done); d != nil {
+		t.Errorf("expected job not to be redelivered before its delay")
+	}
+	if got, want := receive(t, b).Attempts(), 2; got != want {
+		t.Errorf("expected redelivery attempts to be %d, got %d", want, got)
+	}
+}
+
+func TestMemoryBroker_full(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	if err := b.Publish(Job{ID: "first-job"}); err != nil {
+		t.Fatalf("publish returned an unexpected error: %+v", err)
+	}
+	if err := b.Publish(Job{ID: "second-job"}); err != ErrQueueFull {
+		t.Errorf("expected a queue full error, got %+v", err)
+	}
+	receive(t, b)
+	if err := b.Publish(Job{ID: "second-job"}); err != nil {
+		t.Errorf("expected publish to succeed once a job is received, got %+v", err)
+	}
+}
+
+func TestMemoryBroker_visibilityTimeout(t *testing.T) {
+	b := NewMemoryBroker(1, time.Millisecond*10)
+	b.Publish(Job{ID: "test-job"})
+	receive(t, b)
+	d := receive(t, b)
+	if got, want := d.Job().ID, "test-job"; got != want {
+		t.Errorf("expected redelivered job ID to be %s, got %s", want, got)
+	}
+}
+
+func TestMemoryBroker_Ack(t *testing.T) {
+	b := NewMemoryBroker(1, time.Millisecond*10)
+	b.Publish(Job{ID: "test-job"})
+	receive(t, b).Ack()
+	done := make(chan struct{})
+	time.AfterFunc(time.Millisecond*50, func() { close(done) })
+	if d, _ := b.Receive(done); d != nil {
+		t.Errorf("expected acknowledged job not to be redelivered")
+	}
+}
+
+func TestMemoryBroker_Close(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	b.Close()
+	if err := b.Publish(Job{}); err != ErrBrokerClosed {
+		t.Errorf("expected a broker closed error, got %+v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// PostgresBroker is a broker backed by the 'weaver_queue' table of a
+// PostgreSQL database (see the postgres package). It can be shared by any
+// number of weaver instances.
+type PostgresBroker struct {
+	db *sql.DB
+	// Visibility is the duration a received job is hidden from other
+	// consumers. It should be greater than the worker timeout.
+	Visibility time.Duration
+	// PollInterval is the duration to wait for before polling an empty
+	// queue again.
+	PollInterval time.Duration
+	// MaxAttempts is the number of times a job is received before it is
+	// dead-lettered, or 0 to receive it until it is acknowledged. This
+	// limits the jobs whose consumers never settle them (e.g. a job that
+	// crashes the instance), since their visibility timeout expires.
+	MaxAttempts int
+}
+
+// NewPostgresBroker creates a new broker using a migrated database.
+func NewPostgresBroker(db *sql.DB, visibility time.Duration) *PostgresBroker {
+	return &PostgresBroker{
+		db:           db,
+		Visibility:   visibility,
+		PollInterval: time.Second,
+	}
+}
+
+// postgresDelivery is a claimed job. The number of attempts identifies the
+// delivery, so that a consumer whose visibility timeout has expired does not
+// settle the redelivered job.
+type postgresDelivery struct {
+	b        *PostgresBroker
+	seq      int64
+	job      Job
+	attempts int
+}
+
+func (d *postgresDelivery) Job() Job {
+	return d.job
+}
+
+func (d *postgresDelivery) Attempts() int {
+	return d.attempts
+}
+
+func (d *postgresDelivery) Ack() error {
+	_, err := d.b.db.Exec("DELETE FROM weaver_queue WHERE seq = $1 AND attempts = $2", d.seq, d.attempts)
+	return err
+}
+
+// Nack makes the job visible again once the delay has passed, which should
+// grow with the attempts (see the consumer), so that a failing job is not
+// claimed again straight away.
+func (d *postgresDelivery) Nack(delay time.Duration) error {
+	_, err := d.b.db.Exec("UPDATE weaver_queue SET visible_at = now() + $3 * interval '1 millisecond' WHERE seq = $1 AND attempts = $2", d.seq, d.attempts, int64(delay/time.Millisecond))
+	return err
+}
+
+// Publish adds a job to the queue.
+func (b *PostgresBroker) Publish(j Job) error {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec("INSERT INTO weaver_queue (job) VALUES ($1)", body)
+	return err
+}
+
+// Receive claims the oldest visible job. If the queue is empty, it waits for
+// the poll interval, and returns a nil delivery.
+//
+// A job that has already been received MaxAttempts times is dead-lettered
+// instead: it is kept in the table (with its 'dead_at' time) for inspection,
+// but it is never claimed again, and a nil delivery is returned.
+func (b *PostgresBroker) Receive(done <-chan struct{}) (Delivery, error) {
+	d := &postgresDelivery{b: b}
+	var body []byte
+	var dead bool
+	err := b.db.QueryRow(`UPDATE weaver_queue
+		SET attempts = CASE WHEN $2 > 0 AND attempts >= $2 THEN attempts ELSE attempts + 1 END,
+			dead_at = CASE WHEN $2 > 0 AND attempts >= $2 THEN now() END,
+			visible_at = now() + $1 * interval '1 millisecond'
+		WHERE seq = (
+			SELECT seq FROM weaver_queue WHERE visible_at <= now() AND dead_at IS NULL
+			ORDER BY seq FOR UPDATE SKIP LOCKED LIMIT 1
+		)
+		RETURNING seq, job, attempts, dead_at IS NOT NULL`,
+		int64(b.Visibility/time.Millisecond), b.MaxAttempts,
+	).Scan(&d.seq, &body, &d.attempts, &dead)
+	if err == sql.ErrNoRows {
+		select {
+		case <-done:
+		case <-time.After(b.PollInterval):
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dead {
+		return nil, nil
+	}
+	if err := json.Unmarshal(body, &d.job); err != nil {
+		// Malformed jobs can never be processed, so they are removed
+		d.Ack()
+		return nil, err
+	}
+	return d, nil
+}
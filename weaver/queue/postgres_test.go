@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lachee/athenapdf/weaver/postgres"
+)
+
+// testPostgres returns a migrated database with an empty queue. The tests
+// using it require a disposable database, named by its data source name in
+// WEAVER_TEST_POSTGRES_URL, and are skipped without one.
+func testPostgres(t *testing.T) *sql.DB {
+	dsn := os.Getenv("WEAVER_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("WEAVER_TEST_POSTGRES_URL is not set")
+	}
+	db, err := postgres.Open(dsn)
+	if err != nil {
+		t.Fatalf("unable to open test database: %+v", err)
+	}
+	if _, err := db.Exec("TRUNCATE weaver_queue"); err != nil {
+		t.Fatalf("unable to empty queue: %+v", err)
+	}
+	return db
+}
+
+func queueLength(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM weaver_queue").Scan(&n); err != nil {
+		t.Fatalf("unable to count queued jobs: %+v", err)
+	}
+	return n
+}
+
+func TestPostgresBroker_Publish(t *testing.T) {
+	db := testPostgres(t)
+	defer db.Close()
+	b := NewPostgresBroker(db, time.Minute)
+	if err := b.Publish(Job{ID: "test-job"}); err != nil {
+		t.Fatalf("publish returned an unexpected error: %+v", err)
+	}
+	d := receive(t, b)
+	if got, want := d.Job().ID, "test-job"; got != want {
+		t.Errorf("expected received job ID to be %s, got %s", want, got)
+	}
+	if got, want := d.Attempts(), 1; got != want {
+		t.Errorf("expected delivery attempts to be %d, got %d", want, got)
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("ack returned an unexpected error: %+v", err)
+	}
+	if got := queueLength(t, db); got != 0 {
+		t.Errorf("expected acknowledged job to be removed, got %d queued jobs", got)
+	}
+}
+
+func TestPostgresBroker_concurrentClaims(t *testing.T) {
+	db := testPostgres(t)
+	defer db.Close()
+	const jobs = 50
+	for i := 0; i < jobs; i++ {
+		NewPostgresBroker(db, time.Minute).Publish(Job{ID: fmt.Sprintf("job-%d", i)})
+	}
+
+	// Consumers of separate instances claim jobs until the queue is empty
+	var mu sync.Mutex
+	received := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := NewPostgresBroker(db, time.Minute)
+			b.PollInterval = time.Millisecond
+			for {
+				d, err := b.Receive(nil)
+				if err != nil {
+					t.Errorf("receive returned an unexpected error: %+v", err)
+					return
+				}
+				if d == nil {
+					return
+				}
+				mu.Lock()
+				received[d.Job().ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(received); got != jobs {
+		t.Errorf("expected %d jobs to be claimed, got %d", jobs, got)
+	}
+	for id, n := range received {
+		if n != 1 {
+			t.Errorf("expected job %s to be claimed once, got %d claims", id, n)
+		}
+	}
+}
+
+func TestPostgresBroker_Nack(t *testing.T) {
+	db := testPostgres(t)
+	defer db.Close()
+	b := NewPostgresBroker(db, time.Minute)
+	b.Publish(Job{ID: "test-job"})
+	if err := receive(t, b).Nack(0); err != nil {
+		t.Fatalf("nack returned an unexpected error: %+v", err)
+	}
+	if got, want := receive(t, b).Attempts(), 2; got != want {
+		t.Errorf("expected redelivery attempts to be %d, got %d", want, got)
+	}
+}
+
+func TestPostgresBroker_visibilityTimeout(t *testing.T) {
+	db := testPostgres(t)
+	defer db.Close()
+	b := NewPostgresBroker(db, time.Millisecond*100)
+	b.PollInterval = time.Millisecond * 10
+	b.Publish(Job{ID: "test-job"})
+	expired := receive(t, b)
+	time.Sleep(time.Millisecond * 200)
+	d := receive(t, b)
+	if got, want := d.Attempts(), 2; got != want {
+		t.Fatalf("expected redelivery attempts to be %d, got %d", want, got)
+	}
+
+	// The consumer whose visibility timeout expired no longer settles the job
+	expired.Ack()
+	if got := queueLength(t, db); got != 1 {
+		t.Fatalf("expected redelivered job to be kept, got %d queued jobs", got)
+	}
+	d.Ack()
+	if got := queueLength(t, db); got != 0 {
+		t.Errorf("expected redelivered job to be removed, got %d queued jobs", got)
+	}
+}
+
+func TestPostgresBroker_MaxAttempts(t *testing.T) {
+	db := testPostgres(t)
+	defer db.Close()
+	b := NewPostgresBroker(db, time.Minute)
+	b.PollInterval = time.Millisecond * 10
+	b.MaxAttempts = 2
+	b.Publish(Job{ID: "test-job"})
+	receive(t, b).Nack(0)
+	receive(t, b).Nack(0)
+
+	// The job is dead-lettered, but kept
+	if d, err := b.Receive(nil); d != nil || err != nil {
+		t.Fatalf("expected no delivery of a dead-lettered job, got %+v (%+v)", d, err)
+	}
+	if d, _ := b.Receive(nil); d != nil {
+		t.Errorf("expected dead-lettered job not to be redelivered")
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM weaver_queue WHERE dead_at IS NOT NULL AND attempts = 2").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected 1 dead-lettered job, got %d (%+v)", n, err)
+	}
+}
+
+func TestPostgresBroker_Receive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	b := NewPostgresBroker(db, time.Minute)
+	b.PollInterval = time.Millisecond
+
+	b.MaxAttempts = 5
+
+	mock.ExpectQuery("UPDATE weaver_queue").
+		WithArgs(int64(60000), 5).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "job", "attempts", "dead"}).AddRow(7, []byte(`{"id":"test-job"}`), 3, false))
+	d := receive(t, b)
+	if got, want := d.Job().ID, "test-job"; got != want {
+		t.Errorf("expected received job ID to be %s, got %s", want, got)
+	}
+
+	// Deliveries are settled only while they are the current one
+	mock.ExpectExec("UPDATE weaver_queue SET visible_at = now\\(\\) \\+ \\$3 \\* interval '1 millisecond' WHERE seq = \\$1 AND attempts = \\$2").
+		WithArgs(int64(7), 3, int64(10000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := d.Nack(10 * time.Second); err != nil {
+		t.Errorf("nack returned an unexpected error: %+v", err)
+	}
+	mock.ExpectExec("DELETE FROM weaver_queue WHERE seq = \\$1 AND attempts = \\$2").
+		WithArgs(int64(7), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := d.Ack(); err != nil {
+		t.Errorf("ack returned an unexpected error: %+v", err)
+	}
+
+	// Empty queue
+	mock.ExpectQuery("UPDATE weaver_queue").WillReturnError(sql.ErrNoRows)
+	if d, err := b.Receive(nil); d != nil || err != nil {
+		t.Errorf("expected no delivery from an empty queue, got %+v (%+v)", d, err)
+	}
+
+	// Jobs received too many times are dead-lettered
+	mock.ExpectQuery("UPDATE weaver_queue").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "job", "attempts", "dead"}).AddRow(9, []byte(`{"id":"failing-job"}`), 5, true))
+	if d, err := b.Receive(nil); d != nil || err != nil {
+		t.Errorf("expected no delivery of a dead-lettered job, got %+v (%+v)", d, err)
+	}
+
+	// Malformed jobs are removed
+	mock.ExpectQuery("UPDATE weaver_queue").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "job", "attempts", "dead"}).AddRow(8, []byte(`{`), 1, false))
+	mock.ExpectExec("DELETE FROM weaver_queue").
+		WithArgs(int64(8), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := b.Receive(nil); err == nil {
+		t.Errorf("expected malformed job to return an error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package queue provides a shared job queue (broker) for distributing
+// asynchronous conversion jobs across multiple weaver instances.
+package queue
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/notify"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"github.com/lachee/athenapdf/weaver/politeness"
+)
+
+var (
+	// ErrBrokerClosed should be returned when a broker can no longer publish
+	// or receive jobs.
+	ErrBrokerClosed = errors.New("queue broker closed")
+	// ErrUnknownDriver should be returned when a broker is requested for an
+	// unsupported driver.
+	ErrUnknownDriver = errors.New("unknown queue driver")
+	// ErrQueueFull should be returned when a broker cannot accept more jobs.
+	ErrQueueFull = errors.New("queue is full")
+)
+
+// Job represents an asynchronous conversion job. It contains everything a
+// consumer needs to run the conversion on any instance, and as such, it must
+// be serialisable.
+type Job struct {
+	ID            string          `json:"id"`
+	URL           string          `json:"url"`
+	Ext           string          `json:"ext,omitempty"`
+	Aggressive    bool            `json:"aggressive,omitempty"`
+	WaitForStatus bool            `json:"wait_for_status,omitempty"`
+	NoPortrait    bool            `json:"no_portrait,omitempty"`
+	PageSize      string          `json:"page_size,omitempty"`
+	SinglePage    bool            `json:"single_page,omitempty"`
+	Select        string          `json:"select,omitempty"`
+	LinkBase      string          `json:"link_base,omitempty"`
+	StripLinks    bool            `json:"strip_external_links,omitempty"`
+	RepeatHeaders bool            `json:"repeat_table_headers,omitempty"`
+	AvoidBreak    []string        `json:"avoid_break,omitempty"`
+	BreakBefore   []string        `json:"break_before,omitempty"`
+	BreakAfter    []string        `json:"break_after,omitempty"`
+	Margins       string          `json:"margins,omitempty"`
+	Media         string          `json:"media,omitempty"`
+	Delay         int             `json:"delay,omitempty"`
+	RasterDPI     int             `json:"raster_dpi,omitempty"`
+	SnapshotMedia bool            `json:"snapshot_media,omitempty"`
+	DPI           int             `json:"dpi,omitempty"`
+	Format        string          `json:"format,omitempty"`
+	ChromeFlags   []string        `json:"chrome_flags,omitempty"`
+	Block         []string        `json:"block,omitempty"`
+	BlockURLs     []string        `json:"block_urls,omitempty"`
+	Locale        string          `json:"locale,omitempty"`
+	Timezone      string          `json:"timezone,omitempty"`
+	AWSS3         converter.AWSS3 `json:"aws_s3"`
+	// Proxy is the HOST:PORT of an allowed proxy (see Config.Proxy), so
+	// that credentials are not stored in the queue.
+	Proxy string `json:"proxy,omitempty"`
+	// HostMap contains the requested host mappings (see Config.Hosts).
+	HostMap map[string]string `json:"host_map,omitempty"`
+	// Tenant is the ID of the tenant the job is accounted to (if any).
+	Tenant string `json:"tenant,omitempty"`
+	// Subject identifies the person the document is about (if any), so that
+	// their data can be erased.
+	Subject string `json:"subject,omitempty"`
+	// RequestID is the ID of the request that published the job (if any).
+	RequestID string `json:"request_id,omitempty"`
+	// IncludeSource stores the rendered source (DOM) of the page next to the
+	// output (see converter.UploadSource).
+	IncludeSource bool `json:"include_source,omitempty"`
+	// IncludeArchive records the network requests, and responses of the
+	// render as a WARC archive next to the output (see
+	// converter.UploadArchive).
+	IncludeArchive bool `json:"include_archive,omitempty"`
+	// Attachments are embedded in the output (see pdf.Attach), with the
+	// rendered source (DOM) if AttachSource is set.
+	Attachments  []pdf.Attachment `json:"attachments,omitempty"`
+	AttachSource bool             `json:"attach_source,omitempty"`
+	// OCR adds a text layer to the pages of the output without text (see
+	// ocr.OCR), in OCRLanguages (or the configured languages if empty).
+	OCR          bool   `json:"ocr,omitempty"`
+	OCRLanguages string `json:"ocr_languages,omitempty"`
+	// Grayscale, and ICCProfile convert the colors of the output (see
+	// recolor.Recolor), to grayscale, or to the named ICC profile.
+	Grayscale  bool   `json:"grayscale,omitempty"`
+	ICCProfile string `json:"icc_profile,omitempty"`
+	// Codes are the QR codes, and barcodes placed on the output, as a JSON
+	// array of stamps (see 'codes').
+	Codes string `json:"codes,omitempty"`
+	// Notify are the targets the output is announced to once it has been
+	// uploaded (see notify.Registry).
+	Notify []notify.Target `json:"notify,omitempty"`
+	// Redact are the names of the redactions of the page (see
+	// Config.Redaction), comma-separated.
+	Redact string `json:"redact,omitempty"`
+	// HostLimit is the limit of the conversions of the source host of the
+	// tenant (if it has its own), or nil for the default limit.
+	HostLimit *politeness.Limit `json:"host_limit,omitempty"`
+}
+
+// Delivery is a job received from a broker. A delivery must be acknowledged
+// once the job has been processed successfully, otherwise it will be
+// redelivered (to any consumer) once its visibility timeout expires.
+type Delivery interface {
+	// Job returns the job contained in the delivery.
+	Job() Job
+	// Attempts returns the number of times the job has been received,
+	// including the current delivery.
+	Attempts() int
+	// Ack removes the job from the broker.
+	Ack() error
+	// Nack releases the job back to the broker for redelivery once the
+	// delay has passed.
+	Nack(delay time.Duration) error
+}
+
+// Broker is a shared queue of conversion jobs. Jobs are delivered at least
+// once, so consumers must be able to handle duplicate deliveries.
+type Broker interface {
+	// Publish adds a job to the queue.
+	Publish(Job) error
+	// Receive blocks until a job is available or the done channel is closed.
+	// It may return a nil delivery if no job was received.
+	Receive(done <-chan struct{}) (Delivery, error)
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+const (
+	// StatusCompleted indicates that a job has been converted, and uploaded.
+	StatusCompleted = "completed"
+	// StatusFailed indicates that an attempt to process a job has failed.
+	StatusFailed = "failed"
+)
+
+// Event is published when a consumer has finished processing a job.
+type Event struct {
+	JobID    string    `json:"job_id"`
+	Status   string    `json:"status"`
+	URL      string    `json:"url"`
+	S3Bucket string    `json:"s3_bucket,omitempty"`
+	S3Key    string    `json:"s3_key,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+	// Metadata of a completed job (durations are in milliseconds).
+	ConversionDuration int64 `json:"conversion_duration,omitempty"`
+	QueueWait          int64 `json:"queue_wait,omitempty"`
+	PageCount          int   `json:"page_count,omitempty"`
+	OutputBytes        int   `json:"output_bytes,omitempty"`
+	// OutputSHA256 is the hex SHA-256 digest of the output.
+	OutputSHA256 string `json:"output_sha256,omitempty"`
+	// Diagnostics of a failed job, if athenapdf CLI failed: its exit code,
+	// and the last of its standard error (see gcmd.MaxStderr).
+	ExitCode int    `json:"exit_code,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	// Diagnostics are the problems of the page seen while it was rendered
+	// (e.g. console errors, and failed subresource loads), of a completed,
+	// or failed job.
+	Diagnostics []converter.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// NewEvent creates an event for a processed job. The status is derived from
+// the processing error, and the metadata is set from the report of a
+// completed job (and the diagnostics from the report of any job).
+func NewEvent(j Job, attempts int, r *converter.Report, err error) Event {
+	e := Event{
+		JobID:    j.ID,
+		Status:   StatusCompleted,
+		URL:      j.URL,
+		S3Bucket: j.AWSS3.S3Bucket,
+		S3Key:    j.AWSS3.S3Key,
+		Attempts: attempts,
+		Time:     time.Now().UTC(),
+	}
+	if r != nil {
+		e.Diagnostics = r.Diagnostics
+	}
+	if err != nil {
+		e.Status = StatusFailed
+		e.Error = err.Error()
+		if x, ok := err.(*gcmd.ExitError); ok {
+			e.Error = x.Err.Error()
+			e.ExitCode = x.ExitCode
+			e.Stderr = x.Stderr
+		}
+		return e
+	}
+	if r != nil {
+		e.ConversionDuration = int64(r.Duration / time.Millisecond)
+		e.QueueWait = int64(r.QueueWait / time.Millisecond)
+		e.PageCount = r.Pages
+		e.OutputBytes = r.Bytes
+		e.OutputSHA256 = r.SHA256
+	}
+	return e
+}
+
+// Notifier publishes job events.
+type Notifier interface {
+	Notify(Event) error
+}
+
+// SNSNotifier publishes job events as JSON messages to an Amazon SNS topic.
+type SNSNotifier struct {
+	svc *sns.SNS
+	// TopicARN is the ARN of the SNS topic.
+	TopicARN string
+}
+
+// NewSNSNotifier creates a new SNS notifier for the topic in the given region.
+// Credentials are resolved using the default AWS credential chain.
+func NewSNSNotifier(region, topicARN string) *SNSNotifier {
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	return &SNSNotifier{
+		svc:      sns.New(sess),
+		TopicARN: topicARN,
+	}
+}
+
+// Notify publishes an event to the SNS topic. The event status is set as a
+// message attribute so that subscribers can filter on it.
+func (n *SNSNotifier) Notify(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = n.svc.Publish(&sns.PublishInput{
+		TopicArn: aws.String(n.TopicARN),
+		Message:  aws.String(string(b)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"status": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(e.Status),
+			},
+		},
+	})
+	return err
+}
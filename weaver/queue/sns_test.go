@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+func TestNewEvent(t *testing.T) {
+	j := Job{ID: "test-job", URL: "http://example.com"}
+	j.AWSS3.S3Bucket = "test-bucket"
+	j.AWSS3.S3Key = "test-key"
+	e := NewEvent(j, 1, &converter.Report{Pages: 3, Bytes: 1024, Duration: time.Second}, nil)
+	if got, want := e.Status, StatusCompleted; got != want {
+		t.Errorf("expected event status to be %s, got %s", want, got)
+	}
+	if got, want := e.PageCount, 3; got != want {
+		t.Errorf("expected event page count to be %d, got %d", want, got)
+	}
+	if got, want := e.ConversionDuration, int64(1000); got != want {
+		t.Errorf("expected event conversion duration to be %d, got %d", want, got)
+	}
+	if got, want := e.S3Key, "test-key"; got != want {
+		t.Errorf("expected event S3 key to be %s, got %s", want, got)
+	}
+}
+
+func TestNewEvent_failed(t *testing.T) {
+	e := NewEvent(Job{ID: "test-job"}, 2, nil, errors.New("test error"))
+	if got, want := e.Status, StatusFailed; got != want {
+		t.Errorf("expected event status to be %s, got %s", want, got)
+	}
+	if got, want := e.Error, "test error"; got != want {
+		t.Errorf("expected event error to be %s, got %s", want, got)
+	}
+	if got, want := e.Attempts, 2; got != want {
+		t.Errorf("expected event attempts to be %d, got %d", want, got)
+	}
+}
+
+func TestNewEvent_diagnostics(t *testing.T) {
+	r := &converter.Report{Diagnostics: []converter.Diagnostic{{Type: converter.DiagnosticConsole, Message: "app failed to start"}}}
+	e := NewEvent(Job{ID: "test-job"}, 1, r, errors.New("test error"))
+	if len(e.Diagnostics) != 1 || e.Diagnostics[0].Message != "app failed to start" {
+		t.Errorf("expected the diagnostics of the failed job, got %+v", e.Diagnostics)
+	}
+}
+
+func TestNewEvent_exitError(t *testing.T) {
+	err := &gcmd.ExitError{Err: errors.New("exit status 1"), ExitCode: 1, Stderr: "net::ERR_NAME_NOT_RESOLVED"}
+	e := NewEvent(Job{ID: "test-job"}, 1, nil, err)
+	if got, want := e.Error, "exit status 1"; got != want {
+		t.Errorf("expected event error to be %s, got %s", want, got)
+	}
+	if got, want := e.ExitCode, 1; got != want {
+		t.Errorf("expected event exit code to be %d, got %d", want, got)
+	}
+	if got, want := e.Stderr, "net::ERR_NAME_NOT_RESOLVED"; got != want {
+		t.Errorf("expected event stderr to be %s, got %s", want, got)
+	}
+}
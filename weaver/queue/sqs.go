@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// maxVisibility is the maximum visibility timeout of an SQS message.
+const maxVisibility = 12 * time.Hour
+
+// SQSBroker is a broker backed by an Amazon SQS queue. It can be shared by
+// any number of weaver instances.
+type SQSBroker struct {
+	svc *sqs.SQS
+	// QueueURL is the URL of the SQS queue.
+	QueueURL string
+	// VisibilityTimeout is the number of seconds a received job is hidden
+	// from other consumers. It should be greater than the worker timeout.
+	VisibilityTimeout int64
+	// WaitTime is the number of seconds to long poll for (max. 20).
+	WaitTime int64
+}
+
+// NewSQSBroker creates a new SQS broker for the queue URL in the given region.
+// Credentials are resolved using the default AWS credential chain.
+func NewSQSBroker(region, queueURL string, visibilityTimeout int64) *SQSBroker {
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	return &SQSBroker{
+		svc:               sqs.New(sess),
+		QueueURL:          queueURL,
+		VisibilityTimeout: visibilityTimeout,
+		WaitTime:          20,
+	}
+}
+
+type sqsDelivery struct {
+	b        *SQSBroker
+	job      Job
+	attempts int
+	receipt  *string
+}
+
+func (d *sqsDelivery) Job() Job {
+	return d.job
+}
+
+func (d *sqsDelivery) Attempts() int {
+	return d.attempts
+}
+
+func (d *sqsDelivery) Ack() error {
+	_, err := d.b.svc.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(d.b.QueueURL),
+		ReceiptHandle: d.receipt,
+	})
+	return err
+}
+
+// Nack makes the message visible again once the delay has passed (at most
+// 12 hours, the maximum visibility timeout of SQS).
+func (d *sqsDelivery) Nack(delay time.Duration) error {
+	if delay > maxVisibility {
+		delay = maxVisibility
+	}
+	_, err := d.b.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(d.b.QueueURL),
+		ReceiptHandle:     d.receipt,
+		VisibilityTimeout: aws.Int64(int64(delay / time.Second)),
+	})
+	return err
+}
+
+// Publish sends a job to the SQS queue as a JSON message.
+func (b *SQSBroker) Publish(j Job) error {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = b.svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(b.QueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// Receive long polls the SQS queue for a single job. It returns a nil
+// delivery if no job was received before the poll expired.
+func (b *SQSBroker) Receive(done <-chan struct{}) (Delivery, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := b.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(b.QueueURL),
+		MaxNumberOfMessages: aws.Int64(1),
+		VisibilityTimeout:   aws.Int64(b.VisibilityTimeout),
+		WaitTimeSeconds:     aws.Int64(b.WaitTime),
+		AttributeNames:      []*string{aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount)},
+	})
+	if err != nil {
+		select {
+		case <-done:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	if len(res.Messages) == 0 {
+		return nil, nil
+	}
+
+	m := res.Messages[0]
+	d := &sqsDelivery{b: b, receipt: m.ReceiptHandle, attempts: 1}
+	if n, ok := m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]; ok {
+		d.attempts, _ = strconv.Atoi(aws.StringValue(n))
+	}
+	if err := json.Unmarshal([]byte(aws.StringValue(m.Body)), &d.job); err != nil {
+		// Malformed messages can never be processed, so they are removed
+		d.Ack()
+		return nil, err
+	}
+	// Messages produced outside of weaver may not have a job ID
+	if d.job.ID == "" {
+		d.job.ID = aws.StringValue(m.MessageId)
+	}
+	return d, nil
+}
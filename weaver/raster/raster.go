@@ -0,0 +1,120 @@
+// Package raster rasterizes PDF documents with Ghostscript, to multi-page
+// TIFF images for systems that cannot ingest PDF (e.g. fax, and archival
+// systems), and sets the resolution of raster images.
+package raster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+// ErrNotPNG is returned when an image is not a valid PNG image.
+var ErrNotPNG = errors.New("invalid PNG image")
+
+// pngSignature is the signature at the start of PNG images.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// TIFF converts PDF documents to multi-page TIFF images, with an image for
+// every page, in black, and white, compressed with CCITT Group 4.
+type TIFF struct {
+	// Ghostscript is the Ghostscript command, e.g. 'gs'.
+	Ghostscript string
+	// Resolution is the resolution of the images in DPI, e.g. '204x196' (the
+	// fine resolution of fax), or '300'.
+	Resolution string
+	// Dir is the directory of the temporary files. Defaults to the system
+	// temporary directory.
+	Dir string
+}
+
+// ValidResolution returns true if a resolution is a positive number of DPI,
+// or a horizontal, and a vertical number of DPI joined by 'x' (e.g.
+// '204x196').
+func ValidResolution(s string) bool {
+	parts := strings.Split(s, "x")
+	if len(parts) > 2 {
+		return false
+	}
+	for _, p := range parts {
+		if n, err := strconv.Atoi(p); err != nil || n <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert returns the TIFF image of a PDF document.
+func (t TIFF) Convert(b []byte, done <-chan struct{}) ([]byte, error) {
+	dir, err := ioutil.TempDir(t.Dir, "raster")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.pdf"), filepath.Join(dir, "out.tiff")
+	if err := ioutil.WriteFile(in, b, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := append(strings.Fields(t.Ghostscript),
+		"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=tiffg4", "-r"+t.Resolution,
+		"-sOutputFile="+out, in)
+	if _, err := gcmd.Execute(cmd, done); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(out)
+}
+
+// SetPNGResolution returns a PNG image with its resolution (the pHYs chunk)
+// set to a number of DPI, so that it is printed at the size it was rendered
+// for. An existing resolution is replaced.
+func SetPNGResolution(b []byte, dpi int) ([]byte, error) {
+	if len(b) < len(pngSignature) || !bytes.Equal(b[:len(pngSignature)], pngSignature) {
+		return nil, ErrNotPNG
+	}
+	// pixels per meter (in both directions), and the unit (meters)
+	data := make([]byte, 9)
+	ppm := uint32(math.Round(float64(dpi) / 0.0254))
+	binary.BigEndian.PutUint32(data[0:], ppm)
+	binary.BigEndian.PutUint32(data[4:], ppm)
+	data[8] = 1
+
+	out := append([]byte{}, pngSignature...)
+	for i := len(pngSignature); i+8 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(b) {
+			return nil, ErrNotPNG
+		}
+		typ := string(b[i+4 : i+8])
+		if typ != "pHYs" {
+			out = append(out, b[i:end]...)
+		}
+		// The chunk must come before the image data, so it follows the header
+		if typ == "IHDR" {
+			out = appendChunk(out, "pHYs", data)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// appendChunk appends a PNG chunk (its length, type, data, and CRC).
+func appendChunk(b []byte, typ string, data []byte) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	b = append(b, n[:]...)
+	start := len(b)
+	b = append(append(b, typ...), data...)
+	binary.BigEndian.PutUint32(n[:], crc32.ChecksumIEEE(b[start:]))
+	return append(b, n[:]...)
+}
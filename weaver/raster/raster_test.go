@@ -0,0 +1,70 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	gs := filepath.Join(dir, "gs")
+	script := "echo \"$@\" > " + args + "\nfor p; do case $p in -sOutputFile=*) out=${p#-sOutputFile=};; esac; done\necho II > \"$out\"\n"
+	if err := ioutil.WriteFile(gs, []byte(script), 0600); err != nil {
+		t.Fatalf("unable to write Ghostscript stub: %+v", err)
+	}
+
+	r := TIFF{Ghostscript: "sh " + gs, Resolution: "204x196", Dir: dir}
+	out, err := r.Convert([]byte("%PDF-1.4"), make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to convert to TIFF: %+v", err)
+	}
+	if got, want := string(out), "II\n"; got != want {
+		t.Errorf("expected the output of Ghostscript to be returned, got %q", got)
+	}
+	b, _ := ioutil.ReadFile(args)
+	if !strings.Contains(string(b), "-sDEVICE=tiffg4 -r204x196") {
+		t.Errorf("expected pages to be rasterized to Group 4 TIFF, got %s", b)
+	}
+}
+
+func TestValidResolution(t *testing.T) {
+	tests := map[string]bool{"300": true, "204x196": true, "": false, "0": false, "204x": false, "1x2x3": false, "-r300": false}
+	for s, want := range tests {
+		if got := ValidResolution(s); got != want {
+			t.Errorf("expected resolution %q to be valid: %v, got %v", s, want, got)
+		}
+	}
+}
+
+func TestSetPNGResolution(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	out, err := SetPNGResolution(buf.Bytes(), 96)
+	if err != nil {
+		t.Fatalf("unable to set resolution: %+v", err)
+	}
+	// The resolution is replaced
+	if out, err = SetPNGResolution(out, 300); err != nil {
+		t.Fatalf("unable to set resolution: %+v", err)
+	}
+	if got, want := bytes.Count(out, []byte("pHYs")), 1; got != want {
+		t.Errorf("expected %d resolution chunk, got %d", want, got)
+	}
+	// 300 DPI is 11811 pixels per meter
+	if !bytes.Contains(out, []byte("pHYs\x00\x00\x2e\x23\x00\x00\x2e\x23\x01")) {
+		t.Errorf("expected the resolution to be 300 DPI")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("expected the image to be valid, got %+v", err)
+	}
+
+	if _, err := SetPNGResolution([]byte("GIF89a"), 300); err != ErrNotPNG {
+		t.Errorf("expected error to be %v, got %v", ErrNotPNG, err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trustedProxy returns whether the peer of a request with the given address
+// is a trusted proxy. A peer without an IP address (i.e. over the Unix
+// socket) is a local proxy.
+func trustedProxy(addr string, proxies []string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return true
+	}
+	for _, cidr := range proxies {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realClientIP returns the IP address of the client of a request from the
+// address of its peer, and its X-Forwarded-For, and X-Real-IP headers. The
+// headers are only trusted from trusted proxies: X-Forwarded-For is walked
+// from the right (the addresses appended by the proxies closest to weaver),
+// and the first address which is not a trusted proxy is the client, so that
+// clients cannot spoof their address by sending the header themselves.
+func realClientIP(remoteAddr string, header func(string) string, proxies []string) string {
+	addr, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		addr = remoteAddr
+	}
+	if !trustedProxy(addr, proxies) {
+		return addr
+	}
+	if forwarded := header("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// The rest of the header cannot be trusted
+				break
+			}
+			addr = hop
+			if !trustedProxy(hop, proxies) {
+				return addr
+			}
+		}
+		return addr
+	}
+	if real := strings.TrimSpace(header("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return addr
+}
+
+// ClientIPMiddleware replaces the address of the peer of the request with
+// the address of its client, as forwarded by the trusted proxies (see
+// Config.TrustedProxies), for the audit log, and Sentry. It requires
+// gin.Engine.ForwardedByClientIP to be disabled, as gin trusts the headers of
+// any peer otherwise.
+func ClientIPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := c.MustGet("config").(Config)
+		ip := realClientIP(c.Request.RemoteAddr, c.Request.Header.Get, conf.TrustedProxies)
+		if host, _, _ := net.SplitHostPort(c.Request.RemoteAddr); net.ParseIP(ip) != nil && ip != host {
+			c.Request.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRealClientIP(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "fd00::/8"}
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		real       string
+		want       string
+	}{
+		// Untrusted peers cannot spoof their address
+		{"203.0.113.7:4000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"10.0.0.2:4000", "", "", "10.0.0.2"},
+		{"10.0.0.2:4000", "198.51.100.1", "", "198.51.100.1"},
+		// The client may prepend addresses to the header
+		{"10.0.0.2:4000", "192.0.2.9, 198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"10.0.0.2:4000", "10.0.0.4, 10.0.0.3", "", "10.0.0.4"},
+		{"10.0.0.2:4000", "unknown, 10.0.0.3", "", "10.0.0.3"},
+		{"10.0.0.2:4000", "", "198.51.100.2", "198.51.100.2"},
+		{"10.0.0.2:4000", "", "unknown", "10.0.0.2"},
+		{"[fd00::1]:4000", "2001:db8::1", "", "2001:db8::1"},
+		// Unix socket
+		{"@", "198.51.100.1", "", "198.51.100.1"},
+		{"", "", "198.51.100.2", "198.51.100.2"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("X-Forwarded-For", tt.forwarded)
+		header.Set("X-Real-IP", tt.real)
+		if got := realClientIP(tt.remoteAddr, header.Get, proxies); got != tt.want {
+			t.Errorf("expected client %s of %s (X-Forwarded-For: %q, X-Real-IP: %q), got %s", tt.want, tt.remoteAddr, tt.forwarded, tt.real, got)
+		}
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		want    string
+	}{
+		{nil, "10.0.0.2"},
+		{[]string{"10.0.0.0/8"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := gin.New()
+		r.ForwardedByClientIP = false
+		r.Use(ConfigMiddleware(Config{TrustedProxies: tt.proxies}), ClientIPMiddleware())
+		r.GET("/", func(c *gin.Context) {
+			c.String(200, c.ClientIP())
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.2:4000"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("expected client %s with proxies %v, got %s", tt.want, tt.proxies, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package recolor converts the colors of PDF documents with Ghostscript, to
+// grayscale, or to the color space of an ICC profile (e.g. the CMYK printing
+// condition of a print shop).
+package recolor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// deviceSpaces are the Ghostscript color conversion strategies, and process
+// color models of the color spaces of ICC profiles.
+var deviceSpaces = map[string][2]string{
+	"GRAY": {"Gray", "/DeviceGray"},
+	"RGB":  {"RGB", "/DeviceRGB"},
+	"CMYK": {"CMYK", "/DeviceCMYK"},
+}
+
+// Recolor converts the colors of PDF documents.
+type Recolor struct {
+	// Ghostscript is the Ghostscript command, e.g. 'gs'.
+	Ghostscript string
+	// Gray converts colors to grayscale.
+	Gray bool
+	// Profile is the path of an ICC profile. Colors are converted to its
+	// color space, and it is embedded as the output intent of the document
+	// (see pdf.SetOutputIntent), identified by ProfileName.
+	Profile     string
+	ProfileName string
+	// Dir is the directory of the temporary files. Defaults to the system
+	// temporary directory.
+	Dir string
+}
+
+// Convert returns a PDF document with its colors converted. The document is
+// written again by Ghostscript, so its text, and vector graphics are kept,
+// but its structure (e.g. tags) may be lost.
+func (r Recolor) Convert(b []byte, done <-chan struct{}) ([]byte, error) {
+	var profile *pdf.ICCProfile
+	strategy := deviceSpaces["GRAY"]
+	if r.Profile != "" {
+		data, err := ioutil.ReadFile(r.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if profile, err = pdf.ParseICCProfile(data); err != nil {
+			return nil, err
+		}
+		strategy = deviceSpaces[profile.ColorSpace]
+	}
+
+	dir, err := ioutil.TempDir(r.Dir, "recolor")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.pdf"), filepath.Join(dir, "out.pdf")
+	if err := ioutil.WriteFile(in, b, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := append(strings.Fields(r.Ghostscript),
+		"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=pdfwrite", "-dAutoRotatePages=/None",
+		"-sColorConversionStrategy="+strategy[0], "-dProcessColorModel="+strategy[1])
+	if profile != nil {
+		cmd = append(cmd, "-sOutputICCProfile="+r.Profile)
+	}
+	cmd = append(cmd, "-sOutputFile="+out, in)
+	if _, err := gcmd.Execute(cmd, done); err != nil {
+		return nil, err
+	}
+	converted, err := ioutil.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return converted, nil
+	}
+	return pdf.SetOutputIntent(converted, profile, r.ProfileName)
+}
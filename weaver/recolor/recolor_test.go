@@ -0,0 +1,76 @@
+package recolor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// mockRecolor returns a Recolor with a Ghostscript stub, which copies the
+// document, and records its arguments in 'args'.
+func mockRecolor(t *testing.T) (Recolor, string) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	gs := filepath.Join(dir, "gs")
+	script := "echo \"$@\" > " + args + "\nfor p; do case $p in -sOutputFile=*) out=${p#-sOutputFile=};; esac; done\ncp \"$p\" \"$out\"\n"
+	if err := ioutil.WriteFile(gs, []byte(script), 0600); err != nil {
+		t.Fatalf("unable to write Ghostscript stub: %+v", err)
+	}
+	return Recolor{Ghostscript: "sh " + gs, Dir: dir}, args
+}
+
+func testPDF(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	return b
+}
+
+func TestConvert_gray(t *testing.T) {
+	r, args := mockRecolor(t)
+	r.Gray = true
+	doc := testPDF(t)
+	out, err := r.Convert(doc, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to convert colors: %+v", err)
+	}
+	if !bytes.Equal(out, doc) {
+		t.Errorf("expected the output of Ghostscript to be returned")
+	}
+	b, _ := ioutil.ReadFile(args)
+	if !strings.Contains(string(b), "-sColorConversionStrategy=Gray -dProcessColorModel=/DeviceGray") {
+		t.Errorf("expected colors to be converted to gray, got %s", b)
+	}
+}
+
+func TestConvert_profile(t *testing.T) {
+	r, args := mockRecolor(t)
+	header := make([]byte, 128)
+	copy(header[16:], "CMYK")
+	copy(header[36:], "acsp")
+	r.Profile = filepath.Join(r.Dir, "coated.icc")
+	r.ProfileName = "FOGRA39"
+	ioutil.WriteFile(r.Profile, header, 0600)
+
+	out, err := r.Convert(testPDF(t), make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unable to convert colors: %+v", err)
+	}
+	b, _ := ioutil.ReadFile(args)
+	if !strings.Contains(string(b), "-sColorConversionStrategy=CMYK -dProcessColorModel=/DeviceCMYK -sOutputICCProfile="+r.Profile) {
+		t.Errorf("expected colors to be converted to the profile, got %s", b)
+	}
+	if !bytes.Contains(out, []byte("/OutputConditionIdentifier (FOGRA39)")) {
+		t.Errorf("expected the profile to be the output intent")
+	}
+
+	ioutil.WriteFile(r.Profile, []byte("not a profile"), 0600)
+	if _, err := r.Convert(testPDF(t), make(chan struct{})); err != pdf.ErrProfileInvalid {
+		t.Errorf("expected error to be %v, got %v", pdf.ErrProfileInvalid, err)
+	}
+}
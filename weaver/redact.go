@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrRedactInvalid should be returned when a requested redaction is not
+	// a built-in type, or a configured pattern.
+	ErrRedactInvalid = errors.New("invalid redact provided (expected a comma-separated list of 'email', 'card', or the names of configured redaction patterns)")
+	// ErrRedactAttachSource should be returned when a redacted conversion
+	// attaches its source, which is not redacted.
+	ErrRedactAttachSource = errors.New("redacted conversions cannot attach their source (attachSource)")
+)
+
+// redactTypes are the built-in redaction types of athenapdf CLI.
+var redactTypes = map[string]bool{"email": true, "card": true}
+
+// redactName matches the names of custom redaction patterns.
+var redactName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// redactionNames returns the names of the redactions of a conversion: the
+// default redactions, and the requested ones (comma-separated), sorted, and
+// without duplicates.
+func redactionNames(conf Config, requested string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range conf.Redaction.Default {
+		add(name)
+	}
+	if requested != "" {
+		for _, name := range strings.Split(requested, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := conf.Redaction.Patterns[name]; !ok && !redactTypes[name] {
+				return nil, ErrRedactInvalid
+			}
+			add(name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// redactOptions returns the built-in types, and the regular expressions of
+// custom patterns of redactions (see redactionNames).
+func redactOptions(conf Config, names []string) (types []string, patterns []string) {
+	for _, name := range names {
+		if redactTypes[name] {
+			types = append(types, name)
+		} else {
+			patterns = append(patterns, conf.Redaction.Patterns[name])
+		}
+	}
+	return types, patterns
+}
+
+// redaction returns the names of the redactions of a request ('redact', and
+// the default redactions).
+func redaction(c *gin.Context) ([]string, error) {
+	return redactionNames(c.MustGet("config").(Config), c.Query("redact"))
+}
+
+// checkRedact checks the redactions of a request. The source of a redacted
+// conversion cannot be attached, as it is not redacted.
+func checkRedact(c *gin.Context) error {
+	names, err := redaction(c)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 && attachSource(c) {
+		return ErrRedactAttachSource
+	}
+	return nil
+}
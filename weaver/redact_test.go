@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactionNames(t *testing.T) {
+	conf := Config{Redaction: Redaction{
+		Patterns: map[string]string{"ssn": `\b\d{3}-\d{2}-\d{4}\b`},
+		Default:  []string{"email"},
+	}}
+
+	tests := []struct {
+		requested string
+		want      []string
+		err       error
+	}{
+		{"", []string{"email"}, nil},
+		{"ssn, card,email", []string{"card", "email", "ssn"}, nil},
+		{"phone", nil, ErrRedactInvalid},
+	}
+	for _, tt := range tests {
+		got, err := redactionNames(conf, tt.requested)
+		if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected redactions of %q to be %v (%v), got %v (%v)", tt.requested, tt.want, tt.err, got, err)
+		}
+	}
+
+	types, patterns := redactOptions(conf, []string{"card", "email", "ssn"})
+	if want := []string{"card", "email"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("expected redaction types to be %v, got %v", want, types)
+	}
+	if want := []string{`\b\d{3}-\d{2}-\d{4}\b`}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("expected redaction patterns to be %v, got %v", want, patterns)
+	}
+}
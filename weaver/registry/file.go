@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore appends records as JSON lines to a file. Lookups scan the whole
+// file, so it is only suitable for a modest registry on a single instance.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore creates a file store at the given path. The file is created if
+// it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &FileStore{path: path}, nil
+}
+
+// Add appends the record of a document to the file. Documents produced again
+// are appended again, but lookups return their first record.
+func (s *FileStore) Add(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Get returns the first record of a digest. Malformed lines are skipped.
+func (s *FileStore) Get(sha256 string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return Record{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.SHA256 == sha256 {
+			return r, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, ErrNotFound
+}
+
+// Remove deletes the records of the documents produced by jobs, rewriting
+// the file (atomically). Malformed lines are kept.
+func (s *FileStore) Remove(jobs []string) (int, error) {
+	removed := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		removed[j] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var kept bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		var r Record
+		if err := json.Unmarshal(line, &r); err == nil && removed[r.Job] {
+			n++
+			continue
+		}
+		kept.Write(line)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), ".registry")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(kept.Bytes()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"sync"
+)
+
+// MemoryStore keeps the records of the most recent documents in memory. It
+// is lost on restart, and it is not shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	order   []string
+	max     int
+}
+
+// NewMemoryStore creates a memory store keeping at most max records (the
+// oldest are dropped first).
+func NewMemoryStore(max int) *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record), max: max}
+}
+
+// Add stores the record of a document, unless it is already stored.
+func (s *MemoryStore) Add(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[r.SHA256]; ok {
+		return nil
+	}
+	if len(s.order) == s.max {
+		delete(s.records, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.records[r.SHA256] = r
+	s.order = append(s.order, r.SHA256)
+	return nil
+}
+
+// Get returns the record of a digest.
+func (s *MemoryStore) Get(sha256 string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[sha256]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// Remove deletes the records of the documents produced by jobs.
+func (s *MemoryStore) Remove(jobs []string) (int, error) {
+	removed := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		removed[j] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	order := s.order[:0]
+	for _, digest := range s.order {
+		if removed[s.records[digest].Job] {
+			delete(s.records, digest)
+			n++
+			continue
+		}
+		order = append(order, digest)
+	}
+	s.order = order
+	return n, nil
+}
@@ -0,0 +1,51 @@
+// Package registry records the SHA-256 digests of the documents produced by
+// conversions (not the documents), so that recipients can verify that a
+// document was produced by the service, and has not been altered since.
+package registry
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a digest is not in the registry.
+var ErrNotFound = errors.New("document not found in the registry")
+
+// Record is the record of a produced document.
+type Record struct {
+	// SHA256 is the hex SHA-256 digest of the document (in lower case).
+	SHA256 string    `json:"sha256"`
+	Time   time.Time `json:"time"`
+	// Job is the ID of the conversion job that produced the document.
+	Job string `json:"job,omitempty"`
+	// Tenant is the ID of the tenant the conversion is accounted to (if
+	// any).
+	Tenant string `json:"tenant,omitempty"`
+	Format string `json:"format,omitempty"`
+	Pages  int    `json:"pages,omitempty"`
+	Bytes  int    `json:"bytes"`
+}
+
+// Store stores the records of produced documents. A document produced again
+// keeps its first record.
+type Store interface {
+	// Add stores the record of a document.
+	Add(Record) error
+	// Get returns the record of a digest, or ErrNotFound.
+	Get(sha256 string) (Record, error)
+	// Remove deletes the records of the documents produced by jobs, and
+	// returns their number.
+	Remove(jobs []string) (int, error)
+}
+
+// Normalize returns a hex SHA-256 digest in lower case, and false if it is
+// not a digest.
+func Normalize(digest string) (string, bool) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != 32 {
+		return "", false
+	}
+	return digest, true
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/sqlite"
+)
+
+var (
+	digestA = strings.Repeat("a", 64)
+	digestB = strings.Repeat("b", 64)
+)
+
+// testStore checks that a store returns the first record of a digest.
+func testStore(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	s.Add(Record{SHA256: digestA, Time: now, Job: "1", Format: "pdf", Pages: 2, Bytes: 1024})
+	s.Add(Record{SHA256: digestA, Time: now.Add(time.Minute), Job: "2", Format: "pdf", Pages: 2, Bytes: 1024})
+
+	r, err := s.Get(digestA)
+	if err != nil {
+		t.Fatalf("get returned an unexpected error: %+v", err)
+	}
+	if r.Job != "1" || r.Pages != 2 || r.Bytes != 1024 || !r.Time.Equal(now) {
+		t.Errorf("expected the first record of the document, got %+v", r)
+	}
+	if _, err := s.Get(digestB); err != ErrNotFound {
+		t.Errorf("expected error of an unknown digest to be %v, got %v", ErrNotFound, err)
+	}
+
+	s.Add(Record{SHA256: digestB, Time: now, Job: "3"})
+	if n, err := s.Remove([]string{"1", "3", "4"}); err != nil || n != 2 {
+		t.Errorf("expected the records of 2 documents to be removed, got %d (%v)", n, err)
+	}
+	if _, err := s.Get(digestB); err != ErrNotFound {
+		t.Errorf("expected the record of a removed document not to be found, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(10))
+
+	s := NewMemoryStore(1)
+	s.Add(Record{SHA256: digestA})
+	s.Add(Record{SHA256: digestB})
+	if _, err := s.Get(digestA); err != ErrNotFound {
+		t.Errorf("expected the oldest record to be dropped, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(filepath.Join(dir, "registry.log"))
+	if err != nil {
+		t.Fatalf("unable to create file store: %+v", err)
+	}
+	testStore(t, s)
+}
+
+func TestSQLStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sqlite.Open(filepath.Join(dir, "weaver.db"))
+	if err != nil {
+		t.Fatalf("unable to open database: %+v", err)
+	}
+	defer db.Close()
+	testStore(t, NewSQLStore(db))
+}
+
+func TestNormalize(t *testing.T) {
+	if got, ok := Normalize(" " + strings.ToUpper(digestA) + "\n"); !ok || got != digestA {
+		t.Errorf("expected digest to be normalized to %s, got %s", digestA, got)
+	}
+	for _, d := range []string{"", "abc", strings.Repeat("g", 64), strings.Repeat("a", 66)} {
+		if _, ok := Normalize(d); ok {
+			t.Errorf("expected %q not to be a digest", d)
+		}
+	}
+}
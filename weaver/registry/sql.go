@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore stores records in the 'weaver_registry' table of a PostgreSQL
+// database (see the postgres package), so that the registry is shared by all
+// instances, or of an embedded SQLite database (see the sqlite package).
+// Times are stored as Unix nanoseconds, so that both databases share the
+// schema.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store using a migrated database.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db}
+}
+
+// Add stores the record of a document, unless it is already stored.
+func (s *SQLStore) Add(r Record) error {
+	_, err := s.db.Exec(`INSERT INTO weaver_registry (sha256, time, job, tenant, format, pages, bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (sha256) DO NOTHING`,
+		r.SHA256, r.Time.UnixNano(), r.Job, r.Tenant, r.Format, r.Pages, r.Bytes,
+	)
+	return err
+}
+
+// Get returns the record of a digest.
+func (s *SQLStore) Get(sha256 string) (Record, error) {
+	r := Record{SHA256: sha256}
+	var t int64
+	err := s.db.QueryRow("SELECT time, job, tenant, format, pages, bytes FROM weaver_registry WHERE sha256 = $1", sha256).
+		Scan(&t, &r.Job, &r.Tenant, &r.Format, &r.Pages, &r.Bytes)
+	if err == sql.ErrNoRows {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	r.Time = time.Unix(0, t).UTC()
+	return r, nil
+}
+
+// Remove deletes the records of the documents produced by jobs.
+func (s *SQLStore) Remove(jobs []string) (int, error) {
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	placeholders := make([]string, len(jobs))
+	args := make([]interface{}, len(jobs))
+	for i, j := range jobs {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = j
+	}
+	res, err := s.db.Exec("DELETE FROM weaver_registry WHERE job IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+// LiveConfig holds the current configuration, which may be replaced at
+// runtime by a Reloader.
+type LiveConfig struct {
+	v atomic.Value
+}
+
+// NewLiveConfig creates a live configuration holding conf.
+func NewLiveConfig(conf Config) *LiveConfig {
+	l := new(LiveConfig)
+	l.Set(conf)
+	return l
+}
+
+// Get returns the current configuration.
+func (l *LiveConfig) Get() Config {
+	return l.v.Load().(Config)
+}
+
+// Set replaces the current configuration.
+func (l *LiveConfig) Set(conf Config) {
+	l.v.Store(conf)
+}
+
+// Reloader reloads the configuration (from the config file, and the
+// environment), the tenants, and resizes the worker pool without a restart.
+// In-flight conversions are unaffected, as every request uses the
+// configuration that was current when it started.
+type Reloader struct {
+	Config  *LiveConfig
+	Pool    *converter.Pool
+	Tenants *tenant.Registry
+	// TenantsDB is the SQLite database tenants are read from if no tenants
+	// file is configured.
+	TenantsDB *sql.DB
+
+	// Load returns the new configuration. Defaults to NewConfig.
+	Load func() (Config, error)
+
+	mu sync.Mutex
+}
+
+// Reload reloads the configuration. The current configuration is kept if
+// the new configuration is invalid, or it, or the tenants fail to load.
+func (r *Reloader) Reload() (Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	load := r.Load
+	if load == nil {
+		load = NewConfig
+	}
+	conf, err := load()
+	if err != nil {
+		return r.Config.Get(), err
+	}
+	if errs := conf.Validate(); len(errs) > 0 {
+		return r.Config.Get(), errs[0]
+	}
+	if r.Tenants != nil {
+		var err error
+		switch {
+		case conf.TenantsFile != "":
+			err = r.Tenants.Reload(conf.TenantsFile)
+		case r.TenantsDB != nil:
+			err = r.Tenants.ReloadSQLite(r.TenantsDB)
+		}
+		if err != nil {
+			return r.Config.Get(), err
+		}
+	}
+	if r.Pool != nil {
+		r.Pool.Resize(conf.MaxWorkers)
+	}
+	r.Config.Set(conf)
+	return conf, nil
+}
+
+// reload reloads the configuration, and logs the outcome.
+func (r *Reloader) reload(reason string) {
+	if _, err := r.Reload(); err != nil {
+		log.Printf("Unable to reload configuration (%s): %+v\n", reason, err)
+		return
+	}
+	log.Printf("Reloaded configuration (%s)\n", reason)
+}
+
+// Start reloads the configuration whenever a SIGHUP is received, or the
+// config file (WEAVER_CONFIG_FILE), or tenants file changes, until done is
+// closed. Files are checked for changes every interval. If SecretsRefresh is
+// set, the configuration is also reloaded periodically to pick up rotated
+// secrets.
+func (r *Reloader) Start(interval time.Duration, done <-chan struct{}) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var refresh <-chan time.Time
+		if s := r.Config.Get().SecretsRefresh; s > 0 {
+			t := time.NewTicker(time.Second * time.Duration(s))
+			defer t.Stop()
+			refresh = t.C
+		}
+		modified := r.modified()
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigChan:
+				r.reload("SIGHUP")
+				modified = r.modified()
+			case <-refresh:
+				r.reload("secrets refresh")
+			case <-ticker.C:
+				if m := r.modified(); !m.Equal(modified) {
+					modified = m
+					r.reload("file changed")
+				}
+			}
+		}
+	}()
+}
+
+// modified returns the latest modification time of the config, and tenants
+// files.
+func (r *Reloader) modified() time.Time {
+	var latest time.Time
+	for _, path := range []string{os.Getenv("WEAVER_CONFIG_FILE"), r.Config.Get().TenantsFile} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// reloadHandler reloads the configuration (admin only).
+func reloadHandler(c *gin.Context) {
+	r := c.MustGet("reloader").(*Reloader)
+	conf, err := r.Reload()
+	if err != nil {
+		c.AbortWithError(http.StatusUnprocessableEntity, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"max_workers": conf.MaxWorkers})
+}
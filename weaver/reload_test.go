@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func TestReloaderReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "tenants")
+	if err != nil {
+		t.Fatalf("unable to create temporary tenants file: %+v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[{"id": "acme", "key": "rotated-key"}]`)
+	f.Close()
+
+	reg, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "acme", Key: "acme-key"}})
+	pool := converter.NewPool(1, 1, 10)
+	defer pool.Resize(0)
+	r := &Reloader{
+		Config:  NewLiveConfig(Config{AuthKey: "123456", MaxWorkers: 1}),
+		Pool:    pool,
+		Tenants: reg,
+		Load: func() (Config, error) {
+			return Config{AuthKey: "654321", MaxWorkers: 3, WorkerTimeout: 90, TenantsFile: f.Name()}, nil
+		},
+	}
+	if _, err := r.Reload(); err != nil {
+		t.Fatalf("reload returned an unexpected error: %+v", err)
+	}
+	if got, want := r.Config.Get().AuthKey, "654321"; got != want {
+		t.Errorf("expected auth key to be %s, got %s", want, got)
+	}
+	if got, want := pool.Size(), 3; got != want {
+		t.Errorf("expected worker pool size to be %d, got %d", want, got)
+	}
+	if _, ok := reg.ByKey("rotated-key"); !ok {
+		t.Errorf("expected tenants to be reloaded")
+	}
+}
+
+func TestReloaderReload_error(t *testing.T) {
+	r := &Reloader{
+		Config: NewLiveConfig(Config{AuthKey: "123456"}),
+		Load: func() (Config, error) {
+			return Config{}, errors.New("invalid config")
+		},
+	}
+	if _, err := r.Reload(); err == nil {
+		t.Fatalf("expected reload to return an error")
+	}
+	if got, want := r.Config.Get().AuthKey, "123456"; got != want {
+		t.Errorf("expected auth key to be unchanged (%s), got %s", want, got)
+	}
+}
+
+func TestReloaderReload_invalid(t *testing.T) {
+	r := &Reloader{
+		Config: NewLiveConfig(Config{AuthKey: "123456"}),
+		Load: func() (Config, error) {
+			return Config{AuthKey: "654321", MaxWorkers: 0, WorkerTimeout: 90}, nil
+		},
+	}
+	if _, err := r.Reload(); err == nil {
+		t.Fatalf("expected reload to return a validation error")
+	}
+	if got, want := r.Config.Get().AuthKey, "123456"; got != want {
+		t.Errorf("expected auth key to be unchanged (%s), got %s", want, got)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	reloader := &Reloader{
+		Config: NewLiveConfig(Config{AuthKey: "123456"}),
+		Load: func() (Config, error) {
+			return Config{AuthKey: "654321", MaxWorkers: 1, WorkerTimeout: 90}, nil
+		},
+	}
+	r := gin.Default()
+	r.Use(LiveConfigMiddleware(reloader.Config))
+	r.Use(ReloaderMiddleware(reloader))
+	r.Use(AuthorizationMiddleware())
+	r.GET("/", func(c *gin.Context) {})
+	r.POST("/admin/reload", reloadHandler)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/reload?auth=123456", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+	expectResponseCode(t, r, "/?auth=123456", http.StatusUnauthorized)
+	expectResponseCode(t, r, "/?auth=654321", http.StatusOK)
+}
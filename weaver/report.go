@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/report"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// ErrReportNoRows should be returned when a report is requested without its
+// rows.
+var ErrReportNoRows = errors.New("the rows of the report are required (a CSV, or JSON file as file, or a JSON body)")
+
+// ReportRequest is the JSON body of a report request.
+type ReportRequest struct {
+	Title   string          `json:"title,omitempty"`
+	Columns []report.Column `json:"columns,omitempty"`
+	// Rows are an array of objects, or arrays.
+	Rows json.RawMessage `json:"rows"`
+}
+
+// readReport returns the report of a request: a JSON body (see
+// ReportRequest), or the rows uploaded as 'file' (CSV, or JSON if its name
+// has the '.json' extension), with the column spec of the 'columns' field (as
+// JSON), and the 'title' field. The first row of CSV files is their header,
+// unless 'header' is false. The rows must fit in the spool quota.
+func readReport(c *gin.Context) (*report.Report, error) {
+	conf := c.MustGet("config").(Config)
+	used := 0
+
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		b, err := readLimited(c.Request.Body, conf.Spool.MaxBytes, &used)
+		if err != nil {
+			return nil, err
+		}
+		var req ReportRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			return nil, ErrRequestInvalid
+		}
+		if len(req.Rows) == 0 {
+			return nil, ErrReportNoRows
+		}
+		keys, rows, err := report.ReadJSON(req.Rows)
+		if err != nil {
+			return nil, err
+		}
+		return report.New(req.Title, req.Columns, keys, rows)
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, ErrReportNoRows
+	}
+	defer file.Close()
+	b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+	if err != nil {
+		return nil, err
+	}
+	var columns []report.Column
+	if spec := c.Request.FormValue("columns"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &columns); err != nil {
+			return nil, report.ErrColumnInvalid
+		}
+	}
+	var keys []string
+	var rows []map[string]string
+	if strings.EqualFold(path.Ext(header.Filename), ".json") {
+		keys, rows, err = report.ReadJSON(b)
+	} else {
+		keys, rows, err = report.ReadCSV(bytes.NewReader(b), c.Request.FormValue("header") != "false")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report.New(c.Request.FormValue("title"), columns, keys, rows)
+}
+
+// reportHandler renders rows (CSV, or JSON, see readReport) as a paginated,
+// styled table, with a column spec, and converts it like an uploaded HTML
+// document, so that simple data exports do not require building HTML. The
+// header of the table is repeated on every page. Every conversion option
+// applies.
+func reportHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	r, err := readReport(c)
+	if err != nil {
+		s.Increment("report_error")
+		if err == ErrSourceTooLarge {
+			c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	s.Increment("report")
+
+	q := c.Request.URL.Query()
+	q.Set("ext", "html")
+	q.Set("repeat_table_headers", "true")
+	c.Request.URL.RawQuery = q.Encode()
+	convertUpload(c, "report.html", bytes.NewReader(r.HTML(time.Now())))
+}
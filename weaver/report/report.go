@@ -0,0 +1,309 @@
+// Package report renders tabular data (CSV, or JSON rows) as a styled HTML
+// table, with a specification of its columns, so that simple data exports
+// can be converted to PDF without building the HTML.
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoColumns is returned when a report has no columns.
+	ErrNoColumns = errors.New("a report requires columns (from the header of the CSV, or a column spec)")
+	// ErrColumnInvalid is returned when a column has no key, or an unknown
+	// alignment, or format.
+	ErrColumnInvalid = errors.New("invalid column provided (every column requires a key, align must be left, center, or right, and format text, or number)")
+	// ErrRowsInvalid is returned when the rows of a report cannot be read.
+	ErrRowsInvalid = errors.New("invalid rows provided (expected CSV, or a JSON array of objects, or arrays)")
+)
+
+// Formats of the values of columns.
+const (
+	FormatText   = "text"
+	FormatNumber = "number"
+)
+
+// Column is a column of a report.
+type Column struct {
+	// Key is the key of the values of the column in the rows: the name of
+	// the column in the header of CSV rows, or in JSON objects, or its
+	// (0-based) index in CSV rows without a header, or JSON arrays.
+	Key string `json:"key"`
+	// Title is the heading of the column. Defaults to the key.
+	Title string `json:"title,omitempty"`
+	// Align is the alignment of the column: 'left', 'center', or 'right'.
+	// Defaults to right for numbers, and left otherwise.
+	Align string `json:"align,omitempty"`
+	// Format is the format of the values: 'text' (default), or 'number'
+	// (grouped by thousands, with the number of decimals).
+	Format   string `json:"format,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+// validate returns an error if the column is invalid.
+func (c Column) validate() error {
+	if c.Key == "" {
+		return ErrColumnInvalid
+	}
+	switch c.Align {
+	case "", "left", "center", "right":
+	default:
+		return ErrColumnInvalid
+	}
+	switch c.Format {
+	case "", FormatText, FormatNumber:
+	default:
+		return ErrColumnInvalid
+	}
+	if c.Decimals != nil && (*c.Decimals < 0 || *c.Decimals > 10) {
+		return ErrColumnInvalid
+	}
+	return nil
+}
+
+// Report is a table of rows.
+type Report struct {
+	Title   string
+	Columns []Column
+	// Rows are the values of the rows, by the key of their column.
+	Rows []map[string]string
+}
+
+// New returns a report of the rows, with the columns. Without columns, the
+// report has a column for every key of the rows (in order).
+func New(title string, columns []Column, keys []string, rows []map[string]string) (*Report, error) {
+	if len(columns) == 0 {
+		for _, k := range keys {
+			columns = append(columns, Column{Key: k})
+		}
+	}
+	if len(columns) == 0 {
+		return nil, ErrNoColumns
+	}
+	for _, c := range columns {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Report{Title: title, Columns: columns, Rows: rows}, nil
+}
+
+// ReadCSV reads CSV rows, with their keys: the names of the columns of the
+// header, or the indexes of the columns without one.
+func ReadCSV(r io.Reader, header bool) ([]string, []map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, ErrRowsInvalid
+	}
+	var keys []string
+	if header && len(records) > 0 {
+		keys, records = records[0], records[1:]
+	}
+	rows := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]string, len(record))
+		for i, v := range record {
+			k := strconv.Itoa(i)
+			if header {
+				if i >= len(keys) {
+					continue
+				}
+				k = keys[i]
+			} else if i >= len(keys) {
+				keys = append(keys, k)
+			}
+			row[k] = v
+		}
+		rows = append(rows, row)
+	}
+	return keys, rows, nil
+}
+
+// ReadJSON reads JSON rows (an array of objects, or arrays), with their
+// keys: the keys of the objects (in the order they first appear), or the
+// indexes of the arrays.
+func ReadJSON(b []byte) ([]string, []map[string]string, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, nil, ErrRowsInvalid
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	key := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	rows := make([]map[string]string, 0, len(values))
+	for _, v := range values {
+		row := make(map[string]string)
+		switch {
+		case bytes.HasPrefix(bytes.TrimSpace(v), []byte("[")):
+			var cells []json.RawMessage
+			if err := json.Unmarshal(v, &cells); err != nil {
+				return nil, nil, ErrRowsInvalid
+			}
+			for i, cell := range cells {
+				k := strconv.Itoa(i)
+				key(k)
+				row[k] = jsonValue(cell)
+			}
+		default:
+			// The keys of objects are read in order
+			dec := json.NewDecoder(bytes.NewReader(v))
+			if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+				return nil, nil, ErrRowsInvalid
+			}
+			for dec.More() {
+				t, err := dec.Token()
+				if err != nil {
+					return nil, nil, ErrRowsInvalid
+				}
+				var cell json.RawMessage
+				if err := dec.Decode(&cell); err != nil {
+					return nil, nil, ErrRowsInvalid
+				}
+				k := t.(string)
+				key(k)
+				row[k] = jsonValue(cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return keys, rows, nil
+}
+
+// jsonValue returns the text of a JSON value: strings as is, null as an
+// empty string, and other values as JSON.
+func jsonValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	if string(v) == "null" {
+		return ""
+	}
+	return string(v)
+}
+
+// formatNumber returns a number grouped by thousands, with the number of
+// decimals (if not nil), or the value as is if it is not a number.
+func formatNumber(v string, decimals *int) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return v
+	}
+	prec := -1
+	if decimals != nil {
+		prec = *decimals
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', prec, 64)
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i:]
+	}
+	var b strings.Builder
+	if f < 0 {
+		b.WriteByte('-')
+	}
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + fraction
+}
+
+// cell is a cell of the table of a report.
+type cell struct {
+	Value string
+	Align string
+}
+
+// table returns the headings, and the cells of the rows of the report, with
+// their values formatted.
+func (r *Report) table() ([]cell, [][]cell) {
+	headings := make([]cell, len(r.Columns))
+	for i, c := range r.Columns {
+		headings[i] = cell{Value: c.Title, Align: c.Align}
+		if c.Title == "" {
+			headings[i].Value = c.Key
+		}
+		if c.Align == "" {
+			headings[i].Align = "left"
+			if c.Format == FormatNumber {
+				headings[i].Align = "right"
+			}
+		}
+	}
+	rows := make([][]cell, len(r.Rows))
+	for i, row := range r.Rows {
+		rows[i] = make([]cell, len(r.Columns))
+		for j, c := range r.Columns {
+			v := row[c.Key]
+			if c.Format == FormatNumber {
+				v = formatNumber(v, c.Decimals)
+			}
+			rows[i][j] = cell{Value: v, Align: headings[j].Align}
+		}
+	}
+	return headings, rows
+}
+
+var tmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font: 10pt/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 0; }
+h1 { font-size: 16pt; margin: 0 0 4pt; }
+.generated { color: #777; font-size: 8pt; margin: 0 0 12pt; }
+table { border-collapse: collapse; width: 100%; }
+th { background: #2f3b4c; color: #fff; font-weight: 600; padding: 5pt 6pt; }
+td { padding: 4pt 6pt; border-bottom: 1px solid #e3e6ea; vertical-align: top; word-break: break-word; }
+tbody tr:nth-child(even) td { background: #f6f7f9; }
+.left { text-align: left; } .center { text-align: center; } .right { text-align: right; font-variant-numeric: tabular-nums; }
+</style>
+</head>
+<body>
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+<p class="generated">{{.Count}} rows, generated {{.Generated}}</p>
+<table>
+<thead><tr>{{range .Headings}}<th class="{{.Align}}">{{.Value}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td class="{{.Align}}">{{.Value}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// HTML returns the report as a HTML document: its title, and a table of its
+// rows (whose header is repeated on every printed page), generated at the
+// time.
+func (r *Report) HTML(generated time.Time) []byte {
+	headings, rows := r.table()
+	var b bytes.Buffer
+	tmpl.Execute(&b, map[string]interface{}{
+		"Title":     r.Title,
+		"Count":     len(rows),
+		"Generated": generated.UTC().Format("2 Jan 2006 15:04 UTC"),
+		"Headings":  headings,
+		"Rows":      rows,
+	})
+	return b.Bytes()
+}
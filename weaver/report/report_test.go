@@ -0,0 +1,122 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	keys, rows, err := ReadCSV(strings.NewReader("name,amount\nWidget,1200.5\nGadget,-3\n"), true)
+	if err != nil {
+		t.Fatalf("unable to read CSV: %+v", err)
+	}
+	if got, want := strings.Join(keys, ","), "name,amount"; got != want {
+		t.Errorf("expected keys to be %s, got %s", want, got)
+	}
+	if got, want := len(rows), 2; got != want {
+		t.Fatalf("expected %d rows, got %d", want, got)
+	}
+	if got, want := rows[1]["amount"], "-3"; got != want {
+		t.Errorf("expected amount to be %s, got %s", want, got)
+	}
+
+	keys, rows, err = ReadCSV(strings.NewReader("a,b\nc,d,e\n"), false)
+	if err != nil {
+		t.Fatalf("unable to read CSV: %+v", err)
+	}
+	if got, want := strings.Join(keys, ","), "0,1,2"; got != want {
+		t.Errorf("expected keys to be %s, got %s", want, got)
+	}
+	if got, want := rows[1]["2"], "e"; got != want {
+		t.Errorf("expected value to be %s, got %s", want, got)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	keys, rows, err := ReadJSON([]byte(`[{"name": "Widget", "amount": 1200.5, "tags": ["a"]}, {"sku": null, "name": "Gadget"}]`))
+	if err != nil {
+		t.Fatalf("unable to read JSON: %+v", err)
+	}
+	if got, want := strings.Join(keys, ","), "name,amount,tags,sku"; got != want {
+		t.Errorf("expected keys to be %s, got %s", want, got)
+	}
+	for _, tt := range [][2]string{{rows[0]["amount"], "1200.5"}, {rows[0]["tags"], `["a"]`}, {rows[1]["sku"], ""}} {
+		if tt[0] != tt[1] {
+			t.Errorf("expected value to be %q, got %q", tt[1], tt[0])
+		}
+	}
+
+	if keys, _, err = ReadJSON([]byte(`[["a", 1], ["b"]]`)); err != nil || strings.Join(keys, ",") != "0,1" {
+		t.Errorf("expected keys of arrays to be 0,1, got %v (%v)", keys, err)
+	}
+	for _, b := range []string{`{"name": "Widget"}`, `[1, 2]`, `[{"a": 1}`} {
+		if _, _, err := ReadJSON([]byte(b)); err != ErrRowsInvalid {
+			t.Errorf("expected error of %s to be %v, got %v", b, ErrRowsInvalid, err)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	two := 2
+	tests := []struct {
+		v        string
+		decimals *int
+		want     string
+	}{
+		{"1234567.891", nil, "1,234,567.891"},
+		{"1234567.891", &two, "1,234,567.89"},
+		{"-1000", &two, "-1,000.00"},
+		{"999", nil, "999"},
+		{"n/a", nil, "n/a"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("expected %s to be formatted as %s, got %s", tt.v, tt.want, got)
+		}
+	}
+}
+
+func TestReport_HTML(t *testing.T) {
+	two := 2
+	r, err := New("Q2 <sales>", []Column{
+		{Key: "name", Title: "Product"},
+		{Key: "amount", Format: FormatNumber, Decimals: &two},
+	}, []string{"name", "amount", "ignored"}, []map[string]string{
+		{"name": "<b>Widget</b>", "amount": "1200.5", "ignored": "x"},
+	})
+	if err != nil {
+		t.Fatalf("unable to create report: %+v", err)
+	}
+	out := string(r.HTML(time.Date(2018, 6, 1, 9, 30, 0, 0, time.UTC)))
+	for _, s := range []string{
+		"<h1>Q2 &lt;sales&gt;</h1>",
+		"1 rows, generated 1 Jun 2018 09:30 UTC",
+		`<th class="left">Product</th><th class="right">amount</th>`,
+		`<td class="left">&lt;b&gt;Widget&lt;/b&gt;</td><td class="right">1,200.50</td>`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected the report to contain %q, got %s", s, out)
+		}
+	}
+	if strings.Contains(out, ">x<") {
+		t.Errorf("expected the report not to contain the values of other columns")
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	tests := []struct {
+		columns []Column
+		want    error
+	}{
+		{nil, ErrNoColumns},
+		{[]Column{{Title: "Name"}}, ErrColumnInvalid},
+		{[]Column{{Key: "name", Align: "justify"}}, ErrColumnInvalid},
+		{[]Column{{Key: "name", Format: "currency"}}, ErrColumnInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := New("", tt.columns, nil, nil); err != tt.want {
+			t.Errorf("expected error of %+v to be %v, got %v", tt.columns, tt.want, err)
+		}
+	}
+}
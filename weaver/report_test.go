@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestReportHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The mock converter keeps the document it converts, and its arguments
+	script := filepath.Join(dir, "converter.sh")
+	ioutil.WriteFile(script, []byte("echo \"$@\" > "+dir+"/args\n"+
+		"for a; do case \"$a\" in *.html) cp \"$a\" "+dir+"/source.html;; esac; done\n"+
+		"cat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	csvRequest := func(name, csv string, fields map[string]string) *http.Request {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		f, _ := w.CreateFormFile("file", name)
+		f.Write([]byte(csv))
+		for k, v := range fields {
+			w.WriteField(k, v)
+		}
+		w.Close()
+		req, _ := http.NewRequest("POST", "/report?auth=123456", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req
+	}
+	jsonRequest := func(body string) *http.Request {
+		req, _ := http.NewRequest("POST", "/report?auth=123456", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	tests := []struct {
+		req  *http.Request
+		code int
+		want string
+	}{
+		{csvRequest("sales.csv", "product,amount\nWidget,1200\n", map[string]string{
+			"title": "Sales", "columns": `[{"key": "amount", "title": "Amount", "format": "number", "decimals": 2}]`,
+		}), http.StatusOK, `<th class="right">Amount</th>`},
+		{csvRequest("sales.json", `[{"product": "Widget"}]`, nil), http.StatusOK, `<td class="left">Widget</td>`},
+		{jsonRequest(`{"title": "Sales", "rows": [["Widget", 3]], "columns": [{"key": "1", "format": "number"}]}`), http.StatusOK, `<td class="right">3</td>`},
+		{jsonRequest(`{"title": "Sales"}`), http.StatusBadRequest, ""},
+		{jsonRequest(`{"rows": [{"a": 1}], "columns": [{"key": "a", "align": "justify"}]}`), http.StatusBadRequest, ""},
+		{csvRequest("sales.csv", "a,\"b\n", nil), http.StatusBadRequest, ""},
+	}
+	for i, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, tt.req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of request %d to be %d, got %d: %s", i, want, got, res.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		source, _ := ioutil.ReadFile(filepath.Join(dir, "source.html"))
+		if !strings.Contains(string(source), tt.want) {
+			t.Errorf("expected the report of request %d to contain %q, got %s", i, tt.want, source)
+		}
+		args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+		if !strings.Contains(string(args), "--repeat-table-headers") {
+			t.Errorf("expected the report of request %d to repeat table headers, got %s", i, args)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/tus"
+)
+
+var (
+	// ErrTusVersion should be returned when a resumable upload request is
+	// not of the supported version of the tus protocol.
+	ErrTusVersion = errors.New("unsupported tus protocol version (Tus-Resumable must be 1.0.0)")
+	// ErrTusContentType should be returned when a chunk of a resumable
+	// upload does not have the Content-Type of the tus protocol.
+	ErrTusContentType = errors.New("upload chunks must have the Content-Type application/offset+octet-stream")
+	// ErrTusOffsetInvalid should be returned when the offset of a chunk of a
+	// resumable upload is invalid.
+	ErrTusOffsetInvalid = errors.New("invalid upload offset provided (Upload-Offset)")
+)
+
+// tusExtensions are the extensions of the tus protocol supported by the
+// resumable uploads.
+const tusExtensions = "creation,termination,expiration"
+
+// TusResumableMiddleware sets the version of the tus protocol on responses,
+// and checks that requests use it (except OPTIONS requests, which discover
+// it).
+func TusResumableMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tus.Version)
+		if c.Request.Method != "OPTIONS" && c.GetHeader("Tus-Resumable") != tus.Version {
+			c.Header("Tus-Version", tus.Version)
+			c.AbortWithError(http.StatusPreconditionFailed, ErrTusVersion).SetType(gin.ErrorTypePublic)
+		}
+	}
+}
+
+// setUploadHeaders sets the state of a resumable upload on a response.
+func setUploadHeaders(c *gin.Context, u tus.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	c.Header("Upload-Expires", u.Expires.Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+}
+
+// ownedUpload returns a resumable upload of the tenant of the request (other
+// uploads are not found).
+func ownedUpload(c *gin.Context, id string) (tus.Upload, error) {
+	store := c.MustGet("uploads").(*tus.Store)
+	u, err := store.Get(id)
+	if err == nil && u.Owner != tenantID(c) {
+		return tus.Upload{}, tus.ErrNotFound
+	}
+	return u, err
+}
+
+// abortUpload aborts a resumable upload request with an error of the tus
+// package.
+func abortUpload(c *gin.Context, err error) {
+	switch err {
+	case tus.ErrNotFound:
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+	case tus.ErrOffsetMismatch, tus.ErrIncomplete:
+		c.AbortWithError(http.StatusConflict, err).SetType(gin.ErrorTypePublic)
+	case tus.ErrTooLarge, ErrUploadTooLarge:
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+	case tus.ErrLocked:
+		c.AbortWithError(http.StatusLocked, err).SetType(gin.ErrorTypePublic)
+	case tus.ErrLengthInvalid, tus.ErrMetadataInvalid, ErrTusOffsetInvalid:
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+	case ErrTusContentType:
+		c.AbortWithError(http.StatusUnsupportedMediaType, err).SetType(gin.ErrorTypePublic)
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// uploadOptionsHandler describes the resumable uploads (the versions, and
+// extensions of the tus protocol, and the maximum size of uploads).
+func uploadOptionsHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	c.Header("Tus-Version", tus.Version)
+	c.Header("Tus-Extension", tusExtensions)
+	if conf.MaxUploadBytes > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(conf.MaxUploadBytes, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// createUploadHandler creates an empty resumable upload of the length of the
+// Upload-Length header, and returns its URL in the Location header.
+func createUploadHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	store := c.MustGet("uploads").(*tus.Store)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		abortUpload(c, tus.ErrLengthInvalid)
+		return
+	}
+	if conf.MaxUploadBytes > 0 && length > conf.MaxUploadBytes {
+		abortUpload(c, ErrUploadTooLarge)
+		return
+	}
+	metadata, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+	u, err := store.Create(tenantID(c), length, metadata)
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+
+	// The auth key is kept, as chunks are authorized like any other request
+	location := c.Request.URL.Path + "/" + u.ID
+	if auth := c.Query("auth"); auth != "" {
+		location += "?" + url.Values{"auth": {auth}}.Encode()
+	}
+	c.Header("Location", location)
+	c.Header("Upload-Expires", u.Expires.Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// headUploadHandler returns the offset of a resumable upload, which a client
+// resumes it from.
+func headUploadHandler(c *gin.Context) {
+	u, err := ownedUpload(c, c.Param("id"))
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+	setUploadHeaders(c, u)
+	c.Status(http.StatusOK)
+}
+
+// patchUploadHandler appends a chunk to a resumable upload at the offset of
+// the Upload-Offset header. The bytes received before the client
+// disconnects are kept.
+func patchUploadHandler(c *gin.Context) {
+	store := c.MustGet("uploads").(*tus.Store)
+	if c.ContentType() != "application/offset+octet-stream" {
+		abortUpload(c, ErrTusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		abortUpload(c, ErrTusOffsetInvalid)
+		return
+	}
+	if _, err := ownedUpload(c, c.Param("id")); err != nil {
+		abortUpload(c, err)
+		return
+	}
+	u, err := store.Write(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+	setUploadHeaders(c, u)
+	c.Status(http.StatusNoContent)
+}
+
+// deleteUploadHandler removes a resumable upload.
+func deleteUploadHandler(c *gin.Context) {
+	store := c.MustGet("uploads").(*tus.Store)
+	if _, err := ownedUpload(c, c.Param("id")); err != nil {
+		abortUpload(c, err)
+		return
+	}
+	if err := store.Remove(c.Param("id")); err != nil {
+		abortUpload(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
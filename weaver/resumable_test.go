@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"github.com/lachee/athenapdf/weaver/tus"
+)
+
+func mockUploadsRouter(t *testing.T, conf Config) (*gin.Engine, func()) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := tus.NewStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mockRouter(conf, Services{Uploads: s}, func(r *gin.Engine, _ Config, _ Services) {
+		r.OPTIONS("/uploads", TusResumableMiddleware(), uploadOptionsHandler)
+		uploads := r.Group("/uploads", TusResumableMiddleware())
+		uploads.POST("", createUploadHandler)
+		uploads.HEAD("/:id", headUploadHandler)
+		uploads.PATCH("/:id", patchUploadHandler)
+		uploads.DELETE("/:id", deleteUploadHandler)
+		r.POST("/convert", func(c *gin.Context) {
+			file, name, err := receiveUpload(c)
+			if err != nil {
+				abortUpload(c, err)
+				return
+			}
+			defer file.Close()
+			b, _ := ioutil.ReadAll(file)
+			c.String(200, name+": "+string(b))
+		})
+	})
+	return r, func() { os.RemoveAll(dir) }
+}
+
+func tusRequest(method, path, body string, headers ...string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", tus.Version)
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return req
+}
+
+func TestResumableUpload(t *testing.T) {
+	r, cleanup := mockUploadsRouter(t, Config{MaxUploadBytes: 100})
+	defer cleanup()
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("OPTIONS", "/uploads", nil))
+	if got, want := res.Header().Get("Tus-Max-Size"), "100"; got != want {
+		t.Errorf("expected Tus-Max-Size %s, got %q", want, got)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, tusRequest("POST", "/uploads?auth=123456", "", "Upload-Length", "11", "Upload-Metadata", "filename ZGVjay5wcHR4"))
+	if got, want := res.Code, http.StatusCreated; got != want {
+		t.Fatalf("expected response code %d, got %d: %s", want, got, res.Body.String())
+	}
+	location := res.Header().Get("Location")
+	if !strings.HasPrefix(location, "/uploads/") || !strings.HasSuffix(location, "?auth=123456") {
+		t.Fatalf("expected location of the upload with the auth key, got %q", location)
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(location, "/uploads/"), "?auth=123456")
+
+	tests := []struct {
+		req    *http.Request
+		code   int
+		offset string
+	}{
+		{tusRequest("PATCH", location, "hello", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0"), http.StatusNoContent, "5"},
+		{tusRequest("HEAD", location, ""), http.StatusOK, "5"},
+		{tusRequest("PATCH", location, "hello", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0"), http.StatusConflict, ""},
+		{tusRequest("PATCH", location, " world", "Content-Type", "text/plain", "Upload-Offset", "5"), http.StatusUnsupportedMediaType, ""},
+		{httptest.NewRequest("PATCH", location, strings.NewReader(" world")), http.StatusPreconditionFailed, ""},
+		{tusRequest("POST", "/convert?upload="+id, ""), http.StatusConflict, ""},
+		{tusRequest("PATCH", location, " world", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "5"), http.StatusNoContent, "11"},
+	}
+	for i, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, tt.req)
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code %d of request %d, got %d: %s", tt.code, i, got, res.Body.String())
+		}
+		if got := res.Header().Get("Upload-Offset"); got != tt.offset {
+			t.Errorf("expected offset %q of request %d, got %q", tt.offset, i, got)
+		}
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("POST", "/convert?upload="+id, nil))
+	if got, want := res.Body.String(), "deck.pptx: hello world"; got != want {
+		t.Errorf("expected upload to be converted as %q, got %q", want, got)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, tusRequest("DELETE", location, ""))
+	if got, want := res.Code, http.StatusNoContent; got != want {
+		t.Errorf("expected response code %d, got %d", want, got)
+	}
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, tusRequest("HEAD", location, ""))
+	if got, want := res.Code, http.StatusNotFound; got != want {
+		t.Errorf("expected response code %d, got %d", want, got)
+	}
+}
+
+func TestResumableUpload_invalid(t *testing.T) {
+	r, cleanup := mockUploadsRouter(t, Config{MaxUploadBytes: 100})
+	defer cleanup()
+
+	tests := []struct {
+		headers []string
+		code    int
+	}{
+		{nil, http.StatusBadRequest},
+		{[]string{"Upload-Length", "-1"}, http.StatusBadRequest},
+		{[]string{"Upload-Length", "101"}, http.StatusRequestEntityTooLarge},
+		{[]string{"Upload-Length", "10", "Upload-Metadata", "filename !"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, tusRequest("POST", "/uploads", "", tt.headers...))
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code %d with %q, got %d", tt.code, tt.headers, got)
+		}
+	}
+}
+
+func TestOwnedUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, _ := tus.NewStore(dir, time.Hour)
+	u, _ := s.Create("acme", 5, nil)
+
+	tests := []struct {
+		tenant string
+		err    error
+	}{
+		{"acme", nil},
+		{"globex", tus.ErrNotFound},
+		{"", tus.ErrNotFound},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("uploads", s)
+		if tt.tenant != "" {
+			c.Set("tenant", tenant.Tenant{ID: tt.tenant})
+		}
+		if _, err := ownedUpload(c, u.ID); err != tt.err {
+			t.Errorf("expected %v for tenant %q, got %+v", tt.err, tt.tenant, err)
+		}
+	}
+}
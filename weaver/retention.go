@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/retention"
+	"github.com/lachee/athenapdf/weaver/tenant"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// maxRetentionDays is the longest retention period (10 years).
+const maxRetentionDays = 3650
+
+// ErrRetentionInvalid should be returned when the requested retention period
+// of an uploaded output is not a number of days, or it is longer than the
+// retention period of the tenant.
+var ErrRetentionInvalid = errors.New("invalid retention_days provided (expected a number of days, no longer than the retention period of the auth key)")
+
+// retentionLimit returns the retention period of the uploaded outputs of a
+// request: the period of its tenant, or the configured period (0 if they
+// are kept).
+func retentionLimit(c *gin.Context) int {
+	if t, ok := c.Get("tenant"); ok && t.(tenant.Tenant).RetentionDays > 0 {
+		return t.(tenant.Tenant).RetentionDays
+	}
+	return c.MustGet("config").(Config).Retention.Days
+}
+
+// retentionDays returns the number of days the uploaded output of a request
+// is kept ('retention_days', defaulting to the retention period of its
+// tenant, see retentionLimit), or 0 if it is kept indefinitely.
+func retentionDays(c *gin.Context) (int, error) {
+	limit := retentionLimit(c)
+	v, ok := c.GetQuery("retention_days")
+	if !ok {
+		return limit, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > maxRetentionDays || (limit > 0 && days > limit) {
+		return 0, ErrRetentionInvalid
+	}
+	return days, nil
+}
+
+// checkRetention checks the requested retention period of a request.
+func checkRetention(c *gin.Context) error {
+	_, err := retentionDays(c)
+	return err
+}
+
+// objectDeletions returns the scheduled deletions of an uploaded output, and
+// of its source, and archive (if any). It returns none if the output is kept.
+func objectDeletions(o *converter.S3Object, job, tenant string) []retention.Deletion {
+	if o == nil {
+		return nil
+	}
+	var deletions []retention.Deletion
+	for _, o := range []*converter.S3Object{o, o.Source, o.Archive} {
+		if o == nil || o.Key == "" || o.Expires.IsZero() {
+			continue
+		}
+		deletions = append(deletions, retention.Deletion{
+			Region: o.Region,
+			Bucket: o.Bucket,
+			Key:    o.Key,
+			Due:    o.Expires,
+			Job:    job,
+			Tenant: tenant,
+		})
+	}
+	return deletions
+}
+
+// scheduleDeletions schedules the deletion of an uploaded output (and of its
+// source, and archive) at the end of its retention period.
+func scheduleDeletions(s retention.Store, o *converter.S3Object, job, tenant string) {
+	for _, d := range objectDeletions(o, job, tenant) {
+		if err := s.Add(d); err != nil {
+			log.Printf("[Retention] unable to schedule the deletion of s3://%s/%s: %+v\n", d.Bucket, d.Key, err)
+		}
+	}
+}
+
+// ScheduleDeletionMiddleware schedules the deletion of the output uploaded by
+// a request at the end of its retention period, once it has finished.
+// Asynchronous conversions are scheduled by the consumer instead.
+func ScheduleDeletionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		o, ok := c.Get("s3_object")
+		if !ok {
+			return
+		}
+		scheduleDeletions(c.MustGet("retention").(retention.Store), o.(*converter.S3Object), c.GetString("job"), tenantID(c))
+	}
+}
+
+// s3Deleter deletes uploaded outputs with the configured S3 credentials (see
+// S3), or the default credentials of the instance.
+type s3Deleter struct {
+	conf Config
+}
+
+func (d s3Deleter) Delete(r retention.Deletion) error {
+	return converter.DeleteFromS3(converter.AWSS3{
+		Region:       r.Region,
+		AccessKey:    d.conf.S3.AccessKey,
+		AccessSecret: d.conf.S3.AccessSecret,
+		S3Bucket:     r.Bucket,
+		S3Key:        r.Key,
+	})
+}
+
+// NewJanitor returns the janitor deleting the uploaded outputs scheduled in a
+// store, which publishes a deleted event for every deleted output.
+func NewJanitor(conf Config, store retention.Store, s *statsd.Client, p events.Publisher) retention.Janitor {
+	return retention.Janitor{
+		Store:   store,
+		Deleter: s3Deleter{conf},
+		Notify: func(d retention.Deletion, err error) {
+			if err != nil {
+				s.Increment("retention_error")
+				return
+			}
+			s.Increment("retention_deleted")
+			events.Emit(events.WithTenant(p, d.Tenant), events.Deleted, d.Job, fmt.Sprintf("s3://%s/%s", d.Bucket, d.Key), nil)
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package retention
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps scheduled deletions in memory, and persists them as a JSON
+// file, which is rewritten on every change. It is only suitable for a modest
+// number of deletions on a single instance.
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// NewFileStore creates a file store at the given path, loading the deletions
+// of the file if it exists.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: MemoryStore{deletions: make(map[string]Deletion)}, path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var deletions []Deletion
+	if err := json.Unmarshal(b, &deletions); err != nil {
+		return nil, err
+	}
+	for _, d := range deletions {
+		s.add(d)
+	}
+	return s, nil
+}
+
+// save writes the deletions to the file, replacing it atomically. The lock
+// must be held.
+func (s *FileStore) save() error {
+	deletions := make([]Deletion, 0, len(s.deletions))
+	for _, d := range s.deletions {
+		deletions = append(deletions, d)
+	}
+	b, err := json.Marshal(deletions)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".retention")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Add schedules a deletion, unless the object is already due later.
+func (s *FileStore) Add(d Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(d)
+	return s.save()
+}
+
+// Remove removes the deletion of an object.
+func (s *FileStore) Remove(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deletions, objectID(bucket, key))
+	return s.save()
+}
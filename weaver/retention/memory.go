@@ -0,0 +1,66 @@
+package retention
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps scheduled deletions in memory. It is lost on restart (so
+// the objects scheduled before are kept), and it is not shared between
+// instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	deletions map[string]Deletion
+}
+
+// NewMemoryStore creates an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{deletions: make(map[string]Deletion)}
+}
+
+// objectID returns the identifier of an object in a store.
+func objectID(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// Add schedules a deletion, unless the object is already due later.
+func (s *MemoryStore) Add(d Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(d)
+	return nil
+}
+
+func (s *MemoryStore) add(d Deletion) {
+	id := objectID(d.Bucket, d.Key)
+	if e, ok := s.deletions[id]; ok && e.Due.After(d.Due) {
+		return
+	}
+	s.deletions[id] = d
+}
+
+// Due returns at most limit deletions due before t, the earliest first.
+func (s *MemoryStore) Due(t time.Time, limit int) ([]Deletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Deletion
+	for _, d := range s.deletions {
+		if d.Due.Before(t) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Due.Before(due[j].Due) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Remove removes the deletion of an object.
+func (s *MemoryStore) Remove(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deletions, objectID(bucket, key))
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package retention schedules the deletion of the outputs uploaded to S3 at
+// the end of their retention period, and deletes them once they are due, to
+// keep stored documents no longer than needed.
+package retention
+
+import (
+	"log"
+	"time"
+)
+
+// Deletion is the scheduled deletion of an uploaded object.
+type Deletion struct {
+	Region string `json:"region,omitempty"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Due is the end of the retention period of the object.
+	Due time.Time `json:"due"`
+	// Job is the ID of the conversion job that uploaded the object.
+	Job string `json:"job,omitempty"`
+	// Tenant is the ID of the tenant the conversion is accounted to (if
+	// any).
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Store stores scheduled deletions. An object scheduled again keeps its
+// latest due time, as it may have been uploaded again (e.g. a
+// content-addressed output).
+type Store interface {
+	// Add schedules a deletion.
+	Add(Deletion) error
+	// Due returns at most limit deletions due before t, the earliest first.
+	Due(t time.Time, limit int) ([]Deletion, error)
+	// Remove removes the deletion of an object (once it is deleted).
+	Remove(bucket, key string) error
+}
+
+// Deleter deletes uploaded objects.
+type Deleter interface {
+	Delete(Deletion) error
+}
+
+// batchSize is the number of deletions read from the store at once.
+const batchSize = 100
+
+// Janitor deletes the objects whose retention period has ended.
+type Janitor struct {
+	Store   Store
+	Deleter Deleter
+	// Notify is called after every attempted deletion (with its error), if
+	// it is set, e.g. to publish deletion events.
+	Notify func(Deletion, error)
+}
+
+// Run deletes the objects due before t, and returns the number of deleted
+// objects. Objects that cannot be deleted are kept in the store, and retried
+// on the next run.
+func (j Janitor) Run(t time.Time) (int, error) {
+	deleted := 0
+	for {
+		due, err := j.Store.Due(t, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		failed := 0
+		for _, d := range due {
+			if err := j.Deleter.Delete(d); err != nil {
+				log.Printf("[Retention] unable to delete s3://%s/%s: %+v\n", d.Bucket, d.Key, err)
+				failed++
+				j.notify(d, err)
+				continue
+			}
+			log.Printf("[Retention] deleted s3://%s/%s (job %q, tenant %q, due %s)\n", d.Bucket, d.Key, d.Job, d.Tenant, d.Due.Format(time.RFC3339))
+			deleted++
+			j.notify(d, nil)
+			if err := j.Store.Remove(d.Bucket, d.Key); err != nil {
+				return deleted, err
+			}
+		}
+		// Failed deletions are due again, so the run ends once a batch
+		// only contains them
+		if len(due) < batchSize || failed == len(due) {
+			return deleted, nil
+		}
+	}
+}
+
+func (j Janitor) notify(d Deletion, err error) {
+	if j.Notify != nil {
+		j.Notify(d, err)
+	}
+}
+
+// Start runs the janitor immediately, and then every interval until the done
+// channel is closed.
+func (j Janitor) Start(interval time.Duration, done <-chan struct{}) {
+	run := func() {
+		if _, err := j.Run(time.Now()); err != nil {
+			log.Printf("[Retention] unable to delete due objects: %+v\n", err)
+		}
+	}
+	go func() {
+		run()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				run()
+			}
+		}
+	}()
+}
@@ -0,0 +1,130 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/sqlite"
+)
+
+// testStore checks that a store returns the due deletions, the earliest
+// first, and keeps the latest due time of an object.
+func testStore(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	s.Add(Deletion{Bucket: "b", Key: "a.pdf", Due: now.Add(-time.Hour), Job: "1"})
+	s.Add(Deletion{Bucket: "b", Key: "b.pdf", Due: now.Add(-2 * time.Hour), Job: "2"})
+	s.Add(Deletion{Bucket: "b", Key: "c.pdf", Due: now.Add(-time.Hour), Job: "3"})
+	// c.pdf was uploaded again, and a.pdf is kept until the latest time
+	s.Add(Deletion{Bucket: "b", Key: "c.pdf", Due: now.Add(time.Hour), Job: "4"})
+	s.Add(Deletion{Bucket: "b", Key: "a.pdf", Due: now.Add(-3 * time.Hour), Job: "5"})
+
+	due, err := s.Due(now, 10)
+	if err != nil {
+		t.Fatalf("due returned an unexpected error: %+v", err)
+	}
+	if len(due) != 2 || due[0].Job != "2" || due[1].Job != "1" || !due[1].Due.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected the deletions of jobs 2, and 1 to be due, got %+v", due)
+	}
+	if due, _ := s.Due(now, 1); len(due) != 1 || due[0].Job != "2" {
+		t.Errorf("expected the earliest deletion to be due, got %+v", due)
+	}
+
+	s.Remove("b", "b.pdf")
+	if due, _ := s.Due(now.Add(2*time.Hour), 10); len(due) != 2 || due[0].Key != "a.pdf" || due[1].Key != "c.pdf" {
+		t.Errorf("expected the deletions of a.pdf, and c.pdf to remain, got %+v", due)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "retention.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("unable to create file store: %+v", err)
+	}
+	testStore(t, s)
+
+	// The deletions are loaded on restart
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("unable to load file store: %+v", err)
+	}
+	if due, _ := s.Due(time.Now().Add(2*time.Hour), 10); len(due) != 2 {
+		t.Errorf("expected 2 deletions to be loaded, got %+v", due)
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sqlite.Open(filepath.Join(dir, "weaver.db"))
+	if err != nil {
+		t.Fatalf("unable to open database: %+v", err)
+	}
+	defer db.Close()
+	testStore(t, NewSQLStore(db))
+}
+
+// mockDeleter fails to delete the objects in failing.
+type mockDeleter struct {
+	deleted []string
+	failing map[string]bool
+}
+
+func (m *mockDeleter) Delete(d Deletion) error {
+	if m.failing[d.Key] {
+		return errors.New("access denied")
+	}
+	m.deleted = append(m.deleted, d.Key)
+	return nil
+}
+
+func TestJanitor_Run(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	for i := 0; i < batchSize+10; i++ {
+		s.Add(Deletion{Bucket: "b", Key: fmt.Sprintf("%d.pdf", i), Due: now.Add(-time.Minute)})
+	}
+	s.Add(Deletion{Bucket: "b", Key: "failing", Due: now.Add(-time.Hour)})
+	s.Add(Deletion{Bucket: "b", Key: "kept", Due: now.Add(time.Hour)})
+
+	d := &mockDeleter{failing: map[string]bool{"failing": true}}
+	var notified, failed int
+	j := Janitor{Store: s, Deleter: d, Notify: func(_ Deletion, err error) {
+		notified++
+		if err != nil {
+			failed++
+		}
+	}}
+	n, err := j.Run(now)
+	if err != nil {
+		t.Fatalf("run returned an unexpected error: %+v", err)
+	}
+	if got, want := n, batchSize+10; got != want || len(d.deleted) != want {
+		t.Errorf("expected %d objects to be deleted, got %d", want, got)
+	}
+	if notified < n+1 || failed < 1 {
+		t.Errorf("expected every deletion to be notified, got %d (%d failed)", notified, failed)
+	}
+	if due, _ := s.Due(now.Add(2*time.Hour), 10); len(due) != 2 {
+		t.Errorf("expected the failed, and kept deletions to remain, got %+v", due)
+	}
+}
@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLStore stores scheduled deletions in the 'weaver_retention' table of a
+// PostgreSQL database (see the postgres package), so that they are shared by
+// all instances, or of an embedded SQLite database (see the sqlite package).
+// Times are stored as Unix nanoseconds, so that both databases share the
+// schema.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store using a migrated database.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db}
+}
+
+// Add schedules a deletion, unless the object is already due later.
+func (s *SQLStore) Add(d Deletion) error {
+	_, err := s.db.Exec(`INSERT INTO weaver_retention (bucket, key, region, due, job, tenant)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (bucket, key) DO UPDATE SET
+			region = excluded.region, due = excluded.due, job = excluded.job, tenant = excluded.tenant
+		WHERE excluded.due > weaver_retention.due`,
+		d.Bucket, d.Key, d.Region, d.Due.UnixNano(), d.Job, d.Tenant,
+	)
+	return err
+}
+
+// Due returns at most limit deletions due before t, the earliest first.
+func (s *SQLStore) Due(t time.Time, limit int) ([]Deletion, error) {
+	rows, err := s.db.Query(`SELECT bucket, key, region, due, job, tenant FROM weaver_retention
+		WHERE due < $1 ORDER BY due LIMIT $2`, t.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []Deletion
+	for rows.Next() {
+		var d Deletion
+		var ns int64
+		if err := rows.Scan(&d.Bucket, &d.Key, &d.Region, &ns, &d.Job, &d.Tenant); err != nil {
+			return nil, err
+		}
+		d.Due = time.Unix(0, ns).UTC()
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// Remove removes the deletion of an object.
+func (s *SQLStore) Remove(bucket, key string) error {
+	_, err := s.db.Exec("DELETE FROM weaver_retention WHERE bucket = $1 AND key = $2", bucket, key)
+	return err
+}
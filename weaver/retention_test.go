@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func TestRetentionDays(t *testing.T) {
+	tests := []struct {
+		days   int
+		tenant int
+		query  string
+		want   int
+		err    error
+	}{
+		{0, 0, "", 0, nil},
+		{0, 0, "?retention_days=3650", 3650, nil},
+		{0, 0, "?retention_days=3651", 0, ErrRetentionInvalid},
+		{30, 0, "", 30, nil},
+		{30, 0, "?retention_days=7", 7, nil},
+		{30, 0, "?retention_days=31", 0, ErrRetentionInvalid},
+		{30, 90, "", 90, nil},
+		{30, 90, "?retention_days=60", 60, nil},
+		{0, 7, "?retention_days=8", 0, ErrRetentionInvalid},
+	}
+	for _, tt := range tests {
+		var got int
+		var err error
+		conf := defaultConfig()
+		conf.Retention.Days = tt.days
+		r := gin.New()
+		r.Use(ConfigMiddleware(conf))
+		r.GET("/", func(c *gin.Context) {
+			if tt.tenant != 0 {
+				c.Set("tenant", tenant.Tenant{ID: "acme", RetentionDays: tt.tenant})
+			}
+			got, err = retentionDays(c)
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want || err != tt.err {
+			t.Errorf("expected retention of %q (default %d, tenant %d) to be %d (%v), got %d (%v)", tt.query, tt.days, tt.tenant, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestObjectDeletions(t *testing.T) {
+	expires := time.Now().UTC().AddDate(0, 0, 30)
+	o := &converter.S3Object{
+		Key:     "reports/a.pdf",
+		Bucket:  "reports",
+		Region:  "eu-west-1",
+		Expires: expires,
+		Source:  &converter.S3Object{Key: "reports/a.source.html", Bucket: "reports", Region: "eu-west-1", Expires: expires},
+		Archive: &converter.S3Object{Key: "reports/a.warc", Bucket: "reports", Region: "eu-west-1", Expires: expires},
+	}
+	deletions := objectDeletions(o, "job-1", "acme")
+	if got, want := len(deletions), 3; got != want {
+		t.Fatalf("expected %d deletions, got %+v", want, deletions)
+	}
+	if d := deletions[1]; d.Key != "reports/a.source.html" || d.Bucket != "reports" || d.Region != "eu-west-1" || !d.Due.Equal(expires) || d.Job != "job-1" || d.Tenant != "acme" {
+		t.Errorf("expected the deletion of the source, got %+v", d)
+	}
+	if d := deletions[2]; d.Key != "reports/a.warc" {
+		t.Errorf("expected the deletion of the archive, got %+v", d)
+	}
+	if deletions := objectDeletions(&converter.S3Object{Key: "a.pdf", Bucket: "reports"}, "job-1", ""); len(deletions) != 0 {
+		t.Errorf("expected an object without retention to be kept, got %+v", deletions)
+	}
+	if deletions := objectDeletions(new(converter.S3Object), "job-1", ""); len(deletions) != 0 {
+		t.Errorf("expected an object that was not uploaded to be kept, got %+v", deletions)
+	}
+}
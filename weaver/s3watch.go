@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/s3watch"
+	"github.com/satori/go.uuid"
+)
+
+// watchedSourceExpiry is how long the presigned URL a watched document is
+// fetched from is valid for.
+const watchedSourceExpiry = time.Minute * 15
+
+// StartS3Watch starts watching the bucket whose event notifications are sent
+// to the configured queue (see S3Watch), if any, converting the documents
+// dropped into its input prefix with the consumer.
+func StartS3Watch(conf Config, c Consumer, done <-chan struct{}) {
+	if conf.S3Watch.QueueURL == "" {
+		return
+	}
+	w := s3watch.New(conf.S3Watch.Region, conf.S3Watch.QueueURL, int64(conf.Queue.VisibilityTimeout))
+	w.Start(conf.Queue.Consumers, c.convertObject, done)
+	log.Printf("Watching S3 objects created under %q (%s)\n", conf.S3Watch.InputPrefix, conf.S3Watch.QueueURL)
+}
+
+// watchedJob returns the job converting an object created in a watched
+// bucket, uploading its output to the output prefix (see S3Watch). It returns
+// false if the object is not a document to convert.
+func watchedJob(conf Config, o s3watch.Object) (queue.Job, bool) {
+	w := conf.S3Watch
+	if !strings.HasPrefix(o.Key, w.InputPrefix) || strings.HasSuffix(o.Key, "/") {
+		return queue.Job{}, false
+	}
+	if w.OutputBucket == "" && strings.HasPrefix(o.Key, w.OutputPrefix) {
+		return queue.Job{}, false
+	}
+	ext := path.Ext(o.Key)
+	if !watchedExtension(w.Extensions, ext) {
+		return queue.Job{}, false
+	}
+
+	bucket := w.OutputBucket
+	if bucket == "" {
+		bucket = o.Bucket
+	}
+	rel := strings.TrimPrefix(o.Key, w.InputPrefix)
+	j := queue.Job{
+		ID:  uuid.NewV4().String(),
+		Ext: strings.ToLower(ext[1:]),
+	}
+	j.AWSS3.Region = w.Region
+	j.AWSS3.S3Bucket = bucket
+	j.AWSS3.S3Key = w.OutputPrefix + strings.TrimSuffix(rel, ext) + ".pdf"
+	return j, true
+}
+
+// watchedExtension returns true if an extension (with its dot) is one of the
+// watched extensions.
+func watchedExtension(extensions []string, ext string) bool {
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if strings.EqualFold(e, ext[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// presignObject returns a URL the object can be fetched from without
+// credentials, until it expires.
+func presignObject(conf Config, o s3watch.Object) (string, error) {
+	region := conf.S3Watch.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	awsConf := aws.NewConfig().WithRegion(region).WithMaxRetries(3)
+	if conf.S3.AccessKey != "" && conf.S3.AccessSecret != "" {
+		awsConf = awsConf.WithCredentials(credentials.NewStaticCredentials(conf.S3.AccessKey, conf.S3.AccessSecret, ""))
+	}
+	req, _ := s3.New(session.New(awsConf)).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(o.Bucket),
+		Key:    aws.String(o.Key),
+	})
+	return req.Presign(watchedSourceExpiry)
+}
+
+// convertObject converts an object created in a watched bucket, if it is a
+// document to convert (see watchedJob).
+func (c Consumer) convertObject(o s3watch.Object) error {
+	j, ok := watchedJob(c.Conf, o)
+	if !ok {
+		return nil
+	}
+	u, err := presignObject(c.Conf, o)
+	if err != nil {
+		return err
+	}
+	j.URL = u
+	j = jobDestination(c.Conf, j)
+
+	log.Printf("[S3Watch] converting s3://%s/%s to s3://%s/%s (job %s)\n", o.Bucket, o.Key, j.AWSS3.S3Bucket, j.AWSS3.S3Key, j.ID)
+	events.Emit(c.jobEvents(j), events.Queued, j.ID, j.URL, nil)
+	if _, err := c.process(j); err != nil {
+		c.Statsd.Increment("s3_watch_failed")
+		return err
+	}
+	c.Statsd.Increment("s3_watch_success")
+	return nil
+}
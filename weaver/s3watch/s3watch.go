@@ -0,0 +1,225 @@
+// Package s3watch receives the event notifications of objects created in an
+// S3 bucket from an SQS queue, so that they can be processed as they are
+// dropped into the bucket.
+package s3watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ErrNotificationInvalid is returned when a message is not an S3 event
+// notification.
+var ErrNotificationInvalid = errors.New("invalid S3 event notification")
+
+// Object is an object created in a bucket.
+type Object struct {
+	Bucket string
+	Key    string
+	Size   int64
+	ETag   string
+}
+
+// notification is an S3 event notification, see:
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/notification-content-structure.html
+type notification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+	// Event is set by the test event sent when the notifications of a
+	// bucket are configured ('s3:TestEvent').
+	Event string `json:"Event"`
+}
+
+// envelope is an SNS notification, whose message is the S3 event
+// notification if the bucket publishes to an SNS topic the queue is
+// subscribed to (without raw message delivery).
+type envelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseNotification returns the objects created in an S3 event notification
+// (either as sent by S3, or wrapped by SNS). Other events (e.g. removals, and
+// the test event) are ignored.
+func ParseNotification(body []byte) ([]Object, error) {
+	var e envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, ErrNotificationInvalid
+	}
+	if e.Type == "Notification" {
+		body = []byte(e.Message)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, ErrNotificationInvalid
+	}
+	if n.Event == "s3:TestEvent" {
+		return nil, nil
+	}
+	if n.Records == nil {
+		return nil, ErrNotificationInvalid
+	}
+
+	var objects []Object
+	for _, r := range n.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") {
+			continue
+		}
+		// Keys are URL encoded (with spaces as '+')
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, ErrNotificationInvalid
+		}
+		objects = append(objects, Object{
+			Bucket: r.S3.Bucket.Name,
+			Key:    key,
+			Size:   r.S3.Object.Size,
+			ETag:   r.S3.Object.ETag,
+		})
+	}
+	return objects, nil
+}
+
+// HandlerFunc processes a created object. The notification is received again
+// (once its visibility timeout expires) if it returns an error.
+type HandlerFunc func(Object) error
+
+// Watcher receives the event notifications of a bucket from an SQS queue.
+type Watcher struct {
+	svc *sqs.SQS
+	// QueueURL is the URL of the SQS queue.
+	QueueURL string
+	// VisibilityTimeout is the number of seconds a received notification is
+	// hidden from other watchers. It should be greater than the time it
+	// takes to process its objects.
+	VisibilityTimeout int64
+	// WaitTime is the number of seconds to long poll for (max. 20).
+	WaitTime int64
+}
+
+// New creates a watcher of the queue URL in the given region. Credentials are
+// resolved using the default AWS credential chain.
+func New(region, queueURL string, visibilityTimeout int64) *Watcher {
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	return &Watcher{
+		svc:               sqs.New(sess),
+		QueueURL:          queueURL,
+		VisibilityTimeout: visibilityTimeout,
+		WaitTime:          20,
+	}
+}
+
+// Start starts n goroutines receiving notifications, and handling their
+// objects, until done is closed. A notification is deleted once all of its
+// objects have been handled, or if it is invalid.
+func (w *Watcher) Start(n int, handle HandlerFunc, done <-chan struct{}) {
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go w.watch(i, handle, done)
+	}
+}
+
+func (w *Watcher) watch(id int, handle HandlerFunc, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		m, err := w.receive(done)
+		if err != nil {
+			log.Printf("[S3Watch #%d] unable to receive notification: %+v\n", id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+
+		objects, err := ParseNotification([]byte(aws.StringValue(m.Body)))
+		if err != nil {
+			log.Printf("[S3Watch #%d] discarding message %s: %+v\n", id, aws.StringValue(m.MessageId), err)
+		}
+		failed := false
+		for _, o := range objects {
+			if err := handle(o); err != nil {
+				log.Printf("[S3Watch #%d] unable to process s3://%s/%s: %+v\n", id, o.Bucket, o.Key, err)
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+		if err := w.delete(m); err != nil {
+			log.Printf("[S3Watch #%d] unable to delete message %s: %+v\n", id, aws.StringValue(m.MessageId), err)
+		}
+	}
+}
+
+// receive long polls the queue for a single message. It returns a nil
+// message if none was received before the poll expired.
+func (w *Watcher) receive(done <-chan struct{}) (*sqs.Message, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := w.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(w.QueueURL),
+		MaxNumberOfMessages: aws.Int64(1),
+		VisibilityTimeout:   aws.Int64(w.VisibilityTimeout),
+		WaitTimeSeconds:     aws.Int64(w.WaitTime),
+	})
+	if err != nil {
+		select {
+		case <-done:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	if len(res.Messages) == 0 {
+		return nil, nil
+	}
+	return res.Messages[0], nil
+}
+
+func (w *Watcher) delete(m *sqs.Message) error {
+	_, err := w.svc.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(w.QueueURL),
+		ReceiptHandle: m.ReceiptHandle,
+	})
+	return err
+}
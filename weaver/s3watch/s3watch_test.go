@@ -0,0 +1,57 @@
+package s3watch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const created = `{"Records":[
+	{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"drops"},"object":{"key":"in/q1+report%282%29.html","size":1024,"eTag":"abc"}}},
+	{"eventName":"ObjectRemoved:Delete","s3":{"bucket":{"name":"drops"},"object":{"key":"in/old.html"}}}
+]}`
+
+func TestParseNotification(t *testing.T) {
+	objects, err := ParseNotification([]byte(created))
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := len(objects), 1; got != want {
+		t.Fatalf("expected %d object, got %d", want, got)
+	}
+	want := Object{Bucket: "drops", Key: "in/q1 report(2).html", Size: 1024, ETag: "abc"}
+	if got := objects[0]; got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestParseNotification_sns(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": created})
+	objects, err := ParseNotification(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := len(objects), 1; got != want {
+		t.Fatalf("expected %d object, got %d", want, got)
+	}
+	if got, want := objects[0].Key, "in/q1 report(2).html"; got != want {
+		t.Errorf("expected key %q, got %q", want, got)
+	}
+}
+
+func TestParseNotification_testEvent(t *testing.T) {
+	objects, err := ParseNotification([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"drops"}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("expected no objects, got %+v", objects)
+	}
+}
+
+func TestParseNotification_invalid(t *testing.T) {
+	for _, body := range []string{"", "not json", `{"id":"job"}`, `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"%zz"}}}]}`} {
+		if _, err := ParseNotification([]byte(body)); err != ErrNotificationInvalid {
+			t.Errorf("expected %v for %q, got %+v", ErrNotificationInvalid, body, err)
+		}
+	}
+}
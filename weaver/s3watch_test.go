@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/s3watch"
+)
+
+func TestWatchedJob(t *testing.T) {
+	conf := defaultConfig()
+	conf.S3Watch.Region = "eu-west-1"
+	tests := []struct {
+		key    string
+		output string
+		ext    string
+		ok     bool
+	}{
+		{"in/report.html", "out/report.pdf", "html", true},
+		{"in/2018/q1 report.HTM", "out/2018/q1 report.pdf", "htm", true},
+		{"in/report.docx", "", "", false},
+		{"in/report", "", "", false},
+		{"in/2018/", "", "", false},
+		{"other/report.html", "", "", false},
+	}
+	for _, tt := range tests {
+		j, ok := watchedJob(conf, s3watch.Object{Bucket: "drops", Key: tt.key})
+		if ok != tt.ok {
+			t.Errorf("expected %v for %q, got %v", tt.ok, tt.key, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got, want := j.AWSS3.S3Key, tt.output; got != want {
+			t.Errorf("expected key %q for %q, got %q", want, tt.key, got)
+		}
+		if got, want := j.AWSS3.S3Bucket, "drops"; got != want {
+			t.Errorf("expected bucket %q for %q, got %q", want, tt.key, got)
+		}
+		if got, want := j.AWSS3.Region, "eu-west-1"; got != want {
+			t.Errorf("expected region %q for %q, got %q", want, tt.key, got)
+		}
+		if got, want := j.Ext, tt.ext; got != want {
+			t.Errorf("expected ext %q for %q, got %q", want, tt.key, got)
+		}
+		if j.ID == "" {
+			t.Errorf("expected a job ID for %q", tt.key)
+		}
+	}
+}
+
+func TestWatchedJob_outputBucket(t *testing.T) {
+	conf := defaultConfig()
+	conf.S3Watch.InputPrefix, conf.S3Watch.OutputPrefix, conf.S3Watch.OutputBucket = "", "", "pdfs"
+	j, ok := watchedJob(conf, s3watch.Object{Bucket: "drops", Key: "a/report.html"})
+	if !ok {
+		t.Fatal("expected a job")
+	}
+	if got, want := j.AWSS3.S3Bucket+"/"+j.AWSS3.S3Key, "pdfs/a/report.pdf"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,157 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ConfineCommand is the command of weaver that confines a process before
+// running it (see Confine).
+const ConfineCommand = "confine"
+
+// maxFilterInstructions is the maximum number of instructions of a seccomp
+// filter (BPF_MAXINSNS).
+const maxFilterInstructions = 4096
+
+var (
+	// ErrConfinementUnsupported is returned when processes are confined on a
+	// system without seccomp, or AppArmor.
+	ErrConfinementUnsupported = errors.New("seccomp, and AppArmor are only supported on Linux")
+	// ErrAppArmorDisabled is returned when processes are confined by an
+	// AppArmor profile, but AppArmor is not enabled.
+	ErrAppArmorDisabled = errors.New("AppArmor is not enabled")
+	// ErrFilterInvalid is returned when a seccomp filter is not a compiled
+	// BPF program.
+	ErrFilterInvalid = errors.New("seccomp filter must be a compiled BPF program of 1 to 4096 instructions")
+)
+
+// Confinement restricts what the processes of sandboxes may do, to contain
+// the exploitation of the renderer.
+type Confinement struct {
+	// Seccomp is the path of a seccomp filter of the system calls of the
+	// processes: a compiled BPF program, as exported by libseccomp (e.g.
+	// seccomp_export_bpf).
+	Seccomp string
+	// AppArmor is the name of a loaded AppArmor profile the processes run
+	// under.
+	AppArmor string
+}
+
+// Confine sets the confinement of the processes of the sandboxes of the
+// pool. The filter is checked now, so that a broken filter fails on start,
+// rather than every conversion. Processes are confined by running them
+// through weaver (launcher is its executable), which must be executable by
+// the users of the sandboxes.
+func (p *Pool) Confine(launcher string, c Confinement) error {
+	if c.Seccomp != "" {
+		if err := CheckFilter(c.Seccomp); err != nil {
+			return err
+		}
+	}
+	if err := checkConfinement(c); err != nil {
+		return err
+	}
+	p.launcher = launcher
+	p.confinement = c
+	return nil
+}
+
+// CheckFilter checks that the file at path is a compiled seccomp filter.
+func CheckFilter(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return checkFilter(b)
+}
+
+// checkFilter checks the size of a compiled seccomp filter.
+func checkFilter(b []byte) error {
+	if len(b) == 0 || len(b)%8 != 0 || len(b)/8 > maxFilterInstructions {
+		return ErrFilterInvalid
+	}
+	return nil
+}
+
+// Command returns the command that runs c in the gVisor container of the
+// sandbox, or under its confinement, if any. env are the environment
+// variables of c (also given to gcmd), which the container does not
+// inherit. The seccomp filter is inherited as file descriptor 3, as the
+// sandbox user may not be able to read it.
+func (s *Sandbox) Command(c []string, env []string) []string {
+	if s.container != "" {
+		return s.p.gvisor.exec(s, c, env)
+	}
+	if s.p == nil || s.p.launcher == "" {
+		return c
+	}
+	cmd := []string{s.p.launcher, ConfineCommand}
+	if s.filter != nil {
+		cmd = append(cmd, "--seccomp-fd=3")
+	}
+	if s.p.confinement.AppArmor != "" {
+		cmd = append(cmd, "--apparmor="+s.p.confinement.AppArmor)
+	}
+	return append(append(cmd, "--"), c...)
+}
+
+// confineArgs parses the arguments of ConfineCommand: the file descriptor
+// of the seccomp filter (-1 if there is none), the AppArmor profile, and
+// the command.
+func confineArgs(args []string) (int, string, []string, error) {
+	fd, profile := -1, ""
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			if i == len(args)-1 {
+				return 0, "", nil, errors.New("no command to confine")
+			}
+			return fd, profile, args[i+1:], nil
+		case strings.HasPrefix(arg, "--seccomp-fd="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--seccomp-fd="))
+			if err != nil || n < 0 {
+				return 0, "", nil, fmt.Errorf("invalid seccomp file descriptor %q", arg)
+			}
+			fd = n
+		case strings.HasPrefix(arg, "--apparmor="):
+			profile = strings.TrimPrefix(arg, "--apparmor=")
+		default:
+			return 0, "", nil, fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+	return 0, "", nil, errors.New("no command to confine")
+}
+
+// Confine runs a command under a confinement: it is given the arguments of
+// ConfineCommand ('--seccomp-fd=N', and '--apparmor=PROFILE', followed by
+// '--', and the command), and it replaces the current process with the
+// command. It only returns if the command could not be run.
+func Confine(args []string) error {
+	fd, profile, cmd, err := confineArgs(args)
+	if err != nil {
+		return err
+	}
+	var filter []byte
+	if fd >= 0 {
+		// The file is read from its start, without moving its offset, as it
+		// is shared with weaver, and every command of the sandbox
+		f := os.NewFile(uintptr(fd), "seccomp")
+		info, err := f.Stat()
+		if err == nil {
+			filter, err = ioutil.ReadAll(io.NewSectionReader(f, 0, info.Size()))
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err := checkFilter(filter); err != nil {
+			return err
+		}
+	}
+	return confine(filter, profile, cmd)
+}
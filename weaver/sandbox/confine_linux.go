@@ -0,0 +1,76 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	prSetNoNewPrivs   = 38
+	seccompModeFilter = 2
+)
+
+// checkConfinement checks that the system supports a confinement.
+func checkConfinement(c Confinement) error {
+	if c.AppArmor == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile("/sys/module/apparmor/parameters/enabled")
+	if err != nil || !bytes.HasPrefix(b, []byte("Y")) {
+		return ErrAppArmorDisabled
+	}
+	return nil
+}
+
+// changeProfileOnExec sets the AppArmor profile the current thread changes
+// to when it executes a program (as aa-exec does).
+func changeProfileOnExec(profile string) error {
+	value := []byte("exec " + profile)
+	err := ioutil.WriteFile("/proc/thread-self/attr/apparmor/exec", value, 0)
+	if os.IsNotExist(err) {
+		// Kernels without the AppArmor specific interface
+		err = ioutil.WriteFile("/proc/thread-self/attr/exec", value, 0)
+	}
+	return err
+}
+
+// confine confines the current thread by an AppArmor profile, and a seccomp
+// filter (if any), and executes a command on it.
+func confine(filter []byte, profile string, cmd []string) error {
+	// The confinement is set up for, and inherited from the current thread
+	runtime.LockOSThread()
+
+	path, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return err
+	}
+	if profile != "" {
+		if err := changeProfileOnExec(profile); err != nil {
+			return err
+		}
+	}
+	if len(filter) > 0 {
+		// Unprivileged processes may only set filters without gaining
+		// privileges from then on (e.g. through setuid programs)
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+			return errno
+		}
+		prog := syscall.SockFprog{
+			Len:    uint16(len(filter) / 8),
+			Filter: (*syscall.SockFilter)(unsafe.Pointer(&filter[0])),
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+			return errno
+		}
+	}
+	return syscall.Exec(path, cmd, os.Environ())
+}
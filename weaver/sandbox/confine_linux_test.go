@@ -0,0 +1,97 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package sandbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+// TestMain lets the test binary confine commands, as weaver does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == ConfineCommand {
+		err := Confine(os.Args[2:])
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(126)
+	}
+	os.Exit(m.Run())
+}
+
+// denyMkdir returns a seccomp filter that fails the creation of
+// directories with EPERM.
+func denyMkdir() []byte {
+	const (
+		ldAbs  = 0x20
+		jeq    = 0x15
+		ret    = 0x06
+		allow  = 0x7fff0000
+		errno  = 0x00050000
+		ldNr   = 0
+		denied = errno | uint32(syscall.EPERM)
+	)
+	prog := []struct {
+		Code   uint16
+		Jt, Jf uint8
+		K      uint32
+	}{
+		{ldAbs, 0, 0, ldNr},
+		{jeq, 2, 0, syscall.SYS_MKDIR},
+		{jeq, 1, 0, syscall.SYS_MKDIRAT},
+		{ret, 0, 0, allow},
+		{ret, 0, 0, denied},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, prog)
+	return b.Bytes()
+}
+
+func TestPool_Confine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	filter := filepath.Join(dir, "filter.bpf")
+	ioutil.WriteFile(filter, denyMkdir(), 0600)
+	launcher, err := os.Executable()
+	if err != nil {
+		t.Fatalf("unable to find test executable: %+v", err)
+	}
+
+	p, _ := NewPool(filepath.Join(dir, "sandboxes"), 1, 0, false)
+	ioutil.WriteFile(filepath.Join(dir, "broken.bpf"), []byte("filter"), 0600)
+	if err := p.Confine(launcher, Confinement{Seccomp: filepath.Join(dir, "broken.bpf")}); err != ErrFilterInvalid {
+		t.Errorf("expected error of a broken filter to be %v, got %v", ErrFilterInvalid, err)
+	}
+	if err := p.Confine(launcher, Confinement{Seccomp: filter}); err != nil {
+		t.Fatalf("unable to confine pool: %+v", err)
+	}
+	s, _ := p.Acquire(nil)
+	defer s.Release()
+
+	// The filter is read again by every command
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		_, err := gcmd.ExecuteIsolated(s.Command([]string{"sh", "-c", "echo confined; mkdir blocked || { echo denied >&2; exit 3; }"}, s.Env()), s.Env(), s.Isolation(), &out, nil, nil)
+		if err == nil {
+			t.Errorf("expected the filter to deny mkdir")
+		} else if e, ok := err.(*gcmd.ExitError); !ok || e.ExitCode != 3 {
+			t.Errorf("expected mkdir to be denied, got %v", err)
+		}
+		if got, want := out.String(), "confined\n"; got != want {
+			t.Errorf("expected the confined command to run (%q), got %q (%v)", want, got, err)
+		}
+		if _, err := os.Stat(filepath.Join(s.Dir, "blocked")); !os.IsNotExist(err) {
+			t.Errorf("expected the directory not to be created, got %v", err)
+		}
+	}
+}
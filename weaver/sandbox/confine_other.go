@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+// checkConfinement checks that the system supports a confinement.
+func checkConfinement(c Confinement) error {
+	if c.Seccomp != "" || c.AppArmor != "" {
+		return ErrConfinementUnsupported
+	}
+	return nil
+}
+
+// confine confines the current process, and executes a command.
+func confine(filter []byte, profile string, cmd []string) error {
+	return ErrConfinementUnsupported
+}
@@ -0,0 +1,46 @@
+package sandbox
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfineArgs(t *testing.T) {
+	fd, profile, cmd, err := confineArgs([]string{"--seccomp-fd=3", "--apparmor=weaver-renderer", "--", "athenapdf", "--"})
+	if err != nil {
+		t.Fatalf("unable to parse arguments: %+v", err)
+	}
+	if fd != 3 || profile != "weaver-renderer" || !reflect.DeepEqual(cmd, []string{"athenapdf", "--"}) {
+		t.Errorf("expected the filter, profile, and command to be parsed, got %d, %q, and %v", fd, profile, cmd)
+	}
+	for _, args := range [][]string{{"athenapdf"}, {"--seccomp-fd=x", "--", "athenapdf"}, {"--"}} {
+		if _, _, _, err := confineArgs(args); err == nil {
+			t.Errorf("expected arguments %v to be invalid", args)
+		}
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	if err := checkFilter(make([]byte, 16)); err != nil {
+		t.Errorf("expected filter of 2 instructions to be valid, got %v", err)
+	}
+	for _, n := range []int{0, 12, 8 * (maxFilterInstructions + 1)} {
+		if err := checkFilter(make([]byte, n)); err != ErrFilterInvalid {
+			t.Errorf("expected error of a filter of %d bytes to be %v, got %v", n, ErrFilterInvalid, err)
+		}
+	}
+}
+
+func TestSandbox_Command(t *testing.T) {
+	p := &Pool{launcher: "/usr/bin/weaver", confinement: Confinement{AppArmor: "weaver-renderer"}}
+	s := &Sandbox{UID: -1, p: p, filter: os.Stdin}
+	got := s.Command([]string{"athenapdf", "-S"}, nil)
+	want := []string{"/usr/bin/weaver", ConfineCommand, "--seccomp-fd=3", "--apparmor=weaver-renderer", "--", "athenapdf", "-S"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected confined command to be %v, got %v", want, got)
+	}
+	if got := (&Sandbox{UID: -1}).Command([]string{"athenapdf"}, nil); len(got) != 1 {
+		t.Errorf("expected the command of an unconfined sandbox to be unchanged, got %v", got)
+	}
+}
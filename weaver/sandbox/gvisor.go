@@ -0,0 +1,301 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bundleSuffix is the suffix of the OCI bundle directory of a sandbox,
+// beside its directory.
+const bundleSuffix = ".bundle"
+
+// displayCommand runs the commands of containers with an X server of their
+// own (Xvfb), as the X server of the host cannot be reached from them: its
+// socket is on the /tmp of the host, and containers have their own.
+var displayCommand = []string{"xvfb-run", "--auto-servernum", "--server-args=-screen 0 1024x768x24 -nolisten tcp"}
+
+// refillDelay is the time to wait before starting a container again, after
+// it could not be started.
+var refillDelay = time.Second * 5
+
+var (
+	// ErrGVisorConfined is returned when sandboxes run in gVisor containers,
+	// and under a seccomp filter, or AppArmor profile.
+	ErrGVisorConfined = errors.New("gVisor containers cannot be confined by a seccomp filter, or AppArmor profile")
+	// ErrGVisorRootfs is returned when gVisor containers are not given a
+	// dedicated root file system, as the file system of the host would
+	// expose its files (e.g. credentials) to the containers.
+	ErrGVisorRootfs = errors.New("gVisor containers require a dedicated root file system (not the file system of the host)")
+	// ErrGVisorNetNS is returned when gVisor containers are not given a
+	// network namespace.
+	ErrGVisorNetNS = errors.New("gVisor containers require a network namespace")
+)
+
+// GVisor is the configuration of the gVisor containers of sandboxes.
+type GVisor struct {
+	// Runsc is the path of the gVisor runtime (runsc).
+	Runsc string
+	// Rootfs is the root file system of the containers (a directory with
+	// athenapdf CLI, and its dependencies only, including xvfb-run, Xvfb,
+	// and xauth), which is mounted read-only. It must not be the file
+	// system of the host.
+	Rootfs string
+	// NetNS is the path of the network namespace of the containers (e.g.
+	// '/var/run/netns/weaver'), whose interfaces the network stack of
+	// gVisor uses. It should only reach an egress proxy, which the renderer
+	// is configured to use.
+	NetNS string
+	// Platform is the gVisor platform (e.g. 'systrap', or 'kvm'), or empty
+	// for the default of runsc.
+	Platform string
+	// Warm is the number of containers started ahead of conversions.
+	Warm int
+}
+
+// gvisor runs the sandboxes of a pool in gVisor containers: a container is
+// started for every sandbox ahead of time, and it is destroyed (with every
+// process in it) once the sandbox is released, as a used container is not
+// trusted again.
+type gvisor struct {
+	GVisor
+	// root is the directory of the state of runsc.
+	root    string
+	started chan *Sandbox
+}
+
+// ociSpec is the subset of the OCI runtime specification of a container
+// used by the sandboxes.
+type ociSpec struct {
+	Version  string      `json:"ociVersion"`
+	Process  ociProcess  `json:"process"`
+	Root     ociRoot     `json:"root"`
+	Hostname string      `json:"hostname"`
+	Mounts   []ociMount  `json:"mounts"`
+	Linux    ociPlatform `json:"linux"`
+}
+
+type ociProcess struct {
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	Cwd  string   `json:"cwd"`
+	User ociUser  `json:"user"`
+}
+
+type ociUser struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+type ociRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type ociMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type ociNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+type ociPlatform struct {
+	Namespaces []ociNamespace `json:"namespaces"`
+}
+
+// UseGVisor runs the sandboxes of the pool in gVisor containers, which
+// intercept the system calls of their processes in a kernel of their own,
+// rather than exposing the kernel of the host, and whose network stack is
+// gVisor's own, in the network namespace g.NetNS. Containers left behind by
+// a previous process are destroyed, and g.Warm containers are started. runsc
+// requires weaver to run as root.
+func (p *Pool) UseGVisor(g GVisor) error {
+	if p.launcher != "" {
+		return ErrGVisorConfined
+	}
+	root, err := os.Stat(g.Rootfs)
+	if g.Rootfs == "" || err != nil || !root.IsDir() {
+		return ErrGVisorRootfs
+	}
+	if host, err := os.Stat("/"); err == nil && os.SameFile(root, host) {
+		return ErrGVisorRootfs
+	}
+	if g.NetNS == "" {
+		return ErrGVisorNetNS
+	}
+	if _, err := os.Stat(g.NetNS); err != nil {
+		return fmt.Errorf("invalid network namespace: %v", err)
+	}
+	if os.Geteuid() != 0 {
+		return ErrNotPrivileged
+	}
+	runsc, err := exec.LookPath(g.Runsc)
+	if err != nil {
+		return err
+	}
+	g.Runsc = runsc
+	if g.Warm < 1 {
+		g.Warm = 1
+	}
+	v := &gvisor{GVisor: g, root: filepath.Join(p.dir, "runsc"), started: make(chan *Sandbox, g.Warm)}
+	if err := os.MkdirAll(v.root, 0700); err != nil {
+		return err
+	}
+	out, err := exec.Command(runsc, "--root", v.root, "list", "-q").Output()
+	if err != nil {
+		return fmt.Errorf("unable to list gVisor containers: %v", err)
+	}
+	for _, id := range strings.Fields(string(out)) {
+		exec.Command(runsc, "--root", v.root, "delete", "--force", id).Run()
+	}
+
+	p.gvisor = v
+	for i := 0; i < g.Warm; i++ {
+		go p.refill()
+	}
+	return nil
+}
+
+// acquireStarted takes a sandbox whose container is started, and starts a
+// container for another one.
+func (p *Pool) acquireStarted(terminate <-chan struct{}) (*Sandbox, error) {
+	select {
+	case s := <-p.gvisor.started:
+		go p.refill()
+		return s, nil
+	case <-terminate:
+		return nil, ErrTerminated
+	}
+}
+
+// refill creates a sandbox, and starts its container, until it succeeds.
+func (p *Pool) refill() {
+	for {
+		s, err := p.create(nil)
+		if err == nil {
+			if err = p.gvisor.start(s); err == nil {
+				p.gvisor.started <- s
+				return
+			}
+			s.Release()
+		}
+		log.Printf("[Sandbox] unable to start gVisor container: %+v\n", err)
+		time.Sleep(refillDelay)
+	}
+}
+
+// command returns the runsc command with the given arguments. Containers use
+// the network stack of gVisor (rather than the one of the host), on the
+// interfaces of their network namespace.
+func (v *gvisor) command(args ...string) []string {
+	cmd := []string{v.Runsc, "--root", v.root, "--network", "sandbox"}
+	if v.Platform != "" {
+		cmd = append(cmd, "--platform", v.Platform)
+	}
+	return append(cmd, args...)
+}
+
+// spec returns the specification of the container of a sandbox: the root
+// file system is read-only, and only the directory of the sandbox, and a
+// private /tmp (where the X server of its commands puts its socket) are
+// writable (the other sandboxes are hidden), and it joins the network
+// namespace of the containers. The container runs an idle process, until
+// commands are executed in it.
+func (v *gvisor) spec(s *Sandbox) ociSpec {
+	user := ociUser{UID: os.Getuid(), GID: os.Getgid()}
+	if s.UID >= 0 {
+		user = ociUser{UID: s.UID, GID: s.UID}
+	}
+	return ociSpec{
+		Version: "1.0.2",
+		Process: ociProcess{
+			Args: []string{"sleep", strconv.Itoa(1<<31 - 1)},
+			Env:  []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			Cwd:  "/",
+			User: user,
+		},
+		Root:     ociRoot{Path: v.Rootfs, Readonly: true},
+		Hostname: "weaver",
+		Mounts: []ociMount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "nodev"}},
+			{Destination: "/tmp", Type: "tmpfs", Source: "tmp", Options: []string{"nosuid", "nodev", "mode=1777"}},
+			{Destination: s.p.dir, Type: "tmpfs", Source: "sandboxes", Options: []string{"nosuid", "nodev"}},
+			{Destination: s.Dir, Type: "bind", Source: s.Dir, Options: []string{"rbind", "rw"}},
+		},
+		Linux: ociPlatform{
+			Namespaces: []ociNamespace{{Type: "pid"}, {Type: "ipc"}, {Type: "uts"}, {Type: "mount"}, {Type: "network", Path: v.NetNS}},
+		},
+	}
+}
+
+// start writes the OCI bundle of a sandbox beside its directory, and starts
+// its container.
+func (v *gvisor) start(s *Sandbox) error {
+	bundle := s.Dir + bundleSuffix
+	if err := os.Mkdir(bundle, 0700); err != nil {
+		return err
+	}
+	if err := v.run(s, bundle); err != nil {
+		os.RemoveAll(bundle)
+		return err
+	}
+	return nil
+}
+
+// run starts the container of a sandbox from its bundle.
+func (v *gvisor) run(s *Sandbox, bundle string) error {
+	b, err := json.Marshal(v.spec(s))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, "config.json"), b, 0600); err != nil {
+		return err
+	}
+	id := filepath.Base(s.Dir)
+	cmd := v.command("run", "--detach", "--bundle", bundle, id)
+	if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	s.container = id
+	return nil
+}
+
+// exec returns the command that executes c in the container of a sandbox,
+// as its user, in its directory, with the environment of the container (its
+// PATH), env, and a display of its own (see displayCommand).
+func (v *gvisor) exec(s *Sandbox, c []string, env []string) []string {
+	spec := v.spec(s)
+	args := []string{"exec", "--cwd", s.Dir, "--user", fmt.Sprintf("%d:%d", spec.Process.User.UID, spec.Process.User.GID)}
+	for _, e := range append(spec.Process.Env, env...) {
+		if !strings.HasPrefix(e, "DISPLAY=") {
+			args = append(args, "--env", e)
+		}
+	}
+	args = append(append(args, s.container), displayCommand...)
+	return v.command(append(args, c...)...)
+}
+
+// destroy kills every process of the container of a sandbox, and deletes
+// the container, and its bundle.
+func (v *gvisor) destroy(s *Sandbox) {
+	cmd := v.command("delete", "--force", s.container)
+	if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		log.Printf("[Sandbox] unable to delete gVisor container %s: %+v: %s\n", s.container, err, out)
+	}
+	os.RemoveAll(s.Dir + bundleSuffix)
+	s.container = ""
+}
@@ -0,0 +1,144 @@
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+// fakeRunsc records the commands of runsc in its log, and executes the
+// commands of containers on the host.
+const fakeRunsc = `#!/bin/sh
+while [ "${1#--}" != "$1" ]; do shift 2; done
+echo "$@" >> "$(dirname "$0")/runsc.log"
+[ "$1" = exec ] || exit 0
+shift
+while [ "${1#--}" != "$1" ]; do
+	case "$1" in
+	--cwd) cd "$2" ;;
+	--env) export "$2" ;;
+	esac
+	shift 2
+done
+shift
+# The display of the container
+[ "$1" = xvfb-run ] && shift 3 && export DISPLAY=:1
+exec "$@"
+`
+
+func TestPool_UseGVisor(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("gVisor requires root")
+	}
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	runsc := filepath.Join(dir, "runsc")
+	ioutil.WriteFile(runsc, []byte(fakeRunsc), 0700)
+
+	rootfs, netns := filepath.Join(dir, "rootfs"), filepath.Join(dir, "netns")
+	os.Mkdir(rootfs, 0700)
+	ioutil.WriteFile(netns, nil, 0600)
+
+	p, _ := NewPool(filepath.Join(dir, "sandboxes"), 1, 0, false)
+	if err := p.UseGVisor(GVisor{Runsc: runsc, Rootfs: rootfs, NetNS: netns, Warm: 1}); err != nil {
+		t.Fatalf("unable to use gVisor: %+v", err)
+	}
+	s, err := p.Acquire(nil)
+	if err != nil {
+		t.Fatalf("unable to acquire sandbox: %+v", err)
+	}
+	if s.container != filepath.Base(s.Dir) {
+		t.Errorf("expected the container of the sandbox to be started, got %q", s.container)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(s.Dir+bundleSuffix, "config.json"))
+	if err != nil {
+		t.Fatalf("unable to read bundle: %+v", err)
+	}
+	var spec ociSpec
+	json.Unmarshal(b, &spec)
+	if !spec.Root.Readonly || spec.Root.Path != rootfs || spec.Mounts[len(spec.Mounts)-1].Destination != s.Dir {
+		t.Errorf("expected a read-only root, with the sandbox directory mounted, got %+v", spec)
+	}
+	if got, want := spec.Linux.Namespaces[len(spec.Linux.Namespaces)-1], (ociNamespace{Type: "network", Path: netns}); got != want {
+		t.Errorf("expected the container to join the network namespace %+v, got %+v", want, got)
+	}
+
+	var out bytes.Buffer
+	env := []string{"LANG=fr_FR.UTF-8"}
+	if _, err := gcmd.ExecuteIsolated(s.Command([]string{"sh", "-c", "pwd; echo $LANG $DISPLAY"}, env), env, s.Isolation(), &out, nil, nil); err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if got, want := out.String(), s.Dir+"\nfr_FR.UTF-8 :1\n"; got != want {
+		t.Errorf("expected the command to run in the container (%q), got %q", want, got)
+	}
+
+	s.Release()
+	if _, err := os.Stat(s.Dir + bundleSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the bundle to be removed, got %v", err)
+	}
+	// The acquired container was replaced
+	next, _ := p.Acquire(nil)
+	next.Release()
+	log, _ := ioutil.ReadFile(filepath.Join(dir, "runsc.log"))
+	if got := strings.Count(string(log), "run --detach"); got < 2 {
+		t.Errorf("expected the container to be replaced, got %s", log)
+	}
+	if !strings.Contains(string(log), "delete --force "+filepath.Base(s.Dir)) {
+		t.Errorf("expected the container to be deleted, got %s", log)
+	}
+}
+
+func TestGVisor_exec(t *testing.T) {
+	v := &gvisor{GVisor: GVisor{Runsc: "runsc", Rootfs: "/srv/rootfs", NetNS: "/var/run/netns/weaver"}, root: "/run/runsc"}
+	s := &Sandbox{Dir: "/sandboxes/1", UID: 1001, p: &Pool{dir: "/sandboxes"}, container: "1"}
+
+	spec := v.spec(s)
+	mounts := make(map[string]ociMount)
+	for _, m := range spec.Mounts {
+		mounts[m.Destination] = m
+		if m.Type == "bind" && m.Destination != s.Dir {
+			t.Errorf("expected only the sandbox directory to be bind-mounted, got %+v", m)
+		}
+	}
+	if m := mounts["/tmp"]; m.Type != "tmpfs" {
+		t.Errorf("expected a private /tmp, got %+v", m)
+	}
+
+	cmd := strings.Join(v.exec(s, []string{"athenapdf", "-S", "in.html"}, []string{"HOME=/sandboxes/1", "DISPLAY=:99"}), " ")
+	want := "runsc --root /run/runsc --network sandbox exec --cwd /sandboxes/1 --user 1001:1001 " +
+		"--env " + spec.Process.Env[0] + " --env HOME=/sandboxes/1 1 " + strings.Join(displayCommand, " ") + " athenapdf -S in.html"
+	if cmd != want {
+		t.Errorf("expected the command to run with a display of the container, and without the display of the host (%q), got %q", want, cmd)
+	}
+}
+
+func TestPool_UseGVisor_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	p, _ := NewPool(filepath.Join(dir, "sandboxes"), 1, 0, false)
+
+	// The file system of the host is not a root file system of containers
+	for _, rootfs := range []string{"", "/", "/.", filepath.Join(dir, "missing")} {
+		if err := p.UseGVisor(GVisor{Runsc: "runsc", Rootfs: rootfs, NetNS: dir}); err != ErrGVisorRootfs {
+			t.Errorf("expected root file system %q to return %v, got %v", rootfs, ErrGVisorRootfs, err)
+		}
+	}
+	if err := p.UseGVisor(GVisor{Runsc: "runsc", Rootfs: dir}); err != ErrGVisorNetNS {
+		t.Errorf("expected error to be %v, got %v", ErrGVisorNetNS, err)
+	}
+	if err := p.UseGVisor(GVisor{Runsc: "runsc", Rootfs: dir, NetNS: filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected a missing network namespace to return an error")
+	}
+}
@@ -0,0 +1,269 @@
+// Package sandbox isolates the processes of conversions from each other: a
+// process runs in a temporary directory of its own (which is also its home,
+// and temporary directory), optionally as an unprivileged user of its own,
+// so that it has no access to the files of other conversions. The directory,
+// and any process left behind are removed once the conversion has finished.
+package sandbox
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+// dirPrefix is the prefix of the directories of sandboxes.
+const dirPrefix = "weaver-job-"
+
+var (
+	// ErrNotPrivileged is returned when sandboxes run as other users, but
+	// the current process is not running as root.
+	ErrNotPrivileged = errors.New("sandbox users require weaver to run as root")
+	// ErrTerminated is returned when a sandbox is no longer needed before
+	// one is available.
+	ErrTerminated = errors.New("sandbox acquisition terminated")
+)
+
+// Pool creates sandboxes in a directory, and allocates their users. A nil
+// Pool creates sandboxes in the system temporary directory, running as the
+// current user.
+type Pool struct {
+	dir           string
+	uids          chan int
+	userNamespace bool
+	launcher      string
+	confinement   Confinement
+	gvisor        *gvisor
+}
+
+// NewPool creates a pool of sandboxes in dir (created with mode 0711, so that
+// sandbox users can only reach their own directory), and removes the
+// sandboxes left behind by a previous process (e.g. after a crash). Every
+// running sandbox is given one of the user IDs from first to last (its group
+// ID is the same), or runs as the current user if there are none (last is
+// less than first). With userNamespace, sandboxes also run in a new user
+// namespace.
+func NewPool(dir string, first, last int, userNamespace bool) (*Pool, error) {
+	if err := os.MkdirAll(dir, 0711); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0711); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, dirPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range stale {
+		if err := os.RemoveAll(d); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &Pool{dir: dir, userNamespace: userNamespace}
+	if last >= first {
+		if os.Geteuid() != 0 {
+			return nil, ErrNotPrivileged
+		}
+		p.uids = make(chan int, last-first+1)
+		for uid := first; uid <= last; uid++ {
+			killUser(uid)
+			p.uids <- uid
+		}
+	}
+	return p, nil
+}
+
+// Acquire creates a sandbox (or takes a started one, see UseGVisor). If
+// every user is in use, it waits for a sandbox to be released, or until
+// terminate is closed.
+func (p *Pool) Acquire(terminate <-chan struct{}) (*Sandbox, error) {
+	if p == nil {
+		dir, err := ioutil.TempDir("", dirPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return &Sandbox{Dir: dir, UID: -1}, nil
+	}
+	if p.gvisor != nil {
+		return p.acquireStarted(terminate)
+	}
+	return p.create(terminate)
+}
+
+// create creates a sandbox.
+func (p *Pool) create(terminate <-chan struct{}) (*Sandbox, error) {
+	uid := -1
+	if p.uids != nil {
+		select {
+		case uid = <-p.uids:
+		case <-terminate:
+			return nil, ErrTerminated
+		}
+	}
+	s := &Sandbox{UID: uid, p: p}
+	dir, err := ioutil.TempDir(p.dir, dirPrefix)
+	if err != nil {
+		s.Release()
+		return nil, err
+	}
+	s.Dir = dir
+	if err := s.own(dir); err != nil {
+		s.Release()
+		return nil, err
+	}
+	if p.launcher != "" && p.confinement.Seccomp != "" {
+		if s.filter, err = os.Open(p.confinement.Seccomp); err != nil {
+			s.Release()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Sandbox is the temporary directory of a process, and the user it runs as.
+type Sandbox struct {
+	// Dir is the directory of the sandbox.
+	Dir string
+	// UID is the user (and group) ID of the sandbox, or -1 if it runs as the
+	// current user.
+	UID    int
+	p      *Pool
+	filter *os.File
+	// container is the ID of the gVisor container of the sandbox, if any.
+	container string
+}
+
+// own gives the ownership of a file to the user of the sandbox.
+func (s *Sandbox) own(path string) error {
+	if s.UID < 0 {
+		return nil
+	}
+	return os.Lchown(path, s.UID, s.UID)
+}
+
+// Isolation returns the isolation of the commands run in the sandbox.
+func (s *Sandbox) Isolation() gcmd.Isolation {
+	iso := gcmd.Isolation{Dir: s.Dir}
+	if s.container != "" {
+		// runsc runs as the current user, and its commands as the user of
+		// the sandbox
+		return iso
+	}
+	if s.filter != nil {
+		iso.Files = []*os.File{s.filter}
+	}
+	if s.UID >= 0 {
+		iso.Credential = &syscall.Credential{Uid: uint32(s.UID), Gid: uint32(s.UID)}
+		iso.UserNamespace = s.p.userNamespace
+	}
+	return iso
+}
+
+// Env returns the environment variables of the commands run in the sandbox,
+// which keep their home, and temporary files in the sandbox.
+func (s *Sandbox) Env() []string {
+	return []string{"HOME=" + s.Dir, "TMPDIR=" + s.Dir}
+}
+
+// Import makes a file available in the sandbox, and returns its path in the
+// sandbox. The file is linked (or copied if it cannot be linked), and owned
+// by the user of the sandbox. If the sandbox has a user of its own, the file
+// is always copied, since a link shares the owner (and contents) of the
+// original file, which the user of the sandbox could then change.
+func (s *Sandbox) Import(path string) (string, error) {
+	dst := filepath.Join(s.Dir, filepath.Base(path))
+	if s.UID >= 0 {
+		if err := copyFile(path, dst); err != nil {
+			return "", err
+		}
+		return dst, s.own(dst)
+	}
+	if err := os.Link(path, dst); err != nil {
+		if err := copyFile(path, dst); err != nil {
+			return "", err
+		}
+	}
+	return dst, s.own(dst)
+}
+
+// Create creates an empty file in the sandbox, writable by its user (e.g.
+// for a command to write an artifact to), and returns its path.
+func (s *Sandbox) Create(name string) (string, error) {
+	path := filepath.Join(s.Dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return path, s.own(path)
+}
+
+// Release kills the processes left behind by the user of the sandbox (if it
+// has one), destroys its gVisor container (if any), and removes its
+// directory.
+func (s *Sandbox) Release() error {
+	if s.filter != nil {
+		s.filter.Close()
+	}
+	if s.container != "" {
+		s.p.gvisor.destroy(s)
+	}
+	if s.UID >= 0 {
+		killUser(s.UID)
+	}
+	var err error
+	if s.Dir != "" {
+		err = os.RemoveAll(s.Dir)
+	}
+	if s.UID >= 0 {
+		s.p.uids <- s.UID
+	}
+	return err
+}
+
+// copyFile copies a file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// killUser kills the processes of a user (on systems with a /proc file
+// system).
+func killUser(uid int) {
+	procs, _ := filepath.Glob("/proc/[0-9]*/status")
+	for _, status := range procs {
+		b, err := ioutil.ReadFile(status)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			// The real, effective, saved, and file system user IDs
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+				if fields[1] == strconv.Itoa(uid) {
+					pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(status)))
+					syscall.Kill(pid, syscall.SIGKILL)
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sandbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+func TestPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	stale := filepath.Join(dir, dirPrefix+"1")
+	os.Mkdir(stale, 0700)
+
+	p, err := NewPool(dir, 1, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create pool: %+v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the stale sandbox to be removed, got %v", err)
+	}
+
+	a, err := p.Acquire(nil)
+	if err != nil {
+		t.Fatalf("unable to acquire sandbox: %+v", err)
+	}
+	b, _ := p.Acquire(nil)
+	if a.Dir == b.Dir || filepath.Dir(a.Dir) != dir {
+		t.Errorf("expected sandboxes to have their own directory in %s, got %s, and %s", dir, a.Dir, b.Dir)
+	}
+	src := filepath.Join(dir, "source.html")
+	ioutil.WriteFile(src, []byte("<p>Invoice</p>"), 0600)
+	path, err := a.Import(src)
+	if err != nil {
+		t.Fatalf("unable to import source: %+v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := gcmd.ExecuteIsolated([]string{"sh", "-c", "pwd; echo $TMPDIR; cat source.html"}, a.Env(), a.Isolation(), &out, nil, nil); err != nil {
+		t.Fatalf("execute returned an unexpected error: %+v", err)
+	}
+	if got, want := out.String(), a.Dir+"\n"+a.Dir+"\n<p>Invoice</p>"; got != want {
+		t.Errorf("expected the command to run in its sandbox (%q), got %q", want, got)
+	}
+
+	a.Release()
+	b.Release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the sandbox to be removed, got %v", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected the imported source to remain, got %v", err)
+	}
+}
+
+func TestPool_users(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("sandbox users require root")
+	}
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for testing: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const first = 64000
+	p, err := NewPool(dir, first, first+1, false)
+	if err != nil {
+		t.Fatalf("unable to create pool: %+v", err)
+	}
+	a, _ := p.Acquire(nil)
+	defer a.Release()
+	b, _ := p.Acquire(nil)
+
+	// Every user is in use
+	done := make(chan struct{})
+	close(done)
+	if _, err := p.Acquire(done); err != ErrTerminated {
+		t.Errorf("expected error of an exhausted pool to be %v, got %v", ErrTerminated, err)
+	}
+
+	secret, _ := b.Create("secret.html")
+	ioutil.WriteFile(secret, []byte("secret"), 0600)
+	var out bytes.Buffer
+	_, err = gcmd.ExecuteIsolated([]string{"sh", "-c", "id -u; cat " + secret}, a.Env(), a.Isolation(), &out, nil, nil)
+	if err == nil {
+		t.Errorf("expected the files of another sandbox to be inaccessible, got %q", out.String())
+	}
+	if got := strings.TrimSpace(out.String()); got != strconv.Itoa(a.UID) {
+		t.Errorf("expected the command to run as %d, got %s", a.UID, got)
+	}
+
+	// Imported files are copies, so the original keeps its owner
+	src := filepath.Join(dir, "source.html")
+	ioutil.WriteFile(src, []byte("<p>Invoice</p>"), 0600)
+	path, err := a.Import(src)
+	if err != nil {
+		t.Fatalf("unable to import source: %+v", err)
+	}
+	orig, _ := os.Stat(src)
+	imported, _ := os.Stat(path)
+	if os.SameFile(orig, imported) || orig.Sys().(*syscall.Stat_t).Uid != uint32(os.Geteuid()) {
+		t.Errorf("expected the imported file to be a copy, and the original to keep its owner")
+	}
+	if got := imported.Sys().(*syscall.Stat_t).Uid; got != uint32(a.UID) {
+		t.Errorf("expected the imported file to be owned by %d, got %d", a.UID, got)
+	}
+
+	// The user of a released sandbox is reused
+	b.Release()
+	c, err := p.Acquire(nil)
+	if err != nil || c.UID != b.UID {
+		t.Errorf("expected the user of the released sandbox (%d), got %+v (%v)", b.UID, c, err)
+	}
+	c.Release()
+}
@@ -0,0 +1,138 @@
+// Package sanitize strips scripts, and other dangerous content from untrusted
+// HTML documents before they are rendered.
+package sanitize
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrUnknownPolicy is returned when a sanitization policy does not exist.
+var ErrUnknownPolicy = errors.New("unknown sanitization policy")
+
+// Policy describes the content removed from a document.
+type Policy struct {
+	// Elements are removed along with their content.
+	Elements []string
+	// Attributes are removed from all elements. Event handler attributes
+	// (e.g. 'onload') are always removed.
+	Attributes []string
+}
+
+// URL attributes are removed if they use a scripting scheme.
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"poster":     true,
+	"src":        true,
+	"xlink:href": true,
+}
+
+// Policies contains the built-in policies by name.
+var Policies = map[string]Policy{
+	// Scripts removes scripts only, leaving other embedded content intact.
+	"scripts": {
+		Elements: []string{"script"},
+	},
+	// Strict additionally removes frames, plugins, forms, and redirects.
+	"strict": {
+		Elements: []string{
+			"script", "iframe", "frame", "frameset", "object", "embed",
+			"applet", "base", "form", "portal",
+		},
+		Attributes: []string{"srcdoc", "http-equiv"},
+	},
+}
+
+// Lookup returns the built-in policy with the given name.
+func Lookup(name string) (Policy, error) {
+	p, ok := Policies[name]
+	if !ok {
+		return Policy{}, ErrUnknownPolicy
+	}
+	return p, nil
+}
+
+// HTML returns a sanitized copy of a HTML document.
+func (p Policy) HTML(r io.Reader) ([]byte, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	p.clean(doc)
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// clean removes disallowed elements, and attributes from the children of a
+// node.
+func (p Policy) clean(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && p.removed(child) {
+			n.RemoveChild(child)
+		} else {
+			child.Attr = p.attributes(child.Attr)
+			p.clean(child)
+		}
+		child = next
+	}
+}
+
+func (p Policy) removed(n *html.Node) bool {
+	for _, e := range p.Elements {
+		if n.Data == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) attributes(attrs []html.Attribute) []html.Attribute {
+	var kept []html.Attribute
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+		if strings.HasPrefix(key, "on") || p.removedAttribute(key) {
+			continue
+		}
+		if urlAttributes[key] && scripted(a.Val) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+func (p Policy) removedAttribute(key string) bool {
+	for _, a := range p.Attributes {
+		if key == a {
+			return true
+		}
+	}
+	return false
+}
+
+// scripted returns true if a URL uses a scripting scheme. Browsers ignore
+// whitespace, and control characters in schemes.
+func scripted(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(u))
+	return strings.HasPrefix(u, "javascript:") || strings.HasPrefix(u, "vbscript:")
+}
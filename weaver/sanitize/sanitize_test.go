@@ -0,0 +1,51 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+const mockDocument = `<html><head><base href="http://evil"><meta http-equiv="refresh" content="0;url=http://evil"><script>alert(1)</script></head>` +
+	`<body onload="steal()"><h1 class="title">Report</h1><a href=" java	script:alert(1)">link</a><a href="/ok">ok</a>` +
+	`<iframe src="http://evil"></iframe><svg><a xlink:href="javascript:alert(1)"></a></svg></body></html>`
+
+func TestPolicyHTML_scripts(t *testing.T) {
+	p, err := Lookup("scripts")
+	if err != nil {
+		t.Fatalf("unable to lookup policy: %+v", err)
+	}
+	b, err := p.HTML(strings.NewReader(mockDocument))
+	if err != nil {
+		t.Fatalf("unable to sanitize document: %+v", err)
+	}
+	got := string(b)
+	for _, removed := range []string{"<script", "onload", "javascript:", "script:alert"} {
+		if strings.Contains(got, removed) {
+			t.Errorf("expected sanitized document not to contain %q, got %s", removed, got)
+		}
+	}
+	for _, kept := range []string{`<h1 class="title">Report</h1>`, `<a href="/ok">ok</a>`, "<iframe", "<base"} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("expected sanitized document to contain %q, got %s", kept, got)
+		}
+	}
+}
+
+func TestPolicyHTML_strict(t *testing.T) {
+	b, err := Policies["strict"].HTML(strings.NewReader(mockDocument))
+	if err != nil {
+		t.Fatalf("unable to sanitize document: %+v", err)
+	}
+	got := string(b)
+	for _, removed := range []string{"<script", "<iframe", "<base", "http-equiv"} {
+		if strings.Contains(got, removed) {
+			t.Errorf("expected sanitized document not to contain %q, got %s", removed, got)
+		}
+	}
+}
+
+func TestLookup_unknown(t *testing.T) {
+	if _, err := Lookup("lenient"); err != ErrUnknownPolicy {
+		t.Errorf("expected error to be %+v, got %+v", ErrUnknownPolicy, err)
+	}
+}
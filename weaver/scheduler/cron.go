@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCronInvalid should be returned when a cron expression can not be
+	// parsed.
+	ErrCronInvalid = errors.New("invalid cron expression")
+)
+
+// Expression is a parsed, standard (five field) cron expression:
+// minute, hour, day of month, month, and day of week.
+// Each field is represented as a bit set of the values it matches.
+type Expression struct {
+	minute, hour, dom, month, dow uint64
+	// Day of month, and day of week are matched with OR semantics
+	// (as in Vixie cron) if both are restricted.
+	domStar, dowStar bool
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a standard cron expression. It supports lists (1,2), ranges
+// (1-5), steps (*/15 or 0-30/5), month, and day names (jan, mon), and the
+// @yearly, @monthly, @weekly, @daily, and @hourly shorthands.
+func Parse(spec string) (*Expression, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	if s, ok := shorthands[spec]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%v: expected 5 fields, got %d", ErrCronInvalid, len(fields))
+	}
+
+	e := &Expression{}
+	var err error
+	if e.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if e.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if e.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if e.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if e.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+	// Sunday can be represented as both 0, and 7
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.domStar = fields[2] == "*" || fields[2] == "?"
+	e.dowStar = fields[4] == "*" || fields[4] == "?"
+	return e, nil
+}
+
+func parseValue(s string, b bounds) (int, error) {
+	if v, ok := b.names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < b.min || v > b.max {
+		return 0, fmt.Errorf("%v: value '%s' out of range [%d-%d]", ErrCronInvalid, s, b.min, b.max)
+	}
+	return v, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%v: invalid step in '%s'", ErrCronInvalid, part)
+			}
+			part = part[:i]
+		}
+
+		start, end := b.min, b.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			r := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseValue(r[0], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(r[1], b); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("%v: invalid range '%s'", ErrCronInvalid, part)
+			}
+		default:
+			v, err := parseValue(part, b)
+			if err != nil {
+				return 0, err
+			}
+			start = v
+			if step == 1 {
+				end = v
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (e *Expression) dayMatches(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+	if e.domStar || e.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t (truncated to the minute) that matches
+// the expression. It returns a zero time if there is no match within five
+// years (e.g. '0 0 30 2 *').
+func (e *Expression) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if e.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !e.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if e.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if e.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func expectNext(t *testing.T, spec string, from string, want string) {
+	e, err := Parse(spec)
+	if err != nil {
+		t.Fatalf("parse returned an unexpected error for '%s': %+v", spec, err)
+	}
+	f, _ := time.Parse(time.RFC3339, from)
+	w, _ := time.Parse(time.RFC3339, want)
+	if got := e.Next(f); !got.Equal(w) {
+		t.Errorf("expected next run of '%s' after %s to be %s, got %s", spec, from, want, got)
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected '%s' to be an invalid cron expression", spec)
+		}
+	}
+}
+
+func TestExpression_Next(t *testing.T) {
+	expectNext(t, "* * * * *", "2018-06-01T10:15:30Z", "2018-06-01T10:16:00Z")
+	expectNext(t, "*/15 * * * *", "2018-06-01T10:15:00Z", "2018-06-01T10:30:00Z")
+	expectNext(t, "0 6 * * *", "2018-06-01T10:15:00Z", "2018-06-02T06:00:00Z")
+	expectNext(t, "30 9 * * mon-fri", "2018-06-01T10:00:00Z", "2018-06-04T09:30:00Z")
+	expectNext(t, "0 0 1 jan *", "2018-06-01T10:00:00Z", "2019-01-01T00:00:00Z")
+	expectNext(t, "@hourly", "2018-06-01T10:15:00Z", "2018-06-01T11:00:00Z")
+	expectNext(t, "0 0 * * 7", "2018-06-01T10:15:00Z", "2018-06-03T00:00:00Z")
+}
+
+func TestExpression_Next_domOrDow(t *testing.T) {
+	// The 15th of the month or any Monday
+	expectNext(t, "0 0 15 * 1", "2018-06-01T10:00:00Z", "2018-06-04T00:00:00Z")
+	expectNext(t, "0 0 15 * 1", "2018-06-12T10:00:00Z", "2018-06-15T00:00:00Z")
+}
+
+func TestExpression_Next_noMatch(t *testing.T) {
+	e, _ := Parse("0 0 30 2 *")
+	if got := e.Next(time.Now()); !got.IsZero() {
+		t.Errorf("expected no next run, got %s", got)
+	}
+}
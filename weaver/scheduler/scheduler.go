@@ -0,0 +1,215 @@
+// Package scheduler runs recurring conversion jobs using cron expressions.
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	// ErrScheduleNotFound should be returned when a schedule does not exist.
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Schedule is a conversion job that is run whenever its cron expression
+// matches.
+type Schedule struct {
+	ID   string `json:"id"`
+	Cron string `json:"cron"`
+	// Job is the template for every run. The '{id}', and '{timestamp}'
+	// placeholders in its S3 key are replaced with the run's job ID, and
+	// time (e.g. 20180601T060000Z) respectively.
+	Job     queue.Job `json:"job"`
+	Next    time.Time `json:"next"`
+	LastRun time.Time `json:"last_run,omitempty"`
+	expr    *Expression
+}
+
+// NewJob creates a job for a single run of the schedule at time t.
+func (s Schedule) NewJob(t time.Time) queue.Job {
+	j := s.Job
+	j.ID = uuid.NewV4().String()
+	r := strings.NewReplacer("{id}", j.ID, "{timestamp}", t.UTC().Format("20060102T150405Z"))
+	j.AWSS3.S3Key = r.Replace(j.AWSS3.S3Key)
+	return j
+}
+
+// Redacted returns the schedule without the S3 credentials of its job, so
+// that it can be returned by the API.
+func (s Schedule) Redacted() Schedule {
+	s.Job.AWSS3.AccessKey, s.Job.AWSS3.AccessSecret = "", ""
+	return s
+}
+
+// Scheduler keeps track of schedules, and runs their jobs.
+type Scheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+	run       func(queue.Job)
+	path      string
+}
+
+// New creates a scheduler which hands the jobs of due schedules to run.
+// If a path is given, schedules are persisted to it as JSON, and loaded
+// from it (if it exists).
+func New(run func(queue.Job), path string) (*Scheduler, error) {
+	s := &Scheduler{
+		schedules: make(map[string]*Schedule),
+		run:       run,
+		path:      path,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(b, &schedules); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, sc := range schedules {
+		sc := sc
+		if sc.expr, err = Parse(sc.Cron); err != nil {
+			return nil, err
+		}
+		sc.Next = sc.expr.Next(now)
+		s.schedules[sc.ID] = &sc
+	}
+	return s, nil
+}
+
+// save persists the schedules. It must be called with the lock held.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, b, 0600)
+}
+
+// list returns the schedules ordered by their next run. It must be called
+// with the lock held.
+func (s *Scheduler) list() []Schedule {
+	l := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		l = append(l, *sc)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Next.Equal(l[j].Next) {
+			return l[i].ID < l[j].ID
+		}
+		return l[i].Next.Before(l[j].Next)
+	})
+	return l
+}
+
+// Add registers a new schedule.
+func (s *Scheduler) Add(cron string, j queue.Job) (Schedule, error) {
+	e, err := Parse(cron)
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc := &Schedule{
+		ID:   uuid.NewV4().String(),
+		Cron: cron,
+		Job:  j,
+		Next: e.Next(time.Now()),
+		expr: e,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[sc.ID] = sc
+	return *sc, s.save()
+}
+
+// Get returns a schedule by ID.
+func (s *Scheduler) Get(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	return *sc, nil
+}
+
+// Remove unregisters a schedule.
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.schedules, id)
+	return s.save()
+}
+
+// List returns all schedules ordered by their next run.
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Tick runs the jobs of all schedules that are due at time t.
+func (s *Scheduler) Tick(t time.Time) {
+	s.mu.Lock()
+	var due []queue.Job
+	for _, sc := range s.schedules {
+		if sc.Next.IsZero() || sc.Next.After(t) {
+			continue
+		}
+		due = append(due, sc.NewJob(t))
+		sc.LastRun = t
+		sc.Next = sc.expr.Next(t)
+	}
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			log.Printf("[Scheduler] unable to save schedules: %+v\n", err)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, j := range due {
+		log.Printf("[Scheduler] running scheduled job %s: %s\n", j.ID, j.URL)
+		s.run(j)
+	}
+}
+
+// Start checks for due schedules at the start of every minute until the
+// done channel is closed.
+func (s *Scheduler) Start(done <-chan struct{}) {
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-done:
+				return
+			case t := <-time.After(next.Sub(now)):
+				s.Tick(t)
+			}
+		}
+	}()
+}
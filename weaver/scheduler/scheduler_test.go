@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/queue"
+)
+
+func TestScheduler_Add(t *testing.T) {
+	s, _ := New(func(queue.Job) {}, "")
+	sc, err := s.Add("0 6 * * *", queue.Job{URL: "http://example.com"})
+	if err != nil {
+		t.Fatalf("add returned an unexpected error: %+v", err)
+	}
+	if sc.Next.IsZero() {
+		t.Errorf("expected next run of schedule to be set")
+	}
+	if got, want := len(s.List()), 1; got != want {
+		t.Errorf("expected %d schedule, got %d", want, got)
+	}
+}
+
+func TestScheduler_Add_invalid(t *testing.T) {
+	s, _ := New(func(queue.Job) {}, "")
+	if _, err := s.Add("invalid", queue.Job{}); err == nil {
+		t.Errorf("expected error to be returned")
+	}
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	s, _ := New(func(queue.Job) {}, "")
+	sc, _ := s.Add("0 6 * * *", queue.Job{})
+	if err := s.Remove(sc.ID); err != nil {
+		t.Fatalf("remove returned an unexpected error: %+v", err)
+	}
+	if err := s.Remove(sc.ID); err != ErrScheduleNotFound {
+		t.Errorf("expected a schedule not found error, got %+v", err)
+	}
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	var jobs []queue.Job
+	s, _ := New(func(j queue.Job) { jobs = append(jobs, j) }, "")
+	j := queue.Job{URL: "http://example.com"}
+	j.AWSS3.S3Key = "reports/{timestamp}.pdf"
+	sc, _ := s.Add("* * * * *", j)
+
+	s.Tick(sc.Next.Add(-time.Second))
+	if got := len(jobs); got != 0 {
+		t.Fatalf("expected no jobs to run before schedule is due, got %d", got)
+	}
+
+	s.Tick(sc.Next)
+	if got, want := len(jobs), 1; got != want {
+		t.Fatalf("expected %d job to run, got %d", want, got)
+	}
+	if want := "reports/" + sc.Next.UTC().Format("20060102T150405Z") + ".pdf"; jobs[0].AWSS3.S3Key != want {
+		t.Errorf("expected job S3 key to be %s, got %s", want, jobs[0].AWSS3.S3Key)
+	}
+	if jobs[0].ID == "" {
+		t.Errorf("expected job ID to be set")
+	}
+
+	updated, _ := s.Get(sc.ID)
+	if !updated.Next.After(sc.Next) {
+		t.Errorf("expected next run to be after %s, got %s", sc.Next, updated.Next)
+	}
+}
+
+func TestScheduler_persist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "schedules.json")
+
+	s, _ := New(func(queue.Job) {}, p)
+	sc, _ := s.Add("@daily", queue.Job{URL: "http://example.com"})
+
+	loaded, err := New(func(queue.Job) {}, p)
+	if err != nil {
+		t.Fatalf("new returned an unexpected error: %+v", err)
+	}
+	got, err := loaded.Get(sc.ID)
+	if err != nil {
+		t.Fatalf("expected persisted schedule to be loaded: %+v", err)
+	}
+	if !strings.EqualFold(got.Cron, "@daily") || got.Job.URL != "http://example.com" {
+		t.Errorf("expected loaded schedule to be %+v, got %+v", sc, got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/scheduler"
+)
+
+var (
+	// ErrScheduleInvalid should be returned when a schedule request can not
+	// be decoded.
+	ErrScheduleInvalid = errors.New("invalid schedule provided")
+)
+
+// scheduleRequest is the JSON body for creating a schedule.
+type scheduleRequest struct {
+	Cron string    `json:"cron"`
+	Job  queue.Job `json:"job"`
+}
+
+// createScheduleHandler registers a recurring conversion. The job is
+// converted whenever the cron expression matches, and it is uploaded to S3.
+func createScheduleHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	sch := c.MustGet("scheduler").(*scheduler.Scheduler)
+
+	var req scheduleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrScheduleInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if req.Job.URL == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrURLInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if err := allowedSource(c, req.Job.URL); err != nil {
+		c.AbortWithError(http.StatusForbidden, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	// The S3 key is only defaulted on each run (to the job ID)
+	if j := jobDestination(conf, req.Job); j.AWSS3.S3Bucket == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrAsyncNoUpload).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	req.Job.Tenant = tenantID(c)
+	sc, err := sch.Add(req.Cron, req.Job)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	c.JSON(http.StatusCreated, sc.Redacted())
+}
+
+// tenantSchedule returns a schedule by ID. Tenants may only get their own
+// schedules: those of others are not found.
+func tenantSchedule(c *gin.Context, sch *scheduler.Scheduler, id string) (scheduler.Schedule, error) {
+	sc, err := sch.Get(id)
+	if err != nil {
+		return sc, err
+	}
+	if t := tenantID(c); t != "" && sc.Job.Tenant != t {
+		return scheduler.Schedule{}, scheduler.ErrScheduleNotFound
+	}
+	return sc, nil
+}
+
+// listSchedulesHandler returns all schedules ordered by their next run, or
+// only those of the tenant of the request. The S3 credentials of their jobs
+// are redacted.
+func listSchedulesHandler(c *gin.Context) {
+	sch := c.MustGet("scheduler").(*scheduler.Scheduler)
+	id := tenantID(c)
+	schedules := make([]scheduler.Schedule, 0)
+	for _, sc := range sch.List() {
+		if id == "" || sc.Job.Tenant == id {
+			schedules = append(schedules, sc.Redacted())
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+func getScheduleHandler(c *gin.Context) {
+	sch := c.MustGet("scheduler").(*scheduler.Scheduler)
+	sc, err := tenantSchedule(c, sch, c.Param("id"))
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.JSON(http.StatusOK, sc.Redacted())
+}
+
+func deleteScheduleHandler(c *gin.Context) {
+	sch := c.MustGet("scheduler").(*scheduler.Scheduler)
+	if _, err := tenantSchedule(c, sch, c.Param("id")); err != nil {
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if err := sch.Remove(c.Param("id")); err != nil {
+		c.AbortWithError(http.StatusNotFound, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
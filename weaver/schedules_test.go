@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/queue"
+	"github.com/lachee/athenapdf/weaver/scheduler"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+func mockScheduleRouter(sch *scheduler.Scheduler) *gin.Engine {
+	return mockRouter(Config{}, Services{Scheduler: sch}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/schedules", createScheduleHandler)
+		r.DELETE("/schedules/:id", deleteScheduleHandler)
+	})
+}
+
+func TestCreateScheduleHandler(t *testing.T) {
+	sch, _ := scheduler.New(func(queue.Job) {}, "")
+	r := mockScheduleRouter(sch)
+	body := `{"cron": "0 6 * * *", "job": {"url": "http://example.com", "aws_s3": {"S3Bucket": "test-bucket"}}}`
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/schedules", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusCreated; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+	if got, want := len(sch.List()), 1; got != want {
+		t.Errorf("expected %d schedule to be registered, got %d", want, got)
+	}
+}
+
+func TestCreateScheduleHandler_noUpload(t *testing.T) {
+	sch, _ := scheduler.New(func(queue.Job) {}, "")
+	r := mockScheduleRouter(sch)
+	body := `{"cron": "0 6 * * *", "job": {"url": "http://example.com"}}`
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/schedules", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusBadRequest; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestDeleteScheduleHandler_notFound(t *testing.T) {
+	sch, _ := scheduler.New(func(queue.Job) {}, "")
+	r := mockScheduleRouter(sch)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/schedules/unknown", nil)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusNotFound; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestScheduleHandlers_tenant(t *testing.T) {
+	sch, _ := scheduler.New(func(queue.Job) {}, "")
+	s3 := converter.AWSS3{S3Bucket: "test-bucket", AccessKey: "key", AccessSecret: "secret"}
+	own, _ := sch.Add("0 6 * * *", queue.Job{URL: "http://example.com", Tenant: "acme", AWSS3: s3})
+	other, _ := sch.Add("0 6 * * *", queue.Job{URL: "http://example.com", Tenant: "globex", AWSS3: s3})
+	r := mockRouter(Config{}, Services{Scheduler: sch}, func(r *gin.Engine, _ Config, _ Services) {
+		r.Use(func(c *gin.Context) {
+			if id := c.Query("tenant"); id != "" {
+				c.Set("tenant", tenant.Tenant{ID: id})
+			}
+		})
+		r.GET("/schedules", listSchedulesHandler)
+		r.GET("/schedules/:id", getScheduleHandler)
+		r.DELETE("/schedules/:id", deleteScheduleHandler)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/schedules/" + own.ID + "?tenant=acme", http.StatusOK},
+		{"GET", "/schedules/" + other.ID + "?tenant=acme", http.StatusNotFound},
+		{"DELETE", "/schedules/" + other.ID + "?tenant=acme", http.StatusNotFound},
+		{"GET", "/schedules/" + other.ID, http.StatusOK},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		r.ServeHTTP(res, req)
+		if res.Code != tt.code {
+			t.Errorf("expected %s %s to respond with %d, got %d", tt.method, tt.path, tt.code, res.Code)
+		}
+		if strings.Contains(res.Body.String(), "secret") {
+			t.Errorf("expected %s %s not to respond with the S3 credentials, got %s", tt.method, tt.path, res.Body)
+		}
+	}
+	if _, err := sch.Get(other.ID); err != nil {
+		t.Errorf("expected the schedule of another tenant not to be deleted, got %+v", err)
+	}
+
+	for _, tt := range []struct {
+		tenant string
+		n      int
+	}{{"acme", 1}, {"", 2}} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/schedules?tenant="+tt.tenant, nil)
+		r.ServeHTTP(res, req)
+		var body struct {
+			Schedules []scheduler.Schedule `json:"schedules"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("expected a JSON response, got %+v", err)
+		}
+		if len(body.Schedules) != tt.n {
+			t.Errorf("expected tenant %q to list %d schedules, got %d", tt.tenant, tt.n, len(body.Schedules))
+		}
+		if strings.Contains(res.Body.String(), "secret") {
+			t.Errorf("expected the list not to include the S3 credentials, got %s", res.Body)
+		}
+	}
+}
+
+func TestCreateScheduleHandler_allowedDomains(t *testing.T) {
+	sch, _ := scheduler.New(func(queue.Job) {}, "")
+	r := mockRouter(Config{}, Services{Scheduler: sch}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/schedules", func(c *gin.Context) {
+			c.Set("tenant", tenant.Tenant{ID: "acme", Profile: &tenant.Profile{AllowedDomains: []string{"acme.com"}}})
+			createScheduleHandler(c)
+		})
+	})
+	body := `{"cron": "0 6 * * *", "job": {"url": "http://example.com", "aws_s3": {"S3Bucket": "test-bucket"}}}`
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/schedules", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusForbidden; got != want {
+		t.Fatalf("expected response code to be %d, got %d", want, got)
+	}
+	if n := len(sch.List()); n != 0 {
+		t.Errorf("expected no schedule to be registered, got %d", n)
+	}
+}
@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// SecretsManager resolves 'aws-sm://' references using AWS Secrets Manager.
+// The path is the name, or ARN of the secret, and the 'region' option
+// overrides the region. The current version of the secret is fetched, so
+// rotated secrets are picked up when they are resolved again.
+// Credentials are resolved using the default AWS credential chain.
+type SecretsManager struct {
+	// The AWS region of the secrets.
+	// Defaults to AWS_REGION, or 'us-east-1'.
+	Region string
+}
+
+// Resolve fetches the referenced secret, or the value of the referenced key
+// if the secret is a JSON object.
+func (m *SecretsManager) Resolve(r Ref) (string, error) {
+	region := r.Options.Get("region")
+	if region == "" {
+		region = m.Region
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	sess := session.New(aws.NewConfig().WithRegion(region).WithMaxRetries(3))
+	svc := secretsmanager.New(sess)
+	out, err := svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(r.Path),
+	})
+	if err != nil {
+		return "", err
+	}
+	secret := string(out.SecretBinary)
+	if out.SecretString != nil {
+		secret = *out.SecretString
+	}
+	return field(secret, r.Key)
+}
@@ -0,0 +1,135 @@
+// Package secrets resolves references to secrets stored in HashiCorp Vault
+// ('vault://'), or AWS Secrets Manager ('aws-sm://'), so that secrets do not
+// have to be set in plain environment variables.
+//
+// A reference has the form '<scheme>://<path>[?<options>][#<key>]', e.g.
+// 'vault://secret/data/weaver#auth_key', or
+// 'aws-sm://weaver/production?region=eu-west-1#auth_key'. The key selects a
+// field of a secret containing multiple values (a JSON object).
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrRefInvalid should be returned when a secret reference has no path,
+	// or invalid options.
+	ErrRefInvalid = errors.New("invalid secret reference")
+	// ErrKeyNotFound should be returned when a secret does not contain the
+	// referenced key.
+	ErrKeyNotFound = errors.New("secret key not found")
+)
+
+// Ref is a parsed reference to a secret.
+type Ref struct {
+	Scheme  string
+	Path    string
+	Key     string
+	Options url.Values
+}
+
+func (r Ref) String() string {
+	s := r.Scheme + "://" + r.Path
+	if len(r.Options) > 0 {
+		s += "?" + r.Options.Encode()
+	}
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// Resolver fetches the value of a referenced secret.
+type Resolver interface {
+	Resolve(r Ref) (string, error)
+}
+
+// Resolvers contains the resolver of each supported scheme.
+var Resolvers = map[string]Resolver{
+	"vault":  new(Vault),
+	"aws-sm": new(SecretsManager),
+}
+
+// IsRef returns true if a value is a reference to a secret of a supported
+// scheme.
+func IsRef(s string) bool {
+	i := strings.Index(s, "://")
+	if i == -1 {
+		return false
+	}
+	_, ok := Resolvers[s[:i]]
+	return ok
+}
+
+// ParseRef parses a reference to a secret. Paths are not parsed as URLs, as
+// secret names (e.g. ARNs) may contain any character but '?', and '#'.
+func ParseRef(s string) (Ref, error) {
+	i := strings.Index(s, "://")
+	if i == -1 {
+		return Ref{}, ErrRefInvalid
+	}
+	r := Ref{Scheme: s[:i]}
+	rest := s[i+3:]
+	if i := strings.Index(rest, "#"); i != -1 {
+		rest, r.Key = rest[:i], rest[i+1:]
+	}
+	if i := strings.Index(rest, "?"); i != -1 {
+		opts, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return Ref{}, ErrRefInvalid
+		}
+		rest, r.Options = rest[:i], opts
+	}
+	r.Path = strings.Trim(rest, "/")
+	if r.Path == "" {
+		return Ref{}, ErrRefInvalid
+	}
+	return r, nil
+}
+
+// Resolve returns the value of a referenced secret. Values that are not
+// references are returned as is.
+func Resolve(s string) (string, error) {
+	if !IsRef(s) {
+		return s, nil
+	}
+	r, err := ParseRef(s)
+	if err != nil {
+		return "", err
+	}
+	v, err := Resolvers[r.Scheme].Resolve(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve secret %s: %v", r, err)
+	}
+	return v, nil
+}
+
+// field returns the value of a key in a secret containing a JSON object.
+// The whole secret is returned if no key is referenced.
+func field(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", ErrKeyNotFound
+	}
+	return value(fields, key)
+}
+
+func value(fields map[string]interface{}, key string) (string, error) {
+	v, ok := fields[key]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
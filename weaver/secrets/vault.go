@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrVaultToken should be returned when no Vault token is configured.
+var ErrVaultToken = errors.New("no Vault token provided (VAULT_TOKEN)")
+
+// Vault resolves 'vault://' references using Vault's HTTP API. The path is
+// the API path of the secret, e.g. 'secret/data/weaver' for the 'weaver'
+// secret in a KV version 2 engine mounted at 'secret/'. Secrets of KV
+// version 1, and 2 engines are supported.
+type Vault struct {
+	// The address of the Vault server.
+	// Defaults to VAULT_ADDR, or 'http://127.0.0.1:8200'.
+	Addr string
+	// The token to authenticate with.
+	// Defaults to VAULT_TOKEN.
+	Token string
+	// Defaults to a client with a 10 second timeout.
+	Client *http.Client
+}
+
+// Resolve fetches the value of the referenced key. The key defaults to
+// 'value'.
+func (v *Vault) Resolve(r Ref) (string, error) {
+	addr := v.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8200"
+	}
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return "", ErrVaultToken
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+r.Path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", res.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	fields := body.Data
+	// KV version 2 nests the secret, and its metadata
+	if data, ok := fields["data"].(map[string]interface{}); ok {
+		if _, ok := fields["metadata"]; ok {
+			fields = data
+		}
+	}
+	key := r.Key
+	if key == "" {
+		key = "value"
+	}
+	return value(fields, key)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/events"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrSectionsUnsupported should be returned when the sections of a v2
+	// request are combined with options they do not support.
+	ErrSectionsUnsupported = errors.New("sections cannot be combined with source.content, delivery.async, delivery.s3, or dry_run")
+	// ErrSectionSourceMissing should be returned when a section does not
+	// have a URL, and the request does not have a source URL.
+	ErrSectionSourceMissing = errors.New("every section requires a url, or source.url")
+	// ErrSectionOrientation should be returned when the orientation of
+	// a section is unknown.
+	ErrSectionOrientation = errors.New("invalid section orientation provided (use portrait, or landscape)")
+)
+
+// SectionOptions are a section of a v2 conversion request (see
+// ConversionRequest.Sections), with its own page layout.
+type SectionOptions struct {
+	// The URL of the section. Defaults to source.url.
+	URL string `json:"url,omitempty"`
+	// A CSS selector of the elements of the page in the section ('select').
+	Select string `json:"select,omitempty"`
+	// The orientation of the pages: 'portrait', or 'landscape'. Defaults to
+	// the orientation of the request (page.landscape).
+	Orientation string `json:"orientation,omitempty"`
+	// The page size, e.g. 'A3'. Defaults to page.size.
+	Size string `json:"size,omitempty"`
+	// The page margins. Defaults to page.margins.
+	Margins string `json:"margins,omitempty"`
+}
+
+// validateSections returns an error if the sections of the request cannot be
+// rendered.
+func (r ConversionRequest) validateSections() error {
+	if r.Source.Content != "" || r.Delivery.Async || r.Delivery.S3 != nil || r.DryRun {
+		return ErrSectionsUnsupported
+	}
+	for _, s := range r.Sections {
+		if s.URL == "" && r.Source.URL == "" {
+			return ErrSectionSourceMissing
+		}
+		switch s.Orientation {
+		case "", "portrait", "landscape":
+		default:
+			return ErrSectionOrientation
+		}
+	}
+	return nil
+}
+
+// query returns the query parameters of the request with the options of the
+// section.
+func (s SectionOptions) query(q url.Values) url.Values {
+	sq := url.Values{}
+	for k, v := range q {
+		sq[k] = v
+	}
+	if s.URL != "" {
+		sq.Set("url", s.URL)
+	}
+	if s.Select != "" {
+		sq.Set("select", s.Select)
+	}
+	switch s.Orientation {
+	case "portrait":
+		sq.Del("no_portrait")
+	case "landscape":
+		sq.Set("no_portrait", "true")
+	}
+	if s.Size != "" {
+		sq.Set("page_size", s.Size)
+	}
+	if s.Margins != "" {
+		sq.Set("margins", s.Margins)
+	}
+	return sq
+}
+
+// checkSection checks the options of a request with the options of a
+// section.
+func checkSection(c *gin.Context, section SectionOptions) error {
+	query := c.Request.URL.RawQuery
+	defer func() { c.Request.URL.RawQuery = query }()
+	c.Request.URL.RawQuery = section.query(c.Request.URL.Query()).Encode()
+	return checkOptions(c)
+}
+
+// renderRequestSections fetches, and renders the sections of a request as
+// PDFs in the work queue, and returns them in order. The sources of the
+// sections are fetched before any of them is rendered, and they are rendered
+// in parallel. Their options must have been checked (see checkSection).
+func renderRequestSections(c *gin.Context, sections []SectionOptions) ([][]byte, error) {
+	wq := c.MustGet("queue").(chan<- converter.Work)
+	query := c.Request.URL.RawQuery
+	q := c.Request.URL.Query()
+
+	var works []converter.Work
+	cancel := func(works []converter.Work) {
+		for _, w := range works {
+			w.Cancel()
+		}
+	}
+	for _, section := range sections {
+		// The options of a section are read from its query, which is
+		// restored before the conversions are awaited
+		c.Request.URL.RawQuery = section.query(q).Encode()
+		source, err := newURLSource(c, c.Query("url"))
+		var conversion athenapdf.AthenaPDF
+		if err == nil {
+			defer source.Remove()
+			conversion, err = renderConversion(c, *source, athenapdf.FormatPDF)
+		}
+		if err != nil {
+			c.Request.URL.RawQuery = query
+			cancel(works)
+			return nil, err
+		}
+		works = append(works, converter.NewWork(wq, conversion, *source))
+	}
+	c.Request.URL.RawQuery = query
+
+	out := make([][]byte, len(works))
+	for i, w := range works {
+		var err error
+		if out[i], err = awaitRender(c, w); err != nil {
+			cancel(works[i+1:])
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// sectionsHandler renders the sections of a v2 conversion request (see
+// ConversionRequest.Sections) separately, with their own page layout, and
+// returns them merged into a single PDF, in order.
+func sectionsHandler(c *gin.Context, req ConversionRequest) {
+	s := c.MustGet("statsd").(*statsd.Client)
+	conf := c.MustGet("config").(Config)
+
+	if conf.Merge.MaxSources > 0 && len(req.Sections) > conf.Merge.MaxSources {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeTooManySources).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if _, ok := c.GetQuery("offline"); ok {
+		c.AbortWithError(http.StatusBadRequest, ErrOfflineURL).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF {
+		c.AbortWithError(http.StatusBadRequest, ErrMergeFormat).SetType(gin.ErrorTypePublic)
+		return
+	}
+	for _, section := range req.Sections {
+		if err := checkSection(c, section); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+	}
+
+	source := req.Source.URL
+	if source == "" {
+		source = req.Sections[0].URL
+	}
+	id := newJob(c, source)
+	started := time.Now()
+	sections, err := renderRequestSections(c, req.Sections)
+	var out []byte
+	if err == nil {
+		out, err = pdf.Merge(sections...)
+	}
+	if err != nil {
+		s.Increment("sections_error")
+		events.Emit(publisher(c), events.Failed, id, source, err)
+		if err == converter.ErrConversionTimeout {
+			c.AbortWithError(http.StatusGatewayTimeout, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		abortWithSourceError(c, err)
+		return
+	}
+
+	report := &converter.Report{Duration: time.Since(started)}
+	report.Fill(out)
+	c.Set("report", report)
+	s.Increment("sections")
+	s.Timing("sections_duration", int(report.Duration/time.Millisecond))
+	events.EmitOutput(publisher(c), events.Completed, id, source, report.Pages, report.Bytes)
+	recordUsage(c, report)
+	setReportHeaders(c, report)
+	sendOutput(c, athenapdf.ContentTypes[athenapdf.FormatPDF], out, report.SHA256)
+}
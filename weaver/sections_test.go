@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+func TestSectionOptionsQuery(t *testing.T) {
+	q := url.Values{"url": {"https://example.com"}, "page_size": {"A4"}, "no_portrait": {"true"}}
+	tests := []struct {
+		section SectionOptions
+		want    url.Values
+	}{
+		{SectionOptions{}, q},
+		{SectionOptions{Orientation: "portrait", Size: "A3", Select: "#tables"},
+			url.Values{"url": {"https://example.com"}, "page_size": {"A3"}, "select": {"#tables"}}},
+		{SectionOptions{URL: "https://example.com/appendix", Orientation: "landscape", Margins: "none"},
+			url.Values{"url": {"https://example.com/appendix"}, "page_size": {"A4"}, "no_portrait": {"true"}, "margins": {"none"}}},
+	}
+	for _, tt := range tests {
+		if got := tt.section.query(q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected query of %+v to be %v, got %v", tt.section, tt.want, got)
+		}
+	}
+	if got, want := q.Get("page_size"), "A4"; got != want {
+		t.Errorf("expected the query of the request to be kept, got page size %s", got)
+	}
+}
+
+func TestSectionsHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "sections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := dir + "/athenapdf.sh"
+	ioutil.WriteFile(script, []byte("echo \"$@\" >> "+dir+"/args\ncat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	r := mockV2Router(conf)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"source": {"url": "` + ts.URL + `"}, "page": {"size": "A4"}, "sections": [{"select": "#text"}, {"select": "#tables", "orientation": "landscape", "size": "A3"}, {"url": "` + ts.URL + `/appendix"}]}`, http.StatusOK},
+		{`{"sections": [{"select": "#text"}]}`, http.StatusBadRequest},
+		{`{"source": {"url": "` + ts.URL + `"}, "sections": [{"orientation": "upside-down"}]}`, http.StatusBadRequest},
+		{`{"source": {"url": "` + ts.URL + `"}, "sections": [{"size": "B52"}]}`, http.StatusBadRequest},
+		{`{"source": {"url": "` + ts.URL + `"}, "sections": [{"select": "}"}]}`, http.StatusBadRequest},
+		{`{"source": {"url": "` + ts.URL + `"}, "output": {"format": "png"}, "sections": [{}]}`, http.StatusBadRequest},
+		{`{"source": {"url": "` + ts.URL + `"}, "delivery": {"async": true}, "sections": [{}]}`, http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v2/conversions", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer 123456")
+		r.ServeHTTP(recorder{res}, req)
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of %s to be %d, got %d (%s)", tt.body, tt.code, got, res.Body)
+		}
+		if i == 0 && res.Code == http.StatusOK {
+			if got, want := pdf.PageCount(res.Body.Bytes()), 3; got != want {
+				t.Errorf("expected the sections to have %d pages, got %d", want, got)
+			}
+		}
+	}
+
+	b, _ := ioutil.ReadFile(dir + "/args")
+	args := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if got, want := len(args), 3; got != want {
+		t.Fatalf("expected %d sections to be rendered, got %d: %q", want, got, args)
+	}
+	// The options of the sections (after their URL), which are rendered in
+	// parallel, in any order
+	for i := range args {
+		args[i] = args[i][strings.Index(args[i], " ")+1:]
+	}
+	sort.Strings(args)
+	want := []string{"--no-portrait -P A3 --select #tables", "-P A4", "-P A4 --select #text"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("expected the sections to be rendered with %q, got %q", want, args)
+	}
+}
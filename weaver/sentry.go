@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/gcmd"
+)
+
+const (
+	// maxBreadcrumbs is the maximum number of breadcrumbs kept for a request.
+	maxBreadcrumbs = 50
+	// stderrTail is the number of bytes of the converter's standard error
+	// reported to Sentry.
+	stderrTail = 2048
+	// redacted replaces sensitive values reported to Sentry.
+	redacted = "REDACTED"
+)
+
+// sensitiveOptions are the query parameters whose values are redacted from
+// the options reported to Sentry.
+var sensitiveOptions = map[string]bool{
+	"auth":       true,
+	"aws_id":     true,
+	"aws_secret": true,
+	"proxy":      true,
+}
+
+// breadcrumb is a step of a request leading up to an error.
+// See https://docs.sentry.io/clientdev/interfaces/breadcrumbs/
+type breadcrumb struct {
+	Timestamp int64                  `json:"timestamp"`
+	Category  string                 `json:"category"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// breadcrumbs records the steps of a request, and it implements the Sentry
+// breadcrumbs interface.
+type breadcrumbs struct {
+	mu     sync.Mutex
+	Values []breadcrumb `json:"values"`
+}
+
+// Class returns the Sentry interface name of the breadcrumbs.
+func (b *breadcrumbs) Class() string {
+	return "breadcrumbs"
+}
+
+// add records a step, dropping the oldest one if there are too many.
+func (b *breadcrumbs) add(category, message string, data map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.Values) == maxBreadcrumbs {
+		b.Values = b.Values[1:]
+	}
+	b.Values = append(b.Values, breadcrumb{time.Now().Unix(), category, message, data})
+}
+
+// addBreadcrumb records a step of the request, if Sentry is enabled.
+func addBreadcrumb(c *gin.Context, category, message string, data map[string]interface{}) {
+	if b, ok := c.Get("breadcrumbs"); ok {
+		b.(*breadcrumbs).add(category, message, data)
+	}
+}
+
+// redactURL removes the credentials, and query values from a URL, as they may
+// contain secrets. Local paths are returned as is.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	q := u.Query()
+	for k := range q {
+		q[k] = []string{redacted}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// redactedOptions returns the conversion options of the request, without
+// the source URL, and with sensitive values redacted.
+func redactedOptions(c *gin.Context) map[string][]string {
+	opts := make(map[string][]string)
+	for k, v := range c.Request.URL.Query() {
+		switch {
+		case k == "url":
+		case sensitiveOptions[k]:
+			opts[k] = []string{redacted}
+		default:
+			opts[k] = v
+		}
+	}
+	return opts
+}
+
+// captureError reports a conversion error to Sentry (if enabled), with the
+// context of the conversion: the (redacted) source, the engine, the options,
+// the queue wait time, the exit code, and standard error of the converter,
+// the IP address of the client, and the breadcrumbs of the request. The
+// engine, and work are optional.
+func captureError(c *gin.Context, err error, source string, engine string, work *converter.Work) {
+	r, ok := c.Get("sentry")
+	if !ok {
+		return
+	}
+
+	extra := map[string]interface{}{
+		"source":  redactURL(source),
+		"options": redactedOptions(c),
+	}
+	tags := map[string]string{
+		"url":        redactURL(source),
+		"request_id": c.GetString("request_id"),
+	}
+	if engine != "" {
+		extra["engine"] = engine
+		tags["engine"] = engine
+	}
+	if work != nil {
+		select {
+		case <-work.Started():
+			extra["queue_wait_ms"] = work.QueueWait().Nanoseconds() / int64(time.Millisecond)
+		default:
+		}
+	}
+	if e, ok := err.(*gcmd.ExitError); ok {
+		extra["exit_code"] = e.ExitCode
+		extra["stderr"] = e.Tail(stderrTail)
+	}
+
+	interfaces := []raven.Interface{&raven.User{IP: c.ClientIP()}}
+	if b, ok := c.Get("breadcrumbs"); ok {
+		interfaces = append(interfaces, b.(*breadcrumbs))
+	}
+	r.(*raven.Client).CaptureError(raven.WrapWithExtra(err, extra), tags, interfaces...)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/smtpd"
+	"github.com/satori/go.uuid"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// forwardTimeout is the timeout of forwarding the output of a message to the
+// URL of its mailbox.
+const forwardTimeout = time.Second * 30
+
+// StartSMTP starts the SMTP listener of the configured mailboxes (see SMTP),
+// if any, converting their messages with the conversion routes of the
+// handler. The returned server is nil if it is disabled.
+func StartSMTP(conf Config, handler http.Handler, s *statsd.Client) (*smtpd.Server, error) {
+	if conf.SMTP.Addr == "" {
+		return nil, nil
+	}
+	mailboxes := make(map[string]Mailbox, len(conf.SMTP.Mailboxes))
+	for _, m := range conf.SMTP.Mailboxes {
+		if m.Dir != "" {
+			if err := os.MkdirAll(m.Dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+		mailboxes[strings.ToLower(m.Address)] = m
+	}
+	hostname := conf.SMTP.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	srv := &smtpd.Server{
+		Hostname: hostname,
+		MaxBytes: conf.SMTP.MaxBytes,
+		Accept: func(rcpt string) bool {
+			_, ok := mailboxes[strings.ToLower(rcpt)]
+			return ok
+		},
+		Handle: func(e smtpd.Envelope) error {
+			for _, rcpt := range e.To {
+				if err := archiveMessage(conf, handler, mailboxes[strings.ToLower(rcpt)], e); err != nil {
+					s.Increment("smtp_failed")
+					return err
+				}
+				s.Increment("smtp_archived")
+			}
+			return nil
+		},
+	}
+	l, err := net.Listen("tcp", conf.SMTP.Addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(l); err != smtpd.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Printf("Receiving email for %d mailbox(es) on %s\n", len(mailboxes), conf.SMTP.Addr)
+	return srv, nil
+}
+
+// archiveMessage converts a message received for a mailbox through the
+// conversion route (in-process), and stores, or forwards its output. A
+// message that cannot be converted is rejected permanently, while other
+// failures are retried by the sender.
+func archiveMessage(conf Config, handler http.Handler, m Mailbox, e smtpd.Envelope) error {
+	params, _ := url.ParseQuery(m.Params)
+	params.Set("ext", "eml")
+	ext, ok := outputExtensions[params.Get("format")]
+	if !ok {
+		ext = ".pdf"
+	}
+	req, err := conversionRequest(conf, "-", convertOptions{Params: params, Stdin: bytes.NewReader(e.Data)})
+	if err != nil {
+		return err
+	}
+	res, err := serveConversion(handler, req)
+	if ce, ok := err.(*conversionError); ok && ce.Status < http.StatusInternalServerError && ce.Status != http.StatusTooManyRequests {
+		return &smtpd.Error{Code: 554, Message: "5.6.0 Unable to convert the message: " + ce.Message}
+	}
+	if err != nil {
+		return err
+	}
+
+	var messageID string
+	if msg, err := mail.ReadMessage(bytes.NewReader(e.Data)); err == nil {
+		messageID = msg.Header.Get("Message-Id")
+	}
+	name := uuid.NewV4().String() + ext
+	output := res.Body.Bytes()
+	log.Printf("[SMTP] archiving message %s from %s to %s as %s\n", messageID, e.From, m.Address, name)
+
+	if m.Dir != "" {
+		if err := ioutil.WriteFile(filepath.Join(m.Dir, name), output, 0644); err != nil {
+			return err
+		}
+	}
+	if m.S3Bucket != "" {
+		upload := converter.UploadConversion{AWSS3: converter.AWSS3{
+			Region:        m.S3Region,
+			AccessKey:     conf.S3.AccessKey,
+			AccessSecret:  conf.S3.AccessSecret,
+			S3Bucket:      m.S3Bucket,
+			S3Key:         m.S3Prefix + name,
+			ContentType:   res.Header().Get("Content-Type"),
+			RetentionDays: conf.Retention.Days,
+		}}
+		if _, err := upload.Upload(output); err != nil {
+			return err
+		}
+	}
+	if m.ForwardURL != "" {
+		return forwardOutput(m, messageID, res.Header().Get("Content-Type"), output)
+	}
+	return nil
+}
+
+// forwardOutput POSTs the output of a message to the URL of its mailbox.
+func forwardOutput(m Mailbox, messageID, contentType string, output []byte) error {
+	req, err := http.NewRequest("POST", m.ForwardURL, bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Weaver-Mailbox", m.Address)
+	if messageID != "" {
+		req.Header.Set("X-Weaver-Message-Id", messageID)
+	}
+	res, err := (&http.Client{Timeout: forwardTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("forwarding to %s failed: %s", m.ForwardURL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/smtpd"
+)
+
+const smtpMessage = "Message-Id: <1@example.com>\r\nFrom: a@example.com\r\nSubject: Invoice\r\n\r\nHello\r\n"
+
+func TestArchiveMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smtp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var forwarded *http.Request
+	var body []byte
+	forward := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer forward.Close()
+
+	var query string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	})
+	m := Mailbox{Address: "archive@weaver.test", Params: "email_attachments=embed", Dir: dir, ForwardURL: forward.URL}
+	conf := defaultConfig()
+	conf.AuthKey = "secret"
+
+	if err := archiveMessage(conf, handler, m, smtpd.Envelope{From: "a@example.com", Data: []byte(smtpMessage)}); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := query, "auth=secret&email_attachments=embed&ext=eml"; got != want {
+		t.Errorf("expected query %q, got %q", want, got)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.pdf"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 output in the directory, got %v", files)
+	}
+	if b, _ := ioutil.ReadFile(files[0]); string(b) != "%PDF-1.4" {
+		t.Errorf("expected the output to be written, got %q", b)
+	}
+	if forwarded == nil {
+		t.Fatal("expected the output to be forwarded")
+	}
+	if string(body) != "%PDF-1.4" {
+		t.Errorf("expected the output to be forwarded, got %q", body)
+	}
+	if got, want := forwarded.Header.Get("X-Weaver-Mailbox"), m.Address; got != want {
+		t.Errorf("expected mailbox %q, got %q", want, got)
+	}
+	if got, want := forwarded.Header.Get("X-Weaver-Message-Id"), "<1@example.com>"; got != want {
+		t.Errorf("expected message ID %q, got %q", want, got)
+	}
+}
+
+func TestArchiveMessage_failed(t *testing.T) {
+	tests := []struct {
+		status int
+		code   int
+	}{
+		{http.StatusBadRequest, 554},
+		{http.StatusServiceUnavailable, 0},
+		{http.StatusTooManyRequests, 0},
+	}
+	for _, tt := range tests {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(`{"code":"INVALID_OPTIONS","error":"invalid email message"}`))
+		})
+		m := Mailbox{Address: "archive@weaver.test", Dir: os.TempDir()}
+		err := archiveMessage(defaultConfig(), handler, m, smtpd.Envelope{Data: []byte(smtpMessage)})
+		if err == nil {
+			t.Errorf("expected an error for %d", tt.status)
+			continue
+		}
+		se, ok := err.(*smtpd.Error)
+		if tt.code == 0 && ok {
+			t.Errorf("expected a temporary failure for %d, got %+v", tt.status, err)
+		}
+		if tt.code != 0 && (!ok || se.Code != tt.code) {
+			t.Errorf("expected %d for %d, got %+v", tt.code, tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Package smtpd is a minimal SMTP server (RFC 5321) receiving messages for a
+// set of mailboxes. It does not relay messages, and has no authentication,
+// or TLS, so it should only be reachable by trusted mail servers (e.g. the
+// MTA of the domain, forwarding the messages of the mailboxes).
+package smtpd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRecipients is the maximum number of recipients of a message.
+	maxRecipients = 100
+	// timeout is the time a client has to send a command, or a message.
+	timeout = time.Minute * 5
+)
+
+// ErrServerClosed is returned by Serve once the server is closed.
+var ErrServerClosed = errors.New("smtpd: server closed")
+
+// Error is an SMTP reply to a message that was not accepted.
+// Errors that are not an Error are replied to with '451', so that the sender
+// retries the message later.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Envelope is a received message.
+type Envelope struct {
+	// RemoteAddr is the address of the client.
+	RemoteAddr string
+	// From is the sender ('MAIL FROM'), which is empty for bounces.
+	From string
+	// To are the accepted recipients ('RCPT TO').
+	To []string
+	// Data is the message (headers, and body).
+	Data []byte
+}
+
+// Server receives the messages of its mailboxes.
+type Server struct {
+	// Hostname is the name of the server, in its greeting.
+	Hostname string
+	// MaxBytes is the maximum size of a message.
+	MaxBytes int64
+	// Accept returns true if a recipient is a mailbox of the server.
+	Accept func(rcpt string) bool
+	// Handle processes a received message. The message is only accepted
+	// once it returns.
+	Handle func(Envelope) error
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// Serve accepts connections on the listener until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 100)
+				continue
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// Close stops accepting connections. Sessions in progress are completed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// session is the state of a connection.
+type session struct {
+	s    *Server
+	conn net.Conn
+	text *textproto.Conn
+	from *string
+	to   []string
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	ss := &session{s: s, conn: conn, text: textproto.NewConn(conn)}
+	ss.reply(220, s.Hostname+" ESMTP weaver")
+	for {
+		conn.SetDeadline(time.Now().Add(timeout))
+		line, err := ss.text.ReadLine()
+		if err != nil {
+			return
+		}
+		if !ss.command(line) {
+			return
+		}
+	}
+}
+
+func (ss *session) reply(code int, lines ...string) {
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		ss.text.PrintfLine("%d%s%s", code, sep, l)
+	}
+}
+
+func (ss *session) reset() {
+	ss.from, ss.to = nil, nil
+}
+
+// command runs a command, and returns false once the session is over.
+func (ss *session) command(line string) bool {
+	verb, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch strings.ToUpper(verb) {
+	case "HELO":
+		ss.reset()
+		ss.reply(250, ss.s.Hostname)
+	case "EHLO":
+		ss.reset()
+		ss.reply(250, ss.s.Hostname, "8BITMIME", "SIZE "+strconv.FormatInt(ss.s.MaxBytes, 10))
+	case "MAIL":
+		ss.mail(arg)
+	case "RCPT":
+		ss.rcpt(arg)
+	case "DATA":
+		ss.data()
+	case "RSET":
+		ss.reset()
+		ss.reply(250, "OK")
+	case "NOOP":
+		ss.reply(250, "OK")
+	case "VRFY":
+		ss.reply(252, "Cannot verify the user")
+	case "QUIT":
+		ss.reply(221, "Bye")
+		return false
+	default:
+		ss.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+func (ss *session) mail(arg string) {
+	if ss.from != nil {
+		ss.reply(503, "Sender already specified")
+		return
+	}
+	addr, params, ok := path(arg, "FROM:")
+	if !ok {
+		ss.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		if strings.EqualFold(kv[0], "SIZE") && len(kv) == 2 {
+			if n, err := strconv.ParseInt(kv[1], 10, 64); err == nil && n > ss.s.MaxBytes {
+				ss.reply(552, "Message exceeds the maximum size")
+				return
+			}
+		}
+	}
+	ss.from = &addr
+	ss.reply(250, "OK")
+}
+
+func (ss *session) rcpt(arg string) {
+	if ss.from == nil {
+		ss.reply(503, "Need MAIL before RCPT")
+		return
+	}
+	addr, _, ok := path(arg, "TO:")
+	if !ok || addr == "" {
+		ss.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(ss.to) >= maxRecipients {
+		ss.reply(452, "Too many recipients")
+		return
+	}
+	if ss.s.Accept != nil && !ss.s.Accept(addr) {
+		ss.reply(550, "Mailbox unavailable")
+		return
+	}
+	ss.to = append(ss.to, addr)
+	ss.reply(250, "OK")
+}
+
+func (ss *session) data() {
+	if ss.from == nil || len(ss.to) == 0 {
+		ss.reply(503, "Need RCPT before DATA")
+		return
+	}
+	ss.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	r := ss.text.DotReader()
+	data, err := ioutil.ReadAll(io.LimitReader(r, ss.s.MaxBytes+1))
+	if err != nil {
+		return
+	}
+	if int64(len(data)) > ss.s.MaxBytes {
+		io.Copy(ioutil.Discard, r)
+		ss.reset()
+		ss.reply(552, "Message exceeds the maximum size")
+		return
+	}
+	// The dot reader returns lines ending with '\n' only
+	data = bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)
+
+	e := Envelope{RemoteAddr: ss.conn.RemoteAddr().String(), From: *ss.from, To: ss.to, Data: data}
+	ss.reset()
+	err = ss.s.Handle(e)
+	ss.conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		if se, ok := err.(*Error); ok {
+			ss.reply(se.Code, se.Message)
+			return
+		}
+		log.Printf("[SMTP] unable to process message from %s: %+v\n", e.From, err)
+		ss.reply(451, "Unable to process the message, try again later")
+		return
+	}
+	ss.reply(250, "OK")
+}
+
+// path parses the '<address>' of a 'MAIL', or 'RCPT' command after its
+// prefix, and the parameters following it.
+func path(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	return arg[1:end], strings.Fields(arg[end+1:]), true
+}
@@ -0,0 +1,118 @@
+package smtpd
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func startTestServer(t *testing.T, handle func(Envelope) error) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Hostname: "weaver.test",
+		MaxBytes: 1024,
+		Accept:   func(rcpt string) bool { return rcpt == "archive@weaver.test" },
+		Handle:   handle,
+	}
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+const message = "From: a@example.com\r\nSubject: Invoice\r\n\r\nHello\r\n.leading dot\r\n"
+
+func TestServer(t *testing.T) {
+	received := make(chan Envelope, 1)
+	s, addr := startTestServer(t, func(e Envelope) error {
+		received <- e
+		return nil
+	})
+	defer s.Close()
+
+	if err := smtp.SendMail(addr, nil, "a@example.com", []string{"archive@weaver.test"}, []byte(message)); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	e := <-received
+	if got, want := e.From, "a@example.com"; got != want {
+		t.Errorf("expected from %q, got %q", want, got)
+	}
+	if got, want := strings.Join(e.To, ","), "archive@weaver.test"; got != want {
+		t.Errorf("expected to %q, got %q", want, got)
+	}
+	if got, want := string(e.Data), message; got != want {
+		t.Errorf("expected data %q, got %q", want, got)
+	}
+}
+
+func TestServer_unknownMailbox(t *testing.T) {
+	s, addr := startTestServer(t, func(e Envelope) error {
+		t.Error("expected the message not to be handled")
+		return nil
+	})
+	defer s.Close()
+
+	err := smtp.SendMail(addr, nil, "a@example.com", []string{"other@weaver.test"}, []byte(message))
+	if e, ok := err.(*textproto.Error); !ok || e.Code != 550 {
+		t.Errorf("expected 550, got %+v", err)
+	}
+}
+
+func TestServer_tooLarge(t *testing.T) {
+	s, addr := startTestServer(t, func(e Envelope) error {
+		t.Error("expected the message not to be handled")
+		return nil
+	})
+	defer s.Close()
+
+	err := smtp.SendMail(addr, nil, "a@example.com", []string{"archive@weaver.test"}, []byte(message+strings.Repeat("a", 2048)))
+	if e, ok := err.(*textproto.Error); !ok || e.Code != 552 {
+		t.Errorf("expected 552, got %+v", err)
+	}
+}
+
+func TestServer_rejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{&Error{Code: 554, Message: "5.6.0 Unable to convert the message"}, 554},
+		{errors.New("spool full"), 451},
+	}
+	for _, tt := range tests {
+		s, addr := startTestServer(t, func(e Envelope) error {
+			return tt.err
+		})
+		err := smtp.SendMail(addr, nil, "a@example.com", []string{"archive@weaver.test"}, []byte(message))
+		if e, ok := err.(*textproto.Error); !ok || e.Code != tt.code {
+			t.Errorf("expected %d for %v, got %+v", tt.code, tt.err, err)
+		}
+		s.Close()
+	}
+}
+
+func TestServer_close(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	errs := make(chan error)
+	go func() { errs <- s.Serve(l) }()
+	for {
+		s.mu.Lock()
+		serving := s.listener != nil
+		s.mu.Unlock()
+		if serving {
+			break
+		}
+	}
+	s.Close()
+	if err := <-errs; err != ErrServerClosed {
+		t.Errorf("expected %v, got %+v", ErrServerClosed, err)
+	}
+}
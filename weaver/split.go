@@ -0,0 +1,85 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// splitName returns the name of a document split from a document, with the
+// pages from the page number, e.g. 'invoice-1-3.pdf'.
+func splitName(name string, from, pages int) string {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if base == "" || base == "." || base == "/" {
+		base = "document"
+	}
+	if pages <= 1 {
+		return fmt.Sprintf("%s-%d.pdf", base, from)
+	}
+	return fmt.Sprintf("%s-%d-%d.pdf", base, from, from+pages-1)
+}
+
+// splitHandler splits a PDF document by page ranges ('ranges', e.g.
+// '1-3,4,5-'), or into single pages. A single document is returned as a PDF,
+// and several documents (or any with 'zip') as a ZIP archive.
+func splitHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	var ranges []pdf.Range
+	if spec := c.Query("ranges"); spec != "" {
+		var err error
+		if ranges, err = pdf.ParseRanges(spec); err != nil {
+			abortDocument(c, err)
+			return
+		}
+	}
+	b, name, err := readDocument(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	docs, err := pdf.Split(b, ranges...)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	s.Increment("split")
+
+	_, archive := c.GetQuery("zip")
+	if len(docs) == 1 && !archive {
+		c.Data(http.StatusOK, "application/pdf", docs[0])
+		return
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i, doc := range docs {
+		// Without ranges, there is a document per page
+		from := i + 1
+		if len(ranges) > 0 {
+			from = ranges[i].From
+		}
+		f, err := w.Create(splitName(name, from, pdf.PageCount(doc)))
+		if err == nil {
+			_, err = f.Write(doc)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("X-Document-Count", strconv.Itoa(len(docs)))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+// mockDocument returns a PDF document of two pages.
+func mockDocument(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("unable to read test PDF: %+v", err)
+	}
+	doc, err := pdf.Merge(b, b)
+	if err != nil {
+		t.Fatalf("unable to merge test PDF: %+v", err)
+	}
+	return doc
+}
+
+func mockDocumentRouter() *gin.Engine {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.Fetch.Retries = 0
+	return mockRouter(conf, Services{}, InitSecureRoutes)
+}
+
+// uploadRequest returns a request uploading a file as 'file'.
+func uploadRequest(target, name string, b []byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	f, _ := w.CreateFormFile("file", name)
+	f.Write(b)
+	w.Close()
+	req, _ := http.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestSplitHandler(t *testing.T) {
+	r := mockDocumentRouter()
+	doc := mockDocument(t)
+
+	// Every page is a document of the archive
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, uploadRequest("/pdf/split?auth=123456", "report.pdf", doc))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	if got, want := res.Header().Get("Content-Type"), "application/zip"; got != want {
+		t.Errorf("expected content type to be %s, got %s", want, got)
+	}
+	z, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+	if err != nil {
+		t.Fatalf("unable to read archive: %+v", err)
+	}
+	var names []string
+	for _, f := range z.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"report-1.pdf", "report-2.pdf"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected archive to contain %v, got %v", want, names)
+	}
+
+	// A single range is returned as a PDF
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, uploadRequest("/pdf/split?auth=123456&ranges=2-", "report.pdf", doc))
+	if got, want := res.Header().Get("Content-Type"), "application/pdf"; got != want {
+		t.Errorf("expected content type to be %s, got %s", want, got)
+	}
+	if got, want := pdf.PageCount(res.Body.Bytes()), 1; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
+
+func TestSplitHandler_url(t *testing.T) {
+	doc := mockDocument(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/invoice.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(doc)
+	}))
+	defer ts.Close()
+	r := mockDocumentRouter()
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"&url=" + ts.URL + "/invoice.pdf&ranges=1,1-2&zip", http.StatusOK},
+		{"&url=" + ts.URL + "/missing.pdf", http.StatusBadGateway},
+		{"&url=" + ts.URL + "/invoice.pdf&ranges=2-3", http.StatusBadRequest},
+		{"&ranges=1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/pdf/split?auth=123456"+tt.query, nil)
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %q to be %d, got %d", tt.query, want, got)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, uploadRequest("/pdf/split?auth=123456", "page.html", []byte("<html></html>")))
+	if got, want := res.Code, http.StatusUnprocessableEntity; got != want {
+		t.Errorf("expected response code of a HTML file to be %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,182 @@
+// Package spool stores the intermediate artifacts of conversions (e.g.
+// fetched, or uploaded sources, and generated outputs) in temporary files,
+// so that they are not held in memory, within a disk quota shared by all
+// conversions.
+package spool
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrQuotaExceeded should be returned when a file can not be written
+// because the spool is full.
+var ErrQuotaExceeded = errors.New("spool quota exceeded")
+
+// Spool creates temporary files in a directory, and accounts for their total
+// size. A nil Spool creates files in the system temporary directory without
+// a quota.
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+// New creates a spool of temporary files in dir (or the system temporary
+// directory if it is empty), which may hold up to maxBytes (0 disables the
+// quota).
+func New(dir string, maxBytes int64) *Spool {
+	return &Spool{dir: dir, maxBytes: maxBytes}
+}
+
+// Dir returns the directory of the temporary files.
+func (s *Spool) Dir() string {
+	if s == nil || s.dir == "" {
+		return os.TempDir()
+	}
+	return s.dir
+}
+
+// Used returns the total size of the temporary files.
+func (s *Spool) Used() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// reserve accounts for n more bytes. It returns false if the quota would be
+// exceeded.
+func (s *Spool) reserve(n int64) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxBytes > 0 && s.used+n > s.maxBytes {
+		return false
+	}
+	s.used += n
+	return true
+}
+
+// release accounts for n bytes that have been removed.
+func (s *Spool) release(n int64) {
+	if s == nil || n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	if s.used < 0 {
+		s.used = 0
+	}
+}
+
+// Create creates a temporary file (see ioutil.TempFile for the pattern).
+func (s *Spool) Create(pattern string) (*File, error) {
+	f, err := ioutil.TempFile(s.Dir(), pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f, s: s}, nil
+}
+
+// Remove removes a temporary file (which may have been renamed since it was
+// created), and releases its size from the quota.
+func (s *Spool) Remove(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.release(info.Size())
+	return nil
+}
+
+// File is a temporary file of a spool. Writes fail with ErrQuotaExceeded if
+// the spool is full.
+type File struct {
+	f *os.File
+	s *Spool
+}
+
+// Name returns the path of the file.
+func (f *File) Name() string {
+	return f.f.Name()
+}
+
+// Write writes to the file within the quota of the spool.
+func (f *File) Write(p []byte) (int, error) {
+	if !f.s.reserve(int64(len(p))) {
+		return 0, ErrQuotaExceeded
+	}
+	n, err := f.f.Write(p)
+	f.s.release(int64(len(p) - n))
+	return n, err
+}
+
+// Claim accounts for the content written to the (empty) file by another
+// process, e.g. a command given its path. If it does not fit in the spool,
+// the file is truncated, and ErrQuotaExceeded is returned.
+func (f *File) Claim() error {
+	size, err := f.Size()
+	if err != nil {
+		return err
+	}
+	if !f.s.reserve(size) {
+		f.f.Truncate(0)
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Read reads from the file.
+func (f *File) Read(p []byte) (int, error) {
+	return f.f.Read(p)
+}
+
+// Seek sets the offset of the next Read, or Write.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return f.f.Seek(offset, whence)
+}
+
+// Size returns the size of the file.
+func (f *File) Size() (int64, error) {
+	info, err := f.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Bytes returns the content of the file, read into a slice of its exact
+// size.
+func (f *File) Bytes() ([]byte, error) {
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	_, err = f.f.ReadAt(b, 0)
+	return b, err
+}
+
+// Close closes the file, without removing it.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Remove closes, and removes the file.
+func (f *File) Remove() error {
+	f.f.Close()
+	return f.s.Remove(f.f.Name())
+}
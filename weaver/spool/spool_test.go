@@ -0,0 +1,114 @@
+package spool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mockSpool(t *testing.T, maxBytes int64) *Spool {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return New(dir, maxBytes)
+}
+
+func TestSpool(t *testing.T) {
+	s := mockSpool(t, 10)
+	f, err := s.Create("test.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filepath.Dir(f.Name()), s.Dir(); got != want {
+		t.Errorf("expected file to be created in %s, got %s", want, got)
+	}
+	if _, err := f.Write([]byte("athena")); err != nil {
+		t.Fatalf("expected write to succeed, got %v", err)
+	}
+	if got, want := s.Used(), int64(6); got != want {
+		t.Errorf("expected used bytes to be %d, got %d", want, got)
+	}
+	if _, err := f.Write([]byte("weaver")); err != ErrQuotaExceeded {
+		t.Errorf("expected error to be %v, got %v", ErrQuotaExceeded, err)
+	}
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "athena"; got != want {
+		t.Errorf("expected content to be %q, got %q", want, got)
+	}
+
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+	if got, want := s.Used(), int64(0); got != want {
+		t.Errorf("expected used bytes to be released, got %d", got)
+	}
+}
+
+func TestSpool_renamed(t *testing.T) {
+	s := mockSpool(t, 0)
+	f, _ := s.Create("test.*")
+	f.Write(make([]byte, 1024))
+	f.Close()
+	path := f.Name() + ".html"
+	if err := os.Rename(f.Name(), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Used(); got != 0 {
+		t.Errorf("expected used bytes to be released, got %d", got)
+	}
+}
+
+func TestSpool_nil(t *testing.T) {
+	var s *Spool
+	f, err := s.Create("test.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	if got, want := filepath.Dir(f.Name()), os.TempDir(); got != want {
+		t.Errorf("expected file to be created in %s, got %s", want, got)
+	}
+	if _, err := f.Write(make([]byte, 1024)); err != nil {
+		t.Errorf("expected write without a quota to succeed, got %v", err)
+	}
+}
+
+func TestFile_Claim(t *testing.T) {
+	s := mockSpool(t, 10)
+	f, _ := s.Create("test.*")
+	defer f.Remove()
+	if err := ioutil.WriteFile(f.Name(), []byte("athena"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Claim(); err != nil {
+		t.Fatalf("expected claim to succeed, got %v", err)
+	}
+	if got, want := s.Used(), int64(6); got != want {
+		t.Errorf("expected used bytes to be %d, got %d", want, got)
+	}
+
+	g, _ := s.Create("test.*")
+	defer g.Remove()
+	ioutil.WriteFile(g.Name(), []byte("weaver"), 0600)
+	if err := g.Claim(); err != ErrQuotaExceeded {
+		t.Errorf("expected error to be %v, got %v", ErrQuotaExceeded, err)
+	}
+	if size, _ := g.Size(); size != 0 {
+		t.Errorf("expected file over the quota to be truncated, got %d bytes", size)
+	}
+	if got, want := s.Used(), int64(6); got != want {
+		t.Errorf("expected used bytes to be %d, got %d", want, got)
+	}
+}
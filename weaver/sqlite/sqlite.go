@@ -0,0 +1,139 @@
+// Package sqlite opens an embedded SQLite database for single-node
+// deployments, and migrates its schema. It stores the job history, tenants
+// (API keys), tenant usage, the document registry, and the scheduled
+// deletions of uploaded outputs without an external database.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Registers the 'sqlite' database/sql driver (pure Go, no cgo)
+	_ "modernc.org/sqlite"
+)
+
+// migrations are the statements applied to the database in order. The
+// version of a migration is its index + 1. Existing migrations must never be
+// changed; append a new one instead.
+var migrations = []string{
+	// 1: job history (see history.SQLiteStore), tenants, and usage (see
+	// tenant.SQLiteUsageStore)
+	`CREATE TABLE weaver_history (
+		id            TEXT PRIMARY KEY,
+		request_id    TEXT NOT NULL DEFAULT '',
+		time          INTEGER NOT NULL,
+		status        TEXT NOT NULL,
+		tenant        TEXT NOT NULL DEFAULT '',
+		source        TEXT NOT NULL DEFAULT '',
+		domain        TEXT NOT NULL DEFAULT '',
+		format        TEXT NOT NULL DEFAULT '',
+		engine        TEXT NOT NULL DEFAULT '',
+		code          TEXT NOT NULL DEFAULT '',
+		error         TEXT NOT NULL DEFAULT '',
+		pages         INTEGER NOT NULL DEFAULT 0,
+		bytes         INTEGER NOT NULL DEFAULT 0,
+		duration_ms   INTEGER NOT NULL DEFAULT 0,
+		queue_wait_ms INTEGER NOT NULL DEFAULT 0,
+		s3_bucket     TEXT NOT NULL DEFAULT '',
+		s3_key        TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX weaver_history_time ON weaver_history (time DESC);
+	CREATE INDEX weaver_history_tenant_time ON weaver_history (tenant, time DESC);
+	CREATE TABLE weaver_tenants (
+		id     TEXT PRIMARY KEY,
+		key    TEXT NOT NULL UNIQUE,
+		tenant TEXT NOT NULL
+	);
+	CREATE TABLE weaver_usage (
+		tenant      TEXT NOT NULL,
+		month       TEXT NOT NULL,
+		conversions INTEGER NOT NULL DEFAULT 0,
+		pages       INTEGER NOT NULL DEFAULT 0,
+		bytes       INTEGER NOT NULL DEFAULT 0,
+		cpu_seconds REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (tenant, month)
+	);`,
+	// 2: document registry (see registry.SQLStore)
+	`CREATE TABLE weaver_registry (
+		sha256 TEXT PRIMARY KEY,
+		time   BIGINT NOT NULL,
+		job    TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		format TEXT NOT NULL DEFAULT '',
+		pages  INTEGER NOT NULL DEFAULT 0,
+		bytes  BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE INDEX weaver_registry_tenant ON weaver_registry (tenant);`,
+	// 3: scheduled deletions of uploaded outputs (see retention.SQLStore)
+	`CREATE TABLE weaver_retention (
+		bucket TEXT NOT NULL,
+		key    TEXT NOT NULL,
+		region TEXT NOT NULL DEFAULT '',
+		due    BIGINT NOT NULL,
+		job    TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (bucket, key)
+	);
+	CREATE INDEX weaver_retention_due ON weaver_retention (due);`,
+	// 4: data subjects of jobs, and the regions of their outputs (see
+	// history.Job), and the documents of jobs (to erase them)
+	`ALTER TABLE weaver_history ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+	ALTER TABLE weaver_history ADD COLUMN s3_region TEXT NOT NULL DEFAULT '';
+	CREATE INDEX weaver_history_tenant_subject ON weaver_history (tenant, subject);
+	CREATE INDEX weaver_registry_job ON weaver_registry (job);`,
+	// 5: diagnostics of jobs (see history.Job)
+	`ALTER TABLE weaver_history ADD COLUMN diagnostics TEXT NOT NULL DEFAULT '';`,
+	// 6: jobs of uploaded outputs (to erase outputs no job references)
+	`CREATE INDEX weaver_history_s3_key ON weaver_history (s3_key, s3_bucket);`,
+}
+
+// Open opens (or creates) the database file at the path, and applies any
+// pending migrations. Writers from other processes (e.g. 'weaver tenants')
+// are waited for, for up to 5 seconds.
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serialises the writes of this process
+	db.SetMaxOpenConns(1)
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the pending migrations to the database in a single
+// transaction. The applied versions are recorded in the 'weaver_migrations'
+// table.
+func Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS weaver_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM weaver_migrations").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %+v", i+1, err)
+		}
+		if _, err := tx.Exec("INSERT INTO weaver_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
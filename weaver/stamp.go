@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/pdf"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrStampsInvalid should be returned when the stamps of a PDF document
+	// are invalid.
+	ErrStampsInvalid = errors.New("invalid stamps provided (stamps)")
+	// ErrStampNoImage should be returned when an image stamp is requested
+	// without an image.
+	ErrStampNoImage = errors.New("an image (image) is required for image stamps")
+	// ErrCodesInvalid should be returned when the QR codes, and barcodes of
+	// a conversion are invalid.
+	ErrCodesInvalid = errors.New("invalid codes provided (a JSON array of qr, or barcode stamps)")
+	// ErrCodesFormat should be returned when QR codes, and barcodes are
+	// requested for a format other than PDF, or TIFF.
+	ErrCodesFormat = errors.New("codes are only supported by the PDF, and TIFF formats")
+)
+
+// defaultStampMargin is the distance of stamps from the edges of the page,
+// in points (half an inch).
+const defaultStampMargin = 36
+
+// StampOptions is a stamp applied to a PDF document, as an element of the
+// 'stamps' JSON array (see stampHandler).
+type StampOptions struct {
+	// Type is 'text' (e.g. a watermark), 'bates', 'qr', 'barcode' (Code
+	// 128), or 'image' (the uploaded 'image').
+	Type string `json:"type"`
+	// Text is the text of the stamp, or the content of a QR code, or
+	// barcode. '{page}',
+	// '{pages}', and '{bates}' are replaced by the page number, the page
+	// count, and the Bates number. Defaults to '{bates}' for Bates stamps.
+	Text string `json:"text"`
+	// Start, and Digits are the first Bates number, and the minimum number
+	// of digits. Default to 1, and 6.
+	Start  int `json:"start"`
+	Digits int `json:"digits"`
+	// Position is 'center', an edge (e.g. 'top'), or a corner (e.g.
+	// 'top-left'). Defaults to 'bottom-right' for Bates stamps,
+	// 'bottom-left' for QR codes, and barcodes, and 'center' otherwise.
+	Position string `json:"position"`
+	// Size is the font size of text, or the width of an image, QR code, or
+	// barcode, in points.
+	Size float64 `json:"size"`
+	// Height is the height of barcodes, in points. Defaults to a third of
+	// their width.
+	Height float64 `json:"height"`
+	// Pages are the page ranges the stamp is drawn on, e.g. '1', or '2-'
+	// (see pdf.ParseRanges). Defaults to every page.
+	Pages string `json:"pages"`
+	// Margin is the distance from the edges of the page, in points. Defaults
+	// to 36 (half an inch).
+	Margin   *float64 `json:"margin"`
+	Rotation float64  `json:"rotation"`
+	// Opacity is between 0 (exclusive), and 1. Defaults to 1.
+	Opacity float64 `json:"opacity"`
+	// Color is the color of text, e.g. '#ff0000'. Defaults to black.
+	Color string `json:"color"`
+}
+
+// parseColor returns the RGB components of a hexadecimal color (e.g.
+// '#ff0000').
+func parseColor(s string) ([3]float64, bool) {
+	var rgb [3]float64
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return rgb, false
+	}
+	for i := range rgb {
+		n, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return rgb, false
+		}
+		rgb[i] = float64(n) / 255
+	}
+	return rgb, true
+}
+
+// overlay returns the overlay of a stamp, with the uploaded image (if any).
+func (o StampOptions) overlay(img *pdf.Image) (pdf.Overlay, error) {
+	overlay := pdf.Overlay{
+		Text:     o.Text,
+		Position: pdf.Position(o.Position),
+		Size:     o.Size,
+		Margin:   defaultStampMargin,
+		Rotation: o.Rotation,
+		Opacity:  o.Opacity,
+	}
+	if o.Margin != nil {
+		overlay.Margin = *o.Margin
+	}
+	if o.Size < 0 || o.Height < 0 || o.Opacity < 0 || o.Opacity > 1 {
+		return overlay, ErrStampsInvalid
+	}
+	if o.Pages != "" {
+		pages, err := pdf.ParseRanges(o.Pages)
+		if err != nil {
+			return overlay, err
+		}
+		overlay.Pages = pages
+	}
+	if o.Color != "" {
+		rgb, ok := parseColor(o.Color)
+		if !ok {
+			return overlay, ErrStampsInvalid
+		}
+		overlay.Color = rgb
+	}
+
+	switch o.Type {
+	case "text":
+		if o.Text == "" {
+			return overlay, ErrStampsInvalid
+		}
+	case "bates":
+		overlay.Bates = pdf.Bates{Start: o.Start, Digits: o.Digits}
+		if overlay.Bates.Start == 0 {
+			overlay.Bates.Start = 1
+		}
+		if overlay.Bates.Digits == 0 {
+			overlay.Bates.Digits = 6
+		}
+		if overlay.Text == "" {
+			overlay.Text = "{bates}"
+		}
+		if overlay.Position == "" {
+			overlay.Position = "bottom-right"
+		}
+	case "qr", "barcode":
+		if o.Text == "" {
+			return overlay, ErrStampsInvalid
+		}
+		overlay.QR = o.Type == "qr"
+		overlay.Barcode = o.Type == "barcode"
+		overlay.Height = o.Height
+		if overlay.Position == "" {
+			overlay.Position = "bottom-left"
+		}
+	case "image":
+		if img == nil {
+			return overlay, ErrStampNoImage
+		}
+		overlay.Image = img
+	default:
+		return overlay, ErrStampsInvalid
+	}
+	return overlay, nil
+}
+
+// stampOverlays returns the overlays of the stamps of a request ('stamps'),
+// with the uploaded image ('image'), if any.
+func stampOverlays(c *gin.Context) ([]pdf.Overlay, error) {
+	conf := c.MustGet("config").(Config)
+
+	var stamps []StampOptions
+	if err := json.Unmarshal([]byte(c.Request.FormValue("stamps")), &stamps); err != nil || len(stamps) == 0 {
+		return nil, ErrStampsInvalid
+	}
+	var img *pdf.Image
+	if file, _, err := c.Request.FormFile("image"); err == nil {
+		defer file.Close()
+		used := 0
+		b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+		if err != nil {
+			return nil, err
+		}
+		if img, err = pdf.NewImage(b); err != nil {
+			return nil, err
+		}
+	}
+
+	overlays := make([]pdf.Overlay, len(stamps))
+	for i, s := range stamps {
+		var err error
+		if overlays[i], err = s.overlay(img); err != nil {
+			return nil, err
+		}
+	}
+	return overlays, nil
+}
+
+// codeOverlays returns the overlays of the QR codes, and barcodes of a
+// conversion (see requestCodes), from their JSON array of stamps.
+func codeOverlays(spec string) ([]pdf.Overlay, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var stamps []StampOptions
+	if err := json.Unmarshal([]byte(spec), &stamps); err != nil || len(stamps) == 0 {
+		return nil, ErrCodesInvalid
+	}
+	overlays := make([]pdf.Overlay, len(stamps))
+	for i, s := range stamps {
+		if s.Type != "qr" && s.Type != "barcode" {
+			return nil, ErrCodesInvalid
+		}
+		var err error
+		if overlays[i], err = s.overlay(nil); err == ErrStampsInvalid {
+			return nil, ErrCodesInvalid
+		} else if err != nil {
+			return nil, err
+		}
+		// The page count of the output is not known yet
+		if err := overlays[i].Validate(1); err != nil {
+			return nil, err
+		}
+	}
+	return overlays, nil
+}
+
+// requestCodes returns the QR codes, and barcodes placed on the output of a
+// conversion ('codes', a JSON array of qr, and barcode stamps, see
+// StampOptions), e.g. for document routing, or verification links.
+func requestCodes(c *gin.Context) ([]pdf.Overlay, error) {
+	return codeOverlays(c.Query("codes"))
+}
+
+// checkCodes validates the QR codes, and barcodes of a conversion.
+func checkCodes(c *gin.Context) error {
+	overlays, err := requestCodes(c)
+	if len(overlays) == 0 || err != nil {
+		return err
+	}
+	if format, _ := outputFormat(c); format != athenapdf.FormatPDF && format != athenapdf.FormatTIFF {
+		return ErrCodesFormat
+	}
+	return nil
+}
+
+// stampHandler applies stamps ('stamps', see StampOptions) to a PDF document:
+// text (e.g. watermarks), Bates numbers, QR codes, barcodes, or an image. The content
+// of the document is not rendered again.
+func stampHandler(c *gin.Context) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	overlays, err := stampOverlays(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	b, _, err := readDocument(c)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+	out, err := pdf.Stamp(b, overlays...)
+	if err != nil {
+		abortDocument(c, err)
+		return
+	}
+
+	s.Increment("stamp")
+	c.Header("X-Page-Count", strconv.Itoa(pdf.PageCount(out)))
+	c.Data(http.StatusOK, "application/pdf", out)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/pdf"
+)
+
+func TestStampHandler(t *testing.T) {
+	r := mockDocumentRouter()
+	doc := mockDocument(t)
+
+	stamps := `[{"type":"text","text":"DRAFT","size":72,"rotation":45,"opacity":0.2,"color":"#ff0000"},{"type":"bates","text":"DOC-{bates}","start":7}]`
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, uploadRequest("/pdf/stamp?auth=123456&stamps="+url.QueryEscape(stamps), "report.pdf", doc))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	if got, want := res.Header().Get("X-Page-Count"), "2"; got != want {
+		t.Errorf("expected page count to be %s, got %s", want, got)
+	}
+	for _, s := range []string{"(DOC-000007) Tj", "(DOC-000008) Tj", "1 0 0 rg"} {
+		if !bytes.Contains(res.Body.Bytes(), []byte(s)) {
+			t.Errorf("expected stamped document to contain %q", s)
+		}
+	}
+	if got, want := pdf.PageCount(res.Body.Bytes()), 2; got != want {
+		t.Errorf("expected page count to be %d, got %d", want, got)
+	}
+}
+
+func TestStampHandler_invalid(t *testing.T) {
+	r := mockDocumentRouter()
+	doc := mockDocument(t)
+
+	tests := []struct {
+		stamps string
+		code   int
+	}{
+		{``, http.StatusBadRequest},
+		{`[{"type":"sticker"}]`, http.StatusBadRequest},
+		{`[{"type":"text"}]`, http.StatusBadRequest},
+		{`[{"type":"text","text":"DRAFT","color":"red"}]`, http.StatusBadRequest},
+		{`[{"type":"image"}]`, http.StatusBadRequest},
+		{`[{"type":"qr","text":"https://example.com","position":"middle"}]`, http.StatusBadRequest},
+		{`[{"type":"barcode","text":"naïve"}]`, http.StatusBadRequest},
+		{`[{"type":"barcode","text":"INV-42","pages":"0"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, uploadRequest("/pdf/stamp?auth=123456&stamps="+url.QueryEscape(tt.stamps), "report.pdf", doc))
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d", tt.stamps, want, got)
+		}
+	}
+}
+
+func TestConvertByFileHandler_codes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "converter.sh")
+	ioutil.WriteFile(script, []byte("cat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{`&codes=` + url.QueryEscape(`[{"type":"qr","text":"https://example.com/verify/42","position":"top-right","size":60},{"type":"barcode","text":"INV-{page}","pages":"1"}]`), http.StatusOK},
+		{`&codes=` + url.QueryEscape(`[{"type":"text","text":"DRAFT"}]`), http.StatusBadRequest},
+		{`&codes=` + url.QueryEscape(`[{"type":"barcode","text":"INV-42"}]`) + `&format=png`, http.StatusBadRequest},
+		{`&codes=` + url.QueryEscape(`[{"type":"barcode","text":"INV-42","position":"middle"}]`), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := streamRecorder{httptest.NewRecorder()}
+		r.ServeHTTP(res, uploadRequest("/convert?auth=123456&ext=html"+tt.query, "page.html", []byte("<p>Invoice</p>")))
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of %s to be %d, got %d: %s", tt.query, want, got, res.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if !bytes.Contains(res.Body.Bytes(), []byte("/WvOverlay Do")) {
+			t.Errorf("expected the codes of %s to be drawn, got %s", tt.query, res.Body.String())
+		}
+		if got, want := pdf.PageCount(res.Body.Bytes()), 1; got != want {
+			t.Errorf("expected page count to be %d, got %d", want, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tenant
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrProfileOverride should be returned when a request sets an option
+	// that is fixed by the profile of its tenant.
+	ErrProfileOverride = errors.New("option is fixed by the profile of the auth key")
+	// ErrDomainNotAllowed should be returned when a request converts a URL
+	// outside of the allowed domains of its tenant.
+	ErrDomainNotAllowed = errors.New("url is not in the allowed domains of the auth key")
+	// ErrProfileInvalid should be returned when a profile is invalid.
+	ErrProfileInvalid = errors.New("invalid tenant profile: options must have names (other than auth), and allowed domains must not be empty")
+)
+
+// Profile contains the default conversion options of a tenant, so that its
+// clients do not need to pass them with every conversion.
+type Profile struct {
+	// Options are the default query parameters of conversions (e.g.
+	// 'page_size', 'margins', or 'media').
+	Options map[string]string `json:"options,omitempty"`
+	// Overridable lists the options of the profile requests may set to
+	// another value. The other options are fixed.
+	Overridable []string `json:"overridable,omitempty"`
+	// AllowedDomains restricts the URLs of conversions to these domains, and
+	// their subdomains (any domain if it is empty).
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+}
+
+// Validate checks that the options of a profile have names (the auth key
+// cannot be set), and that its domains are not empty.
+func (p *Profile) Validate() error {
+	for name := range p.Options {
+		if name == "" || name == "auth" {
+			return ErrProfileInvalid
+		}
+	}
+	for _, d := range p.AllowedDomains {
+		if strings.Trim(d, ".") == "" {
+			return ErrProfileInvalid
+		}
+	}
+	return nil
+}
+
+// overridable returns true if requests may override an option.
+func (p *Profile) overridable(name string) bool {
+	for _, o := range p.Overridable {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the options of the profile that the query does not set. It
+// returns the name of an option, and ErrProfileOverride if the query sets a
+// fixed option to another value.
+func (p *Profile) Apply(q url.Values) (string, error) {
+	for name, value := range p.Options {
+		v, ok := q[name]
+		if !ok {
+			q.Set(name, value)
+			continue
+		}
+		if !p.overridable(name) && (len(v) != 1 || v[0] != value) {
+			return name, ErrProfileOverride
+		}
+	}
+	return "", nil
+}
+
+// AllowsHost returns true if the profile allows conversions of URLs of a
+// host.
+func (p *Profile) AllowsHost(host string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range p.AllowedDomains {
+		d = strings.ToLower(strings.Trim(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package tenant
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestProfileApply(t *testing.T) {
+	p := &Profile{Options: map[string]string{"page_size": "A4", "margins": "1cm"}, Overridable: []string{"margins"}}
+	q := url.Values{"margins": {"2cm"}}
+	if _, err := p.Apply(q); err != nil {
+		t.Fatalf("apply returned an unexpected error: %+v", err)
+	}
+	if got, want := q.Encode(), "margins=2cm&page_size=A4"; got != want {
+		t.Errorf("expected query to be %s, got %s", want, got)
+	}
+	if name, err := p.Apply(url.Values{"page_size": {"Letter"}}); err != ErrProfileOverride || name != "page_size" {
+		t.Errorf("expected error of a fixed option to be %v (page_size), got %v (%s)", ErrProfileOverride, err, name)
+	}
+}
+
+func TestProfileAllowsHost(t *testing.T) {
+	p := &Profile{AllowedDomains: []string{"acme.com"}}
+	for host, want := range map[string]bool{
+		"acme.com":          true,
+		"Invoices.ACME.com": true,
+		"acme.com.":         true,
+		"notacme.com":       false,
+		"acme.com.evil.com": false,
+	} {
+		if got := p.AllowsHost(host); got != want {
+			t.Errorf("expected %s to be allowed: %v, got %v", host, want, got)
+		}
+	}
+	if !(&Profile{}).AllowsHost("example.com") {
+		t.Errorf("expected a profile without allowed domains to allow any host")
+	}
+}
+
+func TestNewRegistry_invalidProfile(t *testing.T) {
+	_, err := NewRegistry([]Tenant{{ID: "acme", Key: "acme-key", Profile: &Profile{Options: map[string]string{"auth": "other-key"}}}})
+	if err != ErrProfileInvalid {
+		t.Errorf("expected error of an invalid profile to be %v, got %v", ErrProfileInvalid, err)
+	}
+}
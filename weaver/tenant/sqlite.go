@@ -0,0 +1,118 @@
+package tenant
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// LoadSQLiteRegistry creates a registry from the tenants in the
+// 'weaver_tenants' table of an embedded SQLite database (see the sqlite
+// package).
+func LoadSQLiteRegistry(db *sql.DB) (*Registry, error) {
+	tenants, err := ReadSQLiteTenants(db)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(tenants)
+}
+
+// ReloadSQLite replaces all tenants of the registry with the tenants in the
+// database (see LoadSQLiteRegistry).
+func (r *Registry) ReloadSQLite(db *sql.DB) error {
+	tenants, err := ReadSQLiteTenants(db)
+	if err != nil {
+		return err
+	}
+	return r.Replace(tenants)
+}
+
+// ReadSQLiteTenants returns the tenants in the database ordered by ID.
+func ReadSQLiteTenants(db *sql.DB) ([]Tenant, error) {
+	rows, err := db.Query("SELECT tenant FROM weaver_tenants ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []Tenant
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		var t Tenant
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// WriteSQLiteTenants replaces all tenants in the database. The database is
+// unchanged if any of the tenants is invalid.
+func WriteSQLiteTenants(db *sql.DB, tenants []Tenant) error {
+	if _, err := NewRegistry(tenants); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM weaver_tenants"); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO weaver_tenants (id, key, tenant) VALUES ($1, $2, $3)", t.ID, t.Key, string(b)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SQLiteUsageStore persists usage to the 'weaver_usage' table of an
+// embedded SQLite database (see the sqlite package).
+type SQLiteUsageStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteUsageStore creates a usage store using a migrated database.
+func NewSQLiteUsageStore(db *sql.DB) *SQLiteUsageStore {
+	return &SQLiteUsageStore{db}
+}
+
+// Load returns the usage of all tenants in all months.
+func (s *SQLiteUsageStore) Load() ([]Usage, error) {
+	rows, err := s.db.Query("SELECT tenant, month, conversions, pages, bytes, cpu_seconds FROM weaver_usage")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []Usage
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.Tenant, &u.Month, &u.Conversions, &u.Pages, &u.Bytes, &u.CPUSeconds); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// Save persists the usage of a tenant in a month.
+func (s *SQLiteUsageStore) Save(u Usage) error {
+	_, err := s.db.Exec(`INSERT INTO weaver_usage (tenant, month, conversions, pages, bytes, cpu_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, month) DO UPDATE SET
+			conversions = EXCLUDED.conversions, pages = EXCLUDED.pages,
+			bytes = EXCLUDED.bytes, cpu_seconds = EXCLUDED.cpu_seconds`,
+		u.Tenant, u.Month, u.Conversions, u.Pages, u.Bytes, u.CPUSeconds,
+	)
+	return err
+}
@@ -0,0 +1,55 @@
+package tenant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/sqlite"
+)
+
+func TestSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tenant")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sqlite.Open(filepath.Join(dir, "weaver.db"))
+	if err != nil {
+		t.Fatalf("unable to open database: %+v", err)
+	}
+	defer db.Close()
+
+	if err := WriteSQLiteTenants(db, []Tenant{{ID: "acme"}}); err != ErrTenantInvalid {
+		t.Errorf("expected writing an invalid tenant to return %v, got %v", ErrTenantInvalid, err)
+	}
+	tenants := []Tenant{{ID: "acme", Key: "acme-secret", Quota: Quota{Conversions: 10}}}
+	if err := WriteSQLiteTenants(db, tenants); err != nil {
+		t.Fatalf("unable to write tenants: %+v", err)
+	}
+	r, err := LoadSQLiteRegistry(db)
+	if err != nil {
+		t.Fatalf("unable to load tenants: %+v", err)
+	}
+	if got, ok := r.ByKey("acme-secret"); !ok || got.Quota.Conversions != 10 {
+		t.Errorf("expected tenant acme with its quota, got %+v", got)
+	}
+
+	a, _ := NewStoreAccountant(NewSQLiteUsageStore(db))
+	a.Record("acme", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), 2, 100, time.Second)
+	a.Record("acme", time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC), 1, 50, 0)
+
+	loaded, err := NewStoreAccountant(NewSQLiteUsageStore(db))
+	if err != nil {
+		t.Fatalf("new accountant returned an unexpected error: %+v", err)
+	}
+	u := loaded.Usage("acme", "2018-06")
+	if got, want := u.Conversions, int64(2); got != want {
+		t.Errorf("expected loaded conversions to be %d, got %d", want, got)
+	}
+	if got, want := u.Bytes, int64(150); got != want {
+		t.Errorf("expected loaded bytes to be %d, got %d", want, got)
+	}
+}
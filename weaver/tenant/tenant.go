@@ -0,0 +1,155 @@
+// Package tenant provides tenants (tied to API keys), and per-tenant usage
+// accounting with monthly quotas.
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/lachee/athenapdf/weaver/politeness"
+)
+
+var (
+	// ErrQuotaExceeded should be returned when a tenant has exceeded its
+	// monthly quota.
+	ErrQuotaExceeded = errors.New("monthly conversion quota exceeded")
+	// ErrTenantInvalid should be returned when a tenant definition is
+	// invalid.
+	ErrTenantInvalid = errors.New("invalid tenant: an ID and a key are required")
+	// ErrHostLimitInvalid should be returned when the host limit of a
+	// tenant is negative.
+	ErrHostLimitInvalid = errors.New("invalid tenant: the host limit must not be negative")
+)
+
+// Quota contains the monthly limits of a tenant. A zero limit is unlimited.
+type Quota struct {
+	Conversions int64   `json:"conversions,omitempty"`
+	Pages       int64   `json:"pages,omitempty"`
+	Bytes       int64   `json:"bytes,omitempty"`
+	CPUSeconds  float64 `json:"cpu_seconds,omitempty"`
+}
+
+// Tenant is a client of the microservice, identified by its API key.
+type Tenant struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Key   string `json:"key"`
+	Quota Quota  `json:"quota"`
+	// Sanitize is the sanitization policy applied to the tenant's uploaded
+	// HTML documents, overriding the default policy.
+	Sanitize string `json:"sanitize,omitempty"`
+	// RetentionDays is the number of days the tenant's uploaded outputs are
+	// kept, overriding the default retention period.
+	RetentionDays int `json:"retention_days,omitempty"`
+	// Profile contains the default conversion options of the tenant.
+	Profile *Profile `json:"profile,omitempty"`
+	// HostLimit limits the tenant's conversions of each source host in
+	// place of the default limit. They are counted separately from the
+	// conversions of other tenants.
+	HostLimit *politeness.Limit `json:"host_limit,omitempty"`
+}
+
+// Registry contains all known tenants.
+type Registry struct {
+	mu    sync.RWMutex
+	byKey map[string]Tenant
+	byID  map[string]Tenant
+}
+
+// NewRegistry creates a registry from a list of tenants.
+func NewRegistry(tenants []Tenant) (*Registry, error) {
+	r := new(Registry)
+	if err := r.Replace(tenants); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRegistry creates a registry from a JSON file containing a list of
+// tenants.
+func LoadRegistry(path string) (*Registry, error) {
+	tenants, err := readTenants(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(tenants)
+}
+
+func readTenants(path string) ([]Tenant, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(b, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// Replace replaces all tenants of the registry. The registry is unchanged if
+// any of the tenants is invalid.
+func (r *Registry) Replace(tenants []Tenant) error {
+	byKey := make(map[string]Tenant)
+	byID := make(map[string]Tenant)
+	for _, t := range tenants {
+		if t.ID == "" || t.Key == "" {
+			return ErrTenantInvalid
+		}
+		if t.Profile != nil {
+			if err := t.Profile.Validate(); err != nil {
+				return err
+			}
+		}
+		if t.HostLimit != nil && (t.HostLimit.Concurrency < 0 || t.HostLimit.DelayMS < 0) {
+			return ErrHostLimitInvalid
+		}
+		byKey[t.Key] = t
+		byID[t.ID] = t
+	}
+	r.mu.Lock()
+	r.byKey, r.byID = byKey, byID
+	r.mu.Unlock()
+	return nil
+}
+
+// Reload replaces all tenants of the registry with the tenants in a JSON
+// file (see LoadRegistry).
+func (r *Registry) Reload(path string) error {
+	tenants, err := readTenants(path)
+	if err != nil {
+		return err
+	}
+	return r.Replace(tenants)
+}
+
+// ByKey returns the tenant with the given API key.
+func (r *Registry) ByKey(k string) (Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byKey[k]
+	return t, ok
+}
+
+// Get returns the tenant with the given ID.
+func (r *Registry) Get(id string) (Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byID[id]
+	return t, ok
+}
+
+// List returns all tenants ordered by ID.
+func (r *Registry) List() []Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l := make([]Tenant, 0, len(r.byID))
+	for _, t := range r.byID {
+		l = append(l, t)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
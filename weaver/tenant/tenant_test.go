@@ -0,0 +1,54 @@
+package tenant
+
+import (
+	"testing"
+
+	"github.com/lachee/athenapdf/weaver/politeness"
+)
+
+func TestNewRegistry(t *testing.T) {
+	r, err := NewRegistry([]Tenant{{ID: "acme", Key: "acme-key"}})
+	if err != nil {
+		t.Fatalf("new registry returned an unexpected error: %+v", err)
+	}
+	if got, ok := r.ByKey("acme-key"); !ok || got.ID != "acme" {
+		t.Errorf("expected tenant with key to be acme, got %+v", got)
+	}
+	if _, ok := r.ByKey("unknown"); ok {
+		t.Errorf("expected unknown key not to match a tenant")
+	}
+}
+
+func TestNewRegistry_invalid(t *testing.T) {
+	if _, err := NewRegistry([]Tenant{{ID: "acme"}}); err != ErrTenantInvalid {
+		t.Errorf("expected an invalid tenant error, got %+v", err)
+	}
+}
+
+func TestNewRegistry_hostLimit(t *testing.T) {
+	limit := &politeness.Limit{Concurrency: -1}
+	if _, err := NewRegistry([]Tenant{{ID: "acme", Key: "acme-key", HostLimit: limit}}); err != ErrHostLimitInvalid {
+		t.Errorf("expected an invalid host limit error, got %+v", err)
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	r, _ := NewRegistry([]Tenant{{ID: "acme", Key: "acme-key"}})
+	if err := r.Replace([]Tenant{{ID: "acme", Key: "rotated-key"}}); err != nil {
+		t.Fatalf("replace returned an unexpected error: %+v", err)
+	}
+	if _, ok := r.ByKey("acme-key"); ok {
+		t.Errorf("expected rotated key not to match a tenant")
+	}
+	if got, ok := r.ByKey("rotated-key"); !ok || got.ID != "acme" {
+		t.Errorf("expected tenant with key to be acme, got %+v", got)
+	}
+
+	// Invalid tenants leave the registry unchanged
+	if err := r.Replace([]Tenant{{ID: "acme"}}); err != ErrTenantInvalid {
+		t.Errorf("expected an invalid tenant error, got %+v", err)
+	}
+	if _, ok := r.ByKey("rotated-key"); !ok {
+		t.Errorf("expected registry to be unchanged after an invalid replace")
+	}
+}
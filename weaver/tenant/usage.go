@@ -0,0 +1,175 @@
+package tenant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Usage contains the resources used by a tenant in a month.
+type Usage struct {
+	Tenant      string  `json:"tenant"`
+	Month       string  `json:"month"`
+	Conversions int64   `json:"conversions"`
+	Pages       int64   `json:"pages"`
+	Bytes       int64   `json:"bytes"`
+	CPUSeconds  float64 `json:"cpu_seconds"`
+}
+
+// Month returns the accounting period (YYYY-MM, UTC) of a time.
+func Month(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// Exceeds returns true if the usage has reached any limit of a quota.
+func (u Usage) Exceeds(q Quota) bool {
+	return (q.Conversions > 0 && u.Conversions >= q.Conversions) ||
+		(q.Pages > 0 && u.Pages >= q.Pages) ||
+		(q.Bytes > 0 && u.Bytes >= q.Bytes) ||
+		(q.CPUSeconds > 0 && u.CPUSeconds >= q.CPUSeconds)
+}
+
+// UsageStore persists the usage of tenants.
+type UsageStore interface {
+	// Load returns the usage of all tenants in all months.
+	Load() ([]Usage, error)
+	// Save persists the usage of a tenant in a month.
+	Save(Usage) error
+}
+
+// Accountant keeps track of the monthly usage of every tenant.
+type Accountant struct {
+	mu sync.Mutex
+	// usage is keyed by month, and then tenant ID
+	usage map[string]map[string]*Usage
+	store UsageStore
+}
+
+// NewAccountant creates a new accountant. If a path is given, usage is
+// persisted to it as JSON, and loaded from it (if it exists).
+func NewAccountant(path string) (*Accountant, error) {
+	if path == "" {
+		return NewStoreAccountant(nil)
+	}
+	return NewStoreAccountant(&fileUsageStore{path: path})
+}
+
+// NewStoreAccountant creates a new accountant that loads, and persists usage
+// with a store. Usage is only kept in memory if the store is nil.
+func NewStoreAccountant(s UsageStore) (*Accountant, error) {
+	a := &Accountant{
+		usage: make(map[string]map[string]*Usage),
+		store: s,
+	}
+	if s == nil {
+		return a, nil
+	}
+	usage, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range usage {
+		u := u
+		a.month(u.Month)[u.Tenant] = &u
+	}
+	return a, nil
+}
+
+// month returns the usage of all tenants in a month. It must be called with
+// the lock held.
+func (a *Accountant) month(m string) map[string]*Usage {
+	if _, ok := a.usage[m]; !ok {
+		a.usage[m] = make(map[string]*Usage)
+	}
+	return a.usage[m]
+}
+
+// Record adds a single conversion to the usage of a tenant at time t.
+func (a *Accountant) Record(tenant string, t time.Time, pages, bytes int, cpu time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m := Month(t)
+	u, ok := a.month(m)[tenant]
+	if !ok {
+		u = &Usage{Tenant: tenant, Month: m}
+		a.usage[m][tenant] = u
+	}
+	u.Conversions++
+	u.Pages += int64(pages)
+	u.Bytes += int64(bytes)
+	u.CPUSeconds += cpu.Seconds()
+
+	if a.store == nil {
+		return
+	}
+	if err := a.store.Save(*u); err != nil {
+		log.Printf("[Tenant] unable to save usage: %+v\n", err)
+	}
+}
+
+// Usage returns the usage of a tenant in a month (YYYY-MM).
+func (a *Accountant) Usage(tenant, month string) Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if u, ok := a.usage[month][tenant]; ok {
+		return *u
+	}
+	return Usage{Tenant: tenant, Month: month}
+}
+
+// Month returns the usage of all tenants in a month (YYYY-MM) ordered by
+// tenant ID.
+func (a *Accountant) Month(month string) []Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	l := make([]Usage, 0, len(a.usage[month]))
+	for _, u := range a.usage[month] {
+		l = append(l, *u)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Tenant < l[j].Tenant })
+	return l
+}
+
+// fileUsageStore persists the usage of all tenants to a JSON file, which is
+// rewritten on every save.
+type fileUsageStore struct {
+	path  string
+	usage map[string]Usage
+}
+
+func (s *fileUsageStore) Load() ([]Usage, error) {
+	s.usage = make(map[string]Usage)
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var usage []Usage
+	if err := json.Unmarshal(b, &usage); err != nil {
+		return nil, err
+	}
+	for _, u := range usage {
+		s.usage[u.Month+"/"+u.Tenant] = u
+	}
+	return usage, nil
+}
+
+func (s *fileUsageStore) Save(u Usage) error {
+	s.usage[u.Month+"/"+u.Tenant] = u
+	l := make([]Usage, 0, len(s.usage))
+	for _, u := range s.usage {
+		l = append(l, u)
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, b, 0600)
+}
@@ -0,0 +1,67 @@
+package tenant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsage_Exceeds(t *testing.T) {
+	u := Usage{Conversions: 10, Pages: 5}
+	if u.Exceeds(Quota{}) {
+		t.Errorf("expected usage not to exceed an unlimited quota")
+	}
+	if u.Exceeds(Quota{Conversions: 11, Pages: 6}) {
+		t.Errorf("expected usage not to exceed quota")
+	}
+	if !u.Exceeds(Quota{Conversions: 100, Pages: 5}) {
+		t.Errorf("expected usage to exceed page quota")
+	}
+}
+
+func TestAccountant_Record(t *testing.T) {
+	a, _ := NewAccountant("")
+	now := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	a.Record("acme", now, 2, 100, time.Second)
+	a.Record("acme", now, 3, 50, time.Second/2)
+	a.Record("acme", now.AddDate(0, 1, 0), 1, 1, 0)
+
+	u := a.Usage("acme", "2018-06")
+	if got, want := u.Conversions, int64(2); got != want {
+		t.Errorf("expected conversions to be %d, got %d", want, got)
+	}
+	if got, want := u.Pages, int64(5); got != want {
+		t.Errorf("expected pages to be %d, got %d", want, got)
+	}
+	if got, want := u.Bytes, int64(150); got != want {
+		t.Errorf("expected bytes to be %d, got %d", want, got)
+	}
+	if got, want := u.CPUSeconds, 1.5; got != want {
+		t.Errorf("expected CPU seconds to be %f, got %f", want, got)
+	}
+	if got, want := len(a.Month("2018-07")), 1; got != want {
+		t.Errorf("expected %d tenant usage in the next month, got %d", want, got)
+	}
+}
+
+func TestAccountant_persist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tenant")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "usage.json")
+
+	a, _ := NewAccountant(p)
+	a.Record("acme", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), 1, 1, 0)
+
+	loaded, err := NewAccountant(p)
+	if err != nil {
+		t.Fatalf("new accountant returned an unexpected error: %+v", err)
+	}
+	if got, want := loaded.Usage("acme", "2018-06").Conversions, int64(1); got != want {
+		t.Errorf("expected loaded conversions to be %d, got %d", want, got)
+	}
+}
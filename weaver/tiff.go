@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/raster"
+)
+
+// ErrTIFFDisabled should be returned when the TIFF format is requested, but
+// Ghostscript is not configured.
+var ErrTIFFDisabled = errors.New("the TIFF format is not enabled")
+
+// newTIFF returns the rasterization of PDF outputs to TIFF of the
+// configuration, or nil if the format is not TIFF, or TIFF is disabled.
+func newTIFF(conf Config, format string) *raster.TIFF {
+	if format != athenapdf.FormatTIFF || conf.TIFF.Ghostscript == "" {
+		return nil
+	}
+	return &raster.TIFF{
+		Ghostscript: conf.TIFF.Ghostscript,
+		Resolution:  conf.TIFF.Resolution,
+		Dir:         converter.Spool.Dir(),
+	}
+}
+
+// checkTIFF checks that the TIFF format is enabled, if it is requested.
+func checkTIFF(c *gin.Context) error {
+	conf := c.MustGet("config").(Config)
+	if format, _ := outputFormat(c); format == athenapdf.FormatTIFF && conf.TIFF.Ghostscript == "" {
+		return ErrTIFFDisabled
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+)
+
+func TestCheckTIFF(t *testing.T) {
+	tests := []struct {
+		ghostscript string
+		query       string
+		err         error
+	}{
+		{"gs", "?format=tiff", nil},
+		{"", "?format=TIFF", ErrTIFFDisabled},
+		{"", "?format=pdf", nil},
+	}
+	for _, tt := range tests {
+		var err error
+		conf := Config{TIFF: TIFF{Ghostscript: tt.ghostscript, Resolution: "300"}}
+		r := gin.New()
+		r.Use(ConfigMiddleware(conf))
+		r.GET("/", func(c *gin.Context) {
+			if err = checkTIFF(c); err == nil {
+				format, _ := outputFormat(c)
+				if got := newTIFF(conf, format); (got != nil) != (format == athenapdf.FormatTIFF) {
+					t.Errorf("expected rasterization of %q to be set only for TIFF, got %+v", tt.query, got)
+				}
+			}
+		})
+		req, _ := http.NewRequest("GET", "/"+tt.query, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if err != tt.err {
+			t.Errorf("expected options %q to return %v, got %v", tt.query, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package toml parses the subset of TOML used by configuration files: tables,
+// (dotted) keys, strings, integers, floats, booleans, arrays, and inline
+// tables. Arrays of tables, dates, and multi-line strings are not supported.
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned when a document uses an unsupported feature.
+var ErrUnsupported = errors.New("unsupported TOML feature")
+
+// SyntaxError is returned when a document is invalid.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("toml: line %d: %s", e.Line, e.Msg)
+}
+
+type parser struct {
+	s    string
+	i    int
+	line int
+}
+
+// Parse returns the tables, and values of a document.
+func Parse(b []byte) (map[string]interface{}, error) {
+	p := &parser{s: string(b), line: 1}
+	root := make(map[string]interface{})
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			if strings.HasPrefix(p.s[p.i:], "[[") {
+				return nil, ErrUnsupported
+			}
+			p.i++
+			var keys []string
+			if keys, err = p.keys(']'); err != nil {
+				return nil, err
+			}
+			p.i++
+			if table, err = p.table(root, keys); err != nil {
+				return nil, err
+			}
+		} else if err = p.keyValue(table, '='); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, p.errorf("expected a new line")
+		}
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	return p.s[p.i]
+}
+
+// skipSpace skips whitespace, and comments (and new lines if lines is true).
+func (p *parser) skipSpace(lines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.i++
+		case c == '\n' && lines:
+			p.line++
+			p.i++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// table returns the (nested) table with the given keys, creating it if needed.
+func (p *parser) table(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	t := root
+	for _, k := range keys {
+		v, ok := t[k]
+		if !ok {
+			v = make(map[string]interface{})
+			t[k] = v
+		}
+		next, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, p.errorf("key %q is not a table", k)
+		}
+		t = next
+	}
+	return t, nil
+}
+
+// keys parses a (dotted) key up to the terminator.
+func (p *parser) keys(end byte) ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("unexpected end of key")
+		}
+		var k string
+		if c := p.peek(); c == '"' || c == '\'' {
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		} else {
+			start := p.i
+			for !p.eof() && isBareKey(p.peek()) {
+				p.i++
+			}
+			k = p.s[start:p.i]
+			if k == "" {
+				return nil, p.errorf("invalid key")
+			}
+		}
+		keys = append(keys, k)
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("unexpected end of key")
+		}
+		switch p.peek() {
+		case '.':
+			p.i++
+		case end:
+			return keys, nil
+		default:
+			return nil, p.errorf("unexpected character %q in key", p.peek())
+		}
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// keyValue parses a key, and its value into a table.
+func (p *parser) keyValue(table map[string]interface{}, sep byte) error {
+	keys, err := p.keys(sep)
+	if err != nil {
+		return err
+	}
+	p.i++
+	t, err := p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	k := keys[len(keys)-1]
+	if _, ok := t[k]; ok {
+		return p.errorf("duplicate key %q", k)
+	}
+	p.skipSpace(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t[k] = v
+	return nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("missing value")
+	}
+	switch c := p.peek(); c {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+	start := p.i
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.i++
+	}
+	lit := p.s[start:p.i]
+	switch lit {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.Replace(lit, "_", "", -1)
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q", lit)
+}
+
+func (p *parser) array() ([]interface{}, error) {
+	p.i++
+	arr := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.i++
+			return arr, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		p.skipSpace(true)
+		if !p.eof() && p.peek() == ',' {
+			p.i++
+		}
+	}
+}
+
+func (p *parser) inlineTable() (map[string]interface{}, error) {
+	p.i++
+	t := make(map[string]interface{})
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		if p.peek() == '}' {
+			p.i++
+			return t, nil
+		}
+		if err := p.keyValue(t, '='); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if !p.eof() && p.peek() == ',' {
+			p.i++
+		}
+	}
+}
+
+// str parses a basic ("...") or literal ('...') string.
+func (p *parser) str() (string, error) {
+	quote := p.peek()
+	if strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3)) {
+		return "", ErrUnsupported
+	}
+	p.i++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.i++
+		if c == quote {
+			return b.String(), nil
+		}
+		if c != '\\' || quote == '\'' {
+			b.WriteByte(c)
+			continue
+		}
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		e := p.peek()
+		p.i++
+		switch e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(e)
+		case 'u', 'U':
+			n := 4
+			if e == 'U' {
+				n = 8
+			}
+			if p.i+n > len(p.s) {
+				return "", p.errorf("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid unicode escape")
+			}
+			b.WriteRune(rune(r))
+			p.i += n
+		default:
+			return "", p.errorf("invalid escape \\%c", e)
+		}
+	}
+}
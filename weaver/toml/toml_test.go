@@ -0,0 +1,67 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc := `# Weaver
+auth_key = "s3crét" # inline comment
+max_workers = 20
+conversion_fallback = true
+
+[chrome]
+flags = [
+  "disable-gpu",
+  'lang=en-GB', # trailing comma
+]
+
+[hosts]
+map = { "staging.internal" = "10.0.3.7" }
+
+[queue.sqs]
+visibility_timeout = 1_200
+`
+	got, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("unable to parse document: %+v", err)
+	}
+	want := map[string]interface{}{
+		"auth_key":            "s3crét",
+		"max_workers":         int64(20),
+		"conversion_fallback": true,
+		"chrome": map[string]interface{}{
+			"flags": []interface{}{"disable-gpu", "lang=en-GB"},
+		},
+		"hosts": map[string]interface{}{
+			"map": map[string]interface{}{"staging.internal": "10.0.3.7"},
+		},
+		"queue": map[string]interface{}{
+			"sqs": map[string]interface{}{"visibility_timeout": int64(1200)},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected document to be %+v, got %+v", want, got)
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	tests := []struct {
+		doc string
+		err error
+	}{
+		{"[[tenants]]\nid = 1", ErrUnsupported},
+		{"key = \"\"\"\nmulti\"\"\"", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		if _, err := Parse([]byte(tt.doc)); err != tt.err {
+			t.Errorf("expected parsing %q to return %+v, got %+v", tt.doc, tt.err, err)
+		}
+	}
+	for _, doc := range []string{"key = ", "key = \"unterminated", "a = 1\na = 2", "a = 1 b = 2", "[a\n"} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("expected parsing %q to return an error", doc)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Package tus stores the resumable uploads of the tus protocol
+// (https://tus.io): the chunks of an upload are appended to a file on disk,
+// so that a client can resume an interrupted upload from its offset, rather
+// than starting it again.
+package tus
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Version is the version of the tus protocol of the uploads.
+const Version = "1.0.0"
+
+const (
+	infoSuffix = ".info"
+	dataSuffix = ".bin"
+)
+
+var (
+	// ErrNotFound is returned when an upload does not exist (or it expired).
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned when a chunk is not written at the
+	// offset of its upload.
+	ErrOffsetMismatch = errors.New("upload offset does not match the offset of the upload")
+	// ErrTooLarge is returned when more than the length of an upload is
+	// written to it.
+	ErrTooLarge = errors.New("upload is larger than its length (Upload-Length)")
+	// ErrLocked is returned when a chunk is written to an upload while
+	// another one is.
+	ErrLocked = errors.New("upload is being written by another request")
+	// ErrIncomplete is returned when an upload is read before all of it is
+	// written.
+	ErrIncomplete = errors.New("upload is not complete")
+	// ErrLengthInvalid is returned when the length of an upload is invalid.
+	ErrLengthInvalid = errors.New("invalid upload length provided (Upload-Length)")
+	// ErrMetadataInvalid is returned when the metadata of an upload is not
+	// a comma-separated list of keys, and base64 encoded values.
+	ErrMetadataInvalid = errors.New("invalid upload metadata provided (Upload-Metadata)")
+)
+
+// id matches valid upload IDs.
+var id = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Upload is a resumable upload.
+type Upload struct {
+	ID string `json:"id"`
+	// Owner is the tenant who created the upload (if any).
+	Owner  string `json:"owner,omitempty"`
+	Length int64  `json:"length"`
+	// Offset is the number of bytes written.
+	Offset int64 `json:"offset"`
+	// Metadata are the key-value pairs of the Upload-Metadata header (e.g.
+	// 'filename').
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Created  time.Time         `json:"created"`
+	// Expires is the time the upload is removed, unless it is written to.
+	Expires time.Time `json:"expires"`
+}
+
+// Complete returns whether all of the upload is written.
+func (u Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// ParseMetadata parses the Upload-Metadata header of an upload.
+func ParseMetadata(header string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			m[fields[0]] = ""
+		case 2:
+			v, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, ErrMetadataInvalid
+			}
+			m[fields[0]] = string(v)
+		default:
+			return nil, ErrMetadataInvalid
+		}
+	}
+	return m, nil
+}
+
+// Store keeps track of uploads in a directory: every upload has a file of
+// its data, and a JSON file of its state.
+type Store struct {
+	dir    string
+	expiry time.Duration
+
+	mu sync.Mutex
+	// writing are the IDs of the uploads being written.
+	writing map[string]bool
+}
+
+// NewStore creates a store of uploads in dir, which is created if it does not
+// exist. Uploads are removed once they have not been written to for expiry.
+func NewStore(dir string, expiry time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, expiry: expiry, writing: make(map[string]bool)}, nil
+}
+
+func (s *Store) path(id, suffix string) string {
+	return filepath.Join(s.dir, id+suffix)
+}
+
+// save persists the state of an upload.
+func (s *Store) save(u Upload) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(u.ID, infoSuffix+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(u.ID, infoSuffix))
+}
+
+// Create creates an empty upload of the given length.
+func (s *Store) Create(owner string, length int64, metadata map[string]string) (Upload, error) {
+	if length < 0 {
+		return Upload{}, ErrLengthInvalid
+	}
+	now := time.Now().UTC()
+	u := Upload{
+		ID:       uuid.NewV4().String(),
+		Owner:    owner,
+		Length:   length,
+		Metadata: metadata,
+		Created:  now,
+		Expires:  now.Add(s.expiry),
+	}
+	f, err := os.OpenFile(s.path(u.ID, dataSuffix), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return Upload{}, err
+	}
+	f.Close()
+	if err := s.save(u); err != nil {
+		os.Remove(s.path(u.ID, dataSuffix))
+		return Upload{}, err
+	}
+	return u, nil
+}
+
+// Get returns an upload.
+func (s *Store) Get(uploadID string) (Upload, error) {
+	if !id.MatchString(uploadID) {
+		return Upload{}, ErrNotFound
+	}
+	b, err := ioutil.ReadFile(s.path(uploadID, infoSuffix))
+	if os.IsNotExist(err) {
+		return Upload{}, ErrNotFound
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+	var u Upload
+	if err := json.Unmarshal(b, &u); err != nil {
+		return Upload{}, err
+	}
+	return u, nil
+}
+
+// lock marks an upload as being written, or returns false if it already is.
+func (s *Store) lock(uploadID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writing[uploadID] {
+		return false
+	}
+	s.writing[uploadID] = true
+	return true
+}
+
+func (s *Store) unlock(uploadID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writing, uploadID)
+}
+
+// Write appends a chunk read from r to an upload at the given offset, which
+// must be its current offset. If r fails (e.g. the client disconnected), the
+// bytes received until then are kept, so that the upload can be resumed from
+// them, and the error is returned with the upload.
+func (s *Store) Write(uploadID string, offset int64, r io.Reader) (Upload, error) {
+	u, err := s.Get(uploadID)
+	if err != nil {
+		return Upload{}, err
+	}
+	if !s.lock(uploadID) {
+		return Upload{}, ErrLocked
+	}
+	defer s.unlock(uploadID)
+	// The upload may have been written before it was locked
+	if u, err = s.Get(uploadID); err != nil {
+		return Upload{}, err
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.path(uploadID, dataSuffix), os.O_WRONLY, 0600)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer f.Close()
+	// Bytes written after the last saved offset (e.g. before a crash) are
+	// discarded
+	if err := f.Truncate(u.Offset); err != nil {
+		return Upload{}, err
+	}
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		return Upload{}, err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, u.Length-u.Offset+1))
+	if u.Offset+n > u.Length {
+		f.Truncate(u.Offset)
+		return u, ErrTooLarge
+	}
+	u.Offset += n
+	u.Expires = time.Now().UTC().Add(s.expiry)
+	if serr := s.save(u); serr != nil {
+		return Upload{}, serr
+	}
+	return u, err
+}
+
+// Open opens the data of a complete upload.
+func (s *Store) Open(uploadID string) (*os.File, Upload, error) {
+	u, err := s.Get(uploadID)
+	if err != nil {
+		return nil, Upload{}, err
+	}
+	if !u.Complete() {
+		return nil, u, ErrIncomplete
+	}
+	f, err := os.Open(s.path(uploadID, dataSuffix))
+	if err != nil {
+		return nil, Upload{}, err
+	}
+	return f, u, nil
+}
+
+// Remove removes an upload.
+func (s *Store) Remove(uploadID string) error {
+	if !id.MatchString(uploadID) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(uploadID, infoSuffix))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.path(uploadID, dataSuffix))
+}
+
+// Expire removes the uploads which expired at the given time, and returns
+// their number.
+func (s *Store) Expire(now time.Time) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+infoSuffix))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range paths {
+		u, err := s.Get(strings.TrimSuffix(filepath.Base(p), infoSuffix))
+		if err != nil || !u.Expires.Before(now) || !s.lock(u.ID) {
+			continue
+		}
+		if err := s.Remove(u.ID); err == nil {
+			n++
+		}
+		s.unlock(u.ID)
+	}
+	return n, nil
+}
+
+// Start removes the expired uploads immediately, and then every interval
+// until the done channel is closed.
+func (s *Store) Start(interval time.Duration, done <-chan struct{}) {
+	run := func() {
+		if _, err := s.Expire(time.Now()); err != nil {
+			log.Printf("[Uploads] unable to remove expired uploads: %+v\n", err)
+		}
+	}
+	go func() {
+		run()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				run()
+			}
+		}
+	}()
+}
@@ -0,0 +1,150 @@
+package tus
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+// failingReader returns its data, and then fails (e.g. a client
+// disconnecting).
+type failingReader struct {
+	data string
+	read bool
+}
+
+var errDisconnected = errors.New("disconnected")
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errDisconnected
+	}
+	r.read = true
+	return copy(p, r.data), nil
+}
+
+func TestParseMetadata(t *testing.T) {
+	got, err := ParseMetadata("filename ZGVjay5wcHR4,filetype YXBwbGljYXRpb24vcGRm, is_confidential")
+	if err != nil {
+		t.Fatalf("expected metadata, got %+v", err)
+	}
+	want := map[string]string{"filename": "deck.pptx", "filetype": "application/pdf", "is_confidential": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected metadata %v, got %v", want, got)
+	}
+	for _, header := range []string{"filename !!!", "filename a b"} {
+		if _, err := ParseMetadata(header); err != ErrMetadataInvalid {
+			t.Errorf("expected %q to be invalid, got %+v", header, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u, err := s.Create("acme", 11, map[string]string{"filename": "deck.pptx"})
+	if err != nil {
+		t.Fatalf("expected upload, got %+v", err)
+	}
+	if _, _, err := s.Open(u.ID); err != ErrIncomplete {
+		t.Errorf("expected %v, got %+v", ErrIncomplete, err)
+	}
+
+	// The bytes received before a failure are kept
+	u, err = s.Write(u.ID, 0, &failingReader{data: "hello"})
+	if err != errDisconnected {
+		t.Errorf("expected %v, got %+v", errDisconnected, err)
+	}
+	if got, want := u.Offset, int64(5); got != want {
+		t.Errorf("expected offset %d, got %d", want, got)
+	}
+	if _, err := s.Write(u.ID, 0, strings.NewReader("hello")); err != ErrOffsetMismatch {
+		t.Errorf("expected %v, got %+v", ErrOffsetMismatch, err)
+	}
+	if _, err := s.Write(u.ID, 5, strings.NewReader(" world!")); err != ErrTooLarge {
+		t.Errorf("expected %v, got %+v", ErrTooLarge, err)
+	}
+	if u, err = s.Write(u.ID, 5, strings.NewReader(" world")); err != nil {
+		t.Fatalf("expected chunk to be written, got %+v", err)
+	}
+	if !u.Complete() {
+		t.Errorf("expected upload to be complete, got %+v", u)
+	}
+
+	f, u, err := s.Open(u.ID)
+	if err != nil {
+		t.Fatalf("expected upload to open, got %+v", err)
+	}
+	b, _ := ioutil.ReadAll(f)
+	f.Close()
+	if got, want := string(b), "hello world"; got != want {
+		t.Errorf("expected data %q, got %q", want, got)
+	}
+	if got, want := u.Owner, "acme"; got != want {
+		t.Errorf("expected owner %s, got %s", want, got)
+	}
+
+	if err := s.Remove(u.ID); err != nil {
+		t.Errorf("expected upload to be removed, got %+v", err)
+	}
+	if _, err := s.Get(u.ID); err != ErrNotFound {
+		t.Errorf("expected %v, got %+v", ErrNotFound, err)
+	}
+	if _, err := s.Get("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("expected %v, got %+v", ErrNotFound, err)
+	}
+}
+
+func TestStoreLocked(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+	u, _ := s.Create("", 5, nil)
+	s.lock(u.ID)
+	if _, err := s.Write(u.ID, 0, strings.NewReader("hello")); err != ErrLocked {
+		t.Errorf("expected %v, got %+v", ErrLocked, err)
+	}
+	s.unlock(u.ID)
+	if _, err := s.Write(u.ID, 0, strings.NewReader("hello")); err != nil {
+		t.Errorf("expected chunk to be written, got %+v", err)
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+	old, _ := s.Create("", 5, nil)
+	old.Expires = time.Now().Add(-time.Minute)
+	s.save(old)
+	recent, _ := s.Create("", 5, nil)
+
+	n, err := s.Expire(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("expected %d expired upload, got %d", want, got)
+	}
+	if _, err := s.Get(old.ID); err != ErrNotFound {
+		t.Errorf("expected %v, got %+v", ErrNotFound, err)
+	}
+	if _, err := s.Get(recent.ID); err != nil {
+		t.Errorf("expected recent upload to be kept, got %+v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/tus"
+)
+
+// ErrUploadTooLarge should be returned when the body of an upload is larger
+// than the upload limit.
+var ErrUploadTooLarge = errors.New("upload is larger than the upload limit (WEAVER_MAX_UPLOAD_BYTES)")
+
+// maxUploadMemory is the size of the uploaded files of a form that are held
+// in memory while it is parsed (the rest is streamed to disk).
+const maxUploadMemory = 1 << 20
+
+// limitedBody is the body of a request, which fails with ErrUploadTooLarge
+// once more than its limit is read (unlike http.MaxBytesReader, the error is
+// known, whichever reader it is returned through).
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrUploadTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if b.remaining -= int64(n); b.remaining < 0 {
+		b.exceeded = true
+		return 0, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+// limitUpload limits the body of a request to the upload limit (if any).
+// Bodies declaring a larger size are rejected before they are read.
+func limitUpload(c *gin.Context) (*limitedBody, error) {
+	conf := c.MustGet("config").(Config)
+	if conf.MaxUploadBytes <= 0 {
+		return nil, nil
+	}
+	if c.Request.ContentLength > conf.MaxUploadBytes {
+		return nil, ErrUploadTooLarge
+	}
+	body := &limitedBody{ReadCloser: c.Request.Body, remaining: conf.MaxUploadBytes}
+	c.Request.Body = body
+	return body, nil
+}
+
+// bufferBody returns the body of a request (within the upload limit), which
+// is replaced with the buffered copy, so that it can be read again (e.g. to
+// fingerprint the request before it is handled).
+func bufferBody(c *gin.Context) ([]byte, error) {
+	if b, ok := c.Get("request_body"); ok {
+		return b.([]byte), nil
+	}
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	if _, err := limitUpload(c); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(b))
+	c.Set("request_body", b)
+	return b, nil
+}
+
+// receiveUpload returns the document uploaded to POST /convert, and its name.
+// It is either a complete resumable upload ('upload'), the 'file' of a
+// multipart form, whose files are streamed to
+// disk while it is parsed (beyond maxUploadMemory), or the body of the
+// request itself (e.g. with chunked transfer encoding), which is streamed to
+// the conversion as it is received. Its name is the 'filename' query
+// parameter, or the file name of its Content-Disposition header.
+func receiveUpload(c *gin.Context) (io.ReadCloser, string, error) {
+	if id := c.Query("upload"); id != "" {
+		return resumedUpload(c, id)
+	}
+
+	body, err := limitUpload(c)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		err := c.Request.ParseMultipartForm(maxUploadMemory)
+		if body != nil && body.exceeded {
+			return nil, "", ErrUploadTooLarge
+		}
+		if err != nil {
+			return nil, "", ErrFileInvalid
+		}
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, "", ErrFileInvalid
+		}
+		return file, header.Filename, nil
+	case mediaType == "application/x-www-form-urlencoded", c.Request.ContentLength == 0:
+		return nil, "", ErrFileInvalid
+	}
+
+	name := c.Query("filename")
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Disposition")); name == "" && err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = "document"
+	}
+	return c.Request.Body, path.Base(name), nil
+}
+
+// resumedUpload returns a complete resumable upload of the tenant of the
+// request, and its name (its 'filename' metadata).
+func resumedUpload(c *gin.Context, id string) (io.ReadCloser, string, error) {
+	store, ok := c.Get("uploads")
+	if !ok {
+		return nil, "", tus.ErrNotFound
+	}
+	if _, err := ownedUpload(c, id); err != nil {
+		return nil, "", err
+	}
+	f, u, err := store.(*tus.Store).Open(id)
+	if err != nil {
+		return nil, "", err
+	}
+	name := u.Metadata["filename"]
+	if name == "" {
+		name = "document"
+	}
+	return f, path.Base(name), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func mockUploadRouter(conf Config) *gin.Engine {
+	return mockRouter(conf, Services{}, func(r *gin.Engine, _ Config, _ Services) {
+		r.POST("/upload", func(c *gin.Context) {
+			file, name, err := receiveUpload(c)
+			if err != nil {
+				c.String(400, err.Error())
+				return
+			}
+			defer file.Close()
+			b, err := ioutil.ReadAll(file)
+			if err != nil {
+				c.String(400, err.Error())
+				return
+			}
+			c.String(200, name+": "+string(b))
+		})
+	})
+}
+
+func multipartBody(name, content string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	f, _ := w.CreateFormFile("file", name)
+	f.Write([]byte(content))
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+func TestReceiveUpload(t *testing.T) {
+	page := "<html>" + strings.Repeat("x", 100) + "</html>"
+	form, formType := multipartBody("invoice.html", page)
+	tests := []struct {
+		name    string
+		limit   int64
+		query   string
+		body    string
+		headers map[string]string
+		// chunked sends the body without a length
+		chunked bool
+		want    string
+	}{
+		{"form", 0, "", form.String(), map[string]string{"Content-Type": formType}, false, "invoice.html: " + page},
+		{"form too large", 50, "", form.String(), map[string]string{"Content-Type": formType}, true, ErrUploadTooLarge.Error()},
+		{"raw", 0, "?filename=invoice.html", page, map[string]string{"Content-Type": "text/html"}, false, "invoice.html: " + page},
+		{"chunked", 0, "?filename=../invoice.html", page, nil, true, "invoice.html: " + page},
+		{"disposition", 0, "", page, map[string]string{"Content-Disposition": `attachment; filename="report.html"`}, false, "report.html: " + page},
+		{"unnamed", 0, "", page, nil, false, "document: " + page},
+		{"declared too large", 50, "", page, nil, false, ErrUploadTooLarge.Error()},
+		{"streamed too large", 50, "", page, nil, true, ErrUploadTooLarge.Error()},
+		{"within limit", int64(len(page)), "", page, nil, true, "document: " + page},
+		{"empty", 0, "", "", nil, false, ErrFileInvalid.Error()},
+		{"form values", 0, "", "file=x", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, false, ErrFileInvalid.Error()},
+	}
+	for _, tt := range tests {
+		r := mockUploadRouter(Config{MaxUploadBytes: tt.limit})
+		req := httptest.NewRequest("POST", "/upload"+tt.query, strings.NewReader(tt.body))
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if got := res.Body.String(); got != tt.want {
+			t.Errorf("expected %s upload to be %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestConvertByFileHandler_tooLarge(t *testing.T) {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.MaxUploadBytes = 10
+	r := mockDryRunRouter(conf)
+
+	body, contentType := multipartBody("invoice.html", "<html></html>")
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/convert?auth=123456&dryRun", body)
+	req.Header.Set("Content-Type", contentType)
+	r.ServeHTTP(res, req)
+	if got, want := res.Code, http.StatusRequestEntityTooLarge; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+	if !strings.Contains(res.Body.String(), CodeUploadTooLarge) {
+		t.Errorf("expected error code to be %s, got %s", CodeUploadTooLarge, res.Body.String())
+	}
+}
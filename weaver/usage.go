@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/tenant"
+)
+
+// usageMonth returns the accounting period requested via the 'month' query
+// parameter (YYYY-MM), or the current month.
+func usageMonth(c *gin.Context) string {
+	if m := c.Query("month"); m != "" {
+		return m
+	}
+	return tenant.Month(time.Now())
+}
+
+// usageHandler returns the usage, and quota of the requesting tenant in a
+// month. If the admin key is used, it returns the usage of all tenants.
+func usageHandler(c *gin.Context) {
+	a := c.MustGet("usage").(*tenant.Accountant)
+	month := usageMonth(c)
+
+	if t, ok := c.Get("tenant"); ok {
+		tt := t.(tenant.Tenant)
+		c.JSON(http.StatusOK, gin.H{
+			"usage": a.Usage(tt.ID, month),
+			"quota": tt.Quota,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": a.Month(month)})
+}
+
+// exportUsageHandler returns the usage of all tenants in a month as CSV for
+// billing.
+func exportUsageHandler(c *gin.Context) {
+	a := c.MustGet("usage").(*tenant.Accountant)
+	month := usageMonth(c)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=usage-%s.csv", month))
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/csv")
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"tenant", "month", "conversions", "pages", "bytes", "cpu_seconds"})
+	for _, u := range a.Month(month) {
+		w.Write([]string{
+			u.Tenant,
+			u.Month,
+			fmt.Sprint(u.Conversions),
+			fmt.Sprint(u.Pages),
+			fmt.Sprint(u.Bytes),
+			fmt.Sprintf("%.3f", u.CPUSeconds),
+		})
+	}
+	w.Flush()
+}
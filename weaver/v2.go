@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrRequestInvalid should be returned when the body of a v2 request is
+	// not a valid conversion request.
+	ErrRequestInvalid = errors.New("invalid conversion request (expected a JSON body)")
+	// ErrSourceInvalid should be returned when a v2 request does not have
+	// exactly one source.
+	ErrSourceInvalid = errors.New("exactly one of source.url, or source.content is required")
+	// ErrEncodingInvalid should be returned when the source content has an
+	// unsupported encoding.
+	ErrEncodingInvalid = errors.New("source.encoding must be empty, or 'base64'")
+	// ErrAsyncContent should be returned when an asynchronous conversion of
+	// a source content is requested.
+	ErrAsyncContent = errors.New("delivery.async requires source.url")
+)
+
+// ConversionRequest is the JSON body of the v2 conversion route
+// ('POST /api/v2/conversions'). Every option mirrors a query parameter of
+// the v1 routes.
+type ConversionRequest struct {
+	Source   SourceOptions   `json:"source"`
+	Engine   EngineOptions   `json:"engine"`
+	Page     PageOptions     `json:"page"`
+	Auth     AuthOptions     `json:"auth"`
+	Output   OutputOptions   `json:"output"`
+	Delivery DeliveryOptions `json:"delivery"`
+	// Returns the render plan instead of converting ('dryRun').
+	DryRun bool `json:"dry_run,omitempty"`
+	// Sections rendered separately, with their own page layout, and merged
+	// in order, instead of the source (see SectionOptions).
+	Sections []SectionOptions `json:"sections,omitempty"`
+	// Identifies the person the document is about, so that their data can
+	// be erased ('subject').
+	Subject string `json:"subject,omitempty"`
+	// The preset of the options the request does not set ('preset').
+	Preset string `json:"preset,omitempty"`
+}
+
+// SourceOptions describe the document to convert, and how it is fetched.
+type SourceOptions struct {
+	// The URL of the document ('url').
+	URL string `json:"url,omitempty"`
+	// The document itself, instead of a URL.
+	Content string `json:"content,omitempty"`
+	// The encoding of the content: empty (plain), or 'base64'.
+	Encoding string `json:"encoding,omitempty"`
+	// The extension of the document, e.g. 'md' ('ext').
+	Ext string `json:"ext,omitempty"`
+	// Renders the content without network access ('offline').
+	Offline bool `json:"offline,omitempty"`
+	// The HOST:PORT of an allowed proxy ('proxy').
+	Proxy string `json:"proxy,omitempty"`
+	// Host names, and the addresses they resolve to ('host_map').
+	HostMap map[string]string `json:"host_map,omitempty"`
+	// A CSS selector of the elements to print ('select').
+	Select string `json:"select,omitempty"`
+	// The base URL relative links are resolved against ('link_base').
+	LinkBase string `json:"link_base,omitempty"`
+}
+
+// EngineOptions control the renderer.
+type EngineOptions struct {
+	Aggressive    bool     `json:"aggressive,omitempty"`
+	WaitForStatus bool     `json:"wait_for_status,omitempty"`
+	ChromeFlags   []string `json:"chrome_flags,omitempty"`
+	Block         []string `json:"block,omitempty"`
+	BlockURLs     []string `json:"block_urls,omitempty"`
+	Locale        string   `json:"locale,omitempty"`
+	Timezone      string   `json:"timezone,omitempty"`
+	// Milliseconds to wait for after the page has loaded ('delay').
+	Delay int `json:"delay,omitempty"`
+	// The resolution content rasterized while printing is rendered at
+	// ('raster_dpi').
+	RasterDPI int `json:"raster_dpi,omitempty"`
+	// Replaces canvases, and videos with images when the page is saved
+	// ('snapshot_media').
+	SnapshotMedia bool `json:"snapshot_media,omitempty"`
+}
+
+// PageOptions control the page layout.
+type PageOptions struct {
+	// The page size, e.g. 'A4' ('page_size').
+	Size string `json:"size,omitempty"`
+	// Uses the landscape orientation ('no_portrait').
+	Landscape bool `json:"landscape,omitempty"`
+	// The page margins: 'standard', 'none', or 'minimal' ('margins').
+	Margins string `json:"margins,omitempty"`
+	// The CSS media type: 'print', or 'screen' ('media').
+	Media string `json:"media,omitempty"`
+	// A single page, as long as the rendered page ('single_page').
+	SinglePage bool `json:"single_page,omitempty"`
+	// Repeats the headers of tables on every page ('repeat_table_headers').
+	RepeatTableHeaders bool `json:"repeat_table_headers,omitempty"`
+	// CSS selectors of the elements to avoid page breaks inside of
+	// ('avoid_break'), and to break pages before ('break_before'), and after
+	// ('break_after').
+	AvoidBreak  []string `json:"avoid_break,omitempty"`
+	BreakBefore []string `json:"break_before,omitempty"`
+	BreakAfter  []string `json:"break_after,omitempty"`
+}
+
+// AuthOptions authenticate the request. The key may also be set in an
+// 'Authorization: Bearer <key>' header.
+type AuthOptions struct {
+	Key string `json:"key,omitempty"`
+}
+
+// OutputOptions control the output document.
+type OutputOptions struct {
+	// The output format, e.g. 'pdf', or 'text' ('format').
+	Format string `json:"format,omitempty"`
+	// Files embedded in the output PDF.
+	Attachments []AttachmentOptions `json:"attachments,omitempty"`
+	// Embeds the rendered source (DOM) in the output PDF ('attachSource').
+	AttachSource bool `json:"attach_source,omitempty"`
+	// Adds a text layer to the pages of the output PDF without text ('ocr'),
+	// in the languages joined by '+' ('ocr_languages').
+	OCR          bool   `json:"ocr,omitempty"`
+	OCRLanguages string `json:"ocr_languages,omitempty"`
+	// The resolution of the output in DPI, e.g. 300 for print ('dpi').
+	DPI int `json:"dpi,omitempty"`
+	// Removes the links leaving the page, keeping their text
+	// ('strip_external_links').
+	StripExternalLinks bool `json:"strip_external_links,omitempty"`
+	// Converts the colors of the output PDF to grayscale ('grayscale'), or
+	// to a configured ICC profile ('icc_profile').
+	Grayscale  bool   `json:"grayscale,omitempty"`
+	ICCProfile string `json:"icc_profile,omitempty"`
+	// The handling of the attachments of email messages: 'list', 'embed',
+	// or 'append' ('email_attachments').
+	EmailAttachments string `json:"email_attachments,omitempty"`
+	// QR codes, and barcodes placed on the output, as an array of stamps
+	// ('codes').
+	Codes json.RawMessage `json:"codes,omitempty"`
+	// Masks personal data in the page: 'email', 'card', or the names of
+	// configured patterns ('redact').
+	Redact []string `json:"redact,omitempty"`
+}
+
+// DeliveryOptions control how the output is delivered. It is returned in
+// the response by default.
+type DeliveryOptions struct {
+	// Queues the conversion, and returns its job ID ('async').
+	Async bool        `json:"async,omitempty"`
+	S3    *S3Delivery `json:"s3,omitempty"`
+	// Stores the rendered source (DOM) next to the output in S3
+	// ('includeSource').
+	IncludeSource bool `json:"include_source,omitempty"`
+	// Stores the WARC archive of the render next to the output in S3
+	// ('includeArchive').
+	IncludeArchive bool `json:"include_archive,omitempty"`
+}
+
+// S3Delivery uploads the output to an S3 bucket.
+type S3Delivery struct {
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	ACL          string `json:"acl,omitempty"`
+	Region       string `json:"region,omitempty"`
+	AccessKey    string `json:"access_key,omitempty"`
+	AccessSecret string `json:"access_secret,omitempty"`
+	// Names the object by the hash of the output, with the key as a prefix,
+	// and skips the upload if it exists ('s3_dedupe').
+	Dedupe bool `json:"dedupe,omitempty"`
+	// Days until the object is deleted ('retention_days').
+	RetentionDays int `json:"retention_days,omitempty"`
+}
+
+// Validate returns an error if the request cannot be converted. Options are
+// validated by the conversion routes.
+func (r ConversionRequest) Validate() error {
+	if len(r.Sections) > 0 {
+		return r.validateSections()
+	}
+	if (r.Source.URL == "") == (r.Source.Content == "") {
+		return ErrSourceInvalid
+	}
+	if r.Source.Encoding != "" && r.Source.Encoding != "base64" {
+		return ErrEncodingInvalid
+	}
+	if r.Delivery.Async && r.Source.URL == "" {
+		return ErrAsyncContent
+	}
+	return nil
+}
+
+// Query returns the v1 query parameters of the request.
+func (r ConversionRequest) Query() url.Values {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	flag := func(k string, v bool) {
+		if v {
+			q.Set(k, "true")
+		}
+	}
+	set("subject", r.Subject)
+	set("preset", r.Preset)
+	set("url", r.Source.URL)
+	set("ext", r.Source.Ext)
+	flag("offline", r.Source.Offline)
+	set("proxy", r.Source.Proxy)
+	set("select", r.Source.Select)
+	set("link_base", r.Source.LinkBase)
+	for host, addr := range r.Source.HostMap {
+		q.Add("host_map", host+"="+addr)
+	}
+	flag("aggressive", r.Engine.Aggressive)
+	flag("waitForStatus", r.Engine.WaitForStatus)
+	q["chrome_flag"] = r.Engine.ChromeFlags
+	q["block"] = r.Engine.Block
+	q["block_url"] = r.Engine.BlockURLs
+	set("locale", r.Engine.Locale)
+	set("timezone", r.Engine.Timezone)
+	if r.Engine.Delay != 0 {
+		set("delay", strconv.Itoa(r.Engine.Delay))
+	}
+	if r.Engine.RasterDPI != 0 {
+		set("raster_dpi", strconv.Itoa(r.Engine.RasterDPI))
+	}
+	flag("snapshot_media", r.Engine.SnapshotMedia)
+	set("page_size", r.Page.Size)
+	flag("no_portrait", r.Page.Landscape)
+	set("margins", r.Page.Margins)
+	set("media", r.Page.Media)
+	flag("single_page", r.Page.SinglePage)
+	flag("repeat_table_headers", r.Page.RepeatTableHeaders)
+	q["avoid_break"] = r.Page.AvoidBreak
+	q["break_before"] = r.Page.BreakBefore
+	q["break_after"] = r.Page.BreakAfter
+	set("auth", r.Auth.Key)
+	set("format", r.Output.Format)
+	flag("attachSource", r.Output.AttachSource)
+	flag("ocr", r.Output.OCR)
+	set("ocr_languages", r.Output.OCRLanguages)
+	if r.Output.DPI != 0 {
+		set("dpi", strconv.Itoa(r.Output.DPI))
+	}
+	flag("strip_external_links", r.Output.StripExternalLinks)
+	if len(r.Output.Codes) > 0 {
+		set("codes", string(r.Output.Codes))
+	}
+	flag("grayscale", r.Output.Grayscale)
+	set("icc_profile", r.Output.ICCProfile)
+	set("email_attachments", r.Output.EmailAttachments)
+	set("redact", strings.Join(r.Output.Redact, ","))
+	flag("async", r.Delivery.Async)
+	if s3 := r.Delivery.S3; s3 != nil {
+		set("s3_bucket", s3.Bucket)
+		set("s3_key", s3.Key)
+		set("s3_acl", s3.ACL)
+		set("aws_region", s3.Region)
+		set("aws_id", s3.AccessKey)
+		set("aws_secret", s3.AccessSecret)
+		flag("s3_dedupe", s3.Dedupe)
+		if s3.RetentionDays != 0 {
+			set("retention_days", strconv.Itoa(s3.RetentionDays))
+		}
+	}
+	flag("includeSource", r.Delivery.IncludeSource)
+	flag("includeArchive", r.Delivery.IncludeArchive)
+	flag("dryRun", r.DryRun)
+	for k, v := range q {
+		if len(v) == 0 {
+			delete(q, k)
+		}
+	}
+	return q
+}
+
+// ConversionRequestMiddleware decodes, and validates the JSON body of a v2
+// conversion request, and sets it in the context. Its options replace the
+// query parameters, so that the request is authorized, audited, and
+// converted exactly as a v1 request.
+func ConversionRequestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ConversionRequest
+		body, err := bufferBody(c)
+		if err == ErrUploadTooLarge {
+			c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		if err != nil || json.Unmarshal(body, &req) != nil {
+			c.AbortWithError(http.StatusBadRequest, ErrRequestInvalid).SetType(gin.ErrorTypePublic)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		setRequestQuery(c, req)
+		c.Set("conversion_request", req)
+	}
+}
+
+// setRequestQuery replaces the query parameters of a request with the
+// options of a v2 conversion request. The auth key is taken from the
+// 'Authorization: Bearer <key>' header if the options do not have one.
+func setRequestQuery(c *gin.Context, req ConversionRequest) {
+	q := req.Query()
+	if q.Get("auth") == "" {
+		if auth := c.Request.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			q.Set("auth", strings.TrimPrefix(auth, "Bearer "))
+		}
+	}
+	c.Request.URL.RawQuery = q.Encode()
+}
+
+// convertV2Handler converts the source of a v2 conversion request (see
+// ConversionRequestMiddleware).
+func convertV2Handler(c *gin.Context) {
+	req := c.MustGet("conversion_request").(ConversionRequest)
+	if len(req.Sections) > 0 {
+		sectionsHandler(c, req)
+		return
+	}
+	if req.Source.URL != "" {
+		convertByURLHandler(c)
+		return
+	}
+
+	var content io.Reader = strings.NewReader(req.Source.Content)
+	if req.Source.Encoding == "base64" {
+		content = base64.NewDecoder(base64.StdEncoding, content)
+	}
+	name := "document"
+	if req.Source.Ext != "" {
+		name += "." + req.Source.Ext
+	}
+	convertUpload(c, name, content)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+)
+
+func TestConversionRequestQuery(t *testing.T) {
+	req := ConversionRequest{
+		Source:   SourceOptions{URL: "https://example.com", HostMap: map[string]string{"staging.internal": "10.0.3.7"}},
+		Engine:   EngineOptions{Aggressive: true, Block: []string{"ads", "fonts"}, Locale: "de-DE", Delay: 500},
+		Page:     PageOptions{Size: "A4", Landscape: true, Margins: "none", Media: "screen"},
+		Auth:     AuthOptions{Key: "123456"},
+		Output:   OutputOptions{Format: "text"},
+		Delivery: DeliveryOptions{S3: &S3Delivery{Bucket: "bucket", Key: "reports/", Dedupe: true}, IncludeSource: true, IncludeArchive: true},
+		DryRun:   true,
+	}
+	want := url.Values{
+		"url":            {"https://example.com"},
+		"host_map":       {"staging.internal=10.0.3.7"},
+		"aggressive":     {"true"},
+		"block":          {"ads", "fonts"},
+		"locale":         {"de-DE"},
+		"delay":          {"500"},
+		"page_size":      {"A4"},
+		"no_portrait":    {"true"},
+		"margins":        {"none"},
+		"media":          {"screen"},
+		"auth":           {"123456"},
+		"format":         {"text"},
+		"s3_bucket":      {"bucket"},
+		"s3_key":         {"reports/"},
+		"s3_dedupe":      {"true"},
+		"includeSource":  {"true"},
+		"includeArchive": {"true"},
+		"dryRun":         {"true"},
+	}
+	if got := req.Query(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected query of conversion request to be %v, got %v", want, got)
+	}
+}
+
+func TestConversionRequestValidate(t *testing.T) {
+	tests := []struct {
+		req ConversionRequest
+		err error
+	}{
+		{ConversionRequest{Source: SourceOptions{URL: "https://example.com"}}, nil},
+		{ConversionRequest{Source: SourceOptions{Content: "PGgxPg==", Encoding: "base64"}}, nil},
+		{ConversionRequest{}, ErrSourceInvalid},
+		{ConversionRequest{Source: SourceOptions{URL: "https://example.com", Content: "<h1>"}}, ErrSourceInvalid},
+		{ConversionRequest{Source: SourceOptions{Content: "<h1>", Encoding: "gzip"}}, ErrEncodingInvalid},
+		{ConversionRequest{Source: SourceOptions{Content: "<h1>"}, Delivery: DeliveryOptions{Async: true}}, ErrAsyncContent},
+		{ConversionRequest{Sections: []SectionOptions{{URL: "https://example.com"}, {URL: "https://example.com/b"}}}, nil},
+		{ConversionRequest{Source: SourceOptions{URL: "https://example.com"}, Sections: []SectionOptions{{Orientation: "landscape"}}}, nil},
+		{ConversionRequest{Sections: []SectionOptions{{Select: "#tables"}}}, ErrSectionSourceMissing},
+		{ConversionRequest{Source: SourceOptions{Content: "<h1>"}, Sections: []SectionOptions{{URL: "https://example.com"}}}, ErrSectionsUnsupported},
+	}
+	for _, tt := range tests {
+		if err := tt.req.Validate(); err != tt.err {
+			t.Errorf("expected validation of %+v to return %v, got %v", tt.req, tt.err, err)
+		}
+	}
+}
+
+func mockV2Router(conf Config) *gin.Engine {
+	return mockRouter(conf, Services{Queue: converter.InitWorkers(1, 1, 10)}, InitSecureRoutes)
+}
+
+func TestConvertV2Handler(t *testing.T) {
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "echo"
+	r := mockV2Router(conf)
+
+	content := base64.StdEncoding.EncodeToString([]byte("# test v2"))
+	tests := []struct {
+		body   string
+		header string
+		code   int
+	}{
+		{`{"source": {"content": "` + content + `", "encoding": "base64", "ext": "md"}, "auth": {"key": "123456"}}`, "", http.StatusOK},
+		{`{"source": {"content": "<h1>test v2</h1>"}}`, "Bearer 123456", http.StatusOK},
+		{`{"source": {"content": "<h1>test v2</h1>"}}`, "", http.StatusUnauthorized},
+		{`{"source": {"content": "<h1>test v2</h1>"}, "output": {"format": "docx"}, "auth": {"key": "123456"}}`, "", http.StatusBadRequest},
+		{`{"source": {}}`, "Bearer 123456", http.StatusBadRequest},
+		{`not json`, "Bearer 123456", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v2/conversions", strings.NewReader(tt.body))
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		r.ServeHTTP(recorder{res}, req)
+		if got := res.Code; got != tt.code {
+			t.Errorf("expected response code of %s to be %d, got %d (%s)", tt.body, tt.code, got, res.Body)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/registry"
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+var (
+	// ErrDigestInvalid should be returned when a document is verified by a
+	// digest that is not a SHA-256 digest.
+	ErrDigestInvalid = errors.New("invalid digest provided (expected a hex SHA-256 digest)")
+	// ErrVerifyTooLarge should be returned when the body of a document
+	// upload to verify is larger than its limit.
+	ErrVerifyTooLarge = errors.New("document is larger than the verification limit (WEAVER_REGISTRY_MAX_BYTES)")
+)
+
+// documentRecord returns the registry record of the output of a conversion.
+func documentRecord(job, tenant, format string, r *converter.Report) registry.Record {
+	return registry.Record{
+		SHA256: r.SHA256,
+		Time:   time.Now().UTC(),
+		Job:    job,
+		Tenant: tenant,
+		Format: format,
+		Pages:  r.Pages,
+		Bytes:  r.Bytes,
+	}
+}
+
+// RecordDocumentMiddleware records the output of the successful conversion
+// of a request to the document registry once it has finished. Asynchronous
+// conversions are recorded by the consumer instead.
+func RecordDocumentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		report, ok := c.Get("report")
+		if !ok || report.(*converter.Report).SHA256 == "" || c.Writer.Status() != http.StatusOK || len(c.Errors) > 0 {
+			return
+		}
+		format, _ := outputFormat(c)
+		r := documentRecord(c.GetString("job"), tenantID(c), format, report.(*converter.Report))
+		if err := c.MustGet("registry").(registry.Store).Add(r); err != nil {
+			log.Printf("[Registry] unable to record the output of job %s: %+v\n", r.Job, err)
+		}
+	}
+}
+
+// Verification is the response of a document verification. The job, and the
+// tenant of the document are not disclosed to recipients.
+type Verification struct {
+	Verified bool   `json:"verified"`
+	SHA256   string `json:"sha256"`
+	// The time the document was verified, so that a signed verification is
+	// dated.
+	CheckedAt time.Time `json:"checked_at"`
+	// The time the document was produced, and its metadata, if it is
+	// verified.
+	ProducedAt *time.Time `json:"produced_at,omitempty"`
+	Format     string     `json:"format,omitempty"`
+	Pages      int        `json:"pages,omitempty"`
+	Bytes      int        `json:"bytes,omitempty"`
+}
+
+var verificationPage = template.Must(template.New("verification").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Document verification</title>
+<style>
+body { font: 11pt/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 40em; margin: 3em auto; padding: 0 1em; }
+.status { font-size: 16pt; font-weight: 600; }
+.verified { color: #1b7f3b; } .unverified { color: #b00020; }
+code { word-break: break-all; }
+th { text-align: left; padding-right: 1em; font-weight: 600; }
+</style>
+</head>
+<body>
+{{if .Verified}}<p class="status verified">&#10003; This document was produced by this service, and has not been altered.</p>
+<table>
+<tr><th>Produced</th><td>{{.ProducedAt.Format "2 Jan 2006 15:04:05 UTC"}}</td></tr>
+<tr><th>Format</th><td>{{.Format}}</td></tr>
+{{if .Pages}}<tr><th>Pages</th><td>{{.Pages}}</td></tr>{{end}}
+<tr><th>Size</th><td>{{.Bytes}} bytes</td></tr>
+<tr><th>SHA-256</th><td><code>{{.SHA256}}</code></td></tr>
+</table>
+{{else}}<p class="status unverified">&#10007; No document with this digest was produced by this service.</p>
+<p>The document may have been altered, or produced elsewhere.</p>
+<p>SHA-256: <code>{{.SHA256}}</code></p>
+{{end}}<p>Checked {{.CheckedAt.Format "2 Jan 2006 15:04:05 UTC"}}.</p>
+</body>
+</html>
+`))
+
+// verify responds with the verification of a digest: JSON, or a
+// verification page for browsers. Unknown digests respond with 404. If a
+// signing key is configured, the body of the response is signed (see
+// signVerification).
+func verify(c *gin.Context, digest string) {
+	s := c.MustGet("statsd").(*statsd.Client)
+
+	v := Verification{SHA256: digest, CheckedAt: time.Now().UTC()}
+	r, err := c.MustGet("registry").(registry.Store).Get(digest)
+	switch err {
+	case nil:
+		v.Verified = true
+		v.ProducedAt = &r.Time
+		v.Format, v.Pages, v.Bytes = r.Format, r.Pages, r.Bytes
+		s.Increment("verify_verified")
+	case registry.ErrNotFound:
+		s.Increment("verify_unverified")
+	default:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	code := http.StatusOK
+	if !v.Verified {
+		code = http.StatusNotFound
+	}
+	var body bytes.Buffer
+	contentType := "application/json; charset=utf-8"
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		contentType = "text/html; charset=utf-8"
+		err = verificationPage.Execute(&body, v)
+	} else {
+		err = json.NewEncoder(&body).Encode(v)
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	signVerification(c, body.Bytes())
+	c.Data(code, contentType, body.Bytes())
+}
+
+// signVerification sets the 'X-Weaver-Signature' header of a verification
+// to 'ed25519=' followed by the base64 encoded Ed25519 signature of its body,
+// if a signing key is configured, so that a recipient can prove what the
+// service responded (e.g. with a saved copy of the verification page).
+func signVerification(c *gin.Context, body []byte) {
+	key, _ := c.MustGet("config").(Config).Registry.signingKey()
+	if key == nil {
+		return
+	}
+	c.Header("X-Weaver-Signature", "ed25519="+base64.StdEncoding.EncodeToString(ed25519.Sign(key, body)))
+}
+
+// verificationKeyHandler responds with the base64 encoded Ed25519 public key
+// that verifications are signed with, or 404 if they are not signed.
+func verificationKeyHandler(c *gin.Context) {
+	key, _ := c.MustGet("config").(Config).Registry.signingKey()
+	if key == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	})
+}
+
+// verifyHandler verifies a document by its hex SHA-256 digest, so that
+// recipients can confirm that it was produced by this service, and has not
+// been altered since.
+func verifyHandler(c *gin.Context) {
+	digest, ok := registry.Normalize(c.Param("sha256"))
+	if !ok {
+		c.AbortWithError(http.StatusBadRequest, ErrDigestInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	verify(c, digest)
+}
+
+// verifyDocumentHandler verifies an uploaded document ('file'), for
+// recipients who cannot compute its digest. As it requires no auth key, the
+// body is limited (see Registry.MaxBytes, and the upload limit) before the
+// form is parsed. The document must also fit in the spool quota.
+func verifyDocumentHandler(c *gin.Context) {
+	conf := c.MustGet("config").(Config)
+	limit := conf.Registry.MaxBytes
+	if conf.MaxUploadBytes > 0 && conf.MaxUploadBytes < limit {
+		limit = conf.MaxUploadBytes
+	}
+	if c.Request.ContentLength > limit {
+		c.AbortWithError(http.StatusRequestEntityTooLarge, ErrVerifyTooLarge).SetType(gin.ErrorTypePublic)
+		return
+	}
+	body := &limitedBody{ReadCloser: c.Request.Body, remaining: limit}
+	c.Request.Body = body
+	err := c.Request.ParseMultipartForm(maxUploadMemory)
+	if body.exceeded {
+		c.AbortWithError(http.StatusRequestEntityTooLarge, ErrVerifyTooLarge).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	defer file.Close()
+	used := 0
+	b, err := readLimited(file, conf.Spool.MaxBytes, &used)
+	if err == ErrSourceTooLarge {
+		c.AbortWithError(http.StatusRequestEntityTooLarge, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrFileInvalid).SetType(gin.ErrorTypePublic)
+		return
+	}
+	verify(c, converter.Digest(b))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lachee/athenapdf/weaver/converter"
+	"github.com/lachee/athenapdf/weaver/registry"
+)
+
+func TestVerifyHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "converter.sh")
+	ioutil.WriteFile(script, []byte("cat <<'PDF'\n"+onePagePDF+"PDF\n"), 0644)
+
+	conf := defaultConfig()
+	conf.AuthKey = "123456"
+	conf.AthenaCMD = "sh " + script
+	svc := Services{Queue: converter.InitWorkers(1, 10, 10), Registry: registry.NewMemoryStore(10)}
+	r := mockRouter(conf, svc, InitSecureRoutes)
+
+	res := streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(res, uploadRequest("/convert?auth=123456&ext=html", "page.html", []byte("<p>Certificate</p>")))
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+	out := res.Body.Bytes()
+	digest := res.Header().Get("X-Output-SHA256")
+	if got, want := digest, converter.Digest(out); got != want {
+		t.Fatalf("expected the digest of the output to be %s, got %s", want, got)
+	}
+
+	tests := []struct {
+		req      *http.Request
+		code     int
+		verified bool
+	}{
+		{httptest.NewRequest("GET", "/verify/"+digest, nil), http.StatusOK, true},
+		{httptest.NewRequest("GET", "/verify/"+strings.ToUpper(digest), nil), http.StatusOK, true},
+		{uploadRequest("/verify", "certificate.pdf", out), http.StatusOK, true},
+		{uploadRequest("/verify", "certificate.pdf", append(out, '\n')), http.StatusNotFound, false},
+		{httptest.NewRequest("GET", "/verify/"+strings.Repeat("0", 64), nil), http.StatusNotFound, false},
+		{httptest.NewRequest("GET", "/verify/certificate", nil), http.StatusBadRequest, false},
+	}
+	for i, tt := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, tt.req)
+		if got, want := res.Code, tt.code; got != want {
+			t.Errorf("expected response code of request %d to be %d, got %d: %s", i, want, got, res.Body.String())
+			continue
+		}
+		if tt.code == http.StatusBadRequest {
+			continue
+		}
+		var v Verification
+		if err := json.Unmarshal(res.Body.Bytes(), &v); err != nil {
+			t.Fatalf("unable to decode verification: %+v", err)
+		}
+		if v.Verified != tt.verified {
+			t.Errorf("expected verification of request %d to be %t, got %+v", i, tt.verified, v)
+		}
+		if tt.verified && (v.Pages != 1 || v.Format != "pdf" || v.ProducedAt == nil) {
+			t.Errorf("expected the metadata of the document of request %d, got %+v", i, v)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/verify/"+digest, nil)
+	req.Header.Set("Accept", "text/html")
+	res = streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(res, req)
+	if body := res.Body.String(); !strings.Contains(body, "has not been altered") || !strings.Contains(body, digest) {
+		t.Errorf("expected a verification page, got %s", body)
+	}
+}
+
+func TestVerifyHandler_signed(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	conf := defaultConfig()
+	conf.Registry.SigningKey = base64.StdEncoding.EncodeToString(seed)
+	store := registry.NewMemoryStore(10)
+	digest := converter.Digest([]byte("certificate"))
+	store.Add(registry.Record{SHA256: digest, Time: time.Now().UTC(), Format: "pdf", Bytes: 11})
+	r := mockRouter(conf, Services{Registry: store}, InitSecureRoutes)
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/verification-key", nil))
+	var key struct {
+		PublicKey []byte `json:"public_key"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &key); err != nil || len(key.PublicKey) != ed25519.PublicKeySize {
+		t.Fatalf("expected the public key, got %s", res.Body.String())
+	}
+
+	for _, accept := range []string{"application/json", "text/html"} {
+		req := httptest.NewRequest("GET", "/verify/"+digest, nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(res.Header().Get("X-Weaver-Signature"), "ed25519="))
+		if err != nil || !ed25519.Verify(key.PublicKey, res.Body.Bytes(), sig) {
+			t.Errorf("expected the %s verification to be signed, got %q", accept, res.Header().Get("X-Weaver-Signature"))
+		}
+	}
+
+	// Verifications are not signed without a key
+	r = mockRouter(defaultConfig(), Services{Registry: store}, InitSecureRoutes)
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/verify/"+digest, nil))
+	if got := res.Header().Get("X-Weaver-Signature"); got != "" {
+		t.Errorf("expected no signature, got %q", got)
+	}
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/verification-key", nil))
+	if got, want := res.Code, http.StatusNotFound; got != want {
+		t.Errorf("expected response code to be %d, got %d", want, got)
+	}
+}
+
+func TestVerifyDocumentHandler_tooLarge(t *testing.T) {
+	conf := defaultConfig()
+	conf.Registry.MaxBytes = 1024
+	r := mockRouter(conf, Services{Registry: registry.NewMemoryStore(10)}, InitSecureRoutes)
+
+	// Bodies are limited whether they declare their size, or not
+	for _, chunked := range []bool{false, true} {
+		req := uploadRequest("/verify", "certificate.pdf", bytes.Repeat([]byte("x"), 2048))
+		if chunked {
+			req.ContentLength = -1
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if got, want := res.Code, http.StatusRequestEntityTooLarge; got != want {
+			t.Errorf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+		}
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, uploadRequest("/verify", "certificate.pdf", []byte("certificate")))
+	if got, want := res.Code, http.StatusNotFound; got != want {
+		t.Errorf("expected response code to be %d, got %d: %s", want, got, res.Body.String())
+	}
+}
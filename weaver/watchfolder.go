@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/lachee/athenapdf/weaver/converter/athenapdf"
+	"github.com/lachee/athenapdf/weaver/watchfolder"
+)
+
+// outputExtensions are the extensions of the outputs of the formats.
+var outputExtensions = map[string]string{
+	athenapdf.FormatPDF:      ".pdf",
+	athenapdf.FormatText:     ".txt",
+	athenapdf.FormatMarkdown: ".md",
+	athenapdf.FormatMHTML:    ".mhtml",
+	athenapdf.FormatHTML:     ".html",
+	athenapdf.FormatPNG:      ".png",
+	athenapdf.FormatTIFF:     ".tiff",
+}
+
+// NewWatchFolder creates the watch folder of the configured directory (see
+// WatchFolder), if any, converting its files with the conversion routes of
+// the handler.
+func NewWatchFolder(conf Config, handler http.Handler) (*watchfolder.Folder, error) {
+	if conf.WatchFolder.Dir == "" {
+		return nil, nil
+	}
+	f, err := watchfolder.New(conf.WatchFolder.Dir, conf.WatchFolder.OutputDir, folderConversion(conf, handler))
+	if err != nil {
+		return nil, err
+	}
+	f.Workers = conf.MaxWorkers
+	return f, nil
+}
+
+// folderConversion returns the function converting the files of the watch
+// folder, by uploading them to the conversion route (in-process), exactly as
+// a one-shot conversion (see convert).
+func folderConversion(conf Config, handler http.Handler) watchfolder.ConvertFunc {
+	params, _ := url.ParseQuery(conf.WatchFolder.Params)
+	ext, ok := outputExtensions[params.Get("format")]
+	if !ok {
+		ext = ".pdf"
+	}
+	return func(path string) (watchfolder.Result, error) {
+		req, err := conversionRequest(conf, path, convertOptions{Params: params})
+		if err != nil {
+			return watchfolder.Result{}, err
+		}
+		res, err := serveConversion(handler, req)
+		if err != nil {
+			var code string
+			if ce, ok := err.(*conversionError); ok {
+				code = ce.Code
+			}
+			return watchfolder.Result{Code: code}, err
+		}
+		pages, _ := strconv.Atoi(res.Header().Get("X-Page-Count"))
+		return watchfolder.Result{
+			Output: res.Body.Bytes(),
+			Ext:    ext,
+			Pages:  pages,
+			SHA256: res.Header().Get("X-Output-SHA256"),
+		}, nil
+	}
+}
@@ -0,0 +1,218 @@
+// Package watchfolder converts the files appearing in a directory, writing
+// their outputs to another directory, each with a sidecar JSON status file,
+// so that on-premise workflows can convert documents by copying them.
+package watchfolder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailedDir is the subdirectory of the input directory that the files which
+// failed to be converted are moved to.
+const FailedDir = "failed"
+
+const (
+	// StatusCompleted is the status of a converted file.
+	StatusCompleted = "completed"
+	// StatusFailed is the status of a file that failed to be converted.
+	StatusFailed = "failed"
+)
+
+// Result is the result of a conversion.
+type Result struct {
+	// Output is the converted document.
+	Output []byte
+	// Ext is the extension of the output (with its dot), e.g. '.pdf'.
+	Ext    string
+	Pages  int
+	SHA256 string
+	// Code is the error code of a failed conversion (if any).
+	Code string
+}
+
+// ConvertFunc converts the file at a path.
+type ConvertFunc func(path string) (Result, error)
+
+// Status is the sidecar status file of a converted file, written next to its
+// output as '<name>.json'.
+type Status struct {
+	Source      string    `json:"source"`
+	Status      string    `json:"status"`
+	Output      string    `json:"output,omitempty"`
+	Pages       int       `json:"pages,omitempty"`
+	Bytes       int       `json:"bytes,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Code        string    `json:"code,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// file is the size, and modification time of a file when it was last
+// scanned.
+type file struct {
+	size    int64
+	modTime time.Time
+}
+
+// Folder is a watched input directory, and its output directory.
+type Folder struct {
+	In      string
+	Out     string
+	Convert ConvertFunc
+	// Workers is the number of files converted at once.
+	Workers int
+
+	mu   sync.Mutex
+	seen map[string]file
+}
+
+// New creates a watch folder of the input directory, creating it, its failed
+// subdirectory, and the output directory if they do not exist.
+func New(in, out string, convert ConvertFunc) (*Folder, error) {
+	for _, dir := range []string{filepath.Join(in, FailedDir), out} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Folder{In: in, Out: out, Convert: convert, Workers: 1, seen: make(map[string]file)}, nil
+}
+
+// Scan returns the names of the files of the input directory that are ready
+// to be converted: files whose size, and modification time have not changed
+// since the previous scan, so that files being copied are not converted
+// until they are complete. Hidden files, and subdirectories are ignored.
+func (f *Folder) Scan() ([]string, error) {
+	infos, err := ioutil.ReadDir(f.In)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ready []string
+	seen := make(map[string]file, len(infos))
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		cur := file{size: fi.Size(), modTime: fi.ModTime()}
+		if prev, ok := f.seen[fi.Name()]; ok && prev == cur {
+			ready = append(ready, fi.Name())
+			continue
+		}
+		seen[fi.Name()] = cur
+	}
+	f.seen = seen
+	return ready, nil
+}
+
+// Process converts a file of the input directory, and writes its output, and
+// status file to the output directory. The file is removed once it has been
+// converted, or moved to the failed subdirectory if it could not be.
+func (f *Folder) Process(name string) error {
+	src := filepath.Join(f.In, name)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	status := Status{Source: name, StartedAt: time.Now().UTC()}
+
+	res, err := f.Convert(src)
+	if err == nil {
+		status.Output = stem + res.Ext
+		err = writeFile(filepath.Join(f.Out, status.Output), res.Output)
+	}
+	status.CompletedAt = time.Now().UTC()
+	if err != nil {
+		status.Status, status.Output = StatusFailed, ""
+		status.Error, status.Code = err.Error(), res.Code
+	} else {
+		status.Status = StatusCompleted
+		status.Pages, status.Bytes, status.SHA256 = res.Pages, len(res.Output), res.SHA256
+	}
+
+	b, merr := json.MarshalIndent(status, "", "  ")
+	if merr != nil {
+		return merr
+	}
+	if werr := writeFile(filepath.Join(f.Out, stem+".json"), append(b, '\n')); werr != nil {
+		return werr
+	}
+	if err != nil {
+		log.Printf("[WatchFolder] unable to convert %s: %+v\n", name, err)
+		return os.Rename(src, filepath.Join(f.In, FailedDir, name))
+	}
+	return os.Remove(src)
+}
+
+// writeFile writes a file of the output directory atomically, so that
+// readers never see a partial file.
+func writeFile(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".watchfolder")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// run converts the files that are ready, with up to Workers at once.
+func (f *Folder) run() {
+	names, err := f.Scan()
+	if err != nil {
+		log.Printf("[WatchFolder] unable to scan %s: %+v\n", f.In, err)
+		return
+	}
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := f.Process(name); err != nil {
+				log.Printf("[WatchFolder] unable to process %s: %+v\n", name, err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+// Start scans the input directory every interval, converting the files that
+// are ready, until the done channel is closed.
+func (f *Folder) Start(interval time.Duration, done <-chan struct{}) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				f.run()
+			}
+		}
+	}()
+}
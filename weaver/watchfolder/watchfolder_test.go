@@ -0,0 +1,117 @@
+package watchfolder
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestFolder(t *testing.T, convert ConvertFunc) (*Folder, func()) {
+	dir, err := ioutil.TempDir("", "watchfolder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(filepath.Join(dir, "in"), filepath.Join(dir, "out"), convert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, func() { os.RemoveAll(dir) }
+}
+
+func readStatus(t *testing.T, path string) Status {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Status
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScan(t *testing.T) {
+	f, cleanup := newTestFolder(t, nil)
+	defer cleanup()
+	for _, name := range []string{"a.html", ".b.html"} {
+		if err := ioutil.WriteFile(filepath.Join(f.In, name), []byte("<p>a</p>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ready, err := f.Scan(); err != nil || len(ready) != 0 {
+		t.Fatalf("expected no ready files on the first scan, got %v (%+v)", ready, err)
+	}
+	ready, err := f.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ready, []string{"a.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestScan_changed(t *testing.T) {
+	f, cleanup := newTestFolder(t, nil)
+	defer cleanup()
+	path := filepath.Join(f.In, "a.html")
+	ioutil.WriteFile(path, []byte("<p>a"), 0644)
+	f.Scan()
+	ioutil.WriteFile(path, []byte("<p>a</p>"), 0644)
+
+	if ready, _ := f.Scan(); len(ready) != 0 {
+		t.Errorf("expected no ready files while a file is written, got %v", ready)
+	}
+	if ready, _ := f.Scan(); len(ready) != 1 {
+		t.Errorf("expected the written file to be ready, got %v", ready)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	f, cleanup := newTestFolder(t, func(path string) (Result, error) {
+		return Result{Output: []byte("%PDF-1.4"), Ext: ".pdf", Pages: 2, SHA256: "abc"}, nil
+	})
+	defer cleanup()
+	src := filepath.Join(f.In, "report.html")
+	ioutil.WriteFile(src, []byte("<p>a</p>"), 0644)
+
+	if err := f.Process("report.html"); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(f.Out, "report.pdf")); err != nil || string(b) != "%PDF-1.4" {
+		t.Errorf("expected the output to be written, got %q (%+v)", b, err)
+	}
+	s := readStatus(t, filepath.Join(f.Out, "report.json"))
+	if s.Status != StatusCompleted || s.Source != "report.html" || s.Output != "report.pdf" || s.Pages != 2 || s.Bytes != 8 || s.SHA256 != "abc" {
+		t.Errorf("expected a completed status, got %+v", s)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed, got %+v", err)
+	}
+}
+
+func TestProcess_failed(t *testing.T) {
+	f, cleanup := newTestFolder(t, func(path string) (Result, error) {
+		return Result{Code: "RENDER_FAILED"}, errors.New("conversion failed")
+	})
+	defer cleanup()
+	ioutil.WriteFile(filepath.Join(f.In, "report.html"), []byte("<p>a</p>"), 0644)
+
+	if err := f.Process("report.html"); err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(f.Out, "report.pdf")); !os.IsNotExist(err) {
+		t.Errorf("expected no output, got %+v", err)
+	}
+	s := readStatus(t, filepath.Join(f.Out, "report.json"))
+	if s.Status != StatusFailed || s.Error != "conversion failed" || s.Code != "RENDER_FAILED" || s.Output != "" {
+		t.Errorf("expected a failed status, got %+v", s)
+	}
+	if _, err := os.Stat(filepath.Join(f.In, FailedDir, "report.html")); err != nil {
+		t.Errorf("expected the file to be moved to %s, got %+v", FailedDir, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestFolderConversion(t *testing.T) {
+	f, err := ioutil.TempFile("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("<p>report</p>")
+	f.Close()
+
+	conf := defaultConfig()
+	conf.AuthKey = "secret"
+	conf.WatchFolder.Params = "format=png&dpi=150"
+	var query string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("X-Page-Count", "1")
+		w.Header().Set("X-Output-SHA256", "abc")
+		w.Write([]byte("png"))
+	})
+
+	res, err := folderConversion(conf, handler)(f.Name())
+	if err != nil {
+		t.Fatalf("expected no error, got %+v", err)
+	}
+	if got, want := query, "auth=secret&dpi=150&format=png"; got != want {
+		t.Errorf("expected query %q, got %q", want, got)
+	}
+	if string(res.Output) != "png" || res.Ext != ".png" || res.Pages != 1 || res.SHA256 != "abc" {
+		t.Errorf("expected the output of the conversion, got %+v", res)
+	}
+}
+
+func TestFolderConversion_error(t *testing.T) {
+	f, err := ioutil.TempFile("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"INVALID_OPTIONS","error":"invalid page size provided"}`))
+	})
+	res, err := folderConversion(defaultConfig(), handler)(f.Name())
+	if err == nil || err.Error() != "invalid page size provided" {
+		t.Errorf("expected the error of the response, got %+v", err)
+	}
+	if got, want := res.Code, "INVALID_OPTIONS"; got != want {
+		t.Errorf("expected code %q, got %q", want, got)
+	}
+}